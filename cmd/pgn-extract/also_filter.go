@@ -0,0 +1,220 @@
+// also_filter.go - A second set of match criteria evaluated in the same pass
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+	"github.com/lgbarn/pgn-extract-go/internal/cql"
+	"github.com/lgbarn/pgn-extract-go/internal/matching"
+	"github.com/lgbarn/pgn-extract-go/internal/output"
+)
+
+// filterSet is a set of match criteria read from an --also-filter file:
+// tag criteria, positions, CQL, variations and material, with the same
+// flags as on the command line.
+type filterSet struct {
+	gameFilter       *matching.GameFilter
+	cqlNode          cql.Node
+	variationMatcher *matching.VariationMatcher
+	materialMatcher  *matching.MaterialMatcher
+	negate           bool
+}
+
+// parseFilterSet builds a filter set from criteria flags. Tag matching
+// uses the options given on the command line (-S, --match-case...).
+func parseFilterSet(args []string) (*filterSet, error) {
+	fs := flag.NewFlagSet("also-filter", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	tags := fs.String("t", "", "")
+	player := fs.String("p", "", "")
+	white := fs.String("Tw", "", "")
+	black := fs.String("Tb", "", "")
+	ecoPrefix := fs.String("Te", "", "")
+	result := fs.String("Tr", "", "")
+	fen := fs.String("Tf", "", "")
+	query := fs.String("cql", "", "")
+	queryFile := fs.String("cql-file", "", "")
+	variations := fs.String("v", "", "")
+	positions := fs.String("x", "", "")
+	material := fs.String("z", "", "")
+	materialExact := fs.String("y", "", "")
+	window := fs.String("zwindow", "", "")
+	plies := fs.Int("zplies", 0, "")
+	negate := fs.Bool("n", false, "")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	set := &filterSet{gameFilter: matching.NewGameFilter(), negate: *negate}
+	gf := set.gameFilter
+	gf.SetUseSoundex(*useSoundex)
+	gf.SetSubstringMatch(*tagSubstring)
+	gf.SetCaseSensitive(*matchCase)
+	gf.SetAnchored(*matchAnchor)
+	gf.SetExactMatch(*matchExact)
+	if *tags != "" {
+		if err := gf.LoadTagFile(*tags); err != nil {
+			return nil, fmt.Errorf("tag file %s: %w", *tags, err)
+		}
+	}
+	if *player != "" {
+		gf.AddPlayerFilter(*player)
+	}
+	if *white != "" {
+		gf.AddWhiteFilter(*white)
+	}
+	if *black != "" {
+		gf.AddBlackFilter(*black)
+	}
+	if *ecoPrefix != "" {
+		gf.AddECOFilter(*ecoPrefix)
+	}
+	if *result != "" {
+		gf.AddResultFilter(*result)
+	}
+	if *fen != "" {
+		if err := gf.AddFENFilter(*fen); err != nil {
+			return nil, fmt.Errorf("FEN filter: %w", err)
+		}
+	}
+	gf.PositionMatcher.SetPlyFilter(matchPlyFilter())
+
+	if *queryFile != "" {
+		content, err := os.ReadFile(*queryFile)
+		if err != nil {
+			return nil, err
+		}
+		*query = strings.TrimSpace(string(content))
+	}
+	if *query != "" {
+		node, err := cql.Parse(*query)
+		if err != nil {
+			return nil, fmt.Errorf("CQL query: %w", err)
+		}
+		set.cqlNode = node
+	}
+
+	if *variations != "" || *positions != "" {
+		set.variationMatcher = matching.NewVariationMatcher()
+		set.variationMatcher.SetMatchAnywhere(*varAnywhere)
+		if *variations != "" {
+			if err := set.variationMatcher.LoadFromFile(*variations); err != nil {
+				return nil, fmt.Errorf("variation file %s: %w", *variations, err)
+			}
+		}
+		if *positions != "" {
+			if err := set.variationMatcher.LoadPositionalFromFile(*positions); err != nil {
+				return nil, fmt.Errorf("position file %s: %w", *positions, err)
+			}
+		}
+	}
+
+	if *materialExact != "" {
+		set.materialMatcher = matching.NewMaterialMatcher(*materialExact, true)
+	} else if *material != "" {
+		set.materialMatcher = matching.NewMaterialMatcher(*material, false)
+	}
+	if set.materialMatcher != nil {
+		if *window != "" {
+			moves, err := parseMoveWindow(*window)
+			if err != nil {
+				return nil, fmt.Errorf("move window: %w", err)
+			}
+			set.materialMatcher.SetWindow(moves[0], moves[1])
+		}
+		set.materialMatcher.SetMinPlies(*plies)
+	}
+	return set, nil
+}
+
+// matches reports whether a game meets the set's criteria, or fails them
+// with -n in the set.
+func (set *filterSet) matches(stop context.Context, game *chess.Game) bool {
+	return set.matchesCriteria(stop, game) != set.negate
+}
+
+func (set *filterSet) matchesCriteria(stop context.Context, game *chess.Game) bool {
+	if set.gameFilter.HasCriteria() && !set.gameFilter.MatchGame(game) {
+		return false
+	}
+	if set.cqlNode != nil && !matchesCQL(stop, game, set.cqlNode) {
+		return false
+	}
+	if set.variationMatcher != nil && !set.variationMatcher.MatchGame(game) {
+		return false
+	}
+	if set.materialMatcher != nil && !set.materialMatcher.MatchGame(game) {
+		return false
+	}
+	return true
+}
+
+// alsoFilter writes the games matched by the --also-filter set to a
+// second output and counts the matches of each set and of both. The set
+// is matched by the workers, but record is only called from the single
+// result-consumer goroutine.
+type alsoFilter struct {
+	set  *filterSet
+	file *os.File
+
+	primary, secondary, both int
+}
+
+// setupAlsoFilter reads the --also-filter file and creates its output, or
+// returns nil if no second filter set is given.
+func setupAlsoFilter() *alsoFilter {
+	if *alsoFilterFile == "" {
+		return nil
+	}
+	args, err := loadArgsFile(*alsoFilterFile)
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error reading --also-filter file %s: %v\n", *alsoFilterFile, err)
+		os.Exit(1)
+	}
+	set, err := parseFilterSet(args)
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error in --also-filter file %s: %v\n", *alsoFilterFile, err)
+		os.Exit(1)
+	}
+	file, err := os.Create(*alsoOutput) //nolint:gosec // G304: filename is user-specified
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error creating --also-output file %s: %v\n", *alsoOutput, err)
+		os.Exit(1)
+	}
+	return &alsoFilter{set: set, file: file}
+}
+
+// record counts a game and writes it to the second output if the second
+// set matched it.
+func (af *alsoFilter) record(game *chess.Game, primary, secondary bool, cfg *config.Config) {
+	if primary {
+		af.primary++
+	}
+	if !secondary {
+		return
+	}
+	af.secondary++
+	if primary {
+		af.both++
+	}
+	withOutputFile(cfg, af.file, func() {
+		output.OutputGame(game, cfg)
+	})
+}
+
+// Close closes the second output and reports the match counts.
+func (af *alsoFilter) Close(log io.Writer) error {
+	fmt.Fprintf(log, "%d game(s) matched the filters, %d matched --also-filter, %d matched both.\n",
+		af.primary, af.secondary, af.both)
+	return af.file.Close()
+}
@@ -2,11 +2,15 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"strings"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
 	"github.com/lgbarn/pgn-extract-go/internal/cql"
 	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/matching"
 	"github.com/lgbarn/pgn-extract-go/internal/processing"
 )
 
@@ -22,42 +26,41 @@ func analyzeGame(game *chess.Game) (*chess.Board, *GameAnalysis) {
 	return processing.AnalyzeGame(game)
 }
 
-// replayGame replays a game from the initial position to get the final board state.
-// This is a thin wrapper around processing.ReplayGame.
-func replayGame(game *chess.Game) *chess.Board {
-	return processing.ReplayGame(game)
-}
-
 // validateGame validates all moves in a game are legal.
 // This is a thin wrapper around processing.ValidateGame.
 func validateGame(game *chess.Game) *ValidationResult {
 	return processing.ValidateGame(game)
 }
 
-// matchesCQL checks if any position in the game matches the CQL query.
-func matchesCQL(game *chess.Game, cqlNode cql.Node) bool {
-	board := engine.NewBoardForGame(game)
+// matchesCQL checks if any position in the game matches the CQL query,
+// searching until stop is done.
+func matchesCQL(stop context.Context, game *chess.Game, cqlNode cql.Node) bool {
+	return len(cql.NewQuery(cqlNode).MatchGame(game, cql.MatchOptions{PlyFilter: matchPlyFilter(), PieceValues: &pieceValues, Context: stop})) > 0
+}
 
-	// Create evaluator once and reuse for all positions
-	eval := cql.NewEvaluator(board)
+// cqlPositionOutput writes the positions matched by a CQL query as EPD
+// records tagged with the query name.
+type cqlPositionOutput struct {
+	name      string
+	games     bool // also write the matched games
+	positions bool
+}
 
-	// Check starting position
-	if eval.Evaluate(cqlNode) {
-		return true
+// writePositions writes every position in the game that matches the query.
+func (co *cqlPositionOutput) writePositions(w io.Writer, game *chess.Game, cqlNode cql.Node) {
+	for _, epd := range cqlMatchingPositions(game, cqlNode) {
+		fmt.Fprintf(w, "%s id \"%s\";\n", epd, co.name)
 	}
+}
 
-	// Check each position after a move
-	for move := game.Moves; move != nil; move = move.Next {
-		if !engine.ApplyMove(board, move) {
-			break
-		}
-		// Board is modified in place, evaluator already has pointer to it
-		if eval.Evaluate(cqlNode) {
-			return true
-		}
+// cqlMatchingPositions returns the EPD of each main-line position that
+// matches the CQL query.
+func cqlMatchingPositions(game *chess.Game, cqlNode cql.Node) []string {
+	var positions []string
+	for _, match := range cql.NewQuery(cqlNode).MatchGame(game, cql.MatchOptions{All: true, PlyFilter: matchPlyFilter(), PieceValues: &pieceValues}) {
+		positions = append(positions, engine.BoardToEPD(match.Board))
 	}
-
-	return false
+	return positions
 }
 
 // fixGame attempts to fix common issues in a game.
@@ -118,17 +121,16 @@ func fixResultTag(game *chess.Game) bool {
 	return true
 }
 
-// fixDateFormat normalizes date separators to dots.
+// fixDateFormat rewrites the Date tag in the PGN YYYY.MM.DD form. Values
+// that cannot be read as a date are left alone.
 func fixDateFormat(game *chess.Game) bool {
 	date := game.GetTag("Date")
 	if date == "" || date == "????.??.??" {
 		return false
 	}
 
-	normalizedDate := strings.ReplaceAll(date, "/", ".")
-	normalizedDate = strings.ReplaceAll(normalizedDate, "-", ".")
-
-	if normalizedDate == date {
+	normalizedDate, ok := normalizeDate(date)
+	if !ok || normalizedDate == date {
 		return false
 	}
 
@@ -160,3 +162,113 @@ func cleanString(s string) string {
 	}
 	return result.String()
 }
+
+// onlineVariants maps lowercase, letters-only variant names to their canonical form.
+var onlineVariants = map[string]string{
+	"standard":      "Standard",
+	"chess960":      "Chess960",
+	"fischerandom":  "Chess960",
+	"fischerrandom": "Chess960",
+	"fromposition":  "From Position",
+	"crazyhouse":    "Crazyhouse",
+	"kingofthehill": "King of the Hill",
+	"threecheck":    "Three-check",
+	"3check":        "Three-check",
+	"antichess":     "Antichess",
+	"giveaway":      "Antichess",
+	"suicide":       "Antichess",
+	"atomic":        "Atomic",
+	"horde":         "Horde",
+	"racingkings":   "Racing Kings",
+	"bughouse":      "Bughouse",
+}
+
+// normalizeOnlineTags rewrites platform-specific tags (Lichess, Chess.com and
+// similar) into a consistent form.
+func normalizeOnlineTags(game *chess.Game) bool {
+	fixed := normalizeUTCDateTime(game)
+	fixed = normalizeTermination(game) || fixed
+	fixed = normalizeVariant(game) || fixed
+	fixed = normalizeRatings(game) || fixed
+	return fixed
+}
+
+// normalizeUTCDateTime moves UTCDate/UTCTime into Date/Time.
+func normalizeUTCDateTime(game *chess.Game) bool {
+	fixed := false
+	if utcDate := game.GetTag("UTCDate"); utcDate != "" {
+		game.SetTag("Date", strings.NewReplacer("-", ".", "/", ".").Replace(utcDate))
+		delete(game.Tags, "UTCDate")
+		fixed = true
+	}
+	if utcTime := game.GetTag("UTCTime"); utcTime != "" {
+		game.SetTag("Time", utcTime)
+		delete(game.Tags, "UTCTime")
+		fixed = true
+	} else if start := game.GetTag("StartTime"); start != "" && !game.HasTag("Time") {
+		game.SetTag("Time", start)
+		fixed = true
+	}
+	return fixed
+}
+
+// normalizeTermination maps free-form Termination values onto the PGN
+// standard vocabulary.
+func normalizeTermination(game *chess.Game) bool {
+	value := game.GetTag("Termination")
+	if value == "" {
+		return false
+	}
+
+	normalized := string(matching.ClassifyTermination(value))
+	if normalized == "" || normalized == value {
+		return false
+	}
+	game.SetTag("Termination", normalized)
+	return true
+}
+
+// normalizeVariant canonicalizes the Variant tag name.
+func normalizeVariant(game *chess.Game) bool {
+	value := game.GetTag("Variant")
+	if value == "" {
+		return false
+	}
+
+	var key strings.Builder
+	for _, r := range strings.ToLower(value) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			key.WriteRune(r)
+		}
+	}
+
+	canonical, ok := onlineVariants[key.String()]
+	if !ok || canonical == value {
+		return false
+	}
+	game.SetTag("Variant", canonical)
+	return true
+}
+
+// normalizeRatings maps alternative rating tags onto WhiteElo/BlackElo and
+// drops placeholder values such as "?".
+func normalizeRatings(game *chess.Game) bool {
+	fixed := false
+	for _, side := range []string{"White", "Black"} {
+		eloTag := side + "Elo"
+		for _, alt := range []string{side + "Rating", side + "ELO"} {
+			if value := game.GetTag(alt); value != "" {
+				if game.GetTag(eloTag) == "" {
+					game.SetTag(eloTag, value)
+				}
+				delete(game.Tags, alt)
+				fixed = true
+			}
+		}
+		if value, ok := game.Tags[eloTag]; ok && parseElo(strings.TrimSpace(value)) <= 0 {
+			delete(game.Tags, eloTag)
+			fixed = true
+		}
+	}
+	return fixed
+}
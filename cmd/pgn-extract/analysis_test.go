@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"testing"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
@@ -124,6 +125,18 @@ func TestFixDateFormat(t *testing.T) {
 		{"dash -> dot", "2024-01-15", true, "2024.01.15"},
 		{"empty date", "", false, ""},
 		{"unknown date", "????.??.??", false, "????.??.??"},
+		{"partial unknown", "2024-??-??", true, "2024.??.??"},
+		{"year only", "1972", true, "1972.??.??"},
+		{"day month-name year", "12 Jan 2003", true, "2003.01.12"},
+		{"month-name day year", "January 12th, 2003", true, "2003.01.12"},
+		{"month-name year", "Sept 1972", true, "1972.09.??"},
+		{"german", "3. März 1999", true, "1999.03.03"},
+		{"french", "1er août 2010", true, "2010.08.01"},
+		{"spanish", "5 de diciembre de 1985", true, "1985.12.05"},
+		{"day first numeric", "12.01.2003", true, "2003.01.12"},
+		{"month first numeric", "01/31/2003", true, "2003.01.31"},
+		{"not a date", "sometime", false, "sometime"},
+		{"bad month", "2003.13.01", false, "2003.13.01"},
 	}
 
 	for _, tt := range tests {
@@ -144,6 +157,47 @@ func TestFixDateFormat(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// dateRange
+// ---------------------------------------------------------------------------
+
+func TestDateRangeContains(t *testing.T) {
+	tests := []struct {
+		rng  string
+		date string
+		want bool
+	}{
+		{"2019.07-2019.08.15", "2019.07.01", true},
+		{"2019.07-2019.08.15", "2019.08.15", true},
+		{"2019.07-2019.08.15", "2019.08.16", false},
+		{"2019.07-2019.08.15", "2019.06.30", false},
+		{"2019.07-2019.08.15", "2019.07.??", true},
+		{"2019-2019", "2019.12.31", true},
+		{"2020-", "2031.01.01", true},
+		{"2020-", "2019.12.31", false},
+		{"-1999", "1999.??.??", true},
+		{"2019.02", "2019.02.28", true},
+		{"2019.02", "2019.03.01", false},
+		{"2019-", "????.??.??", false},
+	}
+
+	for _, tt := range tests {
+		r, err := parseDateRange(tt.rng)
+		if err != nil {
+			t.Fatalf("parseDateRange(%q): %v", tt.rng, err)
+		}
+		if got := r.contains(tt.date); got != tt.want {
+			t.Errorf("range %q contains %q = %v; want %v", tt.rng, tt.date, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"x", "2019.13-", "-2019.1.x"} {
+		if _, err := parseDateRange(bad); err == nil {
+			t.Errorf("parseDateRange(%q) succeeded; want an error", bad)
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // cleanAllTags
 // ---------------------------------------------------------------------------
@@ -278,28 +332,6 @@ func TestValidateGame(t *testing.T) {
 	}
 }
 
-// ---------------------------------------------------------------------------
-// replayGame
-// ---------------------------------------------------------------------------
-
-func TestReplayGame(t *testing.T) {
-	game := testutil.MustParseGame(t, `[Event "Test"]
-[Site "?"]
-[Date "2024.01.01"]
-[Round "1"]
-[White "A"]
-[Black "B"]
-[Result "1-0"]
-
-1. e4 e5 2. Nf3 Nc6 1-0
-`)
-
-	board := replayGame(game)
-	if board == nil {
-		t.Fatal("replayGame returned nil board")
-	}
-}
-
 // ---------------------------------------------------------------------------
 // matchesCQL
 // ---------------------------------------------------------------------------
@@ -321,7 +353,7 @@ func TestMatchesCQL(t *testing.T) {
 
 1. f3 e5 2. g4 Qh4# 0-1
 `)
-		if !matchesCQL(game, mateNode) {
+		if !matchesCQL(context.Background(), game, mateNode) {
 			t.Error("matchesCQL(checkmate game, mate) = false; want true")
 		}
 	})
@@ -337,7 +369,7 @@ func TestMatchesCQL(t *testing.T) {
 
 1. e4 e5 2. Nf3 Nc6 1-0
 `)
-		if matchesCQL(game, mateNode) {
+		if matchesCQL(context.Background(), game, mateNode) {
 			t.Error("matchesCQL(non-checkmate game, mate) = true; want false")
 		}
 	})
@@ -360,11 +392,49 @@ func TestMatchesCQL_CheckQuery(t *testing.T) {
 
 1. f3 e5 2. g4 Qh4# 0-1
 `)
-	if !matchesCQL(game, checkNode) {
+	if !matchesCQL(context.Background(), game, checkNode) {
 		t.Error("matchesCQL(game with check, check) = false; want true")
 	}
 }
 
+func TestMatchesCQL_Annotations(t *testing.T) {
+	game := testutil.MustParseGame(t, `[Event "Test"]
+[Site "London"]
+[Date "2024.01.01"]
+[Round "1"]
+[White "A"]
+[Black "B"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 {A Novelty} Nc6 $6 3. Bb5 1-0
+`)
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{`comment "novelty"`, true},
+		{`(and (comment "novelty") (piece N f3))`, true},
+		{`(and (comment "novelty") btm)`, true},
+		{`nag 6`, true},
+		{`(and (nag 6) (piece n c6))`, true},
+		{`nag 2`, false},
+		{`site "london"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			node, err := cql.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("cql.Parse(%q) error: %v", tt.query, err)
+			}
+			if got := matchesCQL(context.Background(), game, node); got != tt.want {
+				t.Errorf("matchesCQL(%q) = %v; want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
 // ---------------------------------------------------------------------------
 // fixResultTag edge cases
 // ---------------------------------------------------------------------------
@@ -441,3 +511,96 @@ func TestAnalyzeGame_WithComments(t *testing.T) {
 		t.Fatal("analyzeGame returned nil analysis")
 	}
 }
+
+// ---------------------------------------------------------------------------
+// normalizeOnlineTags
+// ---------------------------------------------------------------------------
+
+func TestNormalizeTermination(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Normal", "normal"},
+		{"Time forfeit", "time forfeit"},
+		{"Hikaru won on time", "time forfeit"},
+		{"Hikaru won by resignation", "normal"},
+		{"Game drawn by repetition", "normal"},
+		{"Game drawn by timeout vs insufficient material", "normal"},
+		{"Hikaru won - game abandoned", "abandoned"},
+		{"Rules infraction", "rules infraction"},
+		{"Something else", "Something else"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			game := chess.NewGame()
+			game.SetTag("Termination", tt.value)
+			normalizeTermination(game)
+			if got := game.GetTag("Termination"); got != tt.want {
+				t.Errorf("Termination = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeVariant(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"chess960", "Chess960"},
+		{"Chess 960", "Chess960"},
+		{"fischerandom", "Chess960"},
+		{"kingOfTheHill", "King of the Hill"},
+		{"Three-check", "Three-check"},
+		{"Unknown Variant", "Unknown Variant"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			game := chess.NewGame()
+			game.SetTag("Variant", tt.value)
+			normalizeVariant(game)
+			if got := game.GetTag("Variant"); got != tt.want {
+				t.Errorf("Variant = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeOnlineTags(t *testing.T) {
+	game := chess.NewGame()
+	game.SetTag("Date", "????.??.??")
+	game.SetTag("UTCDate", "2024-03-05")
+	game.SetTag("UTCTime", "18:30:00")
+	game.SetTag("WhiteRating", "2100")
+	game.SetTag("BlackElo", "?")
+	game.SetTag("Termination", "Time forfeit")
+
+	if !normalizeOnlineTags(game) {
+		t.Fatal("normalizeOnlineTags() = false; want true")
+	}
+	if got := game.GetTag("Date"); got != "2024.03.05" {
+		t.Errorf("Date = %q; want %q", got, "2024.03.05")
+	}
+	if got := game.GetTag("Time"); got != "18:30:00" {
+		t.Errorf("Time = %q; want %q", got, "18:30:00")
+	}
+	if game.HasTag("UTCDate") || game.HasTag("UTCTime") {
+		t.Error("UTCDate/UTCTime should be removed")
+	}
+	if got := game.GetTag("WhiteElo"); got != "2100" {
+		t.Errorf("WhiteElo = %q; want %q", got, "2100")
+	}
+	if game.HasTag("WhiteRating") || game.HasTag("BlackElo") {
+		t.Error("WhiteRating and placeholder BlackElo should be removed")
+	}
+	if got := game.GetTag("Termination"); got != "time forfeit" {
+		t.Errorf("Termination = %q; want %q", got, "time forfeit")
+	}
+
+	if normalizeOnlineTags(game) {
+		t.Error("second normalizeOnlineTags() = true; want false")
+	}
+}
@@ -0,0 +1,144 @@
+// async_output.go - Asynchronous -o output with periodic fsync
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// asyncChunkSize is how much output is gathered before it is handed to
+	// the writer goroutine.
+	asyncChunkSize = 64 << 10
+	// asyncQueueChunks bounds the chunks waiting to be written; a full
+	// queue stalls the producer until the disk catches up.
+	asyncQueueChunks = 16
+)
+
+// asyncChunk is queued output, or a request to sync what came before it.
+type asyncChunk struct {
+	data []byte
+	sync bool
+}
+
+// asyncWriter writes a file from its own goroutine through a bounded
+// queue, so that formatting games does not wait on each write, and can
+// fsync the file every so many games.
+// NOT thread-safe: Only accessed from the single result-consumer goroutine;
+// the writer goroutine only touches the file and err.
+type asyncWriter struct {
+	file       *os.File
+	queue      chan asyncChunk
+	done       chan struct{}
+	buf        []byte
+	fsyncEvery int
+	games      int
+
+	stalls    int
+	stallTime time.Duration
+
+	mu  sync.Mutex
+	err error // first write or sync error
+}
+
+// newAsyncWriter starts the writer goroutine for a file. With fsyncEvery
+// positive the file is synced after every fsyncEvery games.
+func newAsyncWriter(file *os.File, fsyncEvery int) *asyncWriter {
+	aw := &asyncWriter{
+		file:       file,
+		queue:      make(chan asyncChunk, asyncQueueChunks),
+		done:       make(chan struct{}),
+		buf:        make([]byte, 0, asyncChunkSize),
+		fsyncEvery: fsyncEvery,
+	}
+	go aw.run()
+	return aw
+}
+
+// run writes queued chunks until the queue is closed. After an error the
+// rest of the output is dropped.
+func (aw *asyncWriter) run() {
+	defer close(aw.done)
+	for chunk := range aw.queue {
+		if aw.error() != nil {
+			continue
+		}
+		var err error
+		if chunk.sync {
+			err = aw.file.Sync()
+		} else {
+			_, err = aw.file.Write(chunk.data)
+		}
+		if err != nil {
+			aw.mu.Lock()
+			aw.err = err
+			aw.mu.Unlock()
+		}
+	}
+}
+
+func (aw *asyncWriter) error() error {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	return aw.err
+}
+
+// Write implements io.Writer. It reports an earlier failed write, as the
+// writes themselves happen later.
+func (aw *asyncWriter) Write(p []byte) (int, error) {
+	if err := aw.error(); err != nil {
+		return 0, err
+	}
+	aw.buf = append(aw.buf, p...)
+	if len(aw.buf) >= asyncChunkSize {
+		aw.flush()
+	}
+	return len(p), nil
+}
+
+// flush queues the gathered output.
+func (aw *asyncWriter) flush() {
+	if len(aw.buf) == 0 {
+		return
+	}
+	aw.send(asyncChunk{data: aw.buf})
+	aw.buf = make([]byte, 0, asyncChunkSize)
+}
+
+// send queues a chunk, counting the times the queue was full.
+func (aw *asyncWriter) send(chunk asyncChunk) {
+	select {
+	case aw.queue <- chunk:
+	default:
+		start := time.Now()
+		aw.queue <- chunk
+		aw.stalls++
+		aw.stallTime += time.Since(start)
+	}
+}
+
+// gameWritten should be called after each game is written.
+func (aw *asyncWriter) gameWritten() {
+	aw.games++
+	if aw.fsyncEvery > 0 && aw.games%aw.fsyncEvery == 0 {
+		aw.flush()
+		aw.send(asyncChunk{sync: true})
+	}
+}
+
+// Close writes the remaining output, syncs it if syncing was asked for and
+// closes the file. It returns the first error met.
+func (aw *asyncWriter) Close() error {
+	aw.flush()
+	if aw.fsyncEvery > 0 {
+		aw.send(asyncChunk{sync: true})
+	}
+	close(aw.queue)
+	<-aw.done
+	err := aw.error()
+	if closeErr := aw.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
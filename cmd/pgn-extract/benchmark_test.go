@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+	"github.com/lgbarn/pgn-extract-go/internal/parser"
+)
+
+// benchmarkGames parses the games of a test file, repeated to make a batch
+// big enough to keep every worker busy.
+func benchmarkGames(b *testing.B, name string, repeat int) []*chess.Game {
+	b.Helper()
+	data, err := os.ReadFile(inputFile(name))
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfg := config.NewConfig()
+	cfg.Verbosity = 0
+	var games []*chess.Game
+	for i := 0; i < repeat; i++ {
+		parsed, err := parser.NewParser(bytes.NewReader(data), cfg).ParseAllGames()
+		if err != nil {
+			b.Fatal(err)
+		}
+		games = append(games, parsed...)
+	}
+	return games
+}
+
+// BenchmarkOutputGamesParallel compares rendering matched games in the
+// single consumer goroutine, where every worker's games queue to be
+// formatted, with rendering them into per-worker buffers.
+func BenchmarkOutputGamesParallel(b *testing.B) {
+	games := benchmarkGames(b, "fischer.pgn", 30)
+	*quiet = true
+	defer func() { *quiet = false }()
+
+	for _, bench := range []struct {
+		name   string
+		render bool
+	}{
+		{"ConsumerRenders", false},
+		{"WorkersRender", true},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				cfg := config.NewConfig()
+				cfg.OutputFile = io.Discard
+				cfg.Verbosity = 0
+				runParallel(games, &ProcessingContext{cfg: cfg}, runtime.NumCPU(), bench.render)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+// blunders.go - Matching games by evaluation swings for --blunders
+package main
+
+import (
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/processing"
+)
+
+// hasBlunder reports whether a game has a main-line move losing more than
+// --blunders centipawns by its [%eval] comments, evaluating the game with
+// --engine first if one is running. With --blunder-nags the moves losing
+// more than the threshold are marked $4, and those losing more than half
+// of it $2.
+func hasBlunder(game *chess.Game, ctx *ProcessingContext) bool {
+	if ctx.engineEval != nil {
+		ctx.engineEval.annotate(game)
+	}
+	threshold := *blunderThreshold
+	swings := processing.EvalSwings(game, threshold/2)
+	if *blunderNAGs {
+		processing.MarkEvalSwings(swings, threshold)
+	}
+	for _, swing := range swings {
+		if swing.Loss > threshold {
+			return true
+		}
+	}
+	return false
+}
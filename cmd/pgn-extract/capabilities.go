@@ -0,0 +1,93 @@
+// capabilities.go - Machine-readable listing of supported features
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/lgbarn/pgn-extract-go/internal/cql"
+)
+
+// capabilitiesSchemaVersion is raised when the layout of the --capabilities
+// document changes incompatibly. Adding entries does not change it.
+const capabilitiesSchemaVersion = 1
+
+// capabilities describes what this binary supports, for wrapper tools and
+// GUIs that would otherwise parse the help text.
+type capabilities struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	Program       string           `json:"program"`
+	Version       string           `json:"version"`
+	Subcommands   []string         `json:"subcommands"`
+	Flags         []flagCapability `json:"flags"`
+	OutputFormats []string         `json:"outputFormats"`
+	CQL           cqlCapability    `json:"cql"`
+	Variants      []string         `json:"variants"`
+}
+
+// flagCapability describes one command-line flag.
+type flagCapability struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"` // bool, int, string or duration
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+}
+
+// cqlCapability describes the CQL support of -cql and -cqlfile.
+type cqlCapability struct {
+	Filters []string `json:"filters"`
+}
+
+// writeCapabilities writes the capabilities document as indented JSON.
+func writeCapabilities(w io.Writer) error {
+	caps := capabilities{
+		SchemaVersion: capabilitiesSchemaVersion,
+		Program:       "pgn-extract-go",
+		Version:       programVersion,
+		Subcommands:   []string{"diff", "index"},
+		OutputFormats: []string{"json"},
+		CQL:           cqlCapability{Filters: cql.FilterNames()},
+		Variants:      []string{"standard", "chess960"},
+	}
+
+	// VisitAll visits flags sorted by name
+	flag.VisitAll(func(f *flag.Flag) {
+		caps.Flags = append(caps.Flags, flagCapability{
+			Name:    f.Name,
+			Type:    flagType(f),
+			Default: f.DefValue,
+			Usage:   f.Usage,
+		})
+	})
+
+	for name := range outputFormats {
+		caps.OutputFormats = append(caps.OutputFormats, name)
+	}
+	sort.Strings(caps.OutputFormats)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(caps)
+}
+
+// flagType names the type of value a flag takes.
+func flagType(f *flag.Flag) string {
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return "string"
+	}
+	switch getter.Get().(type) {
+	case bool:
+		return "bool"
+	case int, int64, uint, uint64:
+		return "int"
+	case time.Duration:
+		return "duration"
+	case float64:
+		return "float"
+	}
+	return "string"
+}
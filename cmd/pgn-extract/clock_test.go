@@ -179,3 +179,72 @@ func TestNoClocksDefaultBehavior(t *testing.T) {
 		t.Errorf("Output without --noclocks should contain clock annotations, got:\n%s", out)
 	}
 }
+
+// TestTimeTrouble verifies --timetrouble selects games by their clocks.
+func TestTimeTrouble(t *testing.T) {
+	tmpFile := createTempPGNWithClocks(t)
+
+	// The lowest clock is Black's 9:50.2
+	out, _ := runPgnExtract(t, "-s", "--timetrouble", "9:51", tmpFile)
+	if countGames(out) != 1 {
+		t.Errorf("--timetrouble 9:51: want the game, got:\n%s", out)
+	}
+	out, _ = runPgnExtract(t, "-s", "--timetrouble", "590", tmpFile)
+	if countGames(out) != 0 {
+		t.Errorf("--timetrouble 590: want no games, got:\n%s", out)
+	}
+
+	_, stderr := runPgnExtract(t, "--timetrouble", "soon", tmpFile)
+	if !strings.Contains(stderr, "--timetrouble") {
+		t.Errorf("expected an error for an invalid time, got %q", stderr)
+	}
+}
+
+// TestEvalRange verifies --evalrange selects games by their evaluations.
+func TestEvalRange(t *testing.T) {
+	tmpFile := createTempPGN(t, "evals.pgn", `[Event "Balanced"]
+[Result "1/2-1/2"]
+
+1. e4 {[%eval 0.3]} e5 {[%eval 0.25]} 1/2-1/2
+
+[Event "Mate"]
+[Result "0-1"]
+
+1. f3 {[%eval -0.9]} e5 {[%eval -0.6]} 2. g4 {[%eval #-1]} Qh4# 0-1
+`)
+
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"0.25:0.25", []string{"Balanced"}},
+		{":-5", []string{"Mate"}},
+		{"-1:0", []string{"Mate"}},
+		{":", []string{"Balanced", "Mate"}},
+		{"1:", nil},
+	}
+	for _, tt := range tests {
+		out, _ := runPgnExtract(t, "-s", "--evalrange", tt.spec, tmpFile)
+		if countGames(out) != len(tt.want) {
+			t.Errorf("--evalrange %s: got %d games, want %v:\n%s", tt.spec, countGames(out), tt.want, out)
+		}
+		for _, event := range tt.want {
+			if !strings.Contains(out, `[Event "`+event+`"]`) {
+				t.Errorf("--evalrange %s: missing %s", tt.spec, event)
+			}
+		}
+	}
+
+	// Like the other filters, -n inverts it
+	out, _ := runPgnExtract(t, "-s", "-n", "--evalrange", ":-5", tmpFile)
+	if countGames(out) != 1 || !strings.Contains(out, `[Event "Balanced"]`) {
+		t.Errorf("-n --evalrange :-5: want only Balanced, got:\n%s", out)
+	}
+
+	for _, spec := range []string{"1", "2:1", "a:b"} {
+		_, stderr := runPgnExtract(t, "--evalrange", spec, tmpFile)
+		if !strings.Contains(stderr, "--evalrange") {
+			t.Errorf("--evalrange %s: expected an error, got %q", spec, stderr)
+		}
+	}
+}
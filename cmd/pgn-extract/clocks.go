@@ -0,0 +1,95 @@
+// clocks.go - Matching games by their [%clk] and [%eval] commands for
+// --timetrouble and --evalrange
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// hasTimeTrouble reports whether a main-line move left its player less
+// than limit on the clock by its [%clk] comment.
+func hasTimeTrouble(game *chess.Game, limit time.Duration) bool {
+	for move := game.Moves; move != nil; move = move.Next {
+		if move.Commands.HasClock && move.Commands.Clock < limit {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimeTrouble parses a --timetrouble limit: seconds, or a clock time
+// such as 1:30.
+func parseTimeTrouble(s string) (time.Duration, error) {
+	limit, ok := chess.ParseClock(strings.TrimSpace(s))
+	if !ok || limit <= 0 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return limit, nil
+}
+
+// evalBounds is an inclusive range of evaluations in pawns from White's
+// point of view; open ends are infinite.
+type evalBounds struct {
+	min, max float64
+}
+
+// parseEvalRange parses "min:max" in pawns, where either end may be left
+// out, e.g. "-0.5:0.5", "3:" or ":-3".
+func parseEvalRange(s string) (evalBounds, error) {
+	from, to, ok := strings.Cut(s, ":")
+	if !ok {
+		return evalBounds{}, fmt.Errorf("%q is not of the form min:max", s)
+	}
+	r := evalBounds{min: math.Inf(-1), max: math.Inf(1)}
+	for _, end := range []struct {
+		text  string
+		value *float64
+	}{{from, &r.min}, {to, &r.max}} {
+		text := strings.TrimSpace(end.text)
+		if text == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+			return evalBounds{}, fmt.Errorf("invalid evaluation %q", end.text)
+		}
+		*end.value = v
+	}
+	if r.min > r.max {
+		return evalBounds{}, fmt.Errorf("%q is empty", s)
+	}
+	return r, nil
+}
+
+// contains reports whether a move's evaluation lies in the range. A mate
+// lies beyond every bound on the side of the player mating.
+func (r evalBounds) contains(c chess.MoveCommands) bool {
+	eval := c.Eval
+	switch {
+	case c.Mate > 0:
+		eval = math.Inf(1)
+	case c.Mate < 0:
+		eval = math.Inf(-1)
+	}
+	return eval >= r.min && eval <= r.max
+}
+
+// inEvalRange reports whether a main-line move has an [%eval] comment in
+// --evalrange, evaluating the game with --engine first if one is running.
+func inEvalRange(game *chess.Game, ctx *ProcessingContext) bool {
+	if ctx.engineEval != nil {
+		ctx.engineEval.annotate(game)
+	}
+	for move := game.Moves; move != nil; move = move.Next {
+		if move.Commands.HasEval && evalRange.contains(move.Commands) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+// date_split.go - Splitting output by the year or month of the Date tag
+package main
+
+import (
+	"fmt"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+)
+
+// DateSplitWriter writes games to one file per year (base_1972.pgn) or per
+// month (base_1972-07.pgn) of their Date tag. Games without a year go to
+// base_unknown.pgn and, when splitting by month, games without a month to
+// base_<year>-unknown.pgn.
+// NOT thread-safe: Only accessed from the single result-consumer goroutine.
+type DateSplitWriter struct {
+	*splitFiles
+	baseName string
+	byMonth  bool
+	cfg      *config.Config
+}
+
+// NewDateSplitWriter creates a date split writer for "year" or "month".
+func NewDateSplitWriter(baseName, period string, cfg *config.Config, maxHandles int) (*DateSplitWriter, error) {
+	if period != "year" && period != "month" {
+		return nil, fmt.Errorf("unknown --splitdate period %q (use year or month)", period)
+	}
+	return &DateSplitWriter{
+		splitFiles: newSplitFiles(maxHandles),
+		baseName:   baseName,
+		byMonth:    period == "month",
+		cfg:        cfg,
+	}, nil
+}
+
+// WriteGame writes a game to the file for its date.
+func (dw *DateSplitWriter) WriteGame(game *chess.Game) error {
+	return dw.writeGame(game, dw.cfg, dw.dateKey(game.Date()), dw.filename)
+}
+
+// dateKey returns the year, or year and month, of a PGN date.
+func (dw *DateSplitWriter) dateKey(date string) string {
+	first, ok := parseDateBound(date, false)
+	if !ok {
+		return "unknown"
+	}
+	if !dw.byMonth {
+		return fmt.Sprintf("%04d", first.Year())
+	}
+	// A date without a month spans the whole year
+	if last, _ := parseDateBound(date, true); last.Month() != first.Month() {
+		return fmt.Sprintf("%04d-unknown", first.Year())
+	}
+	return fmt.Sprintf("%04d-%02d", first.Year(), first.Month())
+}
+
+func (dw *DateSplitWriter) filename(key string) (string, error) {
+	return fmt.Sprintf("%s_%s.pgn", dw.baseName, key), nil
+}
+
+// Close closes all open files.
+func (dw *DateSplitWriter) Close() error {
+	return dw.closeAll()
+}
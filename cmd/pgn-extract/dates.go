@@ -0,0 +1,336 @@
+// dates.go - Repair and checking of Date and EventDate tag values
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// monthNames maps lowercase month names in several languages to their
+// month number. Abbreviations are recognised as unambiguous prefixes.
+var monthNames = map[string]int{
+	// English
+	"january": 1, "february": 2, "march": 3, "april": 4, "may": 5, "june": 6,
+	"july": 7, "august": 8, "september": 9, "october": 10, "november": 11, "december": 12,
+	// German
+	"januar": 1, "jänner": 1, "februar": 2, "märz": 3, "maerz": 3, "mai": 5, "juni": 6,
+	"juli": 7, "oktober": 10, "dezember": 12,
+	// French
+	"janvier": 1, "février": 2, "fevrier": 2, "mars": 3, "avril": 4, "juin": 6,
+	"juillet": 7, "août": 8, "aout": 8, "septembre": 9, "octobre": 10, "novembre": 11,
+	"décembre": 12, "decembre": 12,
+	// Spanish
+	"enero": 1, "febrero": 2, "marzo": 3, "abril": 4, "mayo": 5, "junio": 6,
+	"julio": 7, "agosto": 8, "septiembre": 9, "setiembre": 9, "octubre": 10,
+	"noviembre": 11, "diciembre": 12,
+	// Italian
+	"gennaio": 1, "febbraio": 2, "aprile": 4, "maggio": 5, "giugno": 6, "luglio": 7,
+	"settembre": 9, "ottobre": 10, "dicembre": 12,
+	// Portuguese
+	"janeiro": 1, "fevereiro": 2, "março": 3, "marco": 3, "maio": 5, "junho": 6,
+	"julho": 7, "setembro": 9, "outubro": 10, "dezembro": 12,
+	// Dutch
+	"januari": 1, "februari": 2, "maart": 3, "mei": 5, "augustus": 8,
+}
+
+// lookupMonth resolves a month name or abbreviation such as "Sept" or
+// "déc". A prefix of three or more letters is accepted when every name it
+// abbreviates refers to the same month.
+func lookupMonth(word string) (int, bool) {
+	word = strings.ToLower(word)
+	if month, ok := monthNames[word]; ok {
+		return month, true
+	}
+	if len([]rune(word)) < 3 {
+		return 0, false
+	}
+	found := 0
+	for name, month := range monthNames {
+		if !strings.HasPrefix(name, word) {
+			continue
+		}
+		if found != 0 && found != month {
+			return 0, false
+		}
+		found = month
+	}
+	return found, found != 0
+}
+
+// dateToken is a run of digits or question marks in a date value.
+type dateToken struct {
+	text    string
+	unknown bool // all question marks
+}
+
+// normalizeDate converts a date in one of many common layouts, e.g.
+// "12 Jan 2003", "January 12th, 2003", "12.01.2003" or "2003-01-12", to
+// the PGN form YYYY.MM.DD with "??" for missing parts. All-numeric dates
+// with the year last are read day first unless only month first is valid.
+// It reports false if the value is not recognisable as a date.
+func normalizeDate(value string) (string, bool) {
+	var numbers []dateToken
+	month := 0
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '?'
+	})
+	for _, field := range fields {
+		for _, part := range splitDateField(field) {
+			r := []rune(part)[0]
+			switch {
+			case unicode.IsDigit(r):
+				numbers = append(numbers, dateToken{text: part})
+			case r == '?':
+				numbers = append(numbers, dateToken{text: part, unknown: true})
+			default:
+				if m, ok := lookupMonth(part); ok {
+					if month != 0 {
+						return "", false
+					}
+					month = m
+				}
+			}
+		}
+	}
+
+	var year, mon, day dateToken
+	if month != 0 {
+		mon = dateToken{text: strconv.Itoa(month)}
+		switch len(numbers) {
+		case 1:
+			year = numbers[0]
+		case 2:
+			if len(numbers[0].text) == 4 {
+				year, day = numbers[0], numbers[1]
+			} else {
+				day, year = numbers[0], numbers[1]
+			}
+		default:
+			return "", false
+		}
+	} else {
+		switch len(numbers) {
+		case 1:
+			year = numbers[0]
+			mon, day = dateToken{unknown: true}, dateToken{unknown: true}
+		case 2:
+			if len(numbers[0].text) == 4 {
+				year, mon = numbers[0], numbers[1]
+			} else {
+				mon, year = numbers[0], numbers[1]
+			}
+		case 3:
+			switch {
+			case len(numbers[0].text) == 4:
+				year, mon, day = numbers[0], numbers[1], numbers[2]
+			case isDateNumber(numbers[1], 13, 31) && isDateNumber(numbers[0], 1, 12):
+				// Month first, as in 01/31/2003
+				mon, day, year = numbers[0], numbers[1], numbers[2]
+			default:
+				day, mon, year = numbers[0], numbers[1], numbers[2]
+			}
+		default:
+			return "", false
+		}
+	}
+
+	if len(year.text) != 4 || (!year.unknown && !isDateNumber(year, 0, 9999)) {
+		return "", false
+	}
+	m, ok := formatDatePart(mon, 12)
+	if !ok {
+		return "", false
+	}
+	d, ok := formatDatePart(day, 31)
+	if !ok {
+		return "", false
+	}
+	return year.text + "." + m + "." + d, true
+}
+
+// splitDateField separates a field such as "12th" or "3janvier" into runs
+// of digits, question marks and letters.
+func splitDateField(field string) []string {
+	var parts []string
+	start := 0
+	runes := []rune(field)
+	class := func(r rune) int {
+		switch {
+		case unicode.IsDigit(r):
+			return 0
+		case r == '?':
+			return 1
+		default:
+			return 2
+		}
+	}
+	for i := 1; i <= len(runes); i++ {
+		if i == len(runes) || class(runes[i]) != class(runes[start]) {
+			parts = append(parts, string(runes[start:i]))
+			start = i
+		}
+	}
+	return parts
+}
+
+// isDateNumber reports whether a token is a number within [lo, hi].
+func isDateNumber(t dateToken, lo, hi int) bool {
+	if t.unknown {
+		return false
+	}
+	n, err := strconv.Atoi(t.text)
+	return err == nil && n >= lo && n <= hi
+}
+
+// formatDatePart renders a month or day as two digits, or "??" when it
+// is missing or unknown.
+func formatDatePart(t dateToken, hi int) (string, bool) {
+	if t.text == "" || t.unknown {
+		return "??", true
+	}
+	if len(t.text) > 2 || !isDateNumber(t, 1, hi) {
+		return "", false
+	}
+	n, _ := strconv.Atoi(t.text) //nolint:errcheck // validated by isDateNumber
+	return fmt.Sprintf("%02d", n), true
+}
+
+// parseDateBound reads a possibly partial PGN date such as "2003",
+// "2003.05" or "2003.05.??" as the first day it may denote, or as the last
+// day if upper is set. It reports false if the year is unknown.
+func parseDateBound(value string, upper bool) (time.Time, bool) {
+	parts := strings.Split(strings.TrimSpace(value), ".")
+	year, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 3 {
+		return time.Time{}, false
+	}
+	month, day := 0, 0
+	if len(parts) > 1 && !isUnknownDatePart(parts[1]) {
+		if month, err = strconv.Atoi(parts[1]); err != nil || month < 1 || month > 12 {
+			return time.Time{}, false
+		}
+	}
+	if len(parts) > 2 && !isUnknownDatePart(parts[2]) {
+		if day, err = strconv.Atoi(parts[2]); err != nil || day < 1 || day > 31 || month == 0 {
+			return time.Time{}, false
+		}
+	}
+
+	switch {
+	case month == 0 && upper:
+		return time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC), true
+	case month == 0:
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC), true
+	case day == 0 && upper:
+		return time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC), true
+	case day == 0:
+		return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC), true
+	}
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC), true
+}
+
+// isUnknownDatePart reports whether a month or day is written as "??".
+func isUnknownDatePart(part string) bool {
+	return strings.Trim(part, "?") == ""
+}
+
+// parseFullDate reads a complete YYYY.MM.DD date.
+func parseFullDate(value string) (time.Time, bool) {
+	t, err := time.Parse("2006.01.02", strings.TrimSpace(value))
+	return t, err == nil
+}
+
+// dateRange is an inclusive range of days; a zero end is open.
+type dateRange struct {
+	from, to time.Time
+}
+
+// parseDateRange parses "from-to" where each end is a possibly partial PGN
+// date and may be empty, e.g. "2019.07-2019.08.15", "2020-" or "-1999".
+func parseDateRange(s string) (dateRange, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		from, to = s, s
+	}
+	var r dateRange
+	if strings.TrimSpace(from) != "" {
+		if r.from, ok = parseDateBound(from, false); !ok {
+			return r, fmt.Errorf("invalid date %q", from)
+		}
+	}
+	if strings.TrimSpace(to) != "" {
+		if r.to, ok = parseDateBound(to, true); !ok {
+			return r, fmt.Errorf("invalid date %q", to)
+		}
+	}
+	return r, nil
+}
+
+// contains reports whether the earliest day a date value may denote lies in
+// the range. Values without a known year are never contained.
+func (r dateRange) contains(value string) bool {
+	t, ok := parseDateBound(value, false)
+	if !ok {
+		return false
+	}
+	return (r.from.IsZero() || !t.Before(r.from)) && (r.to.IsZero() || !t.After(r.to))
+}
+
+// eventDateProblem describes a game Date that is before its EventDate or
+// more than window days after it. Only complete dates are compared.
+func eventDateProblem(game *chess.Game, window int) string {
+	date, ok := parseFullDate(game.GetTag("Date"))
+	if !ok {
+		return ""
+	}
+	eventDate, ok := parseFullDate(game.GetTag("EventDate"))
+	if !ok {
+		return ""
+	}
+	days := int(date.Sub(eventDate).Hours() / 24)
+	switch {
+	case days < 0:
+		return fmt.Sprintf("Date %s is before EventDate %s", game.GetTag("Date"), game.GetTag("EventDate"))
+	case days > window:
+		return fmt.Sprintf("Date %s is %d days after EventDate %s", game.GetTag("Date"), days, game.GetTag("EventDate"))
+	}
+	return ""
+}
+
+// fillEventDates sets a missing EventDate to the earliest complete Date
+// among the games of the same Event, and returns the number of games
+// changed.
+func fillEventDates(games []*chess.Game) int {
+	earliest := make(map[string]string)
+	for _, game := range games {
+		event := strings.TrimSpace(game.GetTag("Event"))
+		date := game.GetTag("Date")
+		if event == "" || event == "?" {
+			continue
+		}
+		if _, ok := parseFullDate(date); !ok {
+			continue
+		}
+		// YYYY.MM.DD dates order as strings
+		if current, seen := earliest[event]; !seen || date < current {
+			earliest[event] = date
+		}
+	}
+
+	filled := 0
+	for _, game := range games {
+		if _, ok := parseDateBound(game.GetTag("EventDate"), false); ok {
+			continue
+		}
+		if date, ok := earliest[strings.TrimSpace(game.GetTag("Event"))]; ok {
+			game.SetTag("EventDate", date)
+			filled++
+		}
+	}
+	return filled
+}
@@ -0,0 +1,98 @@
+// debug_stats.go - Parser counters and stage timings for --debug-stats
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lgbarn/pgn-extract-go/internal/parser"
+)
+
+// profile accumulates --debug-stats figures across input files.
+// Only updated from the main goroutine, which reads the inputs in turn.
+var profile struct {
+	parser    parser.Stats
+	parseTime time.Duration
+	fixTime   time.Duration // move repairs applied after parsing
+	totalTime time.Duration
+
+	asyncOutput bool // whether the write stalls below were measured
+	writeStalls int  // times --async-output found its queue full
+	stallTime   time.Duration
+}
+
+// recordParse adds one input's parser counters and stage timings.
+func recordParse(stats parser.Stats, parseTime, fixTime time.Duration) {
+	profile.parser.Add(stats)
+	profile.parseTime += parseTime
+	profile.fixTime += fixTime
+}
+
+// recordWriteStalls records how often and how long output waited on the
+// --async-output writer.
+func recordWriteStalls(stalls int, stallTime time.Duration) {
+	profile.asyncOutput = true
+	profile.writeStalls = stalls
+	profile.stallTime = stallTime
+}
+
+// reportDebugStats prints the --debug-stats summary.
+func reportDebugStats(w io.Writer) {
+	s := &profile.parser
+	other := profile.totalTime - profile.parseTime - profile.fixTime
+	if other < 0 {
+		other = 0
+	}
+
+	fmt.Fprintf(w, "Debug statistics:\n")
+	fmt.Fprintf(w, "  %-16s %d\n", "games parsed", s.Games)
+	fmt.Fprintf(w, "  %-16s %v\n", "parse time", profile.parseTime.Round(time.Microsecond))
+	fmt.Fprintf(w, "  %-16s %v\n", "repair time", profile.fixTime.Round(time.Microsecond))
+	fmt.Fprintf(w, "  %-16s %v\n", "filter/output", other.Round(time.Microsecond))
+	fmt.Fprintf(w, "  %-16s %d (%s)\n", "tokens", s.TotalTokens(), tokenBreakdown(s))
+	avg := 0
+	if s.Comments > 0 {
+		avg = s.CommentBytes / s.Comments
+	}
+	fmt.Fprintf(w, "  %-16s %d, %d bytes (average %d, longest %d)\n", "comments", s.Comments, s.CommentBytes, avg, s.LongestComment)
+	fmt.Fprintf(w, "  %-16s %s\n", "RAV depths", ravBreakdown(s.RAVDepths))
+	if profile.asyncOutput {
+		fmt.Fprintf(w, "  %-16s %d (%v)\n", "write stalls", profile.writeStalls, profile.stallTime.Round(time.Microsecond))
+	}
+}
+
+// tokenBreakdown lists the token types seen, most frequent first.
+func tokenBreakdown(s *parser.Stats) string {
+	type count struct {
+		name string
+		n    int
+	}
+	var counts []count
+	for i, n := range s.Tokens {
+		if n > 0 {
+			counts = append(counts, count{parser.TokenType(i).String(), n})
+		}
+	}
+	sort.SliceStable(counts, func(i, j int) bool { return counts[i].n > counts[j].n })
+
+	parts := make([]string, len(counts))
+	for i, c := range counts {
+		parts[i] = fmt.Sprintf("%s=%d", c.name, c.n)
+	}
+	return strings.Join(parts, " ")
+}
+
+// ravBreakdown lists variation counts by nesting depth, e.g. "1:40 2:7".
+func ravBreakdown(depths []int) string {
+	if len(depths) == 0 {
+		return "none"
+	}
+	parts := make([]string, len(depths))
+	for i, n := range depths {
+		parts[i] = fmt.Sprintf("%d:%d", i+1, n)
+	}
+	return strings.Join(parts, " ")
+}
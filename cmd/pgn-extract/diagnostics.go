@@ -0,0 +1,133 @@
+// diagnostics.go - Terminal-aware diagnostics and progress on stderr
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ANSI escape sequences used for diagnostics.
+const (
+	ansiRed       = "\x1b[31m"
+	ansiYellow    = "\x1b[33m"
+	ansiReset     = "\x1b[0m"
+	ansiClearLine = "\r\x1b[K"
+)
+
+// errorWords mark a diagnostic line as an error rather than a warning.
+var errorWords = []string{"error", "illegal", "invalid", "cannot"}
+
+// isTerminal reports whether f is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// useColour reports whether diagnostics written to f may use ANSI colour.
+// Colour needs a terminal and is disabled by --no-color, --dumb-terminal,
+// the NO_COLOR environment variable or TERM=dumb.
+func useColour(f *os.File) bool {
+	if *noColor || *dumbTerminal || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(f)
+}
+
+// diagnosticOutput receives the diagnostics meant for stderr, the log
+// included unless -l or -L sends it to a file. setupDiagnostics wraps it
+// in a colourWriter when stderr is a colour-capable terminal.
+var diagnosticOutput io.Writer = os.Stderr
+
+// setupDiagnostics colours diagnostics once the flags are parsed.
+func setupDiagnostics() {
+	if useColour(os.Stderr) {
+		diagnosticOutput = &colourWriter{w: os.Stderr}
+	}
+}
+
+// colourWriter colours each line of diagnostics by severity: errors in
+// red and warnings in yellow. Lines starting with a count or "Loaded",
+// which summarise the run, are left plain.
+type colourWriter struct {
+	w io.Writer
+}
+
+// Write colours complete lines in p, first clearing the current terminal
+// line. Each call is expected to hold whole lines, as the diagnostics are
+// written with one Fprintf per message.
+func (cw *colourWriter) Write(p []byte) (int, error) {
+	var out bytes.Buffer
+	out.WriteString(ansiClearLine) // overwrite any progress line
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		text := bytes.TrimRight(line, "\n")
+		colour := diagnosticColour(string(text))
+		if colour == "" || len(text) == 0 {
+			out.Write(line)
+			continue
+		}
+		out.WriteString(colour)
+		out.Write(text)
+		out.WriteString(ansiReset)
+		out.Write(line[len(text):])
+	}
+	if _, err := cw.w.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// diagnosticColour picks the colour for a diagnostic line.
+func diagnosticColour(line string) string {
+	if strings.HasPrefix(line, "Loaded ") || line != "" && line[0] >= '0' && line[0] <= '9' {
+		return ""
+	}
+	lower := strings.ToLower(line)
+	for _, word := range errorWords {
+		if strings.Contains(lower, word) {
+			return ansiRed
+		}
+	}
+	return ansiYellow
+}
+
+// progressReporter shows which input file is being read on a single,
+// rewritten line of a terminal.
+type progressReporter struct {
+	w     io.Writer
+	total int
+	width int // digits in total, for alignment
+	shown bool
+}
+
+// newProgressReporter returns a reporter for total input files, or nil
+// when progress should not be shown: a single file, quiet mode, or stderr
+// that is not a colour-capable terminal.
+func newProgressReporter(total int, verbosity int) *progressReporter {
+	if total < 2 || verbosity == 0 || !useColour(os.Stderr) {
+		return nil
+	}
+	return &progressReporter{w: os.Stderr, total: total, width: len(fmt.Sprint(total))}
+}
+
+// file reports that the n'th (1-based) input file is starting.
+func (pr *progressReporter) file(n int, name string) {
+	if pr == nil {
+		return
+	}
+	fmt.Fprintf(pr.w, "%s[%*d/%d] %s", ansiClearLine, pr.width, n, pr.total, name)
+	pr.shown = true
+}
+
+// done clears the progress line.
+func (pr *progressReporter) done() {
+	if pr == nil || !pr.shown {
+		return
+	}
+	fmt.Fprint(pr.w, ansiClearLine)
+}
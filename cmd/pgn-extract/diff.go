@@ -0,0 +1,269 @@
+// diff.go - The diff subcommand: compare two PGN files game by game
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+	"github.com/lgbarn/pgn-extract-go/internal/hashing"
+	"github.com/lgbarn/pgn-extract-go/internal/parser"
+	"github.com/lgbarn/pgn-extract-go/internal/processing"
+)
+
+// tagDiff is a tag whose value differs between two matched games.
+type tagDiff struct {
+	Tag string `json:"tag"`
+	A   string `json:"a"`
+	B   string `json:"b"`
+}
+
+// moveDiff is the first main-line move at which two matched games differ.
+type moveDiff struct {
+	Ply int    `json:"ply"`
+	A   string `json:"a"`
+	B   string `json:"b"`
+}
+
+// gamePairDiff describes a pair of matched games. Game numbers are 1-based
+// positions within each file.
+type gamePairDiff struct {
+	A         int       `json:"a"`
+	B         int       `json:"b"`
+	MatchedBy string    `json:"matchedBy"` // "moves" or "players"
+	PliesA    int       `json:"pliesA"`
+	PliesB    int       `json:"pliesB"`
+	Tags      []tagDiff `json:"tags,omitempty"`
+	FirstMove *moveDiff `json:"firstDifference,omitempty"`
+}
+
+// identical reports whether the pair has no differences.
+func (d *gamePairDiff) identical() bool {
+	return len(d.Tags) == 0 && d.FirstMove == nil
+}
+
+// fileDiff is the result of comparing two PGN files.
+type fileDiff struct {
+	Pairs   []*gamePairDiff `json:"pairs"`
+	OnlyInA []int           `json:"onlyInA"`
+	OnlyInB []int           `json:"onlyInB"`
+}
+
+// runDiff implements "pgn-extract diff [-json] a.pgn b.pgn". It returns
+// the exit status: 0 when the files hold the same games, 1 when they
+// differ and 2 on error.
+func runDiff(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	asJSON := fs.Bool("json", false, "Report differences as JSON")
+	all := fs.Bool("all", false, "Also list matched games that are identical")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: pgn-extract diff [options] a.pgn b.pgn\n\n")
+		fmt.Fprintf(stderr, "Matches games across two files by moves, then by players and date,\n")
+		fmt.Fprintf(stderr, "and reports differences in tags, length and the first differing move.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	gamesA, err := readDiffInput(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "Error reading %s: %v\n", fs.Arg(0), err)
+		return 2
+	}
+	gamesB, err := readDiffInput(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(stderr, "Error reading %s: %v\n", fs.Arg(1), err)
+		return 2
+	}
+
+	result := diffGames(gamesA, gamesB)
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			fmt.Fprintf(stderr, "Error writing JSON: %v\n", err)
+			return 2
+		}
+	} else {
+		writeDiffText(stdout, result, *all)
+	}
+
+	for _, pair := range result.Pairs {
+		if !pair.identical() {
+			return 1
+		}
+	}
+	if len(result.OnlyInA) > 0 || len(result.OnlyInB) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readDiffInput parses all games of a file.
+func readDiffInput(filename string) ([]*chess.Game, error) {
+	file, err := os.Open(filename) //nolint:gosec // G304: CLI tool opens user-specified files
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cfg := config.NewConfig()
+	cfg.LogFile = io.Discard
+	return parser.NewParser(file, cfg).ParseAllGames()
+}
+
+// diffGames matches the games of two files, first by identical move
+// sequences and then by White, Black and Date, in file order.
+func diffGames(gamesA, gamesB []*chess.Game) *fileDiff {
+	result := &fileDiff{Pairs: []*gamePairDiff{}, OnlyInA: []int{}, OnlyInB: []int{}}
+	matchedA := make([]bool, len(gamesA))
+	matchedB := make([]bool, len(gamesB))
+
+	hasher := hashing.NewGameHasher(hashing.HashMoveSequence)
+	byMoves := make(map[uint64][]int)
+	for j, game := range gamesB {
+		hash := hasher.HashGame(game, nil)
+		byMoves[hash] = append(byMoves[hash], j)
+	}
+	for i, game := range gamesA {
+		hash := hasher.HashGame(game, nil)
+		if j, ok := takeUnmatched(byMoves[hash], matchedB); ok {
+			matchedA[i], matchedB[j] = true, true
+			result.Pairs = append(result.Pairs, compareGames(i, j, "moves", game, gamesB[j]))
+		}
+	}
+
+	byPlayers := make(map[string][]int)
+	for j, game := range gamesB {
+		if !matchedB[j] {
+			byPlayers[playersKey(game)] = append(byPlayers[playersKey(game)], j)
+		}
+	}
+	for i, game := range gamesA {
+		if matchedA[i] {
+			continue
+		}
+		if j, ok := takeUnmatched(byPlayers[playersKey(game)], matchedB); ok {
+			matchedA[i], matchedB[j] = true, true
+			result.Pairs = append(result.Pairs, compareGames(i, j, "players", game, gamesB[j]))
+		}
+	}
+
+	sort.SliceStable(result.Pairs, func(x, y int) bool { return result.Pairs[x].A < result.Pairs[y].A })
+	for i, matched := range matchedA {
+		if !matched {
+			result.OnlyInA = append(result.OnlyInA, i+1)
+		}
+	}
+	for j, matched := range matchedB {
+		if !matched {
+			result.OnlyInB = append(result.OnlyInB, j+1)
+		}
+	}
+	return result
+}
+
+// takeUnmatched returns the first candidate index not yet matched.
+func takeUnmatched(candidates []int, matched []bool) (int, bool) {
+	for _, j := range candidates {
+		if !matched[j] {
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+// playersKey identifies a game by its players and date.
+func playersKey(game *chess.Game) string {
+	return strings.Join([]string{game.White(), game.Black(), game.Date()}, "|")
+}
+
+// compareGames compares two matched games, numbered from 0.
+func compareGames(i, j int, matchedBy string, a, b *chess.Game) *gamePairDiff {
+	d := &gamePairDiff{
+		A:         i + 1,
+		B:         j + 1,
+		MatchedBy: matchedBy,
+		PliesA:    processing.CountPlies(a),
+		PliesB:    processing.CountPlies(b),
+	}
+
+	names := make(map[string]bool)
+	for tag := range a.Tags {
+		names[tag] = true
+	}
+	for tag := range b.Tags {
+		names[tag] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for tag := range names {
+		sorted = append(sorted, tag)
+	}
+	sort.Strings(sorted)
+	for _, tag := range sorted {
+		if a.Tags[tag] != b.Tags[tag] {
+			d.Tags = append(d.Tags, tagDiff{Tag: tag, A: a.Tags[tag], B: b.Tags[tag]})
+		}
+	}
+
+	if ply, aMove, bMove := processing.FirstMoveDifference(a, b); ply > 0 {
+		d.FirstMove = &moveDiff{Ply: ply, A: aMove, B: bMove}
+	}
+	return d
+}
+
+// writeDiffText writes a human-readable report of a file comparison.
+func writeDiffText(w io.Writer, result *fileDiff, all bool) {
+	identical := 0
+	for _, pair := range result.Pairs {
+		if pair.identical() {
+			identical++
+			if !all {
+				continue
+			}
+		}
+		fmt.Fprintf(w, "a#%d <-> b#%d (matched by %s)", pair.A, pair.B, pair.MatchedBy)
+		if pair.identical() {
+			fmt.Fprintf(w, ": identical\n")
+			continue
+		}
+		fmt.Fprintln(w)
+		for _, tag := range pair.Tags {
+			fmt.Fprintf(w, "  tag %s: %q vs %q\n", tag.Tag, tag.A, tag.B)
+		}
+		if pair.PliesA != pair.PliesB {
+			fmt.Fprintf(w, "  plies: %d vs %d\n", pair.PliesA, pair.PliesB)
+		}
+		if m := pair.FirstMove; m != nil {
+			fmt.Fprintf(w, "  first difference at ply %d: %s vs %s\n", m.Ply, orEnd(m.A), orEnd(m.B))
+		}
+	}
+	for _, i := range result.OnlyInA {
+		fmt.Fprintf(w, "a#%d: only in first file\n", i)
+	}
+	for _, j := range result.OnlyInB {
+		fmt.Fprintf(w, "b#%d: only in second file\n", j)
+	}
+	fmt.Fprintf(w, "%d matched (%d identical), %d only in first file, %d only in second file.\n",
+		len(result.Pairs), identical, len(result.OnlyInA), len(result.OnlyInB))
+}
+
+// orEnd shows a missing move as the end of the game.
+func orEnd(move string) string {
+	if move == "" {
+		return "(end)"
+	}
+	return move
+}
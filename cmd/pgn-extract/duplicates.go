@@ -0,0 +1,204 @@
+// duplicates.go - Deferred output of kept duplicate originals
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+	"github.com/lgbarn/pgn-extract-go/internal/output"
+	"github.com/lgbarn/pgn-extract-go/internal/processing"
+)
+
+// keepPolicy selects which copy of a duplicated game survives.
+type keepPolicy int
+
+const (
+	keepFirst         keepPolicy = iota // first seen (default)
+	keepMostTags                        // most non-placeholder tags
+	keepLongest                         // most moves, including variations
+	keepBestAnnotated                   // most comments, NAGs and variations
+	keepSourceOrder                     // earliest input in --dupe-source-order
+)
+
+// keepPolicyNames maps --dupe-keep values to policies.
+var keepPolicyNames = map[string]keepPolicy{
+	"first":          keepFirst,
+	"most-tags":      keepMostTags,
+	"longest":        keepLongest,
+	"best-annotated": keepBestAnnotated,
+	"source-order":   keepSourceOrder,
+}
+
+// parseKeepPolicy parses a --dupe-keep value.
+func parseKeepPolicy(name string) (keepPolicy, error) {
+	policy, ok := keepPolicyNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return keepFirst, fmt.Errorf("unknown duplicate keep policy %q (use first, most-tags, longest, best-annotated or source-order)", name)
+	}
+	return policy, nil
+}
+
+// duplicateSelector decides whether a newly seen duplicate should replace the kept copy.
+type duplicateSelector struct {
+	policy      keepPolicy
+	sourceOrder []string
+}
+
+// prefers reports whether candidate should replace kept. Ties keep the first-seen copy.
+func (s *duplicateSelector) prefers(candidate, kept *keptGame) bool {
+	switch s.policy {
+	case keepMostTags:
+		return countRealTags(candidate.game) > countRealTags(kept.game)
+	case keepLongest:
+		return processing.CountAllMoves(candidate.game) > processing.CountAllMoves(kept.game)
+	case keepBestAnnotated:
+		return processing.CountAnnotations(candidate.game) > processing.CountAnnotations(kept.game)
+	case keepSourceOrder:
+		return s.sourceRank(candidate.source) < s.sourceRank(kept.source)
+	default:
+		return false
+	}
+}
+
+// sourceRank returns the preference index of an input file; unlisted files rank last.
+func (s *duplicateSelector) sourceRank(source string) int {
+	for i, preferred := range s.sourceOrder {
+		if source == preferred || filepath.Base(source) == filepath.Base(preferred) {
+			return i
+		}
+	}
+	return len(s.sourceOrder)
+}
+
+// countRealTags counts tags that carry a value other than a placeholder.
+func countRealTags(game *chess.Game) int {
+	count := 0
+	for _, value := range game.Tags {
+		if !isPlaceholderTagValue(value) {
+			count++
+		}
+	}
+	return count
+}
+
+// keptGame is a unique game whose output is held back until all input has been read.
+type keptGame struct {
+	game     *chess.Game
+	gameInfo *GameAnalysis
+	source   string
+}
+
+// deferredOriginals holds kept games so later duplicates can still update them.
+// NOT thread-safe: Only accessed from the single result-consumer goroutine.
+type deferredOriginals struct {
+	games      []*keptGame
+	byOriginal map[*chess.Game]*keptGame
+	selector   *duplicateSelector
+	mergeTags  bool
+}
+
+// newDeferredOriginals creates an empty deferred output list.
+func newDeferredOriginals(selector *duplicateSelector, mergeTags bool) *deferredOriginals {
+	return &deferredOriginals{
+		byOriginal: make(map[*chess.Game]*keptGame),
+		selector:   selector,
+		mergeTags:  mergeTags,
+	}
+}
+
+// resolve settles a duplicate against the kept copy of its original and
+// returns the game that should be treated as the suppressed duplicate.
+func (d *deferredOriginals) resolve(original, game *chess.Game, gameInfo *GameAnalysis, source string, cfg *config.Config) *chess.Game {
+	kept := d.lookup(original)
+	if kept == nil {
+		return game
+	}
+
+	candidate := &keptGame{game: game, gameInfo: gameInfo, source: source}
+	if d.selector == nil || !d.selector.prefers(candidate, kept) {
+		if d.mergeTags {
+			mergeTagsIntoKept(kept.game, game, cfg)
+		}
+		return game
+	}
+
+	displaced := kept.game
+	if d.mergeTags {
+		mergeTagsIntoKept(game, displaced, cfg)
+	}
+	kept.game, kept.gameInfo, kept.source = game, gameInfo, source
+	return displaced
+}
+
+// add records a unique game for output at the end of the run.
+func (d *deferredOriginals) add(game *chess.Game, gameInfo *GameAnalysis, source string) {
+	kept := &keptGame{game: game, gameInfo: gameInfo, source: source}
+	d.games = append(d.games, kept)
+	d.byOriginal[game] = kept
+}
+
+// lookup returns the kept entry for an original reported by the duplicate detector.
+func (d *deferredOriginals) lookup(original *chess.Game) *keptGame {
+	if original == nil {
+		return nil
+	}
+	return d.byOriginal[original]
+}
+
+// flush outputs all kept games in the order they were first seen.
+func (d *deferredOriginals) flush(ctx *ProcessingContext) {
+	cfg := ctx.cfg
+	var jsonGames []*chess.Game
+	for _, kept := range d.games {
+		outputMatchedGame(kept.game, kept.gameInfo, ctx, &jsonGames)
+	}
+	if cfg.Output.JSONFormat && len(jsonGames) > 0 {
+		output.OutputGamesJSON(jsonGames, cfg, cfg.OutputFile)
+	}
+	d.games = nil
+	d.byOriginal = make(map[*chess.Game]*keptGame)
+}
+
+// mergeTagsIntoKept copies tags that are missing from the kept game and
+// logs tags whose values differ between the two copies.
+func mergeTagsIntoKept(kept, duplicate *chess.Game, cfg *config.Config) {
+	names := make([]string, 0, len(duplicate.Tags))
+	for name := range duplicate.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := duplicate.Tags[name]
+		existing, ok := kept.Tags[name]
+		switch {
+		case !ok || existing == "" || isPlaceholderTagValue(existing):
+			if !isPlaceholderTagValue(value) {
+				kept.SetTag(name, value)
+			}
+		case existing != value && !isPlaceholderTagValue(value):
+			if cfg.LogFile != nil {
+				fmt.Fprintf(cfg.LogFile, "Duplicate tag conflict (%s vs %s): %s %q kept, %q dropped\n",
+					gameLabel(kept), gameLabel(duplicate), name, existing, value)
+			}
+		}
+	}
+}
+
+// isPlaceholderTagValue reports whether a tag value is an "unknown" placeholder.
+func isPlaceholderTagValue(value string) bool {
+	switch value {
+	case "", "?", "-", "*", "????.??.??":
+		return true
+	}
+	return false
+}
+
+// gameLabel returns a short human-readable description of a game for diagnostics.
+func gameLabel(game *chess.Game) string {
+	return fmt.Sprintf("%s-%s %s", game.White(), game.Black(), game.Date())
+}
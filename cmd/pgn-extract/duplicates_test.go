@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+	"github.com/lgbarn/pgn-extract-go/internal/testutil"
+)
+
+func TestParseKeepPolicy(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    keepPolicy
+		wantErr bool
+	}{
+		{"first", keepFirst, false},
+		{"most-tags", keepMostTags, false},
+		{"Longest", keepLongest, false},
+		{"best-annotated", keepBestAnnotated, false},
+		{"source-order", keepSourceOrder, false},
+		{"newest", keepFirst, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseKeepPolicy(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseKeepPolicy(%q) error = %v; wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseKeepPolicy(%q) = %v; want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDuplicateSelector_Prefers(t *testing.T) {
+	plain := &keptGame{
+		game:   testutil.MustParseGame(t, "[Event \"A\"]\n\n1. e4 e5 *\n"),
+		source: "a.pgn",
+	}
+	annotated := &keptGame{
+		game:   testutil.MustParseGame(t, "[Event \"B\"]\n[Site \"Here\"]\n\n1. e4 {Good} e5 $1 (1... c5) *\n"),
+		source: "/data/b.pgn",
+	}
+
+	tests := []struct {
+		name     string
+		selector duplicateSelector
+		want     bool
+	}{
+		{"first never replaces", duplicateSelector{policy: keepFirst}, false},
+		{"most tags", duplicateSelector{policy: keepMostTags}, true},
+		{"longest", duplicateSelector{policy: keepLongest}, true},
+		{"best annotated", duplicateSelector{policy: keepBestAnnotated}, true},
+		{"source order by base name", duplicateSelector{policy: keepSourceOrder, sourceOrder: []string{"b.pgn", "a.pgn"}}, true},
+		{"source order unlisted", duplicateSelector{policy: keepSourceOrder, sourceOrder: []string{"a.pgn"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.selector.prefers(annotated, plain); got != tt.want {
+				t.Errorf("prefers() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeferredOriginals_ResolveReplacesAndMerges(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.LogFile = &strings.Builder{}
+
+	first := chess.NewGame()
+	first.SetTag("Event", "Open")
+	first.SetTag("Round", "3")
+	second := chess.NewGame()
+	second.SetTag("Event", "Open")
+	second.SetTag("Annotator", "Someone")
+	second.SetTag("WhiteElo", "2400")
+
+	d := newDeferredOriginals(&duplicateSelector{policy: keepMostTags}, true)
+	d.add(first, nil, "a.pgn")
+
+	suppressed := d.resolve(first, second, nil, "b.pgn", cfg)
+	if suppressed != first {
+		t.Fatal("expected the first copy to be displaced")
+	}
+	kept := d.lookup(first)
+	if kept.game != second || kept.source != "b.pgn" {
+		t.Fatal("expected the second copy to be kept")
+	}
+	if second.GetTag("Round") != "3" {
+		t.Errorf("Round = %q; want merged value %q", second.GetTag("Round"), "3")
+	}
+}
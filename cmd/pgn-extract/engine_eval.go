@@ -0,0 +1,208 @@
+// engine_eval.go - Annotating games with evaluations from a UCI engine
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/hashing"
+	"github.com/lgbarn/pgn-extract-go/internal/parser"
+	"github.com/lgbarn/pgn-extract-go/internal/processing"
+	"github.com/lgbarn/pgn-extract-go/internal/uci"
+)
+
+// engineCacheSize is how many evaluated positions --engine remembers, so
+// that positions recurring across games are searched once.
+const engineCacheSize = 1 << 16
+
+// engineAnnotator adds [%eval] comments from a UCI engine after each move
+// of the main line, as lichess annotates games. Evaluations are from
+// White's point of view, in pawns or as #N for mate in N. With --pv the
+// engine's best lines are added as variations too.
+// NOT thread-safe: Only accessed from the single result-consumer goroutine,
+// and from the filters when games are processed sequentially for them.
+type engineAnnotator struct {
+	engine    *uci.Engine
+	limit     uci.Limit
+	cache     *hashing.EvalCache
+	pv        int         // number of engine lines to add as variations
+	annotated *chess.Game // the game last annotated, which is not done twice
+	err       error       // the engine failed; no further games are annotated
+}
+
+// setupEngineAnnotator starts the --engine program, or returns nil if no
+// engine is given.
+func setupEngineAnnotator() *engineAnnotator {
+	if *enginePV < 0 {
+		fmt.Fprintf(diagnosticOutput, "Error: --pv must not be negative\n")
+		os.Exit(1)
+	}
+	if *enginePath == "" {
+		if *enginePV > 0 {
+			fmt.Fprintf(diagnosticOutput, "Error: --pv needs --engine\n")
+			os.Exit(1)
+		}
+		return nil
+	}
+	if *engineDepth < 0 || *engineTime < 0 {
+		fmt.Fprintf(diagnosticOutput, "Error: --engine-depth and --engine-time must not be negative\n")
+		os.Exit(1)
+	}
+	eng, err := uci.Start(*enginePath)
+	if err == nil && *enginePV > 1 {
+		err = eng.SetOption("MultiPV", strconv.Itoa(*enginePV))
+	}
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return &engineAnnotator{
+		engine: eng,
+		limit:  uci.Limit{Depth: *engineDepth, MoveTime: time.Duration(*engineTime) * time.Millisecond},
+		cache:  hashing.NewEvalCache(engineCacheSize),
+		pv:     *enginePV,
+	}
+}
+
+// annotate evaluates the position after each main-line move that has no
+// evaluation yet. Positions where the game is over are not evaluated.
+func (ea *engineAnnotator) annotate(game *chess.Game) {
+	if ea.err != nil || game == ea.annotated {
+		return
+	}
+	ea.annotated = game
+	if ea.err = ea.engine.NewGame(); ea.err != nil {
+		return
+	}
+	ea.evaluateMoves(game)
+	if ea.err == nil && ea.pv > 0 {
+		ea.addLines(game)
+	}
+}
+
+// evaluateMoves adds an [%eval] comment after each main-line move.
+func (ea *engineAnnotator) evaluateMoves(game *chess.Game) {
+	board := engine.NewBoardForGame(game)
+	for move := game.Moves; move != nil; move = move.Next {
+		if !engine.ApplyMove(board, move) {
+			return
+		}
+		if move.Commands.HasEval || !engine.HasLegalMoves(board, board.ToMove) {
+			continue
+		}
+		eval, err := ea.evaluate(board)
+		if err != nil {
+			ea.err = err
+			return
+		}
+		move.AppendComment("[%eval " + formatEval(eval) + "]")
+	}
+}
+
+// addLines adds the engine's best lines from the position before each
+// main-line move as variations of the move, or with --blunders only before
+// the moves losing more than its threshold. A line starting with the move
+// played is left out. The first move of each line carries the line's
+// evaluation.
+func (ea *engineAnnotator) addLines(game *chess.Game) {
+	var selected map[*chess.Move]bool
+	if *blunderThreshold > 0 {
+		selected = make(map[*chess.Move]bool)
+		for _, swing := range processing.EvalSwings(game, *blunderThreshold) {
+			selected[swing.Move] = true
+		}
+	}
+
+	board := engine.NewBoardForGame(game)
+	for move := game.Moves; move != nil; move = move.Next {
+		before := board.Copy()
+		if !engine.ApplyMove(board, move) {
+			return
+		}
+		if selected != nil && !selected[move] {
+			continue
+		}
+		lines, err := ea.engine.Analyse(engine.BoardToFEN(before), ea.limit)
+		if err != nil {
+			ea.err = err
+			return
+		}
+		played := hashing.GenerateZobristHash(board)
+		for _, line := range lines {
+			variation := lineVariation(before, line)
+			if variation == nil || variation.Moves.Zobrist == played {
+				continue
+			}
+			move.Variations = append(move.Variations, variation)
+		}
+	}
+}
+
+// lineVariation turns an engine line into a variation from board, up to
+// its first illegal move. It returns nil if there is none.
+func lineVariation(board *chess.Board, line uci.Line) *chess.Variation {
+	board = board.Copy()
+	var first, last *chess.Move
+	for _, text := range line.Moves {
+		move := parser.DecodeMove(text)
+		if move.Class == chess.UnknownMove || engine.MoveProblem(board, move) != "" {
+			break
+		}
+		before := board.Copy()
+		engine.ApplyMove(board, move)
+		move.Text = engine.SAN(before, move)
+		move.Zobrist = hashing.GenerateZobristHash(board)
+		if first == nil {
+			first = move
+			move.AppendComment("[%eval " + formatEval(line.Eval) + "]")
+		} else {
+			last.Next, move.Prev = move, last
+		}
+		last = move
+	}
+	if first == nil {
+		return nil
+	}
+	return &chess.Variation{Moves: first}
+}
+
+// evaluate returns the engine's evaluation of a position, searching it
+// only if it is not cached deep enough.
+func (ea *engineAnnotator) evaluate(board *chess.Board) (hashing.Eval, error) {
+	hash := hashing.GenerateZobristHash(board)
+	if eval, ok := ea.cache.Get(hash, ea.limit.Depth); ok {
+		return eval, nil
+	}
+	eval, err := ea.engine.Evaluate(engine.BoardToFEN(board), ea.limit)
+	if err != nil {
+		return eval, err
+	}
+	ea.cache.Put(hash, eval)
+	return eval, nil
+}
+
+// formatEval writes an evaluation as lichess does: pawns to two decimals,
+// or #N when there is a mate.
+func formatEval(eval hashing.Eval) string {
+	if eval.Mate != 0 {
+		return fmt.Sprintf("#%d", eval.Mate)
+	}
+	return fmt.Sprintf("%.2f", float64(eval.Centipawns)/100)
+}
+
+// Close stops the engine, reporting any failure and, at log, the cache
+// statistics.
+func (ea *engineAnnotator) Close(log io.Writer, verbose bool) {
+	if ea.err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error: engine stopped evaluating: %v\n", ea.err)
+	}
+	if verbose {
+		fmt.Fprintf(log, "Engine evaluations: %s.\n", ea.cache.Stats())
+	}
+	_ = ea.engine.Close() // the engine's exit status does not affect the output
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -137,6 +142,40 @@ func TestSoundex(t *testing.T) {
 	t.Logf("Without Soundex: searching for 'Fisher' found %d games", countNoSoundex)
 }
 
+// TestMatchControls tests --match-case, --match-exact and --match-anchored
+func TestMatchControls(t *testing.T) {
+	pgn := createTempPGN(t, "names.pgn", `[White "Carlsen, Magnus"]
+[Black "Nepomniachtchi, Ian"]
+[Result "1-0"]
+
+1. e4 1-0
+
+[White "Van Carlsen, Piet"]
+[Black "Smith, John"]
+[Result "0-1"]
+
+1. d4 0-1
+`)
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"-Tw", "carlsen"}, 2},
+		{[]string{"--match-case", "-Tw", "carlsen"}, 0},
+		{[]string{"--match-anchored", "-Tw", "Carlsen"}, 1},
+		{[]string{"--match-exact", "-Tw", "Carlsen"}, 0},
+		{[]string{"--match-exact", "-Tw", "carlsen, magnus"}, 1},
+		{[]string{"--match-anchored", "-p", "smith"}, 1},
+	}
+	for _, tt := range tests {
+		stdout, _ := runPgnExtract(t, append(tt.args, pgn)...)
+		if got := countGames(stdout); got != tt.want {
+			t.Errorf("%v: %d game(s), want %d", tt.args, got, tt.want)
+		}
+	}
+}
+
 // TestOutputSplit tests the -# flag for splitting output
 func TestOutputSplit(t *testing.T) {
 	// Create temp directory for split files
@@ -318,6 +357,42 @@ func TestExactMaterialMatch(t *testing.T) {
 	t.Logf("-y KQR:kqr: found %d games", count)
 }
 
+// TestMaterialWindow tests --zwindow and --zplies with -z
+func TestMaterialWindow(t *testing.T) {
+	// Black is a pawn down from 2. exd5; White keeps eight pawns only
+	// until 2... Qxd5.
+	path := createTempPGN(t, "window.pgn", `[Event "Window"]
+[Result "*"]
+
+1. e4 d5 2. exd5 Qxd5 3. Nc3 Qa5 4. d4 Nf6 *
+`)
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"pattern alone", []string{"-z", "ex=8P:ex=7p"}, 1},
+		{"window excludes", []string{"-z", "ex=8P:ex=7p", "--zwindow", "3-"}, 0},
+		{"window includes", []string{"-z", ":ex=7p", "--zwindow", "3-4"}, 1},
+		{"persists", []string{"-z", ":ex=7p", "--zplies", "6"}, 1},
+		{"in passing", []string{"-z", "ex=8P:ex=7p", "--zplies", "2"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, _ := runPgnExtract(t, append(append([]string{"-s"}, tt.args...), path)...)
+			if got := countGames(stdout); got != tt.want {
+				t.Errorf("got %d games, want %d", got, tt.want)
+			}
+		})
+	}
+
+	_, stderr := runPgnExtract(t, "-s", "-z", "R:r", "--zwindow", "40-20", path)
+	if !strings.Contains(stderr, "--zwindow") {
+		t.Errorf("expected a --zwindow error, got stderr %q", stderr)
+	}
+}
+
 // TestCombinedFilters tests combining multiple new filters
 func TestCombinedFilters(t *testing.T) {
 	// Find games with at least 20 ply, result 1-0, with comments
@@ -500,3 +575,2319 @@ func TestStrictWithFixable(t *testing.T) {
 		t.Error("Expected fixable+strict to accept game after fixing tags")
 	}
 }
+
+// TestPlayerTypeFilters tests the --no-selfplay, --engines-only and --humans-only flags
+func TestPlayerTypeFilters(t *testing.T) {
+	pgnFile := createTempPGN(t, "players.pgn", `[Event "Mixed"]
+[White "Stockfish 16"]
+[Black "Komodo 14"]
+[Result "1-0"]
+
+1. e4 e5 1-0
+
+[Event "Mixed"]
+[White "Carlsen, Magnus"]
+[Black "Caruana, Fabiano"]
+[Result "1/2-1/2"]
+
+1. d4 d5 1/2-1/2
+
+[Event "Mixed"]
+[White "Carlsen, Magnus"]
+[Black "Magnus Carlsen"]
+[Result "0-1"]
+
+1. c4 c5 0-1
+`)
+
+	tests := []struct {
+		flag string
+		want int
+	}{
+		{"--no-selfplay", 2},
+		{"--engines-only", 1},
+		{"--humans-only", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			stdout, _ := runPgnExtract(t, "-s", tt.flag, pgnFile)
+			if got := countGames(stdout); got != tt.want {
+				t.Errorf("%s: got %d games, want %d", tt.flag, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestTimeClassFilter tests the --time-class and --add-timeclass flags
+func TestTimeClassFilter(t *testing.T) {
+	pgnFile := createTempPGN(t, "timecontrol.pgn", `[Event "Blitz"]
+[White "A"]
+[Black "B"]
+[Result "1-0"]
+[TimeControl "180+2"]
+
+1. e4 e5 1-0
+
+[Event "Rapid"]
+[White "C"]
+[Black "D"]
+[Result "0-1"]
+[TimeControl "900+10"]
+
+1. d4 d5 0-1
+
+[Event "Classical"]
+[White "E"]
+[Black "F"]
+[Result "1/2-1/2"]
+[TimeControl "40/7200:3600"]
+
+1. c4 c5 1/2-1/2
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--time-class", "blitz,rapid", pgnFile)
+	if got := countGames(stdout); got != 2 {
+		t.Errorf("--time-class blitz,rapid: got %d games, want 2", got)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--add-timeclass", pgnFile)
+	if !strings.Contains(stdout, `[TimeClass "classical"]`) {
+		t.Error("Expected TimeClass tag in output")
+	}
+
+	_, stderr := runPgnExtract(t, "-s", "--time-class", "lightning", pgnFile)
+	if !strings.Contains(stderr, "unknown time class") {
+		t.Errorf("Expected error for unknown time class, got: %s", stderr)
+	}
+}
+
+// TestTermination tests the --termination and --add-termination flags
+func TestTermination(t *testing.T) {
+	pgnFile := createTempPGN(t, "termination.pgn", `[Event "Flagged"]
+[Result "0-1"]
+
+1. e4 e5 2. Nf3 {White forfeits on time} 0-1
+
+[Event "Tagged"]
+[Result "1-0"]
+[Termination "Black won on time"]
+
+1. d4 d5 1-0
+
+[Event "Mated"]
+[Result "0-1"]
+
+1. f3 e5 2. g4 Qh4+ 0-1
+
+[Event "Unfinished"]
+[Result "*"]
+
+1. c4 *
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--termination", "time-forfeit", pgnFile)
+	if got := countGames(stdout); got != 2 || strings.Contains(stdout, "Mated") {
+		t.Errorf("--termination time-forfeit: got %d games, want Flagged and Tagged:\n%s", got, stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--add-termination", pgnFile)
+	for _, want := range []string{
+		"[Termination \"time forfeit\"]", "[Termination \"Black won on time\"]",
+		"[Termination \"normal\"]", "[Termination \"unterminated\"]",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("--add-termination: missing %s in output:\n%s", want, stdout)
+		}
+	}
+
+	_, stderr := runPgnExtract(t, "-s", "--termination", "resigned", pgnFile)
+	if !strings.Contains(stderr, "unknown termination") {
+		t.Errorf("Expected error for unknown termination, got: %s", stderr)
+	}
+}
+
+// TestMergeDuplicateTags tests the --merge-duplicate-tags flag
+func TestMergeDuplicateTags(t *testing.T) {
+	pgnFile := createTempPGN(t, "dups.pgn", `[Event "Club Championship"]
+[Site "?"]
+[White "Alpha"]
+[Black "Beta"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 1-0
+
+[Event "Club Ch."]
+[Site "Springfield"]
+[White "Alpha"]
+[Black "Beta"]
+[Result "1-0"]
+[ECO "C44"]
+
+1. e4 e5 2. Nf3 Nc6 1-0
+`)
+	logFile := filepath.Join(t.TempDir(), "merge.log")
+
+	stdout, _ := runPgnExtract(t, "-s", "-D", "--merge-duplicate-tags", "-l", logFile, pgnFile)
+
+	if got := countGames(stdout); got != 1 {
+		t.Fatalf("Expected 1 game after -D, got %d", got)
+	}
+	for _, want := range []string{`[Site "Springfield"]`, `[ECO "C44"]`, `[Event "Club Championship"]`} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("Expected merged output to contain %s", want)
+		}
+	}
+
+	logData, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(string(logData), "Duplicate tag conflict") || !strings.Contains(string(logData), "Club Ch.") {
+		t.Errorf("Expected Event conflict in log, got: %s", logData)
+	}
+
+	for _, extra := range []string{"-U", "--count"} {
+		_, stderr := runPgnExtract(t, "-s", "-D", "--merge-duplicate-tags", extra, pgnFile)
+		if !strings.Contains(stderr, "cannot be combined with -U or --count") {
+			t.Errorf("--merge-duplicate-tags %s: expected an error, got: %s", extra, stderr)
+		}
+	}
+}
+
+// TestDupeKeepBestAnnotated tests that --dupe-keep best-annotated keeps the annotated copy
+func TestDupeKeepBestAnnotated(t *testing.T) {
+	pgnFile := createTempPGN(t, "dupkeep.pgn", `[Event "Plain"]
+[White "Alpha"]
+[Black "Beta"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 1-0
+
+[Event "Annotated"]
+[White "Alpha"]
+[Black "Beta"]
+[Result "1-0"]
+
+1. e4 {Best by test} e5 2. Nf3 $1 Nc6 1-0
+`)
+	dupFile := filepath.Join(t.TempDir(), "dups.pgn")
+
+	stdout, _ := runPgnExtract(t, "-s", "-D", "--dupe-keep", "best-annotated", "-d", dupFile, pgnFile)
+	if got := countGames(stdout); got != 1 {
+		t.Fatalf("Expected 1 game, got %d", got)
+	}
+	if !strings.Contains(stdout, `[Event "Annotated"]`) {
+		t.Errorf("Expected annotated copy to be kept, got:\n%s", stdout)
+	}
+
+	dupData, err := os.ReadFile(dupFile)
+	if err != nil {
+		t.Fatalf("Failed to read duplicate file: %v", err)
+	}
+	if !strings.Contains(string(dupData), `[Event "Plain"]`) {
+		t.Errorf("Expected plain copy in duplicate file, got:\n%s", dupData)
+	}
+
+	for _, extra := range []string{"-U", "--count"} {
+		_, stderr := runPgnExtract(t, "-s", "-D", "--dupe-keep", "best-annotated", extra, pgnFile)
+		if !strings.Contains(stderr, "cannot be combined with -U or --count") {
+			t.Errorf("--dupe-keep best-annotated %s: expected an error, got: %s", extra, stderr)
+		}
+	}
+}
+
+// TestMultipleFENFilters tests repeatable --fen flags and --addlabeltag
+func TestMultipleFENFilters(t *testing.T) {
+	pgnFile := createTempPGN(t, "openings.pgn", `[Event "Kings Pawn"]
+[White "A"]
+[Black "B"]
+[Result "*"]
+
+1. e4 e5 *
+
+[Event "Queens Pawn"]
+[White "C"]
+[Black "D"]
+[Result "*"]
+
+1. d4 d5 *
+
+[Event "English"]
+[White "E"]
+[Black "F"]
+[Result "*"]
+
+1. c4 e5 *
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--addlabeltag",
+		"--fen", "pattern:rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR;open",
+		"--fen", "rnbqkbnr/ppp1pppp/8/3p4/3P4/8/PPP1PPPP/RNBQKBNR w KQkq - 0 2;closed",
+		pgnFile)
+
+	if got := countGames(stdout); got != 2 {
+		t.Errorf("Expected 2 games, got %d", got)
+	}
+	if !strings.Contains(stdout, `[MatchLabel "open"]`) || !strings.Contains(stdout, `[MatchLabel "closed"]`) {
+		t.Errorf("Expected MatchLabel tags in output, got:\n%s", stdout)
+	}
+}
+
+// TestNextMoveConstraint tests --fen combined with --next-move
+func TestNextMoveConstraint(t *testing.T) {
+	pgnFile := createTempPGN(t, "nextmove.pgn", `[Event "Knight"]
+[White "A"]
+[Black "B"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 Nc6 *
+
+[Event "Bishop"]
+[White "C"]
+[Black "D"]
+[Result "*"]
+
+1. e4 e5 2. Bc4 Nf6 *
+`)
+	fen := "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2"
+
+	stdout, _ := runPgnExtract(t, "-s", "--fen", fen, pgnFile)
+	if got := countGames(stdout); got != 2 {
+		t.Errorf("Without --next-move: got %d games, want 2", got)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--fen", fen, "--next-move", "Nf3", pgnFile)
+	if got := countGames(stdout); got != 1 || !strings.Contains(stdout, `[Event "Knight"]`) {
+		t.Errorf("With --next-move Nf3: got %d games, want only the Knight game", got)
+	}
+
+	tagFile := createTempPGN(t, "criteria.txt", "FEN \""+fen+"\"\n")
+	stdout, _ = runPgnExtract(t, "-s", "-t", tagFile, "--next-move", "Nf3", pgnFile)
+	if got := countGames(stdout); got != 1 || !strings.Contains(stdout, `[Event "Knight"]`) {
+		t.Errorf("With a -t FEN line and --next-move Nf3: got %d games, want only the Knight game", got)
+	}
+
+	_, stderr := runPgnExtract(t, "-s", "--next-move", "Nf3", pgnFile)
+	if !strings.Contains(stderr, "--next-move needs a position") {
+		t.Errorf("--next-move without a position: expected an error, got: %s", stderr)
+	}
+}
+
+func TestPositionFiltersSkipUnreplayableGames(t *testing.T) {
+	pgnFile := createTempPGN(t, "broken.pgn", `[Event "Legal"]
+[White "A"]
+[Black "B"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 Nc6 *
+
+[Event "Broken"]
+[White "C"]
+[Black "D"]
+[Result "*"]
+
+1. e4 e5 2. Ke3 Nc6 *
+`)
+	fen := "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2"
+
+	stdout, stderr := runPgnExtract(t, "--fen", fen, pgnFile)
+	if got := countGames(stdout); got != 1 || !strings.Contains(stdout, `[Event "Legal"]`) {
+		t.Errorf("got %d games, want only the Legal game", got)
+	}
+	if !strings.Contains(stderr, "illegal move at ply 3: Ke3") {
+		t.Errorf("expected replay failure on stderr, got %q", stderr)
+	}
+
+	// Tag-only filtering does not need to replay the game.
+	stdout, _ = runPgnExtract(t, "-s", pgnFile)
+	if got := countGames(stdout); got != 2 {
+		t.Errorf("without position filters: got %d games, want 2", got)
+	}
+}
+
+func TestPositionOutputFormats(t *testing.T) {
+	pgnFile := createTempPGN(t, "clocks.pgn", `[Event "Clocks"]
+[White "A"]
+[Black "B"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 Nc6 *
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "-W", "epd", pgnFile)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("EPD output: got %d lines, want 5:\n%s", len(lines), stdout)
+	}
+	if want := `r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - hmvc 2; fmvn 3; id "Clocks, game 1, ply 4"; c0 "A - B";`; lines[4] != want {
+		t.Errorf("final EPD = %q, want %q", lines[4], want)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "-W", "epd", "--epd-bm", pgnFile)
+	lines = strings.Split(strings.TrimSpace(stdout), "\n")
+	if want := `rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 hmvc 0; fmvn 1; bm e5; id "Clocks, game 1, ply 1"; c0 "A - B";`; lines[1] != want {
+		t.Errorf("--epd-bm EPD = %q, want %q", lines[1], want)
+	}
+	if strings.Contains(lines[4], "bm ") {
+		t.Errorf("final position has no move played, got %q", lines[4])
+	}
+
+	// bm is written in SAN whatever notation the game used.
+	lalgFile := createTempPGN(t, "lalg.pgn", `[Event "LALG"]
+[Result "*"]
+
+1. e2e4 b8c6 2. g1f3 *
+`)
+	stdout, _ = runPgnExtract(t, "-s", "-W", "epd", "--epd-bm", lalgFile)
+	var bms []string
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		if _, rest, ok := strings.Cut(line, "; bm "); ok {
+			bms = append(bms, rest[:strings.Index(rest, ";")])
+		}
+	}
+	if got := strings.Join(bms, " "); got != "e4 Nc6 Nf3" {
+		t.Errorf("--epd-bm from long algebraic: bm moves %q, want %q", got, "e4 Nc6 Nf3")
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "-W", "fen", pgnFile)
+	if !strings.Contains(stdout, "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3") {
+		t.Errorf("FEN output missing final position:\n%s", stdout)
+	}
+}
+
+func TestNullMovePolicies(t *testing.T) {
+	pgnFile := createTempPGN(t, "null.pgn", `[Event "Null"]
+[White "A"]
+[Black "B"]
+[Result "*"]
+
+1. e4 -- 2. d4 e5 *
+
+[Event "Clean"]
+[White "C"]
+[Black "D"]
+[Result "*"]
+
+1. d4 d5 *
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--keep-null", "--validate", "-W", "uci", pgnFile)
+	if got := countGames(stdout); got != 2 || !strings.Contains(stdout, "e2e4 0000") {
+		t.Errorf("--keep-null: got %d games, want 2 with a 0000 null move:\n%s", got, stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--reject-null", pgnFile)
+	if got := countGames(stdout); got != 1 || !strings.Contains(stdout, `[Event "Clean"]`) {
+		t.Errorf("--reject-null: got %d games, want only the Clean game", got)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--convert-null-to-comment", "--validate", pgnFile)
+	if got := countGames(stdout); got != 2 || !strings.Contains(stdout, "1. e4 {-- d4 e5} *") {
+		t.Errorf("--convert-null-to-comment: got %d games, want the null line as a comment:\n%s", got, stdout)
+	}
+}
+
+func TestDuplicateTagKeys(t *testing.T) {
+	pgnFile := createTempPGN(t, "dupetags.pgn", `[Event "Repeated"]
+[Date "2020.01.01"]
+[Date "2021.02.02"]
+[Result "*"]
+
+1. e4 *
+
+[Event "Clean"]
+[Date "2022.03.03"]
+[Result "*"]
+
+1. d4 *
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--duplicate-tags", "first", pgnFile)
+	if !strings.Contains(stdout, `[Date "2020.01.01"]`) {
+		t.Errorf("--duplicate-tags first: expected first Date to be kept:\n%s", stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--no-duplicate-tag-keys", pgnFile)
+	if got := countGames(stdout); got != 1 || !strings.Contains(stdout, `[Event "Clean"]`) {
+		t.Errorf("--no-duplicate-tag-keys: got %d games, want only the Clean game", got)
+	}
+}
+
+func TestKeepHeader(t *testing.T) {
+	pgnFile := createTempPGN(t, "header.pgn", "\xEF\xBB\xBF% Collection: club games\n{Source: club archive}\n\n[Event \"A\"]\n[Result \"*\"]\n\n1. e4 *\n")
+
+	stdout, _ := runPgnExtract(t, "-s", pgnFile)
+	if strings.Contains(stdout, "Collection") || strings.HasPrefix(stdout, "\xEF\xBB\xBF") {
+		t.Errorf("header should be dropped by default:\n%s", stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--keep-header", pgnFile)
+	want := "\xEF\xBB\xBF% Collection: club games\n{Source: club archive}\n\n[Event \"A\"]"
+	if !strings.HasPrefix(stdout, want) {
+		t.Errorf("--keep-header: output does not start with the header:\n%q", stdout)
+	}
+}
+
+func TestSizeLimitFlags(t *testing.T) {
+	pgnFile := createTempPGN(t, "sizes.pgn", `[Event "Small"]
+[Result "*"]
+
+1. e4 e5 *
+
+[Event "Engine log"]
+[Result "*"]
+
+1. d4 {`+strings.Repeat("depth 30 score cp 15 ", 50)+`} d5 *
+`)
+
+	stdout, stderr := runPgnExtract(t, "-s", "--max-comment-bytes", "200", pgnFile)
+	if got := countGames(stdout); got != 1 || !strings.Contains(stdout, `[Event "Small"]`) {
+		t.Errorf("--max-comment-bytes: got %d games, want only the Small game", got)
+	}
+	if !strings.Contains(stderr, "Size limit:") {
+		t.Errorf("expected a Size limit message, got %q", stderr)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--max-game-bytes", "500", pgnFile)
+	if got := countGames(stdout); got != 1 {
+		t.Errorf("--max-game-bytes: got %d games, want 1", got)
+	}
+}
+
+func TestCQLOutputPositions(t *testing.T) {
+	pgnFile := createTempPGN(t, "checks.pgn", `[Event "Checks"]
+[White "A"]
+[Black "B"]
+[Result "0-1"]
+
+1. e4 e5 2. Bc4 Nc6 3. Bxf7+ Kxf7 4. Qh5+ g6 0-1
+`)
+	cqlFile := createTempPGN(t, "checks.cql", "check")
+
+	stdout, _ := runPgnExtract(t, "-s", "--cql-file", cqlFile, "--cql-output", "positions", pgnFile)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("positions output: got %d lines, want 2:\n%s", len(lines), stdout)
+	}
+	for _, line := range lines {
+		if !strings.HasSuffix(line, `id "checks";`) {
+			t.Errorf("EPD record %q missing query id", line)
+		}
+	}
+	if countGames(stdout) != 0 {
+		t.Errorf("positions output should not include games:\n%s", stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--cql", "check", "--cql-output", "both", pgnFile)
+	if !strings.Contains(stdout, `id "cql";`) || countGames(stdout) != 1 {
+		t.Errorf("both output should hold positions and the game:\n%s", stdout)
+	}
+}
+
+func TestRookSquareCastlingRepair(t *testing.T) {
+	pgnFile := createTempPGN(t, "relay.pgn", `[Event "Relay"]
+[White "A"]
+[Black "B"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bc4 Bc5 4. e1h1 Nf6 *
+`)
+
+	stdout, stderr := runPgnExtract(t, "--validate", pgnFile)
+	if !strings.Contains(stdout, "4. O-O Nf6") {
+		t.Errorf("castling move not repaired:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "1 castling move(s)") {
+		t.Errorf("stderr missing repair count:\n%s", stderr)
+	}
+}
+
+func TestFirstNPliesRelayDedupe(t *testing.T) {
+	pgnFile := createTempPGN(t, "relay.pgn", `[Event "Live"]
+[Round "1"]
+[White "A"]
+[Black "B"]
+[Result "*"]
+
+1. e4 e5 *
+
+[Event "Live"]
+[Round "1"]
+[White "C"]
+[Black "D"]
+[Result "*"]
+
+1. d4 *
+
+[Event "Live"]
+[Round "1"]
+[White "A"]
+[Black "B"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 1-0
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--first-n-plies", "4", pgnFile)
+	if got := countGames(stdout); got != 2 {
+		t.Fatalf("got %d games, want 2:\n%s", got, stdout)
+	}
+	if !strings.Contains(stdout, "3. Bb5 a6 1-0") || strings.Contains(stdout, "1. e4 e5 *") {
+		t.Errorf("relay dedupe should keep the longest copy:\n%s", stdout)
+	}
+}
+
+func TestSplitByResult(t *testing.T) {
+	pgnFile := createTempPGN(t, "results.pgn", `[Event "W"]
+[Result "1-0"]
+
+1. e4 1-0
+
+[Event "B"]
+[Result "0-1"]
+
+1. d4 0-1
+
+[Event "D"]
+[Result "1/2-1/2"]
+
+1. c4 1/2-1/2
+
+[Event "U"]
+[Result "*"]
+
+1. Nf3 *
+
+[Event "W2"]
+[Result "1-0"]
+
+1. b3 1-0
+`)
+
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"w.pgn", "b.pgn", "d.pgn", "u.pgn"} {
+		files = append(files, filepath.Join(dir, name))
+	}
+
+	runPgnExtract(t, "-s", "--split-by-result", "--result-files", strings.Join(files, ","), pgnFile)
+
+	for i, want := range []int{2, 1, 1, 1} {
+		data, err := os.ReadFile(files[i])
+		if err != nil {
+			t.Fatalf("reading %s: %v", files[i], err)
+		}
+		if got := countGames(string(data)); got != want {
+			t.Errorf("%s: got %d games, want %d", filepath.Base(files[i]), got, want)
+		}
+	}
+}
+
+func TestSplitDate(t *testing.T) {
+	pgnFile := createTempPGN(t, "dates.pgn", `[Event "A"]
+[Date "1972.07.11"]
+[Result "1-0"]
+
+1. e4 1-0
+
+[Event "B"]
+[Date "1972.08.??"]
+[Result "0-1"]
+
+1. d4 0-1
+
+[Event "C"]
+[Date "1972.??.??"]
+[Result "*"]
+
+1. c4 *
+
+[Event "D"]
+[Date "????.??.??"]
+[Result "*"]
+
+1. Nf3 *
+`)
+
+	dir := t.TempDir()
+	base := filepath.Join(dir, "games")
+	runPgnExtract(t, "-s", "--splitdate", "year", "-o", base+".pgn", pgnFile)
+	for name, want := range map[string]int{"games_1972.pgn": 3, "games_unknown.pgn": 1} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		if got := countGames(string(data)); got != want {
+			t.Errorf("%s: got %d games, want %d", name, got, want)
+		}
+	}
+
+	base = filepath.Join(dir, "monthly")
+	runPgnExtract(t, "-s", "--splitdate", "month", "--eco-max-handles", "1", "-o", base+".pgn", pgnFile)
+	for _, name := range []string{"monthly_1972-07.pgn", "monthly_1972-08.pgn", "monthly_1972-unknown.pgn", "monthly_unknown.pgn"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		if got := countGames(string(data)); got != 1 {
+			t.Errorf("%s: got %d games, want 1", name, got)
+		}
+	}
+
+	_, stderr := runPgnExtract(t, "-s", "--splitdate", "week", pgnFile)
+	if !strings.Contains(stderr, "unknown --splitdate period") {
+		t.Errorf("Expected error for unknown period, got: %s", stderr)
+	}
+}
+
+func TestSplitPlayer(t *testing.T) {
+	pgnFile := createTempPGN(t, "players.pgn", `[Event "A"]
+[White "Carlsen, Magnus"]
+[Black "Caruana, Fabiano"]
+[Result "1-0"]
+
+1. e4 1-0
+
+[Event "B"]
+[White "Fabiano Caruana"]
+[Black "Nakamura, Hikaru"]
+[Result "0-1"]
+
+1. d4 0-1
+`)
+
+	dir := t.TempDir()
+	runPgnExtract(t, "-s", "--splitplayer", "--eco-max-handles", "1", "-o", filepath.Join(dir, "t.pgn"), pgnFile)
+	for name, want := range map[string]int{"t_carlsen.pgn": 1, "t_caruana.pgn": 2, "t_nakamura.pgn": 1} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		if got := countGames(string(data)); got != want {
+			t.Errorf("%s: got %d games, want %d", name, got, want)
+		}
+	}
+
+	_, stderr := runPgnExtract(t, "-s", "--splitplayer", "--splitdate", "year", pgnFile)
+	if !strings.Contains(stderr, "cannot be combined") {
+		t.Errorf("Expected error for --splitplayer with --splitdate, got: %s", stderr)
+	}
+}
+
+func TestPlayerAsWhite(t *testing.T) {
+	pgnFile := createTempPGN(t, "perspective.pgn", `[Event "As Black"]
+[White "Other"]
+[Black "Hero, A"]
+[Result "0-1"]
+
+1. e4 c5 0-1
+
+[Event "As White"]
+[White "Hero, A"]
+[Black "Other"]
+[Result "1-0"]
+
+1. d4 d5 1-0
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--player-as-white", "hero", pgnFile)
+	if strings.Count(stdout, `[White "Hero, A"]`) != 2 {
+		t.Errorf("expected Hero as White in both games:\n%s", stdout)
+	}
+	if strings.Count(stdout, `[Flipped "1"]`) != 1 {
+		t.Errorf("expected exactly one flipped game:\n%s", stdout)
+	}
+	if !strings.Contains(stdout, "1... e5 2. c4 1-0") {
+		t.Errorf("flipped moves missing:\n%s", stdout)
+	}
+}
+
+func TestInjectComments(t *testing.T) {
+	pgnFile := createTempPGN(t, "inject.pgn", `[Event "T"]
+[Site "Berlin"]
+[GameId "Game1"]
+[Result "*"]
+
+1. e4 c5 2. Nf3 d6 *
+
+[Event "U"]
+[Site "Berlin"]
+[Result "*"]
+
+1. d4 d5 *
+`)
+	csvFile := createTempPGN(t, "notes.csv", `game,ply,comment
+game1,0,Prepared at home
+game1,3,"Sharp, as ever"
+# comments are ignored
+game1,40,past the end
+Berlin,1,not a key
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--inject-comments", csvFile, pgnFile)
+	if !strings.Contains(stdout, "{Prepared at home} 1. e4 c5 2. Nf3 {Sharp, as ever} d6 *") {
+		t.Errorf("comments not injected:\n%s", stdout)
+	}
+	if !strings.Contains(stdout, "1. d4 d5 *") {
+		t.Errorf("unmatched game should be unchanged:\n%s", stdout)
+	}
+}
+
+func TestInjectCommentsBadPly(t *testing.T) {
+	_, err := readCommentInjector(strings.NewReader("g,1,ok\ng,x,bad\n"))
+	if err == nil || !strings.Contains(err.Error(), "row 2") {
+		t.Errorf("readCommentInjector() error = %v, want row 2 error", err)
+	}
+
+	_, err = readCommentInjector(strings.NewReader("g,1,ok\ng,-1,before the start\n"))
+	if err == nil || !strings.Contains(err.Error(), "row 2: ply -1 is negative") {
+		t.Errorf("readCommentInjector() error = %v, want negative ply error", err)
+	}
+}
+
+func TestPerFileLimitAndSkip(t *testing.T) {
+	var sb strings.Builder
+	for i := 1; i <= 4; i++ {
+		fmt.Fprintf(&sb, "[Event \"G%d\"]\n[Result \"*\"]\n\n1. e4 *\n\n", i)
+	}
+	first := createTempPGN(t, "first.pgn", sb.String())
+	second := createTempPGN(t, "second.pgn", strings.ReplaceAll(sb.String(), "\"G", "\"H"))
+
+	stdout, _ := runPgnExtract(t, "-s", "--per-file-limit", "2", "--per-file-skip", "1", first, second)
+	for _, event := range []string{"G2", "G3", "H2", "H3"} {
+		if !strings.Contains(stdout, `[Event "`+event+`"]`) {
+			t.Errorf("missing game %s:\n%s", event, stdout)
+		}
+	}
+	if got := countGames(stdout); got != 4 {
+		t.Errorf("got %d games, want 4", got)
+	}
+
+	for _, collect := range []string{"--interleave", "--reconcile", "--sort=Elo"} {
+		_, stderr := runPgnExtract(t, "-s", "--per-file-limit", "2", collect, first, second)
+		if !strings.Contains(stderr, "--per-file-limit cannot be combined") {
+			t.Errorf("--per-file-limit with %s: expected an error, got: %s", collect, stderr)
+		}
+	}
+}
+
+func TestInterleave(t *testing.T) {
+	var a, b strings.Builder
+	for i := 1; i <= 3; i++ {
+		fmt.Fprintf(&a, "[Event \"A%d\"]\n[Result \"*\"]\n\n1. e4 *\n\n", i)
+	}
+	fmt.Fprintf(&b, "[Event \"B1\"]\n[Result \"*\"]\n\n1. d4 *\n\n")
+	first := createTempPGN(t, "a.pgn", a.String())
+	second := createTempPGN(t, "b.pgn", b.String())
+
+	stdout, _ := runPgnExtract(t, "-s", "--interleave", first, second)
+	var order []string
+	for _, line := range strings.Split(stdout, "\n") {
+		if strings.HasPrefix(line, "[Event ") {
+			order = append(order, strings.Trim(strings.TrimPrefix(line, "[Event "), "\"]"))
+		}
+	}
+	if got := strings.Join(order, ","); got != "A1,B1,A2,A3" {
+		t.Errorf("order = %s, want A1,B1,A2,A3", got)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--interleave", "--stopafter", "2", first, second)
+	if !strings.Contains(stdout, `[Event "B1"]`) || countGames(stdout) != 2 {
+		t.Errorf("--stopafter 2 should take one game from each file:\n%s", stdout)
+	}
+}
+
+func TestExtractMoveRange(t *testing.T) {
+	pgn := createTempPGN(t, "game.pgn", `[Event "T"]
+[White "A"]
+[Black "B"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 4. Ba4 Nf6 1-0
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--extract-moves", "2-3", pgn)
+	for _, want := range []string{
+		`[FEN "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2"]`,
+		`[SetUp "1"]`,
+		`[Result "*"]`,
+		"2. Nf3 Nc6 3. Bb5 a6 *",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("missing %q in:\n%s", want, stdout)
+		}
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--extract-plies", "7-", pgn)
+	if !strings.Contains(stdout, "4. Ba4 Nf6 1-0") || !strings.Contains(stdout, `[Result "1-0"]`) {
+		t.Errorf("open-ended extract should keep the result:\n%s", stdout)
+	}
+}
+
+func TestSetUpMoveNumbers(t *testing.T) {
+	pgn := createTempPGN(t, "setup.pgn", `[Event "T"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 b - - 0 37"]
+[Result "*"]
+
+37... Kd7 38. e4 Kc6 39. e5 *
+`)
+
+	// Move numbers are those of the game, not counted from 1
+	stdout, _ := runPgnExtract(t, "-s", "--extract-moves", "38-38", pgn)
+	if !strings.Contains(stdout, `[FEN "8/3k4/8/8/8/8/4P3/4K3 w - - 1 38"]`) || !strings.Contains(stdout, "38. e4 Kc6 *") {
+		t.Errorf("--extract-moves 38-38:\n%s", stdout)
+	}
+
+	// Black's first move counts as a move: the game spans moves 37 to 39
+	stdout, _ = runPgnExtract(t, "-s", "--exactmoves", "3", pgn)
+	if countGames(stdout) != 1 {
+		t.Errorf("--exactmoves 3 should match the game:\n%s", stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "-J", pgn)
+	if !strings.Contains(stdout, `"moveNumber": 37`) {
+		t.Errorf("JSON should number Black's first move 37:\n%s", stdout)
+	}
+}
+
+func TestExportFeatures(t *testing.T) {
+	csvPath := filepath.Join(t.TempDir(), "features.csv")
+	runPgnExtract(t, "-s", "--export-features", csvPath, inputFile("fischer.pgn"))
+
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatalf("reading feature file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if !strings.HasPrefix(lines[0], "Event,Site,Date,White,Black,") || !strings.HasSuffix(lines[0], ",material_final") {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if !strings.Contains(lines[1], ",1/2-1/2,73,O-O,O-O-O,26,8,1,1,") {
+		t.Errorf("unexpected first row %q", lines[1])
+	}
+	stdout, _ := runPgnExtract(t, "-s", inputFile("fischer.pgn"))
+	if got := len(lines) - 1; got != countGames(stdout) {
+		t.Errorf("got %d rows, want one per game (%d)", got, countGames(stdout))
+	}
+}
+
+func TestPieceValues(t *testing.T) {
+	pgn := createTempPGN(t, "minor.pgn", `[Event "Minor"]
+[SetUp "1"]
+[FEN "4k1n1/8/8/8/8/8/8/2B1K3 b - - 0 1"]
+[Result "*"]
+
+1... Kd7 2. Kd2 Ke7 *
+`)
+	stdout, _ := runPgnExtract(t, "-s", "--material-comments", "1", pgn)
+	if !strings.Contains(stdout, "{material: 0 (B vs N)}") {
+		t.Errorf("default values: expected a level balance:\n%s", stdout)
+	}
+	stdout, _ = runPgnExtract(t, "-s", "--material-comments", "1", "--piece-values", "N=3.2,B=3.35", pgn)
+	if !strings.Contains(stdout, "{material: +0.15 (B vs N)}") {
+		t.Errorf("--piece-values: expected White 0.15 ahead:\n%s", stdout)
+	}
+
+	query := `(> (material "white") (material "black"))`
+	if stdout, _ = runPgnExtract(t, "-s", "--cql", query, pgn); countGames(stdout) != 0 {
+		t.Errorf("default values: CQL should not find White ahead:\n%s", stdout)
+	}
+	if stdout, _ = runPgnExtract(t, "-s", "--piece-values", "B=3.3", "--cql", query, pgn); countGames(stdout) != 1 {
+		t.Errorf("--piece-values B=3.3: CQL should find White ahead:\n%s", stdout)
+	}
+
+	_, stderr := runPgnExtract(t, "--piece-values", "K=4", pgn)
+	if !strings.Contains(stderr, "Error: --piece-values") {
+		t.Errorf("--piece-values K=4: stderr = %q", stderr)
+	}
+}
+
+func TestPositionIndex(t *testing.T) {
+	pgn := createTempPGN(t, "two.pgn", `[Result "*"]
+
+1. e4 e5 *
+
+[Result "*"]
+
+1. d4 *
+`)
+	dir := t.TempDir()
+
+	csvPath := filepath.Join(dir, "positions.csv")
+	runPgnExtract(t, "-s", "--posindex", csvPath, "--posindex-format", "csv", pgn)
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatalf("reading position index: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 6 || lines[0] != "game,ply,hash" {
+		t.Fatalf("want a header and 5 records, got:\n%s", data)
+	}
+	first, second := strings.Split(lines[1], ","), strings.Split(lines[4], ",")
+	if first[0] != "1" || first[1] != "0" || second[0] != "2" || second[1] != "0" || first[2] != second[2] {
+		t.Errorf("both games should start with the same ply 0 hash: %q, %q", lines[1], lines[4])
+	}
+	if lines[2] == lines[3] || !strings.HasPrefix(lines[3], "1,2,") {
+		t.Errorf("unexpected records %q, %q", lines[2], lines[3])
+	}
+
+	binPath := filepath.Join(dir, "positions.idx")
+	runPgnExtract(t, "-s", "--posindex", binPath, pgn)
+	stdout, _ := runPgnExtract(t, "index", "query", "-list", "-fen", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", binPath)
+	if stdout != "game 1 ply 0\ngame 2 ply 0\n" {
+		t.Errorf("index query -list on the binary index = %q, want both games at ply 0", stdout)
+	}
+	_, stderr := runPgnExtract(t, "index", "query", "-fen", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", binPath)
+	if !strings.Contains(stderr, "use -list") {
+		t.Errorf("index query without -list: stderr = %q", stderr)
+	}
+}
+
+func TestDuplicateFileNamesOriginal(t *testing.T) {
+	pgn := createTempPGN(t, "dupes.pgn", `[Event "Original"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 *
+
+[Event "Other"]
+[Result "*"]
+
+1. d4 *
+
+[Event "Copy"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 *
+`)
+	dupPath := filepath.Join(t.TempDir(), "dupes.pgn")
+	stdout, _ := runPgnExtract(t, "-D", "-d", dupPath, pgn)
+	if countGames(stdout) != 2 || strings.Contains(stdout, "DuplicateOf") {
+		t.Errorf("kept games should be untagged:\n%s", stdout)
+	}
+
+	data, err := os.ReadFile(dupPath)
+	if err != nil {
+		t.Fatalf("reading duplicate file: %v", err)
+	}
+	dupes := string(data)
+	for _, want := range []string{`[Event "Copy"]`, `[DuplicateOfFile "` + pgn + `"]`, `[DuplicateOfGame "1"]`, `[DuplicateOf "`} {
+		if !strings.Contains(dupes, want) {
+			t.Errorf("duplicate file should contain %s:\n%s", want, dupes)
+		}
+	}
+}
+
+func TestDupePlies(t *testing.T) {
+	pgn := createTempPGN(t, "truncated.pgn", `[Event "Full"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 1-0
+
+[Event "Truncated"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 Nc6 *
+
+[Event "Different"]
+[Result "*"]
+
+1. e4 c5 2. Nf3 d6 *
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "-D", pgn)
+	if countGames(stdout) != 3 {
+		t.Errorf("without --dupe-plies all 3 games should be kept, got %d", countGames(stdout))
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "-D", "--dupe-plies", "4", pgn)
+	if countGames(stdout) != 2 || strings.Contains(stdout, `[Event "Truncated"]`) {
+		t.Errorf("games agreeing on the first 4 plies should be duplicates:\n%s", stdout)
+	}
+}
+
+func TestFuzzyDup(t *testing.T) {
+	pgn := createTempPGN(t, "near.pgn", `[Event "Full"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 1-0
+
+[Event "Missing last move"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 *
+
+[Event "Transposed"]
+[Result "*"]
+
+1. Nf3 Nc6 2. e4 e5 3. Bb5 a6 *
+`)
+
+	stdout, stderr := runPgnExtract(t, "--fuzzydup", "4", pgn)
+	if countGames(stdout) != 2 || strings.Contains(stdout, `[Event "Missing last move"]`) {
+		t.Errorf("only the game missing its last move should be a near-duplicate:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "2 game(s) output, 1 near-duplicate(s) out of 3.") {
+		t.Errorf("near-duplicates not reported: %s", stderr)
+	}
+
+	// --dupe-plies compares only the position reached, so the transposition matches too
+	stdout, _ = runPgnExtract(t, "-s", "-D", "--dupe-plies", "4", pgn)
+	if countGames(stdout) != 1 {
+		t.Errorf("--dupe-plies 4 should keep 1 game, got %d", countGames(stdout))
+	}
+
+	_, stderr = runPgnExtract(t, "--fuzzydup", "4", "--dupe-plies", "4", pgn)
+	if !strings.Contains(stderr, "cannot be combined") {
+		t.Errorf("expected an error combining --fuzzydup and --dupe-plies: %s", stderr)
+	}
+}
+
+func TestPhoneticTags(t *testing.T) {
+	pgn := createTempPGN(t, "players.pgn", `[Event "T"]
+[White "Tal, Mikhail"]
+[Black "?"]
+[Result "*"]
+
+1. e4 *
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--add-phonetic-tags", pgn)
+	if !strings.Contains(stdout, `[WhiteSoundex "T45240"]`) {
+		t.Errorf("expected WhiteSoundex tag:\n%s", stdout)
+	}
+	if strings.Contains(stdout, "BlackSoundex") {
+		t.Errorf("an unknown player should get no code:\n%s", stdout)
+	}
+
+	csvPath := filepath.Join(t.TempDir(), "features.csv")
+	runPgnExtract(t, "-s", "--add-phonetic-tags", "--export-features", csvPath, pgn)
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatalf("reading feature file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if !strings.Contains(lines[0], ",Result,WhiteSoundex,BlackSoundex,plies,") || !strings.Contains(lines[1], ",*,T45240,,1,") {
+		t.Errorf("expected Soundex columns:\n%s", data)
+	}
+}
+
+func TestDebugStats(t *testing.T) {
+	_, stderr := runPgnExtract(t, "--debug-stats", "-o", filepath.Join(t.TempDir(), "out.pgn"), inputFile("fischer.pgn"))
+	for _, want := range []string{"Debug statistics:", "games parsed     34", "parse time", "MOVE=", "RAV depths       none"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("stderr missing %q:\n%s", want, stderr)
+		}
+	}
+}
+
+func TestAsyncOutput(t *testing.T) {
+	dir := t.TempDir()
+	syncPath, asyncPath := filepath.Join(dir, "sync.pgn"), filepath.Join(dir, "async.pgn")
+	runPgnExtract(t, "-s", "-o", syncPath, inputFile("fischer.pgn"))
+	_, stderr := runPgnExtract(t, "-s", "--fsync-every", "10", "--debug-stats", "-o", asyncPath, inputFile("fischer.pgn"))
+
+	want, err := os.ReadFile(syncPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(asyncPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) == 0 || !bytes.Equal(got, want) {
+		t.Errorf("asynchronous output differs: %d bytes, want %d", len(got), len(want))
+	}
+	if !strings.Contains(stderr, "write stalls") {
+		t.Errorf("expected write stall figures:\n%s", stderr)
+	}
+
+	_, stderr = runPgnExtract(t, "--async-output", inputFile("fischer.pgn"))
+	if !strings.Contains(stderr, "need a single -o output file") {
+		t.Errorf("expected -o error, got %q", stderr)
+	}
+
+	// A failed write must fail the run
+	if _, err := os.Stat("/dev/full"); err != nil {
+		return
+	}
+	cmd := exec.Command(buildTestBinary(t), "-s", "--async-output", "-o", "/dev/full", inputFile("fischer.pgn")) //nolint:gosec,noctx // G204: test runs the built binary
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || !strings.Contains(string(out), "Error writing output file /dev/full") {
+		t.Errorf("writing to /dev/full: err %v, output %q; want a non-zero exit and an error", err, out)
+	}
+}
+
+func TestStreamedInput(t *testing.T) {
+	// More games than one batch, alternating between two move sequences
+	var sb strings.Builder
+	sb.WriteString("% Collection header\n\n")
+	for i := 0; i < 2500; i++ {
+		moves := "1. e4 e5 *"
+		if i%2 == 1 {
+			moves = "1. d4 d5 *"
+		}
+		fmt.Fprintf(&sb, "[Event \"Game %d\"]\n\n%s\n\n", i+1, moves)
+	}
+	pgn := createTempPGN(t, "many.pgn", sb.String())
+
+	stdout, _ := runPgnExtract(t, "-s", "-D", pgn)
+	if got := countGames(stdout); got != 2 {
+		t.Errorf("duplicates across batches: got %d games, want 2", got)
+	}
+	stdout, _ = runPgnExtract(t, "-s", "--per-file-skip", "1500", pgn)
+	if got := countGames(stdout); got != 1000 || !strings.Contains(stdout, `[Event "Game 1501"]`) {
+		t.Errorf("skip across batches: got %d games, want 1000 from game 1501", got)
+	}
+	stdout, _ = runPgnExtract(t, "-s", "--stopafter", "1200", "--keep-header", pgn)
+	if got := countGames(stdout); got != 1200 || !strings.HasPrefix(stdout, "% Collection header\n") {
+		t.Errorf("stopafter with header: got %d games, want 1200 after the header", got)
+	}
+}
+
+func TestFirstIllegalPly(t *testing.T) {
+	pgnFile := createTempPGN(t, "illegal.pgn", `[Event "Legal"]
+[Result "*"]
+
+1. e4 e5 *
+
+[Event "Illegal"]
+[Result "*"]
+
+1. e4 e5 2. Ke3 Nc6 *
+
+[Event "Pinned"]
+[Result "*"]
+
+1. d4 e5 2. Nc3 Bb4 3. Ne4 *
+`)
+
+	report := filepath.Join(t.TempDir(), "illegal.csv")
+	stdout, _ := runPgnExtract(t, "-s", "--first-illegal-ply", report, pgnFile)
+	if got := countGames(stdout); got != 3 {
+		t.Errorf("games should still be output, got %d, want 3", got)
+	}
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatalf("reading report: %v", err)
+	}
+	want := "file,game,ply,move,reason\n" +
+		pgnFile + ",2,3,Ke3,has no king that can move to e3\n" +
+		pgnFile + ",3,5,Ne4,leaves the king in check\n"
+	if string(data) != want {
+		t.Errorf("report:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestStrictSAN(t *testing.T) {
+	pgn := createTempPGN(t, "san.pgn", `[Event "Ambiguous"]
+[Result "*"]
+
+1. Nf3 Nf6 2. d3 d6 3. Nd2 *
+
+[Event "Clean"]
+[Result "*"]
+
+1. e4 e5 2. Nc3 Nc6 3. Nge2 *
+`)
+
+	stdout, stderr := runPgnExtract(t, "--strict-san", "reject", pgn)
+	if countGames(stdout) != 1 || !strings.Contains(stdout, `[Event "Clean"]`) {
+		t.Errorf("reject should keep only the clean game:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "Nd2 is ambiguous") {
+		t.Errorf("stderr should explain the rejection:\n%s", stderr)
+	}
+
+	stdout, stderr = runPgnExtract(t, "--strict-san", "report", pgn)
+	if countGames(stdout) != 2 || !strings.Contains(stderr, "ply 5: Nd2 is ambiguous") {
+		t.Errorf("report should keep both games and log the problem:\nstdout:\n%s\nstderr:\n%s", stdout, stderr)
+	}
+}
+
+func TestLegality(t *testing.T) {
+	pgn := createTempPGN(t, "castling.pgn", `[Event "Through check"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/5r2/R3K2R w KQ - 0 1"]
+[Result "*"]
+
+1. O-O *
+
+[Event "Clean"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bc4 Bc5 4. O-O *
+`)
+
+	stdout, stderr := runPgnExtract(t, "--legality", "strict", pgn)
+	if countGames(stdout) != 1 || !strings.Contains(stdout, `[Event "Clean"]`) {
+		t.Errorf("strict should keep only the clean game:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "O-O castles through the attacked square f1") ||
+		!strings.Contains(stderr, "1 game(s) with illegal castling rejected.") {
+		t.Errorf("stderr should explain and count the rejection:\n%s", stderr)
+	}
+
+	stdout, stderr = runPgnExtract(t, "--legality", "castling-lenient", pgn)
+	if countGames(stdout) != 2 || !strings.Contains(stderr, "ply 1: O-O castles through the attacked square f1.") ||
+		!strings.Contains(stderr, "1 game(s) with illegal castling kept with warnings.") {
+		t.Errorf("castling-lenient should keep both games with a warning:\nstdout:\n%s\nstderr:\n%s", stdout, stderr)
+	}
+
+	stdout, stderr = runPgnExtract(t, pgn)
+	if countGames(stdout) != 2 || strings.Contains(stderr, "castl") {
+		t.Errorf("off should accept castling unchecked:\nstdout:\n%s\nstderr:\n%s", stdout, stderr)
+	}
+}
+
+func TestEnPassant(t *testing.T) {
+	pgn := createTempPGN(t, "enpassant.pgn", `[Event "Converted"]
+[SetUp "1"]
+[FEN "4k3/3p4/8/4P3/8/8/8/4K3 b - - 0 1"]
+[Result "*"]
+
+1... d5 2. exd5 Kf7 *
+
+[Event "Clean"]
+[Result "*"]
+
+1. e4 a6 2. e5 d5 3. exd6 *
+`)
+
+	stdout, stderr := runPgnExtract(t, "--en-passant", "report", pgn)
+	if countGames(stdout) != 2 || !strings.Contains(stderr, "ply 2: exd5 is written onto the square of the pawn it takes en passant (should be exd6).") {
+		t.Errorf("report should keep both games and log the problem:\nstdout:\n%s\nstderr:\n%s", stdout, stderr)
+	}
+
+	stdout, _ = runPgnExtract(t, "--en-passant", "reject", pgn)
+	if countGames(stdout) != 1 || !strings.Contains(stdout, `[Event "Clean"]`) {
+		t.Errorf("reject should keep only the clean game:\n%s", stdout)
+	}
+
+	stdout, stderr = runPgnExtract(t, "--en-passant", "repair", "--fencomments", pgn)
+	if countGames(stdout) != 2 || !strings.Contains(stdout, "exd6") || strings.Contains(stdout, "exd5") {
+		t.Errorf("repair should rewrite the capture:\n%s", stdout)
+	}
+	if !strings.Contains(stdout, "8/5k2/3P4/8/8/8/8/4K3") {
+		t.Errorf("repaired game should replay with the taken pawn removed:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "Game at line 1: 1 en passant problem(s) repaired.") || strings.Contains(stderr, "should be") {
+		t.Errorf("repair should log the repair count only:\n%s", stderr)
+	}
+}
+
+func TestTagEditing(t *testing.T) {
+	pgn := createTempPGN(t, "tags.pgn", `[Event "Club"]
+[White "A"]
+[Black "B"]
+[Result "1-0"]
+[WhiteElo "2100"]
+[Source "TWIC"]
+
+1. e4 e5 1-0
+`)
+
+	stdout, _ := runPgnExtract(t, "--addtag", "Annotator=me", "--addtag", "Event=Renamed Club",
+		"--deletetag", "WhiteElo", "--renametag", "Source=Origin", pgn)
+	for _, want := range []string{`[Annotator "me"]`, `[Event "Renamed Club"]`, `[Origin "TWIC"]`} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output should contain %s:\n%s", want, stdout)
+		}
+	}
+	if strings.Contains(stdout, "WhiteElo") || strings.Contains(stdout, "[Source ") {
+		t.Errorf("deleted and renamed tags should be gone:\n%s", stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-J", "--addtag", "Annotator=me", "--deletetag", "WhiteElo", pgn)
+	if !strings.Contains(stdout, `"Annotator": "me"`) || strings.Contains(stdout, "WhiteElo") {
+		t.Errorf("JSON output should carry the edits:\n%s", stdout)
+	}
+
+	_, stderr := runPgnExtract(t, "--addtag", "Annotator", pgn)
+	if !strings.Contains(stderr, "--addtag") {
+		t.Errorf("a malformed --addtag should be an error:\n%s", stderr)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	whiteSheet := createTempPGN(t, "white.pgn", `[Event "Match"]
+[Round "1"]
+[Board "2"]
+[White "A"]
+[Black "B"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 *
+`)
+	blackSheet := createTempPGN(t, "black.pgn", `[Event "Match"]
+[Round "1"]
+[Board "2"]
+[White "A"]
+[Black "B."]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 1-0
+`)
+
+	stdout, stderr := runPgnExtract(t, "--reconcile", whiteSheet, blackSheet)
+	if countGames(stdout) != 1 || !strings.Contains(stdout, "3. Bb5 1-0") {
+		t.Errorf("expected one merged game:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, `tag Black differs: "B" vs "B."`) {
+		t.Errorf("expected the Black tag conflict to be reported:\n%s", stderr)
+	}
+}
+
+func TestDiffSubcommand(t *testing.T) {
+	a := createTempPGN(t, "a.pgn", `[Event "One"]
+[White "A"]
+[Black "B"]
+[Date "2020.01.01"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 1-0
+
+[Event "Two"]
+[White "C"]
+[Black "D"]
+[Date "2020.01.02"]
+[Result "*"]
+
+1. d4 d5 *
+
+[Event "Three"]
+[White "E"]
+[Black "F"]
+[Result "*"]
+
+1. c4 *
+`)
+	b := createTempPGN(t, "b.pgn", `[Event "Two"]
+[White "C"]
+[Black "D"]
+[Date "2020.01.02"]
+[Result "*"]
+
+1. d4 d5 *
+
+[Event "One"]
+[White "A"]
+[Black "B"]
+[Date "2020.01.01"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nf6 1-0
+`)
+
+	var out, errOut strings.Builder
+	if code := runDiff([]string{a, b}, &out, &errOut); code != 1 {
+		t.Errorf("exit code = %d, want 1 (stderr %q)", code, errOut.String())
+	}
+	for _, want := range []string{
+		"a#1 <-> b#2 (matched by players)",
+		"  plies: 5 vs 4",
+		"  first difference at ply 4: Nc6 vs Nf6",
+		"a#3: only in first file",
+		"2 matched (1 identical), 1 only in first file, 0 only in second file.",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if code := runDiff([]string{"-json", a, a}, &out, &errOut); code != 0 {
+		t.Errorf("identical files: exit code = %d, want 0", code)
+	}
+	if !strings.Contains(out.String(), `"matchedBy": "moves"`) || !strings.Contains(out.String(), `"onlyInA": []`) {
+		t.Errorf("unexpected JSON:\n%s", out.String())
+	}
+}
+
+func TestPlyCountModes(t *testing.T) {
+	pgn := createTempPGN(t, "analysed.pgn", `[Event "T"]
+[White "A"]
+[Black "B"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 (2. Bc4 Nf6 3. d3 Bc5 4. Nf3 d6 5. O-O O-O) Nc6 *
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--plycount", "--longest-variation", pgn)
+	if !strings.Contains(stdout, `[PlyCount "4"]`) || !strings.Contains(stdout, `[LongestVariationPly "10"]`) {
+		t.Errorf("expected main line PlyCount and LongestVariationPly:\n%s", stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--plycount", "--plycount-mode", "total", pgn)
+	if !strings.Contains(stdout, `[PlyCount "12"]`) {
+		t.Errorf("expected PlyCount including variations:\n%s", stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--minply", "10", pgn)
+	if countGames(stdout) != 0 {
+		t.Errorf("main line bounds should reject the game:\n%s", stdout)
+	}
+	stdout, _ = runPgnExtract(t, "-s", "--minply", "10", "--ply-bounds-mode", "total", pgn)
+	if countGames(stdout) != 1 {
+		t.Errorf("total bounds should accept the game:\n%s", stdout)
+	}
+
+	_, stderr := runPgnExtract(t, "--plycount-mode", "longest", pgn)
+	if !strings.Contains(stderr, "--plycount-mode must be mainline or total") {
+		t.Errorf("expected mode error, got %q", stderr)
+	}
+}
+
+func TestPlyBoundsMatchMode(t *testing.T) {
+	// Both games reach the Ruy Lopez after ply 5; the second is much longer
+	pgn := createTempPGN(t, "ruy.pgn", `[Event "Short"]
+[White "A"]
+[Black "B"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 *
+
+[Event "Long"]
+[White "C"]
+[Black "D"]
+[Result "*"]
+
+1. Nf3 Nc6 2. e4 e5 3. Bb5 a6 4. Ba4 Nf6 5. O-O Be7 6. Re1 b5 7. Bb3 d6 *
+`)
+	ruy := "r1bqkbnr/pppp1ppp/2n5/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 3 3"
+
+	stdout, _ := runPgnExtract(t, "-s", "--fen", ruy, "--maxply", "6", pgn)
+	if countGames(stdout) != 1 || !strings.Contains(stdout, "Short") {
+		t.Errorf("whole-game bounds should keep only the short game:\n%s", stdout)
+	}
+	stdout, _ = runPgnExtract(t, "-s", "--fen", ruy, "--maxply", "6", "--ply-bounds-mode", "match", pgn)
+	if countGames(stdout) != 2 {
+		t.Errorf("match bounds should keep both games:\n%s", stdout)
+	}
+	stdout, _ = runPgnExtract(t, "-s", "--fen", ruy, "--maxmoves", "2", "--ply-bounds-mode", "match", pgn)
+	if countGames(stdout) != 0 {
+		t.Errorf("a match at move 3 should fail --maxmoves 2:\n%s", stdout)
+	}
+	stdout, _ = runPgnExtract(t, "-s", "--cql", "(piece B b5)", "--minply", "6", "--ply-bounds-mode", "match", pgn)
+	if countGames(stdout) != 1 || !strings.Contains(stdout, "Long") {
+		t.Errorf("only the long game has a bishop on b5 from ply 6:\n%s", stdout)
+	}
+
+	_, stderr := runPgnExtract(t, "--maxply", "6", "--ply-bounds-mode", "match", pgn)
+	if !strings.Contains(stderr, "requires a FEN position filter or --cql") {
+		t.Errorf("expected missing position filter error, got %q", stderr)
+	}
+}
+
+func TestStableOutput(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("\xEF\xBB\xBF")
+	for i := 1; i <= 20; i++ {
+		fmt.Fprintf(&sb, "[Event \"E%d\"]\r\n[Zeta \"z\"]\r\n[Alpha \"a\"]\r\n[Mid \"m\"]\r\n[Result \"*\"]\r\n\r\n1. e4 {first\r\nline} e5 *\r\n\r\n", i)
+	}
+	pgnFile := createTempPGN(t, "crlf.pgn", sb.String())
+
+	first, _ := runPgnExtract(t, "-s", "--stable-output", "--keep-header", "--workers", "4", pgnFile)
+	second, _ := runPgnExtract(t, "-s", "--stable-output", "--keep-header", "--workers", "4", pgnFile)
+	if first != second {
+		t.Error("--stable-output: two runs differ")
+	}
+	if strings.Contains(first, "\r") || strings.HasPrefix(first, "\xEF\xBB\xBF") {
+		t.Errorf("--stable-output: expected LF endings and no BOM:\n%q", first)
+	}
+	if !strings.Contains(first, "[Alpha \"a\"]\n[Mid \"m\"]\n[Zeta \"z\"]\n") {
+		t.Errorf("--stable-output: tags not in name order:\n%s", first)
+	}
+	if !strings.HasPrefix(first, "[Event \"E1\"]") || countGames(first) != 20 {
+		t.Errorf("--stable-output: games not in input order:\n%s", first)
+	}
+
+	stdout, _ := runPgnExtract(t, "-s", "--bom", "add", pgnFile)
+	if !strings.HasPrefix(stdout, "\xEF\xBB\xBF[Event \"E1\"]") {
+		t.Errorf("--bom add: expected a BOM before the first game:\n%q", stdout[:20])
+	}
+	stdout, _ = runPgnExtract(t, "-s", "--keep-header", "--bom", "strip", pgnFile)
+	if strings.HasPrefix(stdout, "\xEF\xBB\xBF") {
+		t.Error("--bom strip: output starts with a BOM")
+	}
+}
+
+func TestMoveNumbers(t *testing.T) {
+	pgn := createTempPGN(t, "numbers.pgn", `[Event "Gap"]
+[Result "*"]
+
+1. e4 e5 3. Nf3 Nc6 *
+
+[Event "Clean"]
+[Result "*"]
+
+1. d4 d5 2. c4 *
+`)
+
+	stdout, stderr := runPgnExtract(t, "--move-numbers", "report", pgn)
+	if countGames(stdout) != 2 || !strings.Contains(stderr, "move number jumps to 3 before Nf3, expected 2") {
+		t.Errorf("report: want both games and a jump diagnostic, got %d games, stderr %q", countGames(stdout), stderr)
+	}
+	if !strings.Contains(stdout, "1. e4 e5 2. Nf3 Nc6") {
+		t.Errorf("output should be numbered from the position:\n%s", stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--move-numbers", "reject", pgn)
+	if countGames(stdout) != 1 || !strings.Contains(stdout, `[Event "Clean"]`) {
+		t.Errorf("reject: want only the Clean game:\n%s", stdout)
+	}
+}
+
+func TestDupeByMetadata(t *testing.T) {
+	pgnFile := createTempPGN(t, "tournament.pgn", `[Event "Club Ch"]
+[Round "2"]
+[White "Smith, J"]
+[Black "Jones, K"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 1-0
+
+[Event "Club Ch"]
+[Round "02"]
+[White "Smith,J"]
+[Black "Jones, K"]
+[Result "1-0"]
+
+1. e4 {Annotated} e5 $1 2. Nf3 Nc6 (2... d6) 3. Bb5 a6 1-0
+
+[Event "Club Ch"]
+[Round "2"]
+[White "Brown"]
+[Black "Green"]
+[Result "*"]
+
+1. d4 d5 2. c4 e6 *
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "-D", pgnFile)
+	if got := countGames(stdout); got != 3 {
+		t.Errorf("-D by moves: got %d games, want 3", got)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "-D", "--dupe-by", "metadata", pgnFile)
+	if got := countGames(stdout); got != 2 {
+		t.Fatalf("-D by metadata: got %d games, want 2:\n%s", got, stdout)
+	}
+	if !strings.Contains(stdout, "{Annotated}") || !strings.Contains(stdout, "Brown") {
+		t.Errorf("-D by metadata should keep the annotated copy and the other pairing:\n%s", stdout)
+	}
+}
+
+func TestFENCommentsAtPlies(t *testing.T) {
+	pgnFile := createTempPGN(t, "short.pgn", `[Result "*"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 *
+`)
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"--fencomments"}, 6},
+		{[]string{"--fencomments-every", "2"}, 3},
+		{[]string{"--fencomments-plies", "1,5"}, 2},
+		{[]string{"--fencomments-every", "3", "--fencomments-plies", "1"}, 3},
+	}
+	for _, tt := range tests {
+		stdout, _ := runPgnExtract(t, append(append([]string{"-s"}, tt.args...), pgnFile)...)
+		if got := strings.Count(stdout, "{"); got != tt.want {
+			t.Errorf("%v: %d FEN comment(s), want %d:\n%s", tt.args, got, tt.want, stdout)
+		}
+	}
+
+	stdout, _ := runPgnExtract(t, "-s", "--fencomments-plies", "2", pgnFile)
+	if !strings.Contains(stdout, "e5 {rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq") {
+		t.Errorf("FEN comment should follow ply 2:\n%s", stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "-J", "--fencomments-every", "3", pgnFile)
+	if got := strings.Count(stdout, `"fen":`); got != 2 {
+		t.Errorf("JSON should carry 2 FENs, got %d:\n%s", got, stdout)
+	}
+}
+
+func TestFENCommentsAndChess960Positions(t *testing.T) {
+	pgnFile := createTempPGN(t, "chess960.pgn", `[Event "Freestyle"]
+[Variant "Chess960"]
+[SetUp "1"]
+[FEN "bqnbrkrn/pppppppp/8/8/8/8/PPPPPPPP/BQNBRKRN w GEge - 0 1"]
+[Result "*"]
+
+1. e4 e5 *
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--fencomments", pgnFile)
+	want := "{bqnbrkrn/pppppppp/8/8/4P3/8/PPPP1PPP/BQNBRKRN b GEge e3 0 1}"
+	if !strings.Contains(stdout, want) {
+		t.Errorf("--fencomments output missing %s:\n%s", want, stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "-W", "epd", pgnFile)
+	want = "bqnbrkrn/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/BQNBRKRN w GEge e6 hmvc 0; fmvn 2;"
+	if !strings.Contains(stdout, want) {
+		t.Errorf("-W epd output missing %s:\n%s", want, stdout)
+	}
+}
+
+func TestCountOnly(t *testing.T) {
+	stdout, _ := runPgnExtract(t, "-s", inputFile("fischer.pgn"))
+	want := countGames(stdout)
+
+	stdout, stderr := runPgnExtract(t, "--count", "--plycount", inputFile("fischer.pgn"))
+	if got := strings.TrimSpace(stdout); got != fmt.Sprint(want) {
+		t.Errorf("--count printed %q, want %d", got, want)
+	}
+	if stderr != "" {
+		t.Errorf("--count wrote to stderr: %q", stderr)
+	}
+
+	stdout, _ = runPgnExtract(t, "--count-per-file", "-Tw", "Fischer", inputFile("fischer.pgn"), inputFile("fools-mate.pgn"))
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("--count-per-file printed %d lines, want 3:\n%s", len(lines), stdout)
+	}
+	if !strings.HasSuffix(lines[0], "fischer.pgn: "+lines[2]) || !strings.HasSuffix(lines[1], "fools-mate.pgn: 0") {
+		t.Errorf("unexpected per-file counts:\n%s", stdout)
+	}
+
+	// Games merged from all inputs are still counted against their own file
+	sorted, _ := runPgnExtract(t, "--count-per-file", "--sort", "Date", "-Tw", "Fischer", inputFile("fischer.pgn"), inputFile("fools-mate.pgn"))
+	if sorted != stdout {
+		t.Errorf("--count-per-file --sort printed:\n%s\nwant:\n%s", sorted, stdout)
+	}
+}
+
+func TestUniqueBy(t *testing.T) {
+	pgnFile := createTempPGN(t, "rounds.pgn", `[Event "Open"]
+[Round "1"]
+[White "Alpha"]
+[Black "Beta"]
+[Result "1-0"]
+
+1. e4 e5 1-0
+
+[Event "Open"]
+[Round "1"]
+[White "Gamma"]
+[Black "Delta"]
+[Result "0-1"]
+
+1. d4 d5 0-1
+
+[Event "Open"]
+[Round "2"]
+[White "Alpha"]
+[Black "Gamma"]
+[Result "*"]
+
+1. c4 c5 *
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--unique-by", "White", pgnFile)
+	if got := countGames(stdout); got != 2 {
+		t.Errorf("--unique-by White: got %d games, want 2", got)
+	}
+	if strings.Contains(stdout, "1. c4") {
+		t.Errorf("--unique-by White kept Alpha's second game:\n%s", stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--unique-by", "Event, Round", pgnFile)
+	if got := countGames(stdout); got != 2 {
+		t.Errorf("--unique-by Event,Round: got %d games, want 2", got)
+	}
+	if strings.Contains(stdout, "1. d4") {
+		t.Errorf("--unique-by Event,Round kept a second round 1 game:\n%s", stdout)
+	}
+}
+
+func TestVerifyRoundtrip(t *testing.T) {
+	stdout, stderr := runPgnExtract(t, "-s", "--verify-roundtrip", inputFile("fischer.pgn"))
+	if stderr != "" {
+		t.Errorf("--verify-roundtrip reported problems for a clean file:\n%s", stderr)
+	}
+	if countGames(stdout) == 0 {
+		t.Error("--verify-roundtrip suppressed the output")
+	}
+
+	// The seven tag roster drops the FEN tag, losing the starting position
+	_, stderr = runPgnExtract(t, "-s", "-7", "--verify-roundtrip", inputFile("test-promotion-in.pgn"))
+	if !strings.Contains(stderr, "failed round-trip verification") {
+		t.Errorf("expected round-trip failures with -7, got stderr:\n%s", stderr)
+	}
+}
+
+func TestGameTimeout(t *testing.T) {
+	stdout, _ := runPgnExtract(t, "-s", inputFile("fischer.pgn"))
+	want := countGames(stdout)
+
+	stdout, stderr := runPgnExtract(t, "-s", "--game-timeout", "1m", inputFile("fischer.pgn"))
+	if got := countGames(stdout); got != want || strings.Contains(stderr, "abandoned") {
+		t.Errorf("--game-timeout 1m: got %d games, want %d; stderr:\n%s", got, want, stderr)
+	}
+}
+
+func TestEventDates(t *testing.T) {
+	pgnFile := createTempPGN(t, "eventdates.pgn", `[Event "Open A"]
+[Date "2019.07.05"]
+[White "a"]
+[Black "b"]
+[Result "1-0"]
+
+1. e4 1-0
+
+[Event "Open A"]
+[Date "2019.07.03"]
+[EventDate "????.??.??"]
+[White "c"]
+[Black "d"]
+[Result "1-0"]
+
+1. d4 1-0
+
+[Event "Open B"]
+[Date "2019.06.01"]
+[EventDate "2019.07.01"]
+[White "e"]
+[Black "f"]
+[Result "1-0"]
+
+1. c4 1-0
+
+[Event "Open C"]
+[Date "2020.03.01"]
+[EventDate "2019.07.01"]
+[White "g"]
+[Black "h"]
+[Result "1-0"]
+
+1. Nf3 1-0
+`)
+
+	stdout, stderr := runPgnExtract(t, "-s", "--event-date-check", "report", pgnFile)
+	if got := countGames(stdout); got != 4 {
+		t.Errorf("--event-date-check report: got %d games, want 4", got)
+	}
+	for _, want := range []string{"Date 2019.06.01 is before EventDate 2019.07.01", "is 244 days after EventDate"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("--event-date-check report: missing %q in:\n%s", want, stderr)
+		}
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--event-date-check", "reject", "--event-date-window", "300", pgnFile)
+	if got := countGames(stdout); got != 3 {
+		t.Errorf("--event-date-check reject with a 300 day window: got %d games, want 3", got)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--fill-event-date", pgnFile)
+	if got := strings.Count(stdout, `[EventDate "2019.07.03"]`); got != 2 {
+		t.Errorf("--fill-event-date: got %d games with EventDate 2019.07.03, want 2:\n%s", got, stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--event-date-range", "2019.07-2019.07", pgnFile)
+	if got := countGames(stdout); got != 2 {
+		t.Errorf("--event-date-range: got %d games, want 2", got)
+	}
+	stdout, _ = runPgnExtract(t, "-s", "--fill-event-date", "--event-date-range", "2019.07-2019.07", pgnFile)
+	if got := countGames(stdout); got != 4 {
+		t.Errorf("--event-date-range after --fill-event-date: got %d games, want 4", got)
+	}
+}
+
+func TestSortGames(t *testing.T) {
+	pgnFile := createTempPGN(t, "sort.pgn", `[Event "x"]
+[White "a"]
+[Black "b"]
+[Result "1-0"]
+[WhiteElo "950"]
+
+1. e4 1-0
+
+[Event "x"]
+[White "c"]
+[Black "d"]
+[Result "1-0"]
+[WhiteElo "2700"]
+
+1. d4 1-0
+
+[Event "x"]
+[White "e"]
+[Black "f"]
+[Result "1-0"]
+[WhiteElo "1800"]
+
+1. c4 1-0
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--sort", "-WhiteElo", pgnFile)
+	c, e, a := strings.Index(stdout, `[White "c"]`), strings.Index(stdout, `[White "e"]`), strings.Index(stdout, `[White "a"]`)
+	if c < 0 || !(c < e && e < a) {
+		t.Errorf("--sort -WhiteElo: want games in Elo order 2700, 1800, 950:\n%s", stdout)
+	}
+}
+
+func TestIndexSubcommand(t *testing.T) {
+	pgn := createTempPGN(t, "games.pgn", `[Event "One"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 *
+
+[Event "Two"]
+[Result "*"]
+
+1. d4 d5 *
+`)
+	idx := filepath.Join(filepath.Dir(pgn), "games.idx")
+
+	var out, errOut strings.Builder
+	if code := runIndex([]string{"build", pgn, "-o", idx}, &out, &errOut); code != 0 {
+		t.Fatalf("index build: exit code = %d (stderr %q)", code, errOut.String())
+	}
+
+	out.Reset()
+	fen := "rnbqkbnr/pppppppp/8/8/3P4/8/PPP1PPPP/RNBQKBNR b KQkq - 0 1"
+	if code := runIndex([]string{"query", "--fen", fen, idx}, &out, &errOut); code != 0 {
+		t.Fatalf("index query: exit code = %d (stderr %q)", code, errOut.String())
+	}
+	if got := countGames(out.String()); got != 1 || !strings.Contains(out.String(), `[Event "Two"]`) {
+		t.Errorf("index query after 1.d4: got %d games:\n%s", got, out.String())
+	}
+
+	out.Reset()
+	if code := runIndex([]string{"query", "-list", "-fen", "8/8/8/8/8/8/8/K1k5 w - - 0 1", idx}, &out, &errOut); code != 1 {
+		t.Errorf("index query of an absent position: exit code = %d, want 1", code)
+	}
+}
+
+func TestNoveltyAgainstReference(t *testing.T) {
+	ref := createTempPGN(t, "ref.pgn", `[Event "Ref"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 *
+`)
+	idx := filepath.Join(filepath.Dir(ref), "ref.idx")
+	var out, errOut strings.Builder
+	if code := runIndex([]string{"build", "-o", idx, ref}, &out, &errOut); code != 0 {
+		t.Fatalf("index build: exit code = %d (stderr %q)", code, errOut.String())
+	}
+
+	pgn := createTempPGN(t, "games.pgn", `[Event "Early"]
+[Result "*"]
+
+1. e4 c5 *
+
+[Event "Late"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bc4 *
+
+[Event "Known"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 *
+`)
+	stdout, _ := runPgnExtract(t, "-s", "--reference", idx, pgn)
+	for _, want := range []string{`[NoveltyPly "2"]`, `[NoveltyPly "5"]`} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("--reference: missing %s in:\n%s", want, stdout)
+		}
+	}
+	if got := strings.Count(stdout, "NoveltyPly"); got != 2 {
+		t.Errorf("--reference: got %d NoveltyPly tags, want 2", got)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--reference", idx, "--novelty-before", "3", pgn)
+	if got := countGames(stdout); got != 1 || !strings.Contains(stdout, `[Event "Early"]`) {
+		t.Errorf("--novelty-before 3: got %d games:\n%s", got, stdout)
+	}
+}
+
+func TestReportPlayers(t *testing.T) {
+	pgn := createTempPGN(t, "players.pgn", `[White "Anna"]
+[Black "Ben"]
+[WhiteElo "2000"]
+[BlackElo "1800"]
+[Result "1-0"]
+
+1. e4 e5 1-0
+
+[White "Ben"]
+[Black "Anna"]
+[WhiteElo "1800"]
+[BlackElo "2000"]
+[Result "1/2-1/2"]
+
+1. d4 d5 1/2-1/2
+
+[White "Ben"]
+[Black "Anna"]
+[Result "1-0"]
+
+1. e4 {[%eval 0.3]} e5 {[%eval 0.3]} 2. Bc4 {[%eval 0.2]} Nc6 {[%eval 0.2]}
+3. Qh5 {[%eval 0.0]} Nf6 {[%eval #1]} 4. Qxf7# 1-0
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--report", "players", "--report-format", "csv", pgn)
+	want := "player,games,white_games,white_wins,white_draws,white_losses,black_games,black_wins,black_draws,black_losses,score,average_opponent_elo,performance,lost_in_opening,lost_in_middlegame,lost_in_endgame\n" +
+		"Anna,3,1,1,0,0,2,0,1,1,1.5,1800,2000,1,0,0\n" +
+		"Ben,3,2,1,1,0,1,0,0,1,1.5,2000,1800,0,0,0\n"
+	if stdout != want {
+		t.Errorf("csv report:\n%s\nwant:\n%s", stdout, want)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--report", "players", pgn)
+	if countGames(stdout) != 0 || !strings.HasPrefix(stdout, "Player") {
+		t.Errorf("text report should replace the games:\n%s", stdout)
+	}
+}
+
+func TestExtractFrom(t *testing.T) {
+	page := createTempPGN(t, "article.html", `<html><body>
+<h1>Miniatures</h1>
+<pre>[Event "Fool's Mate"]
+[Result "0-1"]
+
+1. f3 e5 2. g4 Qh4# 0-1</pre>
+<p>And another:</p>
+<p>[Event "Scholar's Mate"]<br>[Result "1-0"]<br><br>1. e4 e5 2. Bc4 Nc6 3. Qh5 Nf6 4. Qxf7# 1-0</p>
+</body></html>
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--extract-from", "html", page)
+	if countGames(stdout) != 2 || !strings.Contains(stdout, "Fool's Mate") || !strings.Contains(stdout, "Qxf7") {
+		t.Errorf("expected both games from the page:\n%s", stdout)
+	}
+}
+
+func TestScidInput(t *testing.T) {
+	db := inputFile("scid-test.si4")
+	stdout, stderr := runPgnExtract(t, "-s", db)
+	if stderr != "" || countGames(stdout) != 2 {
+		t.Fatalf("expected the 2 undeleted games, stderr %q:\n%s", stderr, stdout)
+	}
+	for _, want := range []string{`[White "Ding, Liren"]`, `[ECO "C50"]`, "2. Nf3 $1 {the main line} ( 2. Bc4) Nc6", "2. a8=N 1-0"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output missing %q:\n%s", want, stdout)
+		}
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "-Tw", "Ding", "--parallel-files", db, inputFile("fischer.pgn"))
+	if countGames(stdout) != 1 || !strings.Contains(stdout, "Qh8+") {
+		t.Errorf("-Tw Ding: expected the Scid game only:\n%s", stdout)
+	}
+}
+
+func TestParallelFiles(t *testing.T) {
+	var files []string
+	for i := 1; i <= 8; i++ {
+		var sb strings.Builder
+		for j := 1; j <= 3; j++ {
+			fmt.Fprintf(&sb, "[Event \"F%d-%d\"]\n[Result \"*\"]\n\n1. e4 e5 2. Nf3 *\n\n", i, j)
+		}
+		files = append(files, createTempPGN(t, fmt.Sprintf("f%d.pgn", i), sb.String()))
+	}
+	for _, mode := range [][]string{{"-s"}, {"--count", "--count-per-file"}} {
+		want, _ := runPgnExtract(t, append(mode, files...)...)
+		args := append([]string{"--parallel-files", "--workers", "4"}, mode...)
+		got, stderr := runPgnExtract(t, append(append(args, "missing.pgn"), files...)...)
+		if got != want {
+			t.Errorf("%v: --parallel-files output differs:\n%s\nwant:\n%s", mode, got, want)
+		}
+		if !strings.Contains(stderr, "Error opening file missing.pgn") {
+			t.Errorf("%v: missing file not reported: %s", mode, stderr)
+		}
+	}
+
+	got, _ := runPgnExtract(t, "-s", "--parallel-files", "--stopafter", "4", files[0], files[1], files[2])
+	if countGames(got) != 4 || !strings.Contains(got, `[Event "F2-1"]`) {
+		t.Errorf("--stopafter 4 with --parallel-files:\n%s", got)
+	}
+}
+
+func TestAlsoFilter(t *testing.T) {
+	var sb strings.Builder
+	for i, g := range []struct{ white, result string }{
+		{"Carlsen", "1-0"}, {"Carlsen", "0-1"}, {"Caruana", "1-0"}, {"Ding", "1/2-1/2"},
+	} {
+		fmt.Fprintf(&sb, "[Event \"G%d\"]\n[White %q]\n[Black \"X\"]\n[Result %q]\n\n1. e4 e5 %s\n\n", i+1, g.white, g.result, g.result)
+	}
+	pgn := createTempPGN(t, "games.pgn", sb.String())
+	filterFile := createTempPGN(t, "also.args", "# White wins\n-Tr 1-0\n")
+	alsoOut := filepath.Join(t.TempDir(), "also.pgn")
+
+	for _, workers := range []string{"1", "4"} {
+		stdout, stderr := runPgnExtract(t, "--workers", workers, "-p", "Carlsen",
+			"--also-filter", filterFile, "--also-output", alsoOut, pgn)
+		if countGames(stdout) != 2 {
+			t.Errorf("workers %s: primary output has %d games, want 2", workers, countGames(stdout))
+		}
+		also, err := os.ReadFile(alsoOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if countGames(string(also)) != 2 || !strings.Contains(string(also), `[Event "G3"]`) {
+			t.Errorf("workers %s: --also-output:\n%s", workers, also)
+		}
+		if !strings.Contains(stderr, "2 game(s) matched the filters, 2 matched --also-filter, 1 matched both.") {
+			t.Errorf("workers %s: counts not reported: %s", workers, stderr)
+		}
+	}
+}
+
+func TestSkipSeen(t *testing.T) {
+	games := `[Event "Club"]
+[White "Alpha"]
+[Black "Beta"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 {threat} Nc6 1-0
+
+[Event "Club"]
+[White "Gamma"]
+[Black "Delta"]
+[Result "0-1"]
+
+1. d4 d5 0-1
+`
+	first := createTempPGN(t, "first.pgn", games)
+	second := createTempPGN(t, "second.pgn", games+`
+[Event "Club"]
+[White "Alpha"]
+[Black "Beta"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 {a different comment} Nc6 1-0
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", first, first)
+	if got := countGames(stdout); got != 4 {
+		t.Fatalf("without --skip-seen: got %d games, want 4", got)
+	}
+
+	stdout, stderr := runPgnExtract(t, "--skip-seen", first, second, first)
+	if got := countGames(stdout); got != 3 {
+		t.Errorf("--skip-seen: got %d games, want 3", got)
+	}
+	if !strings.Contains(stderr, "4 game(s) already output") {
+		t.Errorf("missing repeat warning, stderr:\n%s", stderr)
+	}
+	if !strings.Contains(stderr, "second.pgn: 2") || !strings.Contains(stderr, "first.pgn: 2") {
+		t.Errorf("missing per-file counts, stderr:\n%s", stderr)
+	}
+}
+
+func TestDumpAndLoadHashes(t *testing.T) {
+	monday := createTempPGN(t, "monday.pgn", `[Event "Monday"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 1-0
+
+[Event "Monday"]
+[Result "0-1"]
+
+1. d4 d5 0-1
+`)
+	tuesday := createTempPGN(t, "tuesday.pgn", `[Event "Tuesday"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 1-0
+
+[Event "Tuesday"]
+[Result "*"]
+
+1. c4 c5 *
+`)
+	hashFile := filepath.Join(t.TempDir(), "seen.hash")
+
+	stdout, stderr := runPgnExtract(t, "-s", "-D", "--dumphashes", hashFile, monday)
+	if got := countGames(stdout); got != 2 {
+		t.Fatalf("first run: got %d games, want 2; stderr:\n%s", got, stderr)
+	}
+
+	// Tuesday's first game repeats one of Monday's
+	stdout, stderr = runPgnExtract(t, "-s", "-D", "--loadhashes", hashFile, "--dumphashes", hashFile, tuesday)
+	if got := countGames(stdout); got != 1 || !strings.Contains(stdout, "1. c4") {
+		t.Errorf("second run: got %d games, want only 1. c4:\n%s\nstderr:\n%s", got, stdout, stderr)
+	}
+
+	// The saved table now holds all three games
+	stdout, _ = runPgnExtract(t, "-s", "-D", "--loadhashes", hashFile, monday, tuesday)
+	if got := countGames(stdout); got != 0 {
+		t.Errorf("third run: got %d games, want 0", got)
+	}
+
+	_, stderr = runPgnExtract(t, "-s", "-D", "--dupe-plies", "4", "--loadhashes", hashFile, tuesday)
+	if !strings.Contains(stderr, "Error loading hash file") {
+		t.Errorf("loading with another --dupe-plies: stderr = %q", stderr)
+	}
+}
+
+// buildFakeEngine builds the test UCI engine in internal/uci/testdata.
+func buildFakeEngine(t *testing.T) string {
+	t.Helper()
+	engine := filepath.Join(t.TempDir(), "fakeengine")
+	if runtime.GOOS == "windows" {
+		engine += ".exe"
+	}
+	build := exec.Command("go", "build", "-o", engine, "../../internal/uci/testdata/fakeengine") //nolint:gosec,noctx // G204: test builds the engine
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("building fake engine: %v\n%s", err, output)
+	}
+	return engine
+}
+
+func TestEngineEvaluations(t *testing.T) {
+	engine := buildFakeEngine(t)
+
+	pgnFile := createTempPGN(t, "evals.pgn", `[Event "Evals"]
+[Result "0-1"]
+
+1. f3 e5 {[%eval 1.50]} 2. g4 Qh4# 0-1
+
+[Event "Evals again"]
+[Result "*"]
+
+1. f3 *
+`)
+	stdout, stderr := runPgnExtract(t, "--engine", engine, "--engine-depth", "3", pgnFile)
+	// The fake engine gives the side to move 0.25 as White and 0.40 as Black
+	for _, want := range []string{"1. f3 {[%eval -0.40]} e5 {[%eval 1.50]} 2. g4 {[%eval -0.40]} Qh4+ 0-1", "1. f3 {[%eval -0.40]} *"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output missing %q:\n%s", want, stdout)
+		}
+	}
+	if !strings.Contains(stderr, "Engine evaluations: 1 hits, 2 misses") {
+		t.Errorf("missing cache statistics, stderr:\n%s", stderr)
+	}
+
+	_, stderr = runPgnExtract(t, "--engine", filepath.Join(t.TempDir(), "missing"), pgnFile)
+	if !strings.Contains(stderr, "Error:") {
+		t.Errorf("missing engine: stderr = %q", stderr)
+	}
+}
+
+func TestEnginePV(t *testing.T) {
+	engine := buildFakeEngine(t)
+	pgnFile := createTempPGN(t, "pv.pgn", `[Event "Lines"]
+[Result "*"]
+
+1. e4 c5 *
+
+[Event "Blunder"]
+[Result "*"]
+
+1. e4 {[%eval 0.3]} e5 {[%eval 0.35]} 2. Qh5 {[%eval -0.4]} Nc6 {[%eval -0.2]} *
+`)
+
+	// The fake engine's lines are e2e4 e7e5 and d2d4 d7d5 for White, e7e5
+	// and d7d5 for Black; a line starting with the move played is left out
+	stdout, _ := runPgnExtract(t, "-s", "--engine", engine, "--pv", "2", pgnFile)
+	want := "1. e4 {[%eval -0.40]} ( 1. d4 {[%eval 0.10]} d5) c5 {[%eval 0.25]} ( 1... e5\n{[%eval -0.40]}) ( 1... d5 {[%eval -0.30]}) *"
+	if !strings.Contains(stdout, want) {
+		t.Errorf("--pv 2: output missing %q:\n%s", want, stdout)
+	}
+
+	// With --blunders only the blunders get lines, and an illegal move,
+	// here e2e4 with the pawn gone, ends a line
+	stdout, _ = runPgnExtract(t, "-s", "--engine", engine, "--pv", "2", "--blunders", "50", pgnFile)
+	want = "1. e4 {[%eval 0.3]} e5 {[%eval 0.35]} 2. Qh5 {[%eval -0.4]} ( 2. d4\n{[%eval 0.10]} d5) Nc6 {[%eval -0.2]} *"
+	if !strings.Contains(stdout, want) || strings.Contains(stdout, "( 1. d4") {
+		t.Errorf("--pv 2 --blunders 50: want lines only before Qh5 and c5 (%q):\n%s", want, stdout)
+	}
+
+	// Games the engine evaluates for --blunders are processed one at a
+	// time, so each is annotated once however many workers there are
+	game := "[Event \"Blunder\"]\n[Result \"*\"]\n\n1. e4 {[%eval 0.3]} e5 {[%eval 0.35]} 2. Qh5 {[%eval -0.4]} Nc6 {[%eval -0.2]} *\n\n"
+	manyFile := createTempPGN(t, "many.pgn", strings.Repeat(game, 4))
+	stdout, _ = runPgnExtract(t, "-s", "--workers", "4", "--engine", engine, "--pv", "2", "--blunders", "50", manyFile)
+	if got := strings.Count(stdout, "( 2. d4"); got != 4 {
+		t.Errorf("--workers 4 --pv 2 --blunders 50: %d lines before Qh5, want 4:\n%s", got, stdout)
+	}
+
+	_, stderr := runPgnExtract(t, "--pv", "2", pgnFile)
+	if !strings.Contains(stderr, "--pv needs --engine") {
+		t.Errorf("--pv without --engine: stderr = %q", stderr)
+	}
+}
+
+func TestBlunders(t *testing.T) {
+	pgnFile := createTempPGN(t, "blunders.pgn", `[Event "Blunder"]
+[Result "*"]
+
+1. e4 {[%eval 0.3]} e5 {[%eval 0.35]} 2. Qh5 {[%eval -0.4]} Nc6 {[%eval -0.2]} 3. Bc4 {[%eval -0.1]} g6 {[%eval 3.2]} *
+
+[Event "Steady"]
+[Result "*"]
+
+1. d4 {[%eval 0.2]} d5 {[%eval 0.25]} 2. c4 {[%eval 0.2]} *
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--blunders", "200", pgnFile)
+	if got := countGames(stdout); got != 1 || !strings.Contains(stdout, "Blunder") {
+		t.Errorf("--blunders 200: got %d games, want only Blunder:\n%s", got, stdout)
+	}
+
+	// --blunders is a filter like any other: -n inverts it.
+	stdout, _ = runPgnExtract(t, "-s", "-n", "--blunders", "200", pgnFile)
+	if got := countGames(stdout); got != 1 || !strings.Contains(stdout, "Steady") {
+		t.Errorf("-n --blunders 200: got %d games, want only Steady:\n%s", got, stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--blunders", "100", "--blunder-nags", pgnFile)
+	if !strings.Contains(stdout, "2. Qh5 $2") || !strings.Contains(stdout, "g6 $4") {
+		t.Errorf("--blunder-nags output missing $2 on Qh5 or $4 on g6:\n%s", stdout)
+	}
+
+	_, stderr := runPgnExtract(t, "--blunder-nags", pgnFile)
+	if !strings.Contains(stderr, "--blunder-nags needs --blunders") {
+		t.Errorf("--blunder-nags alone: stderr = %q", stderr)
+	}
+}
+
+func TestTagsOnlyAndMovesOnly(t *testing.T) {
+	stdout, stderr := runPgnExtract(t, "-s", "--tags-only", "--verify-roundtrip", inputFile("fischer.pgn"))
+	if stderr != "" || countGames(stdout) == 0 || strings.Contains(stdout, "1. ") {
+		t.Errorf("--tags-only: stderr %q, output:\n%s", stderr, stdout)
+	}
+
+	stdout, stderr = runPgnExtract(t, "-s", "--moves-only", "--verify-roundtrip", inputFile("fischer.pgn"))
+	if stderr != "" || strings.Contains(stdout, "[") || !strings.HasPrefix(stdout, "1. ") {
+		t.Errorf("--moves-only: stderr %q, output:\n%s", stderr, stdout)
+	}
+
+	_, stderr = runPgnExtract(t, "--tags-only", "--moves-only", inputFile("fischer.pgn"))
+	if !strings.Contains(stderr, "cannot be combined") {
+		t.Errorf("--tags-only --moves-only: stderr = %q", stderr)
+	}
+}
+
+func TestNAGStyle(t *testing.T) {
+	pgn := createTempPGN(t, "nags.pgn", `[Event "Glyphs"]
+[Result "*"]
+
+1. e4! e5 ± 2. Nf3 $14 *
+`)
+
+	stdout, _ := runPgnExtract(t, "-s", "--moves-only", "--nags", "numeric", pgn)
+	if want := "1. e4 $1 e5 $16 2. Nf3 $14 *"; !strings.Contains(stdout, want) {
+		t.Errorf("--nags numeric: want %q in:\n%s", want, stdout)
+	}
+
+	stdout, _ = runPgnExtract(t, "-s", "--moves-only", "--nags", "symbolic", pgn)
+	if want := "1. e4! e5 {±} 2. Nf3 {⩲} *"; !strings.Contains(stdout, want) {
+		t.Errorf("--nags symbolic: want %q in:\n%s", want, stdout)
+	}
+
+	_, stderr := runPgnExtract(t, "--nags", "glyphs", pgn)
+	if !strings.Contains(stderr, "--nags must be numeric or symbolic") {
+		t.Errorf("expected an error for an unknown style, got %q", stderr)
+	}
+}
@@ -2,15 +2,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
-	"sync/atomic"
+	"time"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
 	"github.com/lgbarn/pgn-extract-go/internal/config"
 	"github.com/lgbarn/pgn-extract-go/internal/engine"
 	"github.com/lgbarn/pgn-extract-go/internal/hashing"
+	"github.com/lgbarn/pgn-extract-go/internal/matching"
 	"github.com/lgbarn/pgn-extract-go/internal/processing"
 )
 
@@ -20,6 +22,16 @@ var (
 	skipMatchingSet map[int]bool
 	parsedPlyRange  [2]int // [min, max]
 	parsedMoveRange [2]int // [min, max]
+	extractRange    [2]int // plies to extract, [first, last], 0 = open
+	extractMoveNums [2]int // move numbers to extract, [first, last], 0 = open
+	timeClassSet    map[matching.TimeClass]bool
+	terminationSet  map[matching.Termination]bool
+	eventDateRange  *dateRange           // nil unless --event-date-range is set
+	sortKeys        []processing.SortKey // nil unless --sort is set
+	pieceValues     = matching.StandardPieceValues
+	timeTrouble     time.Duration // 0 unless --timetrouble is set
+	evalRange       *evalBounds   // nil unless --evalrange is set
+	materialMoves   [2]int        // --zwindow move numbers, [first, last], 0 = open
 )
 
 // initSelectionSets parses the selection flags into sets for O(1) lookup.
@@ -36,6 +48,12 @@ func initSelectionSets() {
 	if *moveRange != "" {
 		parsedMoveRange = parseRange(*moveRange)
 	}
+	if *extractPlies != "" {
+		extractRange = parseRange(*extractPlies)
+	}
+	if *extractMoves != "" {
+		extractMoveNums = parseRange(*extractMoves)
+	}
 }
 
 // parseIntSet parses a comma-separated list of integers into a set.
@@ -61,6 +79,31 @@ func parseRange(s string) [2]int {
 	return [2]int{min, max}
 }
 
+// parseMoveWindow parses a range of move numbers such as "20-40", where
+// either end may be left out to leave it open, e.g. "30-".
+func parseMoveWindow(s string) ([2]int, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return [2]int{}, fmt.Errorf("%q is not of the form first-last", s)
+	}
+	var window [2]int
+	for i, end := range []string{from, to} {
+		end = strings.TrimSpace(end)
+		if end == "" {
+			continue
+		}
+		n, err := strconv.Atoi(end)
+		if err != nil || n < 1 {
+			return [2]int{}, fmt.Errorf("invalid move number %q", end)
+		}
+		window[i] = n
+	}
+	if window[0] != 0 && window[1] != 0 && window[0] > window[1] {
+		return [2]int{}, fmt.Errorf("move %d is after move %d", window[0], window[1])
+	}
+	return window, nil
+}
+
 // FilterResult holds the result of applying all filters to a game.
 type FilterResult struct {
 	Matched      bool
@@ -69,53 +112,123 @@ type FilterResult struct {
 	PlyCount     int
 	SkipOutput   bool   // True if validation failed (don't output anywhere)
 	ErrorMessage string // For logging validation errors
+	AlsoMatched  bool   // True if the --also-filter set matched
+	Abandoned    bool   // True if the filters were stopped by --game-timeout
 }
 
+// abandoned is the result of a game whose filters were stopped.
+var abandoned = FilterResult{Matched: false, SkipOutput: true, Abandoned: true}
+
 // applyFilters applies all game filters and returns the result.
 // This is the shared filter logic used by both sequential and parallel processing.
-func applyFilters(game *chess.Game, ctx *ProcessingContext) FilterResult {
+// Once stop is done the remaining filters are skipped and the game is
+// reported as abandoned.
+func applyFilters(stop context.Context, game *chess.Game, ctx *ProcessingContext) FilterResult {
 	result := FilterResult{Matched: true}
 
 	if *fixableMode {
 		fixGame(game)
 	}
 
+	if *normalizeOnline {
+		normalizeOnlineTags(game)
+	}
+
 	if failed := applyValidation(game); failed != nil {
 		return *failed
 	}
 
+	if failed := checkStrictSAN(game, ctx.cfg); failed != nil {
+		return *failed
+	}
+
+	if failed := checkCastling(game, ctx); failed != nil {
+		return *failed
+	}
+
+	if failed := checkEnPassant(game, ctx.cfg); failed != nil {
+		return *failed
+	}
+
+	if failed := checkMoveNumbers(game, ctx.cfg); failed != nil {
+		return *failed
+	}
+
+	if failed := checkEventDate(game, ctx.cfg); failed != nil {
+		return *failed
+	}
+
+	if failed := checkReplay(stop, game, ctx); failed != nil {
+		return *failed
+	}
+	if stop.Err() != nil {
+		return abandoned
+	}
+
 	if ctx.ecoClassifier != nil {
 		ctx.ecoClassifier.AddECOTags(game)
 	}
 
+	if failed := markNovelty(game, ctx); failed != nil {
+		return *failed
+	}
+
 	// Check for same-setup duplicates (deleteSameSetup flag)
 	if ctx.setupDetector != nil && ctx.setupDetector.CheckAndAdd(game) {
 		return FilterResult{Matched: false}
 	}
 
+	if ctx.alsoFilter != nil {
+		result.AlsoMatched = ctx.alsoFilter.set.matches(stop, game)
+	}
+
 	// Apply tag and pattern filters
-	result.Matched = applyTagFilters(game, ctx, result.Matched)
+	result.Matched = applyTagFilters(stop, game, ctx, result.Matched)
 	result.Matched = applyPatternFilters(game, ctx, result.Matched)
+	if stop.Err() != nil {
+		return abandoned
+	}
 
-	// Calculate and check ply/move bounds
+	// Calculate and check ply/move bounds. In match mode the position
+	// filters have applied them to the ply of the match instead.
 	result.PlyCount = processing.CountPlies(game)
-	result.Matched = checkPlyBounds(result.PlyCount, result.Matched)
-	result.Matched = checkMoveBounds(result.PlyCount, result.Matched)
+	if *plyBoundsMode != "match" {
+		boundsPlies := result.PlyCount
+		if *plyBoundsMode == "total" {
+			boundsPlies = processing.CountAllMoves(game)
+		}
+		result.Matched = checkPlyBounds(boundsPlies, result.Matched)
+		result.Matched = checkMoveCount(processing.MovesSpanned(game, boundsPlies), result.Matched)
+	}
 
 	// Analyze game if needed for feature filters
 	if needsGameAnalysis(ctx) {
 		result.Board, result.GameInfo = analyzeGame(game)
+		if stop.Err() != nil {
+			return abandoned
+		}
 	}
 
 	// Apply game feature filters
 	result.Matched = applyFeatureFilters(&result, game, result.Matched)
+	result.Matched = applyEvalFilters(game, ctx, result.Matched)
+	if stop.Err() != nil {
+		return abandoned
+	}
 
 	if *negateMatch {
 		result.Matched = !result.Matched
 	}
 
-	if result.Matched {
+	// Counting needs no annotations
+	if result.Matched && !*countOnly {
 		addAnnotations(game, &result, ctx.cfg)
+		if *materialComments > 0 {
+			processing.AddMaterialComments(game, *materialComments, &pieceValues)
+		}
+		if ctx.commentInjector != nil {
+			ctx.commentInjector.inject(game, result.Board)
+		}
 	}
 
 	return result
@@ -148,17 +261,211 @@ func applyValidation(game *chess.Game) *FilterResult {
 	return nil
 }
 
+// checkStrictSAN checks piece move disambiguation for --strict-san. Every
+// problem is logged; in reject mode the game is also skipped.
+func checkStrictSAN(game *chess.Game, cfg *config.Config) *FilterResult {
+	if *strictSAN == "" {
+		return nil
+	}
+	problems := engine.CheckSANDisambiguation(game)
+	if len(problems) == 0 {
+		return nil
+	}
+	if *strictSAN == "report" {
+		for _, problem := range problems {
+			fmt.Fprintf(cfg.LogFile, "Game at line %d: %s.\n", game.StartLine, problem)
+		}
+		return nil
+	}
+	return &FilterResult{
+		Matched:      false,
+		SkipOutput:   true,
+		ErrorMessage: fmt.Sprintf("game at line %d: %s", game.StartLine, problems[0]),
+	}
+}
+
+// checkCastling checks castling legality for --legality. Illegal castling
+// skips the game at the strict level and is logged at the castling-lenient
+// level. Either way the game is counted for the summary.
+func checkCastling(game *chess.Game, ctx *ProcessingContext) *FilterResult {
+	if *legality == "off" {
+		return nil
+	}
+	problems := engine.CheckCastling(game)
+	if len(problems) == 0 {
+		return nil
+	}
+	ctx.run.illegalCastling.Add(1)
+	if *legality == "castling-lenient" {
+		for _, problem := range problems {
+			fmt.Fprintf(ctx.cfg.LogFile, "Game at line %d: %s.\n", game.StartLine, problem)
+		}
+		return nil
+	}
+	return &FilterResult{
+		Matched:      false,
+		SkipOutput:   true,
+		ErrorMessage: fmt.Sprintf("game at line %d: %s", game.StartLine, problems[0]),
+	}
+}
+
+// checkEnPassant checks en passant captures and the FEN en passant square
+// for --en-passant. Problems are logged in report mode and skip the game in
+// reject mode; repair mode corrects those a correction can be derived for
+// from the position and logs the rest.
+func checkEnPassant(game *chess.Game, cfg *config.Config) *FilterResult {
+	if *enPassant == "" {
+		return nil
+	}
+	if *enPassant == "repair" {
+		repaired := 0
+		for _, problem := range engine.RepairEnPassant(game) {
+			if problem.Repair == "" {
+				fmt.Fprintf(cfg.LogFile, "Game at line %d: %s.\n", game.StartLine, problem)
+			} else {
+				repaired++
+			}
+		}
+		if repaired > 0 && cfg.Verbosity > 0 {
+			fmt.Fprintf(cfg.LogFile, "Game at line %d: %d en passant problem(s) repaired.\n", game.StartLine, repaired)
+		}
+		return nil
+	}
+	problems := engine.CheckEnPassant(game)
+	if len(problems) == 0 {
+		return nil
+	}
+	if *enPassant == "reject" {
+		return &FilterResult{
+			Matched:      false,
+			SkipOutput:   true,
+			ErrorMessage: fmt.Sprintf("game at line %d: %s", game.StartLine, problems[0]),
+		}
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(cfg.LogFile, "Game at line %d: %s.\n", game.StartLine, problem)
+	}
+	return nil
+}
+
+// checkMoveNumbers checks the move numbers written in the source for
+// --move-numbers. Problems are logged in report mode and skip the game in
+// reject mode. Output numbering always follows the position, so a game
+// that is kept is written with correct numbers either way.
+func checkMoveNumbers(game *chess.Game, cfg *config.Config) *FilterResult {
+	if *moveNumbers == "" {
+		return nil
+	}
+	problems := processing.CheckMoveNumbers(game)
+	if len(problems) == 0 {
+		return nil
+	}
+	switch *moveNumbers {
+	case "reject":
+		return &FilterResult{
+			Matched:      false,
+			SkipOutput:   true,
+			ErrorMessage: fmt.Sprintf("game at line %d: %s", game.StartLine, problems[0]),
+		}
+	default:
+		for _, problem := range problems {
+			fmt.Fprintf(cfg.LogFile, "Game at line %d: %s.\n", game.StartLine, problem)
+		}
+	}
+	return nil
+}
+
+// checkEventDate checks a game's Date against its EventDate for
+// --event-date-check: it must not be earlier, nor more than
+// --event-date-window days later. Games with partial dates pass.
+func checkEventDate(game *chess.Game, cfg *config.Config) *FilterResult {
+	if *eventDateCheck == "" {
+		return nil
+	}
+	problem := eventDateProblem(game, *eventDateWindow)
+	if problem == "" {
+		return nil
+	}
+	if *eventDateCheck == "reject" {
+		return &FilterResult{
+			Matched:      false,
+			SkipOutput:   true,
+			ErrorMessage: fmt.Sprintf("game at line %d: %s", game.StartLine, problem),
+		}
+	}
+	fmt.Fprintf(cfg.LogFile, "Game at line %d: %s.\n", game.StartLine, problem)
+	return nil
+}
+
+// markNovelty tags a game with the ply of its first position missing from
+// the --reference index, as NoveltyPly, replacing any such tag in the input.
+func markNovelty(game *chess.Game, ctx *ProcessingContext) *FilterResult {
+	if ctx.reference == nil {
+		return nil
+	}
+	ply, err := ctx.reference.Novelty(game)
+	if err != nil {
+		return &FilterResult{
+			Matched:      false,
+			SkipOutput:   true,
+			ErrorMessage: fmt.Sprintf("game at line %d: reading reference index: %v", game.StartLine, err),
+		}
+	}
+	if ply > 0 {
+		game.SetTag("NoveltyPly", strconv.Itoa(ply))
+	} else {
+		delete(game.Tags, "NoveltyPly")
+	}
+	return nil
+}
+
+// checkReplay skips games whose moves cannot be replayed when any enabled
+// filter inspects board positions, so none of them matches a partial game.
+func checkReplay(stop context.Context, game *chess.Game, ctx *ProcessingContext) *FilterResult {
+	if !needsPositionReplay(ctx) {
+		return nil
+	}
+	if _, _, err := engine.ReplayGameContext(stop, game); err != nil {
+		if stop.Err() != nil {
+			return &abandoned
+		}
+		return &FilterResult{
+			Matched:      false,
+			SkipOutput:   true,
+			ErrorMessage: err.Error(),
+		}
+	}
+	return nil
+}
+
+// needsPositionReplay returns true if any enabled filter depends on the
+// positions reached in the game.
+func needsPositionReplay(ctx *ProcessingContext) bool {
+	return (ctx.gameFilter != nil && ctx.gameFilter.PositionMatcher.PatternCount() > 0) ||
+		ctx.cqlNode != nil || ctx.variationMatcher != nil || ctx.materialMatcher != nil ||
+		*pieceCount > 0 || *checkmateFilter || *stalemateFilter ||
+		*fiftyMoveFilter || *repetitionFilter || *underpromotionFilter ||
+		*seventyFiveMoveFilter || *fiveFoldRepFilter ||
+		*insufficientFilter || *materialOddsFilter
+}
+
 // applyTagFilters applies tag-based filters (game filter, CQL, variation, material).
-func applyTagFilters(game *chess.Game, ctx *ProcessingContext, matched bool) bool {
+func applyTagFilters(stop context.Context, game *chess.Game, ctx *ProcessingContext, matched bool) bool {
 	if !matched {
 		return false
 	}
 
-	if ctx.gameFilter != nil && ctx.gameFilter.HasCriteria() && !ctx.gameFilter.MatchGame(game) {
-		return false
+	if ctx.gameFilter != nil && ctx.gameFilter.HasCriteria() {
+		matched, position := ctx.gameFilter.MatchGameDetail(game)
+		if !matched {
+			return false
+		}
+		if ctx.cfg.Annotation.AddMatchLabelTag && position != nil && position.Label != "" {
+			game.SetTag("MatchLabel", position.Label)
+		}
 	}
 
-	if ctx.cqlNode != nil && !matchesCQL(game, ctx.cqlNode) {
+	if ctx.cqlNode != nil && !matchesCQL(stop, game, ctx.cqlNode) {
 		return false
 	}
 
@@ -210,12 +517,17 @@ func checkPlyBounds(plyCount int, matched bool) bool {
 	return true
 }
 
-// checkMoveBounds checks if the game meets move count requirements.
+// checkMoveBounds checks if the game meets move count requirements,
+// counting the moves of plyCount plies played from White's move.
 func checkMoveBounds(plyCount int, matched bool) bool {
+	return checkMoveCount((plyCount+1)/2, matched)
+}
+
+// checkMoveCount checks a number of moves against the move bounds.
+func checkMoveCount(moveCount int, matched bool) bool {
 	if !matched {
 		return false
 	}
-	moveCount := (plyCount + 1) / 2
 
 	// Exact move match takes precedence
 	if *exactMove > 0 && moveCount != *exactMove {
@@ -243,6 +555,22 @@ func checkMoveBounds(plyCount int, matched bool) bool {
 	return true
 }
 
+// matchPlyFilter returns the test FEN and CQL matching apply to the ply of
+// a matched position: the ply and move bounds in --ply-bounds-mode match,
+// and none otherwise.
+func matchPlyFilter() func(ply int) bool {
+	if *plyBoundsMode != "match" {
+		return nil
+	}
+	return acceptMatchPly
+}
+
+// acceptMatchPly reports whether a position reached after ply plies is
+// within the ply and move bounds.
+func acceptMatchPly(ply int) bool {
+	return checkPlyBounds(ply, true) && checkMoveBounds(ply, true)
+}
+
 // needsGameAnalysis returns true if game analysis is required for any enabled filter.
 func needsGameAnalysis(ctx *ProcessingContext) bool {
 	cfg := ctx.cfg
@@ -251,7 +579,7 @@ func needsGameAnalysis(ctx *ProcessingContext) bool {
 		*higherRatedWinner || *lowerRatedWinner ||
 		*seventyFiveMoveFilter || *fiveFoldRepFilter ||
 		*insufficientFilter || *materialOddsFilter ||
-		cfg.Annotation.AddFENComments || cfg.Annotation.AddHashComments || cfg.Annotation.AddHashTag
+		(!*countOnly && (cfg.Annotation.AddFENComments || cfg.Annotation.AddHashComments || cfg.Annotation.AddHashTag))
 }
 
 // applyFeatureFilters applies game feature filters (checkmate, stalemate, etc).
@@ -283,6 +611,30 @@ func applyFeatureFilters(result *FilterResult, game *chess.Game, matched bool) b
 		return false
 	}
 
+	if !checkPlayerTypes(game) {
+		return false
+	}
+
+	if len(timeClassSet) > 0 && !timeClassSet[matching.ClassifyTimeControl(game.GetTag("TimeControl"))] {
+		return false
+	}
+
+	if len(terminationSet) > 0 && !terminationSet[matching.DeriveTermination(game)] {
+		return false
+	}
+
+	if eventDateRange != nil && !eventDateRange.contains(game.GetTag("EventDate")) {
+		return false
+	}
+
+	if timeTrouble > 0 && !hasTimeTrouble(game, timeTrouble) {
+		return false
+	}
+
+	if *noveltyBefore > 0 && !noveltyBeforeMove(game, *noveltyBefore) {
+		return false
+	}
+
 	// Setup tag filtering
 	if *noSetupTags && game.HasTag("SetUp") {
 		return false
@@ -295,6 +647,26 @@ func applyFeatureFilters(result *FilterResult, game *chess.Game, matched bool) b
 	return true
 }
 
+// evalFiltersSet reports whether a filter on [%eval] comments is set.
+func evalFiltersSet() bool {
+	return *blunderThreshold > 0 || evalRange != nil
+}
+
+// applyEvalFilters applies the filters on the [%eval] comments of the
+// main line, which --engine adds first if one is running.
+func applyEvalFilters(game *chess.Game, ctx *ProcessingContext, matched bool) bool {
+	if !matched {
+		return false
+	}
+	if *blunderThreshold > 0 && !hasBlunder(game, ctx) {
+		return false
+	}
+	if evalRange != nil && !inEvalRange(game, ctx) {
+		return false
+	}
+	return true
+}
+
 // applyEndingFilters checks board-based ending conditions.
 func applyEndingFilters(board *chess.Board) bool {
 	if *checkmateFilter && !engine.IsCheckmate(board) {
@@ -344,7 +716,7 @@ func applyGameInfoFilters(info *GameAnalysis) bool {
 
 // checkPieceCount checks if the game ever reaches a position with exactly N pieces.
 func checkPieceCount(game *chess.Game, targetCount int) bool {
-	board := engine.MustBoardFromFEN(engine.InitialFEN)
+	board := engine.NewInitialBoard()
 
 	// Check initial position
 	if countPieces(board) == targetCount {
@@ -378,6 +750,20 @@ func countPieces(board *chess.Board) int {
 	return count
 }
 
+// checkPlayerTypes applies the self-play and engine/human filters.
+func checkPlayerTypes(game *chess.Game) bool {
+	if *noSelfPlay && matching.IsSelfPlay(game) {
+		return false
+	}
+	if *enginesOnly && !matching.IsEngineGame(game) {
+		return false
+	}
+	if *humansOnly && !matching.IsHumanGame(game) {
+		return false
+	}
+	return true
+}
+
 // checkRatingWinner checks if the game result matches the rating-based winner filter.
 func checkRatingWinner(game *chess.Game) bool {
 	whiteElo := parseElo(game.Tags["WhiteElo"])
@@ -411,13 +797,39 @@ func checkRatingWinner(game *chess.Game) bool {
 // addAnnotations adds requested annotations to a matched game.
 func addAnnotations(game *chess.Game, result *FilterResult, cfg *config.Config) {
 	if cfg.Annotation.AddPlyCount {
-		game.Tags["PlyCount"] = strconv.Itoa(result.PlyCount)
+		plies := result.PlyCount
+		if cfg.Annotation.PlyCountVariations {
+			plies = processing.CountAllMoves(game)
+		}
+		game.Tags["PlyCount"] = strconv.Itoa(plies)
+	}
+
+	if cfg.Annotation.AddLongestVariation {
+		game.Tags["LongestVariationPly"] = strconv.Itoa(processing.LongestLinePly(game))
 	}
 
 	if cfg.Annotation.AddHashTag && result.Board != nil {
 		hash := hashing.GenerateZobristHash(result.Board)
 		game.Tags["HashCode"] = fmt.Sprintf("%016x", hash)
 	}
+
+	if cfg.Annotation.AddTimeClassTag {
+		if class := matching.ClassifyTimeControl(game.GetTag("TimeControl")); class != matching.TimeClassUnknown {
+			game.Tags["TimeClass"] = string(class)
+		}
+	}
+
+	if cfg.Annotation.AddTerminationTag && !game.HasTag("Termination") {
+		game.Tags["Termination"] = string(matching.DeriveTermination(game))
+	}
+
+	if cfg.Annotation.AddPhoneticTags {
+		for _, side := range []string{"White", "Black"} {
+			if code := matching.Soundex(game.GetTag(side)); code != "" {
+				game.Tags[side+"Soundex"] = code
+			}
+		}
+	}
 }
 
 // parseElo parses an Elo rating string to int
@@ -432,25 +844,53 @@ func parseElo(s string) int {
 	return elo
 }
 
-// Global state for stopAfter (atomic for thread safety)
-var matchedCount int64
-
-// gamePositionCounter tracks the position of games being processed (1-indexed)
-var gamePositionCounter int64
+// skipLeadingGames drops the first --per-file-skip games of an input file.
+func skipLeadingGames(games []*chess.Game) []*chess.Game {
+	if *perFileSkip <= 0 {
+		return games
+	}
+	if *perFileSkip >= len(games) {
+		return nil
+	}
+	return games[*perFileSkip:]
+}
 
-// IncrementMatchedCount atomically increments the matched game counter
-func IncrementMatchedCount() int64 {
-	return atomic.AddInt64(&matchedCount, 1)
+// interleaveGames merges the games of several input files round-robin,
+// taking one game from each file in turn until all are exhausted.
+func interleaveGames(batches [][]*chess.Game) []*chess.Game {
+	var games []*chess.Game
+	for i := 0; ; i++ {
+		added := false
+		for _, batch := range batches {
+			if i < len(batch) {
+				games = append(games, batch[i])
+				added = true
+			}
+		}
+		if !added {
+			return games
+		}
+	}
 }
 
-// GetMatchedCount returns the current matched game count
-func GetMatchedCount() int64 {
-	return atomic.LoadInt64(&matchedCount)
+// noveltyBeforeMove reports whether a game's NoveltyPly falls before the
+// given move number.
+func noveltyBeforeMove(game *chess.Game, move int) bool {
+	ply, err := strconv.Atoi(game.GetTag("NoveltyPly"))
+	return err == nil && int(processing.MoveNumberOfPly(game, ply)) < move
 }
 
-// IncrementGamePosition atomically increments the game position counter and returns the new position
-func IncrementGamePosition() int64 {
-	return atomic.AddInt64(&gamePositionCounter, 1)
+// reconcileGames merges paired copies of team match games for --reconcile,
+// logging every discrepancy between the copies.
+func reconcileGames(games []*chess.Game, cfg *config.Config) []*chess.Game {
+	merged, discrepancies := processing.ReconcilePairs(games)
+	for _, d := range discrepancies {
+		fmt.Fprintf(cfg.LogFile, "Reconcile %s.\n", d)
+	}
+	if cfg.Verbosity > 0 && len(merged) < len(games) {
+		fmt.Fprintf(cfg.LogFile, "%d duplicate scoresheet(s) merged.\n", len(games)-len(merged))
+	}
+	return merged
 }
 
 // checkGamePosition checks if the game at the given position should be processed.
@@ -468,12 +908,21 @@ func checkGamePosition(position int) bool {
 }
 
 // truncateMoves applies move truncation options to the game.
-// This modifies the game's move list based on dropPly, startPly, plyLimit.
+// This modifies the game's move list based on dropPly, startPly, plyLimit
+// and the extraction ranges. A fragment that no longer starts at the
+// beginning of the game gets FEN and SetUp tags for its first position,
+// and one cut short of the game's end has its result reset to "*".
 func truncateMoves(game *chess.Game) {
-	if *dropPly <= 0 && *startPly <= 0 && *plyLimit <= 0 && *dropBefore == "" {
+	if *dropPly <= 0 && *startPly <= 0 && *plyLimit <= 0 && *dropBefore == "" &&
+		extractRange == [2]int{} && extractMoveNums == [2]int{} {
 		return
 	}
 
+	extract := extractRange
+	if extractMoveNums != [2]int{} {
+		extract = extractMovePlies(game, extractMoveNums)
+	}
+
 	// Handle dropBefore - find comment matching the string
 	dropBeforePly := 0
 	if *dropBefore != "" {
@@ -491,17 +940,89 @@ func truncateMoves(game *chess.Game) {
 	if dropBeforePly > effectiveStart {
 		effectiveStart = dropBeforePly
 	}
+	if extract[0]-1 > effectiveStart {
+		effectiveStart = extract[0] - 1
+	}
 
 	// Calculate effective limit
 	effectiveLimit := 0
 	if *plyLimit > 0 {
 		effectiveLimit = *plyLimit
 	}
+	if extract[1] != 0 {
+		span := extract[1] - effectiveStart
+		if span <= 0 {
+			span = -1
+		}
+		if effectiveLimit == 0 || span < effectiveLimit {
+			effectiveLimit = span
+		}
+	}
 
 	// Apply truncation
-	if effectiveStart > 0 || effectiveLimit > 0 {
+	if effectiveStart > 0 || effectiveLimit != 0 {
+		if effectiveStart > 0 {
+			setFragmentStart(game, effectiveStart)
+		}
+		total := countPlies(game.Moves)
 		game.Moves = truncateMoveList(game.Moves, effectiveStart, effectiveLimit)
+		if effectiveLimit != 0 && countPlies(game.Moves) < total-effectiveStart {
+			setFragmentEnd(game)
+		}
+	}
+}
+
+// extractMovePlies converts a range of move numbers to the plies of a
+// game, numbered from the game's starting position. A range ending before
+// the game starts gives a negative last ply.
+func extractMovePlies(game *chess.Game, moves [2]int) [2]int {
+	var plies [2]int
+	if moves[0] > 0 {
+		plies[0] = max(processing.PlyOfMove(game, moves[0], true), 1)
+	}
+	if moves[1] > 0 {
+		plies[1] = processing.PlyOfMove(game, moves[1], false)
+		if plies[1] < 1 {
+			plies[1] = -1
+		}
+	}
+	return plies
+}
+
+// setFragmentStart records the position before ply start+1 in the game's
+// FEN and SetUp tags so that the truncated game remains legal PGN.
+func setFragmentStart(game *chess.Game, start int) {
+	board := engine.NewBoardForGame(game)
+	opts := engine.FENOptionsForGame(game, board)
+	move := game.Moves
+	for i := 0; i < start && move != nil; i++ {
+		if !engine.ApplyMove(board, move) {
+			return
+		}
+		move = move.Next
+	}
+	if move == nil {
+		return
+	}
+	game.SetTag("FEN", engine.BoardToFEN(board, opts))
+	game.SetTag("SetUp", "1")
+}
+
+// setFragmentEnd marks a game whose final moves were cut as unfinished.
+func setFragmentEnd(game *chess.Game) {
+	if last := game.LastMove(); last != nil {
+		last.TerminatingResult = ""
+	}
+	game.SetTag("Result", "*")
+}
+
+// countPlies counts the moves in a move list.
+func countPlies(moves *chess.Move) int {
+	n := 0
+	for move := moves; move != nil; move = move.Next {
+		n++
 	}
+	return n
 }
 
 // findCommentPly finds the ply number where a comment contains the given string.
@@ -520,9 +1041,9 @@ func findCommentPly(game *chess.Game, pattern string) int {
 }
 
 // truncateMoveList truncates the move list, skipping the first 'skip' plies
-// and limiting to 'limit' plies (0 = no limit).
+// and limiting to 'limit' plies (0 = no limit, negative = none at all).
 func truncateMoveList(moves *chess.Move, skip, limit int) *chess.Move {
-	if moves == nil {
+	if moves == nil || limit < 0 {
 		return nil
 	}
 
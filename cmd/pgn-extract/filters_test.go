@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"sync/atomic"
 	"testing"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
@@ -100,23 +100,16 @@ func TestCleanString(t *testing.T) {
 	}
 }
 
-func TestMatchedCountOperations(t *testing.T) {
-	// Reset to zero state first (since tests run in order)
-	// We can't reset matchedCount directly, so we test incremental behavior
-
-	initialCount := GetMatchedCount()
-
-	IncrementMatchedCount()
-	afterFirst := GetMatchedCount()
-	if afterFirst != initialCount+1 {
-		t.Errorf("after first increment: GetMatchedCount() = %d; want %d", afterFirst, initialCount+1)
+func TestRunStatsMatchedCount(t *testing.T) {
+	var rs runStats
+	rs.addMatched("a.pgn")
+	rs.addMatched("b.pgn")
+	rs.addMatched("a.pgn")
+	if got := rs.matched.Load(); got != 3 {
+		t.Errorf("matched = %d; want 3", got)
 	}
-
-	IncrementMatchedCount()
-	IncrementMatchedCount()
-	afterThree := GetMatchedCount()
-	if afterThree != initialCount+3 {
-		t.Errorf("after three increments: GetMatchedCount() = %d; want %d", afterThree, initialCount+3)
+	if rs.fileMatched["a.pgn"] != 2 || rs.fileMatched["b.pgn"] != 1 {
+		t.Errorf("fileMatched = %v; want a.pgn:2 b.pgn:1", rs.fileMatched)
 	}
 }
 
@@ -968,7 +961,7 @@ func TestApplyTagFilters(t *testing.T) {
 	t.Run("already false", func(t *testing.T) {
 		game := chess.NewGame()
 		ctx := &ProcessingContext{cfg: config.NewConfig()}
-		if applyTagFilters(game, ctx, false) {
+		if applyTagFilters(context.Background(), game, ctx, false) {
 			t.Error("expected false when matched=false")
 		}
 	})
@@ -976,7 +969,7 @@ func TestApplyTagFilters(t *testing.T) {
 	t.Run("nil game filter passes", func(t *testing.T) {
 		game := chess.NewGame()
 		ctx := &ProcessingContext{cfg: config.NewConfig()}
-		if !applyTagFilters(game, ctx, true) {
+		if !applyTagFilters(context.Background(), game, ctx, true) {
 			t.Error("expected true with nil gameFilter")
 		}
 	})
@@ -985,7 +978,7 @@ func TestApplyTagFilters(t *testing.T) {
 		game := chess.NewGame()
 		gf := matching.NewGameFilter()
 		ctx := &ProcessingContext{cfg: config.NewConfig(), gameFilter: gf}
-		if !applyTagFilters(game, ctx, true) {
+		if !applyTagFilters(context.Background(), game, ctx, true) {
 			t.Error("expected true: gameFilter has no criteria")
 		}
 	})
@@ -996,7 +989,7 @@ func TestApplyTagFilters(t *testing.T) {
 		gf := matching.NewGameFilter()
 		gf.AddTagCriterion("White", "Kasparov", matching.OpEqual)
 		ctx := &ProcessingContext{cfg: config.NewConfig(), gameFilter: gf}
-		if applyTagFilters(game, ctx, true) {
+		if applyTagFilters(context.Background(), game, ctx, true) {
 			t.Error("expected false: White doesn't match Kasparov")
 		}
 	})
@@ -1007,7 +1000,7 @@ func TestApplyTagFilters(t *testing.T) {
 		gf := matching.NewGameFilter()
 		gf.AddTagCriterion("White", "Carlsen", matching.OpEqual)
 		ctx := &ProcessingContext{cfg: config.NewConfig(), gameFilter: gf}
-		if !applyTagFilters(game, ctx, true) {
+		if !applyTagFilters(context.Background(), game, ctx, true) {
 			t.Error("expected true: White matches Carlsen")
 		}
 	})
@@ -1413,17 +1406,12 @@ func TestNeedsGameAnalysis(t *testing.T) {
 	})
 }
 
-func TestIncrementGamePosition(t *testing.T) {
-	oldCounter := atomic.LoadInt64(&gamePositionCounter)
-	defer atomic.StoreInt64(&gamePositionCounter, oldCounter)
-
-	atomic.StoreInt64(&gamePositionCounter, 0)
-	pos1 := IncrementGamePosition()
-	if pos1 != 1 {
-		t.Errorf("first IncrementGamePosition() = %d; want 1", pos1)
+func TestRunStatsGamePosition(t *testing.T) {
+	var rs runStats
+	if pos := rs.nextGamePosition(); pos != 1 {
+		t.Errorf("first nextGamePosition() = %d; want 1", pos)
 	}
-	pos2 := IncrementGamePosition()
-	if pos2 != 2 {
-		t.Errorf("second IncrementGamePosition() = %d; want 2", pos2)
+	if pos := rs.nextGamePosition(); pos != 2 {
+		t.Errorf("second nextGamePosition() = %d; want 2", pos)
 	}
 }
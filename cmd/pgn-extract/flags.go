@@ -3,24 +3,54 @@ package main
 
 import (
 	"flag"
+	"strings"
 
 	"github.com/lgbarn/pgn-extract-go/internal/config"
 )
 
+// stringListFlag collects the values of a flag that may be repeated.
+type stringListFlag []string
+
+// String implements flag.Value.
+func (s *stringListFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set implements flag.Value.
+func (s *stringListFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// newStringListFlag defines a repeatable string flag.
+func newStringListFlag(name, usage string) *stringListFlag {
+	var values stringListFlag
+	flag.Var(&values, name, usage)
+	return &values
+}
+
 var (
 	// Output options
 	outputFile   = flag.String("o", "", "Output file (default: stdout)")
 	appendOutput = flag.Bool("a", false, "Append to output file instead of overwrite")
+	asyncOutput  = flag.Bool("async-output", false, "Write the -o file from a separate goroutine through a bounded buffer")
+	fsyncEvery   = flag.Int("fsync-every", 0, "Sync the -o file to disk every N games written, using --async-output (0 = never)")
 	sevenTagOnly = flag.Bool("7", false, "Output only the seven tag roster")
 	noTags       = flag.Bool("notags", false, "Don't output any tags")
+	tagsOnly     = flag.Bool("tags-only", false, "Output only the tags of each game, as a tag catalog")
+	movesOnly    = flag.Bool("moves-only", false, "Output only the movetext of each game, without tags")
 	lineLength   = flag.Int("w", 80, "Maximum line length")
-	outputFormat = flag.String("W", "", "Output format: san, lalg, halg, elalg, uci, epd, fen")
+	outputFormat = flag.String("W", "", "Output format: san, lalg, halg, elalg, uci, san+uci, epd, fen")
 	jsonOutput   = flag.Bool("J", false, "Output in JSON format")
-	splitGames   = flag.Int("#", 0, "Split output into files of N games each")
+	epdBestMove  = flag.Bool("epd-bm", false, "With -W epd, give the move played from each position as its bm operation, in SAN")
+
+	sanUCISeparator = flag.String("san-uci-separator", "/", "Separator between SAN and UCI moves for -W san+uci; empty writes the UCI move as a {uci: ...} comment")
+	splitGames      = flag.Int("#", 0, "Split output into files of N games each")
 
 	// Content options
 	noComments   = flag.Bool("C", false, "Don't output comments")
 	noNAGs       = flag.Bool("N", false, "Don't output NAGs")
+	nagStyle     = flag.String("nags", "", "Write NAGs as numeric $-codes or symbolic glyphs (default: as read)")
 	noVariations = flag.Bool("V", false, "Don't output variations")
 	noResults    = flag.Bool("noresults", false, "Don't output results")
 	noClocks     = flag.Bool("noclocks", false, "Strip clock annotations from comments")
@@ -30,7 +60,15 @@ var (
 	duplicateFile      = flag.String("d", "", "Output duplicates to this file")
 	outputDupsOnly     = flag.Bool("U", false, "Output only duplicates (suppress unique games)")
 	checkFile          = flag.String("c", "", "Check file for duplicate detection")
+	loadHashes         = flag.String("loadhashes", "", "Load duplicate hashes saved by --dumphashes, as a faster -c")
+	dumpHashes         = flag.String("dumphashes", "", "Save the duplicate hashes to this file after the run, for --loadhashes")
 	duplicateCapacity  = flag.Int("duplicate-capacity", 0, "Maximum duplicate hash table entries (0 = unlimited)")
+	mergeDuplicateTags = flag.Bool("merge-duplicate-tags", false, "Merge missing tags from suppressed duplicates into the kept game; holds every unique game in memory")
+	dupeKeep           = flag.String("dupe-keep", "first", "Duplicate copy to keep: first, most-tags, longest, best-annotated, source-order; any but first holds every unique game in memory")
+	dupeSourceOrder    = flag.String("dupe-source-order", "", "Input files in order of preference for --dupe-keep source-order (comma-separated)")
+	dupeBy             = flag.String("dupe-by", "moves", "What makes games duplicates for -D/-d/-U: moves, or metadata (same players, Event and Round)")
+	dupePlies          = flag.Int("dupe-plies", 0, "Compare only the position after the first N plies for -D/-d/-U/-c, so copies truncated at different lengths match")
+	firstNPlies        = flag.Int("first-n-plies", 0, "Relay dedupe: games with the same event, round and players whose first N plies agree are duplicates; the longest is kept")
 
 	// ECO classification
 	ecoFile = flag.String("e", "", "ECO classification file (PGN format)")
@@ -43,9 +81,20 @@ var (
 	ecoFilter    = flag.String("Te", "", "Filter by ECO code prefix")
 	resultFilter = flag.String("Tr", "", "Filter by result (1-0, 0-1, 1/2-1/2)")
 	fenFilter    = flag.String("Tf", "", "Filter by FEN position")
+	fenEntries   = newStringListFlag("fen", "Position to match, repeatable: [exact:|pattern:]FEN[;label[;move]]")
+	fenFile      = flag.String("fen-file", "", "File of positions to match, one [exact:|pattern:]FEN[;label] per line")
+	nextMove     = flag.String("next-move", "", "Require this move (SAN) to be played from a matched position")
+	addLabelTag  = flag.Bool("addlabeltag", false, "Add MatchLabel tag naming the position entry that matched")
 	negateMatch  = flag.Bool("n", false, "Output games that DON'T match criteria")
 	useSoundex   = flag.Bool("S", false, "Use Soundex for player name matching")
 	tagSubstring = flag.Bool("tagsubstr", false, "Match tag values anywhere (substring)")
+	matchCase    = flag.Bool("match-case", false, "Compare tag values, including player names, case-sensitively")
+	matchExact   = flag.Bool("match-exact", false, "Match the whole name with -p, -Tw and -Tb rather than any part of it")
+	matchAnchor  = flag.Bool("match-anchored", false, "Match player names and --tagsubstr values only at the start of the tag value")
+
+	// Second filter set, matched in the same pass
+	alsoFilterFile = flag.String("also-filter", "", "File of filter flags (-t, -p, -Tw, -Tb, -Te, -Tr, -Tf, --cql, --cql-file, -v, -x, -z, -y, -n) for a second filter set")
+	alsoOutput     = flag.String("also-output", "", "Output file for the games matching the --also-filter set")
 
 	// Ply/move bounds
 	minPly    = flag.Int("minply", 0, "Minimum ply count")
@@ -58,12 +107,30 @@ var (
 	moveRange = flag.String("moverange", "", "Move range to match (e.g., '10-20')")
 	stopAfter = flag.Int("stopafter", 0, "Stop after matching N games")
 
+	// Move number checking
+	moveNumbers = flag.String("move-numbers", "", "Check move numbers written in the source: report or reject")
+
+	// Scoresheet reconciliation
+	reconcile = flag.Bool("reconcile", false, "Merge pairs of copies of a game sharing Event, Round, Board and players, reporting differences")
+
+	// Per-file sampling
+	perFileLimit = flag.Int("per-file-limit", 0, "Match at most N games from each input file")
+	perFileSkip  = flag.Int("per-file-skip", 0, "Skip the first N games of each input file")
+	interleave   = flag.Bool("interleave", false, "Output games from multiple input files round-robin")
+
+	// Output order
+	sortSpec = flag.String("sort", "", "Sort games by these tags, - for descending (e.g. Date,-WhiteElo); Elo, PlyCount, Round and dates sort numerically")
+
 	// Move truncation and range
 	dropPly    = flag.Int("dropply", 0, "Remove first N plies from output")
 	plyLimit   = flag.Int("plylimit", 0, "Limit output to first N plies")
 	startPly   = flag.Int("startply", 0, "Begin output at ply N (skip earlier moves)")
 	dropBefore = flag.String("dropbefore", "", "Drop moves before comment matching this string")
 
+	// Fragment extraction
+	extractPlies = flag.String("extract-plies", "", "Output only plies N-M of each game, starting from a FEN (e.g., '21-40')")
+	extractMoves = flag.String("extract-moves", "", "Output only moves N-M of each game, starting from a FEN (e.g., '10-20')")
+
 	// Game selection controls
 	selectOnly   = flag.String("selectonly", "", "Output only games at these positions (comma-separated, 1-indexed)")
 	skipMatching = flag.String("skipmatching", "", "Skip games at these positions (comma-separated, 1-indexed)")
@@ -88,6 +155,15 @@ var (
 	// Material odds detection
 	materialOddsFilter = flag.Bool("odds", false, "Games played at material odds (unequal starting material)")
 
+	// Player type filtering
+	noSelfPlay  = flag.Bool("no-selfplay", false, "Exclude games where White and Black are the same player")
+	enginesOnly = flag.Bool("engines-only", false, "Only games between two engines")
+	humansOnly  = flag.Bool("humans-only", false, "Only games between two humans")
+
+	// Time control filtering
+	timeClassFilter   = flag.String("time-class", "", "Only games in these time classes (e.g., 'blitz,rapid')")
+	terminationFilter = flag.String("termination", "", "Only games ending in these ways: normal, time-forfeit, abandoned, adjudication, rules-infraction, unterminated")
+
 	// Setup tag filtering
 	noSetupTags   = flag.Bool("nosetuptags", false, "Exclude games with SetUp tag")
 	onlySetupTags = flag.Bool("onlysetuptags", false, "Only match games with SetUp tag")
@@ -98,6 +174,7 @@ var (
 	// CQL filter
 	cqlQuery = flag.String("cql", "", "CQL query to filter games by position patterns")
 	cqlFile  = flag.String("cql-file", "", "File containing CQL query")
+	cqlOut   = flag.String("cql-output", "games", "Output for CQL matches: games, positions (EPD) or both")
 
 	// Variation matching
 	variationFile = flag.String("v", "", "File with move sequences to match")
@@ -106,6 +183,8 @@ var (
 	// Material matching
 	materialMatch      = flag.String("z", "", "Material balance to match (e.g., 'QR:qrr')")
 	materialMatchExact = flag.String("y", "", "Exact material balance to match")
+	materialWindow     = flag.String("zwindow", "", "Match -z/-y material only after moves in this range of move numbers (e.g. 20-40)")
+	materialPlies      = flag.Int("zplies", 0, "Require the -z/-y material to persist for at least N consecutive plies")
 	pieceCount         = flag.Int("piececount", 0, "Match games reaching exactly N pieces on board")
 
 	// Variation matching options
@@ -114,39 +193,132 @@ var (
 	// Annotations
 	addPlyCount     = flag.Bool("plycount", false, "Add PlyCount tag")
 	addFENComments  = flag.Bool("fencomments", false, "Add FEN comment after each move")
+	fenCommentPlies = flag.String("fencomments-plies", "", "Add FEN comments only after these plies (e.g. 10,20,30)")
+	fenCommentEvery = flag.Int("fencomments-every", 0, "Add FEN comments only after every N plies")
 	addHashComments = flag.Bool("hashcomments", false, "Add position hash after each move")
 	addHashcodeTag  = flag.Bool("addhashcode", false, "Add HashCode tag")
+	addTimeClass    = flag.Bool("add-timeclass", false, "Add TimeClass tag derived from TimeControl")
+	addTermination  = flag.Bool("add-termination", false, "Add a Termination tag, where missing, derived from the result, final position and comments")
+	addPhoneticTags = flag.Bool("add-phonetic-tags", false, "Add WhiteSoundex and BlackSoundex tags with the codes -S matches names by")
+
+	// Engine evaluation
+	enginePath  = flag.String("engine", "", "Add [%eval] comments after each move from this UCI engine (e.g. stockfish)")
+	engineDepth = flag.Int("engine-depth", 12, "Search depth for --engine (0 = limited by --engine-time only)")
+	engineTime  = flag.Int("engine-time", 0, "Search time per position for --engine, in milliseconds (0 = limited by --engine-depth only)")
+	enginePV    = flag.Int("pv", 0, "With --engine, add its N best lines as variations before each move, or with --blunders before each blunder")
+
+	// Evaluation swings
+	blunderThreshold = flag.Int("blunders", 0, "Only games with a move losing more than N centipawns by its [%eval] comments or --engine")
+	blunderNAGs      = flag.Bool("blunder-nags", false, "With --blunders, mark moves losing more than N centipawns $4 and more than N/2 $2")
+
+	// Clock and evaluation commands
+	timeTroubleSpec = flag.String("timetrouble", "", "Only games where a [%clk] comment shows a player with less than this time left, e.g. 30 (seconds) or 1:00")
+	evalRangeSpec   = flag.String("evalrange", "", "Only games with a main-line [%eval] in this range of pawns, e.g. -0.5:0.5, 3: or :-3 (with --engine evaluations)")
+
+	// Ply counting
+	plyCountMode     = flag.String("plycount-mode", "mainline", "Plies counted by --plycount: mainline or total (including variations)")
+	longestVariation = flag.Bool("longest-variation", false, "Add LongestVariationPly tag: the ply at which the longest line ends")
+	plyBoundsMode    = flag.String("ply-bounds-mode", "mainline", "Plies checked by the ply/move bounds: mainline, total (including variations) or match (the ply at which a FEN or CQL position matches)")
+
+	// Material checkpoints
+	materialComments = flag.Int("material-comments", 0, "Add a material balance comment every N moves")
+	pieceValuesSpec  = flag.String("piece-values", "", "Piece values in pawns for material balances, CQL material and --export-features, e.g. 'N=3.2,B=3.3' (default P=1,N=3,B=3,R=5,Q=9)")
+
+	// Dataset export
+	exportFeatures = flag.String("export-features", "", "Write tags and engineered features of each output game to this CSV file")
+	posIndex       = flag.String("posindex", "", "Write a position index of every main-line position of each output game to this file")
+	posIndexFormat = flag.String("posindex-format", "binary", "Format of the --posindex file: binary or csv")
 
 	// Tag management
 	fixResultTags = flag.Bool("fixresulttags", false, "Fix inconsistent result tags")
 	fixTagStrings = flag.Bool("fixtagstrings", false, "Fix malformed tag strings")
 
+	// Tag editing, applied to every game written
+	addTags    = newStringListFlag("addtag", "Set a tag in every game written, repeatable: Name=Value")
+	deleteTags = newStringListFlag("deletetag", "Delete a tag from every game written, repeatable")
+	renameTags = newStringListFlag("renametag", "Rename a tag in every game written, repeatable: Old=New")
+
 	// Validation
 	strictMode   = flag.Bool("strict", false, "Only output games that parse without errors")
 	validateMode = flag.Bool("validate", false, "Verify all moves are legal")
 	fixableMode  = flag.Bool("fixable", false, "Attempt to fix common issues")
 
+	// Illegal move report
+	firstIllegalPly = flag.String("first-illegal-ply", "", "Write the first illegal move of each game to this CSV file: file, game, ply, move, reason")
+
+	// SAN strictness
+	strictSAN = flag.String("strict-san", "", "Check piece move disambiguation against SAN: reject or report")
+
+	// Castling legality
+	legality = flag.String("legality", "off", "Castling legality checks: strict (reject illegal castling), castling-lenient (warn) or off")
+
+	// En passant checking
+	enPassant = flag.String("en-passant", "", "Check en passant captures and FEN en passant squares: report, reject or repair")
+
+	// Online platform tag normalization
+	normalizeOnline = flag.Bool("normalize-online", false, "Normalize Lichess/Chess.com tags (UTCDate, Termination, Variant, ratings)")
+
 	// Logging
 	logFile    = flag.String("l", "", "Write diagnostics to log file")
 	appendLog  = flag.String("L", "", "Append diagnostics to log file")
 	reportOnly = flag.Bool("r", false, "Report errors without extracting games")
 
+	// Counting
+	countOnly    = flag.Bool("count", false, "Print only the number of matching games")
+	countPerFile = flag.Bool("count-per-file", false, "With --count, also print the number of matching games in each input file")
+
+	// Statistics reports, written instead of the games
+	reportMode   = flag.String("report", "", "Write a statistics report instead of the matching games: players")
+	reportFormat = flag.String("report-format", "text", "Format of the --report output: text, csv or json")
+
+	// Terminal diagnostics
+	noColor      = flag.Bool("no-color", false, "Never colour diagnostics, even on a terminal")
+	dumbTerminal = flag.Bool("dumb-terminal", false, "Plain diagnostics with no colour or progress line")
+
+	// Profiling
+	debugStats = flag.Bool("debug-stats", false, "Print parser counters and stage timings to stderr")
+
 	// Other options
 	quiet   = flag.Bool("s", false, "Silent mode (no game count)")
 	help    = flag.Bool("h", false, "Show help")
 	version = flag.Bool("version", false, "Show version")
 
+	// Capability listing for wrapper tools
+	capabilitiesFlag = flag.Bool("capabilities", false, "Print the supported flags, output formats, CQL filters and variants as JSON")
+
 	// Performance options
-	workers = flag.Int("workers", 0, "Number of worker threads (0 = auto-detect based on CPU cores)")
+	workers       = flag.Int("workers", 0, "Number of worker threads (0 = auto-detect based on CPU cores)")
+	gameTimeout   = flag.Duration("game-timeout", 0, "Abandon a game whose processing takes longer than this, e.g. 5s (0 = no limit)")
+	parallelFiles = flag.Bool("parallel-files", false, "Read and parse input files concurrently, up to -workers at a time; games are still output in argument order")
 
 	// File input options
 	fileListFile = flag.String("f", "", "File containing list of PGN files to process (one per line)")
+	extractFrom  = flag.String("extract-from", "", "Read inputs as web pages and pull out the PGN in them: html or markdown")
+	recurse      = flag.Bool("recurse", false, "Also read the files in subdirectories of directory arguments")
+	inputGlob    = flag.String("input-glob", "*.pgn", "Pattern for the names of files read from directory arguments")
 	// Note: -A flag is handled manually before flag.Parse() in loadArgsFromFileIfSpecified
 	_ = flag.String("A", "", "File containing command-line arguments (one per line, # for comments)")
 
 	// ECO-based output splitting
 	ecoSplit      = flag.Int("E", 0, "Split output by ECO code: 1=A-E, 2=A0-E9, 3=A00-E99")
-	ecoMaxHandles = flag.Int("eco-max-handles", 128, "Maximum open file handles for ECO splitting")
+	ecoMaxHandles = flag.Int("eco-max-handles", 128, "Maximum open file handles for ECO, date and player splitting")
+	splitDir      = flag.String("split-dir", "", "Write -E files to this directory, one subdirectory per ECO class, with an index.csv of code, file and game count")
+
+	// Date-based output splitting
+	splitDate = flag.String("splitdate", "", "Split output by the Date tag: year (<base>_1972.pgn) or month (<base>_1972-07.pgn)")
+
+	// Player-based output splitting
+	splitPlayer = flag.Bool("splitplayer", false, "Split output into a file per player surname (<base>_carlsen.pgn), writing each game to both players' files")
+
+	// Perspective normalisation
+	playerAsWhite = flag.String("player-as-white", "", "Colour-flip games where this player had Black so they appear as White")
+
+	// Comment injection
+	injectComments = flag.String("inject-comments", "", "CSV file of game,ply,comment rows to merge into matching games")
+
+	// Result-based output splitting
+	splitByResult = flag.Bool("split-by-result", false, "Split output into white wins, black wins, draws and unfinished games")
+	resultFiles   = flag.String("result-files", "", "Output files for --split-by-result: white,black,draw,unfinished (default <base>_<result>.pgn)")
 
 	// Split output filename pattern
 	splitPattern = flag.String("splitpattern", "%s_%d.pgn", "Filename pattern for split output (use %s for base, %d for number)")
@@ -157,8 +329,48 @@ var (
 	// Nested comments
 	nestedComments = flag.Bool("nestedcomments", false, "Allow nested comments in PGN parsing")
 
+	// Per-game size limits
+	maxGameBytes    = flag.Int64("max-game-bytes", 0, "Skip games larger than N bytes of input (0 = no limit)")
+	maxCommentBytes = flag.Int("max-comment-bytes", 0, "Skip games containing a comment longer than N bytes (0 = no limit)")
+
+	// Input header preservation
+	keepHeader = flag.Bool("keep-header", false, "Copy the BOM and leading %-lines/comments of the first input to the output")
+
+	// Reproducible output
+	stableOutput = flag.Bool("stable-output", false, "Byte-identical output across runs and platforms: sequential processing, sorted tags, LF line endings, no BOM")
+	bomMode      = flag.String("bom", "keep", "UTF-8 byte order mark on output: keep (from --keep-header input), add or strip")
+
+	// Output verification
+	verifyRoundtrip = flag.Bool("verify-roundtrip", false, "Re-parse each game written and check its tags and moves are unchanged; exit with an error otherwise")
+
+	// One game per key
+	uniqueBy = flag.String("unique-by", "", "Output only the first matching game for each value of these tags (e.g. White or Event,Round)")
+
+	// Repeated input
+	skipSeen = flag.Bool("skip-seen", false, "Skip games identical to one already output in this run, e.g. from a file given twice, and report them")
+
+	// Event dates
+	eventDateCheck  = flag.String("event-date-check", "", "Check each Date is on or after EventDate and within --event-date-window days of it: report or reject")
+	eventDateWindow = flag.Int("event-date-window", 90, "Days after EventDate a game Date may fall for --event-date-check")
+	fillEventDate   = flag.Bool("fill-event-date", false, "Set a missing EventDate to the earliest Date of the same Event in each input")
+	eventDateFilter = flag.String("event-date-range", "", "Only games whose EventDate is in this range, e.g. 2019.07-2019.08.15, 2020- or -1999")
+
+	// Novelties against a reference collection
+	referenceIndex = flag.String("reference", "", "Position index (from \"index build\") of a reference collection: tag each game's first position missing from it as NoveltyPly")
+	noveltyBefore  = flag.Int("novelty-before", 0, "With --reference, only games with a novelty before move N")
+
+	// Repeated tag handling
+	duplicateTagPolicy = flag.String("duplicate-tags", "last", "Value kept when a tag is repeated in one game: first, last, error")
+	noDuplicateTagKeys = flag.Bool("no-duplicate-tag-keys", false, "Drop games that repeat a tag (same as --duplicate-tags error)")
+
+	// Null move handling
+	keepNull             = flag.Bool("keep-null", false, "Keep null moves (--/Z0) as written (default)")
+	rejectNull           = flag.Bool("reject-null", false, "Drop games that contain null moves")
+	convertNullToComment = flag.Bool("convert-null-to-comment", false, "Replace null moves and the moves after them with a comment")
+
 	// Fuzzy duplicate detection
-	fuzzyDepth = flag.Int("fuzzydepth", 0, "Match duplicates at this ply depth (positional)")
+	fuzzyDepth = flag.Int("fuzzydepth", 0, "With -D/-d/-U/-c, games are duplicates when they pass through the same positions for their first N plies")
+	fuzzyDup   = flag.Int("fuzzydup", 0, "Suppress near-duplicates: games that pass through the same positions for their first N plies (-D with --fuzzydepth N)")
 
 	// Variation splitting
 	splitVariants = flag.Bool("splitvariants", false, "Output each variation as a separate game")
@@ -184,15 +396,22 @@ func applyFlags(cfg *config.Config) {
 // applyPhase4Flags applies Phase 4 feature flags.
 func applyPhase4Flags(cfg *config.Config) {
 	cfg.AllowNestedComments = *nestedComments
+	cfg.MaxGameBytes = *maxGameBytes
+	cfg.MaxCommentBytes = *maxCommentBytes
 	cfg.SplitVariants = *splitVariants
 	cfg.Chess960Mode = *chess960Mode
 	cfg.FuzzyDepth = *fuzzyDepth
+	if *fuzzyDup > 0 {
+		cfg.FuzzyDepth = *fuzzyDup
+	}
 }
 
 // applyTagOutputFlags configures tag output settings.
 func applyTagOutputFlags(cfg *config.Config) {
+	cfg.Output.TagsOnly = *tagsOnly
+	cfg.Output.MovesOnly = *movesOnly
 	switch {
-	case *noTags:
+	case *noTags, *movesOnly:
 		cfg.Output.TagFormat = config.NoTags
 	case *sevenTagOnly:
 		cfg.Output.TagFormat = config.SevenTagRoster
@@ -209,21 +428,27 @@ func applyContentFlags(cfg *config.Config) {
 	cfg.Output.JSONFormat = *jsonOutput
 	cfg.Output.MaxLineLength = uint(*lineLength)
 	cfg.Output.ECOMaxHandles = *ecoMaxHandles
+	cfg.Output.StableOutput = *stableOutput
+}
+
+// outputFormats maps -W values to output formats.
+var outputFormats = map[string]config.OutputFormat{
+	"san":     config.SAN,
+	"lalg":    config.LALG,
+	"halg":    config.HALG,
+	"elalg":   config.ELALG,
+	"uci":     config.UCI,
+	"san+uci": config.SANUCI,
+	"epd":     config.EPD,
+	"fen":     config.FEN,
 }
 
 // applyOutputFormatFlags configures the output format.
 func applyOutputFormatFlags(cfg *config.Config) {
-	formatMap := map[string]config.OutputFormat{
-		"lalg":  config.LALG,
-		"halg":  config.HALG,
-		"elalg": config.ELALG,
-		"uci":   config.UCI,
-		"epd":   config.EPD,
-		"fen":   config.FEN,
-	}
-
-	if format, ok := formatMap[*outputFormat]; ok {
+	if format, ok := outputFormats[*outputFormat]; ok {
 		cfg.Output.Format = format
+		cfg.Output.SANUCISeparator = *sanUCISeparator
+		cfg.Output.EPDBestMove = *epdBestMove
 	} else {
 		cfg.Output.Format = config.SAN
 	}
@@ -248,9 +473,19 @@ func applyMoveBoundsFlags(cfg *config.Config) {
 // applyAnnotationFlags configures annotation and tag fixing settings.
 func applyAnnotationFlags(cfg *config.Config) {
 	cfg.Annotation.AddPlyCount = *addPlyCount
-	cfg.Annotation.AddFENComments = *addFENComments
+	cfg.Annotation.PlyCountVariations = *plyCountMode == "total"
+	cfg.Annotation.AddLongestVariation = *longestVariation
+	cfg.Annotation.AddFENComments = *addFENComments || *fenCommentPlies != "" || *fenCommentEvery > 0
+	if *fenCommentPlies != "" {
+		cfg.Annotation.FENCommentPlies = parseIntSet(*fenCommentPlies)
+	}
+	cfg.Annotation.FENCommentEvery = *fenCommentEvery
 	cfg.Annotation.AddHashComments = *addHashComments
 	cfg.Annotation.AddHashTag = *addHashcodeTag
+	cfg.Annotation.AddTimeClassTag = *addTimeClass
+	cfg.Annotation.AddTerminationTag = *addTermination
+	cfg.Annotation.AddPhoneticTags = *addPhoneticTags
+	cfg.Annotation.AddMatchLabelTag = *addLabelTag
 	cfg.Annotation.FixResultTags = *fixResultTags
 	cfg.Annotation.FixTagStrings = *fixTagStrings
 }
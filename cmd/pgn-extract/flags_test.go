@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/lgbarn/pgn-extract-go/internal/config"
@@ -460,3 +463,33 @@ func TestApplyFlags_QuietAndReportOnly(t *testing.T) {
 		t.Error("CheckOnly = false; want true when reportOnly=true")
 	}
 }
+
+func TestWriteCapabilities(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeCapabilities(&buf); err != nil {
+		t.Fatalf("writeCapabilities: %v", err)
+	}
+	var caps capabilities
+	if err := json.Unmarshal(buf.Bytes(), &caps); err != nil {
+		t.Fatalf("capabilities are not valid JSON: %v\n%s", err, buf.String())
+	}
+
+	if caps.Version != programVersion || caps.SchemaVersion != capabilitiesSchemaVersion {
+		t.Errorf("versions = %q, %d; want %q, %d", caps.Version, caps.SchemaVersion, programVersion, capabilitiesSchemaVersion)
+	}
+	types := make(map[string]string)
+	for _, f := range caps.Flags {
+		types[f.Name] = f.Type
+	}
+	for name, want := range map[string]string{"7": "bool", "workers": "int", "W": "string", "game-timeout": "duration"} {
+		if types[name] != want {
+			t.Errorf("flag %s has type %q; want %q", name, types[name], want)
+		}
+	}
+	if !strings.Contains(strings.Join(caps.OutputFormats, ","), "uci") {
+		t.Errorf("output formats %v lack uci", caps.OutputFormats)
+	}
+	if !strings.Contains(strings.Join(caps.CQL.Filters, ","), "flipcolor") || strings.Contains(strings.Join(caps.CQL.Filters, ","), "diagonal") {
+		t.Errorf("unexpected CQL filters %v", caps.CQL.Filters)
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -227,6 +229,7 @@ func TestOutputFormat(t *testing.T) {
 		{"halg", "halg", "e2-e4", []string{"e2-e4", "e7-e5"}},
 		{"elalg", "elalg", "Pe2e4", []string{}}, // Enhanced long algebraic
 		{"uci", "uci", "e2e4", []string{"e2e4", "e7e5"}},
+		{"san+uci", "san+uci", "e4/e2e4", []string{"e4/e2e4", "e5/e7e5"}},
 	}
 
 	for _, tt := range tests {
@@ -246,6 +249,14 @@ func TestOutputFormat(t *testing.T) {
 	}
 }
 
+// TestSANUCICommentForm tests -W san+uci with the UCI move as a comment.
+func TestSANUCICommentForm(t *testing.T) {
+	stdout, _ := runPgnExtract(t, "-W", "san+uci", "--san-uci-separator=", "-s", inputFile("test-ucW.pgn"))
+	if !strings.Contains(stdout, "e4 {uci: e2e4}") || !strings.Contains(stdout, "e5 {uci: e7e5}") {
+		t.Errorf("Expected SAN moves followed by UCI comments, got:\n%s", stdout)
+	}
+}
+
 // TestECOClassification tests the -e flag for ECO classification.
 func TestECOClassification(t *testing.T) {
 	// First get output without ECO
@@ -381,6 +392,97 @@ func TestJSONOutput(t *testing.T) {
 	}
 }
 
+// TestJSONSource tests the source fields of JSON games.
+func TestJSONSource(t *testing.T) {
+	input := inputFile("fischer.pgn")
+	stdout, _ := runPgnExtract(t, "-J", "-s", input)
+
+	var out struct {
+		Games []struct {
+			Tags       map[string]string `json:"tags"`
+			File       string            `json:"sourceFile"`
+			GameIndex  int               `json:"gameIndex"`
+			ByteOffset int64             `json:"byteOffset"`
+			ByteLength int64             `json:"byteLength"`
+		} `json:"games"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(out.Games) < 2 {
+		t.Fatalf("got %d games, want several", len(out.Games))
+	}
+
+	data, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, src := range out.Games {
+		if src.File != input || src.GameIndex != i+1 {
+			t.Errorf("game %d source = %s #%d", i+1, src.File, src.GameIndex)
+		}
+		text := string(data[src.ByteOffset : src.ByteOffset+src.ByteLength])
+		if !strings.Contains(text, fmt.Sprintf("[White %q]", src.Tags["White"])) {
+			t.Errorf("game %d text at offset %d does not hold its White tag:\n%s", i+1, src.ByteOffset, text)
+		}
+	}
+}
+
+// TestJSONComputedFields tests the fields JSON output computes from the
+// game rather than its tags.
+func TestJSONComputedFields(t *testing.T) {
+	pgn := createTempPGN(t, "untagged.pgn", `[Result "*"]
+
+1. e4 e5 (1... c5) 2. Nf3 {Developing} Nc6 *
+
+[Result "*"]
+
+*
+`)
+	stdout, _ := runPgnExtract(t, "-J", "-s", "-e", testEcoFile(), pgn)
+
+	var out struct {
+		Games []struct {
+			ECO           string `json:"eco"`
+			Opening       string `json:"opening"`
+			PlyCount      *int   `json:"plyCount"`
+			FinalFEN      string `json:"finalFEN"`
+			HasVariations *bool  `json:"hasVariations"`
+			HasComments   *bool  `json:"hasComments"`
+		} `json:"games"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(out.Games) != 2 {
+		t.Fatalf("got %d games, want 2", len(out.Games))
+	}
+
+	game := out.Games[0]
+	if game.ECO == "" || game.Opening == "" {
+		t.Errorf("eco = %q, opening = %q; want the classification", game.ECO, game.Opening)
+	}
+	if game.PlyCount == nil || *game.PlyCount != 4 {
+		t.Errorf("plyCount = %v, want 4", game.PlyCount)
+	}
+	if game.FinalFEN != "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3" {
+		t.Errorf("finalFEN = %q", game.FinalFEN)
+	}
+	if game.HasVariations == nil || !*game.HasVariations || game.HasComments == nil || !*game.HasComments {
+		t.Errorf("hasVariations = %v, hasComments = %v; want both true", game.HasVariations, game.HasComments)
+	}
+
+	// An empty game still carries every computed field
+	empty := out.Games[1]
+	if empty.PlyCount == nil || *empty.PlyCount != 0 || empty.HasVariations == nil || *empty.HasVariations ||
+		empty.HasComments == nil || *empty.HasComments {
+		t.Errorf("empty game fields = %+v", empty)
+	}
+	if !strings.HasPrefix(empty.FinalFEN, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq -") {
+		t.Errorf("empty game finalFEN = %q, want the initial position", empty.FinalFEN)
+	}
+}
+
 // TestLineLength tests the -w flag for line length control.
 func TestLineLength(t *testing.T) {
 	// Test with very short line length
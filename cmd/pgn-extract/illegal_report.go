@@ -0,0 +1,68 @@
+// illegal_report.go - CSV report of the first illegal move of each game
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+)
+
+// IllegalMoveReport writes a CSV row of file, game number, ply, move and
+// reason for the first illegal move of each game, so that source
+// files can be corrected by hand. A game whose FEN tag is invalid is
+// reported at ply 0 with no move.
+// NOT thread-safe: Only accessed from the goroutine reading the input.
+type IllegalMoveReport struct {
+	file  *os.File
+	w     *csv.Writer
+	games int // games reported
+}
+
+// NewIllegalMoveReport creates the CSV file and writes its header row.
+func NewIllegalMoveReport(filename string) (*IllegalMoveReport, error) {
+	file, err := os.Create(filename) //nolint:gosec // G304: filename is user-specified
+	if err != nil {
+		return nil, err
+	}
+	r := &IllegalMoveReport{file: file, w: csv.NewWriter(file)}
+	if err := r.w.Write([]string{"file", "game", "ply", "move", "reason"}); err != nil {
+		_ = file.Close() // already failing
+		return nil, err
+	}
+	return r, nil
+}
+
+// check reports the first illegal move of each game.
+func (r *IllegalMoveReport) check(games []*chess.Game) error {
+	for _, game := range games {
+		illegal, found := engine.FirstIllegalMove(game)
+		if !found {
+			continue
+		}
+		r.games++
+		row := []string{game.SourceFile, strconv.Itoa(game.SourceIndex), strconv.Itoa(illegal.Ply), illegal.Written, illegal.Reason}
+		if err := r.w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes the CSV file, logging at log the number of
+// games reported.
+func (r *IllegalMoveReport) Close(log io.Writer, verbose bool) error {
+	if verbose {
+		fmt.Fprintf(log, "%d game(s) with an illegal move reported.\n", r.games)
+	}
+	r.w.Flush()
+	if err := r.w.Error(); err != nil {
+		_ = r.file.Close() // already failing
+		return err
+	}
+	return r.file.Close()
+}
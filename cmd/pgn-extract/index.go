@@ -0,0 +1,184 @@
+// index.go - The "index" subcommand: position index building and lookup
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/index"
+)
+
+// runIndex implements "pgn-extract index build|query". It returns the exit
+// status: for a query 0 when games were found and 1 when none were, and 2
+// on error.
+func runIndex(args []string, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "build":
+			return runIndexBuild(args[1:], stdout, stderr)
+		case "query":
+			return runIndexQuery(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "Usage: pgn-extract index build [-o games.idx] games.pgn\n")
+	fmt.Fprintf(stderr, "       pgn-extract index query -fen FEN [-list] games.idx\n")
+	return 2
+}
+
+// runIndexBuild writes a position index of one PGN file.
+func runIndexBuild(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("index build", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	outFile := fs.String("o", "", "Index file to write (default: the PGN file name with .idx)")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: pgn-extract index build [-o games.idx] games.pgn\n\n")
+		fmt.Fprintf(stderr, "Indexes the starting position and every main-line position of each\n")
+		fmt.Fprintf(stderr, "game, for use by \"pgn-extract index query\".\n\n")
+		fs.PrintDefaults()
+	}
+	files, err := parseSubcommandArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(files) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	pgnFile, err := filepath.Abs(files[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 2
+	}
+	src, err := index.SourceOf(pgnFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error reading %s: %v\n", files[0], err)
+		return 2
+	}
+	games, err := readDiffInput(pgnFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error reading %s: %v\n", files[0], err)
+		return 2
+	}
+
+	if *outFile == "" {
+		*outFile = strings.TrimSuffix(files[0], filepath.Ext(files[0])) + ".idx"
+	}
+	out, err := os.Create(*outFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error creating %s: %v\n", *outFile, err)
+		return 2
+	}
+	err = index.Write(out, src, games)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error writing %s: %v\n", *outFile, err)
+		return 2
+	}
+	fmt.Fprintf(stdout, "%d game(s) indexed in %s.\n", len(games), *outFile)
+	return 0
+}
+
+// runIndexQuery prints the games of an index's source that reach a
+// position, each once, as they are written in the source.
+func runIndexQuery(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("index query", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fen := fs.String("fen", "", "Position to look up")
+	list := fs.Bool("list", false, "List the game numbers and plies reaching the position instead of the games")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: pgn-extract index query -fen FEN [-list] games.idx\n\n")
+		fmt.Fprintf(stderr, "Prints the games reaching a position. Exit status is 1 if there are none.\n\n")
+		fs.PrintDefaults()
+	}
+	files, err := parseSubcommandArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(files) != 1 || *fen == "" {
+		fs.Usage()
+		return 2
+	}
+
+	ix, err := index.Open(files[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "Error opening %s: %v\n", files[0], err)
+		return 2
+	}
+	defer ix.Close() //nolint:errcheck // read-only
+
+	if ix.Stale() {
+		fmt.Fprintf(stderr, "Error: %s has changed since it was indexed; rebuild %s\n", ix.Source.Path, files[0])
+		return 2
+	}
+	if !*list && !ix.HasSource() {
+		fmt.Fprintf(stderr, "Error: %s was not built from a PGN file; use -list\n", files[0])
+		return 2
+	}
+	matches, err := ix.LookupFEN(*fen)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 2
+	}
+	if len(matches) == 0 {
+		return 1
+	}
+
+	if *list {
+		for _, m := range matches {
+			fmt.Fprintf(stdout, "game %d ply %d\n", m.Game, m.Ply)
+		}
+		return 0
+	}
+
+	if err := writeIndexedGames(stdout, ix, matches); err != nil {
+		fmt.Fprintf(stderr, "Error reading %s: %v\n", ix.Source.Path, err)
+		return 2
+	}
+	return 0
+}
+
+// writeIndexedGames copies each matched game once from the source.
+func writeIndexedGames(w io.Writer, ix *index.Index, matches []index.Match) error {
+	source, err := os.Open(ix.Source.Path)
+	if err != nil {
+		return err
+	}
+	defer source.Close() //nolint:errcheck // read-only
+
+	last := 0
+	for _, m := range matches {
+		if m.Game == last {
+			continue
+		}
+		last = m.Game
+		start, end := ix.GameSpan(m.Game)
+		if _, err := io.Copy(w, io.NewSectionReader(source, start, end-start)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSubcommandArgs parses flags that may come before or after the
+// file arguments, as in "index build games.pgn -o games.idx", and returns
+// the file arguments.
+func parseSubcommandArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var files []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return files, nil
+		}
+		files = append(files, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
@@ -0,0 +1,142 @@
+// inject.go - Merging externally written comments into games
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/hashing"
+)
+
+// injectedComment is one comment to add at a main-line ply (0 = before the first move).
+type injectedComment struct {
+	ply  int
+	text string
+}
+
+// commentInjector adds comments read from a CSV file of game,ply,comment
+// rows. A game is identified by its GameId or HashCode tag, or by the hash
+// code of its final position as written by --addhashcode. Site is not a
+// key, as many games share one.
+// Read-only after loading, so it is safe for concurrent use.
+type commentInjector struct {
+	byGame      map[string][]injectedComment
+	hasHashKeys bool // some keys look like hash codes, so final positions are needed
+}
+
+// loadCommentInjector reads an injection CSV file.
+func loadCommentInjector(path string) (*commentInjector, error) {
+	file, err := os.Open(path) //nolint:gosec // G304: path is user-specified
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readCommentInjector(file)
+}
+
+// readCommentInjector parses game,ply,comment rows. A first row whose ply
+// column is not a number is taken as a header; lines starting with # are
+// ignored. Negative plies are an error.
+func readCommentInjector(r io.Reader) (*commentInjector, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+
+	ci := &commentInjector{byGame: make(map[string][]injectedComment)}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("row %d: want game,ply,comment, got %d field(s)", row, len(record))
+		}
+
+		ply, err := strconv.Atoi(strings.TrimSpace(record[1]))
+		if err != nil {
+			if row == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("row %d: bad ply %q", row, record[1])
+		}
+		if ply < 0 {
+			return nil, fmt.Errorf("row %d: ply %d is negative", row, ply)
+		}
+
+		key := strings.ToLower(strings.TrimSpace(record[0]))
+		if isHashCode(key) {
+			ci.hasHashKeys = true
+		}
+		ci.byGame[key] = append(ci.byGame[key], injectedComment{ply: ply, text: record[2]})
+	}
+	return ci, nil
+}
+
+// inject adds the comments for a game, using board as its final position
+// when it is known. It returns the number of comments added.
+func (ci *commentInjector) inject(game *chess.Game, board *chess.Board) int {
+	comments := ci.lookup(game, board)
+	added := 0
+	for _, c := range comments {
+		if c.ply == 0 {
+			game.AppendPrefixComment(c.text)
+			added++
+			continue
+		}
+		if move := mainLineMove(game, c.ply); move != nil {
+			move.AppendComment(c.text)
+			added++
+		}
+	}
+	return added
+}
+
+// lookup returns the comments whose game key identifies this game.
+func (ci *commentInjector) lookup(game *chess.Game, board *chess.Board) []injectedComment {
+	for _, tag := range []string{"GameId", "HashCode"} {
+		if value := strings.ToLower(strings.TrimSpace(game.Tags[tag])); value != "" {
+			if comments, ok := ci.byGame[value]; ok {
+				return comments
+			}
+		}
+	}
+
+	if !ci.hasHashKeys {
+		return nil
+	}
+	if board == nil {
+		board, _, _ = engine.ReplayGame(game)
+	}
+	return ci.byGame[fmt.Sprintf("%016x", hashing.GenerateZobristHash(board))]
+}
+
+// isHashCode reports whether s looks like a 16-digit hex hash code.
+func isHashCode(s string) bool {
+	if len(s) != 16 {
+		return false
+	}
+	_, err := strconv.ParseUint(s, 16, 64)
+	return err == nil
+}
+
+// mainLineMove returns the move at a 1-based main-line ply, or nil if the
+// main line has no such ply.
+func mainLineMove(game *chess.Game, ply int) *chess.Move {
+	if ply < 1 {
+		return nil
+	}
+	move := game.Moves
+	for i := 1; move != nil && i < ply; i++ {
+		move = move.Next
+	}
+	return move
+}
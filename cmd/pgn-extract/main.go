@@ -5,21 +5,38 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
-	"sync/atomic"
+	"time"
 
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
 	"github.com/lgbarn/pgn-extract-go/internal/config"
 	"github.com/lgbarn/pgn-extract-go/internal/cql"
 	"github.com/lgbarn/pgn-extract-go/internal/eco"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
 	"github.com/lgbarn/pgn-extract-go/internal/hashing"
+	"github.com/lgbarn/pgn-extract-go/internal/index"
 	"github.com/lgbarn/pgn-extract-go/internal/matching"
+	"github.com/lgbarn/pgn-extract-go/internal/parser"
+	"github.com/lgbarn/pgn-extract-go/internal/processing"
+	"github.com/lgbarn/pgn-extract-go/internal/stats"
+	"github.com/lgbarn/pgn-extract-go/internal/tagedit"
 )
 
 const programVersion = "0.1.0"
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(runDiff(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "index" {
+		os.Exit(runIndex(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	flag.Usage = usage
 
 	// First pass: check for -A flag to load arguments file
@@ -47,15 +64,220 @@ func main() {
 		os.Exit(0)
 	}
 
+	setupDiagnostics()
+
+	if *capabilitiesFlag {
+		if err := writeCapabilities(os.Stdout); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing capabilities: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	cfg := config.NewConfig()
 	applyFlags(cfg)
+	setupNullMovePolicy(cfg)
+	setupDuplicateTagPolicy(cfg)
+	setupNAGStyle(cfg)
 
 	// Initialize selection sets for selectOnly/skipMatching flags
 	initSelectionSets()
 
+	// Parse time class filter
+	setupTimeClassFilter()
+	setupTerminationFilter()
+
+	if *strictSAN != "" && *strictSAN != "reject" && *strictSAN != "report" {
+		fmt.Fprintf(diagnosticOutput, "Error: --strict-san must be reject or report, not %q\n", *strictSAN)
+		os.Exit(1)
+	}
+
+	if *posIndexFormat != "binary" && *posIndexFormat != "csv" {
+		fmt.Fprintf(diagnosticOutput, "Error: --posindex-format must be binary or csv, not %q\n", *posIndexFormat)
+		os.Exit(1)
+	}
+
+	if *extractFrom != "" && *extractFrom != "html" && *extractFrom != "markdown" {
+		fmt.Fprintf(diagnosticOutput, "Error: --extract-from must be html or markdown, not %q\n", *extractFrom)
+		os.Exit(1)
+	}
+
+	if (*alsoFilterFile == "") != (*alsoOutput == "") {
+		fmt.Fprintf(diagnosticOutput, "Error: --also-filter and --also-output must be given together\n")
+		os.Exit(1)
+	}
+
+	if _, err := filepath.Match(*inputGlob, ""); err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error: --input-glob %q: %v\n", *inputGlob, err)
+		os.Exit(1)
+	}
+
+	if *reportMode != "" && *reportMode != "players" {
+		fmt.Fprintf(diagnosticOutput, "Error: --report must be players, not %q\n", *reportMode)
+		os.Exit(1)
+	}
+	if *reportFormat != "text" && *reportFormat != "csv" && *reportFormat != "json" {
+		fmt.Fprintf(diagnosticOutput, "Error: --report-format must be text, csv or json, not %q\n", *reportFormat)
+		os.Exit(1)
+	}
+
+	if *tagsOnly && (*movesOnly || *noTags) {
+		fmt.Fprintf(diagnosticOutput, "Error: --tags-only cannot be combined with --moves-only or --notags\n")
+		os.Exit(1)
+	}
+	if (*tagsOnly || *movesOnly) && (*jsonOutput || *outputFormat == "epd" || *outputFormat == "fen") {
+		fmt.Fprintf(diagnosticOutput, "Error: --tags-only and --moves-only write PGN and cannot be combined with -J or -W epd/fen\n")
+		os.Exit(1)
+	}
+
+	if *blunderThreshold < 0 {
+		fmt.Fprintf(diagnosticOutput, "Error: --blunders must not be negative\n")
+		os.Exit(1)
+	}
+	if *blunderNAGs && *blunderThreshold == 0 {
+		fmt.Fprintf(diagnosticOutput, "Error: --blunder-nags needs --blunders\n")
+		os.Exit(1)
+	}
+
+	if *fenCommentEvery < 0 {
+		fmt.Fprintf(diagnosticOutput, "Error: --fencomments-every must not be negative\n")
+		os.Exit(1)
+	}
+	if *fenCommentPlies != "" {
+		for _, part := range strings.Split(*fenCommentPlies, ",") {
+			if ply, err := strconv.Atoi(strings.TrimSpace(part)); err != nil || ply < 1 {
+				fmt.Fprintf(diagnosticOutput, "Error: --fencomments-plies must be a comma-separated list of plies, not %q\n", *fenCommentPlies)
+				os.Exit(1)
+			}
+		}
+	}
+
+	switch *legality {
+	case "strict", "castling-lenient", "off":
+	default:
+		fmt.Fprintf(diagnosticOutput, "Error: --legality must be strict, castling-lenient or off, not %q\n", *legality)
+		os.Exit(1)
+	}
+
+	switch *enPassant {
+	case "", "report", "reject", "repair":
+	default:
+		fmt.Fprintf(diagnosticOutput, "Error: --en-passant must be report, reject or repair, not %q\n", *enPassant)
+		os.Exit(1)
+	}
+
+	switch *moveNumbers {
+	case "", "report", "reject":
+	default:
+		fmt.Fprintf(diagnosticOutput, "Error: --move-numbers must be report or reject, not %q\n", *moveNumbers)
+		os.Exit(1)
+	}
+
+	if *plyCountMode != "mainline" && *plyCountMode != "total" {
+		fmt.Fprintf(diagnosticOutput, "Error: --plycount-mode must be mainline or total, not %q\n", *plyCountMode)
+		os.Exit(1)
+	}
+	switch *plyBoundsMode {
+	case "mainline", "total", "match":
+	default:
+		fmt.Fprintf(diagnosticOutput, "Error: --ply-bounds-mode must be mainline, total or match, not %q\n", *plyBoundsMode)
+		os.Exit(1)
+	}
+
+	if *eventDateCheck != "" && *eventDateCheck != "reject" && *eventDateCheck != "report" {
+		fmt.Fprintf(diagnosticOutput, "Error: --event-date-check must be reject or report, not %q\n", *eventDateCheck)
+		os.Exit(1)
+	}
+	if *eventDateWindow < 0 {
+		fmt.Fprintf(diagnosticOutput, "Error: --event-date-window must not be negative\n")
+		os.Exit(1)
+	}
+	if *eventDateFilter != "" {
+		r, err := parseDateRange(*eventDateFilter)
+		if err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error: --event-date-range: %v\n", err)
+			os.Exit(1)
+		}
+		eventDateRange = &r
+	}
+	if *timeTroubleSpec != "" {
+		limit, err := parseTimeTrouble(*timeTroubleSpec)
+		if err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error: --timetrouble: %v\n", err)
+			os.Exit(1)
+		}
+		timeTrouble = limit
+	}
+	if *evalRangeSpec != "" {
+		r, err := parseEvalRange(*evalRangeSpec)
+		if err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error: --evalrange: %v\n", err)
+			os.Exit(1)
+		}
+		evalRange = &r
+	}
+	if *materialWindow != "" {
+		window, err := parseMoveWindow(*materialWindow)
+		if err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error: --zwindow: %v\n", err)
+			os.Exit(1)
+		}
+		materialMoves = window
+	}
+	if *materialPlies < 0 {
+		fmt.Fprintf(diagnosticOutput, "Error: --zplies must not be negative\n")
+		os.Exit(1)
+	}
+	if *pieceValuesSpec != "" {
+		values, err := matching.ParsePieceValues(*pieceValuesSpec)
+		if err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error: --piece-values: %v\n", err)
+			os.Exit(1)
+		}
+		pieceValues = values
+	}
+
+	switch *bomMode {
+	case "keep":
+		if *stableOutput {
+			*bomMode = "strip"
+		}
+	case "add", "strip":
+	default:
+		fmt.Fprintf(diagnosticOutput, "Error: --bom must be keep, add or strip, not %q\n", *bomMode)
+		os.Exit(1)
+	}
+
+	if *sortSpec != "" {
+		keys, err := processing.ParseSortKeys(*sortSpec)
+		if err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error: --sort: %v\n", err)
+			os.Exit(1)
+		}
+		sortKeys = keys
+	}
+
+	if *countPerFile {
+		*countOnly = true
+	}
+
+	if (*interleave || *reconcile || sortKeys != nil) && *perFileLimit > 0 {
+		fmt.Fprintf(diagnosticOutput, "Error: --per-file-limit cannot be combined with --interleave, --reconcile or --sort\n")
+		os.Exit(1)
+	}
+
+	if *fsyncEvery < 0 {
+		fmt.Fprintf(diagnosticOutput, "Error: --fsync-every must not be negative\n")
+		os.Exit(1)
+	}
+	if (*asyncOutput || *fsyncEvery > 0) && (*outputFile == "" || *splitGames > 0) {
+		fmt.Fprintf(diagnosticOutput, "Error: --async-output and --fsync-every need a single -o output file\n")
+		os.Exit(1)
+	}
+
 	// Set up logging and output files
 	setupLogFile(cfg)
-	setupOutputFile(cfg)
+	asyncOut := setupOutputFile(cfg)
 	setupDuplicateFile(cfg)
 
 	// Set up non-matching file for -n flag
@@ -70,6 +292,9 @@ func main() {
 	// Load ECO classifier if specified
 	ecoClassifier := loadECOClassifier(cfg)
 
+	// Open the reference index for novelties if specified
+	reference := loadReferenceIndex(cfg)
+
 	// Set up game filter with all criteria
 	gameFilter := setupGameFilter()
 
@@ -81,6 +306,11 @@ func main() {
 
 	// Parse CQL query
 	cqlNode := parseCQLQuery()
+	cqlOutput := setupCQLOutput(cqlNode)
+	if *plyBoundsMode == "match" && cqlNode == nil && gameFilter.PositionMatcher.PatternCount() == 0 {
+		fmt.Fprintf(diagnosticOutput, "Error: --ply-bounds-mode match requires a FEN position filter or --cql\n")
+		os.Exit(1)
+	}
 
 	// Set up output splitting
 	var splitWriter *SplitWriter
@@ -101,6 +331,62 @@ func main() {
 			base = strings.TrimSuffix(*outputFile, filepath.Ext(*outputFile))
 		}
 		ecoSplitWriter = NewECOSplitWriter(base, *ecoSplit, cfg, cfg.Output.ECOMaxHandles)
+		if *splitDir != "" {
+			if err := ecoSplitWriter.SetDir(*splitDir); err != nil {
+				fmt.Fprintf(diagnosticOutput, "Error creating split directory %s: %v\n", *splitDir, err)
+				os.Exit(1)
+			}
+		}
+	} else if *splitDir != "" {
+		fmt.Fprintf(diagnosticOutput, "Error: --split-dir requires -E\n")
+		os.Exit(1)
+	}
+
+	// Set up result-based output splitting
+	var resultSplitWriter *ResultSplitWriter
+	if *splitByResult {
+		base := "output"
+		if *outputFile != "" {
+			base = strings.TrimSuffix(*outputFile, filepath.Ext(*outputFile))
+		}
+		var names []string
+		if *resultFiles != "" {
+			names = strings.Split(*resultFiles, ",")
+		}
+		resultSplitWriter = NewResultSplitWriter(base, names, cfg)
+	}
+
+	// Set up date-based output splitting
+	var dateSplitWriter *DateSplitWriter
+	if *splitDate != "" {
+		if ecoSplitWriter != nil || resultSplitWriter != nil {
+			fmt.Fprintf(diagnosticOutput, "Error: --splitdate cannot be combined with -E or --split-by-result\n")
+			os.Exit(1)
+		}
+		base := "output"
+		if *outputFile != "" {
+			base = strings.TrimSuffix(*outputFile, filepath.Ext(*outputFile))
+		}
+		var err error
+		dateSplitWriter, err = NewDateSplitWriter(base, strings.ToLower(*splitDate), cfg, cfg.Output.ECOMaxHandles)
+		if err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Set up player-based output splitting
+	var playerSplitWriter *PlayerSplitWriter
+	if *splitPlayer {
+		if ecoSplitWriter != nil || resultSplitWriter != nil || dateSplitWriter != nil {
+			fmt.Fprintf(diagnosticOutput, "Error: --splitplayer cannot be combined with -E, --split-by-result or --splitdate\n")
+			os.Exit(1)
+		}
+		base := "output"
+		if *outputFile != "" {
+			base = strings.TrimSuffix(*outputFile, filepath.Ext(*outputFile))
+		}
+		playerSplitWriter = NewPlayerSplitWriter(base, cfg, cfg.Output.ECOMaxHandles)
 	}
 
 	// Set up same-setup duplicate detection
@@ -115,19 +401,54 @@ func main() {
 		detector:         detector,
 		setupDetector:    setupDetector,
 		ecoClassifier:    ecoClassifier,
+		reference:        reference,
 		gameFilter:       gameFilter,
 		cqlNode:          cqlNode,
+		cqlOutput:        cqlOutput,
 		variationMatcher: variationMatcher,
 		materialMatcher:  materialMatcher,
 		ecoSplitWriter:   ecoSplitWriter,
+		resultSplit:      resultSplitWriter,
+		dateSplit:        dateSplitWriter,
+		playerSplit:      playerSplitWriter,
+		commentInjector:  setupCommentInjector(),
+		featureExport:    setupFeatureExporter(),
+		illegalReport:    setupIllegalMoveReport(),
+		posIndex:         setupPositionIndex(),
+		asyncOutput:      asyncOut,
+		deferred:         setupDeferredOriginals(cfg, detector),
+		uniqueBy:         newUniqueKeyFilter(*uniqueBy),
+		seen:             setupSeenGames(),
+		tagEditor:        setupTagEditor(),
+		playerStats:      setupPlayerStats(),
+		alsoFilter:       setupAlsoFilter(),
+		engineEval:       setupEngineAnnotator(),
 	}
 
 	// Process input files or stdin
+	start := time.Now()
 	totalGames, outputGames, duplicates := processAllInputs(ctx, splitWriter)
+	profile.totalTime = time.Since(start)
+	saveHashes(detector)
+
+	if *countOnly {
+		fmt.Println(outputGames)
+		return
+	}
 
 	// Report statistics
 	if cfg.Verbosity > 0 && !*quiet && !*reportOnly {
-		reportStatistics(detector, outputGames, duplicates, totalGames)
+		reportStatistics(detector, &ctx.run, outputGames, duplicates, totalGames)
+	}
+	if *debugStats {
+		reportDebugStats(diagnosticOutput)
+	}
+	if n := ctx.run.roundTripFailures.Load(); n > 0 {
+		fmt.Fprintf(diagnosticOutput, "Error: %d game(s) failed round-trip verification.\n", n)
+		os.Exit(1)
+	}
+	if ctx.run.outputErrors.Load() > 0 {
+		os.Exit(1)
 	}
 }
 
@@ -136,7 +457,7 @@ func setupLogFile(cfg *config.Config) {
 	if *logFile != "" {
 		file, err := os.Create(*logFile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating log file %s: %v\n", *logFile, err)
+			fmt.Fprintf(diagnosticOutput, "Error creating log file %s: %v\n", *logFile, err)
 			os.Exit(1)
 		}
 		cfg.LogFile = file
@@ -145,17 +466,22 @@ func setupLogFile(cfg *config.Config) {
 	if *appendLog != "" {
 		file, err := os.OpenFile(*appendLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644) //nolint:gosec // G302: 0644 is appropriate for user-created log files
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error opening log file %s: %v\n", *appendLog, err)
+			fmt.Fprintf(diagnosticOutput, "Error opening log file %s: %v\n", *appendLog, err)
 			os.Exit(1)
 		}
 		cfg.LogFile = file
 	}
+
+	if cfg.LogFile == os.Stderr {
+		cfg.LogFile = diagnosticOutput
+	}
 }
 
 // setupOutputFile configures the output file based on command-line flags.
-func setupOutputFile(cfg *config.Config) {
+// It returns the asynchronous writer for the file, if one is used.
+func setupOutputFile(cfg *config.Config) *asyncWriter {
 	if *outputFile == "" {
-		return
+		return nil
 	}
 
 	var file *os.File
@@ -168,10 +494,16 @@ func setupOutputFile(cfg *config.Config) {
 	}
 
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating output file %s: %v\n", *outputFile, err)
+		fmt.Fprintf(diagnosticOutput, "Error creating output file %s: %v\n", *outputFile, err)
 		os.Exit(1)
 	}
+	if *asyncOutput || *fsyncEvery > 0 {
+		aw := newAsyncWriter(file, *fsyncEvery)
+		cfg.OutputFile = aw
+		return aw
+	}
 	cfg.OutputFile = file
+	return nil
 }
 
 // setupDuplicateFile configures the duplicate output file.
@@ -182,7 +514,7 @@ func setupDuplicateFile(cfg *config.Config) {
 
 	file, err := os.Create(*duplicateFile)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating duplicate file %s: %v\n", *duplicateFile, err)
+		fmt.Fprintf(diagnosticOutput, "Error creating duplicate file %s: %v\n", *duplicateFile, err)
 		os.Exit(1)
 	}
 	cfg.Duplicate.DuplicateFile = file
@@ -190,27 +522,83 @@ func setupDuplicateFile(cfg *config.Config) {
 
 // setupDuplicateDetector creates and configures the duplicate detector.
 func setupDuplicateDetector(cfg *config.Config) hashing.DuplicateChecker {
-	if !*suppressDuplicates && *duplicateFile == "" && !*outputDupsOnly && *checkFile == "" {
+	if !*suppressDuplicates && *duplicateFile == "" && !*outputDupsOnly && *checkFile == "" && *firstNPlies <= 0 && *fuzzyDup <= 0 &&
+		*loadHashes == "" && *dumpHashes == "" {
 		return nil
 	}
 
-	cfg.Duplicate.Suppress = *suppressDuplicates
+	cfg.Duplicate.Suppress = *suppressDuplicates || *firstNPlies > 0 || *fuzzyDup > 0
+
+	if *fuzzyDepth < 0 || *fuzzyDup < 0 {
+		fmt.Fprintf(diagnosticOutput, "Error: --fuzzydepth and --fuzzydup must not be negative\n")
+		os.Exit(1)
+	}
+	if cfg.FuzzyDepth > 0 && (*firstNPlies > 0 || *dupePlies != 0 || *dupeBy != "moves") {
+		fmt.Fprintf(diagnosticOutput, "Error: --fuzzydup and --fuzzydepth cannot be combined with --first-n-plies, --dupe-plies or --dupe-by metadata\n")
+		os.Exit(1)
+	}
 	cfg.Duplicate.SuppressOriginals = *outputDupsOnly
+	if (*loadHashes != "" || *dumpHashes != "") && (*firstNPlies > 0 || *dupeBy == "metadata") {
+		fmt.Fprintf(diagnosticOutput, "Error: --loadhashes and --dumphashes cannot be combined with --first-n-plies or --dupe-by metadata\n")
+		os.Exit(1)
+	}
+
+	if *firstNPlies > 0 {
+		if *checkFile != "" {
+			fmt.Fprintf(diagnosticOutput, "Error: --first-n-plies cannot be combined with -c\n")
+			os.Exit(1)
+		}
+		if *dupePlies > 0 {
+			fmt.Fprintf(diagnosticOutput, "Error: --dupe-plies cannot be combined with --first-n-plies\n")
+			os.Exit(1)
+		}
+		return hashing.NewRelayDuplicateDetector(*firstNPlies)
+	}
+
+	if *dupePlies < 0 {
+		fmt.Fprintf(diagnosticOutput, "Error: --dupe-plies must not be negative\n")
+		os.Exit(1)
+	}
+
+	switch *dupeBy {
+	case "moves":
+	case "metadata":
+		if *dupePlies > 0 {
+			fmt.Fprintf(diagnosticOutput, "Error: --dupe-plies cannot be combined with --dupe-by metadata\n")
+			os.Exit(1)
+		}
+		if *checkFile != "" {
+			fmt.Fprintf(diagnosticOutput, "Error: --dupe-by metadata cannot be combined with -c\n")
+			os.Exit(1)
+		}
+		return hashing.NewMetadataDuplicateDetector()
+	default:
+		fmt.Fprintf(diagnosticOutput, "Error: --dupe-by must be moves or metadata, not %q\n", *dupeBy)
+		os.Exit(1)
+	}
 
 	// Load check file for duplicate detection
 	if *checkFile != "" {
 		file, err := os.Open(*checkFile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error opening check file %s: %v\n", *checkFile, err)
+			fmt.Fprintf(diagnosticOutput, "Error opening check file %s: %v\n", *checkFile, err)
 			os.Exit(1)
 		}
 		defer file.Close()
 
 		// Load games into a temporary non-thread-safe detector
 		tempDetector := hashing.NewDuplicateDetector(false, cfg.Duplicate.MaxCapacity)
+		tempDetector.SetPlyWindow(*dupePlies)
+		tempDetector.SetFuzzyDepth(cfg.FuzzyDepth)
 		checkGames := processInput(file, *checkFile, cfg)
 		for _, game := range checkGames {
-			board := replayGame(game)
+			board, _, err := engine.ReplayGamePlies(game, *dupePlies)
+			if err != nil {
+				if cfg.Verbosity > 0 {
+					fmt.Fprintf(cfg.LogFile, "Skipping check file game: %v\n", err)
+				}
+				continue
+			}
 			tempDetector.CheckAndAdd(game, board)
 		}
 
@@ -220,12 +608,109 @@ func setupDuplicateDetector(cfg *config.Config) hashing.DuplicateChecker {
 
 		// Create thread-safe detector and load from temporary detector
 		detector := hashing.NewThreadSafeDuplicateDetector(false, cfg.Duplicate.MaxCapacity)
+		detector.SetPlyWindow(*dupePlies)
+		detector.SetFuzzyDepth(cfg.FuzzyDepth)
 		detector.LoadFromDetector(tempDetector)
+		loadSavedHashes(detector, cfg)
 		return detector
 	}
 
 	// No check file - create empty thread-safe detector
-	return hashing.NewThreadSafeDuplicateDetector(false, cfg.Duplicate.MaxCapacity)
+	detector := hashing.NewThreadSafeDuplicateDetector(false, cfg.Duplicate.MaxCapacity)
+	detector.SetPlyWindow(*dupePlies)
+	detector.SetFuzzyDepth(cfg.FuzzyDepth)
+	loadSavedHashes(detector, cfg)
+	return detector
+}
+
+// loadSavedHashes adds the hashes saved by an earlier --dumphashes run, if
+// --loadhashes is given.
+func loadSavedHashes(detector *hashing.ThreadSafeDuplicateDetector, cfg *config.Config) {
+	if *loadHashes == "" {
+		return
+	}
+	file, err := os.Open(*loadHashes)
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error opening hash file %s: %v\n", *loadHashes, err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	if err := detector.LoadFrom(file); err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error loading hash file %s: %v\n", *loadHashes, err)
+		os.Exit(1)
+	}
+	if cfg.Verbosity > 0 {
+		fmt.Fprintf(cfg.LogFile, "Loaded %d game hashes from %s\n", detector.UniqueCount(), *loadHashes)
+	}
+}
+
+// saveHashes writes the duplicate hashes for --dumphashes.
+func saveHashes(detector hashing.DuplicateChecker) {
+	saver, ok := detector.(*hashing.ThreadSafeDuplicateDetector)
+	if *dumpHashes == "" || !ok {
+		return
+	}
+	file, err := os.Create(*dumpHashes) //nolint:gosec // G304: filename is user-specified
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error creating hash file %s: %v\n", *dumpHashes, err)
+		os.Exit(1)
+	}
+	err = saver.SaveTo(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error writing hash file %s: %v\n", *dumpHashes, err)
+		os.Exit(1)
+	}
+}
+
+// setupDeferredOriginals enables deferred output of kept games when
+// duplicates need to update or replace the copy that is eventually written.
+func setupDeferredOriginals(cfg *config.Config, detector hashing.DuplicateChecker) *deferredOriginals {
+	if *mergeDuplicateTags && (cfg.Duplicate.SuppressOriginals || *countOnly) {
+		fmt.Fprintf(diagnosticOutput, "Error: --merge-duplicate-tags cannot be combined with -U or --count\n")
+		os.Exit(1)
+	}
+
+	policy, err := parseKeepPolicy(*dupeKeep)
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if policy != keepFirst && (cfg.Duplicate.SuppressOriginals || *countOnly) {
+		fmt.Fprintf(diagnosticOutput, "Error: --dupe-keep %s cannot be combined with -U or --count\n", *dupeKeep)
+		os.Exit(1)
+	}
+
+	if policy == keepFirst && *firstNPlies > 0 {
+		policy = keepLongest
+	}
+	if policy == keepFirst && *dupeBy == "metadata" {
+		policy = keepBestAnnotated
+	}
+
+	if (!*mergeDuplicateTags && policy == keepFirst) || detector == nil || cfg.Duplicate.SuppressOriginals || *countOnly {
+		return nil
+	}
+
+	tracker, ok := detector.(hashing.OriginalTracker)
+	if !ok {
+		return nil
+	}
+	tracker.SetTrackOriginals(true)
+
+	var selector *duplicateSelector
+	if policy != keepFirst {
+		selector = &duplicateSelector{policy: policy}
+		for _, name := range strings.Split(*dupeSourceOrder, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				selector.sourceOrder = append(selector.sourceOrder, name)
+			}
+		}
+	}
+	return newDeferredOriginals(selector, *mergeDuplicateTags)
 }
 
 // loadECOClassifier loads the ECO classification file if specified.
@@ -236,7 +721,7 @@ func loadECOClassifier(cfg *config.Config) *eco.ECOClassifier {
 
 	classifier := eco.NewECOClassifier()
 	if err := classifier.LoadFromFile(*ecoFile); err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading ECO file %s: %v\n", *ecoFile, err)
+		fmt.Fprintf(diagnosticOutput, "Error loading ECO file %s: %v\n", *ecoFile, err)
 		os.Exit(1)
 	}
 
@@ -248,16 +733,47 @@ func loadECOClassifier(cfg *config.Config) *eco.ECOClassifier {
 	return classifier
 }
 
+// loadReferenceIndex opens the --reference position index. It stays open
+// for the whole run.
+func loadReferenceIndex(cfg *config.Config) *index.Index {
+	if *referenceIndex == "" {
+		if *noveltyBefore > 0 {
+			fmt.Fprintf(diagnosticOutput, "Error: --novelty-before needs --reference\n")
+			os.Exit(1)
+		}
+		return nil
+	}
+
+	ix, err := index.Open(*referenceIndex)
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error opening reference index %s: %v\n", *referenceIndex, err)
+		os.Exit(1)
+	}
+	if cfg.Verbosity > 0 {
+		fmt.Fprintf(cfg.LogFile, "Loaded reference index of %d games\n", ix.NumGames())
+	}
+	return ix
+}
+
 // setupGameFilter creates and configures the game filter with all criteria.
 func setupGameFilter() *matching.GameFilter {
 	filter := matching.NewGameFilter()
 	filter.SetUseSoundex(*useSoundex)
 	filter.SetSubstringMatch(*tagSubstring)
+	filter.SetCaseSensitive(*matchCase)
+	filter.SetAnchored(*matchAnchor)
+	filter.SetExactMatch(*matchExact)
+
+	// Position criteria added below, including those in a -t file, inherit
+	// the next-move constraint
+	if *nextMove != "" {
+		filter.SetNextMove(*nextMove)
+	}
 
 	// Load tag criteria file if specified
 	if *tagFile != "" {
 		if err := filter.LoadTagFile(*tagFile); err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading tag file %s: %v\n", *tagFile, err)
+			fmt.Fprintf(diagnosticOutput, "Error loading tag file %s: %v\n", *tagFile, err)
 			os.Exit(1)
 		}
 	}
@@ -280,14 +796,119 @@ func setupGameFilter() *matching.GameFilter {
 	}
 	if *fenFilter != "" {
 		if err := filter.AddFENFilter(*fenFilter); err != nil {
-			fmt.Fprintf(os.Stderr, "Error parsing FEN filter: %v\n", err)
+			fmt.Fprintf(diagnosticOutput, "Error parsing FEN filter: %v\n", err)
 			os.Exit(1)
 		}
 	}
+	for i, entry := range *fenEntries {
+		if err := filter.AddFENEntry(entry, fmt.Sprintf("fen%d", i+1)); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error parsing --fen %q: %v\n", entry, err)
+			os.Exit(1)
+		}
+	}
+	if *fenFile != "" {
+		if err := filter.LoadFENFile(*fenFile); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error loading FEN file %s: %v\n", *fenFile, err)
+			os.Exit(1)
+		}
+	}
+	if *nextMove != "" && filter.PositionMatcher.PatternCount() == 0 {
+		fmt.Fprintf(diagnosticOutput, "Error: --next-move needs a position to match (-Tf, --fen, --fen-file or a FEN or FENPattern line in -t)\n")
+		os.Exit(1)
+	}
+	filter.PositionMatcher.SetPlyFilter(matchPlyFilter())
 
 	return filter
 }
 
+// setupNullMovePolicy selects the null move policy from the null move flags.
+func setupNullMovePolicy(cfg *config.Config) {
+	chosen := 0
+	for _, set := range []bool{*keepNull, *rejectNull, *convertNullToComment} {
+		if set {
+			chosen++
+		}
+	}
+	if chosen > 1 {
+		fmt.Fprintf(diagnosticOutput, "Error: --keep-null, --reject-null and --convert-null-to-comment are mutually exclusive\n")
+		os.Exit(1)
+	}
+
+	switch {
+	case *keepNull:
+		cfg.NullMovePolicy = config.KeepNullMoves
+		cfg.AllowNullMoves = true
+	case *rejectNull:
+		cfg.NullMovePolicy = config.RejectNullMoves
+	case *convertNullToComment:
+		cfg.NullMovePolicy = config.NullMovesToComments
+	default:
+		cfg.NullMovePolicy = config.KeepNullMoves
+	}
+}
+
+// setupDuplicateTagPolicy selects how repeated tags within a game are resolved.
+func setupDuplicateTagPolicy(cfg *config.Config) {
+	policies := map[string]config.DuplicateTagPolicy{
+		"first": config.KeepFirstTag,
+		"last":  config.KeepLastTag,
+		"error": config.RejectDuplicateTags,
+	}
+
+	policy, ok := policies[strings.ToLower(*duplicateTagPolicy)]
+	if !ok {
+		fmt.Fprintf(diagnosticOutput, "Error: unknown duplicate tag policy %q (use first, last or error)\n", *duplicateTagPolicy)
+		os.Exit(1)
+	}
+	if *noDuplicateTagKeys {
+		policy = config.RejectDuplicateTags
+	}
+	cfg.DuplicateTagPolicy = policy
+}
+
+// setupNAGStyle selects how NAGs are written from --nags.
+func setupNAGStyle(cfg *config.Config) {
+	styles := map[string]config.NAGStyle{
+		"":         config.NAGsAsRead,
+		"numeric":  config.NumericNAGs,
+		"symbolic": config.SymbolicNAGs,
+	}
+	style, ok := styles[*nagStyle]
+	if !ok {
+		fmt.Fprintf(diagnosticOutput, "Error: --nags must be numeric or symbolic, not %q\n", *nagStyle)
+		os.Exit(1)
+	}
+	cfg.Output.NAGStyle = style
+}
+
+// setupTimeClassFilter parses the --time-class list.
+func setupTimeClassFilter() {
+	if *timeClassFilter == "" {
+		return
+	}
+
+	classes, err := matching.ParseTimeClasses(*timeClassFilter)
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error parsing time class filter: %v\n", err)
+		os.Exit(1)
+	}
+	timeClassSet = classes
+}
+
+// setupTerminationFilter parses the --termination list.
+func setupTerminationFilter() {
+	if *terminationFilter == "" {
+		return
+	}
+
+	terminations, err := matching.ParseTerminations(*terminationFilter)
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error parsing termination filter: %v\n", err)
+		os.Exit(1)
+	}
+	terminationSet = terminations
+}
+
 // loadVariationMatcher loads variation and position files if specified.
 func loadVariationMatcher() *matching.VariationMatcher {
 	if *variationFile == "" && *positionFile == "" {
@@ -303,14 +924,14 @@ func loadVariationMatcher() *matching.VariationMatcher {
 
 	if *variationFile != "" {
 		if err := matcher.LoadFromFile(*variationFile); err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading variation file %s: %v\n", *variationFile, err)
+			fmt.Fprintf(diagnosticOutput, "Error loading variation file %s: %v\n", *variationFile, err)
 			os.Exit(1)
 		}
 	}
 
 	if *positionFile != "" {
 		if err := matcher.LoadPositionalFromFile(*positionFile); err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading position file %s: %v\n", *positionFile, err)
+			fmt.Fprintf(diagnosticOutput, "Error loading position file %s: %v\n", *positionFile, err)
 			os.Exit(1)
 		}
 	}
@@ -318,15 +939,21 @@ func loadVariationMatcher() *matching.VariationMatcher {
 	return matcher
 }
 
-// loadMaterialMatcher creates a material matcher if specified.
+// loadMaterialMatcher creates a material matcher if specified, limited by
+// --zwindow and --zplies.
 func loadMaterialMatcher() *matching.MaterialMatcher {
-	if *materialMatchExact != "" {
-		return matching.NewMaterialMatcher(*materialMatchExact, true)
-	}
-	if *materialMatch != "" {
-		return matching.NewMaterialMatcher(*materialMatch, false)
+	var mm *matching.MaterialMatcher
+	switch {
+	case *materialMatchExact != "":
+		mm = matching.NewMaterialMatcher(*materialMatchExact, true)
+	case *materialMatch != "":
+		mm = matching.NewMaterialMatcher(*materialMatch, false)
+	default:
+		return nil
 	}
-	return nil
+	mm.SetWindow(materialMoves[0], materialMoves[1])
+	mm.SetMinPlies(*materialPlies)
+	return mm
 }
 
 // parseCQLQuery parses the CQL query from file or command line.
@@ -336,7 +963,7 @@ func parseCQLQuery() cql.Node {
 	if *cqlFile != "" {
 		content, err := os.ReadFile(*cqlFile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading CQL file %s: %v\n", *cqlFile, err)
+			fmt.Fprintf(diagnosticOutput, "Error reading CQL file %s: %v\n", *cqlFile, err)
 			os.Exit(1)
 		}
 		queryStr = strings.TrimSpace(string(content))
@@ -348,13 +975,132 @@ func parseCQLQuery() cql.Node {
 
 	node, err := cql.Parse(queryStr)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing CQL query: %v\n", err)
+		fmt.Fprintf(diagnosticOutput, "Error parsing CQL query: %v\n", err)
 		os.Exit(1)
 	}
 
 	return node
 }
 
+// setupCQLOutput selects what is written for games matched by the CQL query.
+// It returns nil when only the games are written.
+func setupCQLOutput(node cql.Node) *cqlPositionOutput {
+	var games, positions bool
+	switch *cqlOut {
+	case "games":
+		return nil
+	case "positions":
+		positions = true
+	case "both":
+		games, positions = true, true
+	default:
+		fmt.Fprintf(diagnosticOutput, "Error: --cql-output must be games, positions or both, got %q\n", *cqlOut)
+		os.Exit(1)
+	}
+
+	if node == nil {
+		fmt.Fprintf(diagnosticOutput, "Error: --cql-output requires --cql or --cql-file\n")
+		os.Exit(1)
+	}
+
+	name := "cql"
+	if *cqlFile != "" {
+		name = strings.TrimSuffix(filepath.Base(*cqlFile), filepath.Ext(*cqlFile))
+	}
+	return &cqlPositionOutput{name: name, games: games, positions: positions}
+}
+
+// setupCommentInjector loads the --inject-comments file if specified.
+func setupCommentInjector() *commentInjector {
+	if *injectComments == "" {
+		return nil
+	}
+	injector, err := loadCommentInjector(*injectComments)
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error reading comment file %s: %v\n", *injectComments, err)
+		os.Exit(1)
+	}
+	return injector
+}
+
+// setupFeatureExporter creates the --export-features CSV file if specified.
+func setupFeatureExporter() *FeatureExporter {
+	if *exportFeatures == "" {
+		return nil
+	}
+	exporter, err := NewFeatureExporter(*exportFeatures)
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error creating feature file %s: %v\n", *exportFeatures, err)
+		os.Exit(1)
+	}
+	return exporter
+}
+
+// setupIllegalMoveReport creates the --first-illegal-ply CSV file if
+// specified.
+func setupIllegalMoveReport() *IllegalMoveReport {
+	if *firstIllegalPly == "" {
+		return nil
+	}
+	report, err := NewIllegalMoveReport(*firstIllegalPly)
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error creating illegal move report %s: %v\n", *firstIllegalPly, err)
+		os.Exit(1)
+	}
+	return report
+}
+
+// setupPlayerStats creates the --report players collector, or returns nil
+// if no report was requested.
+func setupPlayerStats() *stats.Players {
+	if *reportMode != "players" {
+		return nil
+	}
+	return stats.NewPlayers()
+}
+
+// setupPositionIndex creates the --posindex writer, or returns nil if no
+// index was asked for.
+func setupPositionIndex() *PositionIndexWriter {
+	if *posIndex == "" {
+		return nil
+	}
+	writer, err := NewPositionIndexWriter(*posIndex, *posIndexFormat == "csv")
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error creating position index %s: %v\n", *posIndex, err)
+		os.Exit(1)
+	}
+	return writer
+}
+
+// setupTagEditor creates the tag editor for --addtag, --deletetag and
+// --renametag, or returns nil if there are no edits.
+func setupTagEditor() *tagedit.Editor {
+	editor := &tagedit.Editor{}
+	for _, spec := range *renameTags {
+		if err := editor.Rename(spec); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error: --renametag: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	for _, name := range *deleteTags {
+		if err := editor.Delete(name); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error: --deletetag: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	for _, spec := range *addTags {
+		if err := editor.Add(spec); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error: --addtag: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if editor.Empty() {
+		return nil
+	}
+	return editor
+}
+
 // processAllInputs processes all input files or stdin.
 func processAllInputs(ctx *ProcessingContext, splitWriter *SplitWriter) (totalGames, outputGames, duplicates int) {
 	args := flag.Args()
@@ -363,36 +1109,149 @@ func processAllInputs(ctx *ProcessingContext, splitWriter *SplitWriter) (totalGa
 	if *fileListFile != "" {
 		fileList, err := loadFileList(*fileListFile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading file list %s: %v\n", *fileListFile, err)
+			fmt.Fprintf(diagnosticOutput, "Error loading file list %s: %v\n", *fileListFile, err)
 			os.Exit(1)
 		}
 		// Append file list to command-line args
 		args = append(args, fileList...)
 	}
 
-	if len(args) == 0 {
-		games := processInput(os.Stdin, "stdin", ctx.cfg)
+	args, err := expandInputDirs(args, *inputGlob, *recurse)
+	if err != nil {
+		fmt.Fprintf(diagnosticOutput, "Error reading input directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	headerWritten := *countOnly || *reportMode != "" || (!*keepHeader && *bomMode != "add")
+
+	// Inputs are processed as they are read unless the games of all inputs
+	// are merged or reordered, EventDates are filled in from other games of
+	// their event, or the output is a single JSON document.
+	collect := *interleave || *reconcile || sortKeys != nil
+	stream := !collect && !*fillEventDate && !ctx.cfg.Output.JSONFormat
+
+	if len(args) == 0 && stream {
+		ctx.run.startInputFile()
+		totalGames, outputGames, duplicates = streamInput(os.Stdin, "stdin", ctx, headerWritten)
+	} else if len(args) == 0 {
+		games, header := readInput(os.Stdin, "stdin", ctx.cfg, &ctx.run)
+		if !headerWritten {
+			writeFileHeader(ctx.cfg.OutputFile, header)
+		}
 		totalGames = len(games)
+		games = skipLeadingGames(games)
+		if *reconcile {
+			games = reconcileGames(games, ctx.cfg)
+		}
+		if sortKeys != nil {
+			processing.SortGames(games, sortKeys)
+		}
+		ctx.run.startInputFile()
 		outputGames, duplicates = outputGamesWithProcessing(games, ctx)
 	} else {
-		for _, filename := range args {
-			if *stopAfter > 0 && atomic.LoadInt64(&matchedCount) >= int64(*stopAfter) {
+		var batches [][]*chess.Game
+		progress := newProgressReporter(len(args), ctx.cfg.Verbosity)
+
+		// With --parallel-files, files are read and parsed ahead on up to
+		// --workers goroutines and taken back in argument order.
+		var ahead *fileReadAhead
+		if *parallelFiles {
+			numWorkers := *workers
+			if numWorkers <= 0 {
+				numWorkers = runtime.NumCPU()
+			}
+			ahead = newFileReadAhead(args, numWorkers, ctx.cfg)
+			defer ahead.stop()
+		}
+
+		for i, filename := range args {
+			if *stopAfter > 0 && ctx.run.matched.Load() >= int64(*stopAfter) {
 				break
 			}
+			progress.file(i+1, filename)
+
+			var games []*chess.Game
+			var header parser.FileHeader
+			if ahead != nil {
+				pf := ahead.next()
+				if pf.err != nil {
+					fmt.Fprintf(diagnosticOutput, "Error opening file %s: %v\n", filename, pf.err)
+					continue
+				}
+				ctx.cfg.CurrentInputFile = filename
+				ctx.run.addInputFile(filename)
+				pf.in.finish(&ctx.run)
+				games, header = pf.games, pf.in.Header()
+			} else {
+				file, err := openInputFile(filename)
+				if err != nil {
+					fmt.Fprintf(diagnosticOutput, "Error opening file %s: %v\n", filename, err)
+					continue
+				}
+				ctx.run.addInputFile(filename)
+
+				if stream {
+					ctx.run.startInputFile()
+					total, out, dup := streamInput(file, filename, ctx, headerWritten)
+					_ = file.Close() // cleanup on exit
+					headerWritten = true
+					totalGames += total
+					outputGames += out
+					duplicates += dup
+					continue
+				}
+
+				games, header = readInput(file, filename, ctx.cfg, &ctx.run)
+				_ = file.Close() // cleanup on exit
+			}
+			if !headerWritten {
+				writeFileHeader(ctx.cfg.OutputFile, header)
+				headerWritten = true
+			}
+			totalGames += len(games)
 
-			file, err := os.Open(filename) //nolint:gosec // G304: CLI tool opens user-specified files
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error opening file %s: %v\n", filename, err)
+			if collect {
+				batches = append(batches, skipLeadingGames(games))
 				continue
 			}
-
-			games := processInput(file, filename, ctx.cfg)
-			totalGames += len(games)
-			out, dup := outputGamesWithProcessing(games, ctx)
+			ctx.run.startInputFile()
+			out, dup := outputGamesWithProcessing(skipLeadingGames(games), ctx)
 			outputGames += out
 			duplicates += dup
+		}
+		if collect {
+			var games []*chess.Game
+			if *interleave {
+				games = interleaveGames(batches)
+			} else {
+				for _, batch := range batches {
+					games = append(games, batch...)
+				}
+			}
+			if *reconcile {
+				games = reconcileGames(games, ctx.cfg)
+			}
+			if sortKeys != nil {
+				processing.SortGames(games, sortKeys)
+			}
+			ctx.run.startInputFile()
+			outputGames, duplicates = outputGamesWithProcessing(games, ctx)
+		}
+		progress.done()
+		if *countPerFile {
+			for _, filename := range ctx.run.files {
+				fmt.Printf("%s: %d\n", filename, ctx.run.fileMatched[filename])
+			}
+		}
+	}
+
+	if ctx.deferred != nil {
+		ctx.deferred.flush(ctx)
+	}
 
-			_ = file.Close() // cleanup on exit
+	if ctx.playerStats != nil {
+		if err := ctx.playerStats.Write(ctx.cfg.OutputFile, *reportFormat); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing player report: %v\n", err)
 		}
 	}
 
@@ -402,23 +1261,96 @@ func processAllInputs(ctx *ProcessingContext, splitWriter *SplitWriter) (totalGa
 
 	// Close ECO split writer if used
 	if ctx.ecoSplitWriter != nil {
-		ctx.ecoSplitWriter.Close() //nolint:errcheck,gosec // cleanup on exit
+		if err := ctx.ecoSplitWriter.Close(); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing ECO split files: %v\n", err)
+		}
+	}
+
+	if ctx.resultSplit != nil {
+		ctx.resultSplit.Close() //nolint:errcheck,gosec // cleanup on exit
+	}
+
+	if ctx.dateSplit != nil {
+		if err := ctx.dateSplit.Close(); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing date split files: %v\n", err)
+		}
+	}
+
+	if ctx.playerSplit != nil {
+		if err := ctx.playerSplit.Close(); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing player split files: %v\n", err)
+		}
+	}
+
+	if ctx.featureExport != nil {
+		if err := ctx.featureExport.Close(); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing feature file %s: %v\n", *exportFeatures, err)
+		}
+	}
+
+	if ctx.illegalReport != nil {
+		if err := ctx.illegalReport.Close(ctx.cfg.LogFile, ctx.cfg.Verbosity > 0); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing illegal move report %s: %v\n", *firstIllegalPly, err)
+		}
+	}
+
+	if ctx.seen != nil {
+		ctx.seen.report(diagnosticOutput)
+	}
+
+	if ctx.alsoFilter != nil {
+		if err := ctx.alsoFilter.Close(diagnosticOutput); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing --also-output file %s: %v\n", *alsoOutput, err)
+		}
+	}
+
+	if ctx.engineEval != nil {
+		ctx.engineEval.Close(ctx.cfg.LogFile, ctx.cfg.Verbosity > 0)
+	}
+
+	if ctx.posIndex != nil {
+		if err := ctx.posIndex.Close(); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing position index %s: %v\n", *posIndex, err)
+		}
+	}
+
+	if aw := ctx.asyncOutput; aw != nil {
+		if err := aw.Close(); err != nil {
+			ctx.run.outputErrors.Add(1)
+			fmt.Fprintf(diagnosticOutput, "Error writing output file %s: %v\n", *outputFile, err)
+		}
+		recordWriteStalls(aw.stalls, aw.stallTime)
 	}
 
 	return totalGames, outputGames, duplicates
 }
 
 // reportStatistics prints the final statistics to stderr.
-func reportStatistics(detector hashing.DuplicateChecker, outputGames, duplicates, totalGames int) {
-	if detector != nil {
-		fmt.Fprintf(os.Stderr, "%d game(s) output, %d duplicate(s) out of %d.\n", outputGames, duplicates, totalGames)
+func reportStatistics(detector hashing.DuplicateChecker, rs *runStats, outputGames, duplicates, totalGames int) {
+	if detector != nil && (*fuzzyDup > 0 || *fuzzyDepth > 0) {
+		fmt.Fprintf(diagnosticOutput, "%d game(s) output, %d near-duplicate(s) out of %d.\n", outputGames, duplicates, totalGames)
+	} else if detector != nil {
+		fmt.Fprintf(diagnosticOutput, "%d game(s) output, %d duplicate(s) out of %d.\n", outputGames, duplicates, totalGames)
 	} else {
-		fmt.Fprintf(os.Stderr, "%d game(s) matched out of %d.\n", outputGames, totalGames)
+		fmt.Fprintf(diagnosticOutput, "%d game(s) matched out of %d.\n", outputGames, totalGames)
+	}
+	if n := rs.duplicateTags.Load(); n > 0 {
+		fmt.Fprintf(diagnosticOutput, "%d repeated tag(s) found.\n", n)
+	}
+	if n := rs.illegalCastling.Load(); n > 0 {
+		if *legality == "strict" {
+			fmt.Fprintf(diagnosticOutput, "%d game(s) with illegal castling rejected.\n", n)
+		} else {
+			fmt.Fprintf(diagnosticOutput, "%d game(s) with illegal castling kept with warnings.\n", n)
+		}
 	}
 }
 
 func usage() {
-	fmt.Fprintf(os.Stderr, "Usage: pgn-extract [options] [input-files...]\n\n")
+	fmt.Fprintf(os.Stderr, "Usage: pgn-extract [options] [input-files...]\n")
+	fmt.Fprintf(os.Stderr, "       pgn-extract diff [-json] [-all] a.pgn b.pgn\n")
+	fmt.Fprintf(os.Stderr, "       pgn-extract index build [-o games.idx] games.pgn\n")
+	fmt.Fprintf(os.Stderr, "       pgn-extract index query -fen FEN [-list] games.idx\n\n")
 	fmt.Fprintf(os.Stderr, "A tool for manipulating chess games in PGN format.\n\n")
 	fmt.Fprintf(os.Stderr, "Options:\n")
 	flag.PrintDefaults()
@@ -428,6 +1360,7 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  halg   Hyphenated long algebraic (e2-e4)\n")
 	fmt.Fprintf(os.Stderr, "  elalg  Enhanced long algebraic (Ng1f3)\n")
 	fmt.Fprintf(os.Stderr, "  uci    UCI format\n")
+	fmt.Fprintf(os.Stderr, "  san+uci  SAN with the UCI move (Nf3/g1f3), see --san-uci-separator\n")
 	fmt.Fprintf(os.Stderr, "  epd    Extended Position Description\n")
 	fmt.Fprintf(os.Stderr, "  fen    FEN sequence\n")
 }
@@ -521,6 +1454,40 @@ func loadFileList(filename string) ([]string, error) {
 	return files, nil
 }
 
+// expandInputDirs replaces each directory in args with the files in it
+// whose names match pattern, in lexical order, descending into
+// subdirectories if recurse is set. Other arguments are kept as they are.
+func expandInputDirs(args []string, pattern string, recurse bool) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil || !info.IsDir() {
+			// A missing file is reported when it is opened
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != arg && !recurse {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if ok, _ := filepath.Match(pattern, d.Name()); ok { //nolint:errcheck // pattern is validated at startup
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
 // loadArgsFromFileIfSpecified scans os.Args for -A flag and loads args from file if found.
 // This must happen before flag.Parse() to inject file arguments.
 func loadArgsFromFileIfSpecified() []string {
@@ -540,7 +1507,7 @@ func loadArgsFromFileIfSpecified() []string {
 
 		args, err := loadArgsFile(filename)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading arguments file %s: %v\n", filename, err)
+			fmt.Fprintf(diagnosticOutput, "Error loading arguments file %s: %v\n", filename, err)
 			os.Exit(1)
 		}
 		return args
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -88,6 +90,48 @@ func TestLoadArgsFile(t *testing.T) {
 	})
 }
 
+func TestExpandInputDirs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.pgn", "a.pgn", "notes.txt", "sub/c.pgn", "sub/deeper/d.pgn"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	in := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name    string
+		pattern string
+		recurse bool
+		want    []string
+	}{
+		{"top level only", "*.pgn", false, append([]string{"x.pgn"}, in("a.pgn", "b.pgn")...)},
+		{"recursive", "*.pgn", true, append([]string{"x.pgn"}, in("a.pgn", "b.pgn", "sub/c.pgn", "sub/deeper/d.pgn")...)},
+		{"other pattern", "*.txt", true, append([]string{"x.pgn"}, in("notes.txt")...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandInputDirs([]string{"x.pgn", dir}, tt.pattern, tt.recurse)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandInputDirs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestLoadFileList(t *testing.T) {
 	t.Run("valid file list", func(t *testing.T) {
 		dir := t.TempDir()
@@ -141,12 +185,12 @@ func TestReportStatistics(t *testing.T) {
 	t.Run("with detector", func(t *testing.T) {
 		detector := hashing.NewDuplicateDetector(false, 0)
 		// Just verify no panic
-		reportStatistics(detector, 10, 2, 15)
+		reportStatistics(detector, &runStats{}, 10, 2, 15)
 	})
 
 	t.Run("without detector", func(t *testing.T) {
 		// Just verify no panic
-		reportStatistics(nil, 10, 0, 15)
+		reportStatistics(nil, &runStats{}, 10, 0, 15)
 	})
 }
 
@@ -527,3 +571,27 @@ func TestLoadArgsFromFileIfSpecified(t *testing.T) {
 		}
 	})
 }
+
+func TestColourWriter(t *testing.T) {
+	var buf bytes.Buffer
+	cw := &colourWriter{w: &buf}
+	fmt.Fprintf(cw, "Unknown move text Qz9 on line %d.\n", 3)
+	fmt.Fprintf(cw, "Error parsing %s: %s\n", "a.pgn", "bad")
+	fmt.Fprintf(cw, "Loaded %d ECO entries\n", 10)
+	fmt.Fprintf(cw, "%d game(s) with illegal castling rejected.\n", 2)
+
+	want := ansiClearLine + ansiYellow + "Unknown move text Qz9 on line 3." + ansiReset + "\n" +
+		ansiClearLine + ansiRed + "Error parsing a.pgn: bad" + ansiReset + "\n" +
+		ansiClearLine + "Loaded 10 ECO entries\n" +
+		ansiClearLine + "2 game(s) with illegal castling rejected.\n"
+	if got := buf.String(); got != want {
+		t.Errorf("colourWriter output = %q, want %q", got, want)
+	}
+}
+
+func TestUseColourDisabled(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	if useColour(os.Stderr) {
+		t.Error("useColour() = true with NO_COLOR set")
+	}
+}
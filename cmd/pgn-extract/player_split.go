@@ -0,0 +1,74 @@
+// player_split.go - Splitting output by player
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+)
+
+// PlayerSplitWriter writes each game to the files of both its players,
+// named by surname: base_carlsen.pgn. Players without a name go to
+// base_unknown.pgn.
+// NOT thread-safe: Only accessed from the single result-consumer goroutine.
+type PlayerSplitWriter struct {
+	*splitFiles
+	baseName string
+	cfg      *config.Config
+}
+
+// NewPlayerSplitWriter creates a player split writer.
+func NewPlayerSplitWriter(baseName string, cfg *config.Config, maxHandles int) *PlayerSplitWriter {
+	return &PlayerSplitWriter{
+		splitFiles: newSplitFiles(maxHandles),
+		baseName:   baseName,
+		cfg:        cfg,
+	}
+}
+
+// WriteGame writes a game to the file of White and, if they differ, to the
+// file of Black.
+func (pw *PlayerSplitWriter) WriteGame(game *chess.Game) error {
+	white, black := playerSurname(game.White()), playerSurname(game.Black())
+	if err := pw.writeGame(game, pw.cfg, white, pw.filename); err != nil {
+		return err
+	}
+	if black == white {
+		return nil
+	}
+	return pw.writeGame(game, pw.cfg, black, pw.filename)
+}
+
+// playerSurname returns the surname of a player, lowercased with any
+// punctuation removed and words joined by hyphens, for use in a file name:
+// "Carlsen, Magnus" and "Magnus Carlsen" are both "carlsen", and
+// "Van Wely, Loek" is "van-wely". Without a comma the last word is taken as
+// the surname.
+func playerSurname(name string) string {
+	surname, _, found := strings.Cut(name, ",")
+	if !found {
+		fields := strings.Fields(name)
+		if len(fields) > 0 {
+			surname = fields[len(fields)-1]
+		}
+	}
+	words := strings.FieldsFunc(strings.ToLower(surname), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return "unknown"
+	}
+	return strings.Join(words, "-")
+}
+
+func (pw *PlayerSplitWriter) filename(key string) (string, error) {
+	return fmt.Sprintf("%s_%s.pgn", pw.baseName, key), nil
+}
+
+// Close closes all open files.
+func (pw *PlayerSplitWriter) Close() error {
+	return pw.closeAll()
+}
@@ -0,0 +1,73 @@
+// posindex.go - Position hash index of the games written
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/index"
+)
+
+// PositionIndexWriter indexes the starting position of each game written
+// and the position after each main-line move, up to the first move that
+// cannot be played. Games are numbered from 1 in the order they are
+// written. The binary format is a position index with no source file, as
+// read by "index query -list" and --reference; it is written on Close.
+// The CSV format has a game,ply,hash row per position.
+// NOT thread-safe: Only accessed from the single result-consumer goroutine.
+type PositionIndexWriter struct {
+	file    *os.File
+	w       *bufio.Writer
+	csv     bool
+	games   int
+	builder index.Builder
+}
+
+// NewPositionIndexWriter creates the index file, writing the header row
+// of the CSV format.
+func NewPositionIndexWriter(filename string, csv bool) (*PositionIndexWriter, error) {
+	file, err := os.Create(filename) //nolint:gosec // G304: filename is user-specified
+	if err != nil {
+		return nil, err
+	}
+	pw := &PositionIndexWriter{file: file, w: bufio.NewWriter(file), csv: csv}
+	if csv {
+		if _, err := pw.w.WriteString("game,ply,hash\n"); err != nil {
+			_ = file.Close() // already failing
+			return nil, err
+		}
+	}
+	return pw, nil
+}
+
+// WriteGame indexes the positions of a game.
+func (pw *PositionIndexWriter) WriteGame(game *chess.Game) error {
+	pw.games++
+	if !pw.csv {
+		pw.builder.Add(game, 0)
+		return nil
+	}
+	var err error
+	index.Positions(game, func(ply int, hash uint64) bool {
+		_, err = fmt.Fprintf(pw.w, "%d,%d,%016x\n", pw.games, ply, hash)
+		return err == nil
+	})
+	return err
+}
+
+// Close writes the binary index, flushes and closes the file.
+func (pw *PositionIndexWriter) Close() error {
+	var err error
+	if !pw.csv {
+		err = pw.builder.Write(pw.w, index.Source{})
+	}
+	if err == nil {
+		err = pw.w.Flush()
+	}
+	if closeErr := pw.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -2,21 +2,36 @@
 package main
 
 import (
+	"bytes"
 	"container/list"
+	"context"
+	"encoding/csv"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
 	"github.com/lgbarn/pgn-extract-go/internal/config"
 	"github.com/lgbarn/pgn-extract-go/internal/cql"
 	"github.com/lgbarn/pgn-extract-go/internal/eco"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
 	"github.com/lgbarn/pgn-extract-go/internal/hashing"
+	"github.com/lgbarn/pgn-extract-go/internal/index"
 	"github.com/lgbarn/pgn-extract-go/internal/matching"
 	"github.com/lgbarn/pgn-extract-go/internal/output"
 	"github.com/lgbarn/pgn-extract-go/internal/parser"
+	"github.com/lgbarn/pgn-extract-go/internal/processing"
+	"github.com/lgbarn/pgn-extract-go/internal/scid"
+	"github.com/lgbarn/pgn-extract-go/internal/stats"
+	"github.com/lgbarn/pgn-extract-go/internal/tagedit"
+	"github.com/lgbarn/pgn-extract-go/internal/webpgn"
 	"github.com/lgbarn/pgn-extract-go/internal/worker"
 )
 
@@ -36,11 +51,30 @@ type ProcessingContext struct {
 	detector         hashing.DuplicateChecker
 	setupDetector    *hashing.SetupDuplicateDetector
 	ecoClassifier    *eco.ECOClassifier
+	reference        *index.Index
 	gameFilter       *matching.GameFilter
 	cqlNode          cql.Node
+	cqlOutput        *cqlPositionOutput
 	variationMatcher *matching.VariationMatcher
 	materialMatcher  *matching.MaterialMatcher
 	ecoSplitWriter   *ECOSplitWriter
+	resultSplit      *ResultSplitWriter
+	dateSplit        *DateSplitWriter
+	playerSplit      *PlayerSplitWriter
+	commentInjector  *commentInjector
+	featureExport    *FeatureExporter
+	illegalReport    *IllegalMoveReport
+	posIndex         *PositionIndexWriter
+	asyncOutput      *asyncWriter
+	deferred         *deferredOriginals
+	uniqueBy         *uniqueKeyFilter
+	seen             *seenGames
+	tagEditor        *tagedit.Editor
+	playerStats      *stats.Players
+	alsoFilter       *alsoFilter
+	engineEval       *engineAnnotator
+	rendered         *bytes.Buffer // worker-rendered text of the game being output, if any
+	run              runStats
 }
 
 // SplitWriter handles writing to multiple output files.
@@ -101,137 +135,110 @@ func (sw *SplitWriter) Close() error {
 
 // lruFileEntry represents an entry in the LRU file handle cache.
 type lruFileEntry struct {
-	ecoPrefix string
-	file      *os.File
-	element   *list.Element
+	key      string
+	filename string
+	games    int
+	file     *os.File
+	element  *list.Element
 }
 
-// ECOSplitWriter writes games to different files based on ECO code.
+// splitFiles is the LRU file handle cache shared by the writers splitting
+// output into files by a key, such as the ECO code or the date. At most
+// maxHandles files are kept open; a file evicted from the cache is reopened
+// for appending when written to again.
 // NOT thread-safe: Only accessed from the single result-consumer goroutine in outputGamesParallel.
-type ECOSplitWriter struct {
-	baseName   string
-	level      int // 1=A-E, 2=A0-E9, 3=A00-E99
+type splitFiles struct {
 	files      map[string]*lruFileEntry
-	cfg        *config.Config
 	lruList    *list.List
 	maxHandles int
 }
 
-// NewECOSplitWriter creates a new ECO-based split writer.
-func NewECOSplitWriter(baseName string, level int, cfg *config.Config, maxHandles int) *ECOSplitWriter {
+// newSplitFiles creates a file handle cache, defaulting to 128 handles.
+func newSplitFiles(maxHandles int) *splitFiles {
 	if maxHandles <= 0 {
 		maxHandles = 128
 	}
-	return &ECOSplitWriter{
-		baseName:   baseName,
-		level:      level,
+	return &splitFiles{
 		files:      make(map[string]*lruFileEntry),
-		cfg:        cfg,
 		lruList:    list.New(),
 		maxHandles: maxHandles,
 	}
 }
 
-// WriteGame writes a game to the appropriate ECO-based file.
-func (ew *ECOSplitWriter) WriteGame(game *chess.Game) error {
-	ecoCode := ew.getECOPrefix(game)
-	file, err := ew.getOrCreateFile(ecoCode)
+// writeGame writes a game to the file for key, creating the file named by
+// filename the first time the key is seen.
+func (sf *splitFiles) writeGame(game *chess.Game, cfg *config.Config, key string, filename func(key string) (string, error)) error {
+	file, err := sf.getOrCreateFile(key, filename)
 	if err != nil {
 		return err
 	}
 
-	// Temporarily redirect output to this file
-	originalOutput := ew.cfg.OutputFile
-	ew.cfg.OutputFile = file
-	output.OutputGame(game, ew.cfg)
-	ew.cfg.OutputFile = originalOutput
+	withOutputFile(cfg, file, func() {
+		output.OutputGame(game, cfg)
+	})
+	sf.files[key].games++
 
 	return nil
 }
 
-// getECOPrefix extracts the ECO prefix based on the configured level.
-func (ew *ECOSplitWriter) getECOPrefix(game *chess.Game) string {
-	eco := game.ECO()
-	if eco == "" {
-		return "unknown"
-	}
-
-	switch ew.level {
-	case 1:
-		// Just the letter: A, B, C, D, E
-		if len(eco) >= 1 {
-			return string(eco[0])
-		}
-	case 2:
-		// Letter + first digit: A0, A1, ..., E9
-		if len(eco) >= 2 {
-			return eco[:2]
-		}
-	case 3:
-		// Full code: A00, A01, ..., E99
-		if len(eco) >= 3 {
-			return eco[:3]
-		}
-	}
-
-	return eco
-}
-
-// getOrCreateFile gets an existing file or creates a new one for the given ECO prefix.
+// getOrCreateFile gets an existing file or creates a new one for the given key.
 // Uses LRU cache to limit open file handles.
-func (ew *ECOSplitWriter) getOrCreateFile(ecoPrefix string) (*os.File, error) {
-	entry, exists := ew.files[ecoPrefix]
+func (sf *splitFiles) getOrCreateFile(key string, filename func(key string) (string, error)) (*os.File, error) {
+	entry, exists := sf.files[key]
 
 	// Case 1: Entry exists and file is open
 	if exists && entry.file != nil {
 		// Move to front (most recently used)
-		ew.lruList.MoveToFront(entry.element)
+		sf.lruList.MoveToFront(entry.element)
 		return entry.file, nil
 	}
 
-	filename := fmt.Sprintf("%s_%s.pgn", ew.baseName, ecoPrefix)
-
 	// Case 2: Entry exists but file was evicted (closed) - reopen in append mode
 	if exists && entry.file == nil {
-		file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644) //nolint:gosec // G304: filename is derived from user-specified base name, G302: 0644 is appropriate for user-created output files
+		file, err := os.OpenFile(entry.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644) //nolint:gosec // G304: filename is derived from user-specified base name, G302: 0644 is appropriate for user-created output files
 		if err != nil {
 			return nil, err
 		}
 		entry.file = file
 		// Re-add to LRU list (element was removed during eviction)
-		entry.element = ew.lruList.PushFront(entry)
-		ew.evictIfNeeded()
+		entry.element = sf.lruList.PushFront(entry)
+		sf.evictIfNeeded()
 		return file, nil
 	}
 
 	// Case 3: New entry - create file
-	file, err := os.Create(filename) //nolint:gosec // G304: filename is derived from user-specified base name
+	name, err := filename(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Create(name) //nolint:gosec // G304: filename is derived from user-specified base name
 	if err != nil {
 		return nil, err
 	}
 
 	// Create new entry and add to front of LRU list
 	newEntry := &lruFileEntry{
-		ecoPrefix: ecoPrefix,
-		file:      file,
+		key:      key,
+		filename: name,
+		file:     file,
 	}
-	newEntry.element = ew.lruList.PushFront(newEntry)
-	ew.files[ecoPrefix] = newEntry
+	newEntry.element = sf.lruList.PushFront(newEntry)
+	sf.files[key] = newEntry
 
 	// Evict least recently used if we've exceeded maxHandles
-	ew.evictIfNeeded()
+	sf.evictIfNeeded()
 
 	return file, nil
 }
 
 // evictIfNeeded evicts the least recently used file handle if we've exceeded maxHandles.
-func (ew *ECOSplitWriter) evictIfNeeded() {
-	if ew.lruList.Len() <= ew.maxHandles {
+func (sf *splitFiles) evictIfNeeded() {
+	if sf.lruList.Len() <= sf.maxHandles {
 		return
 	}
 
 	// Evict from back (least recently used)
-	back := ew.lruList.Back()
+	back := sf.lruList.Back()
 	if back == nil {
 		return
 	}
@@ -246,46 +253,329 @@ func (ew *ECOSplitWriter) evictIfNeeded() {
 	}
 
 	// Remove from LRU list but keep entry in map for potential reopen
-	ew.lruList.Remove(back)
+	sf.lruList.Remove(back)
 	entry.element = nil // Defensive: element is no longer in the list
 }
 
-// Close closes all open files.
-func (ew *ECOSplitWriter) Close() error {
+// closeAll closes all open files.
+func (sf *splitFiles) closeAll() error {
 	var lastErr error
-	for _, entry := range ew.files {
+	for _, entry := range sf.files {
 		if entry.file != nil {
 			if err := entry.file.Close(); err != nil {
 				lastErr = err
 			}
+			entry.file = nil
 		}
 	}
 	return lastErr
 }
 
 // FileCount returns the number of files created.
-func (ew *ECOSplitWriter) FileCount() int {
-	return len(ew.files)
+func (sf *splitFiles) FileCount() int {
+	return len(sf.files)
 }
 
 // OpenHandleCount returns the number of currently open file handles.
-func (ew *ECOSplitWriter) OpenHandleCount() int {
-	return ew.lruList.Len()
+func (sf *splitFiles) OpenHandleCount() int {
+	return sf.lruList.Len()
+}
+
+// ECOSplitWriter writes games to different files based on ECO code.
+// NOT thread-safe: Only accessed from the single result-consumer goroutine in outputGamesParallel.
+type ECOSplitWriter struct {
+	*splitFiles
+	baseName string
+	level    int // 1=A-E, 2=A0-E9, 3=A00-E99
+	cfg      *config.Config
+	dir      string // --split-dir, or "" to write next to baseName
+}
+
+// NewECOSplitWriter creates a new ECO-based split writer.
+func NewECOSplitWriter(baseName string, level int, cfg *config.Config, maxHandles int) *ECOSplitWriter {
+	return &ECOSplitWriter{
+		splitFiles: newSplitFiles(maxHandles),
+		baseName:   baseName,
+		level:      level,
+		cfg:        cfg,
+	}
+}
+
+// SetDir places the split files in dir, creating it, with each ECO class
+// A-E in a subdirectory of its own and an index.csv of code, file and game
+// count written on Close.
+func (ew *ECOSplitWriter) SetDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil { //nolint:gosec // G301: 0755 is appropriate for user-created output directories
+		return err
+	}
+	ew.dir = dir
+	return nil
+}
+
+// WriteGame writes a game to the appropriate ECO-based file.
+func (ew *ECOSplitWriter) WriteGame(game *chess.Game) error {
+	return ew.writeGame(game, ew.cfg, ew.getECOPrefix(game), ew.filename)
+}
+
+// getECOPrefix extracts the ECO prefix based on the configured level.
+func (ew *ECOSplitWriter) getECOPrefix(game *chess.Game) string {
+	eco := game.ECO()
+	if eco == "" {
+		return "unknown"
+	}
+
+	switch ew.level {
+	case 1:
+		// Just the letter: A, B, C, D, E
+		if len(eco) >= 1 {
+			return string(eco[0])
+		}
+	case 2:
+		// Letter + first digit: A0, A1, ..., E9
+		if len(eco) >= 2 {
+			return eco[:2]
+		}
+	case 3:
+		// Full code: A00, A01, ..., E99
+		if len(eco) >= 3 {
+			return eco[:3]
+		}
+	}
+
+	return eco
+}
+
+// filename returns the file for an ECO prefix, creating its class
+// subdirectory under the --split-dir directory.
+func (ew *ECOSplitWriter) filename(ecoPrefix string) (string, error) {
+	if ew.dir == "" {
+		return fmt.Sprintf("%s_%s.pgn", ew.baseName, ecoPrefix), nil
+	}
+	dir := ew.dir
+	if class := ecoPrefix[0]; class >= 'A' && class <= 'E' {
+		dir = filepath.Join(dir, string(class))
+		if err := os.MkdirAll(dir, 0755); err != nil { //nolint:gosec // G301: 0755 is appropriate for user-created output directories
+			return "", err
+		}
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s_%s.pgn", filepath.Base(ew.baseName), ecoPrefix)), nil
+}
+
+// Close closes all open files and, with a --split-dir directory, writes
+// its index.
+func (ew *ECOSplitWriter) Close() error {
+	lastErr := ew.closeAll()
+	if ew.dir != "" {
+		if err := ew.writeIndex(); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// writeIndex writes index.csv in the --split-dir directory: a row of ECO
+// code, file (relative to the directory) and game count per split file.
+func (ew *ECOSplitWriter) writeIndex() error {
+	codes := make([]string, 0, len(ew.files))
+	for code := range ew.files {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	// Write errors stick to cw and are reported by Error after Flush
+	_ = cw.Write([]string{"eco", "file", "games"})
+	for _, code := range codes {
+		entry := ew.files[code]
+		rel, err := filepath.Rel(ew.dir, entry.filename)
+		if err != nil {
+			rel = entry.filename
+		}
+		_ = cw.Write([]string{code, filepath.ToSlash(rel), strconv.Itoa(entry.games)})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(ew.dir, "index.csv"), buf.Bytes(), 0644) //nolint:gosec // G306: 0644 is appropriate for user-created output files
 }
 
 // processInput parses games from a reader
 func processInput(r io.Reader, name string, cfg *config.Config) []*chess.Game {
+	games, _ := readInput(r, name, cfg, nil)
+	return games
+}
+
+// readInput parses games from a reader and returns them together with the
+// header that preceded the first game. Parser counters are added to rs
+// unless it is nil.
+func readInput(r io.Reader, name string, cfg *config.Config, rs *runStats) ([]*chess.Game, parser.FileHeader) {
+	in := newInputReader(r, name, cfg)
+	games := in.next(0)
+	in.finish(rs)
+	return games, in.Header()
+}
+
+// inputBatchSize is how many games streamInput reads before processing
+// them.
+const inputBatchSize = 1000
+
+// streamInput reads an input in batches of games and processes each batch
+// before reading on, so that memory use does not grow with the input. It
+// writes the input's header first unless headerWritten, skips the first
+// --per-file-skip games and stops reading once the match limit is reached.
+// It returns the number of games read and the output and duplicate counts.
+func streamInput(r io.Reader, name string, ctx *ProcessingContext, headerWritten bool) (total, out, dup int) {
+	in := newInputReader(r, name, ctx.cfg)
+	defer in.finish(&ctx.run)
+
+	skip := *perFileSkip
+	for !ctx.run.matchLimitReached() {
+		games := in.next(inputBatchSize)
+		if len(games) == 0 {
+			break
+		}
+		if !headerWritten {
+			writeFileHeader(ctx.cfg.OutputFile, in.Header())
+			headerWritten = true
+		}
+		total += len(games)
+		if skip > 0 {
+			n := min(skip, len(games))
+			games, skip = games[n:], skip-n
+		}
+		o, d := outputGamesWithProcessing(games, ctx)
+		out += o
+		dup += d
+	}
+	if !headerWritten {
+		writeFileHeader(ctx.cfg.OutputFile, in.Header())
+	}
+	return total, out, dup
+}
+
+// inputReader reads the games of one input, pulling them out of a web page
+// with --extract-from, numbering them, repairing castling written as king
+// takes rook and timing the work for --debug-stats.
+type inputReader struct {
+	*parser.GameReader
+	name string
+	cfg  *config.Config
+	done bool
+
+	read      int
+	repaired  int
+	parseTime time.Duration
+	fixTime   time.Duration
+}
+
+// newInputReader opens an input for reading and makes it the current input.
+func newInputReader(r io.Reader, name string, cfg *config.Config) *inputReader {
 	cfg.CurrentInputFile = name
+	return openInput(r, name, cfg)
+}
 
-	p := parser.NewParser(r, cfg)
-	games, err := p.ParseAllGames()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing %s: %v\n", name, err)
+// openInputFile opens an input file: a PGN file, or a Scid database named
+// by one of its files, read as the PGN text of its games. Scid games that
+// cannot be decoded are reported and skipped.
+func openInputFile(filename string) (io.ReadCloser, error) {
+	if scid.IsDatabase(filename) {
+		r, err := scid.OpenReader(filename, func(err error) {
+			fmt.Fprintf(diagnosticOutput, "Error reading %s: %v\n", filename, err)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	return os.Open(filename) //nolint:gosec // G304: CLI tool opens user-specified files
+}
+
+// openInput opens an input for reading without making it the current
+// input, so that it can be read on another goroutine.
+func openInput(r io.Reader, name string, cfg *config.Config) *inputReader {
+	if *extractFrom != "" {
+		data, err := webpgn.Extract(r, *extractFrom)
+		if err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error reading %s: %v\n", name, err)
+		}
+		r = bytes.NewReader(data)
+	}
+	return &inputReader{GameReader: parser.NewGameReader(r, cfg), name: name, cfg: cfg}
+}
+
+// next reads up to limit games, or all remaining games if limit is not
+// positive. It returns none at the end of the input; a parse error is
+// reported and ends it.
+func (in *inputReader) next(limit int) []*chess.Game {
+	var games []*chess.Game
+	start := time.Now()
+	for !in.done && (limit <= 0 || len(games) < limit) {
+		game, err := in.Next()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(diagnosticOutput, "Error parsing %s: %v\n", in.name, err)
+			}
+			in.done = true
+			break
+		}
+		in.read++
+		game.SourceFile = in.name
+		game.SourceIndex = in.read
+		games = append(games, game)
 	}
+	parsed := time.Now()
 
+	for _, game := range games {
+		in.repaired += engine.RepairRookSquareCastling(game)
+	}
+	in.parseTime += parsed.Sub(start)
+	in.fixTime += time.Since(parsed)
 	return games
 }
 
+// finish adds the input's parser counters to rs, unless it is nil, and
+// reports its repairs.
+func (in *inputReader) finish(rs *runStats) {
+	if rs != nil {
+		rs.duplicateTags.Add(int64(in.DuplicateTagCount()))
+	}
+	if *debugStats {
+		recordParse(in.Stats(), in.parseTime, in.fixTime)
+	}
+	if in.repaired > 0 && in.cfg.Verbosity > 0 {
+		fmt.Fprintf(in.cfg.LogFile, "%s: %d castling move(s) written as king takes rook repaired.\n", in.name, in.repaired)
+	}
+}
+
+// writeFileHeader writes a preserved input header: the byte order mark,
+// then each %-line or comment, then a blank line. The header is only kept
+// with --keep-header, and --bom adds or strips the byte order mark.
+func writeFileHeader(w io.Writer, header parser.FileHeader) {
+	if w == nil {
+		return
+	}
+	if !*keepHeader {
+		header = parser.FileHeader{}
+	}
+	switch *bomMode {
+	case "add":
+		header.BOM = true
+	case "strip":
+		header.BOM = false
+	}
+	if header.BOM {
+		fmt.Fprint(w, "\xEF\xBB\xBF")
+	}
+	for _, line := range header.Lines {
+		fmt.Fprintln(w, line)
+	}
+	if len(header.Lines) > 0 {
+		fmt.Fprintln(w)
+	}
+}
+
 // outputGamesWithProcessing outputs games with optional filtering, ECO classification, and duplicate detection.
 // Returns the number of games output and the number of duplicates found.
 func outputGamesWithProcessing(games []*chess.Game, ctx *ProcessingContext) (int, int) {
@@ -294,8 +584,24 @@ func outputGamesWithProcessing(games []*chess.Game, ctx *ProcessingContext) (int
 		numWorkers = runtime.NumCPU()
 	}
 
-	// Use parallel processing for multiple workers and enough games
-	if numWorkers > 1 && len(games) > 2 {
+	if ctx.illegalReport != nil {
+		if err := ctx.illegalReport.check(games); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing illegal move report: %v\n", err)
+		}
+	}
+
+	if *fillEventDate {
+		if filled := fillEventDates(games); filled > 0 && ctx.cfg.Verbosity > 0 {
+			fmt.Fprintf(ctx.cfg.LogFile, "EventDate filled in %d game(s).\n", filled)
+		}
+	}
+
+	// Use parallel processing for multiple workers and enough games. Stable
+	// output, --unique-by and --sort are produced sequentially, as workers
+	// finish in any order, and so are games the evaluation filters run the
+	// one --engine on.
+	if numWorkers > 1 && len(games) > 2 && !ctx.cfg.Output.StableOutput && ctx.uniqueBy == nil && sortKeys == nil &&
+		(ctx.engineEval == nil || !evalFiltersSet()) {
 		return outputGamesParallel(games, ctx, numWorkers)
 	}
 
@@ -311,32 +617,37 @@ func outputGamesSequential(games []*chess.Game, ctx *ProcessingContext) (int, in
 	var jsonGames []*chess.Game
 
 	for _, game := range games {
-		if *stopAfter > 0 && atomic.LoadInt64(&matchedCount) >= int64(*stopAfter) {
+		if ctx.run.matchLimitReached() {
 			break
 		}
 
 		// Track game position (1-indexed) and check if it should be processed
-		position := int(IncrementGamePosition())
+		position := ctx.run.nextGamePosition()
 		if !checkGamePosition(position) {
 			continue
 		}
 
-		filterResult := applyFilters(game, ctx)
+		filterResult := applyFiltersWithTimeout(game, ctx)
 
 		if filterResult.SkipOutput {
 			if !*quiet && filterResult.ErrorMessage != "" {
-				fmt.Fprintf(os.Stderr, "Skipping game: %s\n", filterResult.ErrorMessage)
+				fmt.Fprintf(diagnosticOutput, "Skipping game: %s\n", filterResult.ErrorMessage)
 			}
 			continue
 		}
 
+		if ctx.alsoFilter != nil {
+			ctx.alsoFilter.record(game, filterResult.Matched, filterResult.AlsoMatched, cfg)
+		}
+
 		if !filterResult.Matched {
+			editTags(game, ctx)
 			outputNonMatchingGame(game, cfg)
 			continue
 		}
 
 		if *reportOnly {
-			atomic.AddInt64(&matchedCount, 1)
+			ctx.run.addMatched(game.SourceFile)
 			outputCount++
 			continue
 		}
@@ -372,23 +683,44 @@ func handleGameOutput(game *chess.Game, board *chess.Board, gameInfo *GameAnalys
 	cfg := ctx.cfg
 	detector := ctx.detector
 
+	if ctx.seen != nil && ctx.seen.repeat(game) {
+		return 0, 0
+	}
+	if ctx.uniqueBy != nil && !ctx.uniqueBy.firstSeen(game) {
+		return 0, 0
+	}
+
 	if detector == nil {
-		outputGameWithECOSplit(game, cfg, gameInfo, jsonGames, ctx.ecoSplitWriter)
-		atomic.AddInt64(&matchedCount, 1)
+		outputMatchedGame(game, gameInfo, ctx, jsonGames)
+		ctx.run.addMatched(game.SourceFile)
 		return 1, 0
 	}
 
-	if board == nil {
-		board = replayGame(game)
+	if cfg.FuzzyDepth == 0 && (board == nil || *dupePlies > 0) {
+		// A partial replay still gives identical games identical keys.
+		// In fuzzy mode the detector replays the game itself.
+		board, _, _ = engine.ReplayGamePlies(game, *dupePlies)
+	}
+
+	if ctx.deferred != nil {
+		if tracker, ok := detector.(hashing.OriginalTracker); ok {
+			return handleDeferredGameOutput(game, board, gameInfo, ctx, tracker)
+		}
 	}
 
-	isDuplicate := detector.CheckAndAdd(game, board)
+	var original *hashing.Original
+	var isDuplicate bool
+	if tracker, ok := detector.(hashing.OriginalTracker); ok {
+		original, isDuplicate = tracker.CheckAndAddOriginal(game, board)
+	} else {
+		isDuplicate = detector.CheckAndAdd(game, board)
+	}
 
 	if isDuplicate {
-		outputDuplicateGame(game, cfg)
+		outputDuplicateOf(game, original, cfg)
 		if cfg.Duplicate.SuppressOriginals {
-			outputGameWithECOSplit(game, cfg, gameInfo, jsonGames, ctx.ecoSplitWriter)
-			atomic.AddInt64(&matchedCount, 1)
+			outputMatchedGame(game, gameInfo, ctx, jsonGames)
+			ctx.run.addMatched(game.SourceFile)
 			return 1, 1
 		}
 		return 0, 1
@@ -396,19 +728,89 @@ func handleGameOutput(game *chess.Game, board *chess.Board, gameInfo *GameAnalys
 
 	// Not a duplicate - output if not suppressing or if not outputting only duplicates
 	if shouldOutputUnique(cfg) {
-		outputGameWithECOSplit(game, cfg, gameInfo, jsonGames, ctx.ecoSplitWriter)
-		atomic.AddInt64(&matchedCount, 1)
+		outputMatchedGame(game, gameInfo, ctx, jsonGames)
+		ctx.run.addMatched(game.SourceFile)
 		return 1, 0
 	}
 
 	return 0, 0
 }
 
+// handleDeferredGameOutput handles duplicate detection when kept games are
+// held back so that later duplicates can replace them or merge tags into them.
+func handleDeferredGameOutput(game *chess.Game, board *chess.Board, gameInfo *GameAnalysis, ctx *ProcessingContext, tracker hashing.OriginalTracker) (int, int) {
+	original, isDuplicate := tracker.CheckAndAddOriginal(game, board)
+	if isDuplicate {
+		suppressed := ctx.deferred.resolve(original.Game, game, gameInfo, ctx.cfg.CurrentInputFile, ctx.cfg)
+		if kept := ctx.deferred.lookup(original.Game); kept != nil && kept.game != original.Game {
+			// A later copy replaced the original as the game kept
+			original = &hashing.Original{SourceFile: kept.game.SourceFile, SourceIndex: kept.game.SourceIndex, Game: kept.game}
+		}
+		outputDuplicateOf(suppressed, original, ctx.cfg)
+		return 0, 1
+	}
+
+	ctx.deferred.add(game, gameInfo, ctx.cfg.CurrentInputFile)
+	ctx.run.addMatched(game.SourceFile)
+	return 1, 0
+}
+
 // shouldOutputUnique returns true if unique (non-duplicate) games should be output.
 func shouldOutputUnique(cfg *config.Config) bool {
 	return !cfg.Duplicate.Suppress || !cfg.Duplicate.SuppressOriginals
 }
 
+// outputDuplicateOf writes a suppressed duplicate to the duplicate file,
+// if configured, tagged with the game it duplicates.
+func outputDuplicateOf(game *chess.Game, original *hashing.Original, cfg *config.Config) {
+	if cfg.Duplicate.DuplicateFile == nil {
+		return
+	}
+	outputDuplicateGame(duplicateRecord(game, original, comparedPlies(cfg)), cfg)
+}
+
+// duplicateRecord returns a copy of a duplicate game carrying the tags
+// DuplicateOf, the Zobrist hash of the original's position after the
+// plies compared (its final position when 0), and, when the original is
+// known, DuplicateOfFile and DuplicateOfGame saying where it was read.
+// The game itself is left as it was, as with -U it is also written to the
+// main output.
+func duplicateRecord(game *chess.Game, original *hashing.Original, plies int) *chess.Game {
+	record := *game
+	record.Tags = make(map[string]string, len(game.Tags)+3)
+	for name, value := range game.Tags {
+		record.Tags[name] = value
+	}
+
+	source, hash := game, uint64(0)
+	if original != nil {
+		if original.SourceIndex > 0 {
+			record.Tags["DuplicateOfFile"] = original.SourceFile
+			record.Tags["DuplicateOfGame"] = strconv.Itoa(original.SourceIndex)
+		}
+		if original.Game != nil {
+			source = original.Game
+		}
+		hash = original.Hash
+	}
+	if hash == 0 {
+		// A partial replay reaches the position the detector compared
+		board, _, _ := engine.ReplayGamePlies(source, plies)
+		hash = hashing.GenerateZobristHash(board)
+	}
+	record.Tags["DuplicateOf"] = fmt.Sprintf("%016x", hash)
+	return &record
+}
+
+// comparedPlies returns how many plies of each game the duplicate
+// detector compares, --fuzzydepth or --dupe-plies, or 0 for whole games.
+func comparedPlies(cfg *config.Config) int {
+	if cfg.FuzzyDepth > 0 {
+		return cfg.FuzzyDepth
+	}
+	return *dupePlies
+}
+
 // outputDuplicateGame outputs a game to the duplicate file if configured.
 func outputDuplicateGame(game *chess.Game, cfg *config.Config) {
 	if cfg.Duplicate.DuplicateFile == nil {
@@ -429,13 +831,21 @@ func outputDuplicateGame(game *chess.Game, cfg *config.Config) {
 // are consumed by a single goroutine (the main function body below). This ensures that
 // non-thread-safe components (jsonGames slice, ECOSplitWriter, SplitWriter) are only
 // accessed from one goroutine, avoiding data races without requiring synchronization.
+// Where workersRender allows, the workers also render the games they match,
+// so that the consumer only copies finished text to the output.
 func outputGamesParallel(games []*chess.Game, ctx *ProcessingContext, numWorkers int) (int, int) {
+	return runParallel(games, ctx, numWorkers, workersRender(ctx))
+}
+
+// runParallel is outputGamesParallel with the choice of who renders games
+// made by the caller: the workers with render set, else the consumer.
+func runParallel(games []*chess.Game, ctx *ProcessingContext, numWorkers int, render bool) (int, int) {
 	cfg := ctx.cfg
 	outputCount := int64(0)
 	duplicateCount := int64(0)
 
 	processFunc := func(item worker.WorkItem) worker.ProcessResult {
-		return processGameWorker(item, ctx)
+		return processGameWorker(item, ctx, render)
 	}
 
 	bufferSize := len(games)
@@ -447,12 +857,12 @@ func outputGamesParallel(games []*chess.Game, ctx *ProcessingContext, numWorkers
 
 	go func() {
 		for i, game := range games {
-			if *stopAfter > 0 && atomic.LoadInt64(&matchedCount) >= int64(*stopAfter) {
+			if ctx.run.matchLimitReached() {
 				break
 			}
 
 			// Track game position (1-indexed) and check if it should be processed
-			position := int(IncrementGamePosition())
+			position := ctx.run.nextGamePosition()
 			if !checkGamePosition(position) {
 				continue
 			}
@@ -466,27 +876,39 @@ func outputGamesParallel(games []*chess.Game, ctx *ProcessingContext, numWorkers
 	var jsonGames []*chess.Game
 
 	for result := range pool.Results() {
-		if *stopAfter > 0 && atomic.LoadInt64(&matchedCount) >= int64(*stopAfter) {
+		if ctx.run.matchLimitReached() {
 			pool.Stop()
 			continue
 		}
 
+		if ctx.alsoFilter != nil {
+			ctx.alsoFilter.record(result.Game, result.Matched, result.AlsoMatched, cfg)
+		}
+
 		if !result.Matched {
+			editTags(result.Game, ctx)
 			outputNonMatchingGame(result.Game, cfg)
 			continue
 		}
 
 		if *reportOnly {
-			atomic.AddInt64(&matchedCount, 1)
+			ctx.run.addMatched(result.Game.SourceFile)
 			atomic.AddInt64(&outputCount, 1)
 			continue
 		}
 
-		// Apply move truncation before output
-		truncateMoves(result.Game)
+		// Apply move truncation before output, unless the worker did
+		if result.Output == nil {
+			truncateMoves(result.Game)
+		}
 
 		gameInfo, _ := result.GameInfo.(*GameAnalysis) //nolint:errcheck // type assertion ok-bool, nil is valid fallback
+		ctx.rendered = result.Output
 		out, dup := handleGameOutput(result.Game, result.Board, gameInfo, ctx, &jsonGames)
+		ctx.rendered = nil
+		if result.Output != nil {
+			output.PutBuffer(result.Output)
+		}
 		atomic.AddInt64(&outputCount, int64(out))
 		atomic.AddInt64(&duplicateCount, int64(dup))
 	}
@@ -498,9 +920,24 @@ func outputGamesParallel(games []*chess.Game, ctx *ProcessingContext, numWorkers
 	return int(atomic.LoadInt64(&outputCount)), int(atomic.LoadInt64(&duplicateCount))
 }
 
+// workersRender reports whether workers can render matched games into
+// their own buffers, leaving the consumer only to copy the text out. That
+// holds when the consumer would write each game to cfg.OutputFile as it
+// stands, without editing, annotating or holding it back first.
+func workersRender(ctx *ProcessingContext) bool {
+	cfg := ctx.cfg
+	return cfg.OutputFile != nil && !cfg.Output.JSONFormat && !*countOnly && !*reportOnly &&
+		*playerAsWhite == "" &&
+		ctx.tagEditor == nil && ctx.engineEval == nil && ctx.playerStats == nil &&
+		ctx.alsoFilter == nil && ctx.deferred == nil && ctx.cqlOutput == nil &&
+		ctx.ecoSplitWriter == nil && ctx.resultSplit == nil && ctx.dateSplit == nil && ctx.playerSplit == nil
+}
+
 // processGameWorker processes a single game in a worker goroutine.
 // This does all the CPU-intensive work that can be safely parallelized.
-func processGameWorker(item worker.WorkItem, ctx *ProcessingContext) worker.ProcessResult {
+// With render set, a game to be output is also truncated and rendered
+// into a buffer, so that formatting does not queue behind the consumer.
+func processGameWorker(item worker.WorkItem, ctx *ProcessingContext, render bool) worker.ProcessResult {
 	game := item.Game
 	result := worker.ProcessResult{
 		Game:  game,
@@ -508,23 +945,139 @@ func processGameWorker(item worker.WorkItem, ctx *ProcessingContext) worker.Proc
 	}
 
 	// Apply all filters using shared logic
-	filterResult := applyFilters(game, ctx)
+	filterResult := applyFiltersWithTimeout(game, ctx)
 
 	// Map FilterResult to ProcessResult
 	result.Matched = filterResult.Matched && !filterResult.SkipOutput
 	result.Board = filterResult.Board
 	result.GameInfo = filterResult.GameInfo
 	result.ShouldOutput = filterResult.Matched && !filterResult.SkipOutput && !*reportOnly
+	result.AlsoMatched = filterResult.AlsoMatched && !filterResult.SkipOutput
+
+	if render && result.ShouldOutput {
+		truncateMoves(game)
+		result.Output = output.GetBuffer()
+		output.RenderGame(result.Output, game, ctx.cfg)
+	}
+
+	return result
+}
+
+// gameDeadline returns the context a game's filters run under with
+// --game-timeout. Tests replace it to expire games deterministically.
+var gameDeadline = func() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), *gameTimeout)
+}
+
+// applyFiltersWithTimeout applies the filters to a game, giving up on it
+// if they run longer than --game-timeout. The filters check the deadline
+// between stages and while stepping through positions, so an abandoned
+// game stops in the goroutine that started it. It is logged and skipped.
+func applyFiltersWithTimeout(game *chess.Game, ctx *ProcessingContext) FilterResult {
+	if *gameTimeout <= 0 {
+		return applyFilters(context.Background(), game, ctx)
+	}
 
+	stop, cancel := gameDeadline()
+	defer cancel()
+	result := applyFilters(stop, game, ctx)
+	if result.Abandoned {
+		fmt.Fprintf(ctx.cfg.LogFile, "Game at line %d: processing abandoned after %v.\n", game.StartLine, *gameTimeout)
+	}
 	return result
 }
 
+// editTags applies the --addtag, --deletetag and --renametag edits to a
+// game about to be written.
+func editTags(game *chess.Game, ctx *ProcessingContext) {
+	if ctx.tagEditor != nil {
+		ctx.tagEditor.Apply(game)
+	}
+}
+
+// outputMatchedGame outputs a matched game, writing its CQL-matching
+// positions first when --cql-output asks for them. With --count matched
+// games are only counted, and with --report players only recorded, after
+// --engine evaluates them for the decisive mistake counts.
+func outputMatchedGame(game *chess.Game, gameInfo *GameAnalysis, ctx *ProcessingContext, jsonGames *[]*chess.Game) {
+	if *countOnly {
+		return
+	}
+	if ctx.playerStats != nil {
+		if ctx.engineEval != nil {
+			ctx.engineEval.annotate(game)
+		}
+		ctx.playerStats.Add(game)
+		return
+	}
+	if *playerAsWhite != "" && playsBlackOnly(game, *playerAsWhite) {
+		processing.FlipColours(game)
+	}
+	editTags(game, ctx)
+	if ctx.engineEval != nil {
+		ctx.engineEval.annotate(game)
+	}
+	if *verifyRoundtrip {
+		if err := output.VerifyRoundTrip(game, ctx.cfg); err != nil {
+			ctx.run.roundTripFailures.Add(1)
+			fmt.Fprintf(diagnosticOutput, "Error: game at line %d does not survive output: %v\n", game.StartLine, err)
+		}
+	}
+	if ctx.featureExport != nil {
+		if err := ctx.featureExport.WriteGame(game); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing game features: %v\n", err)
+		}
+	}
+	if ctx.posIndex != nil {
+		if err := ctx.posIndex.WriteGame(game); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing position index: %v\n", err)
+		}
+	}
+	if co := ctx.cqlOutput; co != nil && ctx.cqlNode != nil {
+		co.writePositions(ctx.cfg.OutputFile, game, ctx.cqlNode)
+		if !co.games {
+			return
+		}
+	}
+	if ctx.resultSplit != nil {
+		if err := ctx.resultSplit.WriteGame(game); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing game to result file: %v\n", err)
+		}
+		return
+	}
+	if ctx.dateSplit != nil {
+		if err := ctx.dateSplit.WriteGame(game); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing game to date file: %v\n", err)
+		}
+		return
+	}
+	if ctx.playerSplit != nil {
+		if err := ctx.playerSplit.WriteGame(game); err != nil {
+			fmt.Fprintf(diagnosticOutput, "Error writing game to player file: %v\n", err)
+		}
+		return
+	}
+	outputGameWithECOSplit(game, ctx.cfg, gameInfo, jsonGames, ctx.ecoSplitWriter, ctx.rendered)
+}
+
+// playsBlackOnly reports whether the named player (a case-insensitive
+// substring) had Black in the game and not also White.
+func playsBlackOnly(game *chess.Game, player string) bool {
+	player = strings.ToLower(player)
+	return strings.Contains(strings.ToLower(game.Black()), player) &&
+		!strings.Contains(strings.ToLower(game.White()), player)
+}
+
 // outputGameWithECOSplit outputs a game with optional annotations and ECO-based splitting.
-func outputGameWithECOSplit(game *chess.Game, cfg *config.Config, gameInfo *GameAnalysis, jsonGames *[]*chess.Game, ecoWriter *ECOSplitWriter) {
+// A game already rendered by its worker is written as rendered.
+func outputGameWithECOSplit(game *chess.Game, cfg *config.Config, gameInfo *GameAnalysis, jsonGames *[]*chess.Game, ecoWriter *ECOSplitWriter, rendered *bytes.Buffer) {
 	// Handle split writer
 	if sw, ok := cfg.OutputFile.(*SplitWriter); ok {
 		defer sw.IncrementGameCount()
 	}
+	if aw, ok := cfg.OutputFile.(*asyncWriter); ok {
+		defer aw.gameWritten()
+	}
 
 	if cfg.Output.JSONFormat {
 		*jsonGames = append(*jsonGames, game)
@@ -534,10 +1087,14 @@ func outputGameWithECOSplit(game *chess.Game, cfg *config.Config, gameInfo *Game
 	// If ECO split writer is configured, use it
 	if ecoWriter != nil {
 		if err := ecoWriter.WriteGame(game); err != nil {
-			fmt.Fprintf(os.Stderr, "Error writing game to ECO file: %v\n", err)
+			fmt.Fprintf(diagnosticOutput, "Error writing game to ECO file: %v\n", err)
 		}
 		return
 	}
 
+	if rendered != nil {
+		cfg.OutputFile.Write(rendered.Bytes()) //nolint:errcheck,gosec // output errors are not reported per game
+		return
+	}
 	output.OutputGame(game, cfg)
 }
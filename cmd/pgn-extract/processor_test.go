@@ -2,17 +2,21 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
 	"github.com/lgbarn/pgn-extract-go/internal/config"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
 	"github.com/lgbarn/pgn-extract-go/internal/hashing"
+	"github.com/lgbarn/pgn-extract-go/internal/output"
 	"github.com/lgbarn/pgn-extract-go/internal/testutil"
 	"github.com/lgbarn/pgn-extract-go/internal/worker"
 )
@@ -154,7 +158,7 @@ func TestParallelDuplicateDetection_MatchesSequential(t *testing.T) {
 			// Run sequential detection
 			seqDetector := hashing.NewDuplicateDetector(false, 0)
 			for _, game := range parsedGames {
-				board := replayGame(game)
+				board, _, _ := engine.ReplayGame(game)
 				seqDetector.CheckAndAdd(game, board)
 			}
 
@@ -177,7 +181,7 @@ func TestParallelDuplicateDetection_MatchesSequential(t *testing.T) {
 				go func(start, end int) {
 					defer wg.Done()
 					for j := start; j < end; j++ {
-						board := replayGame(parsedGames[j])
+						board, _, _ := engine.ReplayGame(parsedGames[j])
 						tsDetector.CheckAndAdd(parsedGames[j], board)
 					}
 				}(startIdx, endIdx)
@@ -266,7 +270,7 @@ func TestParallelDuplicateDetection_WithCheckFile(t *testing.T) {
 	baseDetector := hashing.NewDuplicateDetector(false, 0)
 	for _, pgnStr := range checkfileGames {
 		game := testutil.MustParseGame(t, pgnStr)
-		board := replayGame(game)
+		board, _, _ := engine.ReplayGame(game)
 		baseDetector.CheckAndAdd(game, board)
 	}
 
@@ -311,7 +315,7 @@ func TestParallelDuplicateDetection_WithCheckFile(t *testing.T) {
 		go func(start, end int) {
 			defer wg.Done()
 			for j := start; j < end; j++ {
-				board := replayGame(parsedNewGames[j])
+				board, _, _ := engine.ReplayGame(parsedNewGames[j])
 				tsDetector.CheckAndAdd(parsedNewGames[j], board)
 			}
 		}(startIdx, endIdx)
@@ -463,6 +467,42 @@ func TestECOSplitWriter_LRU_UnlimitedWhenHigh(t *testing.T) {
 	}
 }
 
+// TestECOSplitWriter_SplitDir verifies that --split-dir places files in
+// per-class subdirectories and writes an index of them.
+func TestECOSplitWriter_SplitDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	cfg := config.NewConfig()
+	cfg.OutputFile = os.Stdout
+
+	writer := NewECOSplitWriter("games", 3, cfg, 1)
+	if err := writer.SetDir(dir); err != nil {
+		t.Fatalf("SetDir failed: %v", err)
+	}
+	for _, eco := range []string{"B90", "A00", "B90", ""} {
+		if err := writer.WriteGame(makeMinimalGame(eco)); err != nil {
+			t.Fatalf("WriteGame(%s) failed: %v", eco, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	for _, name := range []string{"A/games_A00.pgn", "B/games_B90.pgn", "games_unknown.pgn"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected split file %s: %v", name, err)
+		}
+	}
+
+	index, err := os.ReadFile(filepath.Join(dir, "index.csv"))
+	if err != nil {
+		t.Fatalf("reading index: %v", err)
+	}
+	want := "eco,file,games\nA00,A/games_A00.pgn,1\nB90,B/games_B90.pgn,2\nunknown,games_unknown.pgn,1\n"
+	if string(index) != want {
+		t.Errorf("index.csv:\n%s\nwant:\n%s", index, want)
+	}
+}
+
 // TestECOSplitWriter_LRU_HandleCountBounded verifies that the LRU cache
 // properly bounds the number of open file handles when writing games
 // with many distinct ECO codes.
@@ -525,6 +565,23 @@ func TestECOSplitWriter_LRU_HandleCountBounded(t *testing.T) {
 	}
 }
 
+func TestPlayerSurname(t *testing.T) {
+	tests := map[string]string{
+		"Carlsen, Magnus": "carlsen",
+		"Magnus Carlsen":  "carlsen",
+		"Van Wely, Loek":  "van-wely",
+		"O'Kelly, A.":     "o-kelly",
+		"Fischer":         "fischer",
+		"?":               "unknown",
+		"":                "unknown",
+	}
+	for name, want := range tests {
+		if got := playerSurname(name); got != want {
+			t.Errorf("playerSurname(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
 // --- Helper: test PGN data ---
 
 const processorTestPGN = `[Event "Test"]
@@ -562,8 +619,6 @@ const threeGamePGN = processorTestPGN + "\n\n" + processorTestPGN2 + "\n\n" + pr
 // resetGlobalState resets all global state modified by the processing pipeline.
 func resetGlobalState(t *testing.T) {
 	t.Helper()
-	atomic.StoreInt64(&matchedCount, 0)
-	atomic.StoreInt64(&gamePositionCounter, 0)
 	selectOnlySet = nil
 	skipMatchingSet = nil
 	parsedPlyRange = [2]int{0, 0}
@@ -700,6 +755,52 @@ func TestSplitWriterCloseNilFile(t *testing.T) {
 	}
 }
 
+func TestAsyncWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "async.pgn")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aw := newAsyncWriter(file, 2)
+
+	// Enough output to fill several chunks, in game-sized writes
+	var want bytes.Buffer
+	for i := 0; i < 5000; i++ {
+		game := fmt.Sprintf("[Event \"Game %d\"]\n\n1. e4 *\n\n", i+1)
+		want.WriteString(game)
+		if _, err := aw.Write([]byte(game)); err != nil {
+			t.Fatalf("Write failed on game %d: %v", i+1, err)
+		}
+		aw.gameWritten()
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("wrote %d bytes, want %d in order", len(got), want.Len())
+	}
+}
+
+func TestAsyncWriterReportsWriteError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "closed.pgn")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close() //nolint:errcheck,gosec // writes must now fail
+	aw := newAsyncWriter(file, 0)
+
+	_, _ = aw.Write([]byte("1. e4 *\n"))
+	if err := aw.Close(); err == nil {
+		t.Error("Close after a failed write returned nil")
+	}
+}
+
 func TestProcessInput(t *testing.T) {
 	cfg := config.NewConfig()
 	cfg.Verbosity = 0
@@ -865,7 +966,7 @@ func TestApplyFiltersMinimal(t *testing.T) {
 	buf := &bytes.Buffer{}
 	ctx := newTestContext(buf)
 
-	result := applyFilters(game, ctx)
+	result := applyFilters(context.Background(), game, ctx)
 	if !result.Matched {
 		t.Error("Expected game to match with no filters")
 	}
@@ -874,6 +975,38 @@ func TestApplyFiltersMinimal(t *testing.T) {
 	}
 }
 
+func TestApplyFiltersWithTimeout(t *testing.T) {
+	resetGlobalState(t)
+	restore := saveFlagPointers(t)
+	defer restore()
+	origTimeout, origDeadline := *gameTimeout, gameDeadline
+	defer func() { *gameTimeout, gameDeadline = origTimeout, origDeadline }()
+	*gameTimeout = time.Minute
+
+	game := testutil.MustParseGame(t, processorTestPGN)
+	var log bytes.Buffer
+	ctx := newTestContext(&bytes.Buffer{})
+	ctx.cfg.LogFile = &log
+
+	if result := applyFiltersWithTimeout(game, ctx); !result.Matched || result.Abandoned || log.Len() != 0 {
+		t.Errorf("within the deadline: result %+v, log %q", result, log.String())
+	}
+
+	// A deadline that has already passed stops the filters at once.
+	gameDeadline = func() (context.Context, context.CancelFunc) {
+		stop, cancel := context.WithCancel(context.Background())
+		cancel()
+		return stop, cancel
+	}
+	result := applyFiltersWithTimeout(game, ctx)
+	if result.Matched || !result.SkipOutput || !result.Abandoned {
+		t.Errorf("past the deadline: result %+v, want an abandoned game", result)
+	}
+	if !strings.Contains(log.String(), "processing abandoned after 1m0s") {
+		t.Errorf("log = %q, want the abandoned game", log.String())
+	}
+}
+
 func TestApplyFiltersFixable(t *testing.T) {
 	resetGlobalState(t)
 	restore := saveFlagPointers(t)
@@ -889,7 +1022,7 @@ func TestApplyFiltersFixable(t *testing.T) {
 	buf := &bytes.Buffer{}
 	ctx := newTestContext(buf)
 
-	result := applyFilters(game, ctx)
+	result := applyFilters(context.Background(), game, ctx)
 	if !result.Matched {
 		t.Error("Expected fixable game to still match")
 	}
@@ -910,7 +1043,7 @@ func TestApplyFiltersNegate(t *testing.T) {
 	buf := &bytes.Buffer{}
 	ctx := newTestContext(buf)
 
-	result := applyFilters(game, ctx)
+	result := applyFilters(context.Background(), game, ctx)
 	if result.Matched {
 		t.Error("Expected negated match to be false for a normally matching game")
 	}
@@ -929,7 +1062,7 @@ func TestApplyFiltersPlyBounds(t *testing.T) {
 	t.Run("minPly too high", func(t *testing.T) {
 		resetGlobalState(t)
 		*minPly = 20
-		result := applyFilters(game, ctx)
+		result := applyFilters(context.Background(), game, ctx)
 		if result.Matched {
 			t.Error("Expected game with 6 plies to fail minPly=20")
 		}
@@ -939,7 +1072,7 @@ func TestApplyFiltersPlyBounds(t *testing.T) {
 	t.Run("minPly within range", func(t *testing.T) {
 		resetGlobalState(t)
 		*minPly = 4
-		result := applyFilters(game, ctx)
+		result := applyFilters(context.Background(), game, ctx)
 		if !result.Matched {
 			t.Error("Expected game with 6 plies to pass minPly=4")
 		}
@@ -958,7 +1091,7 @@ func TestApplyFiltersCheckmate(t *testing.T) {
 	buf := &bytes.Buffer{}
 	ctx := newTestContext(buf)
 
-	result := applyFilters(game, ctx)
+	result := applyFilters(context.Background(), game, ctx)
 	if result.Matched {
 		t.Error("Expected non-checkmate game to fail checkmateFilter")
 	}
@@ -974,7 +1107,7 @@ func TestApplyFiltersCheckmate(t *testing.T) {
 
 1. e4 e5 2. Bc4 Nc6 3. Qh5 Nf6 4. Qxf7# 1-0`
 	checkmateGame := testutil.MustParseGame(t, checkmatePGN)
-	result2 := applyFilters(checkmateGame, ctx)
+	result2 := applyFilters(context.Background(), checkmateGame, ctx)
 	if !result2.Matched {
 		t.Error("Expected checkmate game to pass checkmateFilter")
 	}
@@ -1027,7 +1160,7 @@ func TestHandleGameOutput(t *testing.T) {
 
 		// First game is unique
 		handleGameOutput(game1, nil, nil, ctx, &jsonGames)
-		resetGlobalState(t) // reset matchedCount for clarity
+		resetGlobalState(t)
 
 		// Second game is duplicate
 		out, dup := handleGameOutput(game2, nil, nil, ctx, &jsonGames)
@@ -1069,7 +1202,7 @@ func TestOutputGameWithECOSplit(t *testing.T) {
 		var jsonGames []*chess.Game
 		game := testutil.MustParseGame(t, processorTestPGN)
 
-		outputGameWithECOSplit(game, cfg, nil, &jsonGames, nil)
+		outputGameWithECOSplit(game, cfg, nil, &jsonGames, nil, nil)
 
 		if len(jsonGames) != 1 {
 			t.Errorf("Expected 1 game in jsonGames, got %d", len(jsonGames))
@@ -1083,7 +1216,7 @@ func TestOutputGameWithECOSplit(t *testing.T) {
 		var jsonGames []*chess.Game
 		game := testutil.MustParseGame(t, processorTestPGN)
 
-		outputGameWithECOSplit(game, cfg, nil, &jsonGames, nil)
+		outputGameWithECOSplit(game, cfg, nil, &jsonGames, nil, nil)
 
 		if buf.Len() == 0 {
 			t.Error("Expected game written to output buffer")
@@ -1196,7 +1329,7 @@ func TestProcessGameWorker(t *testing.T) {
 	ctx := newTestContext(buf)
 
 	item := worker.WorkItem{Game: game, Index: 0}
-	result := processGameWorker(item, ctx)
+	result := processGameWorker(item, ctx, false)
 
 	if !result.Matched {
 		t.Error("Expected game to match with no filters")
@@ -1293,3 +1426,47 @@ func TestOutputGamesParallel(t *testing.T) {
 		t.Error("Expected output to be non-empty")
 	}
 }
+
+func TestProcessGameWorkerRender(t *testing.T) {
+	resetGlobalState(t)
+	restore := saveFlagPointers(t)
+	defer restore()
+
+	game := testutil.MustParseGame(t, processorTestPGN)
+	want := &bytes.Buffer{}
+	ctx := newTestContext(want)
+	output.OutputGame(game, ctx.cfg)
+
+	result := processGameWorker(worker.WorkItem{Game: game}, ctx, true)
+	if result.Output == nil {
+		t.Fatal("Expected the worker to render the game")
+	}
+	if result.Output.String() != want.String() {
+		t.Errorf("Rendered game differs from OutputGame:\n%s\nwant:\n%s", result.Output, want)
+	}
+
+	*reportOnly = true
+	if workersRender(ctx) {
+		t.Error("Expected no rendering by workers in reportOnly mode")
+	}
+}
+
+func TestOutputGamesParallelRenderMatchesConsumer(t *testing.T) {
+	resetGlobalState(t)
+	restore := saveFlagPointers(t)
+	defer restore()
+	*quiet = true
+
+	games := testutil.MustParseGames(t, threeGamePGN)
+	outputs := make([]string, 2)
+	for i, render := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		runParallel(games, newTestContext(buf), 2, render)
+		games := strings.Split(strings.TrimSpace(buf.String()), "\n\n[")
+		sort.Strings(games)
+		outputs[i] = strings.Join(games, "\n")
+	}
+	if outputs[0] != outputs[1] {
+		t.Errorf("Worker-rendered output differs:\n%s\nconsumer-rendered:\n%s", outputs[1], outputs[0])
+	}
+}
@@ -0,0 +1,85 @@
+// readahead.go - Reading input files concurrently for --parallel-files
+package main
+
+import (
+	"sync"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+)
+
+// parsedFile is an input file read and parsed ahead of processing.
+type parsedFile struct {
+	games []*chess.Game
+	in    *inputReader
+	err   error // opening the file failed
+}
+
+// fileReadAhead reads and parses input files on worker goroutines, at most
+// n files ahead of the caller, and hands them back in argument order so
+// that filtering and output stay deterministic.
+type fileReadAhead struct {
+	order chan chan *parsedFile
+	slots chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// newFileReadAhead starts reading filenames, n at a time.
+func newFileReadAhead(filenames []string, n int, cfg *config.Config) *fileReadAhead {
+	if n < 1 {
+		n = 1
+	}
+	ra := &fileReadAhead{
+		order: make(chan chan *parsedFile, n),
+		slots: make(chan struct{}, n),
+		done:  make(chan struct{}),
+	}
+	go func() {
+		defer close(ra.order)
+		for _, filename := range filenames {
+			select {
+			case ra.slots <- struct{}{}:
+			case <-ra.done:
+				return
+			}
+			ch := make(chan *parsedFile, 1)
+			ra.order <- ch
+			go func(filename string) {
+				ch <- parseFile(filename, cfg)
+			}(filename)
+		}
+	}()
+	return ra
+}
+
+// parseFile reads all the games of a file. It leaves cfg.CurrentInputFile
+// alone, as other files are being processed meanwhile.
+func parseFile(filename string, cfg *config.Config) *parsedFile {
+	file, err := openInputFile(filename)
+	if err != nil {
+		return &parsedFile{err: err}
+	}
+	defer file.Close()
+
+	in := openInput(file, filename, cfg)
+	return &parsedFile{games: in.next(0), in: in}
+}
+
+// next returns the next file in argument order, waiting for it to be
+// parsed, and frees its slot for another file to be read.
+func (ra *fileReadAhead) next() *parsedFile {
+	ch, ok := <-ra.order
+	if !ok {
+		return nil
+	}
+	pf := <-ch
+	<-ra.slots
+	return pf
+}
+
+// stop stops reading further files. Files already being read are left to
+// finish in the background.
+func (ra *fileReadAhead) stop() {
+	ra.once.Do(func() { close(ra.done) })
+}
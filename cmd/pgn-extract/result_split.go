@@ -0,0 +1,84 @@
+// result_split.go - Splitting output by game result
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+	"github.com/lgbarn/pgn-extract-go/internal/output"
+)
+
+// resultCategories names the --split-by-result outputs, in --result-files order.
+var resultCategories = []string{"white", "black", "draw", "unfinished"}
+
+// ResultSplitWriter writes games to one file per result: white wins, black
+// wins, draws and unfinished games. Files are created on first use.
+// NOT thread-safe: Only accessed from the single result-consumer goroutine.
+type ResultSplitWriter struct {
+	filenames [4]string
+	files     [4]*os.File
+	cfg       *config.Config
+}
+
+// NewResultSplitWriter creates a result split writer. Each category is
+// written to the matching entry of filenames, or to base_<category>.pgn
+// when that entry is empty.
+func NewResultSplitWriter(baseName string, filenames []string, cfg *config.Config) *ResultSplitWriter {
+	rw := &ResultSplitWriter{cfg: cfg}
+	for i, category := range resultCategories {
+		if i < len(filenames) && strings.TrimSpace(filenames[i]) != "" {
+			rw.filenames[i] = strings.TrimSpace(filenames[i])
+		} else {
+			rw.filenames[i] = fmt.Sprintf("%s_%s.pgn", baseName, category)
+		}
+	}
+	return rw
+}
+
+// WriteGame writes a game to the file for its result.
+func (rw *ResultSplitWriter) WriteGame(game *chess.Game) error {
+	i := resultIndex(game.Tags["Result"])
+	if rw.files[i] == nil {
+		file, err := os.Create(rw.filenames[i]) //nolint:gosec // G304: filename is user-specified
+		if err != nil {
+			return err
+		}
+		rw.files[i] = file
+	}
+
+	withOutputFile(rw.cfg, rw.files[i], func() {
+		output.OutputGame(game, rw.cfg)
+	})
+	return nil
+}
+
+// resultIndex maps a Result tag value to its output category.
+func resultIndex(result string) int {
+	switch strings.TrimSpace(result) {
+	case "1-0":
+		return 0
+	case "0-1":
+		return 1
+	case "1/2-1/2":
+		return 2
+	default:
+		return 3
+	}
+}
+
+// Close closes all open files.
+func (rw *ResultSplitWriter) Close() error {
+	var lastErr error
+	for i, file := range rw.files {
+		if file != nil {
+			if err := file.Close(); err != nil {
+				lastErr = err
+			}
+			rw.files[i] = nil
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,62 @@
+// run_stats.go - Counters kept for one processing run
+package main
+
+import (
+	"slices"
+	"sync/atomic"
+)
+
+// runStats holds the counters of one run, so that nothing is carried over
+// between runs in package globals. The zero value is ready to use. The
+// atomic counters are updated from the worker goroutines; the per-file
+// counts are only accessed from the goroutine consuming results.
+type runStats struct {
+	matched           atomic.Int64 // games matched, for --stopafter
+	fileMatchedBase   atomic.Int64 // matched when the current input was started
+	gamePosition      atomic.Int64 // 1-based position of the last game taken
+	duplicateTags     atomic.Int64 // repeated tags seen by the parsers
+	roundTripFailures atomic.Int64 // games failing --verify-roundtrip
+	illegalCastling   atomic.Int64 // games with castling --legality objects to
+	outputErrors      atomic.Int64 // output files that could not be written
+
+	files       []string       // input files in the order they were opened
+	fileMatched map[string]int // games matched in each input file
+}
+
+// addMatched counts a matched game read from file.
+func (rs *runStats) addMatched(file string) {
+	rs.matched.Add(1)
+	if rs.fileMatched == nil {
+		rs.fileMatched = make(map[string]int)
+	}
+	rs.fileMatched[file]++
+}
+
+// addInputFile records an input file opened for reading. A file given
+// more than once is recorded once.
+func (rs *runStats) addInputFile(file string) {
+	if !slices.Contains(rs.files, file) {
+		rs.files = append(rs.files, file)
+	}
+}
+
+// startInputFile resets the per-file match count for --per-file-limit.
+func (rs *runStats) startInputFile() {
+	rs.fileMatchedBase.Store(rs.matched.Load())
+}
+
+// matchLimitReached reports whether --stopafter or --per-file-limit has
+// been reached.
+func (rs *runStats) matchLimitReached() bool {
+	matched := rs.matched.Load()
+	if *stopAfter > 0 && matched >= int64(*stopAfter) {
+		return true
+	}
+	return *perFileLimit > 0 && matched-rs.fileMatchedBase.Load() >= int64(*perFileLimit)
+}
+
+// nextGamePosition returns the 1-based position of the next game taken for
+// processing, for --selectonly and --skipmatching.
+func (rs *runStats) nextGamePosition() int {
+	return int(rs.gamePosition.Add(1))
+}
@@ -0,0 +1,112 @@
+// seen.go - Skipping games already output in this run
+package main
+
+import (
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"sort"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// seenGames skips exact repeats of games already output in the run, for
+// --skip-seen, such as the games of a file passed twice or of files that
+// overlap. It is much cheaper than duplicate detection: nothing is
+// replayed, and games only repeat when their tags and movetext, comments
+// and variations included, are the same.
+// NOT thread-safe: Only accessed from the single result-consumer goroutine.
+type seenGames struct {
+	seen    map[uint64]bool
+	skipped map[string]int // repeats skipped per input file
+}
+
+// setupSeenGames returns the --skip-seen filter, or nil if not requested.
+func setupSeenGames() *seenGames {
+	if !*skipSeen {
+		return nil
+	}
+	return &seenGames{seen: make(map[uint64]bool), skipped: make(map[string]int)}
+}
+
+// repeat reports whether an identical game was seen before, recording the
+// game otherwise.
+func (s *seenGames) repeat(game *chess.Game) bool {
+	key := gameContentHash(game)
+	if s.seen[key] {
+		s.skipped[game.SourceFile]++
+		return true
+	}
+	s.seen[key] = true
+	return false
+}
+
+// report warns about the repeats skipped, with a count for each file.
+func (s *seenGames) report(w io.Writer) {
+	total := 0
+	files := make([]string, 0, len(s.skipped))
+	for file, n := range s.skipped {
+		total += n
+		files = append(files, file)
+	}
+	if total == 0 {
+		return
+	}
+	sort.Strings(files)
+	fmt.Fprintf(w, "Warning: %d game(s) already output earlier in this run were skipped:\n", total)
+	for _, file := range files {
+		fmt.Fprintf(w, "  %s: %d\n", file, s.skipped[file])
+	}
+}
+
+// gameContentHash hashes a game's tags, in name order, and its movetext.
+func gameContentHash(game *chess.Game) uint64 {
+	h := fnv.New64a()
+	names := make([]string, 0, len(game.Tags))
+	for name := range game.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeField(h, name)
+		writeField(h, game.Tags[name])
+	}
+	writeComments(h, game.PrefixComment)
+	writeMoves(h, game.Moves)
+	return h.Sum64()
+}
+
+func writeMoves(h hash.Hash64, moves *chess.Move) {
+	for move := moves; move != nil; move = move.Next {
+		writeField(h, move.Text)
+		for _, nag := range move.NAGs {
+			for _, text := range nag.Text {
+				writeField(h, text)
+			}
+			writeComments(h, nag.Comments)
+		}
+		writeComments(h, move.Comments)
+		for _, variation := range move.Variations {
+			writeField(h, "(")
+			writeComments(h, variation.PrefixComment)
+			writeMoves(h, variation.Moves)
+			writeComments(h, variation.SuffixComment)
+			writeField(h, ")")
+		}
+		writeField(h, move.TerminatingResult)
+	}
+}
+
+func writeComments(h hash.Hash64, comments []*chess.Comment) {
+	for _, comment := range comments {
+		writeField(h, "{"+comment.Text)
+	}
+}
+
+// writeField writes a string followed by a separator, so that adjacent
+// fields cannot run together.
+func writeField(h hash.Hash64, s string) {
+	_, _ = io.WriteString(h, s) // hash writes never fail
+	_, _ = h.Write([]byte{0})
+}
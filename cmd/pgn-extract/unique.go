@@ -0,0 +1,46 @@
+// unique.go - Limiting output to one game per tag value
+package main
+
+import (
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// uniqueKeyFilter passes only the first game seen for each combination of
+// values of its tags, as for --unique-by White or --unique-by Event,Round.
+// NOT thread-safe: Only accessed from the single result-consumer goroutine.
+type uniqueKeyFilter struct {
+	tags []string
+	seen map[string]bool
+}
+
+// newUniqueKeyFilter creates a filter keyed on a comma-separated list of
+// tag names. It returns nil if the list names no tags.
+func newUniqueKeyFilter(tagList string) *uniqueKeyFilter {
+	var tags []string
+	for _, tag := range strings.Split(tagList, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return &uniqueKeyFilter{tags: tags, seen: make(map[string]bool)}
+}
+
+// firstSeen reports whether game is the first with its key, recording the
+// key. Missing tags count as empty values.
+func (u *uniqueKeyFilter) firstSeen(game *chess.Game) bool {
+	values := make([]string, len(u.tags))
+	for i, tag := range u.tags {
+		values[i] = strings.TrimSpace(game.GetTag(tag))
+	}
+	key := strings.Join(values, "\x00")
+	if u.seen[key] {
+		return false
+	}
+	u.seen[key] = true
+	return true
+}
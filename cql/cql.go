@@ -0,0 +1,68 @@
+// Package cql is the public Go API of pgn-extract-go's Chess Query Language
+// engine. It lets other programs parse CQL queries and match them against
+// single positions or whole games, including the transformation filters
+// (flip, flipvertical, flipcolor, shift, ...). See docs/CQL.md for the
+// query language.
+//
+//	query, err := cql.Parse("(and mate (piece [RQ] [a-h]8))")
+//	if err != nil {
+//		return err
+//	}
+//	games, err := cql.ParseGames(r)
+//	...
+//	for _, game := range games {
+//		if matches := query.MatchGame(game, cql.MatchOptions{}); len(matches) > 0 {
+//			fmt.Println(game.White(), "-", game.Black(), "ply", matches[0].Ply)
+//		}
+//	}
+package cql
+
+import (
+	"io"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+	icql "github.com/lgbarn/pgn-extract-go/internal/cql"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/parser"
+)
+
+// Board is a chess position.
+type Board = chess.Board
+
+// Game is a parsed PGN game.
+type Game = chess.Game
+
+// Move is a move in a game.
+type Move = chess.Move
+
+// Query is a parsed CQL query. It is safe for concurrent use.
+type Query = icql.Query
+
+// MatchOptions controls how Query.MatchGame searches a game.
+type MatchOptions = icql.MatchOptions
+
+// Match is a position in a game that matched a query.
+type Match = icql.Match
+
+// Parse parses a CQL query.
+func Parse(query string) (*Query, error) {
+	return icql.Compile(query)
+}
+
+// BoardFromFEN returns the position described by a FEN string.
+func BoardFromFEN(fen string) (*Board, error) {
+	return engine.NewBoardFromFEN(fen)
+}
+
+// BoardToFEN returns the FEN string of a position.
+func BoardToFEN(board *Board) string {
+	return engine.BoardToFEN(board)
+}
+
+// ParseGames reads all games from PGN text.
+func ParseGames(r io.Reader) ([]*Game, error) {
+	cfg := config.NewConfig()
+	cfg.LogFile = io.Discard
+	return parser.NewParser(r, cfg).ParseAllGames()
+}
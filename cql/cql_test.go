@@ -0,0 +1,41 @@
+package cql_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/cql"
+)
+
+func TestPublicAPI(t *testing.T) {
+	games, err := cql.ParseGames(strings.NewReader(`[White "A"]
+[Black "B"]
+[Result "0-1"]
+
+1. f3 e5 2. g4 Qh4# 0-1
+`))
+	if err != nil || len(games) != 1 {
+		t.Fatalf("ParseGames = %d games, %v", len(games), err)
+	}
+
+	// Fool's mate, found from White's side with flipcolor
+	query, err := cql.Parse("(flipcolor (and mate (piece Q h4)))")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	matches := query.MatchGame(games[0], cql.MatchOptions{})
+	if len(matches) != 1 || matches[0].Ply != 4 {
+		t.Fatalf("MatchGame = %+v; want a match at ply 4", matches)
+	}
+	if fen := cql.BoardToFEN(matches[0].Board); !strings.HasPrefix(fen, "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/") {
+		t.Errorf("matched position = %s", fen)
+	}
+
+	board, err := cql.BoardFromFEN("4k3/8/8/8/8/8/8/R3K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("BoardFromFEN: %v", err)
+	}
+	if query.MatchBoard(board) {
+		t.Error("MatchBoard matched a position without mate")
+	}
+}
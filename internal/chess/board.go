@@ -34,7 +34,7 @@ type Board struct {
 	// Weak hash value based on a simple hashing approach.
 	WeakHashValue HashCode
 
-	// Zobrist hash value (Polyglot-compatible).
+	// Zobrist hash value.
 	Zobrist uint64
 
 	// The half-move clock since the last pawn move or capture.
@@ -0,0 +1,105 @@
+package chess
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MoveCommands holds the [%clk], [%emt] and [%eval] commands embedded in
+// a move's comments, as lichess and chess servers write them.
+type MoveCommands struct {
+	Clock      time.Duration // [%clk]: the mover's time left after the move
+	HasClock   bool
+	Elapsed    time.Duration // [%emt]: the time the mover spent on the move
+	HasElapsed bool
+	Eval       float64 // [%eval]: White's advantage in pawns, 0 for a mate
+	Mate       int     // mate in this many moves, negative when Black mates
+	HasEval    bool
+}
+
+// commandPattern matches a [%clk], [%emt] or [%eval] command.
+var commandPattern = regexp.MustCompile(`\[%(clk|emt|eval)\s+([^\s\]]+)[^\]]*\]`)
+
+// ParseCommands sets m.Commands from the commands in the move's comments,
+// including those after its NAGs. The first of each command counts.
+func (m *Move) ParseCommands() {
+	m.Commands = MoveCommands{}
+	for _, nag := range m.NAGs {
+		for _, comment := range nag.Comments {
+			m.Commands.parse(comment.Text)
+		}
+	}
+	for _, comment := range m.Comments {
+		m.Commands.parse(comment.Text)
+	}
+}
+
+// parse reads the commands of one comment, skipping malformed ones.
+func (c *MoveCommands) parse(text string) {
+	if !strings.Contains(text, "[%") {
+		return
+	}
+	for _, m := range commandPattern.FindAllStringSubmatch(text, -1) {
+		switch m[1] {
+		case "clk":
+			if d, ok := ParseClock(m[2]); ok && !c.HasClock {
+				c.Clock, c.HasClock = d, true
+			}
+		case "emt":
+			if d, ok := ParseClock(m[2]); ok && !c.HasElapsed {
+				c.Elapsed, c.HasElapsed = d, true
+			}
+		case "eval":
+			// Some tools add the search depth: [%eval 0.25,20]
+			value, _, _ := strings.Cut(m[2], ",")
+			if !c.HasEval {
+				c.Eval, c.Mate, c.HasEval = parseEval(value)
+			}
+		}
+	}
+}
+
+// ParseClock parses a clock time such as 0:03:21, 3:21 or 1:02:03.5.
+func ParseClock(s string) (time.Duration, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, false
+	}
+	var seconds float64
+	for i, part := range parts {
+		var v float64
+		var err error
+		if i == len(parts)-1 {
+			v, err = strconv.ParseFloat(part, 64)
+		} else {
+			var n int
+			n, err = strconv.Atoi(part)
+			v = float64(n)
+		}
+		if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+			return 0, false
+		}
+		seconds = seconds*60 + v
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// parseEval parses an evaluation in pawns, such as 0.25 or -1.5, or a
+// mate in N, such as #3 or #-2.
+func parseEval(s string) (float64, int, bool) {
+	if mate, ok := strings.CutPrefix(s, "#"); ok {
+		n, err := strconv.Atoi(mate)
+		if err != nil || n == 0 {
+			return 0, 0, false
+		}
+		return 0, n, true
+	}
+	pawns, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(pawns, 0) || math.IsNaN(pawns) {
+		return 0, 0, false
+	}
+	return pawns, 0, true
+}
@@ -0,0 +1,62 @@
+package chess
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCommands(t *testing.T) {
+	tests := []struct {
+		comments []string
+		want     MoveCommands
+	}{
+		{[]string{"[%clk 0:03:21]"}, MoveCommands{Clock: 201 * time.Second, HasClock: true}},
+		{[]string{"[%emt 0:00:05.5] [%eval -1.25]"}, MoveCommands{
+			Elapsed: 5500 * time.Millisecond, HasElapsed: true, Eval: -1.25, HasEval: true}},
+		{[]string{"[%eval #-3]"}, MoveCommands{Mate: -3, HasEval: true}},
+		{[]string{"[%eval 0.25,20]"}, MoveCommands{Eval: 0.25, HasEval: true}},
+		// The first of each command counts; malformed ones are skipped
+		{[]string{"[%clk 1:00:00] good", "[%clk 0:59:00] [%eval x] [%eval 2]"}, MoveCommands{
+			Clock: time.Hour, HasClock: true, Eval: 2, HasEval: true}},
+		{[]string{"no commands [%csl Ga4]"}, MoveCommands{}},
+	}
+	for _, tt := range tests {
+		move := NewMove()
+		for _, text := range tt.comments {
+			move.Comments = append(move.Comments, &Comment{Text: text})
+		}
+		move.ParseCommands()
+		if move.Commands != tt.want {
+			t.Errorf("ParseCommands(%q) = %+v, want %+v", tt.comments, move.Commands, tt.want)
+		}
+	}
+
+	// AppendComment reads the commands it adds
+	move := NewMove()
+	move.AppendComment("[%eval 0.5]")
+	if !move.Commands.HasEval || move.Commands.Eval != 0.5 {
+		t.Errorf("after AppendComment, Commands = %+v", move.Commands)
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"0:03:21", 201 * time.Second, true},
+		{"3:21", 201 * time.Second, true},
+		{"45", 45 * time.Second, true},
+		{"1:02:03.5", time.Hour + 2*time.Minute + 3500*time.Millisecond, true},
+		{"1:2:3:4", 0, false},
+		{"-1:00", 0, false},
+		{"a:00", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseClock(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseClock(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
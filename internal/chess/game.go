@@ -45,6 +45,15 @@ type Game struct {
 	// Line numbers of the start and end of the game in the input file.
 	StartLine uint
 	EndLine   uint
+
+	// Byte offsets in the input of the line where the game starts and of
+	// the end of the line where it ends.
+	StartOffset int64
+	EndOffset   int64
+
+	// The input the game was read from and its 1-based number there.
+	SourceFile  string
+	SourceIndex int
 }
 
 // NewGame creates a new empty game.
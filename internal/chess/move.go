@@ -55,8 +55,8 @@ type Move struct {
 	// Zobrist hash code of the position after this move.
 	Zobrist uint64
 
-	// Evaluation of the position after this move.
-	Evaluation float64
+	// Clock, elapsed time and evaluation commands from the comments.
+	Commands MoveCommands
 
 	// Numeric Annotation Glyphs (!, ?, !!, ??, etc.).
 	NAGs []*NAG
@@ -67,6 +67,9 @@ type Move struct {
 	// Terminating result if this is the last move (e.g., "1-0", "0-1", "1/2-1/2").
 	TerminatingResult string
 
+	// Move number written before this move in the source, or 0 if none.
+	Number uint
+
 	// Alternative variations from this position.
 	Variations []*Variation
 
@@ -124,9 +127,11 @@ func (m *Move) HasVariations() bool {
 	return len(m.Variations) > 0
 }
 
-// AppendComment adds a comment to this move.
+// AppendComment adds a comment to this move, reading any commands in it
+// that the move does not have yet.
 func (m *Move) AppendComment(text string) {
 	m.Comments = append(m.Comments, &Comment{Text: text})
+	m.Commands.parse(text)
 }
 
 // AppendNAG adds a NAG to this move.
@@ -0,0 +1,93 @@
+package chess
+
+import "strings"
+
+// nagGlyphs are the NAGs with a conventional symbol. Where White and Black
+// have a NAG each for the same symbol, black holds Black's.
+var nagGlyphs = []struct {
+	white, black, glyph string
+}{
+	{"$1", "", "!"},
+	{"$2", "", "?"},
+	{"$3", "", "!!"},
+	{"$4", "", "??"},
+	{"$5", "", "!?"},
+	{"$6", "", "?!"},
+	{"$7", "", "□"},
+	{"$10", "", "="},
+	{"$13", "", "∞"},
+	{"$14", "", "⩲"},
+	{"$15", "", "⩱"},
+	{"$16", "", "±"},
+	{"$17", "", "∓"},
+	{"$18", "", "+−"},
+	{"$19", "", "−+"},
+	{"$22", "$23", "⨀"},
+	{"$32", "$33", "⟳"},
+	{"$36", "$37", "↑"},
+	{"$40", "$41", "→"},
+	{"$44", "$45", "=∞"},
+	{"$132", "$133", "⇆"},
+	{"$138", "$139", "⨁"},
+	{"$140", "", "∆"},
+	{"$146", "", "N"},
+}
+
+// IsMoveGlyph reports whether a glyph judges the move itself, as the
+// glyphs of $1 to $6 do, rather than the position.
+func IsMoveGlyph(glyph string) bool {
+	for _, g := range nagGlyphs[:6] {
+		if g.glyph == glyph {
+			return true
+		}
+	}
+	return false
+}
+
+// NAGGlyph returns the symbol of a NAG such as "$16", if it has one.
+func NAGGlyph(nag string) (string, bool) {
+	for _, g := range nagGlyphs {
+		if g.white == nag || g.black == nag {
+			return g.glyph, true
+		}
+	}
+	return "", false
+}
+
+// GlyphNAG returns the NAG of a symbol such as "±". A symbol with a NAG
+// for each side gives the one for the player who made the move, White's
+// when white is set.
+func GlyphNAG(glyph string, white bool) (string, bool) {
+	for _, g := range nagGlyphs {
+		if g.glyph != glyph {
+			continue
+		}
+		if !white && g.black != "" {
+			return g.black, true
+		}
+		return g.white, true
+	}
+	return "", false
+}
+
+// GlyphPrefix returns the longest symbol starting s that is not plain
+// ASCII, or "" if none does. The ASCII symbols are left out as they
+// overlap with move text and with the lexer's own handling of ! and ?.
+func GlyphPrefix(s string) string {
+	longest := ""
+	for _, g := range nagGlyphs {
+		if !isASCII(g.glyph) && len(g.glyph) > len(longest) && strings.HasPrefix(s, g.glyph) {
+			longest = g.glyph
+		}
+	}
+	return longest
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -8,14 +8,29 @@ type AnnotationConfig struct {
 	AddFENCastling bool   // Include castling rights in FEN
 	FENPattern     string // Pattern for FEN comments
 
+	// FEN comments only after these main-line plies, or every
+	// FENCommentEvery plies; with neither, after every move
+	FENCommentPlies map[int]bool
+	FENCommentEvery int
+
 	// Hash annotations
 	AddHashComments bool // Add position hash as comments
 	AddHashTag      bool // Add hashcode tag to game
 
+	// Time control annotations
+	AddTimeClassTag   bool // Add TimeClass tag derived from TimeControl
+	AddTerminationTag bool // Add Termination tag derived from the result, final position and comments
+
+	// Player annotations
+	AddPhoneticTags bool // Add WhiteSoundex and BlackSoundex tags
+
 	// Ply count annotations
 	AddPlyCount      bool // Add ply count to moves
 	AddTotalPlyCount bool // Add total ply count tag
 
+	PlyCountVariations  bool // Count variation moves in the PlyCount tag
+	AddLongestVariation bool // Add LongestVariationPly tag
+
 	// Match annotations
 	AddMatchTag      bool   // Add tag indicating match
 	AddMatchLabelTag bool   // Add label to match tag
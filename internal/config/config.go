@@ -23,6 +23,7 @@ const (
 	XLALG                      // Extended long algebraic with capture notation
 	XOLALG                     // XLALG with O-O castling notation
 	UCI                        // UCI format (same as LALG)
+	SANUCI                     // SAN with the UCI move (Nf3/g1f3)
 )
 
 // EcoDivision specifies how to divide output by ECO code.
@@ -43,6 +44,15 @@ const (
 	NoTags         TagOutputForm = 2
 )
 
+// NAGStyle specifies how NAGs are written.
+type NAGStyle int
+
+const (
+	NAGsAsRead   NAGStyle = iota // $-codes and glyphs as in the source
+	NumericNAGs                  // Glyphs converted to $-codes
+	SymbolicNAGs                 // $-codes with a conventional glyph converted to it
+)
+
 // SetupOutputStatus specifies how to handle games with Setup tags.
 type SetupOutputStatus int
 
@@ -52,6 +62,25 @@ const (
 	SetupTagOnly
 )
 
+// NullMovePolicy specifies how null moves ("--" or "Z0") are handled.
+type NullMovePolicy int
+
+const (
+	KeepNullMoves       NullMovePolicy = iota // Keep null moves as written
+	RejectNullMoves                           // Drop games containing a null move
+	NullMovesToComments                       // Replace a null move and its continuation with a comment
+)
+
+// DuplicateTagPolicy specifies which value wins when a tag is repeated
+// within one game header.
+type DuplicateTagPolicy int
+
+const (
+	KeepLastTag         DuplicateTagPolicy = iota // Later values replace earlier ones
+	KeepFirstTag                                  // The first value is kept
+	RejectDuplicateTags                           // Games with a repeated tag are dropped
+)
+
 // SourceFileType distinguishes between different types of input files.
 type SourceFileType int
 
@@ -93,6 +122,12 @@ type Config struct {
 	// Parsing options
 	AllowNullMoves      bool
 	AllowNestedComments bool
+	NullMovePolicy      NullMovePolicy
+	DuplicateTagPolicy  DuplicateTagPolicy
+
+	// Size limits (0 = unlimited); larger games are skipped while parsing
+	MaxGameBytes    int64
+	MaxCommentBytes int
 
 	// Chess960 support
 	Chess960Mode bool
@@ -5,6 +5,10 @@ type OutputConfig struct {
 	// Format specifies the output notation format (SAN, LALG, etc.)
 	Format OutputFormat
 
+	// SANUCISeparator joins each SAN move to its UCI move in SANUCI
+	// output; when empty the UCI move follows as a {uci: g1f3} comment
+	SANUCISeparator string
+
 	// MaxLineLength is the maximum line length for PGN output
 	MaxLineLength uint
 
@@ -23,6 +27,9 @@ type OutputConfig struct {
 	// KeepNAGs controls whether Numeric Annotation Glyphs are kept
 	KeepNAGs bool
 
+	// NAGStyle selects $-codes or glyphs for the NAGs kept
+	NAGStyle NAGStyle
+
 	// KeepComments controls whether comments are kept in output
 	KeepComments bool
 
@@ -35,20 +42,37 @@ type OutputConfig struct {
 	// TagFormat specifies which tags to output (AllTags, SevenTagRoster, NoTags)
 	TagFormat TagOutputForm
 
+	// TagsOnly writes each game's tags without its movetext, as a
+	// catalog of the games
+	TagsOnly bool
+
+	// MovesOnly writes each game's movetext without tags or the blank
+	// line before it
+	MovesOnly bool
+
 	// SeparateCommentLines puts each comment on its own line
 	SeparateCommentLines bool
 
+	// EPDBestMove writes the move played from each position as its bm
+	// operation in EPD output
+	EPDBestMove bool
+
 	// OutputEvaluation includes engine evaluation annotations
 	OutputEvaluation bool
 
 	// ECOMaxHandles is the maximum number of open file handles for ECO splitting
 	ECOMaxHandles int
+
+	// StableOutput makes output byte-identical across runs and platforms
+	// for the same input and options
+	StableOutput bool
 }
 
 // NewOutputConfig creates an OutputConfig with default values.
 func NewOutputConfig() *OutputConfig {
 	return &OutputConfig{
 		Format:          SAN,
+		SANUCISeparator: "/",
 		MaxLineLength:   80,
 		KeepMoveNumbers: true,
 		KeepResults:     true,
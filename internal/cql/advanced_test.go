@@ -4,7 +4,6 @@ import (
 	"testing"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
-	"github.com/lgbarn/pgn-extract-go/internal/engine"
 )
 
 func TestEvalResult(t *testing.T) {
@@ -16,7 +15,7 @@ func TestEvalResult(t *testing.T) {
 			"Black":  "Spassky",
 		},
 	}
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -52,7 +51,7 @@ func TestEvalPlayer(t *testing.T) {
 			"Black": "Spassky, Boris",
 		},
 	}
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -88,7 +87,7 @@ func TestEvalYear(t *testing.T) {
 			"Date": "1972.07.11",
 		},
 	}
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -127,7 +126,7 @@ func TestEvalElo(t *testing.T) {
 			"BlackElo": "2660",
 		},
 	}
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -158,7 +157,7 @@ func TestEvalElo(t *testing.T) {
 
 func TestEvalBetween(t *testing.T) {
 	// Position with pieces to test between filter
-	board := engine.MustBoardFromFEN("8/8/8/3q4/8/8/8/R3K3 w - - 0 1")
+	board := mustBoardFromFEN("8/8/8/3q4/8/8/8/R3K3 w - - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -191,7 +190,7 @@ func TestEvalBetween(t *testing.T) {
 
 func TestEvalPin(t *testing.T) {
 	// Position with pinned piece: black bishop on c6 pins white knight on d5 to white king on e4
-	board := engine.MustBoardFromFEN("8/8/2b5/3N4/4K3/8/8/8 w - - 0 1")
+	board := mustBoardFromFEN("8/8/2b5/3N4/4K3/8/8/8 w - - 0 1")
 
 	tests := []struct {
 		name     string
@@ -223,7 +222,7 @@ func TestEvalPin(t *testing.T) {
 
 func TestEvalRay(t *testing.T) {
 	// Position with pieces along a ray
-	board := engine.MustBoardFromFEN("8/8/8/8/R3K3/8/8/8 w - - 0 1")
+	board := mustBoardFromFEN("8/8/8/8/R3K3/8/8/8 w - - 0 1")
 
 	tests := []struct {
 		name     string
@@ -254,3 +253,114 @@ func TestEvalRay(t *testing.T) {
 		})
 	}
 }
+
+func TestEvalGameRangesAndText(t *testing.T) {
+	game := &chess.Game{
+		Tags: map[string]string{
+			"Event":    "World Championship 1972",
+			"Site":     "Reykjavik ISL",
+			"Date":     "1972.07.11",
+			"White":    "Spassky, Boris",
+			"Black":    "Fischer, Robert James",
+			"WhiteElo": "2660",
+			"BlackElo": "2785",
+		},
+	}
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+
+	tests := []struct {
+		cql      string
+		expected bool
+	}{
+		{`year 1950 1975`, true},
+		{`year 1975 1950`, true},
+		{`year 1972`, true},
+		{`year 1980 1990`, false},
+		{`(and (year 1970 1979) mate)`, false},
+		{`elo "white" 2600 2700`, true},
+		{`elo "black" 2600 2700`, false},
+		{`elo 2700`, true},
+		{`elo "white" 2700`, false},
+		{`elo 2800 2900`, false},
+		{`(> (elo "black") 2700)`, true},
+		{`(== (year) 1972)`, true},
+		{`player "fischer"`, true},
+		{`site "reykjavik"`, true},
+		{`site "Moscow"`, false},
+		{`event "/^world ch/"`, true},
+		{`event "/^Championship/"`, false},
+		{`player "/^spassky,/"`, true},
+		{`(and (event "world") (year 1970 1979) (player "/fischer/"))`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cql, func(t *testing.T) {
+			node, err := Parse(tt.cql)
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+
+			eval := NewEvaluatorWithGame(board, game)
+			result := eval.Evaluate(node)
+
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseBadTextPattern(t *testing.T) {
+	if _, err := Parse(`site "/[/"`); err == nil {
+		t.Error("expected an error for an invalid regular expression")
+	}
+}
+
+func TestEvalAnnotations(t *testing.T) {
+	move := &chess.Move{
+		Text:     "Nf3",
+		Comments: []*chess.Comment{{Text: "The main line"}},
+		NAGs: []*chess.NAG{
+			{Text: []string{"$1", "$14"}, Comments: []*chess.Comment{{Text: "slight edge"}}},
+			{Text: []string{"∓", "⇆"}},
+		},
+	}
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/5N2/PPPPPPPP/RNBQKB1R b KQkq - 1 1")
+
+	tests := []struct {
+		cql      string
+		expected bool
+	}{
+		{`comment "main line"`, true},
+		{`comment "EDGE"`, true},
+		{`comment "/^the/"`, true},
+		{`comment "novelty"`, false},
+		{`nag 1`, true},
+		{`nag 14`, true},
+		{`nag "$14"`, true},
+		{`nag 3`, false},
+		{`nag 17`, true},  // read as ∓
+		{`nag 133`, true}, // ⇆ stands for White's $132 and Black's $133
+		{`(and (nag 1) btm)`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cql, func(t *testing.T) {
+			node, err := Parse(tt.cql)
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+
+			eval := NewEvaluator(board)
+			eval.SetMove(move)
+			if result := eval.Evaluate(node); result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+
+			eval.SetMove(nil)
+			if eval.Evaluate(node) {
+				t.Error("annotation filters should not match without a move")
+			}
+		})
+	}
+}
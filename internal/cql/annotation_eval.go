@@ -0,0 +1,87 @@
+package cql
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// evalComment checks if a comment on the current move matches the given
+// text pattern.
+func (e *Evaluator) evalComment(args []Node) bool {
+	if len(args) < 1 || e.move == nil {
+		return false
+	}
+
+	patternArg, ok := args[0].(*StringNode)
+	if !ok {
+		return false
+	}
+	re, err := compileTextPattern(patternArg.Value)
+	if err != nil {
+		return false
+	}
+
+	for _, comment := range e.move.Comments {
+		if re.MatchString(comment.Text) {
+			return true
+		}
+	}
+	for _, nag := range e.move.NAGs {
+		for _, comment := range nag.Comments {
+			if re.MatchString(comment.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// evalNAG checks if the current move carries the given NAG, written as a
+// number (3) or in PGN form ("$3").
+func (e *Evaluator) evalNAG(args []Node) bool {
+	if len(args) < 1 || e.move == nil {
+		return false
+	}
+
+	var want int
+	switch arg := args[0].(type) {
+	case *NumberNode:
+		want = arg.Value
+	case *StringNode:
+		n, err := strconv.Atoi(strings.TrimPrefix(arg.Value, "$"))
+		if err != nil {
+			return false
+		}
+		want = n
+	default:
+		return false
+	}
+
+	for _, nag := range e.move.NAGs {
+		for _, text := range nag.Text {
+			if nagMatches(text, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nagMatches reports whether a NAG's text, a $-code or a glyph such as
+// "±", is NAG number want. A glyph shared by White's and Black's NAGs
+// matches either.
+func nagMatches(text string, want int) bool {
+	codes := []string{text}
+	if white, ok := chess.GlyphNAG(text, true); ok {
+		black, _ := chess.GlyphNAG(text, false)
+		codes = []string{white, black}
+	}
+	for _, code := range codes {
+		if n, err := strconv.Atoi(strings.TrimPrefix(code, "$")); err == nil && n == want {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,9 @@
 package cql
 
-import "strconv"
+import (
+	"strconv"
+	"sync"
+)
 
 // Node is the interface for all AST nodes.
 type Node interface {
@@ -12,6 +15,11 @@ type Node interface {
 type FilterNode struct {
 	Name string
 	Args []Node
+
+	// variants are the transformed arguments of a transformation filter,
+	// built on first evaluation
+	variantsOnce sync.Once
+	variants     []Node
 }
 
 func (f *FilterNode) node() {}
@@ -42,6 +50,65 @@ func (l *LogicalNode) String() string {
 	return result
 }
 
+// LineNode represents a line filter, whose constituents match consecutive
+// positions of the game starting with the current one: forwards for
+// "line --> a --> b", backwards for "line <-- a <-- b".
+type LineNode struct {
+	Backward     bool
+	Constituents []Node
+}
+
+func (l *LineNode) node() {}
+func (l *LineNode) String() string {
+	arrow := " --> "
+	if l.Backward {
+		arrow = " <-- "
+	}
+	result := "(line"
+	for _, c := range l.Constituents {
+		result += arrow + c.String()
+	}
+	return result + ")"
+}
+
+// SetOpNode represents set arithmetic on piece and square sets: the union
+// "(| a b ...)" or the intersection "(& a b ...)" of its operands.
+type SetOpNode struct {
+	Op       string // "|", "&"
+	Operands []Node
+}
+
+func (s *SetOpNode) node() {}
+func (s *SetOpNode) String() string {
+	result := "(" + s.Op
+	for _, operand := range s.Operands {
+		result += " " + operand.String()
+	}
+	return result + ")"
+}
+
+// VariableNode refers to a set variable, "$x".
+type VariableNode struct {
+	Name string
+}
+
+func (v *VariableNode) node() {}
+func (v *VariableNode) String() string {
+	return "$" + v.Name
+}
+
+// AssignNode binds a set variable to the value of a set expression at the
+// current position: "$x = [RQ]".
+type AssignNode struct {
+	Name  string
+	Value Node
+}
+
+func (a *AssignNode) node() {}
+func (a *AssignNode) String() string {
+	return "$" + a.Name + " = " + a.Value.String()
+}
+
 // ComparisonNode represents comparison operations.
 type ComparisonNode struct {
 	Op    string // "<", ">", "<=", ">=", "=="
@@ -0,0 +1,127 @@
+package cql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/errors"
+)
+
+// pieceDesignatorChars are the characters allowed in a piece designator.
+const pieceDesignatorChars = "KQRBNPkqrbnpAa_?"
+
+// parseSquareDesignator parses a square designator into the squares it
+// denotes. A designator is "." for every square, or a file part followed by
+// a rank part, where each part is a single file or rank, or a bracketed
+// list of them and of ranges, e.g. "e4", "[a-h]1", "e[1-8]", "[a-d][1-4]"
+// or "[ace][1-3]".
+func parseSquareDesignator(desig string) ([]square, error) {
+	if desig == "." {
+		squares := make([]square, 0, 64)
+		for rank := chess.Rank(0); rank < 8; rank++ {
+			for col := chess.Col(0); col < 8; col++ {
+				squares = append(squares, square{col, rank})
+			}
+		}
+		return squares, nil
+	}
+
+	files, rest, err := parseDesignatorPart(desig, 'a', 'h', "file")
+	if err != nil {
+		return nil, err
+	}
+	ranks, rest, err := parseDesignatorPart(rest, '1', '8', "rank")
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("unexpected %q after rank", rest)
+	}
+
+	squares := make([]square, 0, len(files)*len(ranks))
+	for _, f := range files {
+		for _, r := range ranks {
+			squares = append(squares, square{chess.Col(f - 'a'), chess.Rank(r - '1')})
+		}
+	}
+	return squares, nil
+}
+
+// parseDesignatorPart parses the file or rank part at the start of s: one
+// character in [lo, hi] or a bracketed list such as "[a-ce]". It returns
+// the characters denoted and the remainder of s.
+func parseDesignatorPart(s string, lo, hi byte, what string) ([]byte, string, error) {
+	if s == "" {
+		return nil, "", fmt.Errorf("missing %s", what)
+	}
+	if s[0] != '[' {
+		if s[0] < lo || s[0] > hi {
+			return nil, "", fmt.Errorf("%q is not a %s (%c-%c)", s[0], what, lo, hi)
+		}
+		return []byte{s[0]}, s[1:], nil
+	}
+
+	end := strings.IndexByte(s, ']')
+	if end == -1 {
+		return nil, "", fmt.Errorf("unterminated %s range %q", what, s)
+	}
+	list := s[1:end]
+	if list == "" {
+		return nil, "", fmt.Errorf("empty %s range", what)
+	}
+
+	var chars []byte
+	seen := make(map[byte]bool)
+	for i := 0; i < len(list); i++ {
+		first, last := list[i], list[i]
+		if i+2 < len(list) && list[i+1] == '-' {
+			last = list[i+2]
+			i += 2
+		}
+		if first < lo || first > hi || last < lo || last > hi {
+			return nil, "", fmt.Errorf("%s range %q: %c-%c only", what, list, lo, hi)
+		}
+		if first > last {
+			return nil, "", fmt.Errorf("%s range %q is reversed", what, list)
+		}
+		for c := first; c <= last; c++ {
+			if !seen[c] {
+				seen[c] = true
+				chars = append(chars, c)
+			}
+		}
+	}
+	return chars, s[end+1:], nil
+}
+
+// validatePieceDesignator checks a piece designator: a single piece
+// character or a bracketed, non-empty set of them such as "[RQ]".
+func validatePieceDesignator(desig string) error {
+	chars := desig
+	if strings.HasPrefix(desig, "[") {
+		if !strings.HasSuffix(desig, "]") || len(desig) < 2 {
+			return fmt.Errorf("unterminated piece set %q", desig)
+		}
+		chars = desig[1 : len(desig)-1]
+		if chars == "" {
+			return fmt.Errorf("empty piece set")
+		}
+	} else if len(desig) != 1 {
+		return fmt.Errorf("%q is not a piece", desig)
+	}
+	for i := 0; i < len(chars); i++ {
+		if !strings.ContainsRune(pieceDesignatorChars, rune(chars[i])) {
+			return fmt.Errorf("%q is not a piece", chars[i])
+		}
+	}
+	return nil
+}
+
+// designatorError reports an invalid designator at a position in the query.
+func designatorError(tok Token, kind string, err error) error {
+	return &errors.ParseError{
+		Err:    fmt.Errorf("invalid %s designator %q: %v: %w", kind, tok.Literal, err, errors.ErrCQLSyntax),
+		Column: tok.Pos + 1,
+	}
+}
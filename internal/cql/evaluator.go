@@ -1,15 +1,31 @@
 package cql
 
 import (
-	"strings"
-
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/matching"
 )
 
 // Evaluator evaluates CQL expressions against a chess position.
 type Evaluator struct {
 	board *chess.Board
 	game  *chess.Game // Optional, for game-level filters
+	move  *chess.Move // Optional, the move that reached the board
+
+	// line holds the game's positions for sequential filters, and ply the
+	// index of the current one; line is nil for a single position
+	line *gameLine
+	ply  int
+
+	// vars holds the set variables bound while evaluating the query at
+	// the current starting position
+	vars map[string]squareSet
+
+	// memo holds node results for the current position while a
+	// transformation filter is evaluated; nil otherwise
+	memo map[Node]bool
+
+	// values weigh material; nil means the standard values
+	values *matching.PieceValues
 }
 
 // NewEvaluator creates a new evaluator for the given board position.
@@ -32,8 +48,26 @@ func (e *Evaluator) SetGame(game *chess.Game) {
 	e.game = game
 }
 
+// SetMove sets the move that led to the current board, used by annotation
+// filters. It is nil for the starting position.
+func (e *Evaluator) SetMove(move *chess.Move) {
+	e.move = move
+}
+
 // Evaluate evaluates the CQL expression and returns true if it matches.
 func (e *Evaluator) Evaluate(node Node) bool {
+	if e.memo == nil {
+		return e.evaluate(node)
+	}
+	if result, ok := e.memo[node]; ok {
+		return result
+	}
+	result := e.evaluate(node)
+	e.memo[node] = result
+	return result
+}
+
+func (e *Evaluator) evaluate(node Node) bool {
 	switch n := node.(type) {
 	case *FilterNode:
 		return e.evalFilter(n)
@@ -41,8 +75,14 @@ func (e *Evaluator) Evaluate(node Node) bool {
 		return e.evalLogical(n)
 	case *ComparisonNode:
 		return e.evalComparison(n)
+	case *LineNode:
+		return e.evalLine(n)
+	case *AssignNode:
+		return e.evalAssign(n)
 	default:
-		return false
+		// A set matches when it is not empty
+		set, ok := e.evalSet(node)
+		return ok && set != 0
 	}
 }
 
@@ -65,24 +105,30 @@ func (e *Evaluator) evalFilter(f *FilterNode) bool {
 	case "count":
 		// Count returns a number, handled in comparison
 		return false
+	case "piecevalues":
+		// Sets the values for the whole query, see Query.pieceValues
+		return true
 	// Transformation filters
-	case "flip":
-		return e.evalFlip(f.Args)
-	case "flipvertical":
-		return e.evalFlipVertical(f.Args)
-	case "flipcolor":
-		return e.evalFlipColor(f.Args)
-	case "shift":
-		return e.evalShift(f.Args)
-	case "shifthorizontal":
-		return e.evalShiftHorizontal(f.Args)
-	case "shiftvertical":
-		return e.evalShiftVertical(f.Args)
+	case "flip", "flipvertical", "flipcolor", "shift", "shifthorizontal", "shiftvertical":
+		return e.evalTransform(f)
 	// Game-level filters
 	case "result":
 		return e.evalResult(f.Args)
 	case "player":
 		return e.evalPlayer(f.Args)
+	case "site":
+		return e.evalTagText("Site", f.Args)
+	case "event":
+		return e.evalTagText("Event", f.Args)
+	case "year":
+		return e.evalYearRange(f.Args)
+	case "elo":
+		return e.evalEloRange(f.Args)
+	// Annotation filters
+	case "comment":
+		return e.evalComment(f.Args)
+	case "nag":
+		return e.evalNAG(f.Args)
 	// Position filters
 	case "between":
 		return e.evalBetween(f.Args)
@@ -90,6 +136,13 @@ func (e *Evaluator) evalFilter(f *FilterNode) bool {
 		return e.evalPin(f.Args)
 	case "ray":
 		return e.evalRay(f.Args)
+	// Sequential filters
+	case "next":
+		return len(f.Args) > 0 && e.evalAt(e.ply+1, f.Args[0])
+	case "previous":
+		return len(f.Args) > 0 && e.evalAt(e.ply-1, f.Args[0])
+	case "move":
+		return e.evalMove(f.Args)
 	default:
 		return false
 	}
@@ -141,20 +194,22 @@ func (e *Evaluator) evalComparison(c *ComparisonNode) bool {
 	}
 }
 
-func (e *Evaluator) evalNumeric(node Node) int {
+// evalNumeric returns the value of a comparison operand. It is a float
+// for material, which piece values may make fractional.
+func (e *Evaluator) evalNumeric(node Node) float64 {
 	switch n := node.(type) {
 	case *NumberNode:
-		return n.Value
+		return float64(n.Value)
 	case *FilterNode:
 		switch n.Name {
 		case "count":
-			return e.evalCount(n.Args)
+			return float64(e.evalCount(n.Args))
 		case "material":
 			return e.evalMaterial(n.Args)
 		case "year":
-			return e.evalYear()
+			return float64(e.evalYear())
 		case "elo":
-			return e.evalElo(n.Args)
+			return float64(e.evalElo(n.Args))
 		}
 	}
 	return 0
@@ -167,146 +222,16 @@ type square struct {
 	rank chess.Rank
 }
 
+// parseSquareSet returns the squares of a designator. Designators are
+// validated when the query is parsed, so an invalid one matches nothing.
 func (e *Evaluator) parseSquareSet(desig string) []square {
-	if desig == "." {
-		// All squares
-		squares := make([]square, 0, 64)
-		for rank := chess.Rank(0); rank < 8; rank++ {
-			for col := chess.Col(0); col < 8; col++ {
-				squares = append(squares, square{col, rank})
-			}
-		}
-		return squares
-	}
-
-	// Simple single square like "e1"
-	if len(desig) == 2 && desig[0] >= 'a' && desig[0] <= 'h' && desig[1] >= '1' && desig[1] <= '8' {
-		col := chess.Col(desig[0] - 'a')
-		rank := chess.Rank(desig[1] - '1')
-		return []square{{col, rank}}
-	}
-
-	// Range patterns like [a-h]1, a[1-8], [a-d][1-4]
-	// For now, handle simple patterns
-	var squares []square
-
-	// Try to parse as range pattern
-	files := "abcdefgh"
-	ranks := "12345678"
-
-	if strings.HasPrefix(desig, "[") {
-		// [a-h]1 or [a-d][1-4] pattern
-		return e.parseComplexSquareSet(desig)
-	}
-
-	// a[1-8] pattern
-	if len(desig) > 2 && desig[1] == '[' {
-		file := desig[0]
-		if file >= 'a' && file <= 'h' {
-			col := chess.Col(file - 'a')
-			// Parse rank range
-			rankRange := desig[2 : len(desig)-1] // Remove brackets
-			parts := strings.Split(rankRange, "-")
-			if len(parts) == 2 {
-				startRank := parts[0][0] - '1'
-				endRank := parts[1][0] - '1'
-				for r := startRank; r <= endRank; r++ {
-					squares = append(squares, square{col, chess.Rank(r)})
-				}
-				return squares
-			}
-		}
-	}
-
-	// Fallback: treat each character
-	for _, r := range ranks {
-		for _, f := range files {
-			if strings.Contains(desig, string(f)) && strings.Contains(desig, string(r)) {
-				col := chess.Col(f - 'a')
-				rank := chess.Rank(r - '1')
-				squares = append(squares, square{col, rank})
-			}
-		}
+	squares, err := parseSquareDesignator(desig)
+	if err != nil {
+		return nil
 	}
-
 	return squares
 }
 
-func (e *Evaluator) parseComplexSquareSet(desig string) []square {
-	var squares []square
-
-	// [a-h]1 pattern
-	if strings.HasPrefix(desig, "[") && !strings.Contains(desig[1:], "[") {
-		// Single file range with rank
-		closeBracket := strings.Index(desig, "]")
-		if closeBracket == -1 {
-			return squares
-		}
-		fileRange := desig[1:closeBracket]
-		rankPart := desig[closeBracket+1:]
-
-		files := e.parseRange(fileRange, 'a', 'h')
-		if len(rankPart) == 1 && rankPart[0] >= '1' && rankPart[0] <= '8' {
-			rank := chess.Rank(rankPart[0] - '1')
-			for _, f := range files {
-				squares = append(squares, square{chess.Col(f - 'a'), rank})
-			}
-		}
-		return squares
-	}
-
-	// [a-d][1-4] pattern
-	firstClose := strings.Index(desig, "]")
-	if firstClose == -1 {
-		return squares
-	}
-	secondOpen := strings.Index(desig[firstClose:], "[")
-	if secondOpen == -1 {
-		return squares
-	}
-	secondOpen += firstClose
-
-	fileRange := desig[1:firstClose]
-	rankRange := desig[secondOpen+1 : len(desig)-1]
-
-	files := e.parseRange(fileRange, 'a', 'h')
-	ranks := e.parseRange(rankRange, '1', '8')
-
-	for _, f := range files {
-		for _, r := range ranks {
-			squares = append(squares, square{chess.Col(f - 'a'), chess.Rank(r - '1')})
-		}
-	}
-
-	return squares
-}
-
-func (e *Evaluator) parseRange(rangeStr string, min, max byte) []byte {
-	var result []byte
-
-	if strings.Contains(rangeStr, "-") {
-		parts := strings.Split(rangeStr, "-")
-		if len(parts) == 2 && len(parts[0]) == 1 && len(parts[1]) == 1 {
-			start := parts[0][0]
-			end := parts[1][0]
-			if start >= min && end <= max && start <= end {
-				for c := start; c <= end; c++ {
-					result = append(result, c)
-				}
-			}
-		}
-	} else {
-		// Individual characters
-		for _, c := range rangeStr {
-			if byte(c) >= min && byte(c) <= max {
-				result = append(result, byte(c))
-			}
-		}
-	}
-
-	return result
-}
-
 func abs(x int) int {
 	if x < 0 {
 		return -x
@@ -3,12 +3,23 @@ package cql
 import (
 	"testing"
 
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
 	"github.com/lgbarn/pgn-extract-go/internal/engine"
 )
 
+// mustBoardFromFEN creates a board from a FEN string known to be valid,
+// panicking on error.
+func mustBoardFromFEN(fen string) *chess.Board {
+	board, err := engine.NewBoardFromFEN(fen)
+	if err != nil {
+		panic(err)
+	}
+	return board
+}
+
 func TestEvalPieceOnSquare(t *testing.T) {
 	// Standard starting position
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -59,7 +70,7 @@ func TestEvalSideToMove(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.cql, func(t *testing.T) {
-			board := engine.MustBoardFromFEN(tt.fen)
+			board := mustBoardFromFEN(tt.fen)
 			node, err := Parse(tt.cql)
 			if err != nil {
 				t.Fatalf("Parse error: %v", err)
@@ -89,7 +100,7 @@ func TestEvalCheck(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			board := engine.MustBoardFromFEN(tt.fen)
+			board := mustBoardFromFEN(tt.fen)
 			node, err := Parse("check")
 			if err != nil {
 				t.Fatalf("Parse error: %v", err)
@@ -119,7 +130,7 @@ func TestEvalMate(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			board := engine.MustBoardFromFEN(tt.fen)
+			board := mustBoardFromFEN(tt.fen)
 			node, err := Parse("mate")
 			if err != nil {
 				t.Fatalf("Parse error: %v", err)
@@ -148,7 +159,7 @@ func TestEvalStalemate(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			board := engine.MustBoardFromFEN(tt.fen)
+			board := mustBoardFromFEN(tt.fen)
 			node, err := Parse("stalemate")
 			if err != nil {
 				t.Fatalf("Parse error: %v", err)
@@ -165,7 +176,7 @@ func TestEvalStalemate(t *testing.T) {
 }
 
 func TestEvalLogicalAnd(t *testing.T) {
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -195,7 +206,7 @@ func TestEvalLogicalAnd(t *testing.T) {
 }
 
 func TestEvalLogicalOr(t *testing.T) {
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -224,7 +235,7 @@ func TestEvalLogicalOr(t *testing.T) {
 }
 
 func TestEvalLogicalNot(t *testing.T) {
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -269,7 +280,7 @@ func TestEvalAttack(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			board := engine.MustBoardFromFEN(tt.fen)
+			board := mustBoardFromFEN(tt.fen)
 			node, err := Parse(tt.cql)
 			if err != nil {
 				t.Fatalf("Parse error: %v", err)
@@ -287,7 +298,7 @@ func TestEvalAttack(t *testing.T) {
 
 func TestEvalComplexQuery(t *testing.T) {
 	// Fool's mate position
-	board := engine.MustBoardFromFEN("rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3")
+	board := mustBoardFromFEN("rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3")
 
 	tests := []struct {
 		cql      string
@@ -320,7 +331,7 @@ func TestEvalComplexQuery(t *testing.T) {
 
 func TestEvalPieceDesignatorAnyWhite(t *testing.T) {
 	// Standard starting position
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -352,7 +363,7 @@ func TestEvalPieceDesignatorAnyWhite(t *testing.T) {
 
 func TestEvalPieceDesignatorAnyBlack(t *testing.T) {
 	// Standard starting position
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -384,7 +395,7 @@ func TestEvalPieceDesignatorAnyBlack(t *testing.T) {
 
 func TestEvalPieceDesignatorEmpty(t *testing.T) {
 	// Standard starting position
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -415,7 +426,7 @@ func TestEvalPieceDesignatorEmpty(t *testing.T) {
 
 func TestEvalPieceDesignatorAny(t *testing.T) {
 	// Standard starting position
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -446,7 +457,7 @@ func TestEvalPieceDesignatorAny(t *testing.T) {
 
 func TestEvalPieceSet(t *testing.T) {
 	// Standard starting position
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -480,7 +491,7 @@ func TestEvalPieceSet(t *testing.T) {
 
 func TestEvalSquareSetRank(t *testing.T) {
 	// Standard starting position
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -511,7 +522,7 @@ func TestEvalSquareSetRank(t *testing.T) {
 
 func TestEvalSquareSetFile(t *testing.T) {
 	// Standard starting position
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -543,7 +554,7 @@ func TestEvalSquareSetFile(t *testing.T) {
 
 func TestEvalSquareSetQuadrant(t *testing.T) {
 	// Standard starting position
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -575,7 +586,7 @@ func TestEvalSquareSetQuadrant(t *testing.T) {
 
 func TestEvalSquareSetAny(t *testing.T) {
 	// Standard starting position
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -606,7 +617,7 @@ func TestEvalSquareSetAny(t *testing.T) {
 
 func TestEvalCount(t *testing.T) {
 	// Standard starting position
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -641,7 +652,7 @@ func TestEvalCount(t *testing.T) {
 func TestEvalMaterial(t *testing.T) {
 	// Standard starting position
 	// White material: 8*1 (pawns) + 2*3 (knights) + 2*3 (bishops) + 2*5 (rooks) + 1*9 (queen) = 8+6+6+10+9 = 39
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -673,7 +684,7 @@ func TestEvalMaterial(t *testing.T) {
 
 func TestEvalMaterialImbalance(t *testing.T) {
 	// Position with material imbalance: white is up a queen
-	board := engine.MustBoardFromFEN("rnb1kbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnb1kbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
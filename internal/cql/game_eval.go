@@ -1,8 +1,11 @@
 package cql
 
 import (
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/lgbarn/pgn-extract-go/internal/engine"
 )
@@ -33,24 +36,112 @@ func (e *Evaluator) evalResult(args []Node) bool {
 		return false
 	}
 
-	return gameResult == resultArg.Value
+	return strings.EqualFold(gameResult, resultArg.Value)
 }
 
-// evalPlayer checks if either player name contains the given substring.
+// evalPlayer checks if either player name matches the given text pattern.
 func (e *Evaluator) evalPlayer(args []Node) bool {
+	return e.evalTagText("White", args) || e.evalTagText("Black", args)
+}
+
+// evalTagText checks if a tag value matches the given text pattern.
+// Patterns are case-insensitive substrings, or regular expressions
+// when written between slashes, e.g. "/^World Ch/".
+func (e *Evaluator) evalTagText(tag string, args []Node) bool {
 	if len(args) < 1 || e.game == nil {
 		return false
 	}
 
-	playerArg, ok := args[0].(*StringNode)
+	patternArg, ok := args[0].(*StringNode)
 	if !ok {
 		return false
 	}
 
-	white := e.game.Tags["White"]
-	black := e.game.Tags["Black"]
+	value, ok := e.game.Tags[tag]
+	if !ok {
+		return false
+	}
+
+	re, err := compileTextPattern(patternArg.Value)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(value)
+}
 
-	return strings.Contains(white, playerArg.Value) || strings.Contains(black, playerArg.Value)
+// textPatternCache holds compiled text patterns, which are evaluated
+// at every position of every game.
+var textPatternCache sync.Map
+
+// compileTextPattern compiles a CQL text pattern to a case-insensitive
+// regular expression.
+func compileTextPattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := textPatternCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	expr := regexp.QuoteMeta(pattern)
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expr = pattern[1 : len(pattern)-1]
+	}
+	re, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		return nil, err
+	}
+	textPatternCache.Store(pattern, re)
+	return re, nil
+}
+
+// evalYearRange checks if the game year equals the given year, or lies
+// within the inclusive range when two years are given.
+func (e *Evaluator) evalYearRange(args []Node) bool {
+	year := e.evalYear()
+	return year != 0 && inRange(year, args)
+}
+
+// evalEloRange checks if a rating lies within the given inclusive range
+// (or is at least the single bound). An optional leading "white" or
+// "black" selects the player; otherwise either player may match.
+func (e *Evaluator) evalEloRange(args []Node) bool {
+	if len(args) < 1 || e.game == nil {
+		return false
+	}
+
+	colors := []Node{&StringNode{Value: "white"}, &StringNode{Value: "black"}}
+	if _, ok := args[0].(*NumberNode); !ok {
+		colors, args = args[:1], args[1:]
+	}
+	if len(args) == 1 {
+		args = append(args, &NumberNode{Value: math.MaxInt})
+	}
+
+	for _, color := range colors {
+		if elo := e.evalElo([]Node{color}); elo != 0 && inRange(elo, args) {
+			return true
+		}
+	}
+	return false
+}
+
+// inRange checks value against one number (equality) or two numbers
+// (inclusive range, in either order).
+func inRange(value int, args []Node) bool {
+	var bounds []int
+	for _, arg := range args {
+		if n, ok := arg.(*NumberNode); ok {
+			bounds = append(bounds, n.Value)
+		}
+	}
+
+	switch len(bounds) {
+	case 1:
+		return value == bounds[0]
+	case 2:
+		lo, hi := min(bounds[0], bounds[1]), max(bounds[0], bounds[1])
+		return value >= lo && value <= hi
+	default:
+		return false
+	}
 }
 
 // evalYear returns the year from the Date tag.
@@ -87,7 +178,7 @@ func (e *Evaluator) evalElo(args []Node) int {
 	}
 
 	var eloTag string
-	switch color {
+	switch strings.ToLower(color) {
 	case "white":
 		eloTag = "WhiteElo"
 	case "black":
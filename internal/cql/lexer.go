@@ -26,6 +26,7 @@ const (
 	PIECESET  // [RQ], [RBN], etc.
 	SQUARE    // a1, e4, h8, .
 	SQUARESET // [a-h]1, a[1-8], [a-d][1-4]
+	VARIABLE  // $x (the literal is the name without $)
 
 	// Operators
 	LT // <
@@ -33,6 +34,15 @@ const (
 	LE // <=
 	GE // >=
 	EQ // ==
+
+	// Line arrows
+	FORWARD  // -->
+	BACKWARD // <--
+
+	// Set variables and operations
+	ASSIGN    // =
+	UNION     // |
+	INTERSECT // &
 )
 
 var tokenNames = map[TokenType]string{
@@ -47,11 +57,17 @@ var tokenNames = map[TokenType]string{
 	PIECESET:  "PIECESET",
 	SQUARE:    "SQUARE",
 	SQUARESET: "SQUARESET",
+	VARIABLE:  "VARIABLE",
 	LT:        "LT",
 	GT:        "GT",
 	LE:        "LE",
 	GE:        "GE",
 	EQ:        "EQ",
+	FORWARD:   "FORWARD",
+	BACKWARD:  "BACKWARD",
+	ASSIGN:    "ASSIGN",
+	UNION:     "UNION",
+	INTERSECT: "INTERSECT",
 }
 
 func (t TokenType) String() string {
@@ -111,7 +127,7 @@ func (l *Lexer) NextToken() Token {
 	l.skipWhitespace()
 
 	var tok Token
-	tok.Pos = l.pos
+	start := l.pos
 
 	switch l.ch {
 	case 0:
@@ -126,7 +142,12 @@ func (l *Lexer) NextToken() Token {
 		tok.Literal = ")"
 		l.readChar()
 	case '<':
-		if l.peekChar() == '=' {
+		if strings.HasPrefix(l.input[l.pos:], "<--") {
+			tok.Type = BACKWARD
+			tok.Literal = "<--"
+			l.readChar()
+			l.readChar()
+		} else if l.peekChar() == '=' {
 			l.readChar()
 			tok.Type = LE
 			tok.Literal = "<="
@@ -152,10 +173,41 @@ func (l *Lexer) NextToken() Token {
 			tok.Literal = "=="
 			l.readChar()
 		} else {
+			tok.Type = ASSIGN
+			tok.Literal = "="
+			l.readChar()
+		}
+	case '|':
+		tok.Type = UNION
+		tok.Literal = "|"
+		l.readChar()
+	case '&':
+		tok.Type = INTERSECT
+		tok.Literal = "&"
+		l.readChar()
+	case '$':
+		l.readChar()
+		nameStart := l.pos
+		for isLetter(l.ch) || isDigit(l.ch) || l.ch == '_' {
+			l.readChar()
+		}
+		tok.Type = VARIABLE
+		tok.Literal = l.input[nameStart:l.pos]
+		if tok.Literal == "" {
 			tok.Type = ILLEGAL
-			tok.Literal = string(l.ch)
+			tok.Literal = "$"
+		}
+	case '-':
+		if strings.HasPrefix(l.input[l.pos:], "-->") {
+			tok.Type = FORWARD
+			tok.Literal = "-->"
+			l.readChar()
 			l.readChar()
+		} else {
+			tok.Type = ILLEGAL
+			tok.Literal = string(l.ch)
 		}
+		l.readChar()
 	case '"':
 		tok.Type = STRING
 		tok.Literal = l.readString()
@@ -185,6 +237,7 @@ func (l *Lexer) NextToken() Token {
 		}
 	}
 
+	tok.Pos = start
 	return tok
 }
 
@@ -244,7 +297,7 @@ func (l *Lexer) readBracketExpr() Token {
 	}
 
 	// Determine if it's a piece set or square set
-	inner := content[1 : len(content)-1] // Remove brackets
+	inner := strings.TrimSuffix(content[1:], "]") // Remove brackets
 	if isPieceSetContent(inner) {
 		return Token{Type: PIECESET, Literal: content}
 	}
@@ -301,8 +354,11 @@ func (l *Lexer) readIdentOrPieceOrSquare() Token {
 		return Token{Type: PIECE, Literal: string(firstChar)}
 	}
 
-	// Read the rest as identifier
+	// Read the rest as identifier, stopping at a line arrow
 	for isLetter(l.ch) || isDigit(l.ch) || l.ch == '-' || l.ch == '_' {
+		if strings.HasPrefix(l.input[l.pos:], "-->") {
+			break
+		}
 		l.readChar()
 	}
 
@@ -195,6 +195,13 @@ func TestLexerOperators(t *testing.T) {
 		{"<=", LE},
 		{">=", GE},
 		{"==", EQ},
+		{"-->", FORWARD},
+		{"<--", BACKWARD},
+		{"=", ASSIGN},
+		{"|", UNION},
+		{"&", INTERSECT},
+		{"$rook", VARIABLE},
+		{"$", ILLEGAL},
 	}
 
 	for _, tt := range tests {
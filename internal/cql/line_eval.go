@@ -0,0 +1,153 @@
+package cql
+
+import (
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+)
+
+// gameLine is the main line of a game replayed for sequential filters:
+// boards[i] is the position after i plies and moves[i] the move played
+// from it.
+type gameLine struct {
+	boards []*chess.Board
+	moves  []*chess.Move
+}
+
+// replayLine replays the main line of a game up to its first illegal move.
+func replayLine(game *chess.Game) *gameLine {
+	board := engine.NewBoardForGame(game)
+	line := &gameLine{boards: []*chess.Board{board.Copy()}}
+	for move := game.Moves; move != nil; move = move.Next {
+		if !engine.ApplyMove(board, move) {
+			break
+		}
+		line.moves = append(line.moves, move)
+		line.boards = append(line.boards, board.Copy())
+	}
+	return line
+}
+
+// usesLine reports whether a query contains a sequential filter, which
+// needs the whole game rather than one position at a time.
+func usesLine(node Node) bool {
+	switch n := node.(type) {
+	case *LineNode:
+		return true
+	case *FilterNode:
+		if sequenceFilters[n.Name] || n.Name == "move" {
+			return true
+		}
+		for _, arg := range n.Args {
+			if usesLine(arg) {
+				return true
+			}
+		}
+	case *LogicalNode:
+		for _, child := range n.Children {
+			if usesLine(child) {
+				return true
+			}
+		}
+	case *ComparisonNode:
+		return usesLine(n.Left) || usesLine(n.Right)
+	}
+	return false
+}
+
+// setPly makes the position after ply plies the current one.
+func (e *Evaluator) setPly(ply int) {
+	e.ply = ply
+	e.board = e.line.boards[ply]
+	e.move = nil
+	if ply > 0 {
+		e.move = e.line.moves[ply-1]
+	}
+}
+
+// evalAt evaluates node at the position after ply plies. Positions outside
+// the game, or other than the current one when there is no game line, do
+// not match.
+func (e *Evaluator) evalAt(ply int, node Node) bool {
+	if ply == e.ply {
+		return e.Evaluate(node)
+	}
+	if e.line == nil || ply < 0 || ply >= len(e.line.boards) {
+		return false
+	}
+
+	// Memoized results belong to the current position
+	current, memo := e.ply, e.memo
+	e.setPly(ply)
+	e.memo = nil
+	result := e.Evaluate(node)
+	e.setPly(current)
+	e.memo = memo
+	return result
+}
+
+// evalLine checks that the constituents of a line filter match consecutive
+// positions, from the current one forwards or backwards.
+func (e *Evaluator) evalLine(l *LineNode) bool {
+	step := 1
+	if l.Backward {
+		step = -1
+	}
+	for i, constituent := range l.Constituents {
+		if !e.evalAt(e.ply+i*step, constituent) {
+			return false
+		}
+	}
+	return true
+}
+
+// evalMove checks that the move played from the current position leaves
+// one of the first square set for one of the second: "move e2 e4",
+// "move . [a-h]8". Castling moves both the king and the rook.
+func (e *Evaluator) evalMove(args []Node) bool {
+	if len(args) < 2 || e.line == nil || e.ply >= len(e.line.moves) {
+		return false
+	}
+	fromArg, okFrom := args[0].(*SquareNode)
+	toArg, okTo := args[1].(*SquareNode)
+	if !okFrom || !okTo {
+		return false
+	}
+
+	from, to := movedSquares(e.line.boards[e.ply], e.line.boards[e.ply+1])
+	return anySquareIn(from, e.parseSquareSet(fromArg.Designator)) &&
+		anySquareIn(to, e.parseSquareSet(toArg.Designator))
+}
+
+// movedSquares compares the positions before and after a move: the mover's
+// pieces left the from squares and arrived on the to squares. Captured
+// pieces, including one taken en passant, are not the mover's.
+func movedSquares(before, after *chess.Board) (from, to []square) {
+	mover := before.ToMove
+	for rank := chess.Rank(0); rank < 8; rank++ {
+		for col := chess.Col(0); col < 8; col++ {
+			was := before.Squares[col+chess.Hedge][rank+chess.Hedge]
+			now := after.Squares[col+chess.Hedge][rank+chess.Hedge]
+			if was == now {
+				continue
+			}
+			if was != chess.Empty && chess.ExtractColour(was) == mover {
+				from = append(from, square{col, rank})
+			}
+			if now != chess.Empty && chess.ExtractColour(now) == mover {
+				to = append(to, square{col, rank})
+			}
+		}
+	}
+	return from, to
+}
+
+func anySquareIn(squares, set []square) bool {
+	for _, sq := range squares {
+		for _, s := range set {
+			if sq == s {
+				return true
+			}
+		}
+	}
+	return false
+}
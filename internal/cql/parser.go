@@ -2,9 +2,11 @@ package cql
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 
 	"github.com/lgbarn/pgn-extract-go/internal/errors"
+	"github.com/lgbarn/pgn-extract-go/internal/matching"
 )
 
 // Parser parses CQL expressions into an AST.
@@ -12,6 +14,7 @@ type Parser struct {
 	lexer   *Lexer
 	current Token
 	peek    Token
+	operand bool // parsing a comparison operand
 }
 
 // NewParser creates a new parser for the given input.
@@ -78,10 +81,16 @@ func (p *Parser) parsePrimary() (Node, error) {
 	case IDENT:
 		return p.parseFilter()
 	case PIECE, PIECESET:
+		if err := validatePieceDesignator(p.current.Literal); err != nil {
+			return nil, designatorError(p.current, "piece", err)
+		}
 		node := &PieceNode{Designator: p.current.Literal}
 		p.nextToken()
 		return node, nil
 	case SQUARE, SQUARESET:
+		if _, err := parseSquareDesignator(p.current.Literal); err != nil {
+			return nil, designatorError(p.current, "square", err)
+		}
 		node := &SquareNode{Designator: p.current.Literal}
 		p.nextToken()
 		return node, nil
@@ -99,11 +108,27 @@ func (p *Parser) parsePrimary() (Node, error) {
 		return node, nil
 	case LT, GT, LE, GE, EQ:
 		return p.parseComparison()
+	case VARIABLE:
+		return p.parseVariable()
 	default:
 		return nil, fmt.Errorf("unexpected token: %v (%q): %w", p.current.Type, p.current.Literal, errors.ErrCQLSyntax)
 	}
 }
 
+// unknownIdentError reports an identifier that is not a filter. One that
+// looks like a square, such as "i9", is reported as a bad designator.
+func (p *Parser) unknownIdentError() error {
+	tok := p.current
+	if len(tok.Literal) == 2 && isLetter(tok.Literal[0]) && isDigit(tok.Literal[1]) {
+		_, err := parseSquareDesignator(tok.Literal)
+		return designatorError(tok, "square", err)
+	}
+	return &errors.ParseError{
+		Err:    fmt.Errorf("unknown filter %q: %w", tok.Literal, errors.ErrCQLSyntax),
+		Column: tok.Pos + 1,
+	}
+}
+
 func (p *Parser) parseParenExpr() (Node, error) {
 	// Skip '('
 	p.nextToken()
@@ -119,6 +144,18 @@ func (p *Parser) parseParenExpr() (Node, error) {
 		}
 	case LT, GT, LE, GE, EQ:
 		return p.parseComparison()
+	case UNION, INTERSECT:
+		return p.parseSetOp()
+	case VARIABLE:
+		node, err := p.parseVariable()
+		if err != nil {
+			return nil, err
+		}
+		if p.current.Type != RPAREN {
+			return nil, fmt.Errorf("expected ')', got %v: %w", p.current.Type, errors.ErrCQLSyntax)
+		}
+		p.nextToken() // Skip ')'
+		return node, nil
 	default:
 		return nil, fmt.Errorf("unexpected token after '(': %v: %w", p.current.Type, errors.ErrCQLSyntax)
 	}
@@ -168,17 +205,43 @@ func (p *Parser) parseParenFilter() (Node, error) {
 }
 
 func (p *Parser) parseFilter() (Node, error) {
+	if !isFilterName(p.current.Literal) {
+		return nil, p.unknownIdentError()
+	}
 	name := p.current.Literal
 	p.nextToken()
 
+	if name == "line" {
+		return p.parseLine()
+	}
+
 	// Zero-argument filters
 	if isZeroArgFilter(name) {
 		return &FilterNode{Name: name, Args: nil}, nil
 	}
 
+	// Transformations and next/previous apply to a single, possibly
+	// compound, expression
+	if transformFilters[name] || sequenceFilters[name] {
+		if p.current.Type == EOF || p.current.Type == RPAREN {
+			return &FilterNode{Name: name, Args: nil}, nil
+		}
+		arg, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return &FilterNode{Name: name, Args: []Node{arg}}, nil
+	}
+
 	// Collect arguments until we hit EOF, RPAREN, or another filter
 	var args []Node
 	expectedArgs := filterArgCount(name)
+	if n, ok := operandArgCounts[name]; ok && p.operand {
+		expectedArgs = n
+		if n == 0 {
+			return &FilterNode{Name: name, Args: nil}, nil
+		}
+	}
 
 	for p.current.Type != EOF && p.current.Type != RPAREN {
 		// Stop if we've collected expected number of arguments
@@ -192,6 +255,11 @@ func (p *Parser) parseFilter() (Node, error) {
 			break
 		}
 
+		// A line arrow ends the constituent this filter belongs to
+		if p.current.Type == FORWARD || p.current.Type == BACKWARD {
+			break
+		}
+
 		// Check if this is a logical operator starting a new expression
 		if p.current.Type == LPAREN {
 			// Peek inside - if it's a logical op, it's a new expression
@@ -210,16 +278,134 @@ func (p *Parser) parseFilter() (Node, error) {
 		args = append(args, arg)
 	}
 
+	if textFilters[name] {
+		for _, arg := range args {
+			if s, ok := arg.(*StringNode); ok {
+				if _, err := compileTextPattern(s.Value); err != nil {
+					return nil, fmt.Errorf("%s: bad pattern %q: %w", name, s.Value, errors.ErrCQLSyntax)
+				}
+			}
+		}
+	}
+
+	if name == "piecevalues" {
+		s, ok := firstString(args)
+		if !ok {
+			return nil, fmt.Errorf("piecevalues: expected a string such as \"N=3.2,B=3.3\": %w", errors.ErrCQLSyntax)
+		}
+		if _, err := matching.ParsePieceValues(s); err != nil {
+			return nil, fmt.Errorf("piecevalues: %v: %w", err, errors.ErrCQLSyntax)
+		}
+	}
+
 	return &FilterNode{
 		Name: name,
 		Args: args,
 	}, nil
 }
 
+// firstString returns the value of the first argument if it is a string.
+func firstString(args []Node) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	s, ok := args[0].(*StringNode)
+	if !ok {
+		return "", false
+	}
+	return s.Value, true
+}
+
+// parseLine parses the constituents of a line filter, each preceded by
+// the same arrow: "line --> check --> mate".
+func (p *Parser) parseLine() (Node, error) {
+	arrow := p.current.Type
+	if arrow != FORWARD && arrow != BACKWARD {
+		return nil, fmt.Errorf("line: expected --> or <--, got %v: %w", p.current.Type, errors.ErrCQLSyntax)
+	}
+
+	var constituents []Node
+	for p.current.Type == arrow {
+		p.nextToken()
+		constituent, err := p.parsePrimary()
+		if err != nil {
+			return nil, fmt.Errorf("line: %w", err)
+		}
+		constituents = append(constituents, constituent)
+	}
+	if p.current.Type == FORWARD || p.current.Type == BACKWARD {
+		return nil, fmt.Errorf("line: cannot mix --> and <--: %w", errors.ErrCQLSyntax)
+	}
+
+	return &LineNode{Backward: arrow == BACKWARD, Constituents: constituents}, nil
+}
+
+// parseVariable parses a set variable reference, "$x", or an assignment to
+// one, "$x = [RQ]".
+func (p *Parser) parseVariable() (Node, error) {
+	name := p.current.Literal
+	p.nextToken()
+	if p.current.Type != ASSIGN {
+		return &VariableNode{Name: name}, nil
+	}
+	p.nextToken()
+
+	value, err := p.parsePrimary()
+	if err != nil {
+		return nil, fmt.Errorf("$%s: %w", name, err)
+	}
+	if !isSetExpr(value) {
+		return nil, fmt.Errorf("$%s: %s is not a piece or square set: %w", name, value, errors.ErrCQLSyntax)
+	}
+	return &AssignNode{Name: name, Value: value}, nil
+}
+
+// parseSetOp parses the union or intersection of piece and square sets.
+func (p *Parser) parseSetOp() (Node, error) {
+	op := p.current.Literal
+	p.nextToken()
+
+	var operands []Node
+	for p.current.Type != RPAREN && p.current.Type != EOF {
+		operand, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		if !isSetExpr(operand) {
+			return nil, fmt.Errorf("%s: %s is not a piece or square set: %w", op, operand, errors.ErrCQLSyntax)
+		}
+		operands = append(operands, operand)
+	}
+
+	if p.current.Type != RPAREN {
+		return nil, fmt.Errorf("expected ')', got %v: %w", p.current.Type, errors.ErrCQLSyntax)
+	}
+	p.nextToken() // Skip ')'
+
+	if len(operands) == 0 {
+		return nil, fmt.Errorf("set operator %q requires at least one operand: %w", op, errors.ErrCQLSyntax)
+	}
+	return &SetOpNode{Op: op, Operands: operands}, nil
+}
+
+// isSetExpr reports whether a node stands for a set of squares: a piece or
+// square designator, a set operation or a set variable.
+func isSetExpr(node Node) bool {
+	switch node.(type) {
+	case *PieceNode, *SquareNode, *SetOpNode, *VariableNode:
+		return true
+	}
+	return false
+}
+
 func (p *Parser) parseComparison() (Node, error) {
 	op := p.current.Literal
 	p.nextToken()
 
+	saved := p.operand
+	p.operand = true
+	defer func() { p.operand = saved }()
+
 	left, err := p.parsePrimary()
 	if err != nil {
 		return nil, fmt.Errorf("expected left operand: %w", err)
@@ -255,6 +441,10 @@ var filterNames = map[string]bool{
 	"material":        true,
 	"result":          true,
 	"player":          true,
+	"site":            true,
+	"event":           true,
+	"comment":         true,
+	"nag":             true,
 	"elo":             true,
 	"year":            true,
 	"pin":             true,
@@ -268,6 +458,11 @@ var filterNames = map[string]bool{
 	"shiftvertical":   true,
 	"controls":        true,
 	"power":           true,
+	"line":            true,
+	"next":            true,
+	"previous":        true,
+	"move":            true,
+	"piecevalues":     true,
 	// Direction keywords for ray
 	"horizontal": true,
 	"vertical":   true,
@@ -285,7 +480,6 @@ var zeroArgFilters = map[string]bool{
 	"stalemate": true,
 	"wtm":       true,
 	"btm":       true,
-	"year":      true,
 	// Direction keywords are zero-arg identifiers used as arguments
 	"horizontal": true,
 	"vertical":   true,
@@ -303,6 +497,10 @@ var filterArgCounts = map[string]int{
 	"material":        1,
 	"result":          1,
 	"player":          1,
+	"site":            1,
+	"event":           1,
+	"comment":         1,
+	"nag":             1,
 	"elo":             3,
 	"year":            2,
 	"pin":             3,
@@ -316,6 +514,67 @@ var filterArgCounts = map[string]int{
 	"shiftvertical":   1,
 	"controls":        2,
 	"power":           2,
+	"next":            1,
+	"previous":        1,
+	"move":            2,
+	"piecevalues":     1,
+}
+
+// transformFilters contains the transformations, whose single argument
+// may be any expression, including a logical one.
+var transformFilters = map[string]bool{
+	"flip":            true,
+	"flipvertical":    true,
+	"flipcolor":       true,
+	"shift":           true,
+	"shifthorizontal": true,
+	"shiftvertical":   true,
+}
+
+// sequenceFilters contains the filters that evaluate their single argument
+// at another position of the game.
+var sequenceFilters = map[string]bool{
+	"next":     true,
+	"previous": true,
+}
+
+// operandArgCounts overrides filterArgCounts for filters used as numeric
+// comparison operands, where trailing numbers belong to the comparison
+// rather than to a range.
+var operandArgCounts = map[string]int{
+	"year": 0,
+	"elo":  1,
+}
+
+// textFilters contains filters whose string argument is a text pattern.
+var textFilters = map[string]bool{
+	"player":  true,
+	"site":    true,
+	"event":   true,
+	"comment": true,
+}
+
+// keywordArgs are identifiers accepted as filter arguments, such as the
+// ray direction and elo colour, rather than filters of their own.
+var keywordArgs = map[string]bool{
+	"horizontal": true,
+	"vertical":   true,
+	"diagonal":   true,
+	"orthogonal": true,
+	"white":      true,
+	"black":      true,
+}
+
+// FilterNames returns the names of the supported CQL filters, sorted.
+func FilterNames() []string {
+	names := make([]string, 0, len(filterNames))
+	for name := range filterNames {
+		if !keywordArgs[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 // isFilterName returns true if the identifier is a known CQL filter name.
@@ -2,6 +2,7 @@ package cql
 
 import (
 	"errors"
+	"strings"
 	"testing"
 
 	perrors "github.com/lgbarn/pgn-extract-go/internal/errors"
@@ -304,13 +305,69 @@ func TestParserSquareRange(t *testing.T) {
 	}
 }
 
+func TestParserLine(t *testing.T) {
+	node, err := Parse("line --> check-->(piece K g1) --> mate wtm")
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	and, ok := node.(*LogicalNode)
+	if !ok || len(and.Children) != 2 {
+		t.Fatalf("expected line and wtm, got %s", node)
+	}
+	line, ok := and.Children[0].(*LineNode)
+	if !ok || line.Backward || len(line.Constituents) != 3 {
+		t.Fatalf("expected a forward line of 3 constituents, got %s", and.Children[0])
+	}
+	if got := line.String(); got != "(line --> check --> piece K g1 --> mate)" {
+		t.Errorf("String() = %q", got)
+	}
+
+	// The canonical form parses back to the same query
+	reparsed, err := Parse(line.String())
+	if err != nil || reparsed.String() != line.String() {
+		t.Errorf("reparsing %q gave %v, %v", line.String(), reparsed, err)
+	}
+}
+
+func TestParserSetVariables(t *testing.T) {
+	node, err := Parse("$x = (| R [a-h]8) (& $x Q)")
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	and, ok := node.(*LogicalNode)
+	if !ok || len(and.Children) != 2 {
+		t.Fatalf("expected an assignment and a set, got %s", node)
+	}
+	assign, ok := and.Children[0].(*AssignNode)
+	if !ok || assign.Name != "x" {
+		t.Fatalf("expected an assignment to $x, got %s", and.Children[0])
+	}
+	if _, ok := assign.Value.(*SetOpNode); !ok {
+		t.Errorf("expected a set operation value, got %T", assign.Value)
+	}
+	if got := node.String(); got != "(and $x = (| R [a-h]8) (& $x Q))" {
+		t.Errorf("String() = %q", got)
+	}
+
+	reparsed, err := Parse(node.String())
+	if err != nil || reparsed.String() != node.String() {
+		t.Errorf("reparsing %q gave %v, %v", node.String(), reparsed, err)
+	}
+}
+
 func TestParserErrors(t *testing.T) {
 	tests := []string{
-		"(",         // Unclosed paren
-		"(and",      // Unclosed paren with content
-		"(and mate", // Unclosed nested
-		")",         // Unexpected close paren
-		"(and )",    // Empty logical
+		"(",                       // Unclosed paren
+		"(and",                    // Unclosed paren with content
+		"(and mate",               // Unclosed nested
+		")",                       // Unexpected close paren
+		"(and )",                  // Empty logical
+		"line check",              // Missing arrow
+		"line --> check <-- mate", // Mixed arrows
+		"line -->",                // Missing constituent
+		"$x = check",              // Not a set
+		"(| )",                    // Empty set operation
+		"(& R mate)",              // Operand not a set
 	}
 
 	for _, input := range tests {
@@ -374,3 +431,61 @@ func TestParserComplexQuery(t *testing.T) {
 		t.Errorf("expected 3 children, got %d", len(logical.Children))
 	}
 }
+
+func TestParserDesignatorErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		column int
+		want   string
+	}{
+		{"piece K [a-", 9, "unterminated file range"},
+		{"piece K i9", 9, "'i' is not a file"},
+		{"piece K e9", 9, "'9' is not a rank"},
+		{"(piece K [h-a]1)", 10, "reversed"},
+		{"piece K [a-h]", 9, "missing rank"},
+		{"piece K e[1-9]", 9, "1-8 only"},
+		{"piece [RQ] e4 piece [] e4", 21, "invalid"},
+		{"(and mate (frob K e4))", 12, `unknown filter "frob"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !errors.Is(err, perrors.ErrCQLSyntax) {
+				t.Errorf("errors.Is(err, ErrCQLSyntax) = false; err = %v", err)
+			}
+			var parseErr *perrors.ParseError
+			if !errors.As(err, &parseErr) || parseErr.Column != tt.column {
+				t.Errorf("error %v: want a ParseError at column %d", err, tt.column)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSquareDesignator(t *testing.T) {
+	tests := []struct {
+		desig string
+		want  int
+	}{
+		{".", 64},
+		{"e4", 1},
+		{"[a-h]1", 8},
+		{"e[1-8]", 8},
+		{"[a-d][1-4]", 16},
+		{"[ace][1-3]", 9},
+		{"[a-ce]1", 4},
+		{"[aa-b]1", 2},
+	}
+	for _, tt := range tests {
+		squares, err := parseSquareDesignator(tt.desig)
+		if err != nil || len(squares) != tt.want {
+			t.Errorf("parseSquareDesignator(%q) = %d squares, %v; want %d", tt.desig, len(squares), err, tt.want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"strings"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/matching"
 )
 
 // evalPiece checks if a specific piece type is on specific squares.
@@ -19,7 +20,10 @@ func (e *Evaluator) evalPiece(args []Node) bool {
 
 	squareArg, ok := args[1].(*SquareNode)
 	if !ok {
-		return false
+		// A set variable or operation
+		pieces, _ := e.evalSet(pieceArg)
+		squares, isSet := e.evalSet(args[1])
+		return isSet && pieces&squares != 0
 	}
 
 	squares := e.parseSquareSet(squareArg.Designator)
@@ -39,34 +43,19 @@ func (e *Evaluator) evalPiece(args []Node) bool {
 	return false
 }
 
-// evalCount counts pieces matching the designator on the board.
+// evalCount counts the squares of a set: the pieces matching a piece
+// designator on the board, or the squares of a set expression.
 func (e *Evaluator) evalCount(args []Node) int {
 	if len(args) < 1 {
 		return 0
 	}
-
-	pieceArg, ok := args[0].(*PieceNode)
-	if !ok {
-		return 0
-	}
-
-	pieces := e.parsePieceDesignator(pieceArg.Designator)
-	count := 0
-
-	for rank := chess.Rank(0); rank < 8; rank++ {
-		for col := chess.Col(0); col < 8; col++ {
-			if containsPiece(pieces, e.getPieceAt(col, rank)) {
-				count++
-			}
-		}
-	}
-
-	return count
+	set, _ := e.evalSet(args[0])
+	return setSize(set)
 }
 
-// evalMaterial calculates the material value for one side.
-// Standard values: P=1, N=3, B=3, R=5, Q=9
-func (e *Evaluator) evalMaterial(args []Node) int {
+// evalMaterial calculates the material value for one side, in pawns, by
+// the query's piece values.
+func (e *Evaluator) evalMaterial(args []Node) float64 {
 	if len(args) < 1 {
 		return 0
 	}
@@ -92,6 +81,10 @@ func (e *Evaluator) evalMaterial(args []Node) int {
 		return 0
 	}
 
+	values := e.values
+	if values == nil {
+		values = &matching.StandardPieceValues
+	}
 	material := 0
 	for rank := chess.Rank(0); rank < 8; rank++ {
 		for col := chess.Col(0); col < 8; col++ {
@@ -105,21 +98,12 @@ func (e *Evaluator) evalMaterial(args []Node) int {
 				continue
 			}
 
-			pieceType := chess.ExtractPiece(piece)
-			switch pieceType {
-			case chess.Pawn:
-				material++
-			case chess.Knight, chess.Bishop:
-				material += 3
-			case chess.Rook:
-				material += 5
-			case chess.Queen:
-				material += 9
-			}
+			material += values[chess.ExtractPiece(piece)]
 		}
 	}
 
-	return material
+	// Equal totals in hundredths give equal floats, so == is exact
+	return float64(material) / 100
 }
 
 // parsePieceDesignator parses a piece designator string into a list of pieces.
@@ -0,0 +1,195 @@
+package cql
+
+import (
+	"context"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/matching"
+)
+
+// Query is a parsed CQL query ready to be matched against positions and
+// games. A Query holds no evaluation state and may be shared between
+// goroutines.
+type Query struct {
+	node   Node
+	source string
+	values *matching.PieceValues // from a piecevalues filter, or nil
+}
+
+// Compile parses a CQL query.
+func Compile(query string) (*Query, error) {
+	node, err := Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	q := NewQuery(node)
+	q.source = query
+	return q, nil
+}
+
+// NewQuery wraps an already parsed query.
+func NewQuery(node Node) *Query {
+	q := &Query{node: node}
+	if spec, ok := findPieceValues(node); ok {
+		if values, err := matching.ParsePieceValues(spec); err == nil {
+			q.values = &values
+		}
+	}
+	return q
+}
+
+// Node returns the query's syntax tree.
+func (q *Query) Node() Node {
+	return q.node
+}
+
+// String returns the query text, or the canonical form of a query that
+// was not compiled from text.
+func (q *Query) String() string {
+	if q.source == "" {
+		return q.node.String()
+	}
+	return q.source
+}
+
+// MatchBoard reports whether a single position matches the query. Filters
+// that need a game, such as player or result, do not match.
+func (q *Query) MatchBoard(board *chess.Board) bool {
+	eval := NewEvaluator(board)
+	eval.values = q.pieceValues(nil)
+	return eval.Evaluate(q.node)
+}
+
+// MatchOptions controls how a game is searched.
+type MatchOptions struct {
+	// All collects every matching position rather than stopping at the
+	// first one.
+	All bool
+	// MaxPly, if positive, stops the search after that many plies.
+	MaxPly int
+	// PlyFilter, if set, limits matches to positions reached after a
+	// number of plies it accepts.
+	PlyFilter func(ply int) bool
+	// PieceValues, if set, weigh material for queries that do not give
+	// their own with piecevalues; otherwise the standard values are used.
+	PieceValues *matching.PieceValues
+	// Context, if set, stops the search once it is done; the matches
+	// found so far are returned.
+	Context context.Context
+}
+
+// stopped reports whether the search has been cancelled.
+func (opts MatchOptions) stopped() bool {
+	return opts.Context != nil && opts.Context.Err() != nil
+}
+
+// Match is a position in a game that matched a query.
+type Match struct {
+	Ply   int          // plies played to reach the position; 0 is the start
+	Move  *chess.Move  // the move that reached the position, nil at the start
+	Board *chess.Board // a copy of the position
+}
+
+// MatchGame replays the main line of a game and returns the positions that
+// match the query, starting with the initial position. The search ends at
+// the first illegal move. Without opts.All at most one match is returned.
+// Sequential filters such as line may look beyond opts.MaxPly.
+func (q *Query) MatchGame(game *chess.Game, opts MatchOptions) []Match {
+	if usesLine(q.node) {
+		return q.matchLine(game, opts)
+	}
+
+	board := engine.NewBoardForGame(game)
+	eval := NewEvaluatorWithGame(board, game)
+	eval.values = q.pieceValues(opts.PieceValues)
+
+	var matches []Match
+	var reached *chess.Move
+	ply := 0
+	for move := game.Moves; ; move = move.Next {
+		eval.vars = nil
+		if (opts.PlyFilter == nil || opts.PlyFilter(ply)) && eval.Evaluate(q.node) {
+			matches = append(matches, Match{Ply: ply, Move: reached, Board: board.Copy()})
+			if !opts.All {
+				return matches
+			}
+		}
+		if move == nil || (opts.MaxPly > 0 && ply >= opts.MaxPly) || opts.stopped() {
+			return matches
+		}
+		if !engine.ApplyMove(board, move) {
+			return matches
+		}
+		ply++
+		reached = move
+		eval.SetMove(move)
+	}
+}
+
+// matchLine is MatchGame for queries with sequential filters, which replays
+// the whole main line first so that filters can look at other positions.
+func (q *Query) matchLine(game *chess.Game, opts MatchOptions) []Match {
+	eval := NewEvaluatorWithGame(nil, game)
+	eval.line = replayLine(game)
+	eval.values = q.pieceValues(opts.PieceValues)
+
+	var matches []Match
+	for ply := range eval.line.boards {
+		if (opts.MaxPly > 0 && ply > opts.MaxPly) || opts.stopped() {
+			break
+		}
+		eval.setPly(ply)
+		eval.vars = nil
+		if (opts.PlyFilter == nil || opts.PlyFilter(ply)) && eval.Evaluate(q.node) {
+			matches = append(matches, Match{Ply: ply, Move: eval.move, Board: eval.board.Copy()})
+			if !opts.All {
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// pieceValues returns the values given by the query's piecevalues filter,
+// which applies to the whole query wherever it appears, or else defaults.
+func (q *Query) pieceValues(defaults *matching.PieceValues) *matching.PieceValues {
+	if q.values != nil {
+		return q.values
+	}
+	return defaults
+}
+
+// findPieceValues returns the argument of the first piecevalues filter in
+// a query.
+func findPieceValues(node Node) (string, bool) {
+	switch n := node.(type) {
+	case *FilterNode:
+		if n.Name == "piecevalues" {
+			return firstString(n.Args)
+		}
+		for _, arg := range n.Args {
+			if spec, ok := findPieceValues(arg); ok {
+				return spec, true
+			}
+		}
+	case *LogicalNode:
+		for _, child := range n.Children {
+			if spec, ok := findPieceValues(child); ok {
+				return spec, true
+			}
+		}
+	case *LineNode:
+		for _, c := range n.Constituents {
+			if spec, ok := findPieceValues(c); ok {
+				return spec, true
+			}
+		}
+	case *ComparisonNode:
+		if spec, ok := findPieceValues(n.Left); ok {
+			return spec, true
+		}
+		return findPieceValues(n.Right)
+	}
+	return "", false
+}
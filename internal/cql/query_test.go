@@ -0,0 +1,219 @@
+package cql
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/matching"
+	"github.com/lgbarn/pgn-extract-go/internal/testutil"
+)
+
+func TestQueryMatchGame(t *testing.T) {
+	game := testutil.MustParseGame(t, `[White "A"]
+[Black "B"]
+[Result "1-0"]
+
+1. e4 e5 2. Bc4 Nc6 3. Qh5 Nf6 4. Qxf7# 1-0
+`)
+
+	query, err := Compile("check")
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if query.String() != "check" {
+		t.Errorf("String() = %q; want %q", query.String(), "check")
+	}
+
+	matches := query.MatchGame(game, MatchOptions{})
+	if len(matches) != 1 || matches[0].Ply != 7 || matches[0].Move.Text[:4] != "Qxf7" {
+		t.Fatalf("MatchGame(check) = %+v; want one match at ply 7", matches)
+	}
+	if got := engine.BoardToFEN(matches[0].Board); got != "r1bqkb1r/pppp1Qpp/2n2n2/4p3/2B1P3/8/PPPP1PPP/RNB1K1NR b KQkq - 0 4" {
+		t.Errorf("matched board = %s", got)
+	}
+
+	// The starting position matches, so every position is returned
+	all, err := Compile("(piece K e1)")
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if got := all.MatchGame(game, MatchOptions{All: true}); len(got) != 8 || got[0].Ply != 0 || got[0].Move != nil {
+		t.Errorf("MatchGame(All) returned %d matches; want 8 starting at ply 0", len(got))
+	}
+	if got := all.MatchGame(game, MatchOptions{All: true, MaxPly: 2}); len(got) != 3 {
+		t.Errorf("MatchGame(MaxPly 2) returned %d matches; want 3", len(got))
+	}
+	odd := func(ply int) bool { return ply%2 == 1 }
+	if got := all.MatchGame(game, MatchOptions{All: true, PlyFilter: odd}); len(got) != 4 || got[0].Ply != 1 {
+		t.Errorf("MatchGame(PlyFilter odd) returned %d matches; want 4 starting at ply 1", len(got))
+	}
+	if got := query.MatchGame(game, MatchOptions{PlyFilter: func(ply int) bool { return ply < 7 }}); len(got) != 0 {
+		t.Errorf("MatchGame(check before ply 7) = %+v; want none", got)
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := all.MatchGame(game, MatchOptions{All: true, Context: cancelled}); len(got) != 1 || got[0].Ply != 0 {
+		t.Errorf("MatchGame(cancelled) returned %d matches; want only the starting position", len(got))
+	}
+
+	if _, err := Compile("(piece K"); err == nil {
+		t.Error("Compile of an unterminated query succeeded")
+	}
+}
+
+func TestQueryMatchGameLine(t *testing.T) {
+	game := testutil.MustParseGame(t, `[White "A"]
+[Black "B"]
+[Result "1-0"]
+
+1. e4 e5 2. Bc4 Nc6 3. Qh5 Nf6 4. Qxf7# 1-0
+`)
+
+	tests := []struct {
+		query string
+		want  []int // plies of the matching positions
+	}{
+		{"line --> (piece Q h5) --> (piece n f6) --> mate", []int{5}},
+		{"line --> check --> mate", nil},
+		{"line <-- mate <-- (piece n f6)", []int{7}},
+		{"next mate", []int{6}},
+		{"previous (piece Q d1)", []int{1, 2, 3, 4, 5}},
+		{"move d1 h5", []int{4}},
+		{"move . f7", []int{6}},
+		{"(flip (line --> (piece Q a5) --> (piece n c6)))", []int{5, 6}},
+		{"line --> (move h5 f7) --> mate", []int{6}},
+		{"line --> (next mate) --> (previous (move h5 f7))", []int{6}},
+	}
+	for _, tt := range tests {
+		query, err := Compile(tt.query)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.query, err)
+		}
+		var got []int
+		for _, m := range query.MatchGame(game, MatchOptions{All: true}) {
+			got = append(got, m.Ply)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("MatchGame(%q) plies = %v; want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// Sequential filters look past MaxPly
+	query, _ := Compile("next mate")
+	if got := query.MatchGame(game, MatchOptions{MaxPly: 6}); len(got) != 1 || got[0].Ply != 6 {
+		t.Errorf("MatchGame(next mate, MaxPly 6) = %+v; want a match at ply 6", got)
+	}
+}
+
+func TestQuerySetVariables(t *testing.T) {
+	board := mustBoardFromFEN("r3k3/8/8/8/8/8/8/R3K2R w KQq - 0 1")
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"R", true},
+		{"Q", false},
+		{"(& R [a-h]1)", true},
+		{"(& R [a-h]8)", false},
+		{"(== (count (| R r)) 3)", true},
+		{"(== (count (& R [a-d][1-8])) 1)", true},
+		{"$x = Q", true}, // assignments match even when the set is empty
+		{"$x = (& R a1) (piece R $x)", true},
+		{"$x = (& R a1) (piece r $x)", false},
+		{"(and $x = [Rr] (== (count $x) 3))", true},
+		{"$unbound", false},
+		{"(flipcolor (& r [a-h]1))", true},
+	}
+	for _, tt := range tests {
+		query, err := Compile(tt.query)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.query, err)
+		}
+		if got := query.MatchBoard(board); got != tt.want {
+			t.Errorf("MatchBoard(%q) = %v; want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// A knight leaves its square and is back on it two plies later
+	game := testutil.MustParseGame(t, "[Event \"T\"]\n\n1. Nf3 Nf6 2. Ng1 Ng8 3. Nc3 *\n")
+	query, err := Compile("line --> ($n = N) --> (< (count (& N $n)) (count N)) --> wtm --> (== (count (& N $n)) (count N))")
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	matches := query.MatchGame(game, MatchOptions{All: true})
+	if len(matches) != 1 || matches[0].Ply != 0 {
+		t.Errorf("returning knight matches = %+v; want one at ply 0", matches)
+	}
+}
+
+func TestQueryMatchBoardTransform(t *testing.T) {
+	board := mustBoardFromFEN("4k3/8/8/8/8/8/8/4K2R b - - 0 1")
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"(piece r h1)", false},
+		{"(flipcolor (piece r h1))", true},
+		{"(flipcolor (piece r h8))", false},
+		{"(and (piece k [a-h]8) (piece R a1))", false},
+		{"(flip (and (piece k [a-h]8) (piece R a1)))", true},
+		{"(flipcolor (and btm (piece r h1)))", true},
+		{"(player \"A\")", false}, // needs a game
+	}
+	for _, tt := range tests {
+		query, err := Compile(tt.query)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.query, err)
+		}
+		if got := query.MatchBoard(board); got != tt.want {
+			t.Errorf("MatchBoard(%q) = %v; want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestQueryPieceValues(t *testing.T) {
+	// A bishop against a knight
+	game := testutil.MustParseGame(t, `[SetUp "1"]
+[FEN "4k1n1/8/8/8/8/8/8/2B1K3 w - - 0 1"]
+[Result "*"]
+
+1. Kd2 *
+`)
+	knights, err := matching.ParsePieceValues("N=3.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query    string
+		defaults *matching.PieceValues
+		want     bool
+	}{
+		{`(== (material "white") (material "black"))`, nil, true},
+		{`(and (piecevalues "B=3.3") (> (material "white") (material "black")))`, nil, true},
+		{`(and (> (material "white") 3) (piecevalues "B=3.3"))`, nil, true},
+		{`(> (material "white") 3)`, nil, false},
+		{`(< (material "white") (material "black"))`, &knights, true},
+		{`(and (piecevalues "B=3.3") (< (material "white") (material "black")))`, &knights, false},
+		{`(line --> (piecevalues "N=2.99") --> (> (material "white") (material "black")))`, nil, true},
+	}
+	for _, tt := range tests {
+		query, err := Compile(tt.query)
+		if err != nil {
+			t.Fatalf("Compile(%s): %v", tt.query, err)
+		}
+		if got := len(query.MatchGame(game, MatchOptions{PieceValues: tt.defaults})) > 0; got != tt.want {
+			t.Errorf("MatchGame(%s) with defaults %v = %v, want %v", tt.query, tt.defaults, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{`(piecevalues "K=1")`, `(piecevalues "N=x")`, `(piecevalues 3)`, `piecevalues`} {
+		if _, err := Compile(bad); err == nil {
+			t.Errorf("Compile(%s) succeeded, want an error", bad)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package cql
+
+import (
+	"math/bits"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// squareSet is a set of squares, bit rank*8+col for each square.
+type squareSet uint64
+
+func (s squareSet) has(sq square) bool {
+	return s&squareBit(sq) != 0
+}
+
+func squareBit(sq square) squareSet {
+	return 1 << (uint(sq.rank)*8 + uint(sq.col))
+}
+
+// evalSet returns the squares a set expression stands for at the current
+// position: where the designated pieces stand for a piece designator, the
+// designated squares for a square designator. ok is false for a node that
+// is not a set.
+func (e *Evaluator) evalSet(node Node) (set squareSet, ok bool) {
+	switch n := node.(type) {
+	case *PieceNode:
+		pieces := e.parsePieceDesignator(n.Designator)
+		for rank := chess.Rank(0); rank < 8; rank++ {
+			for col := chess.Col(0); col < 8; col++ {
+				if containsPiece(pieces, e.getPieceAt(col, rank)) {
+					set |= squareBit(square{col, rank})
+				}
+			}
+		}
+		return set, true
+	case *SquareNode:
+		for _, sq := range e.parseSquareSet(n.Designator) {
+			set |= squareBit(sq)
+		}
+		return set, true
+	case *VariableNode:
+		// An unbound variable is empty
+		return e.vars[n.Name], true
+	case *SetOpNode:
+		if n.Op == "&" {
+			set = ^squareSet(0)
+		}
+		for _, operand := range n.Operands {
+			value, _ := e.evalSet(operand)
+			if n.Op == "&" {
+				set &= value
+			} else {
+				set |= value
+			}
+		}
+		return set, true
+	}
+	return 0, false
+}
+
+// evalAssign binds a set variable. Like any assignment in CQL it matches,
+// whether or not the set is empty.
+func (e *Evaluator) evalAssign(a *AssignNode) bool {
+	value, _ := e.evalSet(a.Value)
+	if e.vars == nil {
+		e.vars = make(map[string]squareSet)
+	}
+	e.vars[a.Name] = value
+	if e.memo != nil {
+		// Memoized results may depend on the old value
+		e.memo = make(map[Node]bool)
+	}
+	return true
+}
+
+// setSize returns the number of squares in a set.
+func setSize(set squareSet) int {
+	return bits.OnesCount64(uint64(set))
+}
@@ -1,211 +1,291 @@
 package cql
 
-import "strings"
+import (
+	"sort"
+	"strings"
+)
 
-// Transform functions
-type squareTransform func(col, rank int) (int, int)
-
-// colorSwapMap maps piece characters to their opposite color equivalents.
-var colorSwapMap = map[rune]rune{
-	'K': 'k', 'Q': 'q', 'R': 'r', 'B': 'b', 'N': 'n', 'P': 'p',
-	'k': 'K', 'q': 'Q', 'r': 'R', 'b': 'B', 'n': 'N', 'p': 'P',
-	'A': 'a', 'a': 'A',
-}
-
-func flipHorizontal(col, rank int) (int, int) {
-	return 7 - col, rank // a↔h, b↔g, etc.
-}
-
-func flipVertical(col, rank int) (int, int) {
-	return col, 7 - rank // 1↔8, 2↔7, etc.
+// squareTransform maps the squares and pieces of a query. Files and ranks
+// are mirrored first, then shifted; every transformation filter maps files
+// and ranks independently, so rectangular square sets stay rectangular.
+type squareTransform struct {
+	mirrorFiles bool // a↔h, b↔g, ...
+	mirrorRanks bool // 1↔8, 2↔7, ...
+	swapColors  bool // white pieces ↔ black pieces
+	dFile       int
+	dRank       int
 }
 
-func flipColor(col, rank int) (int, int) {
-	// Color flip doesn't change squares, just piece colors
-	// Handled specially in transformNode
-	return col, rank
-}
-
-// evalFlip evaluates the child expression with horizontal flip transformation.
-// Tries both the original pattern and its horizontal mirror (a↔h files).
-func (e *Evaluator) evalFlip(args []Node) bool {
-	if len(args) < 1 {
-		return false
-	}
-
-	// Try original
-	if e.Evaluate(args[0]) {
-		return true
+// file maps a file index (0 = a), which may leave the board.
+func (t squareTransform) file(f int) int {
+	if t.mirrorFiles {
+		f = 7 - f
 	}
-
-	// Try horizontal flip - transform the pattern and evaluate
-	flippedNode := e.transformNode(args[0], flipHorizontal)
-	return e.Evaluate(flippedNode)
+	return f + t.dFile
 }
 
-// evalFlipVertical evaluates with vertical flip transformation (1↔8 ranks).
-func (e *Evaluator) evalFlipVertical(args []Node) bool {
-	if len(args) < 1 {
-		return false
-	}
-
-	// Try original
-	if e.Evaluate(args[0]) {
-		return true
+// rank maps a rank index (0 = 1), which may leave the board.
+func (t squareTransform) rank(r int) int {
+	if t.mirrorRanks {
+		r = 7 - r
 	}
-
-	// Try vertical flip
-	flippedNode := e.transformNode(args[0], flipVertical)
-	return e.Evaluate(flippedNode)
+	return r + t.dRank
 }
 
-// evalFlipColor evaluates with color flip transformation (white↔black).
-func (e *Evaluator) evalFlipColor(args []Node) bool {
-	if len(args) < 1 {
-		return false
-	}
-
-	// Try original
-	if e.Evaluate(args[0]) {
-		return true
-	}
-
-	// Try color flip
-	flippedNode := e.transformNode(args[0], flipColor)
-	return e.Evaluate(flippedNode)
+// colorSwapMap maps piece characters to their opposite color equivalents.
+var colorSwapMap = map[rune]rune{
+	'K': 'k', 'Q': 'q', 'R': 'r', 'B': 'b', 'N': 'n', 'P': 'p',
+	'k': 'K', 'q': 'Q', 'r': 'R', 'b': 'B', 'n': 'N', 'p': 'P',
+	'A': 'a', 'a': 'A',
 }
 
-// evalShift tries all possible translations of the pattern.
-func (e *Evaluator) evalShift(args []Node) bool {
-	if len(args) < 1 {
-		return false
-	}
-
-	// Try all possible shifts
-	for dCol := -7; dCol <= 7; dCol++ {
+// transformsFor returns the transformations a transformation filter tries,
+// starting with the identity.
+func transformsFor(name string) []squareTransform {
+	switch name {
+	case "flip":
+		return []squareTransform{{}, {mirrorFiles: true}}
+	case "flipvertical":
+		return []squareTransform{{}, {mirrorRanks: true}}
+	case "flipcolor":
+		return []squareTransform{{}, {swapColors: true}}
+	case "shift":
+		transforms := []squareTransform{{}}
+		for dFile := -7; dFile <= 7; dFile++ {
+			for dRank := -7; dRank <= 7; dRank++ {
+				if dFile != 0 || dRank != 0 {
+					transforms = append(transforms, squareTransform{dFile: dFile, dRank: dRank})
+				}
+			}
+		}
+		return transforms
+	case "shifthorizontal":
+		transforms := []squareTransform{{}}
+		for dFile := -7; dFile <= 7; dFile++ {
+			if dFile != 0 {
+				transforms = append(transforms, squareTransform{dFile: dFile})
+			}
+		}
+		return transforms
+	case "shiftvertical":
+		transforms := []squareTransform{{}}
 		for dRank := -7; dRank <= 7; dRank++ {
-			shiftedNode := e.transformNode(args[0], func(col, rank int) (int, int) {
-				return col + dCol, rank + dRank
-			})
-			if e.Evaluate(shiftedNode) {
-				return true
+			if dRank != 0 {
+				transforms = append(transforms, squareTransform{dRank: dRank})
 			}
 		}
+		return transforms
 	}
-	return false
+	return nil
 }
 
-// evalShiftHorizontal tries all horizontal translations.
-func (e *Evaluator) evalShiftHorizontal(args []Node) bool {
-	if len(args) < 1 {
+// evalTransform evaluates a transformation filter: it matches if its
+// argument matches under any of the filter's transformations. The
+// transformed queries are built once per query and shared by all
+// positions. While they are evaluated, results are memoized per node, so
+// subqueries that no transformation changes are evaluated only once.
+func (e *Evaluator) evalTransform(f *FilterNode) bool {
+	if len(f.Args) < 1 {
 		return false
 	}
 
-	// Try all horizontal shifts
-	for dCol := -7; dCol <= 7; dCol++ {
-		shiftedNode := e.transformNode(args[0], func(col, rank int) (int, int) {
-			return col + dCol, rank
-		})
-		if e.Evaluate(shiftedNode) {
+	f.variantsOnce.Do(func() {
+		f.variants = transformVariants(f.Args[0], transformsFor(f.Name))
+	})
+
+	if e.memo == nil {
+		e.memo = make(map[Node]bool)
+		defer func() { e.memo = nil }()
+	}
+	for _, variant := range f.variants {
+		if e.Evaluate(variant) {
 			return true
 		}
 	}
 	return false
 }
 
-// evalShiftVertical tries all vertical translations.
-func (e *Evaluator) evalShiftVertical(args []Node) bool {
-	if len(args) < 1 {
-		return false
-	}
-
-	// Try all vertical shifts
-	for dRank := -7; dRank <= 7; dRank++ {
-		shiftedNode := e.transformNode(args[0], func(col, rank int) (int, int) {
-			return col, rank + dRank
-		})
-		if e.Evaluate(shiftedNode) {
-			return true
+// transformVariants returns the distinct queries node becomes under the
+// transformations, dropping those that move a square off the board.
+func transformVariants(node Node, transforms []squareTransform) []Node {
+	var variants []Node
+	seen := make(map[string]bool)
+	for _, t := range transforms {
+		variant, ok := transformNode(node, t)
+		if !ok {
+			continue
+		}
+		key := variant.String()
+		if seen[key] {
+			continue
 		}
+		seen[key] = true
+		variants = append(variants, variant)
 	}
-	return false
+	return variants
 }
 
-// transformNode creates a transformed copy of an AST node.
-func (e *Evaluator) transformNode(node Node, transform squareTransform) Node {
+// transformNode returns node under a transformation, or false if one of
+// its squares leaves the board. Subtrees the transformation does not
+// change are returned as they are, so variants share them.
+func transformNode(node Node, t squareTransform) (Node, bool) {
 	switch n := node.(type) {
 	case *FilterNode:
-		return e.transformFilterNode(n, transform)
+		args, changed, ok := transformNodes(n.Args, t)
+		if !ok {
+			return nil, false
+		}
+		if !changed {
+			return n, true
+		}
+		return &FilterNode{Name: n.Name, Args: args}, true
 	case *LogicalNode:
-		children := make([]Node, len(n.Children))
-		for i, child := range n.Children {
-			children[i] = e.transformNode(child, transform)
+		children, changed, ok := transformNodes(n.Children, t)
+		if !ok {
+			return nil, false
+		}
+		if !changed {
+			return n, true
+		}
+		return &LogicalNode{Op: n.Op, Children: children}, true
+	case *LineNode:
+		constituents, changed, ok := transformNodes(n.Constituents, t)
+		if !ok {
+			return nil, false
+		}
+		if !changed {
+			return n, true
+		}
+		return &LineNode{Backward: n.Backward, Constituents: constituents}, true
+	case *SetOpNode:
+		operands, changed, ok := transformNodes(n.Operands, t)
+		if !ok {
+			return nil, false
+		}
+		if !changed {
+			return n, true
+		}
+		return &SetOpNode{Op: n.Op, Operands: operands}, true
+	case *AssignNode:
+		value, ok := transformNode(n.Value, t)
+		if !ok {
+			return nil, false
+		}
+		if value == n.Value {
+			return n, true
+		}
+		return &AssignNode{Name: n.Name, Value: value}, true
+	case *ComparisonNode:
+		left, okLeft := transformNode(n.Left, t)
+		right, okRight := transformNode(n.Right, t)
+		if !okLeft || !okRight {
+			return nil, false
 		}
-		return &LogicalNode{Op: n.Op, Children: children}
+		if left == n.Left && right == n.Right {
+			return n, true
+		}
+		return &ComparisonNode{Op: n.Op, Left: left, Right: right}, true
 	case *SquareNode:
-		return e.transformSquareNode(n, transform)
+		return transformSquareNode(n, t)
 	case *PieceNode:
-		// For flipColor, we need to swap piece colors
-		if transform == nil {
-			return n
-		}
-		// Check if this is a color flip by testing a known point
-		testCol, testRank := transform(0, 0)
-		if testCol == 0 && testRank == 0 {
-			// This could be flipColor - check by comparing with flipHorizontal
-			hCol, hRank := flipHorizontal(0, 0)
-			if hCol != 0 || hRank != 0 {
-				// Not flipHorizontal, check flipVertical
-				vCol, vRank := flipVertical(0, 0)
-				if vCol != 0 || vRank != 0 {
-					// Must be flipColor - swap piece colors
-					return e.transformPieceNodeColor(n)
-				}
-			}
+		if !t.swapColors {
+			return n, true
 		}
-		return n
+		return transformPieceNodeColor(n), true
 	default:
-		return node
+		return node, true
 	}
 }
 
-// transformFilterNode transforms a filter node with the given transform.
-func (e *Evaluator) transformFilterNode(f *FilterNode, transform squareTransform) *FilterNode {
-	// Transform arguments
-	args := make([]Node, len(f.Args))
-	for i, arg := range f.Args {
-		args[i] = e.transformNode(arg, transform)
+// transformNodes transforms a list of nodes, reporting whether any changed.
+func transformNodes(nodes []Node, t squareTransform) ([]Node, bool, bool) {
+	result := make([]Node, len(nodes))
+	changed := false
+	for i, node := range nodes {
+		transformed, ok := transformNode(node, t)
+		if !ok {
+			return nil, false, false
+		}
+		result[i] = transformed
+		changed = changed || transformed != node
 	}
-	return &FilterNode{Name: f.Name, Args: args}
+	return result, changed, true
 }
 
-// transformSquareNode transforms a square node with the given transform.
-func (e *Evaluator) transformSquareNode(s *SquareNode, transform squareTransform) *SquareNode {
-	// Parse the square designator, transform, and create new designator
-	squares := e.parseSquareSet(s.Designator)
-	if len(squares) == 0 {
-		return s
+// transformSquareNode maps the files and ranks of a square designator. It
+// fails if a square leaves the board. "." stands for every square under any
+// transformation.
+func transformSquareNode(s *SquareNode, t squareTransform) (Node, bool) {
+	if s.Designator == "." || (t.dFile == 0 && t.dRank == 0 && !t.mirrorFiles && !t.mirrorRanks) {
+		return s, true
+	}
+	files, rest, err := parseDesignatorPart(s.Designator, 'a', 'h', "file")
+	if err != nil {
+		return s, true
+	}
+	ranks, _, err := parseDesignatorPart(rest, '1', '8', "rank")
+	if err != nil {
+		return s, true
+	}
+
+	newFiles, okFiles := mapDesignatorChars(files, 'a', t.file)
+	newRanks, okRanks := mapDesignatorChars(ranks, '1', t.rank)
+	if !okFiles || !okRanks {
+		return nil, false
+	}
+	desig := designatorPart(newFiles) + designatorPart(newRanks)
+	if desig == designatorPart(files)+designatorPart(ranks) {
+		return s, true
 	}
+	return &SquareNode{Designator: desig}, true
+}
 
-	// For single squares, transform and create new designator
-	if len(squares) == 1 {
-		sq := squares[0]
-		newCol, newRank := transform(int(sq.col), int(sq.rank))
-		if newCol >= 0 && newCol < 8 && newRank >= 0 && newRank < 8 {
-			newDesig := string(rune('a'+newCol)) + string(rune('1'+newRank))
-			return &SquareNode{Designator: newDesig}
+// mapDesignatorChars maps file or rank characters, failing if one leaves
+// the board.
+func mapDesignatorChars(chars []byte, base byte, mapIndex func(int) int) ([]byte, bool) {
+	result := make([]byte, len(chars))
+	for i, c := range chars {
+		mapped := mapIndex(int(c - base))
+		if mapped < 0 || mapped > 7 {
+			return nil, false
 		}
-		// Out of bounds - return original (won't match)
-		return s
+		result[i] = base + byte(mapped)
 	}
+	return result, true
+}
 
-	// For complex square sets, transform each square
-	// This is more complex - for now, just return original
-	return s
+// designatorPart writes files or ranks in a canonical form: a single
+// character, or a sorted bracketed list with runs of three or more written
+// as ranges, e.g. "[a-ce]".
+func designatorPart(chars []byte) string {
+	sorted := append([]byte(nil), chars...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if len(sorted) == 1 {
+		return string(sorted)
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+		if j-i >= 2 {
+			sb.WriteByte(sorted[i])
+			sb.WriteByte('-')
+			sb.WriteByte(sorted[j])
+		} else {
+			sb.Write(sorted[i : j+1])
+		}
+		i = j + 1
+	}
+	sb.WriteByte(']')
+	return sb.String()
 }
 
 // transformPieceNodeColor swaps piece colors in a piece node.
-func (e *Evaluator) transformPieceNodeColor(p *PieceNode) *PieceNode {
+func transformPieceNodeColor(p *PieceNode) *PieceNode {
 	var sb strings.Builder
 	sb.Grow(len(p.Designator))
 
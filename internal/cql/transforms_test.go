@@ -1,14 +1,10 @@
 package cql
 
-import (
-	"testing"
-
-	"github.com/lgbarn/pgn-extract-go/internal/engine"
-)
+import "testing"
 
 func TestTransformFlipHorizontal(t *testing.T) {
 	// Position with white king on g1 (already castled)
-	board := engine.MustBoardFromFEN("r1bq1rk1/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQ1RK1 w - - 6 5")
+	board := mustBoardFromFEN("r1bq1rk1/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQ1RK1 w - - 6 5")
 
 	tests := []struct {
 		cql      string
@@ -41,7 +37,7 @@ func TestTransformFlipHorizontal(t *testing.T) {
 
 func TestTransformFlipVertical(t *testing.T) {
 	// Standard starting position
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -74,7 +70,7 @@ func TestTransformFlipVertical(t *testing.T) {
 
 func TestTransformFlipColor(t *testing.T) {
 	// Standard starting position
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -107,7 +103,7 @@ func TestTransformFlipColor(t *testing.T) {
 
 func TestTransformShift(t *testing.T) {
 	// Position with king in corner
-	board := engine.MustBoardFromFEN("7k/8/8/8/8/8/8/K7 w - - 0 1")
+	board := mustBoardFromFEN("7k/8/8/8/8/8/8/K7 w - - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -140,7 +136,7 @@ func TestTransformShift(t *testing.T) {
 
 func TestTransformShiftHorizontal(t *testing.T) {
 	// White king on e1
-	board := engine.MustBoardFromFEN("8/8/8/8/8/8/8/4K3 w - - 0 1")
+	board := mustBoardFromFEN("8/8/8/8/8/8/8/4K3 w - - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -172,7 +168,7 @@ func TestTransformShiftHorizontal(t *testing.T) {
 
 func TestTransformShiftVertical(t *testing.T) {
 	// White king on e1
-	board := engine.MustBoardFromFEN("8/8/8/8/8/8/8/4K3 w - - 0 1")
+	board := mustBoardFromFEN("8/8/8/8/8/8/8/4K3 w - - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -204,7 +200,7 @@ func TestTransformShiftVertical(t *testing.T) {
 
 func TestTransformCombined(t *testing.T) {
 	// Standard starting position
-	board := engine.MustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 
 	tests := []struct {
 		cql      string
@@ -231,3 +227,78 @@ func TestTransformCombined(t *testing.T) {
 		})
 	}
 }
+
+func TestTransformVariants(t *testing.T) {
+	tests := []struct {
+		cql  string
+		want int
+	}{
+		{"(shift (piece K e4))", 64},
+		{"(shift (piece K [a-h]1))", 8},
+		{"(shift (piece K [a-b][1-2]))", 49},
+		{"(shiftvertical (piece K [a-h]1))", 8},
+		{"(shifthorizontal (piece K [a-d]1))", 5},
+		{"(shift mate)", 1},
+		{"(flip (piece K d1))", 2},
+		{"(flip (piece K [a-h]1))", 1},
+		{"(flipcolor (piece K e1))", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cql, func(t *testing.T) {
+			node, err := Parse(tt.cql)
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+			f := node.(*FilterNode)
+			if got := len(transformVariants(f.Args[0], transformsFor(f.Name))); got != tt.want {
+				t.Errorf("got %d variants, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformSquareSets(t *testing.T) {
+	// White king on e1, white rook on h1, black king on e8
+	board := mustBoardFromFEN("4k3/8/8/8/8/8/8/4K2R w - - 0 1")
+
+	tests := []struct {
+		cql      string
+		expected bool
+	}{
+		// The identity shift keeps piece colours
+		{"(shift (piece K e1))", true},
+		{"(shift (and (piece K e1) (piece R h1)))", true},
+		// Square sets are transformed too
+		{"(flip (piece R [a-c]1))", true},
+		{"(shiftvertical (piece R h[5-8]))", true},
+		// Shifts that move a square off the board are not tried
+		{"(shifthorizontal (and (piece K d1) (piece R g1)))", true},
+		{"(shifthorizontal (and (piece K a1) (piece R h1)))", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cql, func(t *testing.T) {
+			node, err := Parse(tt.cql)
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+			if got := NewEvaluator(board).Evaluate(node); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func BenchmarkTransformShift(b *testing.B) {
+	board := mustBoardFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	node, err := Parse("(shift (and (piece Q d4) (piece N f3) (not check)))")
+	if err != nil {
+		b.Fatal(err)
+	}
+	eval := NewEvaluator(board)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		eval.Evaluate(node)
+	}
+}
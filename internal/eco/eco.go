@@ -81,7 +81,7 @@ func (ec *ECOClassifier) addECOEntry(game *chess.Game) {
 		return
 	}
 
-	board := engine.MustBoardFromFEN(engine.InitialFEN)
+	board := engine.NewInitialBoard()
 	var cumulativeHash uint64
 	halfMoves := 0
 
@@ -180,7 +180,7 @@ func (ec *ECOClassifier) boardForGame(game *chess.Game) *chess.Board {
 			return board
 		}
 	}
-	board := engine.MustBoardFromFEN(engine.InitialFEN)
+	board := engine.NewInitialBoard()
 	return board
 }
 
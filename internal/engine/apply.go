@@ -2,35 +2,90 @@ package engine
 
 import (
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/parser"
 )
 
 // ApplyMove applies a move to the board and updates the board state.
 // Returns true if the move was applied successfully.
 func ApplyMove(board *chess.Board, move *chess.Move) bool {
+	return applyMove(board, move, nil)
+}
+
+// Square is a square of the board.
+type Square struct {
+	Col  chess.Col
+	Rank chess.Rank
+}
+
+// Changes lists the squares whose contents a move changed, so that
+// anything derived from the pieces on the board, such as a Zobrist hash,
+// can be updated for those squares alone.
+type Changes struct {
+	Squares [4]Square // castling changes the most: two king and two rook squares
+	N       int
+}
+
+// add records a changed square once. A nil Changes records nothing.
+func (c *Changes) add(col chess.Col, rank chess.Rank) {
+	if c == nil {
+		return
+	}
+	for _, sq := range c.Squares[:c.N] {
+		if sq.Col == col && sq.Rank == rank {
+			return
+		}
+	}
+	c.Squares[c.N] = Square{col, rank}
+	c.N++
+}
+
+// ApplyMoveChanges applies a move as ApplyMove does, also returning the
+// squares whose contents it changed.
+func ApplyMoveChanges(board *chess.Board, move *chess.Move) (Changes, bool) {
+	var changes Changes
+	ok := applyMove(board, move, &changes)
+	return changes, ok
+}
+
+func applyMove(board *chess.Board, move *chess.Move, changes *Changes) bool {
 	if move == nil {
 		return false
 	}
+	classifyFromSquare(board, move)
 
 	switch move.Class {
 	case chess.NullMove:
-		// Just switch sides
+		// Pass the turn; the clocks advance as for any non-capture
+		board.HalfmoveClock++
+		if board.ToMove == chess.Black {
+			board.MoveNumber++
+		}
 		board.ToMove = board.ToMove.Opposite()
 		board.EnPassant = false
 		return true
 
 	case chess.KingsideCastle:
-		return applyCastle(board, true)
+		return applyCastle(board, true, changes)
 
 	case chess.QueensideCastle:
-		return applyCastle(board, false)
+		return applyCastle(board, false, changes)
 
 	case chess.PawnMove, chess.PawnMoveWithPromotion, chess.EnPassantPawnMove:
-		return applyPawnMove(board, move)
+		return applyPawnMove(board, move, changes)
 
 	case chess.PieceMove:
-		return applyPieceMove(board, move)
+		return applyPieceMove(board, move, changes)
 
 	default:
 		return false
 	}
 }
+
+// classifyFromSquare corrects the class of a move decoded without a piece
+// letter, as long algebraic moves such as "g1f3" or "e1g1" are, from the
+// piece on its from square. Such moves are decoded as pawn moves.
+func classifyFromSquare(board *chess.Board, move *chess.Move) {
+	if move.Class == chess.PawnMove {
+		parser.DecodeAlgebraic(move, board)
+	}
+}
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
@@ -12,18 +13,24 @@ func TestApplyMove_NullMove(t *testing.T) {
 		fen          string
 		wantToMove   chess.Colour
 		wantEnPassnt bool
+		wantHalfmove uint
+		wantMoveNum  uint
 	}{
 		{
 			name:         "null move from initial position",
 			fen:          InitialFEN,
 			wantToMove:   chess.Black,
 			wantEnPassnt: false,
+			wantHalfmove: 1,
+			wantMoveNum:  1,
 		},
 		{
 			name:         "null move as black",
 			fen:          "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
 			wantToMove:   chess.White,
 			wantEnPassnt: false,
+			wantHalfmove: 1,
+			wantMoveNum:  2,
 		},
 	}
 
@@ -46,6 +53,9 @@ func TestApplyMove_NullMove(t *testing.T) {
 			if board.EnPassant != tt.wantEnPassnt {
 				t.Errorf("board.EnPassant = %v, want %v", board.EnPassant, tt.wantEnPassnt)
 			}
+			if board.HalfmoveClock != tt.wantHalfmove || board.MoveNumber != tt.wantMoveNum {
+				t.Errorf("clocks = %d %d, want %d %d", board.HalfmoveClock, board.MoveNumber, tt.wantHalfmove, tt.wantMoveNum)
+			}
 		})
 	}
 }
@@ -268,6 +278,23 @@ func TestApplyMove_EnPassant(t *testing.T) {
 					b.Get('e', '4') == chess.Empty // Captured pawn removed
 			},
 		},
+		{
+			// Plain SAN "fxe6" without an e.p. suffix is parsed as a pawn move
+			name: "en passant capture without e.p. suffix",
+			fen:  "rnbqkbnr/pppp1ppp/8/4pP2/8/8/PPPPP1PP/RNBQKBNR w KQkq e6 0 3",
+			move: &chess.Move{
+				Class:   chess.PawnMove,
+				FromCol: 'f',
+				ToCol:   'e',
+				ToRank:  '6',
+			},
+			wantOk: true,
+			checkFn: func(b *chess.Board) bool {
+				return b.Get('e', '6') == chess.W(chess.Pawn) &&
+					b.Get('f', '5') == chess.Empty &&
+					b.Get('e', '5') == chess.Empty
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -514,6 +541,63 @@ func TestApplyMove_PieceMoves(t *testing.T) {
 	}
 }
 
+func TestApplyMove_LongAlgebraicPieceMoves(t *testing.T) {
+	// Long algebraic moves carry no piece letter and arrive as pawn moves
+	board, err := NewBoardFromFEN("rnbqkbnr/pppp1ppp/8/4p3/3pP3/8/PPPN1PPP/R3KBNR w KQkq - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	knight := &chess.Move{Class: chess.PawnMove, FromCol: 'd', FromRank: '2', ToCol: 'c', ToRank: '4'}
+	if !ApplyMove(board, knight) {
+		t.Fatal("ApplyMove(d2c4) failed")
+	}
+	if board.Get('c', '4') != chess.W(chess.Knight) || board.EnPassant {
+		t.Errorf("d2c4: c4 = %v, en passant = %v; want a knight and no en passant square", board.Get('c', '4'), board.EnPassant)
+	}
+
+	board.ToMove = chess.White
+	castle := &chess.Move{Class: chess.PawnMove, FromCol: 'e', FromRank: '1', ToCol: 'c', ToRank: '1'}
+	if !ApplyMove(board, castle) {
+		t.Fatal("ApplyMove(e1c1) failed")
+	}
+	if board.Get('d', '1') != chess.W(chess.Rook) || board.WKingCol != 'c' || board.WKingCastle != 0 {
+		t.Errorf("e1c1: d1 = %v, king on %c, kingside castling %v; want a castled king", board.Get('d', '1'), board.WKingCol, board.WKingCastle)
+	}
+}
+
+func TestApplyMoveChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		move *chess.Move
+		want string
+	}{
+		{"piece move", InitialFEN, &chess.Move{Class: chess.PieceMove, PieceToMove: chess.Knight, ToCol: 'f', ToRank: '3'}, "g1 f3"},
+		{"en passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", &chess.Move{Class: chess.PawnMove, FromCol: 'e', ToCol: 'd', ToRank: '6'}, "d5 e5 d6"},
+		{"castling", "4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1", &chess.Move{Class: chess.QueensideCastle}, "e1 c1 a1 d1"},
+		{"null move", InitialFEN, &chess.Move{Class: chess.NullMove}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board, err := NewBoardFromFEN(tt.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			changes, ok := ApplyMoveChanges(board, tt.move)
+			if !ok {
+				t.Fatal("ApplyMoveChanges() = false, want true")
+			}
+			var squares []string
+			for _, sq := range changes.Squares[:changes.N] {
+				squares = append(squares, squareName(sq.Col, sq.Rank))
+			}
+			if got := strings.Join(squares, " "); got != tt.want {
+				t.Errorf("changed squares = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestIsInCheck(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -1,9 +1,14 @@
 package engine
 
-import "github.com/lgbarn/pgn-extract-go/internal/chess"
+import (
+	"fmt"
+	"strings"
 
-// applyCastle applies a castling move.
-func applyCastle(board *chess.Board, kingside bool) bool {
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// applyCastle applies a castling move, recording the squares it changes.
+func applyCastle(board *chess.Board, kingside bool, changes *Changes) bool {
 	colour := board.ToMove
 	rank, kingFromCol, kingSideCastle, queenSideCastle := getCastlingInfo(board, colour)
 
@@ -27,6 +32,10 @@ func applyCastle(board *chess.Board, kingside bool) bool {
 	rook := board.Get(rookFromCol, rank)
 	board.Set(rookFromCol, rank, chess.Empty)
 	board.Set(rookToCol, rank, rook)
+	changes.add(kingFromCol, rank)
+	changes.add(kingToCol, rank)
+	changes.add(rookFromCol, rank)
+	changes.add(rookToCol, rank)
 
 	// Update king position and remove castling rights
 	if colour == chess.White {
@@ -49,6 +58,87 @@ func applyCastle(board *chess.Board, kingside bool) bool {
 	return true
 }
 
+// CastlingProblem describes a castling move that breaks the castling rules.
+type CastlingProblem struct {
+	Ply     int    // 1-based ply of the move in the main line
+	Written string // the move as it appears in the game
+	Reason  string // what makes the move illegal
+}
+
+// String describes the problem for diagnostics.
+func (p CastlingProblem) String() string {
+	return fmt.Sprintf("ply %d: %s castles %s", p.Ply, p.Written, p.Reason)
+}
+
+// CheckCastling replays a game's main line and reports each castling move
+// made without the right to castle, with a piece in the way, out of check,
+// or through or into an attacked square. Castling itself is played without
+// these checks, so such games otherwise replay. Replay stops at the first
+// move that cannot be played.
+func CheckCastling(game *chess.Game) []CastlingProblem {
+	var problems []CastlingProblem
+	board := NewBoardForGame(game)
+	ply := 0
+	for move := game.Moves; move != nil; move = move.Next {
+		ply++
+		if move.Class == chess.KingsideCastle || move.Class == chess.QueensideCastle {
+			if reason := castlingProblem(board, move.Class == chess.KingsideCastle); reason != "" {
+				problems = append(problems, CastlingProblem{Ply: ply, Written: move.Text, Reason: reason})
+			}
+		}
+		if !ApplyMove(board, move) {
+			break
+		}
+	}
+	return problems
+}
+
+// castlingProblem returns why the side to move may not castle, or "".
+func castlingProblem(board *chess.Board, kingside bool) string {
+	colour := board.ToMove
+	rank, kingCol, kingSideCastle, queenSideCastle := getCastlingInfo(board, colour)
+	rookCol, kingToCol, rookToCol := queenSideCastle, chess.Col('c'), chess.Col('d')
+	if kingside {
+		rookCol, kingToCol, rookToCol = kingSideCastle, 'g', 'f'
+	}
+	if rookCol == 0 {
+		return "without the right to castle"
+	}
+
+	// Every square the king and rook cross or land on must be empty but for
+	// the two of them
+	from, to := min(kingCol, rookCol, kingToCol, rookToCol), max(kingCol, rookCol, kingToCol, rookToCol)
+	for col := from; col <= to; col++ {
+		if col != kingCol && col != rookCol && board.Get(col, rank) != chess.Empty {
+			return fmt.Sprintf("with %c%c occupied", col, rank)
+		}
+	}
+
+	enemy := colour.Opposite()
+	if isSquareAttacked(board, kingCol, rank, enemy) {
+		return "out of check"
+	}
+	// The king's own square no longer blocks lines along the rank once it
+	// has moved
+	crossing := board.Copy()
+	crossing.Set(kingCol, rank, chess.Empty)
+	step := 1
+	if kingToCol < kingCol {
+		step = -1
+	}
+	for c := int(kingCol); c != int(kingToCol); {
+		c += step
+		col := chess.Col(c)
+		if isSquareAttacked(crossing, col, rank, enemy) {
+			if col == kingToCol {
+				return "into check"
+			}
+			return fmt.Sprintf("through the attacked square %c%c", col, rank)
+		}
+	}
+	return ""
+}
+
 // getCastlingInfo returns castling-related board state for a colour.
 func getCastlingInfo(board *chess.Board, colour chess.Colour) (rank chess.Rank, kingCol, kingSideCastle, queenSideCastle chess.Col) {
 	if colour == chess.White {
@@ -75,3 +165,103 @@ func updateCastlingRightsForRook(board *chess.Board, colour chess.Colour, col ch
 		}
 	}
 }
+
+// RepairRookSquareCastling rewrites castling moves written as the king
+// moving onto its own rook (e.g. "e1h1" or "Kxa8", as some UCI-based
+// sources export them) into O-O or O-O-O. It returns the number of moves
+// repaired across the main line and all variations.
+func RepairRookSquareCastling(game *chess.Game) int {
+	if !hasRookSquareTarget(game.Moves) {
+		return 0
+	}
+	return repairCastlingLine(NewBoardForGame(game), game.Moves)
+}
+
+// repairCastlingLine repairs one line of moves played from board.
+func repairCastlingLine(board *chess.Board, moves *chess.Move) int {
+	repaired := 0
+	for move := moves; move != nil; move = move.Next {
+		for _, variation := range move.Variations {
+			repaired += repairCastlingLine(board.Copy(), variation.Moves)
+		}
+		if kingside, ok := rookSquareCastle(board, move); ok {
+			setCastleMove(move, kingside)
+			repaired++
+		}
+		if !ApplyMove(board, move) {
+			break
+		}
+	}
+	return repaired
+}
+
+// rookSquareCastle reports whether move takes the side to move's king from
+// its castling square onto one of its own castling rooks, and if so which
+// side it castles to.
+func rookSquareCastle(board *chess.Board, move *chess.Move) (kingside, ok bool) {
+	if move.Class == chess.KingsideCastle || move.Class == chess.QueensideCastle {
+		return false, false
+	}
+
+	colour := board.ToMove
+	rank, kingCol, kingSideCastle, queenSideCastle := getCastlingInfo(board, colour)
+	if board.Get(kingCol, rank) != chess.MakeColouredPiece(colour, chess.King) || move.ToRank != rank {
+		return false, false
+	}
+
+	// Long algebraic moves decode as pawn moves with an explicit source.
+	fromKing := move.FromCol == kingCol && move.FromRank == rank
+	if move.PieceToMove != chess.King && !fromKing {
+		return false, false
+	}
+	if move.FromCol != 0 && move.FromCol != kingCol {
+		return false, false
+	}
+
+	if board.Get(move.ToCol, rank) != chess.MakeColouredPiece(colour, chess.Rook) {
+		return false, false
+	}
+	switch move.ToCol {
+	case kingSideCastle:
+		return true, true
+	case queenSideCastle:
+		return false, true
+	}
+	return false, false
+}
+
+// setCastleMove turns move into a castling move, keeping any check suffix.
+func setCastleMove(move *chess.Move, kingside bool) {
+	text, class := "O-O-O", chess.QueensideCastle
+	if kingside {
+		text, class = "O-O", chess.KingsideCastle
+	}
+	suffix := move.Text[len(strings.TrimRight(move.Text, "+#")):]
+
+	move.Text = text + suffix
+	move.Class = class
+	move.PieceToMove = chess.King
+	move.FromCol, move.FromRank = 0, 0
+	move.ToCol, move.ToRank = 0, 0
+}
+
+// hasRookSquareTarget reports whether any move in the line or its
+// variations lands on a corner square, the only targets of a castling move
+// written as king takes rook in standard chess.
+func hasRookSquareTarget(moves *chess.Move) bool {
+	for move := moves; move != nil; move = move.Next {
+		text := strings.TrimRight(move.Text, "+#!?")
+		if len(text) >= 2 {
+			switch text[len(text)-2:] {
+			case "a1", "h1", "a8", "h8":
+				return true
+			}
+		}
+		for _, variation := range move.Variations {
+			if hasRookSquareTarget(variation.Moves) {
+				return true
+			}
+		}
+	}
+	return false
+}
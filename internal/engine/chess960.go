@@ -49,53 +49,7 @@ func IsChess960Position(board *chess.Board) bool {
 // BoardToShredderFEN converts a board to a FEN string using Shredder notation for castling.
 // This is used for Chess960 games where castling rights are indicated by rook file letters.
 func BoardToShredderFEN(board *chess.Board) string {
-	var sb strings.Builder
-
-	writePiecePositionsToBuilder(&sb, board)
-	sb.WriteByte(' ')
-	writeSideToMoveToBuilder(&sb, board)
-	sb.WriteByte(' ')
-	writeShredderCastlingRights(&sb, board)
-	sb.WriteByte(' ')
-	writeEnPassantToBuilder(&sb, board)
-	sb.WriteString(" ")
-	sb.WriteString(formatClocks(board))
-
-	return sb.String()
-}
-
-// writePiecePositionsToBuilder writes piece positions to a string builder.
-func writePiecePositionsToBuilder(sb *strings.Builder, board *chess.Board) {
-	for rank := chess.Rank('8'); rank >= '1'; rank-- {
-		emptyCount := 0
-		for col := chess.Col('a'); col <= 'h'; col++ {
-			piece := board.Get(col, rank)
-			if piece == chess.Empty {
-				emptyCount++
-				continue
-			}
-			if emptyCount > 0 {
-				sb.WriteByte(byte('0' + emptyCount))
-				emptyCount = 0
-			}
-			sb.WriteByte(ColouredPieceToSANLetter(piece))
-		}
-		if emptyCount > 0 {
-			sb.WriteByte(byte('0' + emptyCount))
-		}
-		if rank > '1' {
-			sb.WriteByte('/')
-		}
-	}
-}
-
-// writeSideToMoveToBuilder writes the side to move.
-func writeSideToMoveToBuilder(sb *strings.Builder, board *chess.Board) {
-	if board.ToMove == chess.White {
-		sb.WriteByte('w')
-	} else {
-		sb.WriteByte('b')
-	}
+	return BoardToFEN(board, FENOptions{Shredder: true})
 }
 
 // writeShredderCastlingRights writes castling rights using Shredder notation (file letters).
@@ -127,45 +81,6 @@ func writeShredderCastlingRights(sb *strings.Builder, board *chess.Board) {
 	}
 }
 
-// writeEnPassantToBuilder writes the en passant square.
-func writeEnPassantToBuilder(sb *strings.Builder, board *chess.Board) {
-	if board.EnPassant {
-		sb.WriteByte(byte(board.EPCol))
-		sb.WriteByte(byte(board.EPRank))
-	} else {
-		sb.WriteByte('-')
-	}
-}
-
-// formatClocks formats the halfmove clock and move number.
-func formatClocks(board *chess.Board) string {
-	var sb strings.Builder
-	// Write halfmove clock
-	writeUint(&sb, board.HalfmoveClock)
-	sb.WriteByte(' ')
-	// Write move number
-	writeUint(&sb, board.MoveNumber)
-	return sb.String()
-}
-
-// writeUint writes an unsigned integer to a string builder.
-func writeUint(sb *strings.Builder, n uint) {
-	if n == 0 {
-		sb.WriteByte('0')
-		return
-	}
-	// Convert to string manually to avoid fmt import
-	digits := make([]byte, 0, 10)
-	for n > 0 {
-		digits = append(digits, byte('0'+n%10))
-		n /= 10
-	}
-	// Reverse
-	for i := len(digits) - 1; i >= 0; i-- {
-		sb.WriteByte(digits[i])
-	}
-}
-
 // GetFENForGame returns the appropriate FEN string for a game.
 // Uses Shredder notation for Chess960 games, standard notation otherwise.
 func GetFENForGame(board *chess.Board, game *chess.Game, forceChess960 bool) string {
@@ -174,3 +89,10 @@ func GetFENForGame(board *chess.Board, game *chess.Game, forceChess960 bool) str
 	}
 	return BoardToFEN(board)
 }
+
+// FENOptionsForGame returns the FEN options for writing positions of a
+// game that starts from initial: Shredder castling for Chess960 games. The
+// starting position decides, since later kings may have left the e-file.
+func FENOptionsForGame(game *chess.Game, initial *chess.Board) FENOptions {
+	return FENOptions{Shredder: IsChess960Game(game) || IsChess960Position(initial)}
+}
@@ -0,0 +1,218 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// EnPassantProblem describes an en passant capture, or the en passant
+// square of a FEN tag, that does not fit the position. Such problems are
+// commonly introduced by format converters.
+type EnPassantProblem struct {
+	Ply     int    // 1-based ply of the move in the main line, 0 for the FEN tag
+	Written string // the move, or the FEN en passant field, as written
+	Reason  string // what is wrong with it
+	Repair  string // the correction derived from the position, "" if none
+}
+
+// String describes the problem for diagnostics.
+func (p EnPassantProblem) String() string {
+	var s string
+	if p.Ply == 0 {
+		s = fmt.Sprintf("FEN en passant square %s %s", p.Written, p.Reason)
+	} else {
+		s = fmt.Sprintf("ply %d: %s %s", p.Ply, p.Written, p.Reason)
+	}
+	if p.Repair != "" {
+		s += fmt.Sprintf(" (should be %s)", p.Repair)
+	}
+	return s
+}
+
+// CheckEnPassant replays a game's main line and reports en passant
+// problems: a FEN en passant square that no double pawn push explains, or
+// one missing for a first-move capture; a capture marked "e.p." that is
+// not en passant; a pawn capture onto an empty square with no en passant
+// capture available; and an en passant capture written onto the square of
+// the pawn it takes. Replay stops at the first move that cannot be played.
+func CheckEnPassant(game *chess.Game) []EnPassantProblem {
+	return auditEnPassant(game, false)
+}
+
+// RepairEnPassant corrects the problems CheckEnPassant finds a correction
+// for, rewriting the FEN tag or the moves, and returns all it found.
+func RepairEnPassant(game *chess.Game) []EnPassantProblem {
+	return auditEnPassant(game, true)
+}
+
+func auditEnPassant(game *chess.Game, repair bool) []EnPassantProblem {
+	var problems []EnPassantProblem
+	if problem, ok := checkFENEnPassant(game); ok {
+		problems = append(problems, problem)
+		if repair && problem.Repair != "" {
+			setFENEnPassant(game, problem.Repair)
+		}
+	}
+
+	board := NewBoardForGame(game)
+	ply := 0
+	for move := game.Moves; move != nil; move = move.Next {
+		ply++
+		if problem, ok := checkEnPassantMove(board, move); ok {
+			problem.Ply = ply
+			problems = append(problems, problem)
+			if repair && problem.Repair != "" {
+				repairEnPassantMove(board, move)
+			}
+		}
+		if !ApplyMove(board, move) {
+			break
+		}
+	}
+	return problems
+}
+
+// checkFENEnPassant checks the en passant field of a game's FEN tag.
+func checkFENEnPassant(game *chess.Game) (EnPassantProblem, bool) {
+	fen, ok := game.Tags["FEN"]
+	if !ok {
+		return EnPassantProblem{}, false
+	}
+	fields := strings.Fields(fen)
+	board, err := NewBoardFromFEN(fen)
+	if err != nil || len(fields) < 4 {
+		return EnPassantProblem{}, false
+	}
+
+	if board.EnPassant {
+		if !doublePushBehind(board, board.EPCol, board.EPRank) {
+			return EnPassantProblem{Written: fields[3], Reason: "does not follow a double pawn push", Repair: "-"}, true
+		}
+		return EnPassantProblem{}, false
+	}
+
+	// A first move capturing onto the square behind a pawn that could just
+	// have been pushed two squares needs the field
+	move := game.Moves
+	if move == nil || !isPawnCapture(board, move) || board.Get(move.ToCol, move.ToRank) != chess.Empty ||
+		!doublePushBehind(board, move.ToCol, move.ToRank) {
+		return EnPassantProblem{}, false
+	}
+	square := fmt.Sprintf("%c%c", move.ToCol, move.ToRank)
+	return EnPassantProblem{Written: fields[3], Reason: "is missing for the capture " + move.Text, Repair: square}, true
+}
+
+// setFENEnPassant rewrites the en passant field of a game's FEN tag.
+func setFENEnPassant(game *chess.Game, square string) {
+	fields := strings.Fields(game.Tags["FEN"])
+	fields[3] = square
+	game.Tags["FEN"] = strings.Join(fields, " ")
+}
+
+// doublePushBehind reports whether an en passant target square for the
+// side to move fits the position: it and the square the pawn came from
+// are empty and the opponent's pawn stands in front of it.
+func doublePushBehind(board *chess.Board, col chess.Col, rank chess.Rank) bool {
+	targetRank, pushedRank, originRank := chess.Rank('6'), chess.Rank('5'), chess.Rank('7')
+	if board.ToMove == chess.Black {
+		targetRank, pushedRank, originRank = '3', '4', '2'
+	}
+	return rank == targetRank && col >= 'a' && col <= 'h' &&
+		board.Get(col, rank) == chess.Empty &&
+		board.Get(col, originRank) == chess.Empty &&
+		board.Get(col, pushedRank) == chess.MakeColouredPiece(board.ToMove.Opposite(), chess.Pawn)
+}
+
+// isPawnCapture reports whether move is a pawn capture by the side to
+// move, written with the file it captures from.
+func isPawnCapture(board *chess.Board, move *chess.Move) bool {
+	if move.Class != chess.PawnMove && move.Class != chess.EnPassantPawnMove {
+		return false
+	}
+	if move.FromCol == 0 || move.FromCol == move.ToCol {
+		return false
+	}
+	if move.FromRank != 0 {
+		return board.Get(move.FromCol, move.FromRank) == chess.MakeColouredPiece(board.ToMove, chess.Pawn)
+	}
+	return true
+}
+
+// checkEnPassantMove checks one move against the position before it.
+func checkEnPassantMove(board *chess.Board, move *chess.Move) (EnPassantProblem, bool) {
+	if !isPawnCapture(board, move) || isEnPassantSquare(board, move.ToCol, move.ToRank) {
+		return EnPassantProblem{}, false
+	}
+	problem := EnPassantProblem{Written: move.Text}
+	target := board.Get(move.ToCol, move.ToRank)
+
+	switch {
+	case capturesOnPassedSquare(board, move):
+		problem.Reason = "is written onto the square of the pawn it takes en passant"
+		problem.Repair = enPassantText(move, board.EPRank)
+	case markedEnPassant(move) && target != chess.Empty:
+		problem.Reason = "is marked e.p. but is an ordinary capture"
+		problem.Repair = unmarkedText(move)
+	case markedEnPassant(move):
+		problem.Reason = "is marked e.p. but does not follow a double pawn push"
+	case target == chess.Empty:
+		problem.Reason = "captures on an empty square with no en passant capture available"
+	default:
+		return EnPassantProblem{}, false
+	}
+	return problem, true
+}
+
+// capturesOnPassedSquare reports whether a pawn capture is written onto
+// the square of a pawn that has just been pushed two squares past it,
+// where only an en passant capture can take it.
+func capturesOnPassedSquare(board *chess.Board, move *chess.Move) bool {
+	own := chess.MakeColouredPiece(board.ToMove, chess.Pawn)
+	behind, source := move.ToRank+1, move.ToRank-1
+	if board.ToMove == chess.Black {
+		behind, source = move.ToRank-1, move.ToRank+1
+	}
+	return board.EnPassant && board.EPCol == move.ToCol && board.EPRank == behind &&
+		board.Get(move.ToCol, move.ToRank) == chess.MakeColouredPiece(board.ToMove.Opposite(), chess.Pawn) &&
+		board.Get(move.FromCol, move.ToRank) == own &&
+		board.Get(move.FromCol, source) != own
+}
+
+// repairEnPassantMove rewrites a move checkEnPassantMove found a
+// correction for.
+func repairEnPassantMove(board *chess.Board, move *chess.Move) {
+	if capturesOnPassedSquare(board, move) {
+		move.Text = enPassantText(move, board.EPRank)
+		move.ToRank = board.EPRank
+		move.FromRank = 0
+		move.Class = chess.EnPassantPawnMove
+		return
+	}
+	move.Text = unmarkedText(move)
+	move.Class = chess.PawnMove
+}
+
+// markedEnPassant reports whether a move is written with an "e.p." or "ep"
+// suffix.
+func markedEnPassant(move *chess.Move) bool {
+	text := strings.TrimRight(move.Text, "+#")
+	return strings.HasSuffix(text, "e.p.") || strings.HasSuffix(text, "ep")
+}
+
+// unmarkedText returns a move's text without its en passant marker,
+// keeping any check suffix.
+func unmarkedText(move *chess.Move) string {
+	text := strings.TrimRight(move.Text, "+#")
+	suffix := move.Text[len(text):]
+	text = strings.TrimSuffix(strings.TrimSuffix(text, "e.p."), "ep")
+	return strings.TrimSpace(text) + suffix
+}
+
+// enPassantText writes a pawn capture onto rank in SAN, keeping any check
+// suffix.
+func enPassantText(move *chess.Move, rank chess.Rank) string {
+	suffix := move.Text[len(strings.TrimRight(move.Text, "+#")):]
+	return fmt.Sprintf("%cx%c%c%s", move.FromCol, move.ToCol, rank, suffix)
+}
@@ -3,6 +3,7 @@ package engine
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -61,58 +62,108 @@ func ColouredPieceToSANLetter(colouredPiece chess.Piece) byte {
 	return letter
 }
 
-// NewBoardFromFEN creates a board from a FEN string.
+// FEN field names, as FENError reports them.
+const (
+	FENPiecePlacement = "piece placement"
+	FENSideToMove     = "side to move"
+	FENCastling       = "castling rights"
+	FENEnPassant      = "en passant square"
+	FENHalfmoveClock  = "halfmove clock"
+	FENFullmoveNumber = "fullmove number"
+)
+
+// FENError reports the field of a FEN string that could not be read. It
+// wraps errors.ErrInvalidFEN.
+type FENError struct {
+	Field  string // one of the FEN field names, or "" for an empty FEN
+	Value  string // the field as written
+	Reason string
+}
+
+func (e *FENError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%v: %s", errors.ErrInvalidFEN, e.Reason)
+	}
+	return fmt.Sprintf("%v: %s %q: %s", errors.ErrInvalidFEN, e.Field, e.Value, e.Reason)
+}
+
+func (e *FENError) Unwrap() error {
+	return errors.ErrInvalidFEN
+}
+
+// NewBoardFromFEN creates a board from a FEN string, returning a
+// *FENError naming the malformed field. It accepts what third-party tools
+// commonly write: any spacing between fields, fields missing from the
+// side to move onwards (White to move, no castling or en passant, clocks
+// 0 and 1), "-" for the clocks, W or B for the side to move and a move
+// number of 0. Fields after the sixth are ignored.
 func NewBoardFromFEN(fen string) (*chess.Board, error) {
 	parts := strings.Fields(fen)
 	if len(parts) < 1 {
-		return nil, fmt.Errorf("empty FEN string: %w", errors.ErrInvalidFEN)
+		return nil, &FENError{Reason: "empty"}
+	}
+	field := func(i int) string {
+		if i < len(parts) {
+			return parts[i]
+		}
+		return "-"
 	}
 
 	board := chess.NewBoard()
-
 	if err := parsePiecePositions(board, parts[0]); err != nil {
 		return nil, err
 	}
-
-	if err := parseSideToMove(board, parts); err != nil {
+	if err := parseSideToMove(board, field(1)); err != nil {
+		return nil, err
+	}
+	if err := parseCastlingRights(board, field(2)); err != nil {
+		return nil, err
+	}
+	if err := parseEnPassant(board, field(3)); err != nil {
+		return nil, err
+	}
+	if err := parseClocks(board, field(4), field(5)); err != nil {
 		return nil, err
 	}
-
-	parseCastlingRights(board, parts)
-	parseEnPassant(board, parts)
-	parseClocks(board, parts)
-
 	return board, nil
 }
 
-// parsePiecePositions parses the piece placement field of a FEN string.
+// parsePiecePositions parses the piece placement field of a FEN string:
+// eight ranks of eight squares from a8, separated by slashes.
 func parsePiecePositions(board *chess.Board, positions string) error {
-	rank := chess.Rank('8')
-	col := chess.Col('a')
-
-	for _, c := range positions {
-		switch {
-		case c == '/':
-			rank--
-			col = 'a'
-		case c >= '1' && c <= '8':
-			col += chess.Col(c - '0')
-		default:
-			piece := ConvertFENCharToPiece(byte(c))
+	fail := func(format string, args ...any) error {
+		return &FENError{Field: FENPiecePlacement, Value: positions, Reason: fmt.Sprintf(format, args...)}
+	}
+	ranks := strings.Split(positions, "/")
+	if len(ranks) != 8 {
+		return fail("rank count %d, not 8", len(ranks))
+	}
+	for i, pieces := range ranks {
+		rank := chess.Rank('8' - i)
+		col := chess.Col('a')
+		for _, c := range pieces {
+			if c >= '1' && c <= '8' {
+				col += chess.Col(c - '0')
+				if col > 'h'+1 {
+					return fail("rank %c has more than 8 squares", rank)
+				}
+				continue
+			}
+			piece := chess.Empty
+			if c < 0x80 {
+				piece = ConvertFENCharToPiece(byte(c))
+			}
 			if piece == chess.Empty {
-				return fmt.Errorf("invalid piece character: %c: %w", c, errors.ErrInvalidFEN)
+				return fail("invalid piece character %q", c)
 			}
-			if col > 'h' || rank < '1' {
-				return fmt.Errorf("position out of bounds: %w", errors.ErrInvalidFEN)
+			if col > 'h' {
+				return fail("rank %c has more than 8 squares", rank)
 			}
-
 			colour := chess.White
 			if unicode.IsLower(c) {
 				colour = chess.Black
 			}
-
 			board.Set(col, rank, chess.MakeColouredPiece(colour, piece))
-
 			if piece == chess.King {
 				if colour == chess.White {
 					board.WKingCol, board.WKingRank = col, rank
@@ -122,52 +173,57 @@ func parsePiecePositions(board *chess.Board, positions string) error {
 			}
 			col++
 		}
+		if col != 'h'+1 {
+			return fail("rank %c has %d squares, not 8", rank, col-'a')
+		}
 	}
 	return nil
 }
 
 // parseSideToMove parses the side to move field.
-func parseSideToMove(board *chess.Board, parts []string) error {
-	if len(parts) < 2 {
-		return nil
-	}
-	switch parts[1] {
-	case "w":
+func parseSideToMove(board *chess.Board, side string) error {
+	switch side {
+	case "w", "W", "-":
 		board.ToMove = chess.White
-	case "b":
+	case "b", "B":
 		board.ToMove = chess.Black
 	default:
-		return fmt.Errorf("invalid side to move: %s: %w", parts[1], errors.ErrInvalidFEN)
+		return &FENError{Field: FENSideToMove, Value: side, Reason: "not w or b"}
 	}
 	return nil
 }
 
-// parseCastlingRights parses the castling availability field.
-func parseCastlingRights(board *chess.Board, parts []string) {
+// parseCastlingRights parses the castling availability field: "-", or
+// KQkq and the files of Chess960 castling rooks, each at most once.
+func parseCastlingRights(board *chess.Board, rights string) error {
 	board.WKingCastle = 0
 	board.WQueenCastle = 0
 	board.BKingCastle = 0
 	board.BQueenCastle = 0
 
-	if len(parts) < 3 || parts[2] == "-" {
-		return
+	if rights == "-" {
+		return nil
 	}
-
-	for _, c := range parts[2] {
-		switch c {
-		case 'K':
+	for i, c := range rights {
+		if strings.ContainsRune(rights[:i], c) {
+			return &FENError{Field: FENCastling, Value: rights, Reason: fmt.Sprintf("%q repeated", c)}
+		}
+		switch {
+		case c == 'K':
 			board.WKingCastle = 'h'
-		case 'Q':
+		case c == 'Q':
 			board.WQueenCastle = 'a'
-		case 'k':
+		case c == 'k':
 			board.BKingCastle = 'h'
-		case 'q':
+		case c == 'q':
 			board.BQueenCastle = 'a'
-		default:
-			// Chess960 notation - column letter
+		case c >= 'A' && c <= 'H', c >= 'a' && c <= 'h':
 			parseCastling960(board, c)
+		default:
+			return &FENError{Field: FENCastling, Value: rights, Reason: fmt.Sprintf("invalid character %q", c)}
 		}
 	}
+	return nil
 }
 
 // parseCastling960 handles Chess960 castling notation.
@@ -189,44 +245,123 @@ func parseCastling960(board *chess.Board, c rune) {
 	}
 }
 
-// parseEnPassant parses the en passant target square field.
-func parseEnPassant(board *chess.Board, parts []string) {
+// parseEnPassant parses the en passant target square field: "-" or a
+// square. Squares no double push explains are accepted, for --en-passant
+// to report or repair.
+func parseEnPassant(board *chess.Board, square string) error {
 	board.EnPassant = false
-	if len(parts) < 4 || parts[3] == "-" || len(parts[3]) != 2 {
-		return
+	if square == "-" {
+		return nil
+	}
+	if len(square) != 2 || square[0] < 'a' || square[0] > 'h' || square[1] < '1' || square[1] > '8' {
+		return &FENError{Field: FENEnPassant, Value: square, Reason: "not - or a square"}
 	}
 	board.EnPassant = true
-	board.EPCol = chess.Col(parts[3][0])
-	board.EPRank = chess.Rank(parts[3][1])
+	board.EPCol = chess.Col(square[0])
+	board.EPRank = chess.Rank(square[1])
+	return nil
 }
 
-// parseClocks parses the halfmove clock and fullmove number fields.
-func parseClocks(board *chess.Board, parts []string) {
-	if len(parts) >= 5 {
-		fmt.Sscanf(parts[4], "%d", &board.HalfmoveClock) //nolint:gosec // G104: default 0 is acceptable
+// parseClocks parses the halfmove clock and fullmove number fields, where
+// "-" gives 0 and 1.
+func parseClocks(board *chess.Board, halfmove, fullmove string) error {
+	board.HalfmoveClock, board.MoveNumber = 0, 1
+	if halfmove != "-" {
+		n, err := strconv.ParseUint(halfmove, 10, 31)
+		if err != nil {
+			return &FENError{Field: FENHalfmoveClock, Value: halfmove, Reason: "not a number of plies"}
+		}
+		board.HalfmoveClock = uint(n)
 	}
-	if len(parts) >= 6 {
-		fmt.Sscanf(parts[5], "%d", &board.MoveNumber) //nolint:gosec // G104: default 0 is acceptable
+	if fullmove != "-" {
+		n, err := strconv.ParseUint(fullmove, 10, 31)
+		if err != nil {
+			return &FENError{Field: FENFullmoveNumber, Value: fullmove, Reason: "not a move number"}
+		}
+		// Move numbers start at 1; some generators write 0
+		board.MoveNumber = max(uint(n), 1)
 	}
+	return nil
 }
 
-// BoardToFEN converts a board to a FEN string.
-func BoardToFEN(board *chess.Board) string {
-	var sb strings.Builder
+// FENOptions controls the fields BoardToFEN writes. The zero value gives
+// a standard six-field FEN.
+type FENOptions struct {
+	// OmitClocks leaves out the halfmove clock and fullmove number, or
+	// their hmvc and fmvn operations in EPD.
+	OmitClocks bool
+	// Shredder writes castling rights as the files of the castling rooks
+	// (Shredder-FEN), as Chess960 positions need.
+	Shredder bool
+	// EPD writes an EPD record: the four position fields followed by
+	// operations, with the clocks as hmvc and fmvn.
+	EPD bool
+	// Operations are further EPD operations, written after the clocks.
+	// They are ignored unless EPD is set.
+	Operations []EPDOperation
+}
 
+// EPDOperation is an EPD opcode with its operands, such as bm Nf3 or
+// id "test 1". Operands are written as given; use EPDString to quote
+// string operands.
+type EPDOperation struct {
+	Opcode   string
+	Operands []string
+}
+
+// EPDString quotes a string operand for an EPD operation.
+func EPDString(s string) string {
+	return strconv.Quote(s)
+}
+
+// BoardToFEN converts a board to a FEN string, or to an EPD record when
+// opts.EPD is set. Without options it writes a standard six-field FEN.
+func BoardToFEN(board *chess.Board, opts ...FENOptions) string {
+	var o FENOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	var sb strings.Builder
 	writePiecePositions(&sb, board)
 	sb.WriteByte(' ')
 	writeSideToMove(&sb, board)
 	sb.WriteByte(' ')
-	writeCastlingRights(&sb, board)
+	if o.Shredder {
+		writeShredderCastlingRights(&sb, board)
+	} else {
+		writeCastlingRights(&sb, board)
+	}
 	sb.WriteByte(' ')
 	writeEnPassant(&sb, board)
-	sb.WriteByte(' ')
-	fmt.Fprintf(&sb, "%d %d", board.HalfmoveClock, board.MoveNumber)
 
+	if !o.EPD {
+		if !o.OmitClocks {
+			fmt.Fprintf(&sb, " %d %d", board.HalfmoveClock, board.MoveNumber)
+		}
+		return sb.String()
+	}
+	if !o.OmitClocks {
+		fmt.Fprintf(&sb, " hmvc %d; fmvn %d;", board.HalfmoveClock, board.MoveNumber)
+	}
+	for _, op := range o.Operations {
+		sb.WriteByte(' ')
+		sb.WriteString(op.Opcode)
+		for _, operand := range op.Operands {
+			sb.WriteByte(' ')
+			sb.WriteString(operand)
+		}
+		sb.WriteByte(';')
+	}
 	return sb.String()
 }
 
+// BoardToEPD converts a board to an EPD string, carrying the halfmove
+// clock and fullmove number as hmvc and fmvn operations.
+func BoardToEPD(board *chess.Board) string {
+	return BoardToFEN(board, FENOptions{EPD: true})
+}
+
 // writePiecePositions writes the piece placement to the builder.
 func writePiecePositions(sb *strings.Builder, board *chess.Board) {
 	for rank := chess.Rank('8'); rank >= '1'; rank-- {
@@ -295,20 +430,16 @@ func writeEnPassant(sb *strings.Builder, board *chess.Board) {
 	}
 }
 
-// MustBoardFromFEN creates a board from a FEN string, panicking on error.
-// Use only with known-valid FEN constants (e.g., InitialFEN).
-func MustBoardFromFEN(fen string) *chess.Board {
-	board, err := NewBoardFromFEN(fen)
-	if err != nil {
-		panic(fmt.Sprintf("MustBoardFromFEN: invalid FEN %q: %v", fen, err))
-	}
-	return board
-}
-
 // cachedInitialBoard holds the pre-parsed initial position as a value.
 // Board is a pure value type (fixed arrays + scalars, no pointers/slices),
 // so assignment copies it fully.
-var cachedInitialBoard = *MustBoardFromFEN(InitialFEN)
+var cachedInitialBoard = func() chess.Board {
+	board, err := NewBoardFromFEN(InitialFEN)
+	if err != nil {
+		panic(err)
+	}
+	return *board
+}()
 
 // NewInitialBoard creates a board with the standard starting position.
 // Returns a fresh copy each time since callers mutate the board.
@@ -9,6 +9,16 @@ import (
 	perrors "github.com/lgbarn/pgn-extract-go/internal/errors"
 )
 
+// mustBoardFromFEN creates a board from a FEN string known to be valid,
+// panicking on error.
+func mustBoardFromFEN(fen string) *chess.Board {
+	board, err := NewBoardFromFEN(fen)
+	if err != nil {
+		panic(err)
+	}
+	return board
+}
+
 func TestNewBoardFromFEN(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -116,6 +126,57 @@ func TestBoardToFEN(t *testing.T) {
 	}
 }
 
+func TestBoardToEPD(t *testing.T) {
+	tests := []struct {
+		fen  string
+		want string
+	}{
+		{InitialFEN, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - hmvc 0; fmvn 1;"},
+		{"8/8/8/4k3/8/8/4K3/4R3 b - - 10 40", "8/8/8/4k3/8/8/4K3/4R3 b - - hmvc 10; fmvn 40;"},
+		{"8/8/8/4k3/8/8/4K3/4R3 w - - 0 0", "8/8/8/4k3/8/8/4K3/4R3 w - - hmvc 0; fmvn 1;"},
+	}
+
+	for _, tt := range tests {
+		board := mustBoardFromFEN(tt.fen)
+		if got := BoardToEPD(board); got != tt.want {
+			t.Errorf("BoardToEPD(%q) = %q, want %q", tt.fen, got, tt.want)
+		}
+	}
+}
+
+func TestBoardToFENOptions(t *testing.T) {
+	const chess960 = "bqnbrkrn/pppppppp/8/8/8/8/PPPPPPPP/BQNBRKRN w GEge - 3 12"
+	tests := []struct {
+		name string
+		fen  string
+		opts FENOptions
+		want string
+	}{
+		{"default", chess960, FENOptions{}, "bqnbrkrn/pppppppp/8/8/8/8/PPPPPPPP/BQNBRKRN w KQkq - 3 12"},
+		{"shredder", chess960, FENOptions{Shredder: true}, "bqnbrkrn/pppppppp/8/8/8/8/PPPPPPPP/BQNBRKRN w GEge - 3 12"},
+		{"no clocks", InitialFEN, FENOptions{OmitClocks: true}, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq -"},
+		{"epd no clocks", InitialFEN, FENOptions{EPD: true, OmitClocks: true}, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq -"},
+		{
+			name: "epd operations",
+			fen:  InitialFEN,
+			opts: FENOptions{EPD: true, Operations: []EPDOperation{
+				{Opcode: "bm", Operands: []string{"e4", "d4"}},
+				{Opcode: "id", Operands: []string{EPDString(`opening "1"`)}},
+			}},
+			want: `rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - hmvc 0; fmvn 1; bm e4 d4; id "opening \"1\"";`,
+		},
+		{"operations ignored in fen", InitialFEN, FENOptions{Operations: []EPDOperation{{Opcode: "bm"}}}, InitialFEN},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BoardToFEN(mustBoardFromFEN(tt.fen), tt.opts); got != tt.want {
+				t.Errorf("BoardToFEN() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestApplyMove(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -225,3 +286,86 @@ func TestNewBoardFromFEN_ErrorTypes(t *testing.T) {
 		})
 	}
 }
+
+func TestNewBoardFromFEN_FieldErrors(t *testing.T) {
+	tests := []struct {
+		fen   string
+		field string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", FENPiecePlacement},
+		{"rnbqkbnr/pppppppp/8/8/45/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", FENPiecePlacement},
+		{"rnbqkbnr/pppppppp/8/8/8/7/PPPPPPPP/RNBQKBNR w KQkq - 0 1", FENPiecePlacement},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPPP/RNBQKBNR w KQkq - 0 1", FENPiecePlacement},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR white KQkq - 0 1", FENSideToMove},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkx - 0 1", FENCastling},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KKq - 0 1", FENCastling},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e9 0 1", FENEnPassant},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - x 1", FENHalfmoveClock},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 -3", FENFullmoveNumber},
+	}
+	for _, tt := range tests {
+		_, err := NewBoardFromFEN(tt.fen)
+		var fenErr *FENError
+		if !errors.As(err, &fenErr) || !errors.Is(err, perrors.ErrInvalidFEN) {
+			t.Errorf("NewBoardFromFEN(%q) error = %v, want a FENError", tt.fen, err)
+			continue
+		}
+		if fenErr.Field != tt.field || !strings.Contains(err.Error(), tt.field) {
+			t.Errorf("NewBoardFromFEN(%q) error = %v, want the %s field", tt.fen, err, tt.field)
+		}
+	}
+}
+
+func TestNewBoardFromFEN_Lenient(t *testing.T) {
+	want := mustBoardFromFEN("4k3/8/8/8/8/8/8/4K3 w - - 0 1")
+	for _, fen := range []string{
+		"4k3/8/8/8/8/8/8/4K3",
+		"4k3/8/8/8/8/8/8/4K3 w",
+		"4k3/8/8/8/8/8/8/4K3 w - -",
+		"  4k3/8/8/8/8/8/8/4K3   w  -  -   0  1 ",
+		"4k3/8/8/8/8/8/8/4K3 W - - - -",
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 0",
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 1 bm Kd2;",
+	} {
+		board, err := NewBoardFromFEN(fen)
+		if err != nil {
+			t.Errorf("NewBoardFromFEN(%q) error = %v", fen, err)
+			continue
+		}
+		if got := BoardToFEN(board); got != BoardToFEN(want) {
+			t.Errorf("NewBoardFromFEN(%q) = %s, want %s", fen, got, BoardToFEN(want))
+		}
+	}
+}
+
+func FuzzNewBoardFromFEN(f *testing.F) {
+	for _, fen := range []string{
+		InitialFEN,
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+		"4k3/8/8/8/8/8/8/4K3",
+		"8/8/8/8/8/8/8/8 b - - 99 -",
+		"rnbqkbnr/ppppXppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+	} {
+		f.Add(fen)
+	}
+	f.Fuzz(func(t *testing.T, fen string) {
+		board, err := NewBoardFromFEN(fen)
+		if err != nil {
+			var fenErr *FENError
+			if !errors.As(err, &fenErr) {
+				t.Fatalf("NewBoardFromFEN(%q) error %v is not a FENError", fen, err)
+			}
+			return
+		}
+		// What is read must be written back as a FEN that reads the same
+		written := BoardToFEN(board)
+		again, err := NewBoardFromFEN(written)
+		if err != nil {
+			t.Fatalf("NewBoardFromFEN(%q) wrote %q, which does not read back: %v", fen, written, err)
+		}
+		if rewritten := BoardToFEN(again); rewritten != written {
+			t.Fatalf("NewBoardFromFEN(%q) wrote %q, then %q", fen, written, rewritten)
+		}
+	})
+}
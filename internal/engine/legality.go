@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// IllegalMove describes the first main-line move of a game that cannot be
+// played.
+type IllegalMove struct {
+	Ply     int    // 1-based ply of the move in the main line, 0 for an invalid FEN
+	Written string // the move as it appears in the game
+	Reason  string // why the move cannot be played
+}
+
+// String describes the move for diagnostics.
+func (m IllegalMove) String() string {
+	if m.Ply == 0 {
+		return m.Reason
+	}
+	return fmt.Sprintf("ply %d: %s %s", m.Ply, m.Written, m.Reason)
+}
+
+// FirstIllegalMove replays a game's main line and returns the first move
+// that MoveProblem rejects, or false if every move can be played. A FEN
+// tag that cannot be read is returned as the problem at ply 0.
+func FirstIllegalMove(game *chess.Game) (IllegalMove, bool) {
+	board := NewInitialBoard()
+	if fen, ok := game.Tags["FEN"]; ok {
+		fenBoard, err := NewBoardFromFEN(fen)
+		if err != nil {
+			return IllegalMove{Reason: err.Error()}, true
+		}
+		board = fenBoard
+	}
+
+	ply := 0
+	for move := game.Moves; move != nil; move = move.Next {
+		ply++
+		if reason := MoveProblem(board, move); reason != "" {
+			return IllegalMove{Ply: ply, Written: move.Text, Reason: reason}, true
+		}
+		ApplyMove(board, move)
+	}
+	return IllegalMove{}, false
+}
+
+// MoveProblem returns why a move cannot be played in a position, or "" if
+// it can. The board is not changed. It is stricter than ApplyMove, which
+// plays moves that leave the king in check, castle against the castling
+// rules or capture a piece of the mover's own colour.
+func MoveProblem(board *chess.Board, move *chess.Move) string {
+	if move == nil {
+		return "is not a move"
+	}
+	classifyFromSquare(board, move)
+
+	switch move.Class {
+	case chess.NullMove:
+		return ""
+	case chess.KingsideCastle, chess.QueensideCastle:
+		if reason := castlingProblem(board, move.Class == chess.KingsideCastle); reason != "" {
+			return "castles " + reason
+		}
+		return ""
+	case chess.PawnMove, chess.PawnMoveWithPromotion, chess.EnPassantPawnMove:
+		if reason := pawnMoveProblem(board, move); reason != "" {
+			return reason
+		}
+	case chess.PieceMove:
+		if reason := pieceMoveProblem(board, move); reason != "" {
+			return reason
+		}
+	default:
+		return "is not a move"
+	}
+
+	colour := board.ToMove
+	after := board.Copy()
+	played := *move // ApplyMove may reclassify the move
+	if !ApplyMove(after, &played) {
+		return "cannot be played"
+	}
+	if IsInCheck(after, colour) {
+		return "leaves the king in check"
+	}
+	return ""
+}
+
+// pawnMoveProblem checks a pawn move's source and target squares.
+func pawnMoveProblem(board *chess.Board, move *chess.Move) string {
+	colour := board.ToMove
+	target := squareName(move.ToCol, move.ToRank)
+	fromCol, fromRank := move.FromCol, move.FromRank
+	if fromCol == 0 || fromRank == 0 {
+		fromCol, fromRank = findPawnSource(board, move, colour)
+	}
+	if fromCol == 0 || board.Get(fromCol, fromRank) != chess.MakeColouredPiece(colour, chess.Pawn) {
+		return "has no pawn that can move to " + target
+	}
+
+	occupant := board.Get(move.ToCol, move.ToRank)
+	if fromCol == move.ToCol {
+		if occupant != chess.Empty {
+			return "moves onto the occupied square " + target
+		}
+		return ""
+	}
+	switch {
+	case occupant == chess.Empty && !isEnPassantSquare(board, move.ToCol, move.ToRank):
+		return "captures on the empty square " + target
+	case occupant != chess.Empty && chess.ExtractColour(occupant) == colour:
+		return "captures a piece of its own colour on " + target
+	}
+	return ""
+}
+
+// pieceMoveProblem checks that exactly one piece of the type written, and
+// fitting its disambiguation, can legally move to the target square.
+func pieceMoveProblem(board *chess.Board, move *chess.Move) string {
+	colour := board.ToMove
+	target := squareName(move.ToCol, move.ToRank)
+	name := strings.ToLower(move.PieceToMove.String())
+	if occupant := board.Get(move.ToCol, move.ToRank); occupant != chess.Empty &&
+		chess.ExtractColour(occupant) == colour {
+		return "moves onto a piece of its own colour on " + target
+	}
+
+	piece := chess.MakeColouredPiece(colour, move.PieceToMove)
+	reachable, legal := 0, 0
+	for col := chess.Col('a'); col <= 'h'; col++ {
+		for rank := chess.Rank('1'); rank <= '8'; rank++ {
+			if board.Get(col, rank) != piece ||
+				(move.FromCol != 0 && col != move.FromCol) ||
+				(move.FromRank != 0 && rank != move.FromRank) ||
+				!canPieceMove(board, move.PieceToMove, col, rank, move.ToCol, move.ToRank) {
+				continue
+			}
+			reachable++
+			if tryMove(board, col, rank, move.ToCol, move.ToRank, colour) {
+				legal++
+			}
+		}
+	}
+	switch {
+	case reachable == 0:
+		return fmt.Sprintf("has no %s that can move to %s", name, target)
+	case legal == 0:
+		return "leaves the king in check"
+	case legal > 1:
+		return "is ambiguous"
+	}
+	return ""
+}
+
+// squareName returns a square in algebraic notation, such as "e4".
+func squareName(col chess.Col, rank chess.Rank) string {
+	return string([]byte{byte(col), byte(rank)})
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/testutil"
+)
+
+func TestFirstIllegalMove(t *testing.T) {
+	tests := []struct {
+		name    string
+		moves   string
+		wantPly int // 0 if every move is legal
+		want    string
+	}{
+		{"legal", "1. e4 e5 2. Nf3 Nc6 3. Bb5 a6", 0, ""},
+		{"unreachable", "1. e4 e5 2. Ke3", 3, "ply 3: Ke3 has no king that can move to e3"},
+		{"pinned", "1. d4 e5 2. Nc3 Bb4 3. Ne4", 5, "ply 5: Ne4 leaves the king in check"},
+		{"own piece", "1. Nd2", 1, "ply 1: Nd2 moves onto a piece of its own colour on d2"},
+		{"empty capture", "1. e4 d5 2. exf5", 3, "ply 3: exf5 captures on the empty square f5"},
+		{"blocked pawn", "1. e4 e5 2. e5", 3, "ply 3: e5 moves onto the occupied square e5"},
+		{"castling", "1. O-O", 1, "ply 1: O-O castles with f1 occupied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := testutil.MustParseGame(t, "[Event \"T\"]\n\n"+tt.moves+" *\n")
+			illegal, found := FirstIllegalMove(game)
+			if found != (tt.wantPly > 0) {
+				t.Fatalf("FirstIllegalMove() found = %v (%s), want %v", found, illegal, tt.wantPly > 0)
+			}
+			if found && (illegal.Ply != tt.wantPly || illegal.String() != tt.want) {
+				t.Errorf("FirstIllegalMove() = %q, want %q", illegal, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirstIllegalMove_InvalidFEN(t *testing.T) {
+	game := testutil.MustParseGame(t, "[Event \"T\"]\n[SetUp \"1\"]\n[FEN \"not a fen\"]\n\n1. e4 *\n")
+	illegal, found := FirstIllegalMove(game)
+	if !found || illegal.Ply != 0 || illegal.Reason != `invalid FEN string: piece placement "not": rank count 1, not 8` {
+		t.Errorf("FirstIllegalMove() = %+v, %v; want the invalid FEN at ply 0", illegal, found)
+	}
+}
+
+// TestApplyMove_SkipsPinnedPiece checks that a move only one of two pieces
+// may legally make moves that one, as SAN does not disambiguate it.
+func TestApplyMove_SkipsPinnedPiece(t *testing.T) {
+	game := testutil.MustParseGame(t, "[Event \"T\"]\n\n1. d4 e6 2. e4 b6 3. Nc3 Bb4 4. Ne2 *\n")
+	board, _, err := ReplayGame(game)
+	if err != nil {
+		t.Fatalf("ReplayGame: %v", err)
+	}
+	if board.Get('c', '3') != chess.W(chess.Knight) || board.Get('g', '1') != chess.Empty {
+		t.Error("Ne2 should move the knight on g1, not the pinned knight on c3")
+	}
+	if _, found := FirstIllegalMove(game); found {
+		t.Error("Ne2 should be legal")
+	}
+}
@@ -2,8 +2,8 @@ package engine
 
 import "github.com/lgbarn/pgn-extract-go/internal/chess"
 
-// applyPawnMove applies a pawn move.
-func applyPawnMove(board *chess.Board, move *chess.Move) bool {
+// applyPawnMove applies a pawn move, recording the squares it changes.
+func applyPawnMove(board *chess.Board, move *chess.Move, changes *Changes) bool {
 	colour := board.ToMove
 	fromCol, fromRank := move.FromCol, move.FromRank
 	toCol, toRank := move.ToCol, move.ToRank
@@ -17,6 +17,12 @@ func applyPawnMove(board *chess.Board, move *chess.Move) bool {
 
 	pawn := board.Get(fromCol, fromRank)
 
+	// A capture onto the en passant square is en passant, whether or not
+	// it is marked "e.p."
+	if move.Class == chess.PawnMove && fromCol != toCol && isEnPassantSquare(board, toCol, toRank) {
+		move.Class = chess.EnPassantPawnMove
+	}
+
 	// Handle en passant capture
 	if move.Class == chess.EnPassantPawnMove {
 		capturedRank := toRank - 1
@@ -24,10 +30,13 @@ func applyPawnMove(board *chess.Board, move *chess.Move) bool {
 			capturedRank = toRank + 1
 		}
 		board.Set(toCol, capturedRank, chess.Empty)
+		changes.add(toCol, capturedRank)
 	}
 
 	// Move the pawn
 	board.Set(fromCol, fromRank, chess.Empty)
+	changes.add(fromCol, fromRank)
+	changes.add(toCol, toRank)
 
 	// Handle promotion
 	if move.Class == chess.PawnMoveWithPromotion {
@@ -61,6 +70,12 @@ func applyPawnMove(board *chess.Board, move *chess.Move) bool {
 	return true
 }
 
+// isEnPassantSquare reports whether a square is the empty en passant
+// target of the position.
+func isEnPassantSquare(board *chess.Board, col chess.Col, rank chess.Rank) bool {
+	return board.EnPassant && board.EPCol == col && board.EPRank == rank && board.Get(col, rank) == chess.Empty
+}
+
 // findPawnSource finds the source square of a pawn move.
 func findPawnSource(board *chess.Board, move *chess.Move, colour chess.Colour) (chess.Col, chess.Rank) {
 	toCol, toRank := move.ToCol, move.ToRank
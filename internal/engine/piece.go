@@ -2,8 +2,9 @@ package engine
 
 import "github.com/lgbarn/pgn-extract-go/internal/chess"
 
-// applyPieceMove applies a piece (non-pawn) move.
-func applyPieceMove(board *chess.Board, move *chess.Move) bool {
+// applyPieceMove applies a piece (non-pawn) move, recording the squares it
+// changes.
+func applyPieceMove(board *chess.Board, move *chess.Move, changes *Changes) bool {
 	colour := board.ToMove
 	fromCol, fromRank := move.FromCol, move.FromRank
 	toCol, toRank := move.ToCol, move.ToRank
@@ -22,6 +23,8 @@ func applyPieceMove(board *chess.Board, move *chess.Move) bool {
 	// Move the piece
 	board.Set(fromCol, fromRank, chess.Empty)
 	board.Set(toCol, toRank, piece)
+	changes.add(fromCol, fromRank)
+	changes.add(toCol, toRank)
 
 	// Update king position and castling rights if king moved
 	if pieceType == chess.King {
@@ -60,13 +63,27 @@ func applyPieceMove(board *chess.Board, move *chess.Move) bool {
 	return true
 }
 
-// findPieceSource finds the source square of a piece move.
+// PieceSource returns the square from which the side to move plays a
+// piece (non-pawn) move, as ApplyMove does, or 0, 0 if no piece can.
+func PieceSource(board *chess.Board, move *chess.Move) (chess.Col, chess.Rank) {
+	if move.FromCol != 0 && move.FromRank != 0 {
+		return move.FromCol, move.FromRank
+	}
+	return findPieceSource(board, move, board.ToMove)
+}
+
+// findPieceSource finds the source square of a piece move. A piece that
+// may not move because it is pinned is only chosen if no other fits, as SAN
+// does not disambiguate between a pinned piece and another.
 func findPieceSource(board *chess.Board, move *chess.Move, colour chess.Colour) (chess.Col, chess.Rank) {
 	toCol, toRank := move.ToCol, move.ToRank
 	pieceType := move.PieceToMove
 	fromCol, fromRank := move.FromCol, move.FromRank
 	piece := chess.MakeColouredPiece(colour, pieceType)
 
+	// Up to ten pieces of a type, with promotions
+	var found [10]sourceSquare
+	n := 0
 	for col := chess.Col('a'); col <= 'h'; col++ {
 		for rank := chess.Rank('1'); rank <= '8'; rank++ {
 			if board.Get(col, rank) != piece {
@@ -79,11 +96,24 @@ func findPieceSource(board *chess.Board, move *chess.Move, colour chess.Colour)
 			if fromRank != 0 && rank != fromRank {
 				continue
 			}
-			if canPieceMove(board, pieceType, col, rank, toCol, toRank) {
-				return col, rank
+			if canPieceMove(board, pieceType, col, rank, toCol, toRank) && n < len(found) {
+				found[n] = sourceSquare{col, rank}
+				n++
 			}
 		}
 	}
 
-	return 0, 0
+	switch n {
+	case 0:
+		return 0, 0
+	case 1:
+		return found[0].col, found[0].rank
+	}
+	// Only when several pieces fit is it worth checking for pins
+	for _, sq := range found[:n] {
+		if tryMove(board, sq.col, sq.rank, toCol, toRank, colour) {
+			return sq.col, sq.rank
+		}
+	}
+	return found[0].col, found[0].rank
 }
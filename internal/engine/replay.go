@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/errors"
+)
+
+// ReplayError reports the move at which a replay stopped.
+type ReplayError struct {
+	Ply  int    // 1-based ply of the move that could not be applied
+	Move string // text of that move
+}
+
+// Error returns a message naming the offending ply and move.
+func (e *ReplayError) Error() string {
+	return fmt.Sprintf("illegal move at ply %d: %s", e.Ply, e.Move)
+}
+
+// Unwrap returns errors.ErrIllegalMove.
+func (e *ReplayError) Unwrap() error {
+	return errors.ErrIllegalMove
+}
+
+// ReplayGame replays the main line of a game from its starting position.
+// It returns the board after the last move that could be applied, the
+// number of plies applied, and an error if the FEN tag is invalid or a move
+// cannot be applied. On error the board is a partial position (the initial
+// position for an invalid FEN) and must not be treated as the game's result.
+func ReplayGame(game *chess.Game) (*chess.Board, int, error) {
+	return ReplayGamePlies(game, 0)
+}
+
+// ReplayGamePlies is ReplayGame stopping after at most maxPlies plies;
+// maxPlies <= 0 replays the whole main line.
+func ReplayGamePlies(game *chess.Game, maxPlies int) (*chess.Board, int, error) {
+	return replayGame(context.Background(), game, maxPlies)
+}
+
+// ReplayGameContext is ReplayGame stopping early, with ctx.Err(), once ctx
+// is done.
+func ReplayGameContext(ctx context.Context, game *chess.Game) (*chess.Board, int, error) {
+	return replayGame(ctx, game, 0)
+}
+
+func replayGame(ctx context.Context, game *chess.Game, maxPlies int) (*chess.Board, int, error) {
+	board := NewInitialBoard()
+	if fen, ok := game.Tags["FEN"]; ok {
+		fenBoard, err := NewBoardFromFEN(fen)
+		if err != nil {
+			return board, 0, err
+		}
+		board = fenBoard
+	}
+
+	ply := 0
+	for move := game.Moves; move != nil && (maxPlies <= 0 || ply < maxPlies); move = move.Next {
+		if err := ctx.Err(); err != nil {
+			return board, ply, err
+		}
+		if !ApplyMove(board, move) {
+			return board, ply, &ReplayError{Ply: ply + 1, Move: move.Text}
+		}
+		ply++
+	}
+	return board, ply, nil
+}
+
+// ReplayMoves applies moves to board in order, calling visit (if non-nil)
+// after each one. It returns the number of moves applied and a *ReplayError
+// for the first move that could not be applied.
+func ReplayMoves(board *chess.Board, moves *chess.Move, visit func(*chess.Move)) (int, error) {
+	ply := 0
+	for move := moves; move != nil; move = move.Next {
+		if !ApplyMove(board, move) {
+			return ply, &ReplayError{Ply: ply + 1, Move: move.Text}
+		}
+		ply++
+		if visit != nil {
+			visit(move)
+		}
+	}
+	return ply, nil
+}
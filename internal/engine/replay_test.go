@@ -0,0 +1,389 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	perrors "github.com/lgbarn/pgn-extract-go/internal/errors"
+	"github.com/lgbarn/pgn-extract-go/internal/testutil"
+)
+
+func TestReplayGame(t *testing.T) {
+	tests := []struct {
+		name      string
+		pgn       string
+		wantPly   int
+		wantErr   error
+		wantPiece chess.Piece // piece expected on e4
+	}{
+		{
+			name:      "legal game",
+			pgn:       "[Event \"T\"]\n\n1. e4 e5 2. Nf3 *\n",
+			wantPly:   3,
+			wantPiece: chess.W(chess.Pawn),
+		},
+		{
+			name:      "stops at illegal move",
+			pgn:       "[Event \"T\"]\n\n1. e4 e5 2. Ke3 Nc6 *\n",
+			wantPly:   2,
+			wantErr:   perrors.ErrIllegalMove,
+			wantPiece: chess.W(chess.Pawn),
+		},
+		{
+			name:      "invalid FEN",
+			pgn:       "[Event \"T\"]\n[SetUp \"1\"]\n[FEN \"not a fen\"]\n\n1. e4 *\n",
+			wantPly:   0,
+			wantErr:   perrors.ErrInvalidFEN,
+			wantPiece: chess.Empty,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := testutil.MustParseGame(t, tt.pgn)
+			board, ply, err := ReplayGame(game)
+			if board == nil {
+				t.Fatal("ReplayGame returned nil board")
+			}
+			if ply != tt.wantPly {
+				t.Errorf("lastValidPly = %d, want %d", ply, tt.wantPly)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got := board.Get('e', '4'); got != tt.wantPiece {
+				t.Errorf("e4 = %v, want %v", got, tt.wantPiece)
+			}
+		})
+	}
+}
+
+func TestReplayGamePlies(t *testing.T) {
+	game := testutil.MustParseGame(t, "[Event \"T\"]\n\n1. e4 e5 2. Nf3 Nc6 *\n")
+
+	board, ply, err := ReplayGamePlies(game, 2)
+	if err != nil || ply != 2 {
+		t.Fatalf("ReplayGamePlies(2) = ply %d, error %v; want 2, nil", ply, err)
+	}
+	if board.Get('f', '3') != chess.Empty || board.Get('e', '5') != chess.B(chess.Pawn) {
+		t.Error("board should be the position after 1. e4 e5")
+	}
+
+	if _, ply, _ := ReplayGamePlies(game, 10); ply != 4 {
+		t.Errorf("a window beyond the game should replay all of it, got %d plies", ply)
+	}
+	if _, ply, _ := ReplayGamePlies(game, 0); ply != 4 {
+		t.Errorf("ReplayGamePlies(0) should replay the whole game, got %d plies", ply)
+	}
+}
+
+func TestReplayError(t *testing.T) {
+	game := testutil.MustParseGame(t, "[Event \"T\"]\n\n1. e4 e5 2. Ke3 *\n")
+	_, _, err := ReplayGame(game)
+
+	var replayErr *ReplayError
+	if !errors.As(err, &replayErr) {
+		t.Fatalf("error %v is not a *ReplayError", err)
+	}
+	if replayErr.Ply != 3 || replayErr.Move != "Ke3" {
+		t.Errorf("ReplayError = {%d %q}, want {3 \"Ke3\"}", replayErr.Ply, replayErr.Move)
+	}
+}
+
+// TestReplayClocksRoundTrip replays games from a FEN and checks that the
+// halfmove clock and fullmove number survive FEN → moves → FEN, and that
+// every intermediate position round-trips through BoardToFEN unchanged.
+func TestReplayClocksRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		fen     string
+		moves   string
+		wantFEN string
+	}{
+		{
+			name:    "castling and quiet moves",
+			fen:     InitialFEN,
+			moves:   "1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 4. O-O Nf6",
+			wantFEN: "r1bqkb1r/1ppp1ppp/p1n2n2/1B2p3/4P3/5N2/PPPP1PPP/RNBQ1RK1 w kq - 2 5",
+		},
+		{
+			name:    "captures reset the clock",
+			fen:     InitialFEN,
+			moves:   "1. e4 d5 2. exd5 Qxd5 3. Nc3",
+			wantFEN: "rnb1kbnr/ppp1pppp/8/3q4/8/2N5/PPPP1PPP/R1BQKBNR b KQkq - 1 3",
+		},
+		{
+			name:    "black to move with existing clocks",
+			fen:     "8/8/8/4k3/8/8/4K3/R7 b - - 10 40",
+			moves:   "40... Kd5 41. Ra5+ Kd4",
+			wantFEN: "8/8/8/R7/3k4/8/4K3/8 w - - 13 42",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgn := "[Event \"T\"]\n[SetUp \"1\"]\n[FEN \"" + tt.fen + "\"]\n\n" + tt.moves + " *\n"
+			game := testutil.MustParseGame(t, pgn)
+
+			board := mustBoardFromFEN(tt.fen)
+			_, err := ReplayMoves(board, game.Moves, func(move *chess.Move) {
+				fen := BoardToFEN(board)
+				reparsed, err := NewBoardFromFEN(fen)
+				if err != nil {
+					t.Fatalf("after %s: NewBoardFromFEN(%q) failed: %v", move.Text, fen, err)
+				}
+				if got := BoardToFEN(reparsed); got != fen {
+					t.Errorf("after %s: round trip %q, want %q", move.Text, got, fen)
+				}
+			})
+			if err != nil {
+				t.Fatalf("ReplayMoves failed: %v", err)
+			}
+			if got := BoardToFEN(board); got != tt.wantFEN {
+				t.Errorf("final FEN = %q, want %q", got, tt.wantFEN)
+			}
+		})
+	}
+}
+
+func TestRepairRookSquareCastling(t *testing.T) {
+	game := testutil.MustParseGame(t, `[Event "Relay"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bc4 Bc5 4. e1h1 (4. Kxh1 Nf6) 4... d6 5. d3 Bg4 6. Nc3 Qd7 7. Be3 e8a8+ *
+`)
+
+	if got := RepairRookSquareCastling(game); got != 3 {
+		t.Fatalf("RepairRookSquareCastling() = %d, want 3", got)
+	}
+
+	var texts []string
+	for move := game.Moves; move != nil; move = move.Next {
+		texts = append(texts, move.Text)
+	}
+	if texts[6] != "O-O" || texts[13] != "O-O-O+" {
+		t.Errorf("repaired moves = %q, %q; want O-O, O-O-O+", texts[6], texts[13])
+	}
+	if v := game.Moves.Next.Next.Next.Next.Next.Next.Variations[0].Moves; v.Text != "O-O" {
+		t.Errorf("variation move = %q, want O-O", v.Text)
+	}
+
+	board, _, err := ReplayGame(game)
+	if err != nil {
+		t.Fatalf("ReplayGame() after repair: %v", err)
+	}
+	if board.Get('g', '1') != chess.W(chess.King) || board.Get('f', '1') != chess.W(chess.Rook) {
+		t.Error("white did not castle kingside")
+	}
+	if board.Get('c', '8') != chess.B(chess.King) || board.Get('d', '8') != chess.B(chess.Rook) {
+		t.Error("black did not castle queenside")
+	}
+}
+
+func TestRepairRookSquareCastling_LeavesOrdinaryMoves(t *testing.T) {
+	game := testutil.MustParseGame(t, `[Event "Rook"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1"]
+[Result "*"]
+
+1. Rh8+ Kd7 2. Ra8 *
+`)
+
+	if got := RepairRookSquareCastling(game); got != 0 {
+		t.Errorf("RepairRookSquareCastling() = %d, want 0", got)
+	}
+}
+
+func TestCheckSANDisambiguation(t *testing.T) {
+	tests := []struct {
+		name string
+		pgn  string
+		want []string
+	}{
+		{"correct", "1. e4 e5 2. Nc3 Nc6 3. Nge2 Nge7 *", nil},
+		{"ambiguous", "1. Nf3 Nf6 2. d3 d6 3. Nd2 *", []string{"ply 5: Nd2 is ambiguous"}},
+		{"unneeded", "1. Ngf3 *", []string{"ply 1: Ngf3 needs no disambiguation"}},
+		{"rank instead of file", "1. Nf3 Nf6 2. d3 d6 3. N1d2 *", []string{"ply 5: N1d2 should be disambiguated by b only"}},
+		// A pinned knight is not a candidate, so no disambiguation is needed.
+		{"pinned", "1. e4 e5 2. Nc3 Nf6 3. Bb5 d6 4. Bxc6+ bxc6 5. d3 Bb4 6. Ne2 *", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := testutil.MustParseGame(t, "[Result \"*\"]\n\n"+tt.pgn+"\n")
+			var got []string
+			for _, problem := range CheckSANDisambiguation(game) {
+				got = append(got, problem.String())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("problems = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("problem %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSAN(t *testing.T) {
+	tests := []struct {
+		name     string
+		fen      string
+		class    chess.MoveClass
+		piece    chess.Piece
+		from, to string
+		want     string
+	}{
+		{"pawn push", "", chess.PawnMove, chess.Pawn, "e2", "e4", "e4"},
+		{"knight", "", chess.PieceMove, chess.Knight, "g1", "f3", "Nf3"},
+		{"file disambiguation", "rnbqkbnr/pppp1ppp/8/4p3/4P3/2N5/PPPP1PPP/R1BQKBNR w KQkq - 0 1", chess.PieceMove, chess.Knight, "c3", "e2", "Nce2"},
+		{"rank disambiguation", "2k5/8/8/R7/8/8/8/R6K w - - 0 1", chess.PieceMove, chess.Rook, "a1", "a3", "R1a3"},
+		{"square disambiguation", "1k6/8/8/8/4Q2Q/8/8/K6Q w - - 0 1", chess.PieceMove, chess.Queen, "h4", "e1", "Qh4e1"},
+		{"pinned piece is no candidate", "4k3/8/8/8/1b6/8/3N4/4K1N1 w - - 0 1", chess.PieceMove, chess.Knight, "g1", "f3", "Nf3"},
+		{"en passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 2", chess.PawnMove, chess.Pawn, "e5", "d6", "exd6"},
+		{"promotion with check", "3r3k/4P3/8/8/8/8/8/K7 w - - 0 1", chess.PawnMoveWithPromotion, chess.Pawn, "e7", "d8", "exd8=Q+"},
+		{"castling", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", chess.KingsideCastle, chess.King, "e1", "g1", "O-O"},
+		{"mate", "rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq - 0 2", chess.PieceMove, chess.Queen, "d8", "h4", "Qh4#"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board := NewInitialBoard()
+			if tt.fen != "" {
+				var err error
+				if board, err = NewBoardFromFEN(tt.fen); err != nil {
+					t.Fatalf("NewBoardFromFEN: %v", err)
+				}
+			}
+			move := &chess.Move{
+				Class: tt.class, PieceToMove: tt.piece,
+				FromCol: chess.Col(tt.from[0]), FromRank: chess.Rank(tt.from[1]),
+				ToCol: chess.Col(tt.to[0]), ToRank: chess.Rank(tt.to[1]),
+			}
+			if tt.class == chess.PawnMoveWithPromotion {
+				move.PromotedPiece = chess.Queen
+			}
+			before := *board
+			if got := SAN(board, move); got != tt.want {
+				t.Errorf("SAN() = %q, want %q", got, tt.want)
+			}
+			if *board != before {
+				t.Error("SAN() changed the board")
+			}
+		})
+	}
+}
+
+func TestCheckCastling(t *testing.T) {
+	tests := []struct {
+		name  string
+		fen   string
+		moves string
+		want  []string
+	}{
+		{"legal", "4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1", "1. O-O", nil},
+		{"through check", "4k3/8/8/8/8/8/5r2/R3K2R w KQ - 0 1", "1. O-O", []string{"ply 1: O-O castles through the attacked square f1"}},
+		{"into check", "4k3/8/8/8/8/8/6r1/R3K2R w KQ - 0 1", "1. O-O", []string{"ply 1: O-O castles into check"}},
+		{"out of check", "4k3/8/8/8/8/8/4r3/R3K2R w KQ - 0 1", "1. O-O+", []string{"ply 1: O-O+ castles out of check"}},
+		{"no right", "4k3/8/8/8/8/8/8/R3K2R w Q - 0 1", "1. O-O", []string{"ply 1: O-O castles without the right to castle"}},
+		{"occupied", "4k3/8/8/8/8/8/8/RN2K2R w KQ - 0 1", "1. O-O-O", []string{"ply 1: O-O-O castles with b1 occupied"}},
+		// Only the squares the king crosses must be safe, not the rook's.
+		{"rook crosses attacked square", "4k3/8/8/8/8/8/1r6/R3K2R w KQ - 0 1", "1. O-O-O", nil},
+		{"black", "r3k2r/8/8/8/8/8/3R4/4K3 b kq - 0 1", "1... O-O-O", []string{"ply 1: O-O-O castles through the attacked square d8"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := testutil.MustParseGame(t, "[SetUp \"1\"]\n[FEN \""+tt.fen+"\"]\n[Result \"*\"]\n\n"+tt.moves+" *\n")
+			var got []string
+			for _, problem := range CheckCastling(game) {
+				got = append(got, problem.String())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("problems = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("problem %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckEnPassant(t *testing.T) {
+	tests := []struct {
+		name  string
+		fen   string
+		moves string
+		want  []string
+	}{
+		{"legal", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "1. exd6", nil},
+		{"legal after double push", "4k3/3p4/8/4P3/8/8/8/4K3 b - - 0 1", "1... d5 2. exd6ep", nil},
+		{"ordinary capture", "4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", "1. exd5", nil},
+		{"FEN square without double push", "4k3/8/8/8/8/8/8/4K3 w - d6 0 1", "1. Kd2",
+			[]string{"FEN en passant square d6 does not follow a double pawn push (should be -)"}},
+		{"FEN square missing", "4k3/8/8/3pP3/8/8/8/4K3 w - - 0 1", "1. exd6", []string{
+			"FEN en passant square - is missing for the capture exd6 (should be d6)",
+			"ply 1: exd6 captures on an empty square with no en passant capture available",
+		}},
+		{"marked ordinary capture", "8/8/2k5/3p4/4P3/8/8/4K3 w - - 0 1", "1. exd5ep+",
+			[]string{"ply 1: exd5ep+ is marked e.p. but is an ordinary capture (should be exd5+)"}},
+		{"marked without double push", "4k3/8/8/3pP3/8/8/8/4K3 w - - 0 1", "1. Kd2 Kd8 2. exd6ep",
+			[]string{"ply 3: exd6ep is marked e.p. but does not follow a double pawn push"}},
+		{"written onto taken pawn", "4k3/3p4/8/4P3/8/8/8/4K3 b - - 0 1", "1... d5 2. exd5",
+			[]string{"ply 2: exd5 is written onto the square of the pawn it takes en passant (should be exd6)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := testutil.MustParseGame(t, "[SetUp \"1\"]\n[FEN \""+tt.fen+"\"]\n[Result \"*\"]\n\n"+tt.moves+" *\n")
+			var got []string
+			for _, problem := range CheckEnPassant(game) {
+				got = append(got, problem.String())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("problems = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("problem %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRepairEnPassant(t *testing.T) {
+	game := testutil.MustParseGame(t, "[SetUp \"1\"]\n[FEN \"4k3/3p4/8/4P3/8/8/8/4K3 b - - 0 1\"]\n[Result \"*\"]\n\n1... d5 2. exd5 Kf7 *\n")
+	if problems := RepairEnPassant(game); len(problems) != 1 {
+		t.Fatalf("RepairEnPassant() found %v, want one problem", problems)
+	}
+	if got := game.Moves.Next.Text; got != "exd6" {
+		t.Errorf("repaired move = %q, want exd6", got)
+	}
+	if problems := CheckEnPassant(game); len(problems) != 0 {
+		t.Errorf("CheckEnPassant() after repair = %v, want none", problems)
+	}
+	board, _, err := ReplayGame(game)
+	if err != nil || board.Get('d', '5') != chess.Empty || board.Get('d', '6') != chess.W(chess.Pawn) {
+		t.Errorf("replay after repair failed or left the taken pawn")
+	}
+}
+
+func TestReplayGameContext(t *testing.T) {
+	game := testutil.MustParseGame(t, "[Event \"T\"]\n\n1. e4 e5 2. Nf3 *\n")
+
+	if _, ply, err := ReplayGameContext(context.Background(), game); err != nil || ply != 3 {
+		t.Errorf("ReplayGameContext = %d, %v; want 3, nil", ply, err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, ply, err := ReplayGameContext(cancelled, game); !errors.Is(err, context.Canceled) || ply != 0 {
+		t.Errorf("ReplayGameContext(cancelled) = %d, %v; want 0, context.Canceled", ply, err)
+	}
+}
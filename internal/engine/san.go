@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// SANProblem describes a piece move whose disambiguation differs from what
+// Standard Algebraic Notation requires.
+type SANProblem struct {
+	Ply       int    // 1-based ply of the move in the main line
+	Written   string // the move as it appears in the game
+	Required  string // the disambiguation SAN requires: "", file, rank or square
+	Ambiguous bool   // true if the written move fits several pieces
+}
+
+// String describes the problem for diagnostics.
+func (p SANProblem) String() string {
+	if p.Ambiguous {
+		return fmt.Sprintf("ply %d: %s is ambiguous", p.Ply, p.Written)
+	}
+	if p.Required == "" {
+		return fmt.Sprintf("ply %d: %s needs no disambiguation", p.Ply, p.Written)
+	}
+	return fmt.Sprintf("ply %d: %s should be disambiguated by %s only", p.Ply, p.Written, p.Required)
+}
+
+// CheckSANDisambiguation replays a game's main line and reports each piece
+// move that is ambiguous as written or is disambiguated more than, or
+// differently from, SAN requires. SAN prefers the file, then the rank,
+// then the full square. Replay stops at the first illegal move.
+func CheckSANDisambiguation(game *chess.Game) []SANProblem {
+	var problems []SANProblem
+	board := NewBoardForGame(game)
+	ply := 0
+	for move := game.Moves; move != nil; move = move.Next {
+		ply++
+		if move.Class == chess.PieceMove {
+			if problem, bad := checkDisambiguation(board, move); bad {
+				problem.Ply = ply
+				problems = append(problems, problem)
+			}
+		}
+		if !ApplyMove(board, move) {
+			break
+		}
+	}
+	return problems
+}
+
+// checkDisambiguation checks one piece move against the position before it.
+func checkDisambiguation(board *chess.Board, move *chess.Move) (SANProblem, bool) {
+	problem := SANProblem{Written: move.Text}
+	candidates := legalSources(board, move.PieceToMove, move.ToCol, move.ToRank)
+
+	var matches []sourceSquare
+	for _, sq := range candidates {
+		if (move.FromCol == 0 || sq.col == move.FromCol) &&
+			(move.FromRank == 0 || sq.rank == move.FromRank) {
+			matches = append(matches, sq)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return problem, false // illegal; reported by validation
+	case 1:
+	default:
+		problem.Ambiguous = true
+		return problem, true
+	}
+
+	wantCol, wantRank := disambiguation(candidates, matches[0])
+	if wantCol {
+		problem.Required = string(rune(matches[0].col))
+	}
+	if wantRank {
+		problem.Required += string(rune(matches[0].rank))
+	}
+	return problem, wantCol != (move.FromCol != 0) || wantRank != (move.FromRank != 0)
+}
+
+// disambiguation returns whether SAN must give the file, the rank or both
+// of a piece's source square to tell it apart from the other candidates
+// that can legally make the same move. It prefers the file, then the rank,
+// then the full square.
+func disambiguation(candidates []sourceSquare, source sourceSquare) (wantCol, wantRank bool) {
+	sameFile, sameRank := false, false
+	for _, sq := range candidates {
+		if sq == source {
+			continue
+		}
+		if sq.col == source.col {
+			sameFile = true
+		}
+		if sq.rank == source.rank {
+			sameRank = true
+		}
+	}
+	switch {
+	case len(candidates) == 1:
+		return false, false
+	case !sameFile:
+		return true, false
+	case !sameRank:
+		return false, true
+	}
+	return true, true
+}
+
+// SAN returns a move in Standard Algebraic Notation, with the least
+// disambiguation needed and a check or mate suffix. The move must give its
+// from square, as moves decoded from a binary format or long algebraic
+// notation do, and be legal in the position; the board is not changed.
+func SAN(board *chess.Board, move *chess.Move) string {
+	var sb strings.Builder
+	switch move.Class {
+	case chess.NullMove:
+		return chess.NullMoveString
+	case chess.KingsideCastle:
+		sb.WriteString("O-O")
+	case chess.QueensideCastle:
+		sb.WriteString("O-O-O")
+	case chess.PawnMove, chess.PawnMoveWithPromotion, chess.EnPassantPawnMove:
+		if move.FromCol != move.ToCol {
+			sb.WriteByte(byte(move.FromCol))
+			sb.WriteByte('x')
+		}
+		sb.WriteByte(byte(move.ToCol))
+		sb.WriteByte(byte(move.ToRank))
+		if move.Class == chess.PawnMoveWithPromotion {
+			sb.WriteByte('=')
+			sb.WriteByte(SANPieceLetter(move.PromotedPiece))
+		}
+	default:
+		sb.WriteByte(SANPieceLetter(move.PieceToMove))
+		source := sourceSquare{move.FromCol, move.FromRank}
+		wantCol, wantRank := disambiguation(legalSources(board, move.PieceToMove, move.ToCol, move.ToRank), source)
+		if wantCol {
+			sb.WriteByte(byte(source.col))
+		}
+		if wantRank {
+			sb.WriteByte(byte(source.rank))
+		}
+		if board.Get(move.ToCol, move.ToRank) != chess.Empty {
+			sb.WriteByte('x')
+		}
+		sb.WriteByte(byte(move.ToCol))
+		sb.WriteByte(byte(move.ToRank))
+	}
+
+	after := board.Copy()
+	played := *move
+	if ApplyMove(after, &played) && IsInCheck(after, after.ToMove) {
+		if HasLegalMoves(after, after.ToMove) {
+			sb.WriteByte('+')
+		} else {
+			sb.WriteByte('#')
+		}
+	}
+	return sb.String()
+}
+
+// sourceSquare is the square a piece moves from.
+type sourceSquare struct {
+	col  chess.Col
+	rank chess.Rank
+}
+
+// legalSources returns the squares of the side to move's pieces of the
+// given type that can legally move to the target.
+func legalSources(board *chess.Board, pieceType chess.Piece, toCol chess.Col, toRank chess.Rank) []sourceSquare {
+	colour := board.ToMove
+	piece := chess.MakeColouredPiece(colour, pieceType)
+	var sources []sourceSquare
+	for col := chess.Col('a'); col <= 'h'; col++ {
+		for rank := chess.Rank('1'); rank <= '8'; rank++ {
+			if board.Get(col, rank) != piece {
+				continue
+			}
+			if canPieceMove(board, pieceType, col, rank, toCol, toRank) &&
+				tryMove(board, col, rank, toCol, toRank, colour) {
+				sources = append(sources, sourceSquare{col, rank})
+			}
+		}
+	}
+	return sources
+}
@@ -115,6 +115,14 @@ func (e *ParseError) Error() string {
 			}
 		}
 		parts = append(parts, loc)
+	} else if e.Line > 0 {
+		loc := fmt.Sprintf("line %d", e.Line)
+		if e.Column > 0 {
+			loc += fmt.Sprintf(", column %d", e.Column)
+		}
+		parts = append(parts, loc)
+	} else if e.Column > 0 {
+		parts = append(parts, fmt.Sprintf("column %d", e.Column))
 	}
 
 	// Add expected/got context
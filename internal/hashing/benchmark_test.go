@@ -2,10 +2,13 @@ package hashing
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
 	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/testutil"
 )
 
 var benchFENPositions = map[string]string{
@@ -237,3 +240,64 @@ func BenchmarkDuplicateDetector_BoundedVsUnlimited(b *testing.B) {
 		})
 	}
 }
+
+// loadBenchGames parses the games of a testdata file for the per-game
+// hashing benchmarks.
+func loadBenchGames(b *testing.B, name string) []*chess.Game {
+	b.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "infiles", name))
+	if err != nil {
+		b.Fatalf("reading %s: %v", name, err)
+	}
+	return testutil.ParseTestGames(string(data))
+}
+
+// BenchmarkGameHashing compares hashing every main-line position of the
+// games in fischer.pgn in full against keeping the hash up to date
+// incrementally, replay included. ReplayOnly is the cost of the moves alone.
+func BenchmarkGameHashing(b *testing.B) {
+	games := loadBenchGames(b, "fischer.pgn")
+	b.Run("ReplayOnly", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, game := range games {
+				board := engine.NewBoardForGame(game)
+				for move := game.Moves; move != nil && engine.ApplyMove(board, move); move = move.Next {
+				}
+			}
+		}
+	})
+	b.Run("Full", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, game := range games {
+				board := engine.NewBoardForGame(game)
+				hash := GenerateZobristHash(board)
+				for move := game.Moves; move != nil && engine.ApplyMove(board, move); move = move.Next {
+					hash ^= GenerateZobristHash(board)
+				}
+			}
+		}
+	})
+	b.Run("Incremental", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, game := range games {
+				hasher := NewIncrementalHasher(engine.NewBoardForGame(game))
+				hash := hasher.Hash()
+				for move := game.Moves; move != nil && hasher.Play(move); move = move.Next {
+					hash ^= hasher.Hash()
+				}
+			}
+		}
+	})
+}
+
+// BenchmarkFuzzySignature measures the signatures used by --fuzzydepth
+// duplicate detection over the whole of each game in fischer.pgn.
+func BenchmarkFuzzySignature(b *testing.B) {
+	games := loadBenchGames(b, "fischer.pgn")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, game := range games {
+			fuzzySignature(game, 1000, false)
+		}
+	}
+}
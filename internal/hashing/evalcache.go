@@ -0,0 +1,119 @@
+package hashing
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// Eval is an engine's evaluation of a position, from White's point of view.
+type Eval struct {
+	Centipawns int    // score in centipawns; ignored when Mate is non-zero
+	Mate       int    // moves to mate, negative when Black mates; 0 for none
+	Depth      int    // search depth the evaluation was reached at
+	BestMove   string // best move in UCI notation, or "" when not reported
+}
+
+// evalEntry is an element of the EvalCache LRU list.
+type evalEntry struct {
+	hash uint64
+	eval Eval
+}
+
+// EvalCacheStats counts EvalCache lookups.
+type EvalCacheStats struct {
+	Hits      int
+	Misses    int
+	Evictions int
+}
+
+// HitRate returns the fraction of lookups answered from the cache.
+func (s EvalCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// String formats the statistics for the log.
+func (s EvalCacheStats) String() string {
+	return fmt.Sprintf("%d hits, %d misses (%.1f%% hit rate), %d evictions",
+		s.Hits, s.Misses, 100*s.HitRate(), s.Evictions)
+}
+
+// EvalCache is a bounded LRU cache of engine evaluations keyed by Zobrist
+// hash, so positions that recur across games, such as opening positions,
+// are only searched once.
+// Safe for concurrent use.
+type EvalCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[uint64]*list.Element
+	lru      *list.List // front is most recently used
+	stats    EvalCacheStats
+}
+
+// NewEvalCache creates a cache holding at most capacity positions.
+// A capacity of 0 or less means unlimited.
+func NewEvalCache(capacity int) *EvalCache {
+	return &EvalCache{
+		capacity: capacity,
+		entries:  make(map[uint64]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Get returns the cached evaluation of a position if it was searched to at
+// least minDepth; a shallower evaluation counts as a miss.
+func (c *EvalCache) Get(hash uint64, minDepth int) (Eval, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[hash]
+	if !ok || elem.Value.(*evalEntry).eval.Depth < minDepth {
+		c.stats.Misses++
+		return Eval{}, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*evalEntry).eval, true
+}
+
+// Put stores the evaluation of a position, evicting the least recently
+// used position when the cache is full. An evaluation already cached at a
+// greater depth is kept.
+func (c *EvalCache) Put(hash uint64, eval Eval) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[hash]; ok {
+		entry := elem.Value.(*evalEntry)
+		if eval.Depth >= entry.eval.Depth {
+			entry.eval = eval
+		}
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[hash] = c.lru.PushFront(&evalEntry{hash: hash, eval: eval})
+	if c.capacity > 0 && c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*evalEntry).hash)
+		c.stats.Evictions++
+	}
+}
+
+// Len returns the number of positions in the cache.
+func (c *EvalCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Stats returns the lookup statistics so far.
+func (c *EvalCache) Stats() EvalCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
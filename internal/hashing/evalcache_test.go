@@ -0,0 +1,45 @@
+package hashing
+
+import "testing"
+
+func TestEvalCache(t *testing.T) {
+	cache := NewEvalCache(2)
+
+	if _, ok := cache.Get(1, 0); ok {
+		t.Fatal("empty cache returned an evaluation")
+	}
+	cache.Put(1, Eval{Centipawns: 30, Depth: 12, BestMove: "e2e4"})
+	cache.Put(2, Eval{Mate: -3, Depth: 20})
+
+	if eval, ok := cache.Get(1, 10); !ok || eval.Centipawns != 30 || eval.BestMove != "e2e4" {
+		t.Errorf("Get(1, 10) = %+v, %v", eval, ok)
+	}
+	// Too shallow for the requested depth
+	if _, ok := cache.Get(1, 16); ok {
+		t.Error("Get(1, 16) returned a depth 12 evaluation")
+	}
+
+	// A shallower evaluation does not replace a deeper one
+	cache.Put(2, Eval{Centipawns: 500, Depth: 8})
+	if eval, _ := cache.Get(2, 0); eval.Mate != -3 {
+		t.Errorf("depth 20 evaluation replaced by %+v", eval)
+	}
+
+	// 1 is now the least recently used
+	cache.Put(3, Eval{Depth: 1})
+	if _, ok := cache.Get(1, 0); ok {
+		t.Error("least recently used position was not evicted")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", cache.Len())
+	}
+
+	stats := cache.Stats()
+	want := EvalCacheStats{Hits: 2, Misses: 3, Evictions: 1}
+	if stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+	if got := stats.String(); got != "2 hits, 3 misses (40.0% hit rate), 1 evictions" {
+		t.Errorf("String() = %q", got)
+	}
+}
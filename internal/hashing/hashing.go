@@ -2,7 +2,10 @@
 package hashing
 
 import (
+	"math/bits"
+
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
 )
 
 // DuplicateChecker defines the interface for duplicate detection implementations.
@@ -17,12 +20,50 @@ type DuplicateChecker interface {
 	UniqueCount() int
 }
 
+// OriginalTracker is implemented by detectors that can report which
+// previously seen game a duplicate matched.
+type OriginalTracker interface {
+	DuplicateChecker
+	// SetTrackOriginals enables remembering the first-seen game itself,
+	// not only where it was read, for each signature.
+	SetTrackOriginals(track bool)
+	// CheckAndAddOriginal behaves like CheckAndAdd but also returns the
+	// original a duplicate matched.
+	CheckAndAddOriginal(game *chess.Game, board *chess.Board) (*Original, bool)
+}
+
+// Original identifies the first-seen game a duplicate matched by where it
+// was read and the position compared, so that a duplicate can name it
+// without the game being kept in memory.
+type Original struct {
+	SourceFile  string
+	SourceIndex int         // 1-based number of the game in SourceFile, 0 if unknown
+	Hash        uint64      // Zobrist hash of the position compared, 0 if unknown
+	Game        *chess.Game // the game itself, only set when tracking originals
+}
+
+// newOriginal records a game as an original, keeping the game itself only
+// if track is set. The board, if any, is the position compared.
+func newOriginal(game *chess.Game, board *chess.Board, track bool) Original {
+	original := Original{SourceFile: game.SourceFile, SourceIndex: game.SourceIndex}
+	if board != nil {
+		original.Hash = GenerateZobristHash(board)
+	}
+	if track {
+		original.Game = game
+	}
+	return original
+}
+
 // DuplicateDetector tracks seen positions for duplicate game detection.
 type DuplicateDetector struct {
 	hashTable      map[uint64][]GameSignature
 	useExactMatch  bool
 	duplicateCount int
 	maxCapacity    int // 0 = unlimited
+	trackOriginals bool
+	plyWindow      int // 0 = whole game
+	fuzzyDepth     int // 0 = compare final positions
 }
 
 // GameSignature stores identifying information about a game.
@@ -30,6 +71,7 @@ type GameSignature struct {
 	Hash      uint64
 	MoveCount int
 	WeakHash  chess.HashCode
+	Original  Original // the first-seen game; unknown for loaded hashes
 }
 
 // NewDuplicateDetector creates a new duplicate detector.
@@ -45,26 +87,81 @@ func NewDuplicateDetector(exactMatch bool, maxCapacity int) *DuplicateDetector {
 // CheckAndAdd checks if a game is a duplicate and adds it to the hash table.
 // Returns true if the game is a duplicate.
 func (d *DuplicateDetector) CheckAndAdd(game *chess.Game, board *chess.Board) bool {
-	if board == nil {
-		return false
+	_, isDuplicate := d.CheckAndAddOriginal(game, board)
+	return isDuplicate
+}
+
+// SetTrackOriginals enables remembering the first-seen game itself for each
+// signature. Tracking keeps every unique game in memory, so it is off by
+// default; where each game was read is recorded either way.
+func (d *DuplicateDetector) SetTrackOriginals(track bool) {
+	d.trackOriginals = track
+}
+
+// SetPlyWindow restricts comparison to the first plies plies of each game.
+// The caller must then pass the position after at most that many plies
+// as the board. In exact mode the move counts compared are capped at the
+// window too, so games that both reach it match whatever their length,
+// while shorter games must still have the same length.
+func (d *DuplicateDetector) SetPlyWindow(plies int) {
+	d.plyWindow = plies
+}
+
+// SetFuzzyDepth switches to near-duplicate matching: games match when
+// they pass through the same positions for their first plies plies,
+// whatever moves follow, so copies missing their last moves are found.
+// Unlike SetPlyWindow, transpositions into the same position do not
+// match. Games shorter than plies match only games of the same length.
+// The board passed to CheckAndAdd is not used; the detector replays the
+// game itself.
+func (d *DuplicateDetector) SetFuzzyDepth(plies int) {
+	d.fuzzyDepth = plies
+}
+
+// CheckAndAddOriginal checks if a game is a duplicate and adds it to the hash table.
+// For duplicates it also returns the original, whose Game is nil if
+// originals are not tracked.
+func (d *DuplicateDetector) CheckAndAddOriginal(game *chess.Game, board *chess.Board) (*Original, bool) {
+	sig, ok := d.signature(game, board)
+	if !ok {
+		return nil, false
 	}
+	return d.checkAndAddSignature(sig)
+}
 
-	hash := GenerateZobristHash(board)
-	weakHash := WeakHash(board)
+// signature computes the signature a game is compared by, or false if it
+// has none. It only reads the detector's settings.
+func (d *DuplicateDetector) signature(game *chess.Game, board *chess.Board) (GameSignature, bool) {
+	if d.fuzzyDepth > 0 {
+		return fuzzySignature(game, d.fuzzyDepth, d.trackOriginals), true
+	}
+	if board == nil {
+		return GameSignature{}, false
+	}
 	moveCount := countMoves(game)
-
-	sig := GameSignature{
-		Hash:      hash,
-		MoveCount: moveCount,
-		WeakHash:  weakHash,
+	if d.plyWindow > 0 && moveCount > d.plyWindow {
+		moveCount = d.plyWindow
 	}
+	return GameSignature{
+		Hash:      GenerateZobristHash(board),
+		MoveCount: moveCount,
+		WeakHash:  WeakHash(board),
+		Original:  newOriginal(game, board, d.trackOriginals),
+	}, true
+}
+
+// checkAndAddSignature checks a signature against the hash table and adds
+// it if it is new.
+func (d *DuplicateDetector) checkAndAddSignature(sig GameSignature) (*Original, bool) {
+	hash := sig.Hash
 
 	// Check for duplicates
 	if existing, ok := d.hashTable[hash]; ok {
 		for _, existingSig := range existing {
 			if d.signaturesMatch(sig, existingSig) {
 				d.duplicateCount++
-				return true
+				original := existingSig.Original
+				return &original, true
 			}
 		}
 	}
@@ -73,7 +170,7 @@ func (d *DuplicateDetector) CheckAndAdd(game *chess.Game, board *chess.Board) bo
 	if d.maxCapacity <= 0 || len(d.hashTable) < d.maxCapacity {
 		d.hashTable[hash] = append(d.hashTable[hash], sig)
 	}
-	return false
+	return nil, false
 }
 
 // signaturesMatch checks if two game signatures match.
@@ -81,7 +178,26 @@ func (d *DuplicateDetector) signaturesMatch(a, b GameSignature) bool {
 	if a.Hash != b.Hash || a.WeakHash != b.WeakHash {
 		return false
 	}
-	return !d.useExactMatch || a.MoveCount == b.MoveCount
+	return (!d.useExactMatch && d.fuzzyDepth == 0) || a.MoveCount == b.MoveCount
+}
+
+// fuzzySignature combines the Zobrist hashes of the positions a game
+// passes through in its first depth plies, in order, with the weak hash
+// and ply count of the position reached. Replay stops at the first move
+// that cannot be played.
+func fuzzySignature(game *chess.Game, depth int, track bool) GameSignature {
+	board := engine.NewBoardForGame(game)
+	hasher := NewIncrementalHasher(board)
+	hash := hasher.Hash()
+	plies := 0
+	for move := game.Moves; move != nil && plies < depth; move = move.Next {
+		if !hasher.Play(move) {
+			break
+		}
+		plies++
+		hash = bits.RotateLeft64(hash, 1) ^ hasher.Hash()
+	}
+	return GameSignature{Hash: hash, MoveCount: plies, WeakHash: WeakHash(board), Original: newOriginal(game, board, track)}
 }
 
 // DuplicateCount returns the number of duplicates detected.
@@ -1,9 +1,13 @@
 package hashing
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/testutil"
 )
 
 func TestZobristHash_IdenticalBoards_SameHash(t *testing.T) {
@@ -38,6 +42,26 @@ func TestZobristHash_DifferentPositions_DifferentHash(t *testing.T) {
 	}
 }
 
+func TestZobristHash_EveryPieceAndSquareCounts(t *testing.T) {
+	empty := chess.NewBoard()
+	emptyHash := GenerateZobristHash(empty)
+	seen := map[uint64]string{emptyHash: "empty board"}
+	for piece := range pieceToID {
+		for rank := chess.Rank('1'); rank <= '8'; rank++ {
+			for col := chess.Col('a'); col <= 'h'; col++ {
+				board := chess.NewBoard()
+				board.Set(col, rank, piece)
+				name := string(rune(col)) + string(rune(rank))
+				hash := GenerateZobristHash(board)
+				if other, ok := seen[hash]; ok {
+					t.Fatalf("%v on %s hashes like %s", piece, name, other)
+				}
+				seen[hash] = name
+			}
+		}
+	}
+}
+
 func TestWeakHash_IdenticalBoards_SameHash(t *testing.T) {
 	board1 := chess.NewBoard()
 	board1.SetupInitialPosition()
@@ -107,6 +131,160 @@ func TestDuplicateDetector_DifferentGames(t *testing.T) {
 	}
 }
 
+func TestDuplicateDetector_TrackOriginals(t *testing.T) {
+	board := chess.NewBoard()
+	board.SetupInitialPosition()
+	first := &chess.Game{Tags: map[string]string{"Event": "First"}, SourceFile: "a.pgn", SourceIndex: 3}
+	second := &chess.Game{Tags: map[string]string{"Event": "Second"}, SourceFile: "b.pgn", SourceIndex: 1}
+
+	// Without tracking only where the original was read is kept
+	untracked := NewDuplicateDetector(false, 0)
+	untracked.CheckAndAdd(first, board)
+	original, dup := untracked.CheckAndAddOriginal(second, board)
+	if !dup || original == nil {
+		t.Fatalf("untracked: got (%v, %v); want an original", original, dup)
+	}
+	if original.Game != nil || original.SourceFile != "a.pgn" || original.SourceIndex != 3 || original.Hash != GenerateZobristHash(board) {
+		t.Errorf("untracked original = %+v; want a.pgn game 3 without the game", *original)
+	}
+
+	tracked := NewDuplicateDetector(false, 0)
+	tracked.SetTrackOriginals(true)
+	if original, dup := tracked.CheckAndAddOriginal(first, board); dup || original != nil {
+		t.Errorf("first game: got (%v, %v); want (nil, false)", original, dup)
+	}
+	if original, dup := tracked.CheckAndAddOriginal(second, board); !dup || original == nil || original.Game != first {
+		t.Errorf("second game: got (%v, %v); want (first, true)", original, dup)
+	}
+}
+
+func TestDuplicateDetector_PlyWindowExactMatch(t *testing.T) {
+	board := chess.NewBoard()
+	board.SetupInitialPosition()
+	plies := func(n int) *chess.Game {
+		game := &chess.Game{Tags: make(map[string]string)}
+		for i := 0; i < n; i++ {
+			game.AppendMove(&chess.Move{Text: "x"})
+		}
+		return game
+	}
+
+	// Without a window exact mode separates games of different lengths
+	detector := NewDuplicateDetector(true, 0)
+	detector.CheckAndAdd(plies(30), board)
+	if detector.CheckAndAdd(plies(40), board) {
+		t.Error("exact mode without a window: games of different lengths matched")
+	}
+
+	// Games that both reach the window match; shorter ones still need equal lengths
+	detector = NewDuplicateDetector(true, 0)
+	detector.SetPlyWindow(20)
+	detector.CheckAndAdd(plies(30), board)
+	if !detector.CheckAndAdd(plies(40), board) {
+		t.Error("games reaching the window should match whatever their length")
+	}
+	detector.CheckAndAdd(plies(10), board)
+	if detector.CheckAndAdd(plies(12), board) {
+		t.Error("games shorter than the window should still need equal lengths")
+	}
+}
+
+func TestDuplicateDetector_FuzzyDepth(t *testing.T) {
+	games := testutil.MustParseGames(t, `
+[Event "Full"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 1-0
+
+[Event "Missing last move"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 *
+
+[Event "Transposed"]
+
+1. Nf3 Nc6 2. e4 e5 3. Bb5 a6 *
+
+[Event "Short"]
+
+1. e4 e5 *
+
+[Event "Short, one more move"]
+
+1. e4 e5 2. Nf3 *
+`)
+	detector := NewDuplicateDetector(false, 0)
+	detector.SetFuzzyDepth(4)
+	var duplicates []string
+	for _, game := range games {
+		// The board is not used in fuzzy mode
+		if detector.CheckAndAdd(game, nil) {
+			duplicates = append(duplicates, game.GetTag("Event"))
+		}
+	}
+	if len(duplicates) != 1 || duplicates[0] != "Missing last move" {
+		t.Errorf("near-duplicates = %v, want [Missing last move]", duplicates)
+	}
+}
+
+func TestDuplicateDetector_SaveAndLoad(t *testing.T) {
+	games := testutil.MustParseGames(t, `
+[Event "One"]
+
+1. e4 e5 2. Nf3 *
+
+[Event "Two"]
+
+1. d4 d5 *
+
+[Event "Three"]
+
+1. c4 *
+`)
+	saved := NewDuplicateDetector(false, 0)
+	saved.SetPlyWindow(2)
+	for _, game := range games[:2] {
+		board, _, _ := engine.ReplayGamePlies(game, 2)
+		saved.CheckAndAdd(game, board)
+	}
+	var buf bytes.Buffer
+	if err := saved.SaveTo(&buf); err != nil {
+		t.Fatalf("SaveTo: %v", err)
+	}
+	data := buf.Bytes()
+
+	loaded := NewDuplicateDetector(false, 0)
+	loaded.SetPlyWindow(2)
+	if err := loaded.LoadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatalf("LoadFrom: %v", err)
+	}
+	if loaded.UniqueCount() != 2 {
+		t.Errorf("UniqueCount() = %d after loading, want 2", loaded.UniqueCount())
+	}
+	for i, game := range games {
+		board, _, _ := engine.ReplayGamePlies(game, 2)
+		if dup := loaded.CheckAndAdd(game, board); dup != (i < 2) {
+			t.Errorf("game %s: duplicate = %v", game.GetTag("Event"), dup)
+		}
+	}
+
+	// Loading the same table again adds nothing
+	if err := loaded.LoadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatalf("LoadFrom again: %v", err)
+	}
+	if loaded.UniqueCount() != 3 {
+		t.Errorf("UniqueCount() = %d after reloading, want 3", loaded.UniqueCount())
+	}
+
+	if err := NewDuplicateDetector(false, 0).LoadFrom(bytes.NewReader(data)); err == nil {
+		t.Error("loading hashes saved with another ply window succeeded")
+	}
+	if err := NewDuplicateDetector(false, 0).LoadFrom(bytes.NewReader(data[:len(data)-3])); err == nil {
+		t.Error("loading a truncated table succeeded")
+	}
+	if err := NewDuplicateDetector(false, 0).LoadFrom(strings.NewReader("[Event \"?\"]")); err == nil {
+		t.Error("loading a PGN file succeeded")
+	}
+}
+
 func TestDuplicateDetector_Reset(t *testing.T) {
 	detector := NewDuplicateDetector(false, 0)
 
@@ -483,3 +661,104 @@ func TestDuplicateDetector_BehaviorUnchanged_Unlimited(t *testing.T) {
 		t.Errorf("After duplicates: UniqueCount=%d, want %d (unchanged)", detector.UniqueCount(), actualUnique)
 	}
 }
+
+// relayGame builds a game with the given pairing tags and main line.
+func relayGame(round, white string, moves ...string) *chess.Game {
+	game := &chess.Game{Tags: map[string]string{
+		"Event": "Live Open",
+		"Round": round,
+		"White": white,
+		"Black": "Opponent",
+	}}
+	var prev *chess.Move
+	for _, text := range moves {
+		move := &chess.Move{Text: text, Prev: prev}
+		if prev == nil {
+			game.Moves = move
+		} else {
+			prev.Next = move
+		}
+		prev = move
+	}
+	return game
+}
+
+func TestRelayDuplicateDetector(t *testing.T) {
+	d := NewRelayDuplicateDetector(4)
+	d.SetTrackOriginals(true)
+
+	first := relayGame("1", "Player", "e4", "e5")
+	if _, dup := d.CheckAndAddOriginal(first, nil); dup {
+		t.Fatal("first game reported as duplicate")
+	}
+
+	tests := []struct {
+		name string
+		game *chess.Game
+		want bool
+	}{
+		{"longer relay update", relayGame("1", "Player", "e4", "e5", "Nf3+", "Nc6", "Bb5"), true},
+		{"shorter snapshot", relayGame("1", "player ", "e4"), true},
+		{"differs after depth", relayGame("1", "Player", "e4", "e5", "Nf3", "Nc6", "Bc4"), true},
+		{"differs within depth", relayGame("1", "Player", "e4", "e5", "Nf3", "d6"), false},
+		{"other round", relayGame("2", "Player", "e4", "e5"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original, dup := d.CheckAndAddOriginal(tt.game, nil)
+			if dup != tt.want {
+				t.Fatalf("duplicate = %v, want %v", dup, tt.want)
+			}
+			if dup && original.Game != first {
+				t.Error("duplicate should report the first-seen game as its original")
+			}
+		})
+	}
+
+	if got := d.DuplicateCount(); got != 3 {
+		t.Errorf("DuplicateCount() = %d, want 3", got)
+	}
+	if got := d.UniqueCount(); got != 3 {
+		t.Errorf("UniqueCount() = %d, want 3", got)
+	}
+}
+
+func TestMetadataDuplicateDetector(t *testing.T) {
+	d := NewMetadataDuplicateDetector()
+	d.SetTrackOriginals(true)
+
+	first := relayGame("3", "Carlsen, Magnus", "e4", "e5")
+	if _, dup := d.CheckAndAddOriginal(first, nil); dup {
+		t.Fatal("first game reported as duplicate")
+	}
+
+	tests := []struct {
+		name string
+		game *chess.Game
+		want bool
+	}{
+		{"annotated copy with other moves", relayGame("3", "Carlsen, Magnus", "d4", "d5", "c4"), true},
+		{"name spelled differently", relayGame("03", "carlsen,magnus ", "e4"), true},
+		{"other round", relayGame("4", "Carlsen, Magnus", "e4", "e5"), false},
+		{"unknown player", relayGame("3", "?", "e4", "e5"), false},
+		{"unknown player again", relayGame("3", "?", "e4", "e5"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original, dup := d.CheckAndAddOriginal(tt.game, nil)
+			if dup != tt.want {
+				t.Fatalf("duplicate = %v, want %v", dup, tt.want)
+			}
+			if dup && original.Game != first {
+				t.Error("duplicate should report the first-seen game as its original")
+			}
+		})
+	}
+
+	if got := d.DuplicateCount(); got != 2 {
+		t.Errorf("DuplicateCount() = %d, want 2", got)
+	}
+	if got := d.UniqueCount(); got != 4 {
+		t.Errorf("UniqueCount() = %d, want 4", got)
+	}
+}
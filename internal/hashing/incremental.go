@@ -0,0 +1,53 @@
+package hashing
+
+import (
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+)
+
+// IncrementalHasher keeps the Zobrist hash of a board up to date as moves
+// are played on it. Instead of hashing all 64 squares after every move, it
+// XORs out and in the keys of only the squares the move changed, two to
+// four, which makes hashing every position of a game several times
+// cheaper. The board must only be changed through Play.
+// NOT thread-safe: use one hasher per board.
+type IncrementalHasher struct {
+	board  *chess.Board
+	pieces [numSquares]chess.Piece // the pieces as last hashed, by square index
+	hash   uint64                  // XOR of the keys of pieces
+}
+
+// NewIncrementalHasher creates a hasher for a board, hashing its current
+// position in full.
+func NewIncrementalHasher(board *chess.Board) *IncrementalHasher {
+	h := &IncrementalHasher{board: board, hash: hashPieces(board, 0)}
+	for col := chess.Hedge; col < chess.Hedge+chess.BoardSize; col++ {
+		for rank := chess.Hedge; rank < chess.Hedge+chess.BoardSize; rank++ {
+			h.pieces[squareIndex(col, rank)] = board.Squares[col][rank]
+		}
+	}
+	return h
+}
+
+// Play applies a move to the board, as engine.ApplyMove does, and updates
+// the hash for the squares it changed.
+func (h *IncrementalHasher) Play(move *chess.Move) bool {
+	changes, ok := engine.ApplyMoveChanges(h.board, move)
+	for _, sq := range changes.Squares[:changes.N] {
+		col, rank := chess.ColConvert(sq.Col), chess.RankConvert(sq.Rank)
+		if col == 0 || rank == 0 {
+			continue
+		}
+		i := squareIndex(col, rank)
+		after := h.board.Squares[col][rank]
+		h.hash ^= pieceKey(h.pieces[i], col, rank) ^ pieceKey(after, col, rank)
+		h.pieces[i] = after
+	}
+	return ok
+}
+
+// Hash returns the Zobrist hash of the board's current position, equal to
+// GenerateZobristHash(board).
+func (h *IncrementalHasher) Hash() uint64 {
+	return hashEnPassant(h.board, hashCastlingRights(h.board, hashSideToMove(h.board, h.hash)))
+}
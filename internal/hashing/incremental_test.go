@@ -0,0 +1,67 @@
+package hashing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/testutil"
+)
+
+// checkIncrementalHash replays a game's main line, failing if the
+// incremental hash ever differs from the full hash. It returns the number
+// of plies played.
+func checkIncrementalHash(t *testing.T, name string, game *chess.Game) int {
+	t.Helper()
+	board := engine.NewBoardForGame(game)
+	hasher := NewIncrementalHasher(board)
+	if got, want := hasher.Hash(), GenerateZobristHash(board); got != want {
+		t.Fatalf("%s: start position: incremental hash %016x, want %016x", name, got, want)
+	}
+	ply := 0
+	for move := game.Moves; move != nil; move = move.Next {
+		if !hasher.Play(move) {
+			break
+		}
+		ply++
+		if got, want := hasher.Hash(), GenerateZobristHash(board); got != want {
+			t.Fatalf("%s: ply %d (%s): incremental hash %016x, want %016x", name, ply, move.Text, got, want)
+		}
+	}
+	return ply
+}
+
+func TestIncrementalHasher_SpecialMoves(t *testing.T) {
+	tests := []struct {
+		name  string
+		pgn   string
+		plies int
+	}{
+		{"castling", `1. e4 e5 2. Nf3 Nc6 3. Bc4 Bc5 4. O-O d6 5. d3 Qe7 6. Bg5 Be6 7. Nc3 O-O-O *`, 14},
+		{"en passant", `1. e4 Nf6 2. e5 d5 3. exd6 exd6 4. d4 Be7 5. d5 c5 6. dxc6 *`, 11},
+		{"promotion", `[FEN "1n6/P6k/8/8/8/8/6Kp/8 w - - 0 1"] [SetUp "1"] 1. axb8=N h1=Q+ 2. Kxh1 *`, 3},
+		{"rook capture", `[FEN "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1"] [SetUp "1"] 1. Rxa8+ Kd7 2. Rxh8 *`, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if plies := checkIncrementalHash(t, tt.name, testutil.MustParseGame(t, tt.pgn)); plies != tt.plies {
+				t.Errorf("played %d plies, want %d", plies, tt.plies)
+			}
+		})
+	}
+}
+
+func TestIncrementalHasher_MatchesFullHashOnTestdata(t *testing.T) {
+	files := []string{"barnes-horton.pgn", "fischer.pgn", "najdorf.pgn", "petrosian.pgn", "test-promotion-in.pgn"}
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "infiles", name))
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		for _, game := range testutil.ParseTestGames(string(data)) {
+			checkIncrementalHash(t, name, game)
+		}
+	}
+}
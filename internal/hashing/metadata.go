@@ -0,0 +1,126 @@
+package hashing
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// MetadataDuplicateDetector treats games with the same players, Event and
+// Round as one game, whatever their moves. It suits tournament files where
+// a game appears both bare and annotated, so the move lists differ. Tag
+// values are normalized before comparison: case, punctuation and spacing
+// are ignored in names, and leading zeros in round numbers. Games missing
+// a player or the round are never duplicates.
+type MetadataDuplicateDetector struct {
+	seen           map[string]Original // first-seen game for each key
+	unkeyed        int                 // games without a complete key
+	duplicateCount int
+	trackOriginals bool
+	mu             sync.Mutex
+}
+
+// NewMetadataDuplicateDetector creates a metadata duplicate detector.
+func NewMetadataDuplicateDetector() *MetadataDuplicateDetector {
+	return &MetadataDuplicateDetector{seen: make(map[string]Original)}
+}
+
+// CheckAndAdd checks if a game is a metadata duplicate and records it.
+func (d *MetadataDuplicateDetector) CheckAndAdd(game *chess.Game, board *chess.Board) bool {
+	_, isDuplicate := d.CheckAndAddOriginal(game, board)
+	return isDuplicate
+}
+
+// SetTrackOriginals enables remembering the first-seen game itself for each key.
+func (d *MetadataDuplicateDetector) SetTrackOriginals(track bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.trackOriginals = track
+}
+
+// CheckAndAddOriginal checks if a game is a metadata duplicate and records
+// it. For duplicates it also returns the original, whose Game is nil if
+// originals are not tracked. The board, if any, only gives the hash of the
+// original's position.
+func (d *MetadataDuplicateDetector) CheckAndAddOriginal(game *chess.Game, board *chess.Board) (*Original, bool) {
+	key, ok := MetadataKey(game)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !ok {
+		d.unkeyed++
+		return nil, false
+	}
+	if original, seen := d.seen[key]; seen {
+		d.duplicateCount++
+		return &original, true
+	}
+	d.seen[key] = newOriginal(game, board, d.trackOriginals)
+	return nil, false
+}
+
+// DuplicateCount returns the number of duplicates detected.
+func (d *MetadataDuplicateDetector) DuplicateCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.duplicateCount
+}
+
+// UniqueCount returns the number of unique games.
+func (d *MetadataDuplicateDetector) UniqueCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.seen) + d.unkeyed
+}
+
+// MetadataKey returns the normalized White, Black, Event and Round of a
+// game. It reports false when a player or the round is unknown.
+func MetadataKey(game *chess.Game) (string, bool) {
+	white := normalizeName(game.Tags["White"])
+	black := normalizeName(game.Tags["Black"])
+	round := normalizeRound(game.Tags["Round"])
+	if white == "" || black == "" || round == "" {
+		return "", false
+	}
+	return strings.Join([]string{white, black, normalizeName(game.Tags["Event"]), round}, "\x00"), true
+}
+
+// normalizeName lowercases a name and reduces punctuation and runs of
+// spaces to single spaces, so "Carlsen,Magnus" matches "carlsen, magnus".
+func normalizeName(value string) string {
+	if isUnknownTag(value) {
+		return ""
+	}
+	fields := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+// normalizeRound strips leading zeros from each numeric part of a round,
+// so "03.1" matches "3.1".
+func normalizeRound(value string) string {
+	if isUnknownTag(value) {
+		return ""
+	}
+	parts := strings.Split(strings.TrimSpace(value), ".")
+	for i, part := range parts {
+		if n, err := strconv.Atoi(part); err == nil {
+			parts[i] = strconv.Itoa(n)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// isUnknownTag reports whether a tag value is a placeholder.
+func isUnknownTag(value string) bool {
+	switch strings.TrimSpace(value) {
+	case "", "?", "-":
+		return true
+	}
+	return false
+}
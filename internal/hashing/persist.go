@@ -0,0 +1,123 @@
+package hashing
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// hashFileMagic starts a saved hash table; the final digit is the format
+// version.
+const hashFileMagic = "PGNXDUP1"
+
+// SaveTo writes the hash table to w in a compact binary form that LoadFrom
+// reads back, so that later runs can check new games against those seen
+// without re-reading them. The ply window and fuzzy depth are saved too,
+// as signatures made with other settings never match. Original games are
+// not saved.
+func (d *DuplicateDetector) SaveTo(w io.Writer) error {
+	hashes := make([]uint64, 0, len(d.hashTable))
+	count := 0
+	for hash, sigs := range d.hashTable {
+		hashes = append(hashes, hash)
+		count += len(sigs)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+
+	// bufio.Writer keeps the first write error and Flush returns it
+	bw := bufio.NewWriter(w)
+	_, _ = bw.WriteString(hashFileMagic)
+	writeUvarint(bw, uint64(d.plyWindow))
+	writeUvarint(bw, uint64(d.fuzzyDepth))
+	writeUvarint(bw, uint64(count))
+	var buf [8]byte
+	for _, hash := range hashes {
+		for _, sig := range d.hashTable[hash] {
+			binary.LittleEndian.PutUint64(buf[:], sig.Hash)
+			_, _ = bw.Write(buf[:])
+			writeUvarint(bw, uint64(sig.MoveCount))
+			binary.LittleEndian.PutUint64(buf[:], uint64(sig.WeakHash))
+			_, _ = bw.Write(buf[:])
+		}
+	}
+	return bw.Flush()
+}
+
+// LoadFrom adds the signatures saved by SaveTo to the hash table. The
+// detector must use the ply window and fuzzy depth they were saved with.
+// Signatures already present are not added twice, and the capacity limit
+// applies as for CheckAndAdd.
+func (d *DuplicateDetector) LoadFrom(r io.Reader) error {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(hashFileMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != hashFileMagic {
+		return errors.New("not a saved duplicate hash table")
+	}
+	plyWindow, err := binary.ReadUvarint(br)
+	if err != nil {
+		return truncated(err)
+	}
+	fuzzyDepth, err := binary.ReadUvarint(br)
+	if err != nil {
+		return truncated(err)
+	}
+	if int(plyWindow) != d.plyWindow || int(fuzzyDepth) != d.fuzzyDepth {
+		return fmt.Errorf("hashes were saved with ply window %d and fuzzy depth %d, not %d and %d",
+			plyWindow, fuzzyDepth, d.plyWindow, d.fuzzyDepth)
+	}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return truncated(err)
+	}
+
+	var buf [8]byte
+	for i := uint64(0); i < count; i++ {
+		var sig GameSignature
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			return truncated(err)
+		}
+		sig.Hash = binary.LittleEndian.Uint64(buf[:])
+		moveCount, err := binary.ReadUvarint(br)
+		if err != nil {
+			return truncated(err)
+		}
+		sig.MoveCount = int(moveCount)
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			return truncated(err)
+		}
+		sig.WeakHash = chess.HashCode(binary.LittleEndian.Uint64(buf[:]))
+		d.addSignature(sig)
+	}
+	return nil
+}
+
+// addSignature adds a loaded signature unless an identical one is present
+// or the table is full.
+func (d *DuplicateDetector) addSignature(sig GameSignature) {
+	for _, existing := range d.hashTable[sig.Hash] {
+		if existing.MoveCount == sig.MoveCount && existing.WeakHash == sig.WeakHash {
+			return
+		}
+	}
+	if d.maxCapacity <= 0 || len(d.hashTable) < d.maxCapacity {
+		d.hashTable[sig.Hash] = append(d.hashTable[sig.Hash], sig)
+	}
+}
+
+func writeUvarint(w *bufio.Writer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	_, _ = w.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+// truncated reports a saved table that ends early.
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("reading saved hashes: %w", err)
+}
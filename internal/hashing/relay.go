@@ -0,0 +1,122 @@
+package hashing
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// RelayDuplicateDetector detects repeated copies of the same game in
+// broadcast relay feeds, where a game is re-sent with a growing move list.
+// Two games are duplicates when they share Event, Round, White and Black
+// and their first plies agree: up to the configured depth, or up to the
+// length of the shorter game when it has not reached that depth yet.
+type RelayDuplicateDetector struct {
+	plies          int
+	seen           map[string][]*relayEntry
+	duplicateCount int
+	trackOriginals bool
+	mu             sync.Mutex
+}
+
+// relayEntry is the opening fingerprint of one unique game.
+type relayEntry struct {
+	moves    []string
+	original Original
+}
+
+// NewRelayDuplicateDetector creates a relay detector comparing the first
+// plies moves of each game.
+func NewRelayDuplicateDetector(plies int) *RelayDuplicateDetector {
+	return &RelayDuplicateDetector{
+		plies: plies,
+		seen:  make(map[string][]*relayEntry),
+	}
+}
+
+// CheckAndAdd checks if a game is a relay duplicate and records it.
+func (d *RelayDuplicateDetector) CheckAndAdd(game *chess.Game, board *chess.Board) bool {
+	_, isDuplicate := d.CheckAndAddOriginal(game, board)
+	return isDuplicate
+}
+
+// SetTrackOriginals enables remembering the first-seen game itself for each fingerprint.
+func (d *RelayDuplicateDetector) SetTrackOriginals(track bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.trackOriginals = track
+}
+
+// CheckAndAddOriginal checks if a game is a relay duplicate and records it.
+// For duplicates it also returns the original, whose Game is nil if
+// originals are not tracked. The board, if any, only gives the hash of the
+// original's position.
+func (d *RelayDuplicateDetector) CheckAndAddOriginal(game *chess.Game, board *chess.Board) (*Original, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := relayKey(game)
+	moves := openingMoves(game, d.plies)
+	for _, entry := range d.seen[key] {
+		if sharesPrefix(entry.moves, moves) {
+			if len(moves) > len(entry.moves) {
+				entry.moves = moves
+			}
+			d.duplicateCount++
+			original := entry.original
+			return &original, true
+		}
+	}
+
+	entry := &relayEntry{moves: moves, original: newOriginal(game, board, d.trackOriginals)}
+	d.seen[key] = append(d.seen[key], entry)
+	return nil, false
+}
+
+// DuplicateCount returns the number of duplicates detected.
+func (d *RelayDuplicateDetector) DuplicateCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.duplicateCount
+}
+
+// UniqueCount returns the number of unique games.
+func (d *RelayDuplicateDetector) UniqueCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	count := 0
+	for _, entries := range d.seen {
+		count += len(entries)
+	}
+	return count
+}
+
+// relayKey identifies the pairing a game belongs to.
+func relayKey(game *chess.Game) string {
+	fields := []string{game.Tags["Event"], game.Tags["Round"], game.Tags["White"], game.Tags["Black"]}
+	for i, field := range fields {
+		fields[i] = strings.ToLower(strings.TrimSpace(field))
+	}
+	return strings.Join(fields, "\x00")
+}
+
+// openingMoves returns the main-line move texts of the first plies moves,
+// without check and annotation suffixes.
+func openingMoves(game *chess.Game, plies int) []string {
+	var moves []string
+	for move := game.Moves; move != nil && len(moves) < plies; move = move.Next {
+		moves = append(moves, strings.TrimRight(move.Text, "+#!?"))
+	}
+	return moves
+}
+
+// sharesPrefix reports whether the shorter move list is a prefix of the longer.
+func sharesPrefix(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
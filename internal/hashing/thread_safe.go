@@ -2,6 +2,7 @@
 package hashing
 
 import (
+	"io"
 	"sync"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
@@ -23,9 +24,46 @@ func NewThreadSafeDuplicateDetector(exactMatch bool, maxCapacity int) *ThreadSaf
 
 // CheckAndAdd atomically checks if a game is a duplicate and adds it to the hash table.
 func (d *ThreadSafeDuplicateDetector) CheckAndAdd(game *chess.Game, board *chess.Board) bool {
+	_, isDuplicate := d.CheckAndAddOriginal(game, board)
+	return isDuplicate
+}
+
+// SetTrackOriginals enables remembering the first-seen game itself for each signature.
+func (d *ThreadSafeDuplicateDetector) SetTrackOriginals(track bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.detector.SetTrackOriginals(track)
+}
+
+// SetPlyWindow restricts comparison to the first plies plies of each game
+// (see DuplicateDetector.SetPlyWindow).
+func (d *ThreadSafeDuplicateDetector) SetPlyWindow(plies int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.detector.SetPlyWindow(plies)
+}
+
+// SetFuzzyDepth switches to near-duplicate matching on the first plies
+// plies (see DuplicateDetector.SetFuzzyDepth).
+func (d *ThreadSafeDuplicateDetector) SetFuzzyDepth(plies int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.detector.SetFuzzyDepth(plies)
+}
+
+// CheckAndAddOriginal atomically checks for a duplicate and returns the matched original.
+// The signature is computed under the read lock, so games replayed for
+// fuzzy matching do not hold up other workers.
+func (d *ThreadSafeDuplicateDetector) CheckAndAddOriginal(game *chess.Game, board *chess.Board) (*Original, bool) {
+	d.mu.RLock()
+	sig, ok := d.detector.signature(game, board)
+	d.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	return d.detector.CheckAndAdd(game, board)
+	return d.detector.checkAndAddSignature(sig)
 }
 
 // DuplicateCount returns the number of duplicates detected.
@@ -51,6 +89,20 @@ func (d *ThreadSafeDuplicateDetector) LoadFromDetector(other *DuplicateDetector)
 	}
 }
 
+// SaveTo writes the hash table to w (see DuplicateDetector.SaveTo).
+func (d *ThreadSafeDuplicateDetector) SaveTo(w io.Writer) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.detector.SaveTo(w)
+}
+
+// LoadFrom adds a hash table saved by SaveTo (see DuplicateDetector.LoadFrom).
+func (d *ThreadSafeDuplicateDetector) LoadFrom(r io.Reader) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.detector.LoadFrom(r)
+}
+
 // IsFull returns true if the detector has reached its capacity limit.
 // Always returns false for unlimited capacity (maxCapacity = 0).
 func (d *ThreadSafeDuplicateDetector) IsFull() bool {
@@ -7,6 +7,7 @@ import (
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
 	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/testutil"
 )
 
 func TestThreadSafeDuplicateDetector_Concurrent(t *testing.T) {
@@ -116,6 +117,30 @@ func TestThreadSafeDuplicateDetector_NoRace(t *testing.T) {
 	wg.Wait()
 }
 
+func TestThreadSafeDuplicateDetector_FuzzyConcurrent(t *testing.T) {
+	detector := NewThreadSafeDuplicateDetector(false, 0)
+	detector.SetFuzzyDepth(4)
+	games := make([]*chess.Game, 50)
+	for i := range games {
+		games[i] = testutil.MustParseGame(t, "1. e4 e5 2. Nf3 Nc6 3. Bb5 *")
+	}
+
+	var wg sync.WaitGroup
+	for _, game := range games {
+		wg.Add(1)
+		go func(game *chess.Game) {
+			defer wg.Done()
+			// The board is not used in fuzzy mode
+			detector.CheckAndAdd(game, nil)
+		}(game)
+	}
+	wg.Wait()
+
+	if detector.DuplicateCount() != len(games)-1 {
+		t.Errorf("Expected %d duplicates, got %d", len(games)-1, detector.DuplicateCount())
+	}
+}
+
 func TestThreadSafeDuplicateDetector_LoadFromDetector(t *testing.T) {
 	regular := NewDuplicateDetector(false, 0)
 	board, _ := engine.NewBoardFromFEN(engine.InitialFEN)
@@ -5,7 +5,9 @@ import (
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
 )
 
-// Random64 is a Polyglot-compatible array (first 781 values) used for generating Zobrist hash values.
+// Random64 holds the Zobrist keys: 768 for pieces on squares, then 4 for
+// castling rights and 8 for en passant files. Only the first polyglotKeys
+// values are listed; init fills in the rest.
 var Random64 = [781]uint64{
 	0x9D39247E33776D41, 0x2AF7398005AAA5C7, 0x44DB015024623547, 0x9C15F73E62A76AE2,
 	0x75834465489C0C89, 0x3290AC3A203001BF, 0x0FBBAD1F61042279, 0xE83A908FF2FB60CA,
@@ -93,8 +95,25 @@ var Random64 = [781]uint64{
 	0x3E2B8BCBF016D66D, 0xBE7444E39328A0AC, 0xF85B2B4FBCDE44B7, 0x49353FEA39BA63B1,
 	0x1DD01AAFCD53486A, 0x1FCA8A92FD719F85, 0xFC7C95D827357AFA, 0x18A6A990C8B35EBD,
 	0xCCCB7005C6B9C28D, 0x3BDBB92C43B17F26, 0xAA70B5B4F89695A2, 0xE94C39A54A98307F,
-	// ... truncated for brevity, but the full array would be here
-	// For now, we use a simpler weak hash approach
+}
+
+// polyglotKeys is the number of leading Random64 values taken from the
+// Polyglot table.
+const polyglotKeys = 344
+
+// init fills the rest of Random64 from a fixed splitmix64 sequence, so
+// every piece, square, castling right and en passant file has its own key.
+// Hashes are the same on every run and platform, but are not Polyglot book
+// keys.
+func init() {
+	state := uint64(0x9E3779B97F4A7C15)
+	for i := polyglotKeys; i < len(Random64); i++ {
+		state += 0x9E3779B97F4A7C15
+		z := state
+		z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+		z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+		Random64[i] = z ^ (z >> 31)
+	}
 }
 
 // Piece ID mapping for Polyglot format: pPnNbBrRqQkK
@@ -113,6 +132,35 @@ var pieceToID = map[chess.Piece]int{
 	chess.W(chess.King):   11,
 }
 
+// pieceKeyBase holds, for each coloured piece value, the offset of its
+// first key in Random64, or -1 for values that are not pieces. Indexing
+// it avoids a map lookup per square.
+var pieceKeyBase [chess.NumPieceValues << chess.PieceShift]int
+
+func init() {
+	for i := range pieceKeyBase {
+		pieceKeyBase[i] = -1
+	}
+	for piece, id := range pieceToID {
+		pieceKeyBase[piece] = pieceOffset + numSquares*id
+	}
+}
+
+// pieceKey returns the key of a piece on the square at board array
+// indices col and rank, or 0 for an empty square.
+func pieceKey(piece chess.Piece, col, rank int) uint64 {
+	if piece < 0 || int(piece) >= len(pieceKeyBase) || pieceKeyBase[piece] < 0 {
+		return 0
+	}
+	return Random64[pieceKeyBase[piece]+squareIndex(col, rank)]
+}
+
+// squareIndex returns the Polyglot index, a1 = 0 to h8 = 63, of the square
+// at board array indices col and rank.
+func squareIndex(col, rank int) int {
+	return 8*(rank-chess.Hedge) + col - chess.Hedge
+}
+
 // Section offsets in Random64
 const (
 	numSquares        = 64
@@ -140,16 +188,9 @@ func GenerateZobristHash(board *chess.Board) uint64 {
 }
 
 func hashPieces(board *chess.Board, hash uint64) uint64 {
-	for rank := chess.Rank('1'); rank <= '8'; rank++ {
-		for col := chess.Col('a'); col <= 'h'; col++ {
-			piece := board.Get(col, rank)
-			if piece == chess.Empty || piece == chess.Off {
-				continue
-			}
-			if id, ok := pieceToID[piece]; ok {
-				squareIndex := 8*(int(rank)-int('1')) + (int(col) - int('a'))
-				hash ^= Random64[pieceOffset+64*id+squareIndex]
-			}
+	for col := chess.Hedge; col < chess.Hedge+chess.BoardSize; col++ {
+		for rank := chess.Hedge; rank < chess.Hedge+chess.BoardSize; rank++ {
+			hash ^= pieceKey(board.Squares[col][rank], col, rank)
 		}
 	}
 	return hash
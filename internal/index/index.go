@@ -0,0 +1,317 @@
+// Package index builds and reads position index files, which map the
+// positions reached in a PGN file to the games and plies that reach them,
+// so that repeated position searches over a static collection need not
+// replay every game.
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/hashing"
+)
+
+// An index file is little-endian and laid out as:
+//
+//	magic      [8]byte  "PGNIDX\x00\x01", the last byte being the version
+//	pathLen    uint32, then the source path, empty for games with no
+//	           source file, whose offsets are then all 0
+//	size       int64    size of the source when indexed
+//	modTime    int64    its modification time, in Unix nanoseconds
+//	games      uint32, then games+1 int64 byte offsets: game i spans
+//	           offsets[i] to offsets[i+1]
+//	entries    uint64, then that many 16-byte entries sorted by hash:
+//	           hash uint64, game uint32 (0-based), ply uint32
+//
+// Fixed-size sorted entries let a lookup binary-search the file without
+// reading it all.
+var magic = [8]byte{'P', 'G', 'N', 'I', 'D', 'X', 0, 1}
+
+const entrySize = 16
+
+// ErrNotIndex is returned when opening a file that is not a position index
+// of this version.
+var ErrNotIndex = errors.New("not a position index")
+
+// Source identifies the PGN file an index was built from.
+type Source struct {
+	Path    string
+	Size    int64
+	ModTime int64 // Unix nanoseconds
+}
+
+// SourceOf describes a PGN file as an index source.
+func SourceOf(path string) (Source, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Source{}, err
+	}
+	return Source{Path: path, Size: info.Size(), ModTime: info.ModTime().UnixNano()}, nil
+}
+
+// Match is a game reaching an indexed position. Game is 1-based, in file
+// order; Ply is the number of half-moves played when the position arose.
+type Match struct {
+	Game int
+	Ply  int
+}
+
+type entry struct {
+	hash uint64
+	game uint32
+	ply  uint32
+}
+
+// Positions calls visit with the Zobrist hash of the starting position of
+// a game and of the position after each main-line move, up to the first
+// move that cannot be played or until visit returns false. Ply is the
+// number of half-moves played.
+func Positions(game *chess.Game, visit func(ply int, hash uint64) bool) {
+	hasher := hashing.NewIncrementalHasher(engine.NewBoardForGame(game))
+	if !visit(0, hasher.Hash()) {
+		return
+	}
+	ply := 0
+	for move := game.Moves; move != nil; move = move.Next {
+		if !hasher.Play(move) {
+			return
+		}
+		ply++
+		if !visit(ply, hasher.Hash()) {
+			return
+		}
+	}
+}
+
+// Write indexes the starting position of each game and the position after
+// each main-line move, up to the first move that cannot be played. Games
+// must be in file order and carry their StartOffset.
+func Write(w io.Writer, src Source, games []*chess.Game) error {
+	var b Builder
+	for _, game := range games {
+		b.Add(game, game.StartOffset)
+	}
+	return b.Write(w, src)
+}
+
+// Builder collects the positions of games added one at a time, numbering
+// them in the order added, and writes them as an index. The entries are
+// held in memory until then, as they are written sorted.
+type Builder struct {
+	offsets []int64
+	entries []entry
+}
+
+// Add indexes the positions of a game starting at offset in the source,
+// which is 0 when there is no source file.
+func (b *Builder) Add(game *chess.Game, offset int64) {
+	number := uint32(len(b.offsets)) //nolint:gosec // G115: game counts fit in uint32
+	b.offsets = append(b.offsets, offset)
+	Positions(game, func(ply int, hash uint64) bool {
+		b.entries = append(b.entries, entry{hash, number, uint32(ply)}) //nolint:gosec // G115: ply counts fit in uint32
+		return true
+	})
+}
+
+// Write writes the index of the games added, from the source src or, for
+// games with no source file, the zero Source.
+func (b *Builder) Write(w io.Writer, src Source) error {
+	entries := b.entries
+	// Entries were made in game and ply order, which a stable sort keeps
+	// within each hash
+	sort.SliceStable(entries, func(a, b int) bool { return entries[a].hash < entries[b].hash })
+
+	bw := bufio.NewWriter(w)
+	// A failed write leaves bw in error, which Flush reports
+	put := func(v any) { _ = binary.Write(bw, binary.LittleEndian, v) }
+
+	put(magic)
+	put(uint32(len(src.Path))) //nolint:gosec // G115: path lengths fit in uint32
+	put([]byte(src.Path))
+	put(src.Size)
+	put(src.ModTime)
+	put(uint32(len(b.offsets))) //nolint:gosec // G115: game counts fit in uint32
+	put(b.offsets)
+	put(src.Size)
+	put(uint64(len(entries)))
+	for _, e := range entries {
+		put(e.hash)
+		put(e.game)
+		put(e.ply)
+	}
+	return bw.Flush()
+}
+
+// Index is an open position index file.
+type Index struct {
+	file         *os.File
+	Source       Source
+	offsets      []int64
+	entriesStart int64
+	entryCount   int64
+}
+
+// Open opens an index file and reads its header and game offsets.
+func Open(path string) (*Index, error) {
+	file, err := os.Open(path) //nolint:gosec // G304: CLI tool opens user-specified files
+	if err != nil {
+		return nil, err
+	}
+	ix := &Index{file: file}
+	if err := ix.readHeader(bufio.NewReader(file)); err != nil {
+		file.Close() //nolint:errcheck,gosec // already failing
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			err = fmt.Errorf("%s: truncated index: %w", path, ErrNotIndex)
+		}
+		return nil, err
+	}
+	return ix, nil
+}
+
+// readHeader reads everything before the entries.
+func (ix *Index) readHeader(r io.Reader) error {
+	var head [8]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return err
+	}
+	if head != magic {
+		return ErrNotIndex
+	}
+	le := binary.LittleEndian
+	var pathLen uint32
+	if err := binary.Read(r, le, &pathLen); err != nil {
+		return err
+	}
+	path := make([]byte, pathLen)
+	if _, err := io.ReadFull(r, path); err != nil {
+		return err
+	}
+	ix.Source.Path = string(path)
+	var games uint32
+	for _, v := range []any{&ix.Source.Size, &ix.Source.ModTime, &games} {
+		if err := binary.Read(r, le, v); err != nil {
+			return err
+		}
+	}
+	ix.offsets = make([]int64, games+1)
+	if err := binary.Read(r, le, ix.offsets); err != nil {
+		return err
+	}
+	if err := binary.Read(r, le, &ix.entryCount); err != nil {
+		return err
+	}
+	ix.entriesStart = int64(len(magic)) + 4 + int64(pathLen) + 8 + 8 + 4 + 8*int64(games+1) + 8
+	return nil
+}
+
+// Close closes the index file.
+func (ix *Index) Close() error {
+	return ix.file.Close()
+}
+
+// NumGames returns the number of games indexed.
+func (ix *Index) NumGames() int {
+	return len(ix.offsets) - 1
+}
+
+// HasSource reports whether the index was built from a source file, whose
+// games GameSpan locates.
+func (ix *Index) HasSource() bool {
+	return ix.Source.Path != ""
+}
+
+// GameSpan returns the byte range of a game (1-based) in the source.
+func (ix *Index) GameSpan(game int) (start, end int64) {
+	return ix.offsets[game-1], ix.offsets[game]
+}
+
+// Stale reports whether the source file has changed since it was indexed.
+// An index without a source is never stale.
+func (ix *Index) Stale() bool {
+	if !ix.HasSource() {
+		return false
+	}
+	src, err := SourceOf(ix.Source.Path)
+	return err != nil || src.Size != ix.Source.Size || src.ModTime != ix.Source.ModTime
+}
+
+// Lookup returns every game and ply reaching the position with this hash,
+// in game order.
+func (ix *Index) Lookup(hash uint64) ([]Match, error) {
+	var readErr error
+	var buf [entrySize]byte
+	read := func(i int64) entry {
+		if _, err := ix.file.ReadAt(buf[:], ix.entriesStart+i*entrySize); err != nil && readErr == nil {
+			readErr = err
+		}
+		le := binary.LittleEndian
+		return entry{le.Uint64(buf[:8]), le.Uint32(buf[8:12]), le.Uint32(buf[12:16])}
+	}
+
+	first := int64(sort.Search(int(ix.entryCount), func(i int) bool {
+		return read(int64(i)).hash >= hash
+	}))
+	var matches []Match
+	for i := first; i < ix.entryCount && readErr == nil; i++ {
+		e := read(i)
+		if e.hash != hash {
+			break
+		}
+		matches = append(matches, Match{Game: int(e.game) + 1, Ply: int(e.ply)})
+	}
+	return matches, readErr
+}
+
+// Contains reports whether any game reaches the position with this hash.
+func (ix *Index) Contains(hash uint64) (bool, error) {
+	var readErr error
+	var buf [8]byte
+	hashAt := func(i int) uint64 {
+		if _, err := ix.file.ReadAt(buf[:], ix.entriesStart+int64(i)*entrySize); err != nil && readErr == nil {
+			readErr = err
+		}
+		return binary.LittleEndian.Uint64(buf[:])
+	}
+	i := sort.Search(int(ix.entryCount), func(i int) bool { return hashAt(i) >= hash })
+	found := int64(i) < ix.entryCount && hashAt(i) == hash
+	return found, readErr
+}
+
+// Novelty returns the first ply of a game's main line after which the
+// position is not in the index, or 0 if every position is, up to the end
+// of the game or the first move that cannot be played.
+func (ix *Index) Novelty(game *chess.Game) (int, error) {
+	novelty := 0
+	var err error
+	Positions(game, func(ply int, hash uint64) bool {
+		if ply == 0 {
+			return true
+		}
+		var found bool
+		if found, err = ix.Contains(hash); err != nil || !found {
+			novelty = ply
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	return novelty, nil
+}
+
+// LookupFEN returns the games and plies reaching the position of a FEN.
+func (ix *Index) LookupFEN(fen string) ([]Match, error) {
+	board, err := engine.NewBoardFromFEN(fen)
+	if err != nil {
+		return nil, err
+	}
+	return ix.Lookup(hashing.GenerateZobristHash(board))
+}
@@ -0,0 +1,141 @@
+package index
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/internal/testutil"
+)
+
+const testPGN = `[Event "One"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 *
+
+[Event "Two"]
+[Result "*"]
+
+1. d4 d5 *
+
+[Event "Three"]
+[Result "*"]
+
+1. Nf3 Nf6 2. Ng1 Ng8 3. Nf3 *
+`
+
+func writeTestIndex(t *testing.T) (*Index, string) {
+	t.Helper()
+	dir := t.TempDir()
+	pgnFile := filepath.Join(dir, "games.pgn")
+	if err := os.WriteFile(pgnFile, []byte(testPGN), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src, err := SourceOf(pgnFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, src, testutil.MustParseGames(t, testPGN)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	idxFile := filepath.Join(dir, "games.idx")
+	if err := os.WriteFile(idxFile, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := Open(idxFile)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { ix.Close() })
+	return ix, pgnFile
+}
+
+func TestLookupFEN(t *testing.T) {
+	ix, _ := writeTestIndex(t)
+	if ix.NumGames() != 3 || ix.Stale() {
+		t.Fatalf("NumGames = %d, Stale = %v; want 3, false", ix.NumGames(), ix.Stale())
+	}
+
+	tests := []struct {
+		name string
+		fen  string
+		want []Match
+	}{
+		{"start", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			[]Match{{1, 0}, {2, 0}, {3, 0}, {3, 4}}},
+		{"after 1.e4 e5", "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2",
+			[]Match{{1, 2}}},
+		{"after 1.Nf3", "rnbqkbnr/pppppppp/8/8/8/5N2/PPPPPPPP/RNBQKB1R b KQkq - 1 1",
+			[]Match{{3, 1}, {3, 5}}},
+		{"absent", "8/8/8/8/8/8/8/K1k5 w - - 0 1", nil},
+	}
+	for _, tt := range tests {
+		got, err := ix.LookupFEN(tt.fen)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestGameSpan(t *testing.T) {
+	ix, pgnFile := writeTestIndex(t)
+	data, err := os.ReadFile(pgnFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var joined string
+	for game := 1; game <= ix.NumGames(); game++ {
+		start, end := ix.GameSpan(game)
+		text := string(data[start:end])
+		if !bytes.HasPrefix([]byte(text), []byte(`[Event "`)) {
+			t.Errorf("game %d span starts %q", game, text)
+		}
+		joined += text
+	}
+	if joined != testPGN {
+		t.Errorf("game spans do not cover the file:\n%s", joined)
+	}
+}
+
+func TestOpenRejectsOtherFiles(t *testing.T) {
+	_, pgnFile := writeTestIndex(t)
+	if _, err := Open(pgnFile); !errors.Is(err, ErrNotIndex) {
+		t.Errorf("Open(PGN file) error = %v; want ErrNotIndex", err)
+	}
+}
+
+func TestNovelty(t *testing.T) {
+	ix, _ := writeTestIndex(t)
+	tests := []struct {
+		pgn  string
+		want int
+	}{
+		{"1. e4 e5 2. Nf3 *", 0},
+		{"1. e4 e5 2. Nc3 *", 3},
+		{"1. c4 *", 1},
+		{"1. d4 d5 2. c4 *", 3},
+	}
+	for _, tt := range tests {
+		got, err := ix.Novelty(testutil.MustParseGame(t, tt.pgn))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.pgn, err)
+		}
+		if got != tt.want {
+			t.Errorf("Novelty(%s) = %d; want %d", tt.pgn, got, tt.want)
+		}
+	}
+}
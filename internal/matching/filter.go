@@ -2,7 +2,9 @@ package matching
 
 import (
 	"bufio"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
@@ -109,6 +111,44 @@ func (gf *GameFilter) AddFENFilter(fen string) error {
 	return gf.PositionMatcher.AddFEN(fen, "")
 }
 
+// AddFENEntry adds an exact or placement-only position entry (see PositionMatcher.AddEntry).
+func (gf *GameFilter) AddFENEntry(entry, label string) error {
+	return gf.PositionMatcher.AddEntry(entry, label)
+}
+
+// LoadFENFile loads position entries from a file, one per line.
+// Blank lines and lines starting with # are ignored. Entries without an
+// explicit label are labelled "file:line".
+func (gf *GameFilter) LoadFENFile(filename string) error {
+	file, err := os.Open(filename) //nolint:gosec // G304: CLI tool opens user-specified files
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	base := filepath.Base(filename)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := gf.AddFENEntry(line, fmt.Sprintf("%s:%d", base, lineNum)); err != nil {
+			return fmt.Errorf("%s:%d: %w", filename, lineNum, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// SetNextMove requires the given move to be played from matched positions
+// added after this call.
+func (gf *GameFilter) SetNextMove(san string) {
+	gf.PositionMatcher.SetNextMove(san)
+}
+
 // AddPatternFilter adds a FEN pattern filter.
 func (gf *GameFilter) AddPatternFilter(pattern string, includeInvert bool) {
 	gf.PositionMatcher.AddPattern(pattern, "", includeInvert)
@@ -116,18 +156,30 @@ func (gf *GameFilter) AddPatternFilter(pattern string, includeInvert bool) {
 
 // MatchGame checks if a game matches the filter criteria.
 func (gf *GameFilter) MatchGame(game *chess.Game) bool {
+	matched, _ := gf.MatchGameDetail(game)
+	return matched
+}
+
+// MatchGameDetail checks if a game matches the filter criteria and also
+// returns the position entry that matched, if any.
+func (gf *GameFilter) MatchGameDetail(game *chess.Game) (bool, *FENPattern) {
 	hasTagCriteria := gf.TagMatcher.CriteriaCount() > 0
 	hasPositionCriteria := gf.PositionMatcher.PatternCount() > 0
 
 	if !hasTagCriteria && !hasPositionCriteria {
-		return true // no criteria = match all
+		return true, nil // no criteria = match all
 	}
 
-	tagMatches := !hasTagCriteria || gf.TagMatcher.MatchGame(game)
-	positionMatches := !hasPositionCriteria || gf.PositionMatcher.MatchGame(game) != nil
+	if hasTagCriteria && !gf.TagMatcher.MatchGame(game) {
+		return false, nil
+	}
+	if !hasPositionCriteria {
+		return true, nil
+	}
 
 	// Both criteria types must match when present (AND logic)
-	return tagMatches && positionMatches
+	matched := gf.PositionMatcher.MatchGame(game)
+	return matched != nil, matched
 }
 
 // HasCriteria returns true if any filter criteria are set.
@@ -145,6 +197,23 @@ func (gf *GameFilter) SetSubstringMatch(use bool) {
 	gf.TagMatcher.SetSubstringMatch(use)
 }
 
+// SetCaseSensitive makes tag value comparisons respect case.
+func (gf *GameFilter) SetCaseSensitive(use bool) {
+	gf.TagMatcher.SetCaseSensitive(use)
+}
+
+// SetAnchored makes substring tag matches only match at the start of a
+// value.
+func (gf *GameFilter) SetAnchored(use bool) {
+	gf.TagMatcher.SetAnchored(use)
+}
+
+// SetExactMatch makes the player, White and Black filters match only the
+// whole name.
+func (gf *GameFilter) SetExactMatch(use bool) {
+	gf.TagMatcher.SetExactMatch(use)
+}
+
 // Match implements GameMatcher interface.
 func (gf *GameFilter) Match(game *chess.Game) bool {
 	return gf.MatchGame(game)
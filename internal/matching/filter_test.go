@@ -183,6 +183,88 @@ func TestGameFilter_AddFENFilter_InvalidFEN(t *testing.T) {
 	}
 }
 
+func TestGameFilter_AddFENEntry(t *testing.T) {
+	game := testutil.MustParseGame(t, `
+[Event "Test"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 *
+`)
+	const ruyPlacement = "r1bqkbnr/pppp1ppp/2n5/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R"
+
+	tests := []struct {
+		name      string
+		entry     string
+		wantMatch bool
+		wantLabel string
+	}{
+		{"exact with correct side", "exact:" + ruyPlacement + " b KQkq - 3 3;ruy", true, "ruy"},
+		{"exact with wrong side", "exact:" + ruyPlacement + " w KQkq - 3 3", false, ""},
+		{"pattern ignores side", "pattern:" + ruyPlacement + " w - - 0 1;ruy", true, "ruy"},
+		{"unmarked placement is pattern", ruyPlacement, true, "default"},
+		{"unmarked full FEN is exact", ruyPlacement + " w KQkq - 3 3", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gf := NewGameFilter()
+			if err := gf.AddFENEntry(tt.entry, "default"); err != nil {
+				t.Fatalf("AddFENEntry failed: %v", err)
+			}
+			matched, position := gf.MatchGameDetail(game)
+			if matched != tt.wantMatch {
+				t.Fatalf("MatchGameDetail matched = %v; want %v", matched, tt.wantMatch)
+			}
+			if matched && position.Label != tt.wantLabel {
+				t.Errorf("Label = %q; want %q", position.Label, tt.wantLabel)
+			}
+		})
+	}
+}
+
+func TestGameFilter_LoadFENFile(t *testing.T) {
+	game := testutil.MustParseGame(t, `
+[Event "Test"]
+[Result "*"]
+
+1. d4 d5 2. c4 *
+`)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "positions.txt")
+	content := "# positions\n" +
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1;kings pawn\n" +
+		"\n" +
+		"pattern:rnbqkbnr/ppp1pppp/8/3p4/2PP4/8/PP2PPPP/RNBQKBNR\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	gf := NewGameFilter()
+	if err := gf.LoadFENFile(path); err != nil {
+		t.Fatalf("LoadFENFile failed: %v", err)
+	}
+	if gf.PositionMatcher.PatternCount() != 2 {
+		t.Fatalf("Expected 2 entries, got %d", gf.PositionMatcher.PatternCount())
+	}
+
+	matched, position := gf.MatchGameDetail(game)
+	if !matched {
+		t.Fatal("Expected Queen's Gambit position to match")
+	}
+	if position.Label != "positions.txt:4" {
+		t.Errorf("Label = %q; want %q", position.Label, "positions.txt:4")
+	}
+
+	bad := filepath.Join(dir, "bad.txt")
+	if err := os.WriteFile(bad, []byte("exact:not a fen\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewGameFilter().LoadFENFile(bad); err == nil {
+		t.Error("Expected error for invalid exact entry")
+	}
+}
+
 func TestGameFilter_AddPatternFilter(t *testing.T) {
 	gf := NewGameFilter()
 	gf.AddPatternFilter("???????*/????????/8/8/8/8/????????/*??????", false)
@@ -2,6 +2,9 @@
 package matching
 
 import (
+	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -9,25 +12,53 @@ import (
 	"github.com/lgbarn/pgn-extract-go/internal/engine"
 )
 
+// minorPiece is the piece class matched by M: any bishop or knight.
+const minorPiece chess.Piece = -1
+
+// materialPieces lists the piece types counted on the board.
+var materialPieces = []chess.Piece{chess.King, chess.Queen, chess.Rook, chess.Bishop, chess.Knight, chess.Pawn}
+
+// countOp is the comparison applied to a piece count.
+type countOp int
+
+const (
+	opDefault countOp = iota // exact with -y, at least with -z
+	opExact
+	opAtLeast
+	opAtMost
+)
+
 // MaterialMatcher matches games by material balance.
 type MaterialMatcher struct {
 	// Pattern like "QR:qrr" means white has Q+R, black has Q+2R
 	pattern     string
 	exactMatch  bool
+	anyColour   bool // also try the pattern with the colours swapped
 	whitePieces map[chess.Piece]int
 	blackPieces map[chess.Piece]int
+	whiteOps    map[chess.Piece]countOp
+	blackOps    map[chess.Piece]countOp
+	firstMove   int // positions before this move number are ignored, 0 = open
+	lastMove    int // positions after this move number are ignored, 0 = open
+	minPlies    int // consecutive matching positions required, at least 1
 }
 
 // NewMaterialMatcher creates a new material matcher.
 // Pattern format: "QRN:qrn" (white pieces : black pieces)
 // Use uppercase for white, lowercase for black
-// K=King, Q=Queen, R=Rook, B=Bishop, N=Knight, P=Pawn
+// K=King, Q=Queen, R=Rook, B=Bishop, N=Knight, P=Pawn, M=any minor piece.
+// A letter followed by + means "at least" that many; a prefix of ex=, <= or
+// >= (optionally with a count, e.g. "<=3P") sets the comparison for the
+// next piece. A leading ~ makes the pattern colour-independent.
 func NewMaterialMatcher(pattern string, exact bool) *MaterialMatcher {
 	mm := &MaterialMatcher{
 		pattern:     pattern,
 		exactMatch:  exact,
 		whitePieces: make(map[chess.Piece]int),
 		blackPieces: make(map[chess.Piece]int),
+		whiteOps:    make(map[chess.Piece]countOp),
+		blackOps:    make(map[chess.Piece]countOp),
+		minPlies:    1,
 	}
 	mm.parsePattern(pattern)
 	return mm
@@ -35,6 +66,11 @@ func NewMaterialMatcher(pattern string, exact bool) *MaterialMatcher {
 
 // parsePattern parses a material pattern like "QR:qrr"
 func (mm *MaterialMatcher) parsePattern(pattern string) {
+	if strings.HasPrefix(pattern, "~") {
+		mm.anyColour = true
+		pattern = pattern[1:]
+	}
+
 	parts := strings.Split(pattern, ":")
 	if len(parts) >= 1 {
 		mm.parsePieces(parts[0], chess.White)
@@ -45,59 +81,146 @@ func (mm *MaterialMatcher) parsePattern(pattern string) {
 }
 
 // parsePieces parses a piece specification string for the given color.
-// White pieces use uppercase (KQRBNP), black pieces use lowercase (kqrbnp).
+// White pieces use uppercase (KQRBNPM), black pieces use lowercase (kqrbnpm).
 func (mm *MaterialMatcher) parsePieces(s string, color chess.Colour) {
-	target := mm.whitePieces
+	target, ops := mm.whitePieces, mm.whiteOps
 	if color == chess.Black {
-		target = mm.blackPieces
+		target, ops = mm.blackPieces, mm.blackOps
 	}
 
-	for _, c := range s {
-		switch unicode.ToUpper(c) {
-		case 'K':
-			target[chess.King]++
-		case 'Q':
-			target[chess.Queen]++
-		case 'R':
-			target[chess.Rook]++
-		case 'B':
-			target[chess.Bishop]++
-		case 'N':
-			target[chess.Knight]++
-		case 'P':
-			target[chess.Pawn]++
+	pendingOp, pendingCount, hasCount := opDefault, 0, false
+	last := chess.Empty
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "ex="):
+			pendingOp = opExact
+			i += 2
+			continue
+		case strings.HasPrefix(s[i:], "<="):
+			pendingOp = opAtMost
+			i++
+			continue
+		case strings.HasPrefix(s[i:], ">="):
+			pendingOp = opAtLeast
+			i++
+			continue
+		case s[i] >= '0' && s[i] <= '9':
+			pendingCount = pendingCount*10 + int(s[i]-'0')
+			hasCount = true
+			continue
+		case s[i] == '+':
+			if last != chess.Empty {
+				ops[last] = opAtLeast
+			}
+			continue
+		}
+
+		piece, ok := materialLetter(rune(s[i]))
+		if !ok {
+			pendingOp, pendingCount, hasCount = opDefault, 0, false
+			continue
 		}
+		count := 1
+		if hasCount {
+			count = pendingCount
+		}
+		target[piece] += count
+		if pendingOp != opDefault {
+			ops[piece] = pendingOp
+		}
+		pendingOp, pendingCount, hasCount, last = opDefault, 0, false, piece
 	}
 }
 
-// MatchGame checks if any position in the game matches the material pattern.
-func (mm *MaterialMatcher) MatchGame(game *chess.Game) bool {
-	board := engine.MustBoardFromFEN(engine.InitialFEN)
-
-	// Check starting position
-	if mm.matchPosition(board) {
-		return true
+// materialLetter maps a pattern letter to its piece class.
+func materialLetter(c rune) (chess.Piece, bool) {
+	switch unicode.ToUpper(c) {
+	case 'K':
+		return chess.King, true
+	case 'Q':
+		return chess.Queen, true
+	case 'R':
+		return chess.Rook, true
+	case 'B':
+		return chess.Bishop, true
+	case 'N':
+		return chess.Knight, true
+	case 'P':
+		return chess.Pawn, true
+	case 'M':
+		return minorPiece, true
 	}
+	return chess.Empty, false
+}
 
-	// Check after each move
-	for move := game.Moves; move != nil; move = move.Next {
-		if !engine.ApplyMove(board, move) {
-			break
+// SetWindow restricts matching to the positions reached by moves first to
+// last, by move number. The starting position belongs to the move before
+// the game's first. Either end may be 0 to leave it open.
+func (mm *MaterialMatcher) SetWindow(first, last int) {
+	mm.firstMove, mm.lastMove = first, last
+}
+
+// SetMinPlies requires the pattern to hold in at least n consecutive
+// positions, so that it persists for n plies rather than occurring in
+// passing, e.g. in the middle of an exchange.
+func (mm *MaterialMatcher) SetMinPlies(n int) {
+	mm.minPlies = max(n, 1)
+}
+
+// MatchGame checks if the material pattern holds, within the move window,
+// for the required number of consecutive positions of the game.
+func (mm *MaterialMatcher) MatchGame(game *chess.Game) bool {
+	board := engine.NewBoardForGame(game)
+	run := 0
+
+	// Check the starting position and then the position after each move
+	for move := game.Moves; ; move = move.Next {
+		if mm.inWindow(board) && mm.matchPosition(board) {
+			run++
+			if run >= mm.minPlies {
+				return true
+			}
+		} else {
+			run = 0
 		}
 
-		if mm.matchPosition(board) {
-			return true
+		if move == nil || !engine.ApplyMove(board, move) {
+			break
 		}
 	}
 
 	return false
 }
 
+// inWindow reports whether the move that reached a position lies within
+// the matcher's move-number window.
+func (mm *MaterialMatcher) inWindow(board *chess.Board) bool {
+	number := int(board.MoveNumber)
+	if board.ToMove == chess.White {
+		number--
+	}
+	return (mm.firstMove == 0 || number >= mm.firstMove) &&
+		(mm.lastMove == 0 || number <= mm.lastMove)
+}
+
 // matchPosition checks if a position matches the material pattern.
 func (mm *MaterialMatcher) matchPosition(board *chess.Board) bool {
-	// Count pieces on the board
-	whiteCounts := make(map[chess.Piece]int)
-	blackCounts := make(map[chess.Piece]int)
+	whiteCounts, blackCounts := CountMaterial(board)
+
+	if mm.sideMatches(mm.whitePieces, mm.whiteOps, whiteCounts) &&
+		mm.sideMatches(mm.blackPieces, mm.blackOps, blackCounts) {
+		return true
+	}
+	return mm.anyColour &&
+		mm.sideMatches(mm.whitePieces, mm.whiteOps, blackCounts) &&
+		mm.sideMatches(mm.blackPieces, mm.blackOps, whiteCounts)
+}
+
+// CountMaterial counts each side's pieces by type. The counts also carry
+// the number of minor pieces under the M class.
+func CountMaterial(board *chess.Board) (white, black map[chess.Piece]int) {
+	white = make(map[chess.Piece]int)
+	black = make(map[chess.Piece]int)
 
 	// Iterate over the board squares (accounting for hedge)
 	for col := chess.Hedge; col < chess.Hedge+chess.BoardSize; col++ {
@@ -112,68 +235,195 @@ func (mm *MaterialMatcher) matchPosition(board *chess.Board) bool {
 			colour := chess.ExtractColour(colouredPiece)
 
 			if colour == chess.White {
-				whiteCounts[pieceType]++
+				white[pieceType]++
 			} else {
-				blackCounts[pieceType]++
+				black[pieceType]++
 			}
 		}
 	}
+	white[minorPiece] = white[chess.Bishop] + white[chess.Knight]
+	black[minorPiece] = black[chess.Bishop] + black[chess.Knight]
+	return white, black
+}
 
-	if mm.exactMatch {
-		return mm.exactMaterialMatch(whiteCounts, blackCounts)
+// PieceValues weigh material, in hundredths of a pawn by piece type, so
+// that a knight of 3.2 and a bishop of 3.3 add up exactly. The king has no
+// value.
+type PieceValues [chess.NumPieceValues]int
+
+// StandardPieceValues are the conventional values: a pawn 1, a knight or
+// bishop 3, a rook 5 and a queen 9.
+var StandardPieceValues = PieceValues{chess.Pawn: 100, chess.Knight: 300, chess.Bishop: 300, chess.Rook: 500, chess.Queen: 900}
+
+// valuedPieces are the pieces that have a value, in the order they are
+// written.
+var valuedPieces = []chess.Piece{chess.Pawn, chess.Knight, chess.Bishop, chess.Rook, chess.Queen}
+
+// ParsePieceValues reads piece values in pawns, such as "N=3.2,B=3.3",
+// with up to two decimal places. Pieces not given keep their standard
+// values.
+func ParsePieceValues(spec string) (PieceValues, error) {
+	values := StandardPieceValues
+	for _, field := range strings.Split(spec, ",") {
+		letter, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		piece := pieceFromLetter(strings.ToUpper(letter))
+		if !ok || piece == chess.Empty {
+			return values, fmt.Errorf("piece value %q: want a letter of PNBRQ, '=' and a value", field)
+		}
+		pawns, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || pawns < 0 || pawns > 100 {
+			return values, fmt.Errorf("piece value %q: want a number of pawns from 0 to 100", field)
+		}
+		values[piece] = int(math.Round(pawns * 100))
 	}
-	return mm.minimalMaterialMatch(whiteCounts, blackCounts)
+	return values, nil
 }
 
-// exactMaterialMatch checks for exact material match.
-func (mm *MaterialMatcher) exactMaterialMatch(whiteCounts, blackCounts map[chess.Piece]int) bool {
-	// White pieces must match exactly
-	for piece, count := range mm.whitePieces {
-		if whiteCounts[piece] != count {
-			return false
+// pieceFromLetter returns the valued piece with an English letter, or
+// chess.Empty.
+func pieceFromLetter(letter string) chess.Piece {
+	for _, piece := range valuedPieces {
+		if letter == string(pieceLetters[piece]) {
+			return piece
 		}
 	}
+	return chess.Empty
+}
 
-	// Black pieces must match exactly
-	for piece, count := range mm.blackPieces {
-		if blackCounts[piece] != count {
-			return false
-		}
+// String returns the values in the form ParsePieceValues reads.
+func (v *PieceValues) String() string {
+	parts := make([]string, len(valuedPieces))
+	for i, piece := range valuedPieces {
+		parts[i] = string(pieceLetters[piece]) + "=" + Pawns(v[piece])
+	}
+	return strings.Join(parts, ",")
+}
+
+// Material returns the value, in hundredths of a pawn, of a side's pieces
+// as counted by CountMaterial.
+func (v *PieceValues) Material(counts map[chess.Piece]int) int {
+	total := 0
+	for _, piece := range valuedPieces {
+		total += counts[piece] * v[piece]
 	}
+	return total
+}
 
-	// Check that there are no extra pieces beyond what's specified
-	allPieces := []chess.Piece{chess.King, chess.Queen, chess.Rook, chess.Bishop, chess.Knight, chess.Pawn}
-	for _, piece := range allPieces {
-		if mm.whitePieces[piece] == 0 && whiteCounts[piece] > 0 {
-			return false
+// Pawns formats hundredths of a pawn as pawns with no more decimal places
+// than needed, e.g. "3", "3.2" or "-0.25".
+func Pawns(hundredths int) string {
+	return strconv.FormatFloat(float64(hundredths)/100, 'f', -1, 64)
+}
+
+// MaterialBalance describes a position's material balance from White's
+// point of view, e.g. "+1 (R vs B+P)". The bracketed part lists the pieces
+// each side has in excess of the other and is omitted when material is
+// identical.
+func MaterialBalance(board *chess.Board, values *PieceValues) string {
+	white, black := CountMaterial(board)
+	var whiteExtra, blackExtra []string
+	for _, piece := range materialPieces {
+		if piece == chess.King {
+			continue
 		}
-		if mm.blackPieces[piece] == 0 && blackCounts[piece] > 0 {
-			return false
+		diff := white[piece] - black[piece]
+		switch {
+		case diff > 0:
+			whiteExtra = append(whiteExtra, pieceCount(piece, diff))
+		case diff < 0:
+			blackExtra = append(blackExtra, pieceCount(piece, -diff))
 		}
 	}
 
-	return true
+	score := values.Material(white) - values.Material(black)
+	text := Pawns(score)
+	if score > 0 {
+		text = "+" + text
+	}
+	if len(whiteExtra) == 0 && len(blackExtra) == 0 {
+		return text
+	}
+	return text + " (" + joinPieces(whiteExtra) + " vs " + joinPieces(blackExtra) + ")"
+}
+
+// MaterialDifference returns White's material minus Black's in hundredths
+// of a pawn.
+func MaterialDifference(board *chess.Board, values *PieceValues) int {
+	white, black := CountMaterial(board)
+	return values.Material(white) - values.Material(black)
+}
+
+// pieceCount renders a number of pieces of one type, e.g. "2P".
+func pieceCount(piece chess.Piece, n int) string {
+	letter := string(pieceLetters[piece])
+	if n == 1 {
+		return letter
+	}
+	return strconv.Itoa(n) + letter
+}
+
+// pieceLetters maps piece types to their English letters.
+var pieceLetters = map[chess.Piece]byte{chess.Queen: 'Q', chess.Rook: 'R', chess.Bishop: 'B', chess.Knight: 'N', chess.Pawn: 'P'}
+
+// joinPieces joins piece counts with "+", or gives "-" for none.
+func joinPieces(parts []string) string {
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, "+")
 }
 
-// minimalMaterialMatch checks that at least the specified pieces exist.
-func (mm *MaterialMatcher) minimalMaterialMatch(whiteCounts, blackCounts map[chess.Piece]int) bool {
-	// White must have at least the specified pieces
-	for piece, count := range mm.whitePieces {
-		if whiteCounts[piece] < count {
+// sideMatches checks one side's board counts against its pattern.
+func (mm *MaterialMatcher) sideMatches(want map[chess.Piece]int, ops map[chess.Piece]countOp, counts map[chess.Piece]int) bool {
+	for piece, count := range want {
+		if !compareCount(mm.effectiveOp(ops[piece]), counts[piece], count) {
 			return false
 		}
 	}
 
-	// Black must have at least the specified pieces
-	for piece, count := range mm.blackPieces {
-		if blackCounts[piece] < count {
+	if !mm.exactMatch {
+		return true
+	}
+
+	// Check that there are no extra pieces beyond what's specified
+	_, hasMinor := want[minorPiece]
+	for _, piece := range materialPieces {
+		if _, specified := want[piece]; specified {
+			continue
+		}
+		if hasMinor && (piece == chess.Bishop || piece == chess.Knight) {
+			continue
+		}
+		if counts[piece] > 0 {
 			return false
 		}
 	}
-
 	return true
 }
 
+// effectiveOp resolves the default comparison for the matcher's mode.
+func (mm *MaterialMatcher) effectiveOp(op countOp) countOp {
+	if op != opDefault {
+		return op
+	}
+	if mm.exactMatch {
+		return opExact
+	}
+	return opAtLeast
+}
+
+// compareCount applies a count comparison.
+func compareCount(op countOp, have, want int) bool {
+	switch op {
+	case opExact:
+		return have == want
+	case opAtMost:
+		return have <= want
+	default:
+		return have >= want
+	}
+}
+
 // HasCriteria returns true if a material pattern is set.
 func (mm *MaterialMatcher) HasCriteria() bool {
 	return mm.pattern != ""
@@ -422,3 +422,138 @@ func TestMaterialMatcher_ParsePattern_MultipleColons(t *testing.T) {
 		t.Error("expected 1 black king")
 	}
 }
+
+func TestMaterialMatcher_ExtendedPatterns(t *testing.T) {
+	// White: K, R, B, N, 3 pawns. Black: K, R, R, N, 4 pawns.
+	board, err := engine.NewBoardFromFEN("r3k1r1/pp1n1pp1/8/8/8/2N5/PP3P2/3RKB2 w - - 0 30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		pattern string
+		exact   bool
+		want    bool
+	}{
+		{"two minors each", "MM:m", false, true},
+		{"exact with minor class", "KRMMPPP:krrnpppp", true, true},
+		{"exact minor count wrong", "KRMPPP:krrnpppp", true, false},
+		{"at least one rook in exact mode", "KR+BNPPP:kr+npppp", true, true},
+		{"at least two rooks for white fails", "RR+:k", false, false},
+		{"at most three pawns", "<=3P:k", false, true},
+		{"at most three black pawns fails", "K:<=3p", false, false},
+		{"explicit at least", ">=2M:>=1r", false, true},
+		{"explicit exact zero queens", "ex=0Q:ex=0q", false, true},
+		{"explicit exact in minimal mode", "ex=2P:k", false, false},
+		{"colour-specific mismatch", "RR:r", false, false},
+		{"colour-independent match", "~RR:r", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mm := NewMaterialMatcher(tt.pattern, tt.exact)
+			if got := mm.matchPosition(board); got != tt.want {
+				t.Errorf("matchPosition(%q, exact=%v) = %v, want %v", tt.pattern, tt.exact, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaterialMatcher_MatchGame_FromFEN(t *testing.T) {
+	game := testutil.MustParseGame(t, `[Event "Endgame"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/R3K3 w - - 0 1"]
+[Result "*"]
+
+1. Ra8+ Kd7 *
+`)
+	if !NewMaterialMatcher("KRP:k", true).MatchGame(game) {
+		t.Error("expected the FEN starting material to be used")
+	}
+}
+
+func TestMaterialBalance(t *testing.T) {
+	bishopPair, err := ParsePieceValues("N=3.2,B=3.35")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		fen    string
+		values *PieceValues
+		want   string
+	}{
+		{engine.InitialFEN, &StandardPieceValues, "0"},
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 0 1", &StandardPieceValues, "+5 (R vs -)"},
+		{"4k3/pp6/8/8/8/8/8/R3K1b1 w - - 0 1", &StandardPieceValues, "0 (R vs B+2P)"},
+		{"3qk3/8/8/8/8/8/8/2RRK3 w - - 0 1", &StandardPieceValues, "+1 (2R vs Q)"},
+		{"4k1n1/8/8/8/8/8/8/2B1K3 w - - 0 1", &bishopPair, "+0.15 (B vs N)"},
+		{"4k1n1/8/8/8/8/8/8/4K3 w - - 0 1", &bishopPair, "-3.2 (- vs N)"},
+	}
+	for _, tt := range tests {
+		board, err := engine.NewBoardFromFEN(tt.fen)
+		if err != nil {
+			t.Fatalf("NewBoardFromFEN(%q): %v", tt.fen, err)
+		}
+		if got := MaterialBalance(board, tt.values); got != tt.want {
+			t.Errorf("MaterialBalance(%q) = %q, want %q", tt.fen, got, tt.want)
+		}
+	}
+}
+
+func TestParsePieceValues(t *testing.T) {
+	values, err := ParsePieceValues("P=1, n=3.2,B=3.33,Q=9.5")
+	if err != nil {
+		t.Fatalf("ParsePieceValues: %v", err)
+	}
+	if got, want := values.String(), "P=1,N=3.2,B=3.33,R=5,Q=9.5"; got != want {
+		t.Errorf("values = %s, want %s", got, want)
+	}
+	if got := StandardPieceValues.String(); got != "P=1,N=3,B=3,R=5,Q=9" {
+		t.Errorf("standard values = %s", got)
+	}
+	for _, spec := range []string{"", "K=100", "N", "N=x", "N=-1", "X=3", "N=3,"} {
+		if _, err := ParsePieceValues(spec); err == nil {
+			t.Errorf("ParsePieceValues(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestMaterialMatcher_WindowAndMinPlies(t *testing.T) {
+	// Black is a pawn down from 2. exd5 (positions after plies 3 to 8);
+	// White has all eight pawns only until 2... Qxd5.
+	game := testutil.MustParseGame(t, `[Event "Test"]
+[Result "*"]
+
+1. e4 d5 2. exd5 Qxd5 3. Nc3 Qa5 4. d4 Nf6 *
+`)
+
+	tests := []struct {
+		name        string
+		pattern     string
+		first, last int
+		minPlies    int
+		want        bool
+	}{
+		{"no window", ":ex=7p", 0, 0, 0, true},
+		{"window after the capture", ":ex=7p", 3, 4, 0, true},
+		{"window before the capture", ":ex=7p", 1, 1, 0, false},
+		{"open-ended window", "ex=8P:ex=7p", 3, 0, 0, false},
+		{"window includes the capture", "ex=8P:ex=7p", 0, 2, 0, true},
+		{"persists long enough", ":ex=7p", 0, 0, 6, true},
+		{"does not persist long enough", ":ex=7p", 0, 0, 7, false},
+		{"passing position", "ex=8P:ex=7p", 0, 0, 2, false},
+		{"persists within window", ":ex=7p", 3, 4, 4, true},
+		{"window cuts the run short", ":ex=7p", 3, 3, 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mm := NewMaterialMatcher(tt.pattern, false)
+			mm.SetWindow(tt.first, tt.last)
+			mm.SetMinPlies(tt.minPlies)
+			if got := mm.MatchGame(game); got != tt.want {
+				t.Errorf("MatchGame() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package matching
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// engineNames lists well-known chess engines by the lowercase words of
+// their names.
+var engineNames = []string{
+	"stockfish", "komodo", "komodo dragon", "leela", "leela chess zero",
+	"lc0", "lczero", "houdini", "fritz", "deep fritz", "rybka", "deep rybka",
+	"shredder", "deep shredder", "critter", "ethereal", "berserk",
+	"alphazero", "crafty", "gnuchess", "gnu chess", "hiarcs", "deep hiarcs",
+	"rubichess", "slowchess", "koivisto", "arasan", "deep blue", "junior",
+	"deep junior", "torch", "dragon",
+}
+
+// engineSuffixes are words that may follow an engine's name besides
+// version numbers, as in "Stockfish dev-20230101 NNUE".
+var engineSuffixes = map[string]bool{
+	"dev": true, "nnue": true, "level": true, "lvl": true, "x64": true,
+	"mp": true, "bit": true, "pro": true, "popcnt": true, "modern": true,
+	"avx2": true, "bmi2": true, "sse": true,
+}
+
+// NormalizePlayerName reduces a player name to a canonical form so that
+// "Carlsen, Magnus" and "magnus  carlsen" compare equal.
+func NormalizePlayerName(name string) string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	sort.Strings(fields)
+	return strings.Join(fields, " ")
+}
+
+// IsEngineName reports whether a player name names a chess engine: the
+// name must start with a known engine's name, as whole words, followed by
+// nothing but versions and build descriptions. "Stockfish 16" and "Deep
+// Fritz 10" are engines; "Saemisch, Fritz" and "Stockfisher, Ann" are not.
+func IsEngineName(name string) bool {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, engine := range engineNames {
+		if rest, ok := cutEngineName(words, strings.Fields(engine)); ok && isVersionWords(rest) {
+			return true
+		}
+	}
+	return false
+}
+
+// cutEngineName matches the words of an engine's name at the start of a
+// player's name, allowing a version glued to the last, as in
+// "Stockfish16". It returns the words that follow.
+func cutEngineName(words, engine []string) ([]string, bool) {
+	if len(words) < len(engine) {
+		return nil, false
+	}
+	last := len(engine) - 1
+	for i, w := range engine[:last] {
+		if words[i] != w {
+			return nil, false
+		}
+	}
+	version, ok := strings.CutPrefix(words[last], engine[last])
+	if !ok || strings.TrimFunc(version, unicode.IsDigit) != "" {
+		return nil, false
+	}
+	return words[last+1:], true
+}
+
+// isVersionWords reports whether every word is a version or a known
+// build description.
+func isVersionWords(words []string) bool {
+	for _, w := range words {
+		if !engineSuffixes[w] && strings.IndexFunc(w, unicode.IsDigit) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IsEnginePlayer decides whether a player is an engine.
+// An explicit WhiteType/BlackType tag ("program" or "human") takes
+// precedence over name-based detection.
+func IsEnginePlayer(name, playerType string) bool {
+	switch strings.ToLower(strings.TrimSpace(playerType)) {
+	case "program", "engine", "computer":
+		return true
+	case "human":
+		return false
+	}
+	return IsEngineName(name)
+}
+
+// IsSelfPlay reports whether both sides of the game are the same player.
+func IsSelfPlay(game *chess.Game) bool {
+	white := NormalizePlayerName(game.White())
+	if white == "" {
+		return false
+	}
+	return white == NormalizePlayerName(game.Black())
+}
+
+// IsEngineGame reports whether both players are engines.
+func IsEngineGame(game *chess.Game) bool {
+	return IsEnginePlayer(game.White(), game.GetTag("WhiteType")) &&
+		IsEnginePlayer(game.Black(), game.GetTag("BlackType"))
+}
+
+// IsHumanGame reports whether neither player is an engine.
+func IsHumanGame(game *chess.Game) bool {
+	return !IsEnginePlayer(game.White(), game.GetTag("WhiteType")) &&
+		!IsEnginePlayer(game.Black(), game.GetTag("BlackType"))
+}
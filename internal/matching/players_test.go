@@ -0,0 +1,87 @@
+package matching
+
+import (
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+func TestNormalizePlayerName(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"Carlsen, Magnus", "Magnus Carlsen", true},
+		{"carlsen,magnus", "CARLSEN  Magnus", true},
+		{"Carlsen, Magnus", "Caruana, Fabiano", false},
+	}
+
+	for _, tt := range tests {
+		got := NormalizePlayerName(tt.a) == NormalizePlayerName(tt.b)
+		if got != tt.same {
+			t.Errorf("NormalizePlayerName(%q) == NormalizePlayerName(%q): got %v, want %v", tt.a, tt.b, got, tt.same)
+		}
+	}
+}
+
+func TestIsEnginePlayer(t *testing.T) {
+	tests := []struct {
+		name       string
+		playerType string
+		want       bool
+	}{
+		{"Stockfish 16", "", true},
+		{"Lc0 v0.30", "", true},
+		{"Komodo Dragon 3", "", true},
+		{"Carlsen, Magnus", "", false},
+		{"Carlsen, Magnus", "program", true},
+		{"Stockfish", "human", false},
+		{"Deep Blue", "", true},
+		{"Deep Fritz 10", "", true},
+		{"Stockfish16", "", true},
+		{"Stockfish_16.1", "", true},
+		{"Stockfish dev-20230101 NNUE", "", true},
+		{"Leela Chess Zero", "", true},
+		// Human names sharing a word or prefix with an engine
+		{"Saemisch, Fritz", "", false},
+		{"Fritz Saemisch", "", false},
+		{"Engineer, Bob", "", false},
+		{"Stockfisher, Ann", "", false},
+		{"Houdini, Harry", "", false},
+		{"Computer, Joe", "", false},
+		{"Saemisch, Fritz", "program", true},
+		{"Stockfish 16", "human", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsEnginePlayer(tt.name, tt.playerType); got != tt.want {
+			t.Errorf("IsEnginePlayer(%q, %q) = %v; want %v", tt.name, tt.playerType, got, tt.want)
+		}
+	}
+}
+
+func TestPlayerGameClassification(t *testing.T) {
+	engineGame := &chess.Game{Tags: map[string]string{"White": "Stockfish 16", "Black": "Leela Chess Zero"}}
+	mixedGame := &chess.Game{Tags: map[string]string{"White": "Carlsen, Magnus", "Black": "Stockfish 16"}}
+	humanGame := &chess.Game{Tags: map[string]string{
+		"White": "Alpha", "Black": "Beta", "WhiteType": "human", "BlackType": "human",
+	}}
+	selfGame := &chess.Game{Tags: map[string]string{"White": "Carlsen, Magnus", "Black": "Magnus Carlsen"}}
+	unknownGame := &chess.Game{Tags: map[string]string{"White": "?", "Black": "?"}}
+
+	if !IsEngineGame(engineGame) || IsHumanGame(engineGame) {
+		t.Error("expected engine-vs-engine game to be classified as engine game")
+	}
+	if IsEngineGame(mixedGame) || IsHumanGame(mixedGame) {
+		t.Error("expected mixed game to be neither engine nor human game")
+	}
+	if !IsHumanGame(humanGame) {
+		t.Error("expected human game to be classified as human game")
+	}
+	if !IsSelfPlay(selfGame) {
+		t.Error("expected self-play game to be detected")
+	}
+	if IsSelfPlay(unknownGame) {
+		t.Error("unknown players should not count as self-play")
+	}
+}
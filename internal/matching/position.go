@@ -22,22 +22,40 @@ type FENPattern struct {
 	Hash          uint64 // position hash for exact FEN matches
 	IsExact       bool   // true if this is an exact FEN (no wildcards)
 	IncludeInvert bool   // also match color-inverted position
+	NextMove      string // if set, the move played from the position must be this one
 	ranks         []string
 }
 
+// acceptsNext reports whether the move played from a matched position
+// satisfies the pattern's next-move constraint.
+func (p *FENPattern) acceptsNext(next *chess.Move) bool {
+	if p.NextMove == "" {
+		return true
+	}
+	return next != nil && normalizeMove(next.Text) == normalizeMove(p.NextMove)
+}
+
 // PositionMatcher provides position-based game filtering.
 type PositionMatcher struct {
 	patterns    []*FENPattern
-	exactHashes map[uint64]*FENPattern
+	exactHashes map[uint64][]*FENPattern
+	nextMove    string
+	plyFilter   func(ply int) bool
 }
 
 // NewPositionMatcher creates a new position matcher.
 func NewPositionMatcher() *PositionMatcher {
 	return &PositionMatcher{
-		exactHashes: make(map[uint64]*FENPattern),
+		exactHashes: make(map[uint64][]*FENPattern),
 	}
 }
 
+// SetNextMove sets a default next-move constraint (SAN, e.g. "Nf3") for
+// patterns added afterwards that do not carry their own.
+func (pm *PositionMatcher) SetNextMove(san string) {
+	pm.nextMove = strings.TrimSpace(san)
+}
+
 // AddFEN adds an exact FEN position to match.
 func (pm *PositionMatcher) AddFEN(fen string, label string) error {
 	board, err := engine.NewBoardFromFEN(fen)
@@ -47,18 +65,59 @@ func (pm *PositionMatcher) AddFEN(fen string, label string) error {
 
 	hash := hashing.GenerateZobristHash(board)
 	pattern := &FENPattern{
-		Pattern: fen,
-		Label:   label,
-		Hash:    hash,
-		IsExact: true,
+		Pattern:  fen,
+		Label:    label,
+		Hash:     hash,
+		IsExact:  true,
+		NextMove: pm.nextMove,
 	}
 
 	pm.patterns = append(pm.patterns, pattern)
-	pm.exactHashes[hash] = pattern
+	pm.exactHashes[hash] = append(pm.exactHashes[hash], pattern)
 
 	return nil
 }
 
+// AddEntry adds a position entry in the form "[exact:|pattern:]FEN[;label[;move]]".
+// Exact entries compare the full position including side to move, castling
+// and en passant; pattern entries compare piece placement only. Unmarked
+// entries are exact when they contain more than the placement field. The
+// optional move requires that move to be played from the position.
+func (pm *PositionMatcher) AddEntry(entry string, defaultLabel string) error {
+	parts := strings.Split(entry, ";")
+	fen, label := strings.TrimSpace(parts[0]), defaultLabel
+	if len(parts) > 1 && strings.TrimSpace(parts[1]) != "" {
+		label = strings.TrimSpace(parts[1])
+	}
+	if len(parts) > 2 && strings.TrimSpace(parts[2]) != "" {
+		saved := pm.nextMove
+		pm.nextMove = strings.TrimSpace(parts[2])
+		defer func() { pm.nextMove = saved }()
+	}
+
+	switch {
+	case strings.HasPrefix(fen, "exact:"):
+		return pm.AddFEN(strings.TrimSpace(strings.TrimPrefix(fen, "exact:")), label)
+	case strings.HasPrefix(fen, "pattern:"):
+		pm.AddPattern(placementField(strings.TrimPrefix(fen, "pattern:")), label, false)
+		return nil
+	case strings.Contains(fen, " "):
+		return pm.AddFEN(fen, label)
+	default:
+		pm.AddPattern(fen, label, false)
+		return nil
+	}
+}
+
+// placementField returns the piece placement field of a FEN string.
+func placementField(fen string) string {
+	fields := strings.Fields(fen)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
 // AddPattern adds a FEN pattern with wildcards.
 func (pm *PositionMatcher) AddPattern(pattern string, label string, includeInvert bool) {
 	p := &FENPattern{
@@ -66,6 +125,7 @@ func (pm *PositionMatcher) AddPattern(pattern string, label string, includeInver
 		Label:         label,
 		IsExact:       false,
 		IncludeInvert: includeInvert,
+		NextMove:      pm.nextMove,
 	}
 
 	// Parse into ranks
@@ -81,6 +141,7 @@ func (pm *PositionMatcher) AddPattern(pattern string, label string, includeInver
 			Label:         label,
 			IsExact:       false,
 			IncludeInvert: false,
+			NextMove:      pm.nextMove,
 		}
 		ip.ranks = strings.Split(inverted, "/")
 		pm.patterns = append(pm.patterns, ip)
@@ -98,17 +159,24 @@ func (pm *PositionMatcher) MatchGame(game *chess.Game) *FENPattern {
 	board := pm.getStartingBoard(game)
 
 	// Check initial position
-	if match := pm.matchPosition(board); match != nil {
-		return match
+	if pm.acceptsPly(0) {
+		if match := pm.matchPositionBefore(board, game.Moves); match != nil {
+			return match
+		}
 	}
 
 	// Replay game and check each position
+	ply := 0
 	for move := game.Moves; move != nil; move = move.Next {
 		if !engine.ApplyMove(board, move) {
 			break
 		}
+		ply++
 
-		if match := pm.matchPosition(board); match != nil {
+		if !pm.acceptsPly(ply) {
+			continue
+		}
+		if match := pm.matchPositionBefore(board, move.Next); match != nil {
 			return match
 		}
 	}
@@ -116,6 +184,16 @@ func (pm *PositionMatcher) MatchGame(game *chess.Game) *FENPattern {
 	return nil
 }
 
+// SetPlyFilter restricts MatchGame to positions reached after a number of
+// plies the filter accepts. A nil filter accepts every position.
+func (pm *PositionMatcher) SetPlyFilter(filter func(ply int) bool) {
+	pm.plyFilter = filter
+}
+
+func (pm *PositionMatcher) acceptsPly(ply int) bool {
+	return pm.plyFilter == nil || pm.plyFilter(ply)
+}
+
 // getStartingBoard returns the starting board from FEN tag or initial position.
 func (pm *PositionMatcher) getStartingBoard(game *chess.Game) *chess.Board {
 	if fen, ok := game.Tags["FEN"]; ok {
@@ -123,21 +201,29 @@ func (pm *PositionMatcher) getStartingBoard(game *chess.Game) *chess.Board {
 			return board
 		}
 	}
-	board := engine.MustBoardFromFEN(engine.InitialFEN)
+	board := engine.NewInitialBoard()
 	return board
 }
 
 // matchPosition checks if a position matches any pattern.
 func (pm *PositionMatcher) matchPosition(board *chess.Board) *FENPattern {
+	return pm.matchPositionBefore(board, nil)
+}
+
+// matchPositionBefore checks if a position matches any pattern, given the
+// move played next from it (nil at the end of the game).
+func (pm *PositionMatcher) matchPositionBefore(board *chess.Board, next *chess.Move) *FENPattern {
 	// First check exact hash matches (fast)
 	hash := hashing.GenerateZobristHash(board)
-	if pattern, ok := pm.exactHashes[hash]; ok {
-		return pattern
+	for _, pattern := range pm.exactHashes[hash] {
+		if pattern.acceptsNext(next) {
+			return pattern
+		}
 	}
 
 	// Then check pattern matches
 	for _, pattern := range pm.patterns {
-		if !pattern.IsExact && pm.matchPattern(board, pattern) {
+		if !pattern.IsExact && pattern.acceptsNext(next) && pm.matchPattern(board, pattern) {
 			return pattern
 		}
 	}
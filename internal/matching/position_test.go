@@ -344,6 +344,32 @@ func TestPositionMatcher_MatchGame_FEN(t *testing.T) {
 	}
 }
 
+func TestPositionMatcher_MatchGame_PlyFilter(t *testing.T) {
+	game := testutil.MustParseGame(t, `
+[White "A"]
+[Black "B"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 *
+`)
+
+	pm := NewPositionMatcher()
+	// The Ruy Lopez position arises after ply 5
+	err := pm.AddFEN("r1bqkbnr/pppp1ppp/2n5/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 3 3", "Ruy Lopez")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pm.SetPlyFilter(func(ply int) bool { return ply <= 4 })
+	if match := pm.MatchGame(game); match != nil {
+		t.Error("expected no match with plies up to 4 accepted")
+	}
+	pm.SetPlyFilter(func(ply int) bool { return ply <= 5 })
+	if match := pm.MatchGame(game); match == nil {
+		t.Error("expected a match with plies up to 5 accepted")
+	}
+}
+
 func TestPositionMatcher_MatchGame_NoMatch(t *testing.T) {
 	game := testutil.MustParseGame(t, `
 [Event "Test"]
@@ -732,3 +758,53 @@ func TestMatchRank_DigitPartialMatch(t *testing.T) {
 		t.Error("expected false - first square is not empty")
 	}
 }
+
+func TestPositionMatcher_NextMove(t *testing.T) {
+	game := testutil.MustParseGame(t, `
+[Event "Test"]
+[Result "*"]
+
+1. e4 e5 2. Nf3+ Nc6 *
+`)
+	const afterE5 = "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2"
+
+	tests := []struct {
+		name  string
+		setup func(pm *PositionMatcher) error
+		want  bool
+	}{
+		{"matching next move", func(pm *PositionMatcher) error {
+			pm.SetNextMove("Nf3")
+			return pm.AddFEN(afterE5, "")
+		}, true},
+		{"different next move", func(pm *PositionMatcher) error {
+			pm.SetNextMove("Bc4")
+			return pm.AddFEN(afterE5, "")
+		}, false},
+		{"pattern with next move", func(pm *PositionMatcher) error {
+			pm.SetNextMove("Nf3")
+			pm.AddPattern("rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR", "", false)
+			return nil
+		}, true},
+		{"entry move overrides default", func(pm *PositionMatcher) error {
+			pm.SetNextMove("Bc4")
+			return pm.AddEntry(afterE5+";label;Nf3", "")
+		}, true},
+		{"no next move at game end", func(pm *PositionMatcher) error {
+			pm.SetNextMove("a3")
+			return pm.AddEntry("pattern:r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R", "")
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := NewPositionMatcher()
+			if err := tt.setup(pm); err != nil {
+				t.Fatal(err)
+			}
+			if got := pm.MatchGame(game) != nil; got != tt.want {
+				t.Errorf("MatchGame matched = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
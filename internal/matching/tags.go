@@ -32,7 +32,7 @@ type TagCriterion struct {
 	Operator   TagOperator
 	Regex      *regexp.Regexp // compiled regex for OpRegex
 	Soundex    string         // soundex value for OpSoundex
-	LowerValue string         // pre-computed lowercase for OpContains
+	LowerValue string         // pre-computed lowercase for text comparisons
 }
 
 // TagMatcher provides tag-based game filtering.
@@ -40,6 +40,9 @@ type TagMatcher struct {
 	criteria       []*TagCriterion
 	useSoundex     bool
 	substringMatch bool
+	caseSensitive  bool
+	anchored       bool
+	exact          bool
 	matchAll       bool // true = AND all criteria, false = OR
 }
 
@@ -60,11 +63,30 @@ func (tm *TagMatcher) SetUseSoundex(use bool) {
 	tm.useSoundex = use
 }
 
-// SetSubstringMatch enables substring matching for all tag values.
+// SetSubstringMatch makes equality criteria, such as those of a tag file,
+// match a tag value containing the criterion value.
 func (tm *TagMatcher) SetSubstringMatch(use bool) {
 	tm.substringMatch = use
 }
 
+// SetCaseSensitive makes text comparisons of tag values respect case.
+func (tm *TagMatcher) SetCaseSensitive(use bool) {
+	tm.caseSensitive = use
+}
+
+// SetAnchored makes substring matches only match at the start of a tag
+// value, so that "Carlsen" matches "Carlsen, Magnus" but not
+// "Carlsen, Henrik" only because both contain it.
+func (tm *TagMatcher) SetAnchored(use bool) {
+	tm.anchored = use
+}
+
+// SetExactMatch makes contains criteria, such as the player filters,
+// match only the whole tag value.
+func (tm *TagMatcher) SetExactMatch(use bool) {
+	tm.exact = use
+}
+
 // AddCriterion adds a tag matching criterion.
 func (tm *TagMatcher) AddCriterion(tagName, value string, op TagOperator) error {
 	c := &TagCriterion{
@@ -87,10 +109,8 @@ func (tm *TagMatcher) AddCriterion(tagName, value string, op TagOperator) error
 		c.Soundex = Soundex(value)
 	}
 
-	// Pre-compute lowercase for contains matching
-	if op == OpContains {
-		c.LowerValue = strings.ToLower(value)
-	}
+	// Pre-compute lowercase for case-insensitive text matching
+	c.LowerValue = strings.ToLower(value)
 
 	tm.criteria = append(tm.criteria, c)
 	return nil
@@ -206,13 +226,13 @@ func (tm *TagMatcher) matchCriterion(game *chess.Game, c *TagCriterion) bool {
 func (tm *TagMatcher) matchValue(tagValue string, c *TagCriterion) bool {
 	switch c.Operator {
 	case OpNone, OpEqual:
-		return strings.EqualFold(tagValue, c.Value)
+		return tm.textMatches(tagValue, c, tm.substringMatch)
 
 	case OpNotEqual:
-		return !strings.EqualFold(tagValue, c.Value)
+		return !tm.textMatches(tagValue, c, tm.substringMatch)
 
 	case OpContains:
-		return strings.Contains(strings.ToLower(tagValue), c.LowerValue)
+		return tm.textMatches(tagValue, c, !tm.exact)
 
 	case OpRegex:
 		if c.Regex == nil {
@@ -230,6 +250,28 @@ func (tm *TagMatcher) matchValue(tagValue string, c *TagCriterion) bool {
 	return false
 }
 
+// textMatches compares a tag value with a criterion value, ignoring case
+// unless the matcher is case-sensitive. A substring match finds the value
+// anywhere in the tag value, or only at its start when anchored.
+func (tm *TagMatcher) textMatches(tagValue string, c *TagCriterion, substring bool) bool {
+	value := c.Value
+	if !tm.caseSensitive {
+		tagValue, value = strings.ToLower(tagValue), c.LowerValue
+		if value == "" {
+			// Criteria built directly rather than by AddCriterion
+			value = strings.ToLower(c.Value)
+		}
+	}
+	switch {
+	case !substring:
+		return tagValue == value
+	case tm.anchored:
+		return strings.HasPrefix(tagValue, value)
+	default:
+		return strings.Contains(tagValue, value)
+	}
+}
+
 // compareValues compares values using relational operators.
 // Handles dates (YYYY.MM.DD) and numeric values.
 func (tm *TagMatcher) compareValues(tagValue, criterionValue string, op TagOperator) bool {
@@ -257,6 +257,47 @@ func TestTagMatcher_SubstringMatch(t *testing.T) {
 	}
 }
 
+func TestTagMatcher_TextMatchSettings(t *testing.T) {
+	tests := []struct {
+		name      string
+		op        TagOperator
+		value     string
+		substring bool
+		matchCase bool
+		anchored  bool
+		exact     bool
+		want      bool
+	}{
+		{"contains ignores case", OpContains, "carlsen", false, false, false, false, true},
+		{"contains with case", OpContains, "carlsen", false, true, false, false, false},
+		{"contains with matching case", OpContains, "Carlsen", false, true, false, false, true},
+		{"contains anywhere", OpContains, "Magnus", false, false, false, false, true},
+		{"anchored rejects later text", OpContains, "Magnus", false, false, true, false, false},
+		{"anchored accepts prefix", OpContains, "carl", false, false, true, false, true},
+		{"exact rejects part", OpContains, "Carlsen", false, false, false, true, false},
+		{"exact accepts whole", OpContains, "carlsen, magnus", false, false, false, true, true},
+		{"equal is whole by default", OpEqual, "Carlsen", false, false, false, false, false},
+		{"equal with substring", OpEqual, "Carlsen", true, false, false, false, true},
+		{"not equal with substring", OpNotEqual, "Carlsen", true, false, false, false, false},
+		{"equal with case", OpEqual, "carlsen, magnus", false, true, false, false, false},
+	}
+
+	game := &chess.Game{Tags: map[string]string{"White": "Carlsen, Magnus"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := NewTagMatcher()
+			tm.SetSubstringMatch(tt.substring)
+			tm.SetCaseSensitive(tt.matchCase)
+			tm.SetAnchored(tt.anchored)
+			tm.SetExactMatch(tt.exact)
+			tm.AddCriterion("White", tt.value, tt.op)
+			if got := tm.MatchGame(game); got != tt.want {
+				t.Errorf("MatchGame() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestTagMatcher_NumericComparison(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -0,0 +1,154 @@
+package matching
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+)
+
+// Termination is a value of the PGN standard's Termination tag.
+type Termination string
+
+// Terminations from the PGN standard.
+const (
+	TerminationUnknown         Termination = ""
+	TerminationNormal          Termination = "normal"
+	TerminationTimeForfeit     Termination = "time forfeit"
+	TerminationAbandoned       Termination = "abandoned"
+	TerminationAdjudication    Termination = "adjudication"
+	TerminationRulesInfraction Termination = "rules infraction"
+	TerminationUnterminated    Termination = "unterminated"
+)
+
+// allTerminations lists every named termination.
+var allTerminations = []Termination{
+	TerminationNormal, TerminationTimeForfeit, TerminationAbandoned,
+	TerminationAdjudication, TerminationRulesInfraction, TerminationUnterminated,
+}
+
+// ClassifyTermination maps a free-form Termination tag value, such as
+// Chess.com's "Black won on time", onto the standard vocabulary. It
+// returns TerminationUnknown for values it does not recognise.
+func ClassifyTermination(value string) Termination {
+	lower := strings.ToLower(value)
+	switch {
+	case lower == "":
+		return TerminationUnknown
+	case strings.Contains(lower, "abandon"):
+		return TerminationAbandoned
+	case strings.Contains(lower, "adjudicat"):
+		return TerminationAdjudication
+	case strings.Contains(lower, "rules infraction"), strings.Contains(lower, "fair play"):
+		return TerminationRulesInfraction
+	case strings.Contains(lower, "unterminated"):
+		return TerminationUnterminated
+	case strings.Contains(lower, "insufficient material"):
+		return TerminationNormal
+	case strings.Contains(lower, "on time"), strings.Contains(lower, "time forfeit"),
+		strings.Contains(lower, "timeout"):
+		return TerminationTimeForfeit
+	case strings.Contains(lower, "normal"), strings.Contains(lower, "resign"),
+		strings.Contains(lower, "checkmate"), strings.Contains(lower, "agreement"),
+		strings.Contains(lower, "repetition"), strings.Contains(lower, "stalemate"),
+		strings.Contains(lower, "50"):
+		return TerminationNormal
+	}
+	return TerminationUnknown
+}
+
+// commentTerminations are the phrases that servers and arbiters write in
+// the final comment of a game to say how it ended, checked in order.
+var commentTerminations = []struct {
+	phrase      string
+	termination Termination
+}{
+	{"abandon", TerminationAbandoned},
+	{"disconnect", TerminationAbandoned},
+	{"adjudicat", TerminationAdjudication},
+	{"forfeits on time", TerminationTimeForfeit},
+	{"lost on time", TerminationTimeForfeit},
+	{"won on time", TerminationTimeForfeit},
+	{"wins on time", TerminationTimeForfeit},
+	{"time forfeit", TerminationTimeForfeit},
+	{"ran out of time", TerminationTimeForfeit},
+	{"resign", TerminationNormal},
+	{"checkmate", TerminationNormal},
+	{"agreed", TerminationNormal},
+	{"repetition", TerminationNormal},
+	{"stalemate", TerminationNormal},
+}
+
+// commandPattern matches the [%...] commands embedded in comments, which
+// are not read as text.
+var commandPattern = regexp.MustCompile(`\[%[^\]]*\]`)
+
+// DeriveTermination returns how a game ended. A recognised Termination
+// tag is used as it is. Otherwise a game without a result is
+// unterminated, one ending in checkmate or stalemate ended normally,
+// and the comments after the last move are searched for how the game
+// was decided, such as "White forfeits on time". A finished game without
+// any of these ended normally, by resignation or agreement.
+func DeriveTermination(game *chess.Game) Termination {
+	if t := ClassifyTermination(game.GetTag("Termination")); t != TerminationUnknown {
+		return t
+	}
+	result := game.GetTag("Result")
+	if result != "1-0" && result != "0-1" && result != "1/2-1/2" {
+		return TerminationUnterminated
+	}
+
+	board := engine.NewBoardForGame(game)
+	var last *chess.Move
+	for move := game.Moves; move != nil; move = move.Next {
+		if !engine.ApplyMove(board, move) {
+			board = nil
+			break
+		}
+		last = move
+	}
+	if board != nil && (engine.IsCheckmate(board) || engine.IsStalemate(board)) {
+		return TerminationNormal
+	}
+
+	if last != nil {
+		for _, comment := range last.Comments {
+			text := strings.ToLower(commandPattern.ReplaceAllString(comment.Text, ""))
+			for _, ct := range commentTerminations {
+				if strings.Contains(text, ct.phrase) {
+					return ct.termination
+				}
+			}
+		}
+	}
+	return TerminationNormal
+}
+
+// ParseTerminations parses a comma-separated list of terminations. Words
+// may be joined by hyphens or underscores, as in "time-forfeit".
+func ParseTerminations(list string) (map[Termination]bool, error) {
+	result := make(map[Termination]bool)
+	for _, part := range strings.Split(list, ",") {
+		name := strings.NewReplacer("-", " ", "_", " ").Replace(strings.ToLower(strings.TrimSpace(part)))
+		if name == "" {
+			continue
+		}
+		if !isTermination(Termination(name)) {
+			return nil, fmt.Errorf("unknown termination %q", part)
+		}
+		result[Termination(name)] = true
+	}
+	return result, nil
+}
+
+// isTermination reports whether name is a known termination.
+func isTermination(name Termination) bool {
+	for _, t := range allTerminations {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package matching
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+	"github.com/lgbarn/pgn-extract-go/internal/parser"
+)
+
+func TestDeriveTermination(t *testing.T) {
+	tests := []struct {
+		name string
+		pgn  string
+		want Termination
+	}{
+		{"tag", `[Termination "Black won on time"] [Result "0-1"] 1. e4 e5 0-1`, TerminationTimeForfeit},
+		{"no result", `[Result "*"] 1. e4 e5 *`, TerminationUnterminated},
+		{"checkmate", `[Result "0-1"] 1. f3 e5 2. g4 Qh4# 0-1`, TerminationNormal},
+		{"time comment", `[Result "0-1"] 1. e4 e5 2. Nf3 {White forfeits on time} 0-1`, TerminationTimeForfeit},
+		{"comment command", `[Result "1-0"] 1. e4 e5 {[%clk 0:00:50]} 1-0`, TerminationNormal},
+		{"abandoned comment", `[Result "1-0"] 1. e4 e5 {Black disconnected} 1-0`, TerminationAbandoned},
+		{"resignation", `[Result "1-0"] 1. e4 e5 1-0`, TerminationNormal},
+		{"unrecognised tag", `[Termination "???"] [Result "1-0"] 1. e4 e5 {adjudicated} 1-0`, TerminationAdjudication},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game, err := parser.NewParser(strings.NewReader(tt.pgn), config.NewConfig()).ParseGame()
+			if err != nil || game == nil {
+				t.Fatalf("parsing %q: %v", tt.pgn, err)
+			}
+			if got := DeriveTermination(game); got != tt.want {
+				t.Errorf("DeriveTermination() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTerminations(t *testing.T) {
+	terminations, err := ParseTerminations("Time-forfeit, abandoned,rules_infraction")
+	if err != nil {
+		t.Fatalf("ParseTerminations failed: %v", err)
+	}
+	if !terminations[TerminationTimeForfeit] || !terminations[TerminationAbandoned] ||
+		!terminations[TerminationRulesInfraction] || len(terminations) != 3 {
+		t.Errorf("unexpected terminations: %v", terminations)
+	}
+
+	if _, err := ParseTerminations("normal,resigned"); err == nil {
+		t.Error("expected error for unknown termination")
+	}
+}
@@ -0,0 +1,179 @@
+package matching
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TimeClass is a coarse speed category derived from a TimeControl tag.
+type TimeClass string
+
+// Time classes, using the same boundaries as the major online platforms.
+const (
+	TimeClassUnknown        TimeClass = ""
+	TimeClassUltraBullet    TimeClass = "ultrabullet"
+	TimeClassBullet         TimeClass = "bullet"
+	TimeClassBlitz          TimeClass = "blitz"
+	TimeClassRapid          TimeClass = "rapid"
+	TimeClassClassical      TimeClass = "classical"
+	TimeClassCorrespondence TimeClass = "correspondence"
+)
+
+// allTimeClasses lists every named time class.
+var allTimeClasses = []TimeClass{
+	TimeClassUltraBullet, TimeClassBullet, TimeClassBlitz,
+	TimeClassRapid, TimeClassClassical, TimeClassCorrespondence,
+}
+
+// estimatedMoves is the game length used to weigh increments.
+const estimatedMoves = 40
+
+// correspondenceSeconds is the per-move allowance at which a control is correspondence.
+const correspondenceSeconds = 24 * 60 * 60
+
+// TimeControlStage is one period of a TimeControl tag.
+type TimeControlStage struct {
+	Moves     int // moves to make in this period (0 = rest of game)
+	Seconds   int // base time for the period
+	Increment int // seconds added per move
+	Sandclock bool
+}
+
+// TimeControl is a parsed PGN TimeControl tag value.
+type TimeControl struct {
+	Stages []TimeControlStage
+}
+
+// ParseTimeControl parses a TimeControl tag value such as "300+3",
+// "40/7200:3600+30" or "*180". It returns nil for "?" and "-".
+func ParseTimeControl(s string) (*TimeControl, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "?" || s == "-" {
+		return nil, nil
+	}
+
+	tc := &TimeControl{}
+	for _, field := range strings.Split(s, ":") {
+		stage, err := parseTimeControlStage(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time control %q: %w", s, err)
+		}
+		tc.Stages = append(tc.Stages, stage)
+	}
+	return tc, nil
+}
+
+// parseTimeControlStage parses a single period of a TimeControl value.
+func parseTimeControlStage(s string) (TimeControlStage, error) {
+	var stage TimeControlStage
+	s = strings.TrimSpace(s)
+
+	if strings.HasPrefix(s, "*") {
+		stage.Sandclock = true
+		s = s[1:]
+	}
+
+	if idx := strings.Index(s, "/"); idx >= 0 {
+		moves, err := strconv.Atoi(s[:idx])
+		if err != nil || moves <= 0 {
+			return stage, fmt.Errorf("bad move count %q", s[:idx])
+		}
+		stage.Moves = moves
+		s = s[idx+1:]
+	}
+
+	if idx := strings.Index(s, "+"); idx >= 0 {
+		inc, err := strconv.Atoi(s[idx+1:])
+		if err != nil || inc < 0 {
+			return stage, fmt.Errorf("bad increment %q", s[idx+1:])
+		}
+		stage.Increment = inc
+		s = s[:idx]
+	}
+
+	secs, err := strconv.Atoi(s)
+	if err != nil || secs < 0 {
+		return stage, fmt.Errorf("bad seconds %q", s)
+	}
+	stage.Seconds = secs
+	return stage, nil
+}
+
+// EstimatedSeconds returns the expected clock time per player for a
+// 40-move game: the first period's base time scaled to 40 moves plus
+// 40 increments.
+func (tc *TimeControl) EstimatedSeconds() int {
+	if tc == nil || len(tc.Stages) == 0 {
+		return 0
+	}
+	first := tc.Stages[0]
+	base := first.Seconds
+	if first.Moves > 0 {
+		base = first.Seconds * estimatedMoves / first.Moves
+	}
+	return base + estimatedMoves*first.Increment
+}
+
+// Class returns the time class of the control.
+func (tc *TimeControl) Class() TimeClass {
+	if tc == nil || len(tc.Stages) == 0 {
+		return TimeClassUnknown
+	}
+
+	first := tc.Stages[0]
+	if first.Moves > 0 && first.Seconds/first.Moves >= correspondenceSeconds {
+		return TimeClassCorrespondence
+	}
+
+	switch est := tc.EstimatedSeconds(); {
+	case est < 30:
+		return TimeClassUltraBullet
+	case est < 180:
+		return TimeClassBullet
+	case est < 480:
+		return TimeClassBlitz
+	case est < 1500:
+		return TimeClassRapid
+	case est < correspondenceSeconds:
+		return TimeClassClassical
+	default:
+		return TimeClassCorrespondence
+	}
+}
+
+// ClassifyTimeControl returns the time class of a TimeControl tag value,
+// or TimeClassUnknown if it is missing or malformed.
+func ClassifyTimeControl(s string) TimeClass {
+	tc, err := ParseTimeControl(s)
+	if err != nil {
+		return TimeClassUnknown
+	}
+	return tc.Class()
+}
+
+// ParseTimeClasses parses a comma-separated list of time class names.
+func ParseTimeClasses(list string) (map[TimeClass]bool, error) {
+	result := make(map[TimeClass]bool)
+	for _, part := range strings.Split(list, ",") {
+		name := TimeClass(strings.ToLower(strings.TrimSpace(part)))
+		if name == "" {
+			continue
+		}
+		if !isTimeClass(name) {
+			return nil, fmt.Errorf("unknown time class %q", part)
+		}
+		result[name] = true
+	}
+	return result, nil
+}
+
+// isTimeClass reports whether name is a known time class.
+func isTimeClass(name TimeClass) bool {
+	for _, tc := range allTimeClasses {
+		if tc == name {
+			return true
+		}
+	}
+	return false
+}
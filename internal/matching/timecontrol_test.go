@@ -0,0 +1,71 @@
+package matching
+
+import "testing"
+
+func TestClassifyTimeControl(t *testing.T) {
+	tests := []struct {
+		value string
+		want  TimeClass
+	}{
+		{"15", TimeClassUltraBullet},
+		{"60", TimeClassBullet},
+		{"120+1", TimeClassBullet},
+		{"180+2", TimeClassBlitz},
+		{"300", TimeClassBlitz},
+		{"600", TimeClassRapid},
+		{"900+10", TimeClassRapid},
+		{"1800", TimeClassClassical},
+		{"40/7200:3600", TimeClassClassical},
+		{"40/5400+30:1800+30", TimeClassClassical},
+		{"*180", TimeClassBlitz},
+		{"1/259200", TimeClassCorrespondence},
+		{"?", TimeClassUnknown},
+		{"-", TimeClassUnknown},
+		{"", TimeClassUnknown},
+		{"abc", TimeClassUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := ClassifyTimeControl(tt.value); got != tt.want {
+				t.Errorf("ClassifyTimeControl(%q) = %q; want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimeControl_Stages(t *testing.T) {
+	tc, err := ParseTimeControl("40/5400+30:1800+30")
+	if err != nil {
+		t.Fatalf("ParseTimeControl failed: %v", err)
+	}
+	if len(tc.Stages) != 2 {
+		t.Fatalf("expected 2 stages, got %d", len(tc.Stages))
+	}
+	first := tc.Stages[0]
+	if first.Moves != 40 || first.Seconds != 5400 || first.Increment != 30 {
+		t.Errorf("unexpected first stage: %+v", first)
+	}
+	second := tc.Stages[1]
+	if second.Moves != 0 || second.Seconds != 1800 || second.Increment != 30 {
+		t.Errorf("unexpected second stage: %+v", second)
+	}
+
+	if _, err := ParseTimeControl("40/abc"); err == nil {
+		t.Error("expected error for malformed time control")
+	}
+}
+
+func TestParseTimeClasses(t *testing.T) {
+	classes, err := ParseTimeClasses("Blitz, rapid")
+	if err != nil {
+		t.Fatalf("ParseTimeClasses failed: %v", err)
+	}
+	if !classes[TimeClassBlitz] || !classes[TimeClassRapid] || len(classes) != 2 {
+		t.Errorf("unexpected classes: %v", classes)
+	}
+
+	if _, err := ParseTimeClasses("blitz,lightning"); err == nil {
+		t.Error("expected error for unknown time class")
+	}
+}
@@ -147,7 +147,7 @@ func (vm *VariationMatcher) matchPositionSequence(game *chess.Game, seq []string
 		return true
 	}
 
-	board := engine.MustBoardFromFEN(engine.InitialFEN)
+	board := engine.NewInitialBoard()
 	seqIdx := 0
 
 	// Check initial position
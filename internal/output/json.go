@@ -9,14 +9,31 @@ import (
 	"github.com/lgbarn/pgn-extract-go/internal/engine"
 )
 
-// JSONGame represents a game in JSON format.
+// JSONGame represents a game in JSON format. The fields after Result are
+// computed from the game, whatever its tags say, except ECO and Opening,
+// which come from the tags ECO classification sets.
 type JSONGame struct {
-	Tags       map[string]string `json:"tags"`
-	Moves      []JSONMove        `json:"moves,omitempty"`
-	Result     string            `json:"result,omitempty"`
-	PlyCount   int               `json:"plyCount,omitempty"`
-	FinalFEN   string            `json:"finalFEN,omitempty"`
-	InitialFEN string            `json:"initialFEN,omitempty"`
+	Tags          map[string]string `json:"tags"`
+	Moves         []JSONMove        `json:"moves,omitempty"`
+	Result        string            `json:"result,omitempty"`
+	ECO           string            `json:"eco,omitempty"`
+	Opening       string            `json:"opening,omitempty"`
+	PlyCount      int               `json:"plyCount"`
+	FinalFEN      string            `json:"finalFEN"`
+	HasVariations bool              `json:"hasVariations"`
+	HasComments   bool              `json:"hasComments"`
+	InitialFEN    string            `json:"initialFEN,omitempty"`
+	*JSONSource
+}
+
+// JSONSource locates a game's text in the input it was read from, so that
+// the original can be fetched again. Its fields appear at the top level of
+// a game, and only for games read from an input file.
+type JSONSource struct {
+	File       string `json:"sourceFile"`
+	GameIndex  int    `json:"gameIndex"`  // 1-based number of the game in the file
+	ByteOffset int64  `json:"byteOffset"` // start of the game's first line
+	ByteLength int64  `json:"byteLength"` // bytes up to the end of its last line
 }
 
 // JSONMove represents a move in JSON format.
@@ -32,6 +49,10 @@ type JSONMove struct {
 	Promotion  string       `json:"promotion,omitempty"`
 	NAGs       []string     `json:"nags,omitempty"`
 	Comments   []string     `json:"comments,omitempty"`
+	Clock      *float64     `json:"clock,omitempty"`   // seconds left, from [%clk]
+	Elapsed    *float64     `json:"elapsed,omitempty"` // seconds spent, from [%emt]
+	Eval       *float64     `json:"eval,omitempty"`    // pawns from White's view, from [%eval]
+	Mate       int          `json:"mate,omitempty"`    // mate in N from [%eval #N], negative for Black
 	Variations [][]JSONMove `json:"variations,omitempty"`
 	FEN        string       `json:"fen,omitempty"`
 }
@@ -71,8 +92,10 @@ func GameToJSON(game *chess.Game, cfg *config.Config) *JSONGame {
 	board, initialFEN := getInitialBoard(game)
 	jg.InitialFEN = initialFEN
 
+	fenOpts := fenOptions(game, board, cfg)
+
 	// Convert moves and count plies
-	jg.Moves = convertMoveList(game.Moves, board, cfg, true)
+	jg.Moves = convertMoveList(game.Moves, board, cfg, &fenOpts)
 	jg.PlyCount = countPlies(game.Moves)
 
 	// Get result
@@ -82,9 +105,20 @@ func GameToJSON(game *chess.Game, cfg *config.Config) *JSONGame {
 		jg.Result = "*"
 	}
 
-	// Final FEN if requested
-	if cfg.Annotation.OutputFEN {
-		jg.FinalFEN = engine.BoardToFEN(board)
+	// The board has followed the main line to its end
+	jg.FinalFEN = engine.BoardToFEN(board, fenOpts)
+	jg.ECO = game.GetTag("ECO")
+	jg.Opening = game.GetTag("Opening")
+	jg.HasVariations = hasVariations(game.Moves)
+	jg.HasComments = len(game.PrefixComment) > 0 || hasComments(game.Moves)
+
+	if game.SourceIndex > 0 {
+		jg.JSONSource = &JSONSource{
+			File:       game.SourceFile,
+			GameIndex:  game.SourceIndex,
+			ByteOffset: game.StartOffset,
+			ByteLength: game.EndOffset - game.StartOffset,
+		}
 	}
 
 	return jg
@@ -124,9 +158,35 @@ func countPlies(moves *chess.Move) int {
 	return count
 }
 
+// hasVariations reports whether any move of a move list has variations.
+func hasVariations(moves *chess.Move) bool {
+	for move := moves; move != nil; move = move.Next {
+		if move.HasVariations() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasComments reports whether a move list, or any of its variations, has
+// comments.
+func hasComments(moves *chess.Move) bool {
+	for move := moves; move != nil; move = move.Next {
+		if move.HasComments() {
+			return true
+		}
+		for _, v := range move.Variations {
+			if len(v.PrefixComment) > 0 || len(v.SuffixComment) > 0 || hasComments(v.Moves) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // convertMoveList converts a move list to JSON format.
-// The includeFEN parameter controls whether FEN is added after each move.
-func convertMoveList(moves *chess.Move, board *chess.Board, cfg *config.Config, includeFEN bool) []JSONMove {
+// A non-nil fenOpts adds the FEN after each move, written with those options.
+func convertMoveList(moves *chess.Move, board *chess.Board, cfg *config.Config, fenOpts *engine.FENOptions) []JSONMove {
 	result := make([]JSONMove, 0, 80) // Preallocate for typical game length
 
 	moveNum := board.MoveNumber
@@ -134,10 +194,14 @@ func convertMoveList(moves *chess.Move, board *chess.Board, cfg *config.Config,
 
 	for move := moves; move != nil; move = move.Next {
 		jm := convertSingleMove(move, board, cfg, moveNum, isWhite)
+		if len(result) == 0 && !isWhite {
+			// A line starting with Black's move is numbered like "37..."
+			jm.MoveNumber = int(moveNum)
+		}
 
 		// Add FEN after move if requested (only for main line)
-		if includeFEN && cfg.Annotation.AddFENComments {
-			jm.FEN = engine.BoardToFEN(board)
+		if fenOpts != nil && fenCommentAt(cfg.Annotation, len(result)+1) {
+			jm.FEN = engine.BoardToFEN(board, *fenOpts)
 		}
 
 		result = append(result, jm)
@@ -186,13 +250,14 @@ func convertSingleMove(move *chess.Move, board *chess.Board, cfg *config.Config,
 
 	// NAGs
 	if cfg.Output.KeepNAGs {
-		jm.NAGs = collectNAGs(move)
+		jm.NAGs = collectNAGs(move, board.ToMove == chess.White, cfg.Output.NAGStyle)
 	}
 
 	// Comments
 	if cfg.Output.KeepComments {
 		jm.Comments = collectComments(move)
 	}
+	setCommandFields(&jm, move.Commands, cfg)
 
 	// Variations
 	if cfg.Output.KeepVariations {
@@ -205,6 +270,25 @@ func convertSingleMove(move *chess.Move, board *chess.Board, cfg *config.Config,
 	return jm
 }
 
+// setCommandFields copies a move's [%clk], [%emt] and [%eval] commands,
+// which are kept even without the comments. Stripping clock annotations
+// drops the clock.
+func setCommandFields(jm *JSONMove, c chess.MoveCommands, cfg *config.Config) {
+	if c.HasClock && !cfg.Output.StripClockAnnotations {
+		seconds := c.Clock.Seconds()
+		jm.Clock = &seconds
+	}
+	if c.HasElapsed {
+		seconds := c.Elapsed.Seconds()
+		jm.Elapsed = &seconds
+	}
+	if c.HasEval && c.Mate == 0 {
+		eval := c.Eval
+		jm.Eval = &eval
+	}
+	jm.Mate = c.Mate
+}
+
 // colorName returns "white" or "black" based on the boolean.
 func colorName(isWhite bool) string {
 	if isWhite {
@@ -225,14 +309,16 @@ func getCapturedPiece(move *chess.Move, board *chess.Board) string {
 	return ""
 }
 
-// collectNAGs collects all NAG strings from a move.
-func collectNAGs(move *chess.Move) []string {
+// collectNAGs collects all NAG strings from a move, in the given style.
+func collectNAGs(move *chess.Move, white bool, style config.NAGStyle) []string {
 	if len(move.NAGs) == 0 {
 		return nil
 	}
 	var result []string
 	for _, nag := range move.NAGs {
-		result = append(result, nag.Text...)
+		for _, text := range nag.Text {
+			result = append(result, styleNAG(text, white, style))
+		}
 	}
 	return result
 }
@@ -256,7 +342,7 @@ func convertVariationsJSON(variations []*chess.Variation, board *chess.Board, cf
 	}
 	var result [][]JSONMove
 	for _, v := range variations {
-		varMoves := convertMoveList(v.Moves, board.Copy(), cfg, false)
+		varMoves := convertMoveList(v.Moves, board.Copy(), cfg, nil)
 		if len(varMoves) > 0 {
 			result = append(result, varMoves)
 		}
@@ -2,10 +2,13 @@
 package output
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
 	"github.com/lgbarn/pgn-extract-go/internal/config"
@@ -72,15 +75,56 @@ func (o *OutputWriter) NewLine() {
 	o.needsSpace = false
 }
 
-// OutputGame outputs a game in the configured format.
+// bufferPool holds the buffers games are rendered into. Being a sync.Pool
+// it keeps a buffer per processor, so parallel workers rarely share one.
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// GetBuffer returns an empty buffer to render a game into with RenderGame.
+func GetBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// PutBuffer returns a buffer from GetBuffer once its contents are written.
+func PutBuffer(buf *bytes.Buffer) {
+	bufferPool.Put(buf)
+}
+
+// OutputGame outputs a game in the configured format to cfg.OutputFile,
+// rendering it first so that it reaches the file in a single write.
 func OutputGame(game *chess.Game, cfg *config.Config) {
-	w := cfg.OutputFile
+	buf := GetBuffer()
+	RenderGame(buf, game, cfg)
+	cfg.OutputFile.Write(buf.Bytes()) //nolint:errcheck,gosec // output errors are not reported per game
+	PutBuffer(buf)
+}
 
-	// Output tags
-	outputTags(game, cfg, w)
+// RenderGame writes a game in the configured format to buf. It does not
+// touch cfg.OutputFile, so workers can render games concurrently and leave
+// writing them to the goroutine that owns the output.
+func RenderGame(buf *bytes.Buffer, game *chess.Game, cfg *config.Config) {
+	w := buf
 
-	// Blank line between tags and moves
-	fmt.Fprintln(w)
+	if cfg.Output.Format == config.EPD || cfg.Output.Format == config.FEN {
+		outputPositions(game, cfg, w)
+		return
+	}
+
+	if cfg.Output.TagsOnly {
+		outputTags(game, cfg, w)
+		fmt.Fprintln(w)
+		return
+	}
+
+	if !cfg.Output.MovesOnly {
+		outputTags(game, cfg, w)
+
+		// Blank line between tags and moves
+		fmt.Fprintln(w)
+	}
 
 	// Output moves
 	outputMoves(game, cfg, w)
@@ -89,6 +133,77 @@ func OutputGame(game *chess.Game, cfg *config.Config) {
 	fmt.Fprintln(w)
 }
 
+// outputPositions writes one EPD or FEN line for each position of the
+// main line, followed by a blank line. EPD records carry id and c0
+// operations naming the game, and with --epd-bm the move played as bm.
+func outputPositions(game *chess.Game, cfg *config.Config, w io.Writer) {
+	board := engine.NewBoardForGame(game)
+	opts := fenOptions(game, board, cfg)
+	opts.EPD = cfg.Output.Format == config.EPD
+
+	ply := 0
+	for move := game.Moves; ; move = move.Next {
+		if opts.EPD {
+			opts.Operations = epdOperations(game, board, ply, move, cfg)
+		}
+		fmt.Fprintln(w, engine.BoardToFEN(board, opts))
+		if move == nil || !engine.ApplyMove(board, move) {
+			break
+		}
+		ply++
+	}
+
+	fmt.Fprintln(w)
+}
+
+// epdOperations returns the operations for the position on board after
+// ply plies, from which next is played: bm with the move played in SAN
+// when requested and it is a legal move, id with the event, game number
+// and ply, and c0 with the players.
+func epdOperations(game *chess.Game, board *chess.Board, ply int, next *chess.Move, cfg *config.Config) []engine.EPDOperation {
+	var ops []engine.EPDOperation
+	if cfg.Output.EPDBestMove && next != nil && next.Class != chess.NullMove && engine.MoveProblem(board, next) == "" {
+		// SAN needs the from square, which SAN input leaves out
+		played := *next
+		played.FromCol, played.FromRank = findSourceFromMove(&played, board)
+		ops = append(ops, engine.EPDOperation{Opcode: "bm", Operands: []string{engine.SAN(board, &played)}})
+	}
+
+	var id []string
+	if event := game.GetTag("Event"); event != "" && event != "?" {
+		id = append(id, event)
+	}
+	if game.SourceIndex > 0 {
+		id = append(id, fmt.Sprintf("game %d", game.SourceIndex))
+	}
+	id = append(id, fmt.Sprintf("ply %d", ply))
+	ops = append(ops, engine.EPDOperation{Opcode: "id", Operands: []string{engine.EPDString(strings.Join(id, ", "))}})
+
+	white, black := game.GetTag("White"), game.GetTag("Black")
+	if white != "" || black != "" {
+		players := orUnknown(white) + " - " + orUnknown(black)
+		ops = append(ops, engine.EPDOperation{Opcode: "c0", Operands: []string{engine.EPDString(players)}})
+	}
+	return ops
+}
+
+// orUnknown returns "?" for an empty tag value.
+func orUnknown(value string) string {
+	if value == "" {
+		return "?"
+	}
+	return value
+}
+
+// fenOptions returns the options for writing positions of a game starting
+// from initial, using Shredder castling for Chess960 games and in
+// --chess960 mode.
+func fenOptions(game *chess.Game, initial *chess.Board, cfg *config.Config) engine.FENOptions {
+	opts := engine.FENOptionsForGame(game, initial)
+	opts.Shredder = opts.Shredder || cfg.Chess960Mode
+	return opts
+}
+
 // outputTags outputs the game tags.
 func outputTags(game *chess.Game, cfg *config.Config, w io.Writer) {
 	if cfg.Output.TagFormat == config.NoTags {
@@ -104,13 +219,18 @@ func outputTags(game *chess.Game, cfg *config.Config, w io.Writer) {
 		fmt.Fprintf(w, "[%s \"%s\"]\n", tag, escapeTagValue(value))
 	}
 
-	// Output additional tags if not restricted to seven tag roster
+	// Output additional tags, in name order, if not restricted to seven tag roster
 	if cfg.Output.TagFormat != config.SevenTagRoster {
-		for tag, value := range game.Tags {
+		extra := make([]string, 0, len(game.Tags))
+		for tag := range game.Tags {
 			if !chess.IsSevenTagRosterTag(tag) {
-				fmt.Fprintf(w, "[%s \"%s\"]\n", tag, escapeTagValue(value))
+				extra = append(extra, tag)
 			}
 		}
+		sort.Strings(extra)
+		for _, tag := range extra {
+			fmt.Fprintf(w, "[%s \"%s\"]\n", tag, escapeTagValue(game.Tags[tag]))
+		}
 	}
 }
 
@@ -131,9 +251,18 @@ func outputMoves(game *chess.Game, cfg *config.Config, w io.Writer) {
 
 	// Start with initial position or FEN
 	board := engine.NewBoardForGame(game)
+	fenOpts := fenOptions(game, board, cfg)
 
 	moveNum := board.MoveNumber
 	isWhite := board.ToMove == chess.White
+	ply := 0
+
+	// Output comments that precede the first move
+	if cfg.Output.KeepComments {
+		for _, comment := range game.PrefixComment {
+			outputComment(comment, cfg, ow, false)
+		}
+	}
 
 	for move := game.Moves; move != nil; move = move.Next {
 		// Output move number
@@ -147,13 +276,13 @@ func outputMoves(game *chess.Game, cfg *config.Config, w io.Writer) {
 		}
 
 		// Output the move in the configured format
-		moveText := formatMove(move, board, cfg.Output.Format)
-		ow.Write(moveText)
+		ow.Write(formatOutputMove(move, board, cfg.Output))
 
 		// Output NAGs
 		if cfg.Output.KeepNAGs && len(move.NAGs) > 0 {
-			outputNAGs(move, ow)
+			outputNAGs(move, board.ToMove == chess.White, cfg, ow)
 		}
+		outputUCIComment(move, board, cfg.Output, ow)
 
 		// Output comments
 		if cfg.Output.KeepComments {
@@ -162,6 +291,15 @@ func outputMoves(game *chess.Game, cfg *config.Config, w io.Writer) {
 			}
 		}
 
+		// Output the position reached as a FEN comment
+		ply++
+		if fenCommentAt(cfg.Annotation, ply) {
+			after := board.Copy()
+			if engine.ApplyMove(after, move) {
+				ow.Write("{" + engine.BoardToFEN(after, fenOpts) + "}")
+			}
+		}
+
 		// Output variations
 		if cfg.Output.KeepVariations {
 			outputVariations(move.Variations, board, cfg, ow)
@@ -198,12 +336,28 @@ func getGameResult(game *chess.Game) string {
 	return "*"
 }
 
+// fenCommentAt reports whether a FEN comment follows the main-line move
+// at ply, counted from the first move of the game.
+func fenCommentAt(a *config.AnnotationConfig, ply int) bool {
+	if !a.AddFENComments {
+		return false
+	}
+	if a.FENCommentEvery <= 0 && len(a.FENCommentPlies) == 0 {
+		return true
+	}
+	return a.FENCommentEvery > 0 && ply%a.FENCommentEvery == 0 || a.FENCommentPlies[ply]
+}
+
 // outputComment writes a comment, optionally stripping clock annotations.
 func outputComment(comment *chess.Comment, cfg *config.Config, ow *OutputWriter, useNoSpace bool) {
 	text := comment.Text
 	if cfg.Output.StripClockAnnotations {
 		text = stripClockAnnotations(text)
 	}
+	if cfg.Output.StableOutput {
+		// Comments spanning lines of a CRLF file keep their CRs
+		text = strings.ReplaceAll(text, "\r", "")
+	}
 	if text == "" {
 		return
 	}
@@ -215,13 +369,50 @@ func outputComment(comment *chess.Comment, cfg *config.Config, ow *OutputWriter,
 	}
 }
 
-// outputNAGs writes NAGs for a move.
-func outputNAGs(move *chess.Move, ow *OutputWriter) {
+// outputNAGs writes NAGs for a move, with the comments that follow them,
+// in the configured style; white says whether White made the move.
+// Symbolic output attaches the first move judgement to the move, as in
+// "e4!", and writes the other glyphs as comments, so that any PGN reader
+// accepts them.
+func outputNAGs(move *chess.Move, white bool, cfg *config.Config, ow *OutputWriter) {
+	attached := false
 	for _, nag := range move.NAGs {
 		for _, text := range nag.Text {
-			ow.Write(text)
+			text = styleNAG(text, white, cfg.Output.NAGStyle)
+			switch {
+			case cfg.Output.NAGStyle != config.SymbolicNAGs || strings.HasPrefix(text, "$"):
+				ow.Write(text)
+			case chess.IsMoveGlyph(text) && !attached:
+				ow.WriteNoSpace(text)
+				attached = true
+			case chess.IsMoveGlyph(text):
+				ow.Write(text)
+			default:
+				ow.Write("{" + text + "}")
+			}
+		}
+		if cfg.Output.KeepComments {
+			for _, comment := range nag.Comments {
+				outputComment(comment, cfg, ow, false)
+			}
+		}
+	}
+}
+
+// styleNAG converts a NAG's text, a $-code or a glyph, to the given
+// style. Texts with no conversion are returned unchanged.
+func styleNAG(text string, white bool, style config.NAGStyle) string {
+	switch style {
+	case config.NumericNAGs:
+		if code, ok := chess.GlyphNAG(text, white); ok {
+			return code
+		}
+	case config.SymbolicNAGs:
+		if glyph, ok := chess.NAGGlyph(text); ok {
+			return glyph
 		}
 	}
+	return text
 }
 
 // outputVariations outputs all variations for a move.
@@ -261,12 +452,13 @@ func outputVariation(variation *chess.Variation, board *chess.Board, cfg *config
 		first = false
 
 		// Output the move
-		ow.Write(formatMove(move, board, cfg.Output.Format))
+		ow.Write(formatOutputMove(move, board, cfg.Output))
 
 		// Output NAGs
 		if cfg.Output.KeepNAGs && len(move.NAGs) > 0 {
-			outputNAGs(move, ow)
+			outputNAGs(move, board.ToMove == chess.White, cfg, ow)
 		}
+		outputUCIComment(move, board, cfg.Output, ow)
 
 		// Output comments
 		if cfg.Output.KeepComments {
@@ -318,6 +510,23 @@ func getVariationResult(variation *chess.Variation) string {
 	return lastMove.TerminatingResult
 }
 
+// formatOutputMove formats a move for the output configuration. SANUCI
+// output pairs the SAN and UCI moves when a separator is set.
+func formatOutputMove(move *chess.Move, board *chess.Board, out *config.OutputConfig) string {
+	if out.Format == config.SANUCI && out.SANUCISeparator != "" {
+		return move.Text + out.SANUCISeparator + formatUCI(move, board)
+	}
+	return formatMove(move, board, out.Format)
+}
+
+// outputUCIComment writes the UCI move as a comment after the move in
+// SANUCI output without a separator.
+func outputUCIComment(move *chess.Move, board *chess.Board, out *config.OutputConfig, ow *OutputWriter) {
+	if out.Format == config.SANUCI && out.SANUCISeparator == "" {
+		ow.Write("{uci: " + formatUCI(move, board) + "}")
+	}
+}
+
 // formatMove formats a move in the specified notation.
 func formatMove(move *chess.Move, board *chess.Board, format config.OutputFormat) string {
 	switch format {
@@ -427,40 +636,16 @@ func formatUCI(move *chess.Move, board *chess.Board) string {
 
 // findSourceFromMove attempts to find the source square from a move.
 func findSourceFromMove(move *chess.Move, board *chess.Board) (chess.Col, chess.Rank) {
-	// This is a simplified version - the engine has more complete logic
 	if move.FromCol != 0 && move.FromRank != 0 {
 		return move.FromCol, move.FromRank
 	}
 
-	colour := board.ToMove
-	pieceType := move.PieceToMove
-	toCol := move.ToCol
-	toRank := move.ToRank
-
-	if pieceType == chess.Empty || pieceType == chess.Pawn {
+	if pieceType := move.PieceToMove; pieceType == chess.Empty || pieceType == chess.Pawn {
 		// Pawn move
-		return findPawnSource(board, move, colour)
-	}
-
-	// Piece move - search for the piece
-	piece := chess.MakeColouredPiece(colour, pieceType)
-	for col := chess.Col('a'); col <= 'h'; col++ {
-		for rank := chess.Rank('1'); rank <= '8'; rank++ {
-			if board.Get(col, rank) == piece {
-				if move.FromCol != 0 && col != move.FromCol {
-					continue
-				}
-				if move.FromRank != 0 && rank != move.FromRank {
-					continue
-				}
-				if canPieceReach(pieceType, col, rank, toCol, toRank, board) {
-					return col, rank
-				}
-			}
-		}
+		return findPawnSource(board, move, board.ToMove)
 	}
 
-	return 0, 0
+	return engine.PieceSource(board, move)
 }
 
 // findPawnSource finds the source of a pawn move.
@@ -497,80 +682,3 @@ func findPawnSource(board *chess.Board, move *chess.Move, colour chess.Colour) (
 
 	return 0, 0
 }
-
-// canPieceReach checks if a piece can reach a square.
-func canPieceReach(pieceType chess.Piece, fromCol chess.Col, fromRank chess.Rank, toCol chess.Col, toRank chess.Rank, board *chess.Board) bool {
-	colDiff := abs(int(toCol) - int(fromCol))
-	rankDiff := abs(int(toRank) - int(fromRank))
-
-	switch pieceType {
-	case chess.Knight:
-		return (colDiff == 1 && rankDiff == 2) || (colDiff == 2 && rankDiff == 1)
-	case chess.Bishop:
-		return colDiff == rankDiff && isDiagonalClear(board, fromCol, fromRank, toCol, toRank)
-	case chess.Rook:
-		return (colDiff == 0 || rankDiff == 0) && isStraightClear(board, fromCol, fromRank, toCol, toRank)
-	case chess.Queen:
-		if colDiff == rankDiff {
-			return isDiagonalClear(board, fromCol, fromRank, toCol, toRank)
-		}
-		if colDiff == 0 || rankDiff == 0 {
-			return isStraightClear(board, fromCol, fromRank, toCol, toRank)
-		}
-		return false
-	case chess.King:
-		return colDiff <= 1 && rankDiff <= 1
-	}
-	return false
-}
-
-func isDiagonalClear(board *chess.Board, fromCol chess.Col, fromRank chess.Rank, toCol chess.Col, toRank chess.Rank) bool {
-	colDir := sign(int(toCol) - int(fromCol))
-	rankDir := sign(int(toRank) - int(fromRank))
-
-	col := chess.Col(int(fromCol) + colDir)
-	rank := chess.Rank(int(fromRank) + rankDir)
-
-	for col != toCol {
-		if board.Get(col, rank) != chess.Empty {
-			return false
-		}
-		col = chess.Col(int(col) + colDir)
-		rank = chess.Rank(int(rank) + rankDir)
-	}
-	return true
-}
-
-func isStraightClear(board *chess.Board, fromCol chess.Col, fromRank chess.Rank, toCol chess.Col, toRank chess.Rank) bool {
-	colDir := sign(int(toCol) - int(fromCol))
-	rankDir := sign(int(toRank) - int(fromRank))
-
-	col := chess.Col(int(fromCol) + colDir)
-	rank := chess.Rank(int(fromRank) + rankDir)
-
-	for col != toCol || rank != toRank {
-		if board.Get(col, rank) != chess.Empty {
-			return false
-		}
-		col = chess.Col(int(col) + colDir)
-		rank = chess.Rank(int(rank) + rankDir)
-	}
-	return true
-}
-
-func abs(x int) int {
-	if x < 0 {
-		return -x
-	}
-	return x
-}
-
-func sign(x int) int {
-	if x > 0 {
-		return 1
-	}
-	if x < 0 {
-		return -1
-	}
-	return 0
-}
@@ -0,0 +1,45 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+	"github.com/lgbarn/pgn-extract-go/internal/testutil"
+)
+
+// TestOutputGame_PrefixComment checks that a comment before the first move
+// is written back out, and dropped along with the others by -C.
+func TestOutputGame_PrefixComment(t *testing.T) {
+	const tags = `[Event "Test"]
+[Site "Test"]
+[Date "2024.01.01"]
+[Round "1"]
+[White "A"]
+[Black "B"]
+[Result "*"]
+
+`
+	game := testutil.ParseTestGame(tags + "{A quiet opening} 1. e4 e5 {as usual} *\n")
+
+	tests := []struct {
+		name         string
+		keepComments bool
+		want         string
+	}{
+		{"kept", true, tags + "{A quiet opening} 1. e4 e5 {as usual} *\n\n"},
+		{"stripped", false, tags + "1. e4 e5 *\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			cfg := config.NewConfig()
+			cfg.SetOutput(&buf)
+			cfg.Output.KeepComments = tt.keepComments
+			OutputGame(game, cfg)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/hashing"
+	"github.com/lgbarn/pgn-extract-go/internal/parser"
+)
+
+// VerifyRoundTrip writes a game as OutputGame would, parses the text back
+// and checks that it holds the same game: exactly one game, the tags that
+// were meant to be written, and main-line moves reaching the same
+// positions, compared by hash. With variations kept their move counts must
+// agree too. It returns the first difference found. JSON, EPD and FEN
+// output, SAN+UCI pairs and tags without moves are not PGN games and are
+// not checked.
+func VerifyRoundTrip(game *chess.Game, cfg *config.Config) error {
+	if cfg.Output.JSONFormat || cfg.Output.Format == config.EPD || cfg.Output.Format == config.FEN || cfg.Output.TagsOnly {
+		return nil
+	}
+	if cfg.Output.Format == config.SANUCI && cfg.Output.SANUCISeparator != "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	written := *cfg
+	written.OutputFile = &buf
+	OutputGame(game, &written)
+
+	parseCfg := config.NewConfig()
+	parseCfg.LogFile = io.Discard
+	parseCfg.AllowNestedComments = cfg.AllowNestedComments
+	games, err := parser.NewParser(bytes.NewReader(buf.Bytes()), parseCfg).ParseAllGames()
+	if err != nil {
+		return fmt.Errorf("output does not parse: %w", err)
+	}
+	if len(games) != 1 {
+		return fmt.Errorf("output parses as %d games", len(games))
+	}
+	reparsed := games[0]
+
+	if err := compareTags(game, reparsed, cfg.Output.TagFormat); err != nil {
+		return err
+	}
+	if err := compareMainLine(game, reparsed); err != nil {
+		return err
+	}
+	if cfg.Output.KeepVariations {
+		if want, got := countLineMoves(game.Moves), countLineMoves(reparsed.Moves); want != got {
+			return fmt.Errorf("%d moves including variations written, %d read back", want, got)
+		}
+	}
+	return nil
+}
+
+// compareTags checks that the tags read back are those written for the
+// tag format. Missing roster tags are written as "?".
+func compareTags(game, reparsed *chess.Game, format config.TagOutputForm) error {
+	if format == config.NoTags {
+		return nil
+	}
+	want := make(map[string]string)
+	for _, tag := range chess.SevenTagRoster {
+		want[tag] = "?"
+	}
+	for tag, value := range game.Tags {
+		if format == config.AllTags || chess.IsSevenTagRosterTag(tag) {
+			if value != "" || !chess.IsSevenTagRosterTag(tag) {
+				want[tag] = value
+			}
+		}
+	}
+	for tag, value := range want {
+		if got, ok := reparsed.Tags[tag]; !ok {
+			return fmt.Errorf("tag %s lost", tag)
+		} else if got != value {
+			return fmt.Errorf("tag %s written as %q, read back as %q", tag, value, got)
+		}
+	}
+	for tag := range reparsed.Tags {
+		if _, ok := want[tag]; !ok {
+			return fmt.Errorf("tag %s read back but not in the game", tag)
+		}
+	}
+	return nil
+}
+
+// compareMainLine replays both main lines and compares the position hash
+// after each move. A move the original cannot play ends the comparison,
+// as the output then holds the same unplayable text.
+func compareMainLine(game, reparsed *chess.Game) error {
+	board := engine.NewBoardForGame(game)
+	reboard := engine.NewBoardForGame(reparsed)
+	if hashing.GenerateZobristHash(board) != hashing.GenerateZobristHash(reboard) {
+		return fmt.Errorf("starting position differs")
+	}
+
+	move, reread := game.Moves, reparsed.Moves
+	for ply := 1; move != nil; ply++ {
+		if reread == nil {
+			return fmt.Errorf("moves lost from ply %d", ply)
+		}
+		if !engine.ApplyMove(board, move) {
+			return nil
+		}
+		if !engine.ApplyMove(reboard, reread) ||
+			hashing.GenerateZobristHash(board) != hashing.GenerateZobristHash(reboard) {
+			return fmt.Errorf("ply %d: %s written, %s read back", ply, move.Text, reread.Text)
+		}
+		move, reread = move.Next, reread.Next
+	}
+	if reread != nil {
+		return fmt.Errorf("extra moves read back after the last move")
+	}
+	return nil
+}
+
+// countLineMoves counts the moves of a line and of all its variations.
+func countLineMoves(moves *chess.Move) int {
+	count := 0
+	for move := moves; move != nil; move = move.Next {
+		count++
+		for _, variation := range move.Variations {
+			count += countLineMoves(variation.Moves)
+		}
+	}
+	return count
+}
@@ -0,0 +1,58 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+	"github.com/lgbarn/pgn-extract-go/internal/parser"
+	"github.com/lgbarn/pgn-extract-go/internal/testutil"
+)
+
+// TestVerifyRoundTripTestdata checks that games from the test corpus come
+// back unchanged from SAN and long algebraic output.
+func TestVerifyRoundTripTestdata(t *testing.T) {
+	files := []string{"fischer.pgn", "najdorf.pgn", "petrosian.pgn", "test-promotion-in.pgn"}
+	for _, format := range []config.OutputFormat{config.SAN, config.LALG} {
+		for _, name := range files {
+			data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "infiles", name))
+			if err != nil {
+				t.Fatalf("reading %s: %v", name, err)
+			}
+			cfg := config.NewConfig()
+			cfg.Output.Format = format
+			games, err := parser.NewParser(strings.NewReader(string(data)), cfg).ParseAllGames()
+			if err != nil || len(games) == 0 {
+				t.Fatalf("parsing %s: %d games, %v", name, len(games), err)
+			}
+			for _, game := range games {
+				if err := VerifyRoundTrip(game, cfg); err != nil {
+					t.Errorf("%s (format %d), game at line %d: %v", name, format, game.StartLine, err)
+				}
+			}
+		}
+	}
+}
+
+func TestVerifyRoundTripDetectsLoss(t *testing.T) {
+	game := testutil.ParseTestGame(`
+[Event "Study"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"]
+[Result "*"]
+
+1. e4 Kd7 *
+`)
+	cfg := config.NewConfig()
+	if err := VerifyRoundTrip(game, cfg); err != nil {
+		t.Fatalf("VerifyRoundTrip() = %v, want nil", err)
+	}
+
+	cfg.Output.TagFormat = config.SevenTagRoster
+	err := VerifyRoundTrip(game, cfg)
+	if err == nil || !strings.Contains(err.Error(), "starting position") {
+		t.Errorf("VerifyRoundTrip() without the FEN tag = %v, want starting position error", err)
+	}
+}
@@ -2,6 +2,7 @@ package output
 
 import (
 	"bytes"
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -50,6 +51,80 @@ func TestPGNWriter_WriteGame(t *testing.T) {
 	}
 }
 
+func TestOutputGame_CommentsAfterNAGs(t *testing.T) {
+	game := testutil.ParseTestGame(`1. e4 $1 {best by test} e5 2. Nf3 $2 $6 {dubious} ( 2. Bc4 $5 {also good} ) 1-0`)
+
+	var buf bytes.Buffer
+	cfg := config.NewConfig()
+	cfg.SetOutput(&buf)
+	cfg.Output.MovesOnly = true
+	OutputGame(game, cfg)
+	want := "1. e4 $1 {best by test} e5 2. Nf3 $2 $6 {dubious} ( 2. Bc4 $5 {also good}) 1-0\n\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	cfg.Output.KeepComments = false
+	OutputGame(game, cfg)
+	if got := buf.String(); strings.Contains(got, "{") {
+		t.Errorf("output without comments = %q", got)
+	}
+}
+
+func TestOutputGame_NAGStyle(t *testing.T) {
+	game := testutil.ParseTestGame(`1. e4 $1 $5 e5 ± 2. Nf3 $14 {edge} $200 ⨀ 1-0`)
+
+	tests := []struct {
+		style config.NAGStyle
+		want  string
+	}{
+		{config.NAGsAsRead, "1. e4 $1 $5 e5 ± 2. Nf3 $14 {edge} $200 ⨀ 1-0\n\n"},
+		{config.NumericNAGs, "1. e4 $1 $5 e5 $16 2. Nf3 $14 {edge} $200 $22 1-0\n\n"},
+		{config.SymbolicNAGs, "1. e4! !? e5 {±} 2. Nf3 {⩲} {edge} $200 {⨀} 1-0\n\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		cfg := config.NewConfig()
+		cfg.SetOutput(&buf)
+		cfg.Output.MovesOnly = true
+		cfg.Output.NAGStyle = tt.style
+		OutputGame(game, cfg)
+		if got := buf.String(); got != tt.want {
+			t.Errorf("style %d: output = %q, want %q", tt.style, got, tt.want)
+		}
+	}
+}
+
+// TestOutputGame_TagsOrMovesOnly verifies the tag section or the movetext is left out
+func TestOutputGame_TagsOrMovesOnly(t *testing.T) {
+	game := testutil.ParseTestGame(`
+[Event "Test"]
+[White "Fischer"]
+[Black "Spassky"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 1-0
+`)
+
+	var buf bytes.Buffer
+	cfg := config.NewConfig()
+	cfg.SetOutput(&buf)
+	cfg.Output.TagsOnly = true
+	OutputGame(game, cfg)
+	if got := buf.String(); strings.Contains(got, "e4") || !strings.HasSuffix(got, "[Result \"1-0\"]\n\n") {
+		t.Errorf("tags only output:\n%s", got)
+	}
+
+	buf.Reset()
+	cfg.Output.TagsOnly = false
+	cfg.Output.MovesOnly = true
+	OutputGame(game, cfg)
+	if got, want := buf.String(), "1. e4 e5 2. Nf3 1-0\n\n"; got != want {
+		t.Errorf("moves only output = %q, want %q", got, want)
+	}
+}
+
 // TestJSONWriter_WriteGame verifies JSON writer outputs correct format
 func TestJSONWriter_WriteGame(t *testing.T) {
 	game := testutil.ParseTestGame(`
@@ -93,6 +168,37 @@ func TestJSONWriter_WriteGame(t *testing.T) {
 	}
 }
 
+func TestJSONWriter_MoveCommands(t *testing.T) {
+	game := testutil.ParseTestGame(`1. e4 {[%clk 0:03:21] [%eval 0.3]} e5 {[%emt 0:00:04] [%eval #-2]} *`)
+
+	var buf bytes.Buffer
+	cfg := config.NewConfig()
+	cfg.Output.KeepComments = false
+	cfg.SetOutput(&buf)
+	OutputGameJSON(game, cfg)
+	var got JSONGame
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if len(got.Moves) != 2 {
+		t.Fatalf("got %d moves, want 2", len(got.Moves))
+	}
+	white, black := got.Moves[0], got.Moves[1]
+	if white.Clock == nil || *white.Clock != 201 || white.Eval == nil || *white.Eval != 0.3 || white.Elapsed != nil {
+		t.Errorf("1. e4 = %+v, want clock 201 and eval 0.3", white)
+	}
+	if black.Elapsed == nil || *black.Elapsed != 4 || black.Eval != nil || black.Mate != -2 {
+		t.Errorf("1... e5 = %+v, want elapsed 4 and mate -2", black)
+	}
+
+	buf.Reset()
+	cfg.Output.StripClockAnnotations = true
+	OutputGameJSON(game, cfg)
+	if strings.Contains(buf.String(), `"clock"`) {
+		t.Errorf("clock kept with clock annotations stripped:\n%s", buf.String())
+	}
+}
+
 // TestGameWriter_Interface verifies that writers implement the interface
 func TestGameWriter_Interface(t *testing.T) {
 	cfg := config.NewConfig()
@@ -24,6 +24,34 @@ type Lexer struct {
 
 	// Comment nesting depth
 	commentDepth uint
+
+	// Byte offsets: total bytes read, and where the current line starts
+	bytesRead int64
+	lineStart int64
+
+	// Comment limits for the game being read, set by the parser: text
+	// beyond maxComment bytes, on lines past input offset keepUntil, or
+	// while discarding is dropped rather than kept. commentLength is the
+	// full length of the last comment, and commentCut is set if it was
+	// longer than maxComment.
+	maxComment    int
+	keepUntil     int64
+	discarding    bool
+	commentLength int
+	commentCut    bool
+
+	// Material before the first game
+	header    FileHeader
+	seenToken bool // a non-comment token has been returned
+}
+
+// utf8BOM is the UTF-8 encoding of the byte order mark.
+const utf8BOM = "\xEF\xBB\xBF"
+
+// FileHeader is the material found before the first game of an input.
+type FileHeader struct {
+	BOM   bool     // the input began with a UTF-8 byte order mark
+	Lines []string // leading %-lines and {comments}, in input order
 }
 
 // Character classification table
@@ -141,18 +169,32 @@ func (l *Lexer) readLine() bool {
 	line, err := l.reader.ReadString('\n')
 	if err != nil {
 		if err == io.EOF && len(line) > 0 {
-			l.line = line
-			l.pos = 0
-			l.lineNum++
+			l.setLine(line)
 			return true
 		}
 		l.eof = true
 		return false
 	}
+	l.setLine(line)
+	return true
+}
+
+// setLine makes line the current line.
+func (l *Lexer) setLine(line string) {
 	l.line = line
 	l.pos = 0
 	l.lineNum++
-	return true
+	l.lineStart = l.bytesRead
+	l.bytesRead += int64(len(line))
+	l.stripBOM()
+}
+
+// stripBOM removes a byte order mark from the first line.
+func (l *Lexer) stripBOM() {
+	if l.lineNum == 1 && strings.HasPrefix(l.line, utf8BOM) {
+		l.line = l.line[len(utf8BOM):]
+		l.header.BOM = true
+	}
 }
 
 // currentChar returns the current character or 0 if at end of line.
@@ -176,6 +218,7 @@ func (l *Lexer) NextToken() *Token {
 		token := l.getNextSymbol()
 		if token.Type != NoToken {
 			token.Line = l.lineNum
+			l.recordHeader(token)
 			return token
 		}
 	}
@@ -241,6 +284,9 @@ func (l *Lexer) getNextSymbol() *Token {
 		return &Token{Type: NAGToken, TokenString: nagStr}
 
 	case CheckSymbol:
+		if token := l.gatherGlyph(symbolStart); token != nil {
+			return token
+		}
 		// Allow ++ for double check
 		for l.pos < len(l.line) && chTab[l.currentChar()] == CheckSymbol {
 			l.advance()
@@ -270,6 +316,9 @@ func (l *Lexer) getNextSymbol() *Token {
 
 	case Percent:
 		// Skip rest of line (comment)
+		if !l.seenToken && symbolStart == 0 {
+			l.header.Lines = append(l.header.Lines, strings.TrimRight(l.line, "\r\n"))
+		}
 		l.pos = len(l.line)
 		return &Token{Type: NoToken}
 
@@ -305,6 +354,9 @@ func (l *Lexer) getNextSymbol() *Token {
 		return &Token{Type: NoToken}
 
 	case Operator:
+		if token := l.gatherGlyph(symbolStart); token != nil {
+			return token
+		}
 		fmt.Fprintf(l.cfg.LogFile, "Operator in illegal context on line %d.\n", l.lineNum)
 		for l.pos < len(l.line) && chTab[l.currentChar()] == Operator {
 			l.advance()
@@ -312,6 +364,9 @@ func (l *Lexer) getNextSymbol() *Token {
 		return &Token{Type: NoToken}
 
 	case ErrorToken:
+		if token := l.gatherGlyph(symbolStart); token != nil {
+			return token
+		}
 		if !l.cfg.SkippingCurrentGame {
 			fmt.Fprintf(l.cfg.LogFile, "Unknown character %c (0x%x) on line %d.\n", ch, ch, l.lineNum)
 		}
@@ -325,6 +380,18 @@ func (l *Lexer) getNextSymbol() *Token {
 	}
 }
 
+// gatherGlyph reads a NAG written as a symbol such as ± or +− starting
+// at start, keeping the symbol as its text. It returns nil when there is
+// none.
+func (l *Lexer) gatherGlyph(start int) *Token {
+	glyph := chess.GlyphPrefix(l.line[start:])
+	if glyph == "" {
+		return nil
+	}
+	l.pos = start + len(glyph)
+	return &Token{Type: NAGToken, TokenString: glyph}
+}
+
 // gatherTag gathers a tag name after '['.
 func (l *Lexer) gatherTag() *Token {
 	// Skip whitespace
@@ -390,10 +457,14 @@ func (l *Lexer) gatherString() *Token {
 	return &Token{Type: StringToken, TokenString: sb.String()}
 }
 
-// gatherComment gathers a comment block.
+// gatherComment gathers a comment block. Under the parser's size limits
+// only the part of the text within them is kept, so an oversized comment
+// does not have to be held in memory.
 func (l *Lexer) gatherComment() *Token {
 	var sb strings.Builder
 	l.commentDepth++
+	l.commentLength, l.commentCut = 0, false
+	keep := l.keepingComments()
 
 	for {
 		for l.pos < len(l.line) {
@@ -403,24 +474,25 @@ func (l *Lexer) gatherComment() *Token {
 			switch {
 			case ch == '{' && l.cfg.AllowNestedComments:
 				l.commentDepth++
-				sb.WriteByte(ch)
+				l.addCommentByte(&sb, ch, keep)
 			case ch == '}':
 				if l.cfg.AllowNestedComments && l.commentDepth > 1 {
 					l.commentDepth--
-					sb.WriteByte(ch)
+					l.addCommentByte(&sb, ch, keep)
 				} else {
 					l.commentDepth--
 					return l.makeCommentToken(sb.String())
 				}
 			default:
-				sb.WriteByte(ch)
+				l.addCommentByte(&sb, ch, keep)
 			}
 		}
 
 		if !l.readLine() {
 			break
 		}
-		sb.WriteByte('\n')
+		keep = l.keepingComments()
+		l.addCommentByte(&sb, '\n', keep)
 	}
 
 	if l.commentDepth > 0 {
@@ -430,6 +502,31 @@ func (l *Lexer) gatherComment() *Token {
 	return l.makeCommentToken(sb.String())
 }
 
+// keepingComments reports whether comment text on the current line is
+// to be kept.
+func (l *Lexer) keepingComments() bool {
+	return !l.discarding && (l.keepUntil <= 0 || l.lineStart <= l.keepUntil)
+}
+
+// addCommentByte adds a byte to a comment's text. Leading white space is
+// left out, as the comment is trimmed anyway; a byte past maxComment is
+// only counted, and cuts the comment short unless it is white space that
+// trimming could still remove.
+func (l *Lexer) addCommentByte(sb *strings.Builder, ch byte, keep bool) {
+	space := ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+	if l.commentLength == 0 && space {
+		return
+	}
+	l.commentLength++
+	switch {
+	case !keep:
+	case l.maxComment <= 0 || sb.Len() < l.maxComment:
+		sb.WriteByte(ch)
+	case !space:
+		l.commentCut = true
+	}
+}
+
 // makeCommentToken creates a comment token from the given text.
 func (l *Lexer) makeCommentToken(text string) *Token {
 	return &Token{
@@ -594,6 +691,26 @@ func moveSeemValid(text string) bool {
 	return hasFile && hasRank
 }
 
+// recordHeader adds comments that precede the first game to the header.
+func (l *Lexer) recordHeader(token *Token) {
+	if l.seenToken {
+		return
+	}
+	if token.Type != CommentToken {
+		l.seenToken = true
+		return
+	}
+	for _, comment := range token.Comments {
+		l.header.Lines = append(l.header.Lines, "{"+comment.Text+"}")
+	}
+}
+
+// Header returns the BOM flag and the %-lines and comments that preceded
+// the first game.
+func (l *Lexer) Header() FileHeader {
+	return l.header
+}
+
 // RestartForNewGame resets lexer state for a new game.
 func (l *Lexer) RestartForNewGame() {
 	l.lastMove = ""
@@ -605,6 +722,16 @@ func (l *Lexer) LineNumber() uint {
 	return l.lineNum
 }
 
+// LineOffset returns the byte offset of the start of the current line.
+func (l *Lexer) LineOffset() int64 {
+	return l.lineStart
+}
+
+// BytesRead returns the number of input bytes consumed so far.
+func (l *Lexer) BytesRead() int64 {
+	return l.bytesRead
+}
+
 // RAVLevel returns the current RAV nesting level.
 func (l *Lexer) RAVLevel() uint {
 	return l.ravLevel
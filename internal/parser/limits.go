@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// startLimits applies the size limits to the game starting at gameStart.
+// The lexer keeps no comment text beyond them, so that an oversized game is
+// never held in memory whole.
+func (p *Parser) startLimits() {
+	p.inGame = true
+	p.lexer.maxComment = p.cfg.MaxCommentBytes
+	p.lexer.keepUntil = 0
+	if limit := p.cfg.MaxGameBytes; limit > 0 {
+		p.lexer.keepUntil = p.gameStart + limit
+	}
+}
+
+// endLimits lifts the size limits between games.
+func (p *Parser) endLimits() {
+	p.inGame = false
+	p.lexer.maxComment, p.lexer.keepUntil = 0, 0
+}
+
+// exceedsLimits reports whether the game read so far, up to token, exceeds
+// the size limits, setting p.oversized to why for a comment. Tag tokens are
+// not checked, as a game without a result ends at the next game's tags.
+func (p *Parser) exceedsLimits(token *Token) bool {
+	if token.Type == CommentToken && p.lexer.commentCut {
+		p.oversized = fmt.Sprintf("%d byte comment, limit %d", p.lexer.commentLength, p.cfg.MaxCommentBytes)
+		return true
+	}
+	limit := p.cfg.MaxGameBytes
+	if limit <= 0 || token.Type == TagToken || token.Type == EOFToken {
+		return false
+	}
+	return p.lexer.BytesRead()-p.gameStart > limit
+}
+
+// skipOversizedGame reads the rest of a game that exceeds a size limit,
+// keeping none of it, up to its result or the next game's tags.
+func (p *Parser) skipOversizedGame() {
+	p.lexer.discarding = true
+	defer func() { p.lexer.discarding = false }()
+
+	end := p.lexer.BytesRead()
+	for p.resume = nil; p.resume == nil; {
+		token := p.lexer.NextToken()
+		switch {
+		case token.Type == TerminatingResult && p.lexer.RAVLevel() == 0:
+			p.resume, end = &Token{Type: NoToken}, p.lexer.BytesRead()
+		case token.Type == TagToken:
+			p.resume, end = token, p.lexer.LineOffset()
+		case token.Type == EOFToken:
+			p.resume, end = token, p.lexer.BytesRead()
+		}
+	}
+	if p.oversized == "" {
+		p.oversized = fmt.Sprintf("%d bytes, limit %d", end-p.gameStart, p.cfg.MaxGameBytes)
+	}
+}
+
+// withinLimits checks a parsed game against the configured size limits,
+// logging a "Size limit" message for games that exceed them.
+func (p *Parser) withinLimits(game *chess.Game) bool {
+	if limit := p.cfg.MaxGameBytes; limit > 0 {
+		if size := p.gameEnd - p.gameStart; size > limit {
+			fmt.Fprintf(p.cfg.LogFile, "Size limit: game at line %d skipped (%d bytes, limit %d).\n",
+				game.StartLine, size, limit)
+			return false
+		}
+	}
+
+	if limit := p.cfg.MaxCommentBytes; limit > 0 {
+		if size := LargestComment(game); size > limit {
+			fmt.Fprintf(p.cfg.LogFile, "Size limit: game at line %d skipped (%d byte comment, limit %d).\n",
+				game.StartLine, size, limit)
+			return false
+		}
+	}
+
+	return true
+}
+
+// LargestComment returns the length in bytes of the longest comment
+// anywhere in the game, including variations.
+func LargestComment(game *chess.Game) int {
+	return max(longestComment(game.PrefixComment), largestMoveComment(game.Moves))
+}
+
+// largestMoveComment returns the longest comment in a move list.
+func largestMoveComment(moves *chess.Move) int {
+	largest := 0
+	for move := moves; move != nil; move = move.Next {
+		largest = max(largest, longestComment(move.Comments))
+		for _, nag := range move.NAGs {
+			largest = max(largest, longestComment(nag.Comments))
+		}
+		for _, variation := range move.Variations {
+			largest = max(largest,
+				longestComment(variation.PrefixComment),
+				longestComment(variation.SuffixComment),
+				largestMoveComment(variation.Moves))
+		}
+	}
+	return largest
+}
+
+// longestComment returns the length of the longest comment in the list.
+func longestComment(comments []*chess.Comment) int {
+	longest := 0
+	for _, comment := range comments {
+		longest = max(longest, len(comment.Text))
+	}
+	return longest
+}
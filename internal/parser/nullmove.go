@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+)
+
+// applyNullMovePolicy applies the configured null move policy to a parsed
+// game. It returns false if the game should be dropped.
+func (p *Parser) applyNullMovePolicy(game *chess.Game) bool {
+	switch p.cfg.NullMovePolicy {
+	case config.RejectNullMoves:
+		if HasNullMove(game.Moves) {
+			fmt.Fprintf(p.cfg.LogFile, "Game at line %d dropped: contains a null move.\n", game.StartLine)
+			return false
+		}
+	case config.NullMovesToComments:
+		head, text := convertNullMoves(game.Moves)
+		if head == nil && game.Moves != nil {
+			game.PrefixComment = append(game.PrefixComment, &chess.Comment{Text: text})
+		}
+		game.Moves = head
+	}
+	return true
+}
+
+// HasNullMove reports whether a move list or any of its variations
+// contains a null move.
+func HasNullMove(moves *chess.Move) bool {
+	for move := moves; move != nil; move = move.Next {
+		if move.Class == chess.NullMove {
+			return true
+		}
+		for _, variation := range move.Variations {
+			if HasNullMove(variation.Moves) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// convertNullMoves cuts each line at its first null move and records the
+// cut moves as a comment on the move before it. It returns the new head of
+// the list (nil if the list began with a null move) and, in that case, the
+// comment text for the caller to attach.
+func convertNullMoves(head *chess.Move) (*chess.Move, string) {
+	for move := head; move != nil; move = move.Next {
+		if move.Class == chess.NullMove {
+			text := lineText(move)
+			prev := move.Prev
+			if prev == nil {
+				return nil, text
+			}
+			prev.Next = nil
+			prev.Comments = append(prev.Comments, &chess.Comment{Text: text})
+			if prev.TerminatingResult == "" {
+				prev.TerminatingResult = lastMove(move).TerminatingResult
+			}
+			return head, ""
+		}
+
+		kept := move.Variations[:0]
+		for _, variation := range move.Variations {
+			newHead, text := convertNullMoves(variation.Moves)
+			if newHead == nil && variation.Moves != nil {
+				move.Comments = append(move.Comments, &chess.Comment{Text: text})
+				continue
+			}
+			variation.Moves = newHead
+			kept = append(kept, variation)
+		}
+		move.Variations = kept
+	}
+	return head, ""
+}
+
+// lineText renders the moves from start to the end of its line.
+func lineText(start *chess.Move) string {
+	var parts []string
+	for move := start; move != nil; move = move.Next {
+		parts = append(parts, move.Text)
+	}
+	return strings.Join(parts, " ")
+}
+
+// lastMove returns the final move of the line containing start.
+func lastMove(start *chess.Move) *chess.Move {
+	move := start
+	for move.Next != nil {
+		move = move.Next
+	}
+	return move
+}
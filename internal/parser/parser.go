@@ -14,6 +14,17 @@ type Parser struct {
 	currentToken *Token
 	ravLevel     uint
 	cfg          *config.Config
+
+	duplicateTags int    // repeated tags seen so far
+	rejectCurrent bool   // the game being parsed has a repeated tag and must be dropped
+	gameStart     int64  // byte offset of the line where the current game starts
+	gameEnd       int64  // byte offset just past the current game's last line
+	gameLine      uint   // line where the current game starts
+	inGame        bool   // the size limits apply to the tokens being read
+	oversized     string // why the current game is being skipped, "" if it is not
+	resume        *Token // the token after a skipped game
+
+	stats Stats
 }
 
 // NewParser creates a new parser for the given reader.
@@ -28,14 +39,52 @@ func NewParser(r io.Reader, cfg *config.Config) *Parser {
 	}
 }
 
-// nextToken gets the next token from the lexer.
+// nextToken gets the next token from the lexer. Once the game being read
+// has exceeded a size limit, the rest of it is skipped and the parse of it
+// sees the end of the input.
 func (p *Parser) nextToken() {
+	if p.oversized != "" {
+		p.currentToken = &Token{Type: EOFToken}
+		return
+	}
 	p.currentToken = p.lexer.NextToken()
+	p.stats.recordToken(p.currentToken)
+	if p.inGame && p.exceedsLimits(p.currentToken) {
+		p.skipOversizedGame()
+	}
 }
 
-// ParseGame parses a single game from the input.
-// Returns nil if no more games are available.
+// ParseGame parses a single game from the input, applying the configured
+// null move policy. Returns nil if no more games are available.
 func (p *Parser) ParseGame() (*chess.Game, error) {
+	for {
+		game, err := p.parseGame()
+		if err != nil {
+			return game, err
+		}
+		if p.oversized != "" {
+			fmt.Fprintf(p.cfg.LogFile, "Size limit: game at line %d skipped (%s).\n", p.gameLine, p.oversized)
+			p.oversized = ""
+			p.currentToken = p.resume
+			continue
+		}
+		if game == nil {
+			return nil, nil
+		}
+		if p.rejectCurrent || !p.withinLimits(game) {
+			continue
+		}
+		if p.applyNullMovePolicy(game) {
+			p.stats.Games++
+			return game, nil
+		}
+	}
+}
+
+// parseGame parses the next game from the input.
+func (p *Parser) parseGame() (*chess.Game, error) {
+	p.rejectCurrent = false
+
 	// Get first token if we haven't yet
 	if p.currentToken == nil {
 		p.nextToken()
@@ -43,12 +92,17 @@ func (p *Parser) ParseGame() (*chess.Game, error) {
 
 	// Skip to next game
 	p.skipToNextGame()
+	p.gameStart = p.lexer.LineOffset()
+	p.gameLine = p.lexer.LineNumber()
+	p.startLimits()
+	defer p.endLimits()
 
 	// Skip any prefix comments between games
 	p.parseOptCommentList()
 
 	game := chess.NewGame()
 	game.StartLine = p.lexer.LineNumber()
+	game.StartOffset = p.gameStart
 
 	// Parse tags
 	p.parseOptTagList(game)
@@ -67,6 +121,13 @@ func (p *Parser) ParseGame() (*chess.Game, error) {
 	// Parse result
 	result := p.parseResult()
 	game.EndLine = p.lexer.LineNumber()
+	p.gameEnd = p.lexer.BytesRead()
+	if result == "" && p.currentToken.Type != EOFToken {
+		// Without a result the game ends before the line of the token
+		// that ended it
+		p.gameEnd = p.lexer.LineOffset()
+	}
+	game.EndOffset = p.gameEnd
 
 	// Attach trailing comment and result to last move
 	if game.Moves != nil {
@@ -78,6 +139,8 @@ func (p *Parser) ParseGame() (*chess.Game, error) {
 		}
 	}
 
+	parseMoveCommands(game.Moves)
+
 	// Store result in tags if not present
 	if result != "" {
 		if game.GetTag("Result") == "" || game.GetTag("Result") == "?" {
@@ -93,6 +156,17 @@ func (p *Parser) ParseGame() (*chess.Game, error) {
 	return game, nil
 }
 
+// parseMoveCommands reads the [%clk], [%emt] and [%eval] commands of a
+// line's moves and of their variations.
+func parseMoveCommands(moves *chess.Move) {
+	for move := moves; move != nil; move = move.Next {
+		move.ParseCommands()
+		for _, variation := range move.Variations {
+			parseMoveCommands(variation.Moves)
+		}
+	}
+}
+
 // skipToNextGame skips tokens until the start of a game is found.
 func (p *Parser) skipToNextGame() {
 	for {
@@ -119,8 +193,7 @@ func (p *Parser) parseTag(game *chess.Game) bool {
 		p.nextToken()
 
 		if p.currentToken.Type == StringToken {
-			tagValue := p.currentToken.TokenString
-			game.SetTag(tagName, tagValue)
+			p.setTag(game, tagName, p.currentToken.TokenString)
 			p.nextToken()
 		} else {
 			fmt.Fprintf(p.cfg.LogFile, "Missing tag string for %s.\n", tagName)
@@ -137,6 +210,37 @@ func (p *Parser) parseTag(game *chess.Game) bool {
 	return false
 }
 
+// setTag stores a tag value, resolving repeats of the same tag name
+// according to the duplicate tag policy. Tag names are case-sensitive.
+func (p *Parser) setTag(game *chess.Game, name, value string) {
+	if !game.HasTag(name) {
+		game.SetTag(name, value)
+		return
+	}
+
+	p.duplicateTags++
+	switch p.cfg.DuplicateTagPolicy {
+	case config.KeepFirstTag:
+	case config.RejectDuplicateTags:
+		if !p.rejectCurrent {
+			fmt.Fprintf(p.cfg.LogFile, "Game at line %d dropped: duplicate %s tag.\n", game.StartLine, name)
+		}
+		p.rejectCurrent = true
+	default:
+		game.SetTag(name, value)
+	}
+}
+
+// Header returns the material that preceded the first game of the input.
+func (p *Parser) Header() FileHeader {
+	return p.lexer.Header()
+}
+
+// DuplicateTagCount returns the number of repeated tags seen so far.
+func (p *Parser) DuplicateTagCount() int {
+	return p.duplicateTags
+}
+
 // parseMoveList parses a list of moves.
 func (p *Parser) parseMoveList() *chess.Move {
 	var head, tail *chess.Move
@@ -174,10 +278,15 @@ func (p *Parser) parseMoveAndVariants() *chess.Move {
 
 // parseMove parses a single move.
 func (p *Parser) parseMove() *chess.Move {
+	var number uint
+	if p.currentToken.Type == MoveNumber {
+		number = p.currentToken.MoveNum
+	}
 	p.parseOptMoveNumber()
 
 	move := p.parseMoveUnit()
 	if move != nil {
+		move.Number = number
 		p.parseOptNAGList(move)
 	}
 	return move
@@ -199,7 +308,8 @@ func (p *Parser) parseMoveUnit() *chess.Move {
 	}
 
 	// Check for null move restriction
-	if move.Class == chess.NullMove && p.ravLevel == 0 && !p.cfg.AllowNullMoves {
+	if move.Class == chess.NullMove && p.ravLevel == 0 && !p.cfg.AllowNullMoves &&
+		p.cfg.NullMovePolicy == config.KeepNullMoves {
 		fmt.Fprintf(p.cfg.LogFile, "Null moves (--) only allowed in variations.\n")
 	}
 
@@ -271,6 +381,7 @@ func (p *Parser) parseVariant() *chess.Variation {
 	}
 
 	p.ravLevel++
+	p.stats.recordRAV(int(p.ravLevel))
 	p.nextToken()
 
 	variation := &chess.Variation{
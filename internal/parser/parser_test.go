@@ -1,6 +1,10 @@
 package parser
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
 	"strings"
 	"testing"
 
@@ -188,3 +192,362 @@ func TestParseNAGs(t *testing.T) {
 		t.Error("Expected NAG on first move (e4!)")
 	}
 }
+
+func TestParseNAGGlyphs(t *testing.T) {
+	var log bytes.Buffer
+	cfg := config.NewConfig()
+	cfg.LogFile = &log
+	games, err := NewParser(strings.NewReader("1. e4 ± e5∓ 2. Nf3+ +− Nc6 =∞ *\n"), cfg).ParseAllGames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 1 {
+		t.Fatalf("got %d games, want 1", len(games))
+	}
+
+	var got []string
+	for move := games[0].Moves; move != nil; move = move.Next {
+		for _, nag := range move.NAGs {
+			got = append(got, nag.Text...)
+		}
+	}
+	if want := []string{"±", "∓", "+−", "=∞"}; !slices.Equal(got, want) {
+		t.Errorf("NAGs = %q, want %q", got, want)
+	}
+	if log.Len() != 0 {
+		t.Errorf("unexpected diagnostics:\n%s", log.String())
+	}
+}
+
+func TestNullMovePolicy(t *testing.T) {
+	pgn := `[Event "Threat"]
+
+1. e4 e5 2. Nf3 (2. Bc4 -- 3. Qh5) 2... Nc6 3. -- Nf6 *
+
+[Event "Clean"]
+
+1. d4 d5 *
+`
+
+	parseAll := func(policy config.NullMovePolicy) []*chess.Game {
+		cfg := config.NewConfig()
+		cfg.LogFile = io.Discard
+		cfg.NullMovePolicy = policy
+		games, err := NewParser(strings.NewReader(pgn), cfg).ParseAllGames()
+		if err != nil {
+			t.Fatalf("ParseAllGames error: %v", err)
+		}
+		return games
+	}
+
+	t.Run("keep", func(t *testing.T) {
+		games := parseAll(config.KeepNullMoves)
+		if len(games) != 2 {
+			t.Fatalf("got %d games, want 2", len(games))
+		}
+		if !HasNullMove(games[0].Moves) {
+			t.Error("expected null moves to be kept")
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		games := parseAll(config.RejectNullMoves)
+		if len(games) != 1 || games[0].GetTag("Event") != "Clean" {
+			t.Fatalf("got %d games, want only the Clean game", len(games))
+		}
+	})
+
+	t.Run("convert to comment", func(t *testing.T) {
+		games := parseAll(config.NullMovesToComments)
+		if len(games) != 2 {
+			t.Fatalf("got %d games, want 2", len(games))
+		}
+		game := games[0]
+		if HasNullMove(game.Moves) {
+			t.Fatal("expected null moves to be removed")
+		}
+		if got := game.PlyCount(); got != 4 {
+			t.Errorf("PlyCount = %d, want 4", got)
+		}
+
+		last := game.LastMove()
+		if len(last.Comments) != 1 || last.Comments[0].Text != "-- Nf6" {
+			t.Errorf("last move comments = %v, want one comment \"-- Nf6\"", last.Comments)
+		}
+		if last.TerminatingResult != "*" {
+			t.Errorf("TerminatingResult = %q, want \"*\"", last.TerminatingResult)
+		}
+
+		variation := game.Moves.Next.Next.Variations[0]
+		if variation.Moves.Next != nil {
+			t.Error("expected variation to be cut at the null move")
+		}
+		if got := variation.Moves.Comments; len(got) != 1 || got[0].Text != "-- Qh5" {
+			t.Errorf("variation comments = %v, want one comment \"-- Qh5\"", got)
+		}
+	})
+}
+
+func TestDuplicateTagPolicy(t *testing.T) {
+	pgn := `[Event "Repeated"]
+[Date "2020.01.01"]
+[Date "2021.02.02"]
+[myTag "x"]
+[MyTag "y"]
+
+1. e4 *
+
+[Event "Clean"]
+[Date "2022.03.03"]
+
+1. d4 *
+`
+
+	tests := []struct {
+		name      string
+		policy    config.DuplicateTagPolicy
+		wantGames int
+		wantDate  string
+	}{
+		{"last", config.KeepLastTag, 2, "2021.02.02"},
+		{"first", config.KeepFirstTag, 2, "2020.01.01"},
+		{"error", config.RejectDuplicateTags, 1, "2022.03.03"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.NewConfig()
+			cfg.LogFile = io.Discard
+			cfg.DuplicateTagPolicy = tt.policy
+			p := NewParser(strings.NewReader(pgn), cfg)
+			games, err := p.ParseAllGames()
+			if err != nil {
+				t.Fatalf("ParseAllGames error: %v", err)
+			}
+			if len(games) != tt.wantGames {
+				t.Fatalf("got %d games, want %d", len(games), tt.wantGames)
+			}
+			if got := games[0].GetTag("Date"); got != tt.wantDate {
+				t.Errorf("Date = %q, want %q", got, tt.wantDate)
+			}
+			if got := p.DuplicateTagCount(); got != 1 {
+				t.Errorf("DuplicateTagCount = %d, want 1", got)
+			}
+		})
+	}
+
+	// Tag names differing only in case are distinct and keep their spelling.
+	game := parseTestGame(t, pgn)
+	if game.GetTag("myTag") != "x" || game.GetTag("MyTag") != "y" {
+		t.Errorf("case-variant tags = %q, %q; want \"x\", \"y\"", game.GetTag("myTag"), game.GetTag("MyTag"))
+	}
+}
+
+func TestFileHeader(t *testing.T) {
+	pgn := "\xEF\xBB\xBF% Collection: test\n{Compiled by hand}\n% second line\n\n[Event \"A\"]\n\n1. e4 *\n\n% not a header\n[Event \"B\"]\n\n1. d4 *\n"
+
+	p := NewParser(strings.NewReader(pgn), config.NewConfig())
+	games, err := p.ParseAllGames()
+	if err != nil {
+		t.Fatalf("ParseAllGames error: %v", err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("got %d games, want 2", len(games))
+	}
+	if games[0].GetTag("Event") != "A" {
+		t.Errorf("first game Event = %q, want \"A\"", games[0].GetTag("Event"))
+	}
+
+	header := p.Header()
+	if !header.BOM {
+		t.Error("expected BOM to be recorded")
+	}
+	want := []string{"% Collection: test", "{Compiled by hand}", "% second line"}
+	if strings.Join(header.Lines, "|") != strings.Join(want, "|") {
+		t.Errorf("header lines = %q, want %q", header.Lines, want)
+	}
+}
+
+func TestGameOffsets(t *testing.T) {
+	first := "[Event \"A\"]\n\n1. e4 e5 *\n"
+	second := "[Event \"B\"]\n\n1. d4 d5\n"
+	third := "[Event \"C\"]\n\n1. c4 1-0\n"
+	pgn := first + "\n" + second + third
+
+	games, err := NewParser(strings.NewReader(pgn), config.NewConfig()).ParseAllGames()
+	if err != nil {
+		t.Fatalf("ParseAllGames error: %v", err)
+	}
+	if len(games) != 3 {
+		t.Fatalf("got %d games, want 3", len(games))
+	}
+	// The second game has no result, so ends where the third begins
+	for i, want := range []string{first, second, third} {
+		if got := pgn[games[i].StartOffset:games[i].EndOffset]; got != want {
+			t.Errorf("game %d spans %q, want %q", i+1, got, want)
+		}
+	}
+}
+
+// countingReader counts the bytes read from it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestGameReader(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&sb, "[Event \"Game %d\"]\n\n1. e4 e5 *\n\n", i+1)
+	}
+	input := &countingReader{r: strings.NewReader(sb.String())}
+
+	gr := NewGameReader(input, config.NewConfig())
+	game, err := gr.Next()
+	if err != nil {
+		t.Fatalf("Next error: %v", err)
+	}
+	if game.GetTag("Event") != "Game 1" {
+		t.Errorf("first game Event = %q, want \"Game 1\"", game.GetTag("Event"))
+	}
+	if input.n >= sb.Len() {
+		t.Errorf("reading one game read all %d bytes of the input", input.n)
+	}
+
+	count := 1
+	for {
+		if _, err := gr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next error: %v", err)
+		}
+		count++
+	}
+	if count != 2000 {
+		t.Errorf("read %d games, want 2000", count)
+	}
+	if _, err := gr.Next(); err != io.EOF {
+		t.Errorf("Next after the last game returned %v, want io.EOF", err)
+	}
+}
+
+func TestSizeLimits(t *testing.T) {
+	huge := strings.Repeat("x", 500)
+	pgn := "[Event \"Small\"]\n\n1. e4 e5 *\n\n[Event \"Chatty\"]\n\n1. d4 {" + huge + "} d5 *\n\n[Event \"Nested\"]\n\n1. c4 (1. Nf3 {" + huge + "}) c5 *\n\n[Event \"After\"]\n\n1. Nf3 *\n"
+
+	tests := []struct {
+		name       string
+		maxGame    int64
+		maxComment int
+		want       []string
+	}{
+		{"no limits", 0, 0, []string{"Small", "Chatty", "Nested", "After"}},
+		{"game bytes", 100, 0, []string{"Small", "After"}},
+		{"comment bytes", 0, 100, []string{"Small", "After"}},
+		{"generous limits", 10000, 1000, []string{"Small", "Chatty", "Nested", "After"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var log strings.Builder
+			cfg := config.NewConfig()
+			cfg.LogFile = &log
+			cfg.MaxGameBytes = tt.maxGame
+			cfg.MaxCommentBytes = tt.maxComment
+
+			games, err := NewParser(strings.NewReader(pgn), cfg).ParseAllGames()
+			if err != nil {
+				t.Fatalf("ParseAllGames error: %v", err)
+			}
+			var got []string
+			for _, g := range games {
+				got = append(got, g.GetTag("Event"))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("games = %v, want %v", got, tt.want)
+			}
+			if skipped := len(tt.want) < 4; skipped != strings.Contains(log.String(), "Size limit:") {
+				t.Errorf("log = %q, skipped = %v", log.String(), skipped)
+			}
+		})
+	}
+}
+
+func TestSizeLimits_Lexer(t *testing.T) {
+	huge := strings.Repeat("word ", 20000)
+
+	t.Run("comment text stops at the limit", func(t *testing.T) {
+		l := NewLexer(strings.NewReader("{"+huge+"}"), config.NewConfig())
+		l.maxComment = 50
+		tok := l.NextToken()
+		if tok.Type != CommentToken || len(tok.Comments) != 1 {
+			t.Fatalf("token = %v, want one comment", tok.Type)
+		}
+		if n := len(tok.Comments[0].Text); n > 50 {
+			t.Errorf("kept %d comment bytes, want at most 50", n)
+		}
+		if !l.commentCut {
+			t.Error("commentCut = false, want true")
+		}
+	})
+
+	t.Run("skip resumes at a tagless game", func(t *testing.T) {
+		pgn := "[Event \"Big\"]\n\n1. e4 {" + huge + "}\ne5 1-0\n\n1. d4 d5 *\n"
+		var log strings.Builder
+		cfg := config.NewConfig()
+		cfg.LogFile = &log
+		cfg.MaxGameBytes = 1000
+
+		games, err := NewParser(strings.NewReader(pgn), cfg).ParseAllGames()
+		if err != nil {
+			t.Fatalf("ParseAllGames error: %v", err)
+		}
+		if len(games) != 1 || games[0].Moves == nil || games[0].Moves.Text != "d4" {
+			t.Fatalf("games = %d, want only the game after the oversized one", len(games))
+		}
+		if !strings.Contains(log.String(), "game at line 1 skipped") {
+			t.Errorf("log = %q, want the skipped game's line", log.String())
+		}
+	})
+}
+
+func TestParserStats(t *testing.T) {
+	pgn := `[Event "Stats"]
+
+1. e4 {best by test} e5 (1... c5 (1... e6) 2. Nf3) 2. Nf3 $1 *
+
+[Event "Second"]
+
+1. d4 {x} *
+`
+	cfg := config.NewConfig()
+	cfg.LogFile = io.Discard
+	p := NewParser(strings.NewReader(pgn), cfg)
+	if _, err := p.ParseAllGames(); err != nil {
+		t.Fatalf("ParseAllGames error: %v", err)
+	}
+
+	s := p.Stats()
+	if s.Games != 2 || s.Tokens[TagToken] != 2 || s.Tokens[NAGToken] != 1 {
+		t.Errorf("games/tags/NAGs = %d/%d/%d, want 2/2/1", s.Games, s.Tokens[TagToken], s.Tokens[NAGToken])
+	}
+	if s.Comments != 2 || s.CommentBytes != len("best by test")+1 || s.LongestComment != len("best by test") {
+		t.Errorf("comments = %d, %d bytes, longest %d", s.Comments, s.CommentBytes, s.LongestComment)
+	}
+	if len(s.RAVDepths) != 2 || s.RAVDepths[0] != 1 || s.RAVDepths[1] != 1 {
+		t.Errorf("RAVDepths = %v, want [1 1]", s.RAVDepths)
+	}
+
+	var total Stats
+	total.Add(s)
+	total.Add(s)
+	if total.Games != 4 || total.RAVDepths[1] != 2 || total.TotalTokens() != 2*s.TotalTokens() {
+		t.Errorf("Add gave %+v", total)
+	}
+}
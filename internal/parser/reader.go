@@ -0,0 +1,33 @@
+package parser
+
+import (
+	"io"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/config"
+)
+
+// GameReader reads the games of an input one at a time, so that an input
+// need not be held in memory whole. The input is read only as far as the
+// games returned so far. The Parser methods report on what has been read.
+type GameReader struct {
+	*Parser
+}
+
+// NewGameReader creates a game reader for the given reader.
+// If cfg is nil, a default config is created.
+func NewGameReader(r io.Reader, cfg *config.Config) *GameReader {
+	return &GameReader{Parser: NewParser(r, cfg)}
+}
+
+// Next returns the next game, or io.EOF when there are no more.
+func (gr *GameReader) Next() (*chess.Game, error) {
+	game, err := gr.ParseGame()
+	if err != nil {
+		return nil, err
+	}
+	if game == nil {
+		return nil, io.EOF
+	}
+	return game, nil
+}
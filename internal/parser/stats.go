@@ -0,0 +1,70 @@
+package parser
+
+// Stats counts what a parser has seen, for diagnosing slow or unusual
+// input.
+type Stats struct {
+	Games          int
+	Tokens         [ErrorToken + 1]int // tokens returned to the parser, by type
+	Comments       int
+	CommentBytes   int
+	LongestComment int
+	RAVDepths      []int // RAVDepths[d-1] counts variations opened at depth d
+}
+
+// Add accumulates other into s.
+func (s *Stats) Add(other Stats) {
+	s.Games += other.Games
+	for i, n := range other.Tokens {
+		s.Tokens[i] += n
+	}
+	s.Comments += other.Comments
+	s.CommentBytes += other.CommentBytes
+	if other.LongestComment > s.LongestComment {
+		s.LongestComment = other.LongestComment
+	}
+	s.growRAVDepths(len(other.RAVDepths))
+	for i, n := range other.RAVDepths {
+		s.RAVDepths[i] += n
+	}
+}
+
+// TotalTokens returns the number of tokens of all types.
+func (s *Stats) TotalTokens() int {
+	total := 0
+	for _, n := range s.Tokens {
+		total += n
+	}
+	return total
+}
+
+// recordToken counts a token and the comments it carries.
+func (s *Stats) recordToken(token *Token) {
+	if int(token.Type) < len(s.Tokens) {
+		s.Tokens[token.Type]++
+	}
+	for _, comment := range token.Comments {
+		s.Comments++
+		s.CommentBytes += len(comment.Text)
+		if len(comment.Text) > s.LongestComment {
+			s.LongestComment = len(comment.Text)
+		}
+	}
+}
+
+// recordRAV counts a variation opened at the given nesting depth.
+func (s *Stats) recordRAV(depth int) {
+	s.growRAVDepths(depth)
+	s.RAVDepths[depth-1]++
+}
+
+// growRAVDepths makes room for counts up to the given depth.
+func (s *Stats) growRAVDepths(depth int) {
+	for len(s.RAVDepths) < depth {
+		s.RAVDepths = append(s.RAVDepths, 0)
+	}
+}
+
+// Stats returns the counts gathered so far.
+func (p *Parser) Stats() Stats {
+	return p.stats
+}
@@ -2,6 +2,7 @@
 package processing
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
@@ -22,6 +23,10 @@ type GameAnalysis struct {
 	Has5FoldRepetition      bool
 	HasInsufficientMaterial bool
 	HasMaterialOdds         bool
+
+	// ReplayErr is set if the game could not be replayed to the end;
+	// FinalBoard is then the position after the last legal move.
+	ReplayErr error
 }
 
 // FiftyMoveTriggered returns true if the game triggered the fifty-move rule.
@@ -57,14 +62,18 @@ func AnalyzeGame(game *chess.Game) (*chess.Board, *GameAnalysis) {
 		analysis.HasMaterialOdds = engine.CheckMaterialOdds(game)
 	}
 
-	posHash := hashing.GenerateZobristHash(board)
+	hasher := hashing.NewIncrementalHasher(board)
+	posHash := hasher.Hash()
 	analysis.Positions = append(analysis.Positions, posHash)
 	positionCount := map[uint64]int{posHash: 1}
 
+	ply := 0
 	for move := game.Moves; move != nil; move = move.Next {
-		if !engine.ApplyMove(board, move) {
+		if !hasher.Play(move) {
+			analysis.ReplayErr = &engine.ReplayError{Ply: ply + 1, Move: move.Text}
 			break
 		}
+		ply++
 
 		// 50-move rule (100 half-moves)
 		if board.HalfmoveClock >= 100 {
@@ -80,7 +89,7 @@ func AnalyzeGame(game *chess.Game) (*chess.Board, *GameAnalysis) {
 			analysis.HasUnderpromotion = true
 		}
 
-		posHash = hashing.GenerateZobristHash(board)
+		posHash = hasher.Hash()
 		analysis.Positions = append(analysis.Positions, posHash)
 		positionCount[posHash]++
 
@@ -102,19 +111,6 @@ func AnalyzeGame(game *chess.Game) (*chess.Board, *GameAnalysis) {
 	return board, analysis
 }
 
-// ReplayGame replays a game from the initial position to get the final board state.
-func ReplayGame(game *chess.Game) *chess.Board {
-	board := engine.NewBoardForGame(game)
-
-	for move := game.Moves; move != nil; move = move.Next {
-		if !engine.ApplyMove(board, move) {
-			break
-		}
-	}
-
-	return board
-}
-
 // ValidateGame validates all moves in a game are legal.
 func ValidateGame(game *chess.Game) *ValidationResult {
 	result := &ValidationResult{Valid: true}
@@ -137,30 +133,16 @@ func ValidateGame(game *chess.Game) *ValidationResult {
 		return result
 	}
 
-	// Replay game to validate moves
-	var board *chess.Board
-	var err error
-
-	if fen, ok := game.Tags["FEN"]; ok {
-		board, err = engine.NewBoardFromFEN(fen)
-		if err != nil {
-			result.Valid = false
-			result.ErrorMsg = fmt.Sprintf("invalid FEN: %s", fen)
-			return result
-		}
-	} else {
-		board = engine.MustBoardFromFEN(engine.InitialFEN)
-	}
-
-	plyCount := 0
-	for move := game.Moves; move != nil; move = move.Next {
-		plyCount++
-		if !engine.ApplyMove(board, move) {
-			result.Valid = false
-			result.ErrorPly = plyCount
-			result.ErrorMsg = fmt.Sprintf("illegal move at ply %d: %s", plyCount, move.Text)
-			return result
+	if _, _, err := engine.ReplayGame(game); err != nil {
+		result.Valid = false
+		var replayErr *engine.ReplayError
+		if errors.As(err, &replayErr) {
+			result.ErrorPly = replayErr.Ply
+			result.ErrorMsg = replayErr.Error()
+		} else {
+			result.ErrorMsg = err.Error()
 		}
+		return result
 	}
 
 	// Mark game as validated
@@ -189,6 +171,60 @@ func HasComments(game *chess.Game) bool {
 	return false
 }
 
+// CountAllMoves counts every move in a game, including moves inside variations.
+func CountAllMoves(game *chess.Game) int {
+	return countMovesIn(game.Moves)
+}
+
+// countMovesIn counts the moves in a move list and its variations.
+func countMovesIn(moves *chess.Move) int {
+	count := 0
+	for move := moves; move != nil; move = move.Next {
+		count++
+		for _, v := range move.Variations {
+			count += countMovesIn(v.Moves)
+		}
+	}
+	return count
+}
+
+// LongestLinePly returns the ply, counted from the start of the game, at
+// which the longest line ends. Every line is considered: the main line and
+// each variation, however deeply nested.
+func LongestLinePly(game *chess.Game) int {
+	return longestLinePly(game.Moves, 0)
+}
+
+// longestLinePly measures a line whose first move is ply start+1. A
+// variation replaces the move it is attached to, so starts at the same ply.
+func longestLinePly(moves *chess.Move, start int) int {
+	ply, longest := start, start
+	for move := moves; move != nil; move = move.Next {
+		for _, variation := range move.Variations {
+			longest = max(longest, longestLinePly(variation.Moves, ply))
+		}
+		ply++
+	}
+	return max(longest, ply)
+}
+
+// CountAnnotations counts comments, NAGs and variations throughout a game.
+func CountAnnotations(game *chess.Game) int {
+	return len(game.PrefixComment) + countAnnotationsIn(game.Moves)
+}
+
+// countAnnotationsIn counts the annotations in a move list and its variations.
+func countAnnotationsIn(moves *chess.Move) int {
+	count := 0
+	for move := moves; move != nil; move = move.Next {
+		count += len(move.Comments) + len(move.NAGs) + len(move.Variations)
+		for _, v := range move.Variations {
+			count += len(v.PrefixComment) + len(v.SuffixComment) + countAnnotationsIn(v.Moves)
+		}
+	}
+	return count
+}
+
 // isValidResult checks if a result string is a valid PGN result.
 func isValidResult(result string) bool {
 	switch result {
@@ -0,0 +1,99 @@
+package processing
+
+import (
+	"math"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+)
+
+// EvalCap bounds the evaluations compared for swings, in centipawns, so
+// that a move in a won or lost position is not a swing just because the
+// margin changed. Mates count as the cap.
+const EvalCap = 1000
+
+// MoveEval returns the evaluation of the position after a move, from its
+// [%eval] comment, in centipawns from White's point of view and capped at
+// EvalCap.
+func MoveEval(move *chess.Move) (int, bool) {
+	c := move.Commands
+	switch {
+	case !c.HasEval:
+		return 0, false
+	case c.Mate < 0:
+		return -EvalCap, true
+	case c.Mate > 0:
+		return EvalCap, true
+	}
+	return int(math.Round(max(-EvalCap, min(EvalCap, c.Eval*100)))), true
+}
+
+// EvalSwing is a main-line move after which the evaluation moved against
+// the player who made it.
+type EvalSwing struct {
+	Move *chess.Move
+	Ply  int // 1-based ply of the move
+	Loss int // centipawns lost by the move's player
+}
+
+// EvalSwings returns the main-line moves losing more than threshold
+// centipawns, comparing the [%eval] of each move with that of the move
+// before. Moves without an evaluation, or following one, are skipped.
+// So is the first move, as the starting position has no [%eval] comment
+// to compare with.
+func EvalSwings(game *chess.Game, threshold int) []EvalSwing {
+	var swings []EvalSwing
+	white := engine.NewBoardForGame(game).ToMove == chess.White
+	prev, known := 0, false
+	ply := 0
+	for move := game.Moves; move != nil; move = move.Next {
+		ply++
+		eval, ok := MoveEval(move)
+		if ok && known {
+			loss := prev - eval
+			if !white {
+				loss = -loss
+			}
+			if loss > threshold {
+				swings = append(swings, EvalSwing{Move: move, Ply: ply, Loss: loss})
+			}
+		}
+		prev, known = eval, ok
+		white = !white
+	}
+	return swings
+}
+
+// moveQualityNAGs are the NAGs and glyphs judging a move, which
+// MarkEvalSwings does not add to.
+var moveQualityNAGs = map[string]bool{
+	"$1": true, "$2": true, "$3": true, "$4": true, "$5": true, "$6": true,
+	"!": true, "?": true, "!!": true, "??": true, "!?": true, "?!": true,
+}
+
+// MarkEvalSwings adds $4 (blunder) to the moves of swings losing more
+// than blunder centipawns and $2 (mistake) to the others, unless a move
+// is already judged by a NAG.
+func MarkEvalSwings(swings []EvalSwing, blunder int) {
+	for _, swing := range swings {
+		if hasMoveQualityNAG(swing.Move) {
+			continue
+		}
+		if swing.Loss > blunder {
+			swing.Move.AppendNAG("$4")
+		} else {
+			swing.Move.AppendNAG("$2")
+		}
+	}
+}
+
+func hasMoveQualityNAG(move *chess.Move) bool {
+	for _, nag := range move.NAGs {
+		for _, text := range nag.Text {
+			if moveQualityNAGs[text] {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package processing
+
+import (
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/matching"
+)
+
+// FeatureCheckpoints are the plies at which GameFeatures samples the
+// material difference: after moves 10, 20, 30 and 40.
+var FeatureCheckpoints = []int{20, 40, 60, 80}
+
+// GameFeatures holds per-game features derived from replaying the moves,
+// for building datasets of games.
+type GameFeatures struct {
+	Plies           int
+	WhiteCastle     string // "O-O", "O-O-O" or "" if White never castled
+	BlackCastle     string
+	QueenTradePly   int // first ply after which no queens remain, 0 if never
+	FirstCapturePly int // 0 if there were no captures
+	WhiteChecks     int
+	BlackChecks     int
+	// MaterialAt holds White's material advantage, in hundredths of a
+	// pawn, at each FeatureCheckpoints ply the game reached.
+	MaterialAt    []int
+	FinalMaterial int
+}
+
+// ExtractFeatures replays a game's main line and computes its features,
+// weighing material by values. Replay stops at the first illegal move.
+func ExtractFeatures(game *chess.Game, values *matching.PieceValues) GameFeatures {
+	var f GameFeatures
+	board := engine.NewBoardForGame(game)
+	pieces := countPieces(board)
+	hadQueens := hasQueens(board)
+
+	for move := game.Moves; move != nil; move = move.Next {
+		mover := board.ToMove
+		if !engine.ApplyMove(board, move) {
+			break
+		}
+		f.Plies++
+
+		if move.Class == chess.KingsideCastle || move.Class == chess.QueensideCastle {
+			side := "O-O"
+			if move.Class == chess.QueensideCastle {
+				side = "O-O-O"
+			}
+			if mover == chess.White {
+				f.WhiteCastle = side
+			} else {
+				f.BlackCastle = side
+			}
+		}
+
+		if n := countPieces(board); n < pieces {
+			if f.FirstCapturePly == 0 {
+				f.FirstCapturePly = f.Plies
+			}
+			pieces = n
+		}
+
+		if engine.IsInCheck(board, board.ToMove) {
+			if mover == chess.White {
+				f.WhiteChecks++
+			} else {
+				f.BlackChecks++
+			}
+		}
+
+		if hadQueens && f.QueenTradePly == 0 && !hasQueens(board) {
+			f.QueenTradePly = f.Plies
+		}
+
+		if len(f.MaterialAt) < len(FeatureCheckpoints) && f.Plies == FeatureCheckpoints[len(f.MaterialAt)] {
+			f.MaterialAt = append(f.MaterialAt, matching.MaterialDifference(board, values))
+		}
+	}
+
+	f.FinalMaterial = matching.MaterialDifference(board, values)
+	return f
+}
+
+// countPieces counts the pieces of both colours on the board.
+func countPieces(board *chess.Board) int {
+	white, black := matching.CountMaterial(board)
+	n := 0
+	for piece := chess.Pawn; piece <= chess.King; piece++ {
+		n += white[piece] + black[piece]
+	}
+	return n
+}
+
+// hasQueens reports whether either side has a queen.
+func hasQueens(board *chess.Board) bool {
+	white, black := matching.CountMaterial(board)
+	return white[chess.Queen] > 0 || black[chess.Queen] > 0
+}
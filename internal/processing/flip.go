@@ -0,0 +1,108 @@
+package processing
+
+import (
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+)
+
+// FlipColours rewrites a game in place so that the two sides swap colours:
+// the starting position is mirrored top to bottom with the piece colours
+// exchanged, every move is mirrored to match, White and Black tags are
+// swapped and the result is reversed. A Flipped "1" tag marks the game.
+func FlipColours(game *chess.Game) {
+	board := mirrorBoard(engine.NewBoardForGame(game))
+	game.SetTag("FEN", engine.BoardToFEN(board))
+	game.SetTag("SetUp", "1")
+
+	flipMoves(game.Moves)
+	swapColourTags(game)
+	game.SetTag("Flipped", "1")
+}
+
+// mirrorBoard returns the position with ranks reversed and colours swapped.
+func mirrorBoard(b *chess.Board) *chess.Board {
+	m := chess.NewBoard()
+	for col := chess.Col('a'); col <= 'h'; col++ {
+		for rank := chess.Rank('1'); rank <= '8'; rank++ {
+			piece := b.Get(col, rank)
+			if piece == chess.Empty {
+				continue
+			}
+			colour := chess.ExtractColour(piece).Opposite()
+			m.Set(col, mirrorRank(rank), chess.MakeColouredPiece(colour, chess.ExtractPiece(piece)))
+		}
+	}
+
+	m.ToMove = b.ToMove.Opposite()
+	m.MoveNumber = b.MoveNumber
+	m.HalfmoveClock = b.HalfmoveClock
+	m.WKingCastle, m.BKingCastle = b.BKingCastle, b.WKingCastle
+	m.WQueenCastle, m.BQueenCastle = b.BQueenCastle, b.WQueenCastle
+	m.WKingCol, m.WKingRank = b.BKingCol, mirrorRank(b.BKingRank)
+	m.BKingCol, m.BKingRank = b.WKingCol, mirrorRank(b.WKingRank)
+	m.EnPassant, m.EPCol, m.EPRank = b.EnPassant, b.EPCol, mirrorRank(b.EPRank)
+	return m
+}
+
+// mirrorRank maps rank 1 to 8, 2 to 7 and so on; 0 (unknown) is kept.
+func mirrorRank(rank chess.Rank) chess.Rank {
+	if rank < '1' || rank > '8' {
+		return rank
+	}
+	return '1' + '8' - rank
+}
+
+// flipMoves mirrors the ranks of every move in a line and its variations.
+func flipMoves(moves *chess.Move) {
+	for move := moves; move != nil; move = move.Next {
+		move.Text = strings.Map(func(r rune) rune {
+			if r >= '1' && r <= '8' {
+				return rune(mirrorRank(chess.Rank(r)))
+			}
+			return r
+		}, move.Text)
+		move.FromRank = mirrorRank(move.FromRank)
+		move.ToRank = mirrorRank(move.ToRank)
+		move.TerminatingResult = flipResult(move.TerminatingResult)
+		for _, variation := range move.Variations {
+			flipMoves(variation.Moves)
+		}
+	}
+}
+
+// swapColourTags exchanges every White* tag with its Black* counterpart
+// and reverses the Result tag.
+func swapColourTags(game *chess.Game) {
+	swapped := make(map[string]string, len(game.Tags))
+	for name, value := range game.Tags {
+		switch {
+		case strings.HasPrefix(name, "White"):
+			name = "Black" + strings.TrimPrefix(name, "White")
+		case strings.HasPrefix(name, "Black"):
+			name = "White" + strings.TrimPrefix(name, "Black")
+		}
+		swapped[name] = value
+	}
+	for name := range game.Tags {
+		delete(game.Tags, name)
+	}
+	for name, value := range swapped {
+		game.Tags[name] = value
+	}
+	if result, ok := game.Tags["Result"]; ok {
+		game.Tags["Result"] = flipResult(result)
+	}
+}
+
+// flipResult reverses a decisive result.
+func flipResult(result string) string {
+	switch result {
+	case "1-0":
+		return "0-1"
+	case "0-1":
+		return "1-0"
+	}
+	return result
+}
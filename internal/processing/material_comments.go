@@ -0,0 +1,28 @@
+package processing
+
+import (
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/matching"
+)
+
+// AddMaterialComments appends a "material: ..." comment to Black's move at
+// every move number that is a multiple of every, giving the material
+// balance of the position reached by values. It stops at the first move
+// that cannot be replayed.
+func AddMaterialComments(game *chess.Game, every int, values *matching.PieceValues) {
+	if every <= 0 {
+		return
+	}
+	board := engine.NewBoardForGame(game)
+	for move := game.Moves; move != nil; move = move.Next {
+		number := board.MoveNumber
+		mover := board.ToMove
+		if !engine.ApplyMove(board, move) {
+			return
+		}
+		if mover == chess.Black && number%uint(every) == 0 {
+			move.Comments = append(move.Comments, &chess.Comment{Text: "material: " + matching.MaterialBalance(board, values)})
+		}
+	}
+}
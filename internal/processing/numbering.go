@@ -0,0 +1,118 @@
+package processing
+
+import (
+	"fmt"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+)
+
+// NumberingProblem is a move number in the source that disagrees with the
+// position of its move, such as "3." written for White's second move.
+type NumberingProblem struct {
+	Move        string // the move the number was written before
+	Written     uint
+	Expected    uint
+	InVariation bool
+}
+
+// String describes the problem for diagnostics. A number that jumps ahead
+// suggests moves were lost from the score.
+func (p NumberingProblem) String() string {
+	where := ""
+	if p.InVariation {
+		where = " in a variation"
+	}
+	if p.Written > p.Expected {
+		return fmt.Sprintf("move number jumps to %d before %s%s, expected %d (%d move(s) missing?)",
+			p.Written, p.Move, where, p.Expected, p.Written-p.Expected)
+	}
+	return fmt.Sprintf("move number %d before %s%s, expected %d", p.Written, p.Move, where, p.Expected)
+}
+
+// CheckMoveNumbers compares the move numbers written in a game's source
+// with those implied by the starting position, in the main line and in
+// variations. Only changes in the offset between the two are reported, so
+// one skipped number is a single problem rather than one per later move,
+// and a return to the right numbering is not a problem.
+func CheckMoveNumbers(game *chess.Game) []NumberingProblem {
+	board := engine.NewBoardForGame(game)
+	var problems []NumberingProblem
+	checkLineNumbers(game.Moves, board.MoveNumber, board.ToMove == chess.White, false, &problems)
+	return problems
+}
+
+// checkLineNumbers checks one line whose first move is made by White if
+// whiteToMove, with the given full move number.
+func checkLineNumbers(moves *chess.Move, number uint, whiteToMove, inVariation bool, problems *[]NumberingProblem) {
+	offset := 0
+	for move := moves; move != nil; move = move.Next {
+		for _, variation := range move.Variations {
+			checkLineNumbers(variation.Moves, number, whiteToMove, true, problems)
+		}
+		if move.Number != 0 {
+			diff := int(move.Number) - int(number)
+			if diff != 0 && diff != offset {
+				*problems = append(*problems, NumberingProblem{
+					Move:        move.Text,
+					Written:     move.Number,
+					Expected:    number,
+					InVariation: inVariation,
+				})
+			}
+			offset = diff
+		}
+		if !whiteToMove {
+			number++
+		}
+		whiteToMove = !whiteToMove
+	}
+}
+
+// StartingMove returns the number of a game's first move and whether
+// White plays it, from the FEN tag of a game set up from a position.
+func StartingMove(game *chess.Game) (uint, bool) {
+	board := engine.NewBoardForGame(game)
+	return board.MoveNumber, board.ToMove == chess.White
+}
+
+// MovesSpanned returns how many move numbers the first plies half-moves of
+// a game take up, so that a game set up with Black to move counts Black's
+// first move as a move of its own.
+func MovesSpanned(game *chess.Game, plies int) int {
+	if plies <= 0 {
+		return 0
+	}
+	if _, whiteFirst := StartingMove(game); !whiteFirst {
+		plies++
+	}
+	return (plies + 1) / 2
+}
+
+// MoveNumberOfPly returns the number of the move that a game's ply-th
+// half-move, counting from 1, belongs to.
+func MoveNumberOfPly(game *chess.Game, ply int) uint {
+	start, whiteFirst := StartingMove(game)
+	if !whiteFirst {
+		ply++
+	}
+	if ply < 1 {
+		return start
+	}
+	return start + uint((ply-1)/2)
+}
+
+// PlyOfMove returns the ply, counting from 1 at a game's first move, of
+// White's or Black's move with the given number. It is below 1 for moves
+// before the game's starting position.
+func PlyOfMove(game *chess.Game, number int, white bool) int {
+	start, whiteFirst := StartingMove(game)
+	ply := 2*(number-int(start)) + 1
+	if !white {
+		ply++
+	}
+	if !whiteFirst {
+		ply--
+	}
+	return ply
+}
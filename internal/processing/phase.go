@@ -0,0 +1,124 @@
+package processing
+
+import (
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+)
+
+// Phase is a stage of a game: opening, middlegame or endgame.
+type Phase int
+
+// Game phases, in order.
+const (
+	Opening Phase = iota
+	Middlegame
+	Endgame
+)
+
+// String returns the phase's name in lower case.
+func (p Phase) String() string {
+	switch p {
+	case Opening:
+		return "opening"
+	case Middlegame:
+		return "middlegame"
+	}
+	return "endgame"
+}
+
+// Phase boundaries, counting the knights, bishops, rooks and queens of
+// both sides, as lichess divides games.
+const (
+	middlegamePieces = 10 // at most this many ends the opening
+	endgamePieces    = 6  // at most this many is an endgame
+	sparseBackRank   = 4  // fewer of a side's own pieces on its back rank ends the opening
+)
+
+// GamePhase classifies a position. It is an endgame with at most six
+// pieces other than kings and pawns, and still the opening while more
+// than ten remain and both sides keep at least four pieces on their
+// back rank.
+func GamePhase(board *chess.Board) Phase {
+	pieces := 0
+	var backRank [2]int
+	for rank := chess.Rank(chess.FirstRank); rank <= chess.LastRank; rank++ {
+		for col := chess.Col(chess.FirstCol); col <= chess.LastCol; col++ {
+			piece := board.Get(col, rank)
+			if piece == chess.Empty || piece == chess.Off {
+				continue
+			}
+			colour := chess.ExtractColour(piece)
+			if (colour == chess.White && rank == chess.FirstRank) || (colour == chess.Black && rank == chess.LastRank) {
+				backRank[colour]++
+			}
+			if kind := chess.ExtractPiece(piece); kind != chess.Pawn && kind != chess.King {
+				pieces++
+			}
+		}
+	}
+	switch {
+	case pieces <= endgamePieces:
+		return Endgame
+	case pieces <= middlegamePieces || backRank[chess.White] < sparseBackRank || backRank[chess.Black] < sparseBackRank:
+		return Middlegame
+	}
+	return Opening
+}
+
+// DecisiveLoss is the evaluation, in centipawns against a player, at which
+// their position counts as lost.
+const DecisiveLoss = 300
+
+// DecisiveMistake is the move that lost a decisive game.
+type DecisiveMistake struct {
+	Move  *chess.Move
+	Ply   int   // 1-based ply of the move
+	Phase Phase // phase of the position the move was played in
+}
+
+// FindDecisiveMistake returns the loser's main-line move after which the
+// [%eval] comments show them lost, at DecisiveLoss or worse, for the rest
+// of the game. It reports false for a game without a decisive result,
+// whose last evaluation is not lost for the loser, or whose final run of
+// lost evaluations starts after a move by the winner. Moves without an
+// evaluation neither start nor end the run; replay stops at the first
+// illegal move.
+func FindDecisiveMistake(game *chess.Game) (DecisiveMistake, bool) {
+	var loser chess.Colour
+	switch game.GetTag("Result") {
+	case "1-0":
+		loser = chess.Black
+	case "0-1":
+		loser = chess.White
+	default:
+		return DecisiveMistake{}, false
+	}
+
+	var mistake DecisiveMistake
+	found, lost := false, false
+	board := engine.NewBoardForGame(game)
+	ply := 0
+	for move := game.Moves; move != nil; move = move.Next {
+		ply++
+		mover := board.ToMove
+		phase := GamePhase(board)
+		if !engine.ApplyMove(board, move) {
+			break
+		}
+		eval, ok := MoveEval(move)
+		if !ok {
+			continue
+		}
+		if loser == chess.Black {
+			eval = -eval
+		}
+		switch {
+		case eval > -DecisiveLoss:
+			found, lost = false, false
+		case !lost:
+			mistake = DecisiveMistake{Move: move, Ply: ply, Phase: phase}
+			found, lost = mover == loser, true
+		}
+	}
+	return mistake, found && lost
+}
@@ -1,9 +1,12 @@
 package processing
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+	"github.com/lgbarn/pgn-extract-go/internal/matching"
 	"github.com/lgbarn/pgn-extract-go/internal/testutil"
 )
 
@@ -130,8 +133,123 @@ func TestCountPlies(t *testing.T) {
 	}
 }
 
-// TestReplayGame verifies game replay returns final position
-func TestReplayGame(t *testing.T) {
+// TestCountAllMovesAndAnnotations verifies counting through variations
+func TestCountAllMovesAndAnnotations(t *testing.T) {
+	game := testutil.MustParseGame(t, `
+[Event "Test"]
+[Result "*"]
+
+{Intro} 1. e4 {Best by test} e5 $1 2. Nf3 (2. Bc4 {Bishop's opening} Nf6) Nc6 *
+`)
+
+	if got := CountAllMoves(game); got != 6 {
+		t.Errorf("CountAllMoves = %d, want 6", got)
+	}
+	// prefix comment, "Best by test", $1, the variation and its comment
+	if got := CountAnnotations(game); got != 5 {
+		t.Errorf("CountAnnotations = %d, want 5", got)
+	}
+}
+
+// TestLongestLinePly verifies the longest line is found through nested variations
+func TestLongestLinePly(t *testing.T) {
+	game := testutil.MustParseGame(t, `
+[Event "Test"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 (2. Bc4 Nf6 (2... Bc5 3. Qh5 Nf6 4. Qxf7#) 3. d3) Nc6 *
+`)
+
+	if got := LongestLinePly(game); got != 7 {
+		t.Errorf("LongestLinePly = %d, want 7", got)
+	}
+	if got := CountAllMoves(game); got != 11 {
+		t.Errorf("CountAllMoves = %d, want 11", got)
+	}
+
+	mainOnly := testutil.MustParseGame(t, "[Result \"*\"]\n\n1. e4 e5 2. Nf3 *\n")
+	if got := LongestLinePly(mainOnly); got != 3 {
+		t.Errorf("LongestLinePly(main line only) = %d, want 3", got)
+	}
+}
+
+// TestCheckMoveNumbers verifies numbering jumps are reported once per change
+func TestCheckMoveNumbers(t *testing.T) {
+	game := testutil.MustParseGame(t, `
+[Event "Test"]
+[Result "*"]
+
+1. e4 e5 3. Nf3 Nc6 4. Bb5 {pin} 2... a6 (3... d6 5. d4) 4. Ba4 *
+`)
+
+	problems := CheckMoveNumbers(game)
+	if len(problems) != 3 {
+		t.Fatalf("CheckMoveNumbers found %d problems, want 3: %v", len(problems), problems)
+	}
+	if p := problems[0]; p.Written != 3 || p.Expected != 2 || p.Move != "Nf3" || p.InVariation {
+		t.Errorf("problems[0] = %+v, want Nf3 numbered 3 instead of 2", p)
+	}
+	if p := problems[1]; !p.InVariation || p.Move != "d4" || p.Written != 5 || p.Expected != 4 {
+		t.Errorf("problems[1] = %+v, want d4 numbered 5 in a variation", p)
+	}
+	if want := "move number 2 before a6, expected 3"; problems[2].String() != want {
+		t.Errorf("problems[2] = %q, want %q", problems[2], want)
+	}
+
+	clean := testutil.MustParseGame(t, "[Result \"*\"]\n\n1. e4 {c} 1... e5 2. Nf3 (2. f4 exf4) Nc6 *\n")
+	if problems := CheckMoveNumbers(clean); len(problems) != 0 {
+		t.Errorf("CheckMoveNumbers(clean) = %v", problems)
+	}
+}
+
+func TestMoveNumbering(t *testing.T) {
+	fromStart := testutil.MustParseGame(t, "[Result \"*\"]\n\n1. e4 e5 2. Nf3 *\n")
+	setUp := testutil.MustParseGame(t, `
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 b - - 0 37"]
+[Result "*"]
+
+37... Kd7 38. e4 Kc6 39. e5 *
+`)
+
+	if number, white := StartingMove(setUp); number != 37 || white {
+		t.Errorf("StartingMove = %d, %v; want 37, false", number, white)
+	}
+
+	tests := []struct {
+		name     string
+		game     *chess.Game
+		plies    int
+		spanned  int
+		lastMove uint
+		whitePly int // ply of White's move lastMove
+		blackPly int // ply of Black's move lastMove
+	}{
+		{"from start, 3 plies", fromStart, 3, 2, 2, 3, 4},
+		{"set up, 1 ply", setUp, 1, 1, 37, 0, 1},
+		{"set up, 4 plies", setUp, 4, 3, 39, 4, 5},
+		{"set up, 5 plies", setUp, 5, 3, 39, 4, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MovesSpanned(tt.game, tt.plies); got != tt.spanned {
+				t.Errorf("MovesSpanned = %d, want %d", got, tt.spanned)
+			}
+			if got := MoveNumberOfPly(tt.game, tt.plies); got != tt.lastMove {
+				t.Errorf("MoveNumberOfPly = %d, want %d", got, tt.lastMove)
+			}
+			if got := PlyOfMove(tt.game, int(tt.lastMove), true); got != tt.whitePly {
+				t.Errorf("PlyOfMove(%d, white) = %d, want %d", tt.lastMove, got, tt.whitePly)
+			}
+			if got := PlyOfMove(tt.game, int(tt.lastMove), false); got != tt.blackPly {
+				t.Errorf("PlyOfMove(%d, black) = %d, want %d", tt.lastMove, got, tt.blackPly)
+			}
+		})
+	}
+}
+
+// TestAnalyzeGame_ReplayError verifies analysis records where replay stopped
+func TestAnalyzeGame_ReplayError(t *testing.T) {
 	game := testutil.ParseTestGame(`
 [Event "Test"]
 [Site "Test"]
@@ -141,22 +259,24 @@ func TestReplayGame(t *testing.T) {
 [Black "B"]
 [Result "*"]
 
-1. e4 *
+1. e4 e5 2. Ke3 *
 `)
 	if game == nil {
 		t.Fatal("Failed to parse test game")
 	}
 
-	board := ReplayGame(game)
+	board, analysis := AnalyzeGame(game)
 
-	if board == nil {
-		t.Fatal("Expected non-nil board")
+	if analysis.ReplayErr == nil {
+		t.Fatal("Expected ReplayErr for illegal move")
 	}
 
-	// After 1. e4, the e4 square should have a white pawn
-	piece := board.Get('e', '4')
-	if piece != chess.W(chess.Pawn) {
-		t.Errorf("Expected white pawn on e4, got %v", piece)
+	// Board stops after 1... e5
+	if piece := board.Get('e', '5'); piece != chess.B(chess.Pawn) {
+		t.Errorf("Expected black pawn on e5, got %v", piece)
+	}
+	if piece := board.Get('e', '1'); piece != chess.W(chess.King) {
+		t.Errorf("Expected white king on e1, got %v", piece)
 	}
 }
 
@@ -201,3 +321,321 @@ func TestValidationResult_Fields(t *testing.T) {
 		t.Errorf("ParseErrors length = %d, want 2", len(result.ParseErrors))
 	}
 }
+
+func TestFlipColours(t *testing.T) {
+	game := testutil.ParseTestGame(`
+[Event "Test"]
+[White "A"]
+[Black "B"]
+[BlackElo "2700"]
+[Result "0-1"]
+
+1. e4 c5 2. Nf3 (2. d4 cxd4) 2... d6 3. O-O e5 0-1
+`)
+	if game == nil {
+		t.Fatal("Failed to parse test game")
+	}
+
+	FlipColours(game)
+
+	if game.White() != "B" || game.Black() != "A" || game.Tags["WhiteElo"] != "2700" {
+		t.Errorf("tags not swapped: %v", game.Tags)
+	}
+	if game.Result() != "1-0" || game.Tags["Flipped"] != "1" {
+		t.Errorf("Result = %q, Flipped = %q; want 1-0, 1", game.Result(), game.Tags["Flipped"])
+	}
+	if want := "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 0 1"; game.FEN() != want {
+		t.Errorf("FEN = %q, want %q", game.FEN(), want)
+	}
+
+	var texts []string
+	for move := game.Moves; move != nil; move = move.Next {
+		texts = append(texts, move.Text)
+	}
+	if got, want := strings.Join(texts, " "), "e5 c4 Nf6 d3 O-O e4"; got != want {
+		t.Errorf("moves = %q, want %q", got, want)
+	}
+	if v := game.Moves.Next.Next.Variations[0].Moves; v.Text != "d5" || v.Next.Text != "cxd5" {
+		t.Errorf("variation = %q %q, want d5 cxd5", v.Text, v.Next.Text)
+	}
+
+	if _, _, err := engine.ReplayGame(game); err != nil {
+		t.Errorf("flipped game does not replay: %v", err)
+	}
+}
+
+func TestAddMaterialComments(t *testing.T) {
+	game := testutil.ParseTestGame(`
+[Event "Test"]
+[Result "*"]
+
+1. e4 d5 2. exd5 Qxd5 3. Nc3 Qa5 4. d4 Nf6 *
+`)
+	if game == nil {
+		t.Fatal("Failed to parse test game")
+	}
+
+	AddMaterialComments(game, 2, &matching.StandardPieceValues)
+
+	var got []string
+	for move := game.Moves; move != nil; move = move.Next {
+		for _, comment := range move.Comments {
+			got = append(got, move.Text+" "+comment.Text)
+		}
+	}
+	want := []string{"Qxd5 material: 0", "Nf6 material: 0"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("comments = %q, want %q", got, want)
+	}
+}
+
+func TestExtractFeatures(t *testing.T) {
+	game := testutil.ParseTestGame(`
+[Event "Test"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 Nc6 3. Bc4 Qe7 4. Qxf7+ Qxf7 5. Bxf7+ Kxf7 6. Nf3 d6 1-0
+`)
+	if game == nil {
+		t.Fatal("Failed to parse test game")
+	}
+
+	f := ExtractFeatures(game, &matching.StandardPieceValues)
+	if f.Plies != 12 || f.FirstCapturePly != 7 || f.QueenTradePly != 9 {
+		t.Errorf("plies/capture/trade = %d/%d/%d, want 12/7/9", f.Plies, f.FirstCapturePly, f.QueenTradePly)
+	}
+	if f.WhiteChecks != 2 || f.BlackChecks != 0 {
+		t.Errorf("checks = %d/%d, want 2/0", f.WhiteChecks, f.BlackChecks)
+	}
+	if f.WhiteCastle != "" || f.BlackCastle != "" || len(f.MaterialAt) != 0 {
+		t.Errorf("unexpected castling %q/%q or checkpoints %v", f.WhiteCastle, f.BlackCastle, f.MaterialAt)
+	}
+	if f.FinalMaterial != -200 {
+		t.Errorf("FinalMaterial = %d, want -200", f.FinalMaterial)
+	}
+}
+
+func TestReconcilePairs(t *testing.T) {
+	parse := func(pgn string) *chess.Game {
+		game := testutil.ParseTestGame(pgn)
+		if game == nil {
+			t.Fatalf("Failed to parse test game:\n%s", pgn)
+		}
+		return game
+	}
+	white := parse("[Event \"M\"]\n[Round \"1\"]\n[Board \"1\"]\n[White \"A\"]\n[Black \"B\"]\n[Result \"*\"]\n\n1. e4 e5 2. Nf3 *\n")
+	black := parse("[Event \"M\"]\n[Round \"1\"]\n[Board \"1\"]\n[White \"A\"]\n[Black \"B\"]\n[Date \"2024.05.01\"]\n[Result \"1-0\"]\n\n1. e4 e5 2. Nf3 Nc6 3. Bb5 1-0\n")
+	other := parse("[Event \"M\"]\n[Round \"1\"]\n[Board \"2\"]\n[White \"C\"]\n[Black \"D\"]\n[Result \"0-1\"]\n\n1. d4 d5 0-1\n")
+	diverged := parse("[Event \"M\"]\n[Round \"1\"]\n[Board \"2\"]\n[White \"C\"]\n[Black \"D\"]\n[Result \"0-1\"]\n\n1. d4 Nf6 0-1\n")
+
+	games, discrepancies := ReconcilePairs([]*chess.Game{white, other, black, diverged})
+	if len(games) != 2 {
+		t.Fatalf("got %d games, want 2", len(games))
+	}
+	merged := games[0]
+	if CountPlies(merged) != 5 || merged.Result() != "1-0" || merged.Date() != "2024.05.01" {
+		t.Errorf("merged game: plies %d, result %q, date %q", CountPlies(merged), merged.Result(), merged.Date())
+	}
+	if len(discrepancies) != 1 || discrepancies[0].String() != "M|1|2|c|d: moves differ at ply 2: d5 vs Nf6" {
+		t.Errorf("discrepancies = %v", discrepancies)
+	}
+
+	// Board 1 of two matches in the same team round is two games, and a
+	// Round of "?" says nothing about which round a game is from.
+	team := []*chess.Game{
+		parse("[Event \"League\"]\n[Round \"3\"]\n[Board \"1\"]\n[White \"A\"]\n[Black \"B\"]\n[Result \"1-0\"]\n\n1. e4 1-0\n"),
+		parse("[Event \"League\"]\n[Round \"3\"]\n[Board \"1\"]\n[White \"C\"]\n[Black \"D\"]\n[Result \"0-1\"]\n\n1. d4 0-1\n"),
+		parse("[Event \"League\"]\n[Round \"?\"]\n[White \"E\"]\n[Black \"F\"]\n[Result \"1-0\"]\n\n1. c4 1-0\n"),
+		parse("[Event \"League\"]\n[Round \"?\"]\n[White \"E\"]\n[Black \"F\"]\n[Result \"0-1\"]\n\n1. Nf3 0-1\n"),
+	}
+	games, discrepancies = ReconcilePairs(team)
+	if len(games) != len(team) || len(discrepancies) != 0 {
+		t.Errorf("team round: got %d games and %v, want %d unpaired games", len(games), discrepancies, len(team))
+	}
+
+	// Three games on one pairing are reported, not merged.
+	three := []*chess.Game{white, black, parse("[Event \"M\"]\n[Round \"1\"]\n[Board \"1\"]\n[White \"A\"]\n[Black \"B\"]\n[Result \"*\"]\n\n1. c4 *\n")}
+	games, discrepancies = ReconcilePairs(three)
+	if len(games) != 3 || len(discrepancies) != 1 || discrepancies[0].String() != "M|1|1|a|b: 3 games share the pairing, none merged" {
+		t.Errorf("three copies: got %d games and %v, want 3 games and one report", len(games), discrepancies)
+	}
+
+	// Without a Board tag, games with an unknown player are never paired.
+	unknown := []*chess.Game{
+		parse("[Event \"M\"]\n[Round \"2\"]\n[White \"?\"]\n[Black \"?\"]\n[Result \"1-0\"]\n\n1. e4 1-0\n"),
+		parse("[Event \"M\"]\n[Round \"2\"]\n[White \"?\"]\n[Black \"?\"]\n[Result \"0-1\"]\n\n1. d4 0-1\n"),
+		parse("[Event \"M\"]\n[Round \"2\"]\n[White \"A\"]\n[Black \"?\"]\n[Result \"0-1\"]\n\n1. c4 0-1\n"),
+		parse("[Event \"M\"]\n[Round \"2\"]\n[White \"A\"]\n[Black \"?\"]\n[Result \"0-1\"]\n\n1. c4 0-1\n"),
+	}
+	games, discrepancies = ReconcilePairs(unknown)
+	if len(games) != len(unknown) || len(discrepancies) != 0 {
+		t.Errorf("unknown players: got %d games and %v, want %d unpaired games", len(games), discrepancies, len(unknown))
+	}
+}
+
+// TestSortGames verifies numeric, round and date aware sorting
+func TestSortGames(t *testing.T) {
+	newGame := func(name string, tags ...string) *chess.Game {
+		game := chess.NewGame()
+		game.SetTag("White", name)
+		for i := 0; i+1 < len(tags); i += 2 {
+			game.SetTag(tags[i], tags[i+1])
+		}
+		return game
+	}
+	games := []*chess.Game{
+		newGame("a", "WhiteElo", "950", "Round", "10", "Date", "2019.07.05"),
+		newGame("b", "WhiteElo", "2700", "Round", "9", "Date", "2019.??.??"),
+		newGame("c", "Round", "9.2", "Date", "2018.12.01"),
+		newGame("d", "WhiteElo", "2700", "Round", "?", "Date", "????.??.??"),
+	}
+
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"WhiteElo", "abdc"},
+		{"-WhiteElo", "bdac"},
+		{"-WhiteElo,Round", "bdac"},
+		{"-WhiteElo,-Date", "bdac"},
+		{"Round", "bcad"},
+		{"-Round", "acbd"},
+		{"Date", "cbad"},
+		{"-Date", "abcd"},
+	}
+	for _, tt := range tests {
+		keys, err := ParseSortKeys(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseSortKeys(%q): %v", tt.spec, err)
+		}
+		sorted := append([]*chess.Game(nil), games...)
+		SortGames(sorted, keys)
+		var got strings.Builder
+		for _, game := range sorted {
+			got.WriteString(game.White())
+		}
+		if got.String() != tt.want {
+			t.Errorf("--sort %s: got order %s, want %s", tt.spec, got.String(), tt.want)
+		}
+	}
+
+	if _, err := ParseSortKeys("Date,,Round"); err == nil {
+		t.Error("ParseSortKeys accepted an empty key")
+	}
+}
+
+func TestEvalSwings(t *testing.T) {
+	games := testutil.MustParseGames(t, `
+[Event "Swings"]
+
+1. e4 {[%eval 0.3]} e5 {[%eval 0.35]} 2. Qh5 {[%eval -0.4]} Nc6 {[%eval -0.2]}
+3. Bc4 {[%eval -0.1]} Nf6 {[%eval #1]} 4. Qxf7# *
+`)
+	swings := EvalSwings(games[0], 50)
+	if len(swings) != 2 {
+		t.Fatalf("EvalSwings() = %d swings, want 2: %+v", len(swings), swings)
+	}
+	// 2. Qh5 loses 0.75 for White; 3... Nf6 allows mate, capped at 10 pawns
+	if swings[0].Ply != 3 || swings[0].Loss != 75 {
+		t.Errorf("first swing = ply %d, loss %d; want ply 3, loss 75", swings[0].Ply, swings[0].Loss)
+	}
+	if swings[1].Ply != 6 || swings[1].Loss != EvalCap+10 {
+		t.Errorf("second swing = ply %d, loss %d; want ply 6, loss %d", swings[1].Ply, swings[1].Loss, EvalCap+10)
+	}
+
+	swings[1].Move.AppendNAG("$6")
+	MarkEvalSwings(swings, 100)
+	if got := swings[0].Move.NAGs; len(got) != 1 || got[0].Text[0] != "$2" {
+		t.Errorf("mistake NAGs = %v, want [$2]", got)
+	}
+	if got := swings[1].Move.NAGs; len(got) != 1 {
+		t.Errorf("move already judged was marked again: %v", got)
+	}
+}
+
+func TestMoveEval(t *testing.T) {
+	tests := []struct {
+		comment string
+		want    int
+		ok      bool
+	}{
+		{"[%eval 0.25]", 25, true},
+		{"[%clk 0:01:00] [%eval -1.5]", -150, true},
+		{"[%eval 24.5]", EvalCap, true},
+		{"[%eval #-3]", -EvalCap, true},
+		{"good move", 0, false},
+	}
+	for _, tt := range tests {
+		move := &chess.Move{Text: "e4"}
+		move.AppendComment(tt.comment)
+		got, ok := MoveEval(move)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("MoveEval(%q) = %d, %v; want %d, %v", tt.comment, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestGamePhase(t *testing.T) {
+	tests := []struct {
+		fen  string
+		want Phase
+	}{
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1", Opening},
+		// Everything developed but the queens and rooks
+		{"r2q1rk1/ppp2ppp/2nbbn2/3pp3/3PP3/2NBBN2/PPP2PPP/R2Q1RK1 w - - 0 8", Opening},
+		// White's queen leaves the back rank
+		{"r2q1rk1/ppp2ppp/2nbbn2/3pp3/3PP3/2NBBN2/PPPQ1PPP/R4RK1 b - - 0 8", Middlegame},
+		{"r2qr1k1/ppp2ppp/2n5/3pp3/3PP3/2N5/PPP2PPP/R2QR1K1 w - - 0 15", Middlegame},
+		{"4r1k1/ppp2ppp/2n5/8/8/2N5/PPP2PPP/4R1K1 w - - 0 30", Endgame},
+	}
+	for _, tt := range tests {
+		board, err := engine.NewBoardFromFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := GamePhase(board); got != tt.want {
+			t.Errorf("GamePhase(%s) = %v, want %v", tt.fen, got, tt.want)
+		}
+	}
+}
+
+func TestFindDecisiveMistake(t *testing.T) {
+	tests := []struct {
+		name  string
+		pgn   string
+		ply   int
+		phase Phase
+		ok    bool
+	}{
+		{"opening blunder", `[Result "1-0"]
+
+1. e4 {[%eval 0.3]} e5 {[%eval 0.3]} 2. Bc4 {[%eval 0.2]} Nc6 {[%eval 0.2]}
+3. Qh5 {[%eval 0.0]} Nf6 {[%eval #1]} 4. Qxf7# 1-0`, 6, Opening, true},
+		{"recovered before the loss", `[Result "0-1"]
+
+1. f3 {[%eval -0.8]} e5 {[%eval -0.7]} 2. g4 {[%eval #-1]} Qh4# 0-1`, 3, Opening, true},
+		{"unevaluated moves keep the run", `[Result "0-1"]
+
+1. e4 {[%eval 0.3]} e5 {[%eval 0.3]} 2. Ke2 {[%eval -3.5]} Nc6 3. Ke1 {[%eval -3.2]} 0-1`, 3, Opening, true},
+		{"lost on time while equal", `[Result "1-0"]
+
+1. e4 {[%eval 0.3]} e5 {[%eval 0.3]} 1-0`, 0, Opening, false},
+		{"draw", `[Result "1/2-1/2"]
+
+1. e4 {[%eval 0.3]} e5 {[%eval -5]} 1/2-1/2`, 0, Opening, false},
+		{"no evaluations", `[Result "1-0"]
+
+1. e4 e5 1-0`, 0, Opening, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mistake, ok := FindDecisiveMistake(testutil.MustParseGame(t, tt.pgn))
+			if ok != tt.ok {
+				t.Fatalf("FindDecisiveMistake() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && (mistake.Ply != tt.ply || mistake.Phase != tt.phase) {
+				t.Errorf("FindDecisiveMistake() = ply %d in the %v, want ply %d in the %v", mistake.Ply, mistake.Phase, tt.ply, tt.phase)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package processing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/matching"
+)
+
+// Discrepancy records a disagreement between two copies of the same game,
+// or more than two games sharing a pairing key.
+type Discrepancy struct {
+	Key    string // the pairing key, e.g. "Match|3|2|alpha|beta"
+	Tag    string // the tag that differs, or "" for a move difference
+	Ply    int    // first differing ply for a move difference
+	Values [2]string
+	Games  int // games sharing the key when there are more than two
+}
+
+// String describes the discrepancy for diagnostics.
+func (d Discrepancy) String() string {
+	if d.Games > 0 {
+		return fmt.Sprintf("%s: %d games share the pairing, none merged", d.Key, d.Games)
+	}
+	if d.Tag != "" {
+		return fmt.Sprintf("%s: tag %s differs: %q vs %q", d.Key, d.Tag, d.Values[0], d.Values[1])
+	}
+	return fmt.Sprintf("%s: moves differ at ply %d: %s vs %s", d.Key, d.Ply, d.Values[0], d.Values[1])
+}
+
+// PairingKey identifies a game played in a round of an event: Event,
+// Round and Board, if there is one, with the two players, normalized so
+// that spelling variants such as "B." and "b" agree. When a game with a
+// Board tag has an unknown player, the WhiteTeam and BlackTeam tags stand
+// in for the players, as the same board is played in every match of a
+// team round. It returns "" when the Event or Round is unknown, or when
+// neither the players nor the teams are known, as such games cannot be
+// told apart.
+func PairingKey(game *chess.Game) string {
+	if unknownTag(game.Event()) || unknownTag(game.Round()) {
+		return ""
+	}
+	key := []string{game.Event(), game.Round()}
+	board := game.GetTag("Board")
+	if board != "" {
+		key = append(key, board)
+	}
+
+	var sides []string
+	switch {
+	case !unknownTag(game.White()) && !unknownTag(game.Black()):
+		sides = []string{game.White(), game.Black()}
+	case board != "" && !unknownTag(game.GetTag("WhiteTeam")) && !unknownTag(game.GetTag("BlackTeam")):
+		sides = []string{game.GetTag("WhiteTeam"), game.GetTag("BlackTeam")}
+	default:
+		return ""
+	}
+	for i, side := range sides {
+		sides[i] = matching.NormalizePlayerName(side)
+	}
+	sort.Strings(sides)
+	return strings.Join(append(key, sides...), "|")
+}
+
+// unknownTag reports whether a tag value names nothing.
+func unknownTag(value string) bool {
+	value = strings.TrimSpace(value)
+	return value == "" || value == "?"
+}
+
+// ReconcilePairs merges pairs of games that share a PairingKey, such as
+// the White and Black scoresheets of one board, into a single game placed
+// where the first copy was. The copy with more moves supplies the moves;
+// tags missing from it are filled in from the other, and a "*" result is
+// replaced by a decided one. Tag conflicts and diverging moves are returned
+// as discrepancies. Games without a partner or without a pairing key are
+// passed through unchanged, and so are the games of a key shared by more
+// than two, which is reported as a discrepancy instead.
+func ReconcilePairs(games []*chess.Game) ([]*chess.Game, []Discrepancy) {
+	keys := make([]string, len(games))
+	count := make(map[string]int)
+	for i, game := range games {
+		keys[i] = PairingKey(game)
+		count[keys[i]]++
+	}
+
+	first := make(map[string]int)
+	var merged []*chess.Game
+	var discrepancies []Discrepancy
+
+	for n, game := range games {
+		key := keys[n]
+		if key == "" || count[key] > 2 {
+			if _, reported := first[key]; key != "" && !reported {
+				first[key] = -1
+				discrepancies = append(discrepancies, Discrepancy{Key: key, Games: count[key]})
+			}
+			merged = append(merged, game)
+			continue
+		}
+		i, seen := first[key]
+		if !seen {
+			first[key] = len(merged)
+			merged = append(merged, game)
+			continue
+		}
+		var found []Discrepancy
+		merged[i], found = mergeCopies(key, merged[i], game)
+		discrepancies = append(discrepancies, found...)
+	}
+	return merged, discrepancies
+}
+
+// mergeCopies merges two copies of a game.
+func mergeCopies(key string, a, b *chess.Game) (*chess.Game, []Discrepancy) {
+	var found []Discrepancy
+
+	if ply, aMove, bMove := FirstMoveDifference(a, b); ply > 0 && aMove != "" && bMove != "" {
+		found = append(found, Discrepancy{Key: key, Ply: ply, Values: [2]string{aMove, bMove}})
+	}
+
+	tags := make([]string, 0, len(a.Tags))
+	for tag := range a.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		if tag == "Result" && (a.Tags[tag] == "*" || b.Tags[tag] == "*") {
+			continue // an unfinished copy does not contradict a decided one
+		}
+		if other, ok := b.Tags[tag]; ok && other != a.Tags[tag] {
+			found = append(found, Discrepancy{Key: key, Tag: tag, Values: [2]string{a.Tags[tag], other}})
+		}
+	}
+
+	base, other := a, b
+	if CountPlies(b) > CountPlies(a) {
+		base, other = b, a
+	}
+	for tag, value := range other.Tags {
+		if !base.HasTag(tag) {
+			base.SetTag(tag, value)
+		}
+	}
+	if base.Result() == "*" && other.Result() != "*" && other.Result() != "" {
+		base.SetTag("Result", other.Result())
+		if last := base.LastMove(); last != nil {
+			last.TerminatingResult = other.Result()
+		}
+	}
+	return base, found
+}
+
+// FirstMoveDifference compares the main lines of two games, ignoring check
+// marks, and returns the first ply at which they differ with the move each
+// game has there ("" past its end). It returns 0 if the lines are equal.
+func FirstMoveDifference(a, b *chess.Game) (ply int, aMove, bMove string) {
+	am, bm := a.Moves, b.Moves
+	for ply = 1; am != nil || bm != nil; ply++ {
+		aMove, bMove = moveText(am), moveText(bm)
+		if am == nil || bm == nil || aMove != bMove {
+			return ply, aMove, bMove
+		}
+		am, bm = am.Next, bm.Next
+	}
+	return 0, "", ""
+}
+
+// moveText returns a move's text without check marks, or "" for nil.
+func moveText(move *chess.Move) string {
+	if move == nil {
+		return ""
+	}
+	return strings.TrimRight(move.Text, "+#")
+}
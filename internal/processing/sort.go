@@ -0,0 +1,143 @@
+package processing
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// SortKey is one criterion of a game sort: a tag, compared in descending
+// order if Descending.
+type SortKey struct {
+	Tag        string
+	Descending bool
+}
+
+// numericSortTags are compared as integers rather than as text, so that
+// "2700" sorts after "950".
+var numericSortTags = map[string]bool{
+	"WhiteElo": true,
+	"BlackElo": true,
+	"PlyCount": true,
+	"Board":    true,
+}
+
+// ParseSortKeys parses a comma-separated list of tag names, each optionally
+// prefixed with "-" for descending order, e.g. "Date,-WhiteElo".
+func ParseSortKeys(spec string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		key := SortKey{Tag: strings.TrimPrefix(field, "-")}
+		key.Descending = key.Tag != field
+		if key.Tag == "" {
+			return nil, fmt.Errorf("empty sort key in %q", spec)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// SortGames sorts games by the keys in turn, keeping the input order of
+// games that compare equal. Games missing a key's value sort after those
+// that have one, in either direction.
+func SortGames(games []*chess.Game, keys []SortKey) {
+	sort.SliceStable(games, func(i, j int) bool {
+		for _, key := range keys {
+			a, b := sortValue(games[i], key.Tag), sortValue(games[j], key.Tag)
+			switch {
+			case a == "" && b == "":
+				continue
+			case a == "":
+				return false
+			case b == "":
+				return true
+			}
+			c := compareSortValues(key.Tag, a, b)
+			if c == 0 {
+				continue
+			}
+			return (c < 0) != key.Descending
+		}
+		return false
+	})
+}
+
+// sortValue returns the value a game is sorted on for a tag, or "" if it
+// is unknown. A missing PlyCount is counted from the moves.
+func sortValue(game *chess.Game, tag string) string {
+	value := strings.TrimSpace(game.GetTag(tag))
+	if tag == "PlyCount" && value == "" {
+		return strconv.Itoa(game.PlyCount())
+	}
+	if strings.Trim(value, "?.-") == "" {
+		return ""
+	}
+	return value
+}
+
+// compareSortValues compares two known values of a tag. Numeric tags
+// compare as integers, Round compares each dotted part numerically and Date
+// compares year, month and day with "??" parts before known ones. Values
+// that do not fit their tag's form compare as text.
+func compareSortValues(tag, a, b string) int {
+	switch {
+	case numericSortTags[tag]:
+		x, errA := strconv.Atoi(a)
+		y, errB := strconv.Atoi(b)
+		if errA == nil && errB == nil {
+			return compareInts(x, y)
+		}
+	case tag == "Round" || tag == "Date" || tag == "EventDate" || tag == "UTCDate":
+		if c, ok := compareDottedNumbers(a, b); ok {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// compareDottedNumbers compares values such as "3.10" and "3.9" or
+// "2019.07.??" part by part. A part of question marks counts as zero. It
+// reports false if a part is neither a number nor unknown.
+func compareDottedNumbers(a, b string) (int, bool) {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		if i >= len(partsA) {
+			return -1, true
+		}
+		if i >= len(partsB) {
+			return 1, true
+		}
+		x, okA := dottedPart(partsA[i])
+		y, okB := dottedPart(partsB[i])
+		if !okA || !okB {
+			return 0, false
+		}
+		if c := compareInts(x, y); c != 0 {
+			return c, true
+		}
+	}
+	return 0, true
+}
+
+// dottedPart reads one part of a dotted value, with "??" as zero.
+func dottedPart(part string) (int, bool) {
+	if part != "" && strings.Trim(part, "?") == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(part)
+	return n, err == nil
+}
+
+func compareInts(x, y int) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
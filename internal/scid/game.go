@@ -0,0 +1,228 @@
+package scid
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+)
+
+// Special bytes of the move data. A move byte holds the number of the
+// piece moved in its high four bits and a piece-specific move code in its
+// low four bits; these values would be impossible king moves.
+const (
+	encodeNAG         = 11
+	encodeComment     = 12 // the preceding move, or the line, has a comment
+	encodeStartMarker = 13 // a variation of the preceding move starts
+	encodeEndMarker   = 14 // the current variation ends
+	encodeEndGame     = 15
+)
+
+// gameFlagStart marks a game that starts from its own position, given as
+// a FEN string after the flags byte.
+const gameFlagStart = 1
+
+// Tag name lengths above maxTagLength stand for common tag names.
+const maxTagLength = 240
+
+// commonTags are the tag names stored as the single bytes 241 onwards.
+var commonTags = []string{
+	"WhiteCountry", "BlackCountry", "Annotator", "PlyCount", "EventDate",
+	"Opening", "Variation", "Setup", "Source", "SetUp",
+}
+
+// binaryEventDate is a tag name length marking an EventDate stored in
+// three bytes, which is skipped.
+const binaryEventDate = 255
+
+var errCorrupt = errors.New("corrupt game data")
+
+// decodeGame returns the PGN text of a game from its index entry and its
+// data in the .sg4 file.
+func (db *Database) decodeGame(e *indexEntry, data []byte) (string, error) {
+	r := &byteReader{data: data}
+	var sb strings.Builder
+	writeTag := func(name, value string) {
+		value = strings.ReplaceAll(strings.ReplaceAll(value, `\`, `\\`), `"`, `\"`)
+		fmt.Fprintf(&sb, "[%s \"%s\"]\n", name, value)
+	}
+	result := resultString(e.result)
+	writeTag("Event", db.name(nameEvent, e.event))
+	writeTag("Site", db.name(nameSite, e.site))
+	writeTag("Date", dateString(e.date))
+	writeTag("Round", db.name(nameRound, e.round))
+	writeTag("White", db.name(namePlayer, e.white))
+	writeTag("Black", db.name(namePlayer, e.black))
+	writeTag("Result", result)
+	if e.whiteElo != 0 {
+		writeTag("WhiteElo", strconv.Itoa(int(e.whiteElo)))
+	}
+	if e.blackElo != 0 {
+		writeTag("BlackElo", strconv.Itoa(int(e.blackElo)))
+	}
+	if e.eco != 0 {
+		writeTag("ECO", ecoString(e.eco))
+	}
+
+	hasSetUp := false
+	for {
+		length := int(r.byte())
+		if length == 0 || r.err != nil {
+			break
+		}
+		if length == binaryEventDate {
+			r.bytes(3)
+			continue
+		}
+		var name string
+		if length > maxTagLength {
+			if length-maxTagLength > len(commonTags) {
+				return "", fmt.Errorf("%w: unknown tag code %d", errCorrupt, length)
+			}
+			name = commonTags[length-maxTagLength-1]
+		} else {
+			name = string(r.bytes(length))
+		}
+		value := string(r.bytes(int(r.byte())))
+		if name == "SetUp" {
+			hasSetUp = true
+		}
+		writeTag(name, value)
+	}
+
+	pos := newStandardPosition()
+	if flags := r.byte(); flags&gameFlagStart != 0 {
+		fen := r.cstring()
+		fenBoard, err := engine.NewBoardFromFEN(fen)
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid start position %q", errCorrupt, fen)
+		}
+		if !hasSetUp {
+			writeTag("SetUp", "1")
+		}
+		writeTag("FEN", fen)
+		pos = newFENPosition(fenBoard)
+	}
+	if r.err != nil {
+		return "", r.err
+	}
+
+	d := &gameDecoder{r: r}
+	if err := d.line(pos, 0); err != nil {
+		return "", err
+	}
+	for _, i := range d.comments {
+		d.tokens[i] = "{" + strings.ReplaceAll(r.cstring(), "}", ")") + "}"
+	}
+	if r.err != nil {
+		return "", r.err
+	}
+
+	sb.WriteByte('\n')
+	for _, token := range d.tokens {
+		sb.WriteString(token)
+		sb.WriteByte(' ')
+	}
+	sb.WriteString(result)
+	sb.WriteByte('\n')
+	return sb.String(), nil
+}
+
+// gameDecoder turns move data into movetext tokens. Comments are stored
+// after all the moves, so their tokens are filled in afterwards, in the
+// order of the comment markers.
+type gameDecoder struct {
+	r        *byteReader
+	tokens   []string
+	comments []int // indexes in tokens of comments, in file order
+}
+
+// line decodes moves from pos until the end of the line, recursing into
+// variations. Depth 0 is the main line.
+func (d *gameDecoder) line(pos *position, depth int) error {
+	var before position // the position before the last move
+	played, needNumber := false, true
+	for {
+		b := d.r.byte()
+		if d.r.err != nil {
+			return d.r.err
+		}
+		switch b {
+		case encodeEndGame, encodeEndMarker:
+			if (b == encodeEndGame) != (depth == 0) {
+				return fmt.Errorf("%w: misplaced end of line", errCorrupt)
+			}
+			return nil
+		case encodeNAG:
+			d.tokens = append(d.tokens, "$"+strconv.Itoa(int(d.r.byte())))
+		case encodeComment:
+			d.comments = append(d.comments, len(d.tokens))
+			d.tokens = append(d.tokens, "")
+			needNumber = true
+		case encodeStartMarker:
+			if !played {
+				return fmt.Errorf("%w: variation before any move", errCorrupt)
+			}
+			variation := before
+			d.tokens = append(d.tokens, "(")
+			if err := d.line(&variation, depth+1); err != nil {
+				return err
+			}
+			d.tokens = append(d.tokens, ")")
+			needNumber = true
+		default:
+			before = *pos
+			number := pos.board.MoveNumber
+			white := pos.board.ToMove == chess.White
+			san, err := pos.play(b, d.r)
+			if err != nil {
+				return err
+			}
+			switch {
+			case white:
+				d.tokens = append(d.tokens, fmt.Sprintf("%d.", number))
+			case needNumber:
+				d.tokens = append(d.tokens, fmt.Sprintf("%d...", number))
+			}
+			d.tokens = append(d.tokens, san)
+			played, needNumber = true, false
+		}
+	}
+}
+
+// resultString returns the PGN result of an index result code.
+func resultString(code byte) string {
+	switch code {
+	case 1:
+		return "1-0"
+	case 2:
+		return "0-1"
+	case 3:
+		return "1/2-1/2"
+	}
+	return "*"
+}
+
+// dateString returns the PGN date of a Scid date, which packs the year,
+// month and day as year<<9 | month<<5 | day, each 0 when unknown.
+func dateString(date uint32) string {
+	year, month, day := date>>9, date>>5&15, date&31
+	part := func(v uint32, width int) string {
+		if v == 0 {
+			return strings.Repeat("?", width)
+		}
+		return fmt.Sprintf("%0*d", width, v)
+	}
+	return part(year, 4) + "." + part(month, 2) + "." + part(day, 2)
+}
+
+// ecoString returns the ECO code, such as "B90", of a Scid ECO value.
+// Scid numbers each of the 500 codes with 131 subcodes (B90a, B90a1 and so
+// on) from 1; the subcode is dropped.
+func ecoString(eco uint16) string {
+	code := int(eco-1) / 131
+	return fmt.Sprintf("%c%02d", 'A'+code/100, code%100)
+}
@@ -0,0 +1,236 @@
+package scid
+
+import (
+	"fmt"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/engine"
+)
+
+// position is a board together with Scid's numbering of each side's
+// pieces, which move bytes refer to. The king is always piece 0. A
+// captured piece's number is taken by the side's last-numbered piece.
+type position struct {
+	board  chess.Board
+	pieces [2][16]int // Scid square, a1 = 0 to h8 = 63, by colour and number
+	count  [2]int
+}
+
+// newStandardPosition returns the initial position, numbered as Scid
+// numbers it: king, the other back-rank pieces from the a-file to the
+// h-file, then the pawns from the a-file.
+func newStandardPosition() *position {
+	pos := &position{board: *engine.NewInitialBoard()}
+	backRank := []int{4, 0, 1, 2, 3, 5, 6, 7}
+	for _, colour := range []chess.Colour{chess.White, chess.Black} {
+		first, pawns := 0, 8
+		if colour == chess.Black {
+			first, pawns = 56, 48
+		}
+		for i, file := range backRank {
+			pos.pieces[colour][i] = first + file
+			pos.pieces[colour][8+i] = pawns + i
+		}
+		pos.count[colour] = 16
+	}
+	return pos
+}
+
+// newFENPosition returns a position set up from a FEN board, numbered as
+// Scid numbers pieces read from FEN: in FEN order, from a8 to h1, with
+// the king moved to the front and the piece it displaces to the end.
+func newFENPosition(board *chess.Board) *position {
+	pos := &position{board: *board}
+	for rank := 7; rank >= 0; rank-- {
+		for file := 0; file < 8; file++ {
+			piece := pos.piece(rank*8 + file)
+			if piece == chess.Empty || piece == chess.Off {
+				continue
+			}
+			colour := chess.ExtractColour(piece)
+			n := pos.count[colour]
+			if n == len(pos.pieces[colour]) {
+				continue // more than 16 pieces; not a legal Scid position
+			}
+			pos.pieces[colour][n] = rank*8 + file
+			if chess.ExtractPiece(piece) == chess.King && n > 0 {
+				pos.pieces[colour][0], pos.pieces[colour][n] = pos.pieces[colour][n], pos.pieces[colour][0]
+			}
+			pos.count[colour]++
+		}
+	}
+	return pos
+}
+
+// piece returns the coloured piece on a Scid square.
+func (pos *position) piece(sq int) chess.Piece {
+	col, rank := squareCoords(sq)
+	return pos.board.Get(col, rank)
+}
+
+func squareCoords(sq int) (chess.Col, chess.Rank) {
+	return chess.Col('a' + sq%8), chess.Rank('1' + sq/8)
+}
+
+// Square differences of king and knight move codes. King codes 9 and 10
+// castle; king code 0 is a null move.
+var (
+	kingDiffs   = [...]int{0, -9, -8, -7, -1, 1, 7, 8, 9, -2, 2}
+	knightDiffs = [...]int{0, -17, -15, -10, -6, 6, 10, 15, 17}
+)
+
+// Pawn move codes: a capture towards the a-file (for White), a push or a
+// capture towards the h-file, each without and then with promotion to
+// queen, rook, bishop and knight; code 15 is a double push.
+var (
+	pawnDiffs  = [...]int{7, 8, 9, 7, 8, 9, 7, 8, 9, 7, 8, 9, 7, 8, 9, 16}
+	promotions = [...]chess.Piece{chess.Queen, chess.Rook, chess.Bishop, chess.Knight}
+)
+
+// play decodes a move byte, reading a second byte for a queen's diagonal
+// move, plays it and returns its SAN.
+func (pos *position) play(b byte, r *byteReader) (string, error) {
+	colour := pos.board.ToMove
+	number, code := int(b>>4), int(b&15)
+	if number >= pos.count[colour] {
+		return "", fmt.Errorf("%w: no piece %d", errCorrupt, number)
+	}
+	from := pos.pieces[colour][number]
+	pieceType := chess.ExtractPiece(pos.piece(from))
+	file, rank := from%8, from/8
+
+	move := &chess.Move{Class: chess.PieceMove, PieceToMove: pieceType}
+	to := -1
+	switch pieceType {
+	case chess.King:
+		if code == 0 {
+			move.Class = chess.NullMove
+			san := engine.SAN(&pos.board, move)
+			engine.ApplyMove(&pos.board, move)
+			return san, nil
+		}
+		if code < len(kingDiffs) {
+			to = from + kingDiffs[code]
+		}
+		switch code {
+		case 9:
+			move.Class = chess.QueensideCastle
+		case 10:
+			move.Class = chess.KingsideCastle
+		}
+	case chess.Knight:
+		if code >= 1 && code < len(knightDiffs) {
+			to = from + knightDiffs[code]
+		}
+	case chess.Rook:
+		to = rookTarget(file, rank, code)
+	case chess.Bishop:
+		to = bishopTarget(from, code)
+	case chess.Queen:
+		switch {
+		case code >= 8 || code != file:
+			to = rookTarget(file, rank, code)
+		default:
+			to = int(r.byte()) - 64
+		}
+	case chess.Pawn:
+		move.Class = chess.PawnMove
+		if colour == chess.White {
+			to = from + pawnDiffs[code]
+		} else {
+			to = from - pawnDiffs[code]
+		}
+		if code >= 3 && code < 15 {
+			move.Class = chess.PawnMoveWithPromotion
+			move.PromotedPiece = promotions[code/3-1]
+		}
+	}
+	// King, knight and pawn codes are square differences, which can wrap
+	// around the edge of the board.
+	wraps := pieceType == chess.King || pieceType == chess.Knight || pieceType == chess.Pawn
+	if to < 0 || to > 63 || wraps && abs(to%8-file) > 2 {
+		return "", fmt.Errorf("%w: bad move code %d for %v", errCorrupt, code, pieceType)
+	}
+
+	move.FromCol, move.FromRank = squareCoords(from)
+	move.ToCol, move.ToRank = squareCoords(to)
+	if pieceType == chess.Pawn && (move.ToRank == '8' || move.ToRank == '1') != (move.Class == chess.PawnMoveWithPromotion) {
+		return "", fmt.Errorf("%w: bad promotion", errCorrupt)
+	}
+	san := engine.SAN(&pos.board, move)
+	if problem := engine.MoveProblem(&pos.board, move); problem != "" {
+		return "", fmt.Errorf("%w: %s %s", errCorrupt, san, problem)
+	}
+	pos.renumber(colour, number, from, to, move)
+	move.Text = san
+	engine.ApplyMove(&pos.board, move)
+	return san, nil
+}
+
+// renumber updates the piece numbers for a move about to be played.
+func (pos *position) renumber(colour chess.Colour, number, from, to int, move *chess.Move) {
+	enemy := colour.Opposite()
+	switch {
+	case move.Class == chess.KingsideCastle:
+		pos.moveSquare(colour, from+3, from+1)
+	case move.Class == chess.QueensideCastle:
+		pos.moveSquare(colour, from-4, from-1)
+	case pos.piece(to) != chess.Empty:
+		pos.capture(enemy, to)
+	case move.PieceToMove == chess.Pawn && to%8 != from%8:
+		pos.capture(enemy, from-from%8+to%8) // en passant
+	}
+	pos.pieces[colour][number] = to
+}
+
+// moveSquare moves a colour's piece numbered by square, for the rook when
+// castling.
+func (pos *position) moveSquare(colour chess.Colour, from, to int) {
+	for i := 0; i < pos.count[colour]; i++ {
+		if pos.pieces[colour][i] == from {
+			pos.pieces[colour][i] = to
+			return
+		}
+	}
+}
+
+// capture removes a colour's piece on a square, giving its number to the
+// colour's last-numbered piece.
+func (pos *position) capture(colour chess.Colour, sq int) {
+	last := pos.count[colour] - 1
+	for i := 0; i <= last; i++ {
+		if pos.pieces[colour][i] == sq {
+			pos.pieces[colour][i] = pos.pieces[colour][last]
+			pos.count[colour] = last
+			return
+		}
+	}
+}
+
+// rookTarget returns the target of a rook move code: codes 8 to 15 move
+// along the file to rank code-8 and codes 0 to 7 along the rank to file
+// code.
+func rookTarget(file, rank, code int) int {
+	if code >= 8 {
+		return (code-8)*8 + file
+	}
+	return rank*8 + code
+}
+
+// bishopTarget returns the target of a bishop move code, which gives the
+// target file in its low three bits and sets 8 for the a8-h1 diagonal
+// direction.
+func bishopTarget(from, code int) int {
+	fileDiff := code&7 - from%8
+	if code >= 8 {
+		return from - 7*fileDiff
+	}
+	return from + 9*fileDiff
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
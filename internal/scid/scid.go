@@ -0,0 +1,330 @@
+// Package scid reads Scid databases, so that they can be filtered and
+// converted like PGN files without exporting them from Scid first. Only
+// the version 4 format written by Scid and Scid vs. PC is read; the
+// database is never changed.
+package scid
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A Scid 4 database is three big-endian files sharing a base name:
+//
+//	base.si4  index: a 182-byte header (magic "Scid.si\x00", version
+//	          uint16, base type uint32, games uint24, ...), then a
+//	          47-byte entry per game holding its offset and length in
+//	          the .sg4 file, flags, name IDs, result, ECO code, date and
+//	          ratings
+//	base.sn4  names: a 36-byte header (magic "Scid.sn\x00", timestamp,
+//	          then name count and highest frequency of each name type as
+//	          uint24s), then the front-coded player, event, site and
+//	          round names, each with its ID
+//	base.sg4  games: for each game its non-standard tags, a start
+//	          position if it has one, the moves with NAGs and variations,
+//	          then its comments
+const (
+	indexMagic      = "Scid.si\x00"
+	nameMagic       = "Scid.sn\x00"
+	indexHeaderSize = 182
+	indexEntrySize  = 47
+	nameHeaderSize  = 36
+)
+
+// Name types, in the order the .sn4 file lists them.
+const (
+	namePlayer = iota
+	nameEvent
+	nameSite
+	nameRound
+	numNameTypes
+)
+
+// flagDeleted marks a game deleted in Scid but not yet removed by
+// compaction.
+const flagDeleted = 1 << 3
+
+// ErrNotScid is returned when opening files that are not a Scid 4
+// database.
+var ErrNotScid = errors.New("not a Scid 4 database")
+
+// IsDatabase reports whether a path names a Scid database by one of its
+// files.
+func IsDatabase(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".si4", ".sn4", ".sg4":
+		return true
+	}
+	return false
+}
+
+// indexEntry is the index data of one game.
+type indexEntry struct {
+	offset, length     uint32
+	flags              uint16
+	white, black       uint32
+	event, site, round uint32
+	result             byte
+	eco                uint16
+	date               uint32
+	whiteElo, blackElo uint16
+}
+
+// Database is an open Scid database.
+type Database struct {
+	entries []indexEntry
+	names   [numNameTypes][]string
+	games   *os.File
+}
+
+// Open opens the database whose .si4, .sn4 or .sg4 file is named by path.
+func Open(path string) (*Database, error) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	db := &Database{}
+	var err error
+	if db.entries, err = readIndex(base + ".si4"); err != nil {
+		return nil, err
+	}
+	if db.names, err = readNames(base + ".sn4"); err != nil {
+		return nil, err
+	}
+	if db.games, err = os.Open(base + ".sg4"); err != nil { //nolint:gosec // G304: path is user-specified
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close closes the database.
+func (db *Database) Close() error {
+	return db.games.Close()
+}
+
+// NumGames returns the number of games in the index, including deleted
+// ones.
+func (db *Database) NumGames() int {
+	return len(db.entries)
+}
+
+// Deleted reports whether game i (0-based) is marked deleted.
+func (db *Database) Deleted(i int) bool {
+	return db.entries[i].flags&flagDeleted != 0
+}
+
+// GamePGN returns game i (0-based) as PGN text.
+func (db *Database) GamePGN(i int) (string, error) {
+	e := &db.entries[i]
+	data := make([]byte, e.length)
+	if _, err := db.games.ReadAt(data, int64(e.offset)); err != nil {
+		return "", fmt.Errorf("game %d: %w", i+1, err)
+	}
+	text, err := db.decodeGame(e, data)
+	if err != nil {
+		return "", fmt.Errorf("game %d: %w", i+1, err)
+	}
+	return text, nil
+}
+
+// name returns a name by type and ID, or "?" for an unknown ID.
+func (db *Database) name(nameType int, id uint32) string {
+	if names := db.names[nameType]; int(id) < len(names) && names[id] != "" {
+		return names[id]
+	}
+	return "?"
+}
+
+// readIndex reads the entries of a .si4 file.
+func readIndex(path string) ([]indexEntry, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path is user-specified
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < indexHeaderSize || string(data[:8]) != indexMagic {
+		return nil, fmt.Errorf("%s: %w", path, ErrNotScid)
+	}
+	if version := be16(data[8:]); version < 400 || version >= 500 {
+		return nil, fmt.Errorf("%s: version %d: %w", path, version, ErrNotScid)
+	}
+	count := int(be24(data[14:]))
+	if available := (len(data) - indexHeaderSize) / indexEntrySize; available < count {
+		return nil, fmt.Errorf("%s: truncated: %d of %d index entries", path, available, count)
+	}
+
+	entries := make([]indexEntry, count)
+	for i := range entries {
+		b := data[indexHeaderSize+i*indexEntrySize:]
+		entries[i] = indexEntry{
+			offset:   be32(b),
+			length:   uint32(be16(b[4:])) | uint32(b[6]&0x80)<<9,
+			flags:    be16(b[7:]),
+			white:    uint32(b[9]>>4)<<16 | uint32(be16(b[10:])),
+			black:    uint32(b[9]&0x0F)<<16 | uint32(be16(b[12:])),
+			event:    uint32(b[14]>>5)<<16 | uint32(be16(b[15:])),
+			site:     uint32(b[14]>>2&7)<<16 | uint32(be16(b[17:])),
+			round:    uint32(b[14]&3)<<16 | uint32(be16(b[19:])),
+			result:   b[21] >> 4,
+			eco:      be16(b[23:]),
+			date:     be32(b[25:]) & 0xFFFFF,
+			whiteElo: be16(b[29:]) & 0xFFF,
+			blackElo: be16(b[31:]) & 0xFFF,
+		}
+	}
+	return entries, nil
+}
+
+// readNames reads the names of a .sn4 file, indexed by type and ID.
+func readNames(path string) ([numNameTypes][]string, error) {
+	var names [numNameTypes][]string
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path is user-specified
+	if err != nil {
+		return names, err
+	}
+	if len(data) < nameHeaderSize || string(data[:8]) != nameMagic {
+		return names, fmt.Errorf("%s: %w", path, ErrNotScid)
+	}
+	var counts, maxFreqs [numNameTypes]uint32
+	for nt := range counts {
+		counts[nt] = be24(data[12+3*nt:])
+		maxFreqs[nt] = be24(data[24+3*nt:])
+	}
+
+	r := &byteReader{data: data, pos: nameHeaderSize}
+	for nt := range names {
+		names[nt] = make([]string, counts[nt])
+		prev := ""
+		for i := uint32(0); i < counts[nt]; i++ {
+			var id uint32
+			if counts[nt] >= 1<<16 {
+				id = r.uint24()
+			} else {
+				id = uint32(r.uint16())
+			}
+			switch {
+			case maxFreqs[nt] >= 1<<16:
+				r.uint24()
+			case maxFreqs[nt] >= 1<<8:
+				r.uint16()
+			default:
+				r.byte()
+			}
+			length, prefix := int(r.byte()), 0
+			if i > 0 {
+				prefix = int(r.byte())
+			}
+			if prefix > length || prefix > len(prev) {
+				return names, fmt.Errorf("%s: corrupt name %d", path, i)
+			}
+			name := prev[:prefix] + string(r.bytes(length-prefix))
+			if r.err != nil {
+				return names, fmt.Errorf("%s: %w", path, r.err)
+			}
+			if id >= counts[nt] {
+				return names, fmt.Errorf("%s: name ID %d out of range", path, id)
+			}
+			names[nt][id] = name
+			prev = name
+		}
+	}
+	return names, nil
+}
+
+// Reader reads the games of a database as PGN text, skipping deleted
+// games.
+type Reader struct {
+	db      *Database
+	next    int
+	buf     bytes.Buffer
+	onError func(error)
+}
+
+// NewReader returns a reader of the database's games. A game that cannot
+// be decoded is passed to onError, if not nil, and skipped.
+func (db *Database) NewReader(onError func(error)) *Reader {
+	return &Reader{db: db, onError: onError}
+}
+
+// Read reads PGN text, decoding games as it is needed.
+func (r *Reader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if r.next >= r.db.NumGames() {
+			return 0, io.EOF
+		}
+		i := r.next
+		r.next++
+		if r.db.Deleted(i) {
+			continue
+		}
+		text, err := r.db.GamePGN(i)
+		if err != nil {
+			if r.onError != nil {
+				r.onError(err)
+			}
+			continue
+		}
+		r.buf.WriteString(text)
+		r.buf.WriteByte('\n')
+	}
+	return r.buf.Read(p)
+}
+
+// Close closes the database.
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
+
+// OpenReader opens a database and returns a reader of its games.
+func OpenReader(path string, onError func(error)) (*Reader, error) {
+	db, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return db.NewReader(onError), nil
+}
+
+func be16(b []byte) uint16 { return uint16(b[0])<<8 | uint16(b[1]) }
+func be24(b []byte) uint32 { return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]) }
+func be32(b []byte) uint32 { return uint32(b[0])<<24 | be24(b[1:]) }
+
+// errTruncated is recorded by a byteReader that reads past its data.
+var errTruncated = errors.New("unexpected end of data")
+
+// byteReader reads big-endian values from a buffer, recording the first
+// read past its end; reads after that return zeros.
+type byteReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *byteReader) bytes(n int) []byte {
+	if r.err != nil || n > len(r.data)-r.pos {
+		r.err = errTruncated
+		return make([]byte, n)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *byteReader) byte() byte     { return r.bytes(1)[0] }
+func (r *byteReader) uint16() uint16 { return be16(r.bytes(2)) }
+func (r *byteReader) uint24() uint32 { return be24(r.bytes(3)) }
+
+// cstring reads a string ended by a zero byte.
+func (r *byteReader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(r.data[r.pos:], 0)
+	if end < 0 {
+		r.err = errTruncated
+		return ""
+	}
+	s := string(r.data[r.pos : r.pos+end])
+	r.pos += end + 1
+	return s
+}
@@ -0,0 +1,322 @@
+package scid
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/internal/testutil"
+)
+
+// testGame is a game to be written to a test database. Moves are given as
+// encoded bytes so that the tests check the decoder against the format,
+// not against an encoder sharing its assumptions.
+type testGame struct {
+	white, black, event, site, round uint32
+	result                           byte
+	eco                              uint16
+	date                             uint32
+	whiteElo, blackElo               uint16
+	flags                            uint16
+	data                             []byte
+}
+
+// testNames are the player, event, site and round names of the test
+// database, by ID.
+var testNames = [numNameTypes][]string{
+	{"Carlsen, Magnus", "Caruana, Fabiano", "Ding, Liren"},
+	{"Test Open"},
+	{"Oslo NOR"},
+	{"1", "2"},
+}
+
+// testGames are the games of the test database.
+var testGames = []testGame{
+	{
+		white: 0, black: 1, event: 0, site: 0, round: 0, result: 3,
+		eco:  250*131 + 1, // C50
+		date: 2024<<9 | 5<<5 | 17, whiteElo: 2830, blackElo: 2805,
+		data: concat(
+			[]byte{243, 6}, []byte("Editor"), // Annotator
+			[]byte{4}, []byte("Mode"), []byte{3}, []byte("OTB"),
+			[]byte{0, 0}, // end of tags, flags
+			[]byte{
+				0xCF, 0xCF, // 1. e4 e5
+				0x67, encodeNAG, 1, encodeComment, // 2. Nf3 $1 {...}
+				encodeStartMarker, 0x5A, encodeEndMarker, // (2. Bc4)
+				0x22, 0x5A, 0x61, // 2... Nc6 3. Bc4 Nf6
+				0x0A, 0x61, // 4. O-O Nxe4
+				0x74, 0xBF, // 5. Re1 d5
+				0x53, 0x4C, // 6. Bxd5 Qxd5
+				0x28, 0x63, // 7. Nc3 Nxc3
+				0xB0, 0x48, // 8. dxc3 Qxd1
+				0x73, // 9. Rxd1
+				encodeEndGame,
+			},
+			[]byte("the main line\x00"),
+		),
+	},
+	{
+		// Deleted, and not a valid game.
+		white: 1, black: 0, round: 1, result: 1, flags: flagDeleted,
+		data: []byte{0xFF},
+	},
+	{
+		white: 2, black: 0, event: 0, site: 0, round: 1, result: 1,
+		data: concat(
+			[]byte{0, gameFlagStart},
+			[]byte("4k3/P7/8/8/8/8/8/Q3K3 w - - 0 1\x00"),
+			[]byte{
+				0x10, 64 + 63, // 1. Qh8+ (a queen's diagonal move takes two bytes)
+				0x01, // 1... Kd7
+				0x2D, // 2. a8=N
+				encodeEndGame,
+			},
+		),
+	},
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// writeTestDatabase writes a Scid 4 database of games and names, returning
+// the path of its .si4 file.
+func writeTestDatabase(t *testing.T, dir string, games []testGame, names [numNameTypes][]string) string {
+	t.Helper()
+	base := filepath.Join(dir, "test")
+
+	var sg []byte
+	index := make([]byte, indexHeaderSize)
+	copy(index, indexMagic)
+	put16(index[8:], 400)
+	put24(index[14:], uint32(len(games)))
+	for _, g := range games {
+		e := make([]byte, indexEntrySize)
+		put32(e, uint32(len(sg)))
+		put16(e[4:], uint16(len(g.data)))
+		put16(e[7:], g.flags)
+		e[9] = byte(g.white>>16)<<4 | byte(g.black>>16)
+		put16(e[10:], uint16(g.white))
+		put16(e[12:], uint16(g.black))
+		e[14] = byte(g.event>>16)<<5 | byte(g.site>>16)<<2 | byte(g.round>>16)
+		put16(e[15:], uint16(g.event))
+		put16(e[17:], uint16(g.site))
+		put16(e[19:], uint16(g.round))
+		e[21] = g.result << 4
+		put16(e[23:], g.eco)
+		put32(e[25:], g.date)
+		put16(e[29:], g.whiteElo)
+		put16(e[31:], g.blackElo)
+		index = append(index, e...)
+		sg = append(sg, g.data...)
+	}
+
+	sn := make([]byte, nameHeaderSize)
+	copy(sn, nameMagic)
+	for nt, list := range names {
+		put24(sn[12+3*nt:], uint32(len(list)))
+		put24(sn[24+3*nt:], 1)
+		prev := ""
+		for id, name := range list {
+			sn = append(sn, byte(id>>8), byte(id), 1, byte(len(name)))
+			prefix := 0
+			if id > 0 {
+				for prefix < len(name) && prefix < len(prev) && name[prefix] == prev[prefix] {
+					prefix++
+				}
+				sn = append(sn, byte(prefix))
+			}
+			sn = append(sn, name[prefix:]...)
+			prev = name
+		}
+	}
+
+	for ext, data := range map[string][]byte{".si4": index, ".sn4": sn, ".sg4": sg} {
+		if err := os.WriteFile(base+ext, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return base + ".si4"
+}
+
+func put16(b []byte, v uint16) { b[0], b[1] = byte(v>>8), byte(v) }
+func put24(b []byte, v uint32) { b[0], b[1], b[2] = byte(v>>16), byte(v>>8), byte(v) }
+func put32(b []byte, v uint32) { b[0] = byte(v >> 24); put24(b[1:], v) }
+
+func TestDatabase_GamePGN(t *testing.T) {
+	db, err := Open(writeTestDatabase(t, t.TempDir(), testGames, testNames))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	if got := db.NumGames(); got != 3 {
+		t.Fatalf("NumGames() = %d, want 3", got)
+	}
+	if !db.Deleted(1) || db.Deleted(0) {
+		t.Errorf("Deleted() = %v, %v, want false, true", db.Deleted(0), db.Deleted(1))
+	}
+
+	tests := []struct {
+		game int
+		want string
+	}{
+		{0, `[Event "Test Open"]
+[Site "Oslo NOR"]
+[Date "2024.05.17"]
+[Round "1"]
+[White "Carlsen, Magnus"]
+[Black "Caruana, Fabiano"]
+[Result "1/2-1/2"]
+[WhiteElo "2830"]
+[BlackElo "2805"]
+[ECO "C50"]
+[Annotator "Editor"]
+[Mode "OTB"]
+
+1. e4 e5 2. Nf3 $1 {the main line} ( 2. Bc4 ) 2... Nc6 3. Bc4 Nf6 4. O-O Nxe4 5. Re1 d5 6. Bxd5 Qxd5 7. Nc3 Nxc3 8. dxc3 Qxd1 9. Rxd1 1/2-1/2
+`},
+		{2, `[Event "Test Open"]
+[Site "Oslo NOR"]
+[Date "????.??.??"]
+[Round "2"]
+[White "Ding, Liren"]
+[Black "Carlsen, Magnus"]
+[Result "1-0"]
+[SetUp "1"]
+[FEN "4k3/P7/8/8/8/8/8/Q3K3 w - - 0 1"]
+
+1. Qh8+ Kd7 2. a8=N 1-0
+`},
+	}
+	for _, tt := range tests {
+		got, err := db.GamePGN(tt.game)
+		if err != nil {
+			t.Fatalf("GamePGN(%d): %v", tt.game, err)
+		}
+		if got != tt.want {
+			t.Errorf("GamePGN(%d) =\n%s\nwant\n%s", tt.game, got, tt.want)
+		}
+		if game := testutil.ParseTestGame(got); game == nil || game.Moves == nil {
+			t.Errorf("GamePGN(%d) does not parse as PGN", tt.game)
+		}
+	}
+}
+
+// TestFixtureMatchesTestGames checks that testdata/infiles/scid-test.*,
+// which the command's tests read, is the database of testGames.
+func TestFixtureMatchesTestGames(t *testing.T) {
+	dir := t.TempDir()
+	writeTestDatabase(t, dir, testGames, testNames)
+	for _, ext := range []string{".si4", ".sn4", ".sg4"} {
+		want, err := os.ReadFile(filepath.Join(dir, "test"+ext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join("..", "..", "testdata", "infiles", "scid-test"+ext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("scid-test%s differs from the database written from testGames", ext)
+		}
+	}
+}
+
+func TestReader_SkipsDeletedAndBadGames(t *testing.T) {
+	games := append([]testGame{}, testGames...)
+	games = append(games, testGame{data: []byte{0, 0, 0x5A, encodeEndGame}}) // 1. Bc4 with the f-pawn still on f2
+	r, err := OpenReader(writeTestDatabase(t, t.TempDir(), games, testNames), nil)
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	var errs []error
+	r.onError = func(err error) { errs = append(errs, err) }
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	parsed := testutil.ParseTestGames(string(data))
+	if len(parsed) != 2 {
+		t.Fatalf("read %d games, want 2:\n%s", len(parsed), data)
+	}
+	if got := parsed[1].White(); got != "Ding, Liren" {
+		t.Errorf("second game White = %q, want %q", got, "Ding, Liren")
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], errCorrupt) || !strings.HasPrefix(errs[0].Error(), "game 4:") {
+		t.Errorf("errors = %v, want one corrupt game 4 error", errs)
+	}
+}
+
+func TestDatabase_CorruptGames(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"truncated", []byte{0, 0, 0xCF}, errTruncated},
+		{"no such piece", concat([]byte{0, gameFlagStart}, []byte("4k3/8/8/8/8/8/8/4K3 w - - 0 1\x00"), []byte{0x11, encodeEndGame}), errCorrupt},
+		{"blocked", []byte{0, 0, 0x5A, encodeEndGame}, errCorrupt},
+		{"knight off the board", []byte{0, 0, 0x21, encodeEndGame}, errCorrupt},
+		{"unclosed variation", []byte{0, 0, 0xCF, encodeStartMarker, 0xDF, encodeEndGame}, errCorrupt},
+		{"variation first", []byte{0, 0, encodeStartMarker, 0xCF, encodeEndMarker, encodeEndGame}, errCorrupt},
+		{"missing comment", []byte{0, 0, 0xCF, encodeComment, encodeEndGame}, errTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := Open(writeTestDatabase(t, t.TempDir(), []testGame{{data: tt.data}}, testNames))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer db.Close()
+			if _, err := db.GamePGN(0); !errors.Is(err, tt.want) {
+				t.Errorf("GamePGN() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpen_NotScid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "games.si4")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{'x'}, indexHeaderSize), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); !errors.Is(err, ErrNotScid) {
+		t.Errorf("Open() error = %v, want ErrNotScid", err)
+	}
+}
+
+func TestIsDatabase(t *testing.T) {
+	for path, want := range map[string]bool{
+		"games.si4": true, "games.SG4": true, "dir/games.sn4": true,
+		"games.pgn": false, "games.si3": false, "si4": false,
+	} {
+		if got := IsDatabase(path); got != want {
+			t.Errorf("IsDatabase(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestECOAndDateStrings(t *testing.T) {
+	if got := ecoString(1); got != "A00" {
+		t.Errorf("ecoString(1) = %q, want A00", got)
+	}
+	if got := ecoString(499*131 + 5); got != "E99" {
+		t.Errorf("ecoString(E99e) = %q, want E99", got)
+	}
+	if got := dateString(1999 << 9); got != "1999.??.??" {
+		t.Errorf("dateString(1999) = %q, want 1999.??.??", got)
+	}
+}
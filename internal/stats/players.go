@@ -0,0 +1,268 @@
+// Package stats aggregates statistics over the games processed, for
+// report modes that print a summary instead of the games.
+package stats
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/processing"
+)
+
+// ColourRecord counts a player's results with one colour.
+type ColourRecord struct {
+	Games  int `json:"games"`
+	Wins   int `json:"wins"`
+	Draws  int `json:"draws"`
+	Losses int `json:"losses"`
+}
+
+// record counts one game; unfinished games count only as games.
+func (r *ColourRecord) record(score float64, finished bool) {
+	r.Games++
+	switch {
+	case !finished:
+	case score == 1:
+		r.Wins++
+	case score == 0:
+		r.Losses++
+	default:
+		r.Draws++
+	}
+}
+
+// String formats the record as wins/draws/losses.
+func (r ColourRecord) String() string {
+	return fmt.Sprintf("%d/%d/%d", r.Wins, r.Draws, r.Losses)
+}
+
+// PhaseCounts counts lost games by the phase of their decisive mistake.
+type PhaseCounts struct {
+	Opening    int `json:"opening"`
+	Middlegame int `json:"middlegame"`
+	Endgame    int `json:"endgame"`
+}
+
+func (c *PhaseCounts) count(phase processing.Phase) {
+	switch phase {
+	case processing.Opening:
+		c.Opening++
+	case processing.Middlegame:
+		c.Middlegame++
+	default:
+		c.Endgame++
+	}
+}
+
+// String formats the counts as opening/middlegame/endgame.
+func (c PhaseCounts) String() string {
+	return fmt.Sprintf("%d/%d/%d", c.Opening, c.Middlegame, c.Endgame)
+}
+
+// PlayerStats is one player's record over the games added.
+type PlayerStats struct {
+	Name  string       `json:"name"`
+	Games int          `json:"games"`
+	White ColourRecord `json:"white"`
+	Black ColourRecord `json:"black"`
+	Score float64      `json:"score"` // wins plus half the draws
+
+	// Over finished games against rated opponents; zero when there are none
+	AverageOpponentElo int `json:"averageOpponentElo,omitempty"`
+	Performance        int `json:"performance,omitempty"`
+
+	// Losses whose [%eval] comments show the decisive mistake, by its phase
+	LostIn PhaseCounts `json:"lostIn"`
+
+	ratedGames     int
+	ratedScore     float64
+	opponentEloSum int
+}
+
+// add counts a game towards the player's totals.
+func (ps *PlayerStats) add(score float64, finished bool, opponentElo int) {
+	ps.Games++
+	if !finished {
+		return
+	}
+	ps.Score += score
+	if opponentElo > 0 {
+		ps.ratedGames++
+		ps.ratedScore += score
+		ps.opponentEloSum += opponentElo
+	}
+}
+
+// finish computes the averaged fields. The performance rating uses the
+// linear approximation: average opponent Elo plus 400 times (wins minus
+// losses) per game.
+func (ps *PlayerStats) finish() {
+	if ps.ratedGames == 0 {
+		return
+	}
+	n := float64(ps.ratedGames)
+	ps.AverageOpponentElo = ps.opponentEloSum / ps.ratedGames
+	ps.Performance = ps.AverageOpponentElo + int(400*(2*ps.ratedScore-n)/n)
+}
+
+// Players aggregates per-player statistics, keyed by the names in the
+// White and Black tags.
+// NOT thread-safe: games must be added from a single goroutine.
+type Players struct {
+	byName map[string]*PlayerStats
+}
+
+// NewPlayers creates an empty player statistics collector.
+func NewPlayers() *Players {
+	return &Players{byName: make(map[string]*PlayerStats)}
+}
+
+// Add records a game for both its players. Games without a decisive or
+// drawn result count towards the players' game totals only. A loss with
+// evaluations is counted by the phase of the loser's decisive mistake.
+func (p *Players) Add(game *chess.Game) {
+	score, finished := whiteScore(game.GetTag("Result"))
+	whiteElo, blackElo := parseElo(game.GetTag("WhiteElo")), parseElo(game.GetTag("BlackElo"))
+
+	white := p.player(game.GetTag("White"))
+	white.White.record(score, finished)
+	white.add(score, finished, blackElo)
+
+	black := p.player(game.GetTag("Black"))
+	black.Black.record(1-score, finished)
+	black.add(1-score, finished, whiteElo)
+
+	if mistake, ok := processing.FindDecisiveMistake(game); ok {
+		loser := white
+		if score == 1 {
+			loser = black
+		}
+		loser.LostIn.count(mistake.Phase)
+	}
+}
+
+func (p *Players) player(name string) *PlayerStats {
+	if name == "" {
+		name = "?"
+	}
+	ps, ok := p.byName[name]
+	if !ok {
+		ps = &PlayerStats{Name: name}
+		p.byName[name] = ps
+	}
+	return ps
+}
+
+// Players returns every player's statistics, most games first, then by
+// name.
+func (p *Players) Players() []*PlayerStats {
+	players := make([]*PlayerStats, 0, len(p.byName))
+	for _, ps := range p.byName {
+		ps.finish()
+		players = append(players, ps)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		if players[i].Games != players[j].Games {
+			return players[i].Games > players[j].Games
+		}
+		return players[i].Name < players[j].Name
+	})
+	return players
+}
+
+// Write writes the statistics in the given format: "text", "csv" or
+// "json".
+func (p *Players) Write(w io.Writer, format string) error {
+	switch format {
+	case "text":
+		return p.WriteText(w)
+	case "csv":
+		return p.WriteCSV(w)
+	case "json":
+		return p.WriteJSON(w)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+// WriteText writes the statistics as an aligned table.
+func (p *Players) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "%-30s %6s %11s %11s %6s %7s %5s %11s\n",
+		"Player", "Games", "White +/=/-", "Black +/=/-", "Score", "OppElo", "Perf", "Lost O/M/E"); err != nil {
+		return err
+	}
+	for _, ps := range p.Players() {
+		if _, err := fmt.Fprintf(w, "%-30s %6d %11s %11s %6.1f %7s %5s %11s\n",
+			ps.Name, ps.Games, ps.White, ps.Black, ps.Score,
+			ratingOrBlank(ps.AverageOpponentElo), ratingOrBlank(ps.Performance), ps.LostIn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes the statistics with a header row.
+func (p *Players) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	// Write errors stick to cw and are reported by Error after Flush
+	_ = cw.Write([]string{"player", "games",
+		"white_games", "white_wins", "white_draws", "white_losses",
+		"black_games", "black_wins", "black_draws", "black_losses",
+		"score", "average_opponent_elo", "performance",
+		"lost_in_opening", "lost_in_middlegame", "lost_in_endgame"})
+	for _, ps := range p.Players() {
+		_ = cw.Write([]string{ps.Name, strconv.Itoa(ps.Games),
+			strconv.Itoa(ps.White.Games), strconv.Itoa(ps.White.Wins),
+			strconv.Itoa(ps.White.Draws), strconv.Itoa(ps.White.Losses),
+			strconv.Itoa(ps.Black.Games), strconv.Itoa(ps.Black.Wins),
+			strconv.Itoa(ps.Black.Draws), strconv.Itoa(ps.Black.Losses),
+			strconv.FormatFloat(ps.Score, 'f', 1, 64),
+			ratingOrBlank(ps.AverageOpponentElo), ratingOrBlank(ps.Performance),
+			strconv.Itoa(ps.LostIn.Opening), strconv.Itoa(ps.LostIn.Middlegame), strconv.Itoa(ps.LostIn.Endgame)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the statistics as {"players": [...]}.
+func (p *Players) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Players []*PlayerStats `json:"players"`
+	}{p.Players()})
+}
+
+// whiteScore returns White's score for a result, and whether the game
+// was finished.
+func whiteScore(result string) (float64, bool) {
+	switch result {
+	case "1-0":
+		return 1, true
+	case "0-1":
+		return 0, true
+	case "1/2-1/2":
+		return 0.5, true
+	}
+	return 0, false
+}
+
+// parseElo parses a rating tag, returning 0 for a missing or invalid one.
+func parseElo(s string) int {
+	elo, err := strconv.Atoi(s)
+	if err != nil || elo < 0 {
+		return 0
+	}
+	return elo
+}
+
+func ratingOrBlank(elo int) string {
+	if elo == 0 {
+		return ""
+	}
+	return strconv.Itoa(elo)
+}
@@ -0,0 +1,123 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+	"github.com/lgbarn/pgn-extract-go/internal/testutil"
+)
+
+func game(white, black, result, whiteElo, blackElo string) *chess.Game {
+	g := chess.NewGame()
+	g.Tags = map[string]string{"White": white, "Black": black, "Result": result}
+	if whiteElo != "" {
+		g.Tags["WhiteElo"] = whiteElo
+	}
+	if blackElo != "" {
+		g.Tags["BlackElo"] = blackElo
+	}
+	return g
+}
+
+func testPlayers() *Players {
+	p := NewPlayers()
+	p.Add(game("Carlsen", "Caruana", "1-0", "2850", "2800"))
+	p.Add(game("Caruana", "Carlsen", "1/2-1/2", "2800", "2850"))
+	p.Add(game("Carlsen", "Nakamura", "*", "2850", "2750"))
+	p.Add(game("Nakamura", "Carlsen", "1-0", "", ""))
+	return p
+}
+
+func TestPlayers(t *testing.T) {
+	players := testPlayers().Players()
+	if len(players) != 3 {
+		t.Fatalf("got %d players, want 3", len(players))
+	}
+
+	carlsen := players[0]
+	if carlsen.Name != "Carlsen" || carlsen.Games != 4 {
+		t.Fatalf("first player = %s with %d games, want Carlsen with 4", carlsen.Name, carlsen.Games)
+	}
+	if carlsen.White != (ColourRecord{Games: 2, Wins: 1}) {
+		t.Errorf("Carlsen as White = %+v", carlsen.White)
+	}
+	if carlsen.Black != (ColourRecord{Games: 2, Draws: 1, Losses: 1}) {
+		t.Errorf("Carlsen as Black = %+v", carlsen.Black)
+	}
+	if carlsen.Score != 1.5 {
+		t.Errorf("Carlsen score = %v, want 1.5", carlsen.Score)
+	}
+	// Rated finished games: a win and a draw against 2800
+	if carlsen.AverageOpponentElo != 2800 || carlsen.Performance != 3000 {
+		t.Errorf("Carlsen opponent Elo = %d, performance = %d, want 2800 and 3000",
+			carlsen.AverageOpponentElo, carlsen.Performance)
+	}
+
+	// Nakamura has no finished games against a rated opponent
+	nakamura := players[2]
+	if nakamura.Name != "Nakamura" || nakamura.AverageOpponentElo != 0 || nakamura.Performance != 0 {
+		t.Errorf("Nakamura = %+v, want no rating statistics", nakamura)
+	}
+}
+
+func TestPlayersWrite(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testPlayers().Write(&buf, "text"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[1], "Carlsen") || !strings.Contains(lines[1], "1/0/0       0/1/1") {
+		t.Errorf("text report:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := testPlayers().Write(&buf, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Carlsen,4,2,1,0,0,2,0,1,1,1.5,2800,3000,0,0,0\n") {
+		t.Errorf("csv report:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := testPlayers().Write(&buf, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Players []PlayerStats `json:"players"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Players) != 3 || report.Players[0].Performance != 3000 {
+		t.Errorf("json report:\n%s", buf.String())
+	}
+
+	if err := testPlayers().Write(&buf, "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestPlayersLostIn(t *testing.T) {
+	p := NewPlayers()
+	p.Add(testutil.MustParseGame(t, `[White "Anna"]
+[Black "Ben"]
+[Result "1-0"]
+
+1. e4 {[%eval 0.3]} e5 {[%eval 0.3]} 2. Bc4 {[%eval 0.2]} Nc6 {[%eval 0.2]}
+3. Qh5 {[%eval 0.0]} Nf6 {[%eval #1]} 4. Qxf7# 1-0`))
+	// A loss without evaluations has no decisive mistake to count
+	p.Add(game("Anna", "Ben", "1-0", "", ""))
+
+	for _, ps := range p.Players() {
+		want := PhaseCounts{}
+		if ps.Name == "Ben" {
+			want.Opening = 1
+		}
+		if ps.LostIn != want {
+			t.Errorf("%s lost in %v, want %v", ps.Name, ps.LostIn, want)
+		}
+	}
+}
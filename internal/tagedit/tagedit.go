@@ -0,0 +1,102 @@
+// Package tagedit adds, renames and deletes arbitrary tags of games, for
+// tag edits given on the command line and applied to every game written.
+package tagedit
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+// Editor holds a set of tag edits. The zero value makes no edits.
+type Editor struct {
+	renames []tagPair
+	deletes []string
+	adds    []tagPair
+}
+
+type tagPair struct {
+	name, value string
+}
+
+// Add adds a "Name=Value" edit, setting the tag whether or not the game
+// has it.
+func (e *Editor) Add(spec string) error {
+	name, value, err := splitSpec(spec)
+	if err != nil {
+		return err
+	}
+	e.adds = append(e.adds, tagPair{name, value})
+	return nil
+}
+
+// Delete adds an edit removing the named tag.
+func (e *Editor) Delete(name string) error {
+	if !validName(name) {
+		return fmt.Errorf("invalid tag name %q", name)
+	}
+	e.deletes = append(e.deletes, name)
+	return nil
+}
+
+// Rename adds an "Old=New" edit, moving the value of tag Old to tag New,
+// replacing any value New had. Games without Old are left alone.
+func (e *Editor) Rename(spec string) error {
+	from, to, err := splitSpec(spec)
+	if err != nil {
+		return err
+	}
+	if !validName(to) {
+		return fmt.Errorf("invalid tag name %q", to)
+	}
+	e.renames = append(e.renames, tagPair{from, to})
+	return nil
+}
+
+// Empty reports whether the editor makes no edits.
+func (e *Editor) Empty() bool {
+	return len(e.renames) == 0 && len(e.deletes) == 0 && len(e.adds) == 0
+}
+
+// Apply edits a game's tags: renames first, then deletions, then
+// additions, each in the order given, so that a tag can be renamed away
+// and a new value added under the old name.
+func (e *Editor) Apply(game *chess.Game) {
+	for _, r := range e.renames {
+		if value, ok := game.Tags[r.name]; ok {
+			delete(game.Tags, r.name)
+			game.SetTag(r.value, value)
+		}
+	}
+	for _, name := range e.deletes {
+		delete(game.Tags, name)
+	}
+	for _, a := range e.adds {
+		game.SetTag(a.name, a.value)
+	}
+}
+
+// splitSpec splits "Name=Value" at the first '='.
+func splitSpec(spec string) (name, value string, err error) {
+	name, value, ok := strings.Cut(spec, "=")
+	if !ok {
+		return "", "", fmt.Errorf("%q is not of the form Name=Value", spec)
+	}
+	if !validName(name) {
+		return "", "", fmt.Errorf("invalid tag name %q", name)
+	}
+	return name, value, nil
+}
+
+// validName reports whether s can be written as a PGN tag name: a letter
+// followed by letters, digits and underscores.
+func validName(s string) bool {
+	for i, r := range s {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || i > 0 && (unicode.IsDigit(r) || r == '_')) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,63 @@
+package tagedit
+
+import (
+	"testing"
+
+	"github.com/lgbarn/pgn-extract-go/internal/chess"
+)
+
+func TestApply(t *testing.T) {
+	var e Editor
+	if !e.Empty() {
+		t.Error("zero Editor should be empty")
+	}
+	for _, err := range []error{
+		e.Rename("Source=Origin"),
+		e.Rename("Missing=Other"),
+		e.Delete("WhiteElo"),
+		e.Add("Annotator=me"),
+		e.Add("Source=pgn-extract"),
+		e.Add("Note=a=b"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	game := chess.NewGame()
+	game.Tags = map[string]string{"Source": "TWIC", "WhiteElo": "2700", "Annotator": "old"}
+	e.Apply(game)
+
+	want := map[string]string{"Origin": "TWIC", "Source": "pgn-extract", "Annotator": "me", "Note": "a=b"}
+	if len(game.Tags) != len(want) {
+		t.Errorf("tags = %v, want %v", game.Tags, want)
+	}
+	for name, value := range want {
+		if game.Tags[name] != value {
+			t.Errorf("%s = %q, want %q", name, game.Tags[name], value)
+		}
+	}
+}
+
+func TestInvalidSpecs(t *testing.T) {
+	var e Editor
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"add without =", e.Add("Annotator")},
+		{"add empty name", e.Add("=me")},
+		{"add bad name", e.Add("White Elo=1")},
+		{"delete bad name", e.Delete("1Elo")},
+		{"rename without =", e.Rename("Source")},
+		{"rename bad target", e.Rename("Source=Ori gin")},
+	}
+	for _, tt := range tests {
+		if tt.err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+	if !e.Empty() {
+		t.Error("invalid specs should not add edits")
+	}
+}
@@ -0,0 +1,57 @@
+// Command fakeengine is a minimal UCI engine for tests. It scores every
+// position 0.25 for White when White is to move and 0.40 for Black when
+// Black is to move, and always suggests e2e4. With MultiPV set above 1 it
+// also reports a second line, d2d4 d7d5 at 0.10 for White or d7d5 at 0.30
+// for Black.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	toMove := "w"
+	multiPV := "1"
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "uci":
+			fmt.Println("id name Fake Engine")
+			fmt.Println("uciok")
+		case "setoption":
+			if len(fields) == 5 && fields[2] == "MultiPV" {
+				multiPV = fields[4]
+			}
+		case "isready":
+			fmt.Println("readyok")
+		case "position":
+			if len(fields) > 3 && fields[1] == "fen" {
+				toMove = fields[3]
+			}
+		case "go":
+			fmt.Println("info depth 3 score cp 999 lowerbound")
+			if toMove == "w" {
+				fmt.Println("info depth 3 seldepth 4 score cp 25 nodes 100 pv e2e4 e7e5")
+			} else {
+				fmt.Println("info depth 3 seldepth 4 score cp 40 nodes 100 pv e7e5")
+			}
+			if multiPV != "1" {
+				if toMove == "w" {
+					fmt.Println("info depth 3 multipv 2 score cp 10 pv d2d4 d7d5")
+				} else {
+					fmt.Println("info depth 3 multipv 2 score cp 30 pv d7d5")
+				}
+			}
+			fmt.Println("bestmove e2e4")
+		case "quit":
+			return
+		}
+	}
+}
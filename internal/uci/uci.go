@@ -0,0 +1,326 @@
+// Package uci runs chess engines speaking the Universal Chess Interface
+// protocol, to evaluate and analyse positions.
+package uci
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lgbarn/pgn-extract-go/internal/hashing"
+)
+
+// handshakeTimeout bounds the wait for the engine to answer uci and
+// isready, so that a program that is not a UCI engine is not waited on
+// forever.
+const handshakeTimeout = 10 * time.Second
+
+// ErrEngineExited is returned when the engine stops before answering.
+var ErrEngineExited = errors.New("engine exited")
+
+// Limit bounds a search. With both set the engine stops at whichever
+// comes first; with neither it searches to depth 1.
+type Limit struct {
+	Depth    int
+	MoveTime time.Duration
+}
+
+// Engine is a running UCI engine. It is not safe for concurrent use.
+type Engine struct {
+	Name string // from the engine's "id name", if sent
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan string
+}
+
+// Start launches the engine at path and waits for it to be ready.
+func Start(path string, args ...string) (*Engine, error) {
+	cmd := exec.Command(path, args...) //nolint:gosec,noctx // G204: the engine is user-specified
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	e := &Engine{cmd: cmd, stdin: stdin, lines: make(chan string, 64)}
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			e.lines <- scanner.Text()
+		}
+		close(e.lines)
+	}()
+
+	if err := e.send("uci"); err != nil {
+		_ = e.Close()
+		return nil, err
+	}
+	err = e.readUntil("uciok", handshakeTimeout, func(line string) {
+		if name, ok := strings.CutPrefix(line, "id name "); ok {
+			e.Name = strings.TrimSpace(name)
+		}
+	})
+	if err == nil {
+		err = e.waitReady()
+	}
+	if err != nil {
+		_ = e.Close()
+		return nil, fmt.Errorf("starting %s: %w", path, err)
+	}
+	return e, nil
+}
+
+// SetOption sets an engine option, such as Hash or Threads.
+func (e *Engine) SetOption(name, value string) error {
+	if err := e.send("setoption name " + name + " value " + value); err != nil {
+		return err
+	}
+	return e.waitReady()
+}
+
+// NewGame tells the engine that the following positions are from
+// another game.
+func (e *Engine) NewGame() error {
+	if err := e.send("ucinewgame"); err != nil {
+		return err
+	}
+	return e.waitReady()
+}
+
+// Line is one of the principal variations an engine reports.
+type Line struct {
+	Eval  hashing.Eval // score of the line, from White's point of view
+	Moves []string     // moves of the line in UCI notation
+}
+
+// Evaluate searches the position given as FEN within limit and returns
+// the last score reported for the best line, from White's point of view.
+func (e *Engine) Evaluate(fen string, limit Limit) (hashing.Eval, error) {
+	lines, bestMove, err := e.search(fen, limit)
+	if err != nil {
+		return hashing.Eval{}, err
+	}
+	eval := lines[0].Eval
+	if bestMove != "(none)" {
+		eval.BestMove = bestMove
+	}
+	return eval, nil
+}
+
+// Analyse searches the position given as FEN within limit and returns the
+// last line reported for each of the engine's MultiPV lines, best first.
+// Lines without moves are left out.
+func (e *Engine) Analyse(fen string, limit Limit) ([]Line, error) {
+	lines, _, err := e.search(fen, limit)
+	if err != nil {
+		return nil, err
+	}
+	var analysed []Line
+	for _, line := range lines {
+		if len(line.Moves) > 0 {
+			analysed = append(analysed, line)
+		}
+	}
+	return analysed, nil
+}
+
+// search runs a search and returns the lines reported, indexed by their
+// MultiPV number less one, and the best move. There is always a first
+// line, if only with a zero score.
+func (e *Engine) search(fen string, limit Limit) ([]Line, string, error) {
+	goCmd := "go"
+	if limit.Depth > 0 {
+		goCmd += " depth " + strconv.Itoa(limit.Depth)
+	}
+	if limit.MoveTime > 0 {
+		goCmd += " movetime " + strconv.FormatInt(limit.MoveTime.Milliseconds(), 10)
+	}
+	if goCmd == "go" {
+		goCmd += " depth 1"
+	}
+	if err := e.send("position fen " + fen); err != nil {
+		return nil, "", err
+	}
+	if err := e.send(goCmd); err != nil {
+		return nil, "", err
+	}
+
+	lines := make([]Line, 1)
+	var bestMove string
+	err := e.readUntil("bestmove", 0, func(line string) {
+		if strings.HasPrefix(line, "info ") {
+			lines = parseInfoLine(line, lines)
+		} else if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "bestmove" {
+			bestMove = fields[1]
+		}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Scores are reported for the side to move
+	if fields := strings.Fields(fen); len(fields) > 1 && fields[1] == "b" {
+		for i := range lines {
+			lines[i].Eval.Centipawns, lines[i].Eval.Mate = -lines[i].Eval.Centipawns, -lines[i].Eval.Mate
+		}
+	}
+	return lines, bestMove, nil
+}
+
+// parseInfoLine updates the line an info line reports on, growing lines
+// as needed. Info lines without a multipv field are about the first line.
+func parseInfoLine(info string, lines []Line) []Line {
+	n := multiPV(info)
+	for len(lines) < n {
+		lines = append(lines, Line{})
+	}
+	line := &lines[n-1]
+	if parseInfo(info, &line.Eval) {
+		line.Moves = infoMoves(info)
+	}
+	return lines
+}
+
+// multiPV returns the multipv number of an info line, 1 if it has none.
+func multiPV(info string) int {
+	fields := strings.Fields(info)
+	for i := 1; i < len(fields)-1; i++ {
+		switch fields[i] {
+		case "multipv":
+			if n, err := strconv.Atoi(fields[i+1]); err == nil && n > 0 {
+				return n
+			}
+			return 1
+		case "pv", "string":
+			return 1
+		}
+	}
+	return 1
+}
+
+// infoMoves returns the moves after the pv field of an info line.
+func infoMoves(info string) []string {
+	fields := strings.Fields(info)
+	for i, field := range fields {
+		switch field {
+		case "pv":
+			return fields[i+1:]
+		case "string":
+			return nil
+		}
+	}
+	return nil
+}
+
+// parseInfo takes the depth and score from an info line, reporting whether
+// it had an exact score. Scores that are only bounds are ignored.
+func parseInfo(line string, eval *hashing.Eval) bool {
+	fields := strings.Fields(line)
+	depth, centipawns, mate := eval.Depth, 0, 0
+	scored := false
+	for i := 1; i < len(fields)-1; i++ {
+		switch fields[i] {
+		case "depth":
+			if n, err := strconv.Atoi(fields[i+1]); err == nil {
+				depth = n
+			}
+		case "score":
+			if i+2 >= len(fields) {
+				return false
+			}
+			n, err := strconv.Atoi(fields[i+2])
+			if err != nil {
+				return false
+			}
+			if fields[i+1] == "mate" {
+				mate = n
+			} else {
+				centipawns = n
+			}
+			scored = true
+			if i+3 < len(fields) && (fields[i+3] == "lowerbound" || fields[i+3] == "upperbound") {
+				return false
+			}
+		case "pv", "string":
+			// The rest of the line is moves or free text
+			i = len(fields)
+		}
+	}
+	if scored {
+		eval.Depth, eval.Centipawns, eval.Mate = depth, centipawns, mate
+	}
+	return scored
+}
+
+// Close asks the engine to quit, killing it if it has not within a second.
+func (e *Engine) Close() error {
+	_ = e.send("quit") // the engine may already have exited
+	_ = e.stdin.Close()
+	// Drain the output so that the reading goroutine can finish
+	go func() {
+		for range e.lines {
+		}
+	}()
+	done := make(chan error, 1)
+	go func() { done <- e.cmd.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		_ = e.cmd.Process.Kill()
+		return <-done
+	}
+}
+
+func (e *Engine) send(command string) error {
+	_, err := io.WriteString(e.stdin, command+"\n")
+	return err
+}
+
+// waitReady sends isready and waits for readyok.
+func (e *Engine) waitReady() error {
+	if err := e.send("isready"); err != nil {
+		return err
+	}
+	return e.readUntil("readyok", handshakeTimeout, nil)
+}
+
+// readUntil reads lines up to one starting with prefix, passing each line,
+// that one included, to visit if it is not nil. A timeout of 0 waits for
+// as long as the engine takes.
+func (e *Engine) readUntil(prefix string, timeout time.Duration, visit func(string)) error {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				return ErrEngineExited
+			}
+			if visit != nil {
+				visit(line)
+			}
+			if strings.HasPrefix(line, prefix) {
+				return nil
+			}
+		case <-expired:
+			return fmt.Errorf("no %s from the engine within %v", prefix, timeout)
+		}
+	}
+}
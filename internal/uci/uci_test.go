@@ -0,0 +1,118 @@
+package uci
+
+import (
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lgbarn/pgn-extract-go/internal/hashing"
+)
+
+// buildFakeEngine builds the test engine in testdata/fakeengine.
+func buildFakeEngine(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fakeengine")
+	if runtime.GOOS == "windows" {
+		path += ".exe"
+	}
+	cmd := exec.Command("go", "build", "-o", path, "./testdata/fakeengine") //nolint:gosec,noctx // G204: test builds the engine
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building fake engine: %v\n%s", err, output)
+	}
+	return path
+}
+
+func TestEngineEvaluate(t *testing.T) {
+	engine, err := Start(buildFakeEngine(t))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer engine.Close()
+
+	if engine.Name != "Fake Engine" {
+		t.Errorf("Name = %q", engine.Name)
+	}
+	if err := engine.NewGame(); err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+
+	eval, err := engine.Evaluate("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", Limit{Depth: 3})
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if want := (hashing.Eval{Centipawns: 25, Depth: 3, BestMove: "e2e4"}); eval != want {
+		t.Errorf("Evaluate(white to move) = %+v, want %+v", eval, want)
+	}
+
+	// Black's score is turned to White's point of view
+	eval, err = engine.Evaluate("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", Limit{MoveTime: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if eval.Centipawns != -40 {
+		t.Errorf("Evaluate(black to move) = %+v, want -40 centipawns", eval)
+	}
+}
+
+func TestEngineAnalyse(t *testing.T) {
+	engine, err := Start(buildFakeEngine(t))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer engine.Close()
+
+	if err := engine.SetOption("MultiPV", "2"); err != nil {
+		t.Fatalf("SetOption: %v", err)
+	}
+	lines, err := engine.Analyse("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", Limit{Depth: 3})
+	if err != nil {
+		t.Fatalf("Analyse: %v", err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("Analyse returned %d lines, want 2: %+v", len(lines), lines)
+	}
+	if got := lines[0]; got.Eval.Centipawns != -40 || strings.Join(got.Moves, " ") != "e7e5" {
+		t.Errorf("first line = %+v, want e7e5 at -40", got)
+	}
+	if got := lines[1]; got.Eval.Centipawns != -30 || strings.Join(got.Moves, " ") != "d7d5" {
+		t.Errorf("second line = %+v, want d7d5 at -30", got)
+	}
+
+	// The score of the best line, not the last reported, is the evaluation
+	eval, err := engine.Evaluate("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", Limit{Depth: 3})
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if eval.Centipawns != 25 {
+		t.Errorf("Evaluate with two lines = %+v, want 25 centipawns", eval)
+	}
+}
+
+func TestStartNotAnEngine(t *testing.T) {
+	if _, err := Start(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Start succeeded for a missing program")
+	}
+}
+
+func TestParseInfo(t *testing.T) {
+	tests := []struct {
+		line string
+		want hashing.Eval
+	}{
+		{"info depth 12 seldepth 20 multipv 1 score cp -35 nodes 1000 pv e7e5", hashing.Eval{Centipawns: -35, Depth: 12}},
+		{"info depth 20 score mate -3 pv h7h8", hashing.Eval{Mate: -3, Depth: 20}},
+		{"info depth 8 score cp 500 lowerbound", hashing.Eval{Centipawns: 10, Depth: 5}},
+		{"info string score cp 77", hashing.Eval{Centipawns: 10, Depth: 5}},
+		{"info currmove e2e4 currmovenumber 1", hashing.Eval{Centipawns: 10, Depth: 5}},
+	}
+	for _, tt := range tests {
+		eval := hashing.Eval{Centipawns: 10, Depth: 5}
+		parseInfo(tt.line, &eval)
+		if eval != tt.want {
+			t.Errorf("parseInfo(%q) = %+v, want %+v", tt.line, eval, tt.want)
+		}
+	}
+}
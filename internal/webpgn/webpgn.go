@@ -0,0 +1,160 @@
+// Package webpgn pulls PGN games out of web pages and Markdown notes, so
+// that scraped articles and blog posts can be read like PGN files.
+package webpgn
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	// tagLine is a PGN tag pair on a line of its own
+	tagLine = regexp.MustCompile(`^\s*\[[A-Za-z0-9_]+\s+"(?:[^"\\]|\\.)*"\s*\]\s*$`)
+	// resultEnd is a game result ending a line of movetext
+	resultEnd = regexp.MustCompile(`(?:^|\s)(?:1-0|0-1|1/2-1/2|\*)\s*$`)
+	// firstMove is movetext starting at move 1, for code blocks without tags
+	firstMove = regexp.MustCompile(`(?m)^\s*1\.\s*\S`)
+
+	htmlBlock     = regexp.MustCompile(`(?is)<(pre|textarea)\b[^>]*>(.*?)</(?:pre|textarea)\s*>`)
+	htmlScript    = regexp.MustCompile(`(?is)<(script|style)\b[^>]*>.*?</(?:script|style)\s*>`)
+	htmlBreak     = regexp.MustCompile(`(?i)<br\s*/?>|</(?:p|div|li|h[1-6]|tr|blockquote)\s*>`)
+	htmlTag       = regexp.MustCompile(`<[^>]*>`)
+	markdownFence = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+)
+
+// Extract reads a page in the given format, "html" or "markdown", and
+// returns the PGN text of the games found in it, separated by blank lines.
+func Extract(r io.Reader, format string) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "html":
+		return []byte(HTML(string(data))), nil
+	case "markdown":
+		return []byte(Markdown(string(data))), nil
+	}
+	return nil, fmt.Errorf("unknown page format %q", format)
+}
+
+// HTML returns the games in an HTML page: the contents of <pre> and
+// <textarea> elements that look like PGN, and games in the page's text
+// that start with a tag pair.
+func HTML(page string) string {
+	page = htmlScript.ReplaceAllString(page, "")
+
+	var sb strings.Builder
+	last := 0
+	for _, m := range htmlBlock.FindAllStringSubmatchIndex(page, -1) {
+		findGames(&sb, htmlText(page[last:m[0]]))
+		addBlock(&sb, htmlText(page[m[4]:m[5]]))
+		last = m[1]
+	}
+	findGames(&sb, htmlText(page[last:]))
+	return sb.String()
+}
+
+// htmlText converts HTML to plain text, ending a line at each line break
+// and block element.
+func htmlText(s string) string {
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	return strings.ReplaceAll(html.UnescapeString(s), "\u00a0", " ")
+}
+
+// Markdown returns the games in a Markdown document: the contents of code
+// fences that look like PGN, and games in the text that start with a tag
+// pair.
+func Markdown(doc string) string {
+	var sb strings.Builder
+	var text, block []string
+	fence := ""
+	for _, line := range strings.Split(strings.ReplaceAll(doc, "\r\n", "\n"), "\n") {
+		m := markdownFence.FindStringSubmatch(line)
+		switch {
+		case fence == "" && m != nil:
+			findGames(&sb, strings.Join(text, "\n"))
+			text, fence = nil, m[1]
+		case fence != "" && m != nil && m[1][0] == fence[0] && len(m[1]) >= len(fence) &&
+			strings.TrimSpace(line[len(m[0]):]) == "":
+			addBlock(&sb, strings.Join(block, "\n"))
+			block, fence = nil, ""
+		case fence != "":
+			block = append(block, line)
+		default:
+			text = append(text, line)
+		}
+	}
+	// An unclosed fence runs to the end of the document
+	addBlock(&sb, strings.Join(block, "\n"))
+	findGames(&sb, strings.Join(text, "\n"))
+	return sb.String()
+}
+
+// addBlock writes a code block if it looks like PGN: it has a tag pair or
+// movetext starting at move 1.
+func addBlock(sb *strings.Builder, block string) {
+	block = strings.TrimSpace(block)
+	if block == "" {
+		return
+	}
+	for _, line := range strings.Split(block, "\n") {
+		if tagLine.MatchString(line) {
+			writeGame(sb, block)
+			return
+		}
+	}
+	if firstMove.MatchString(block) {
+		writeGame(sb, block)
+	}
+}
+
+// findGames writes the games in running text. A game starts with a tag
+// pair line, takes the tag pairs and movetext that follow, and ends at a
+// result, at a blank line after its movetext or at the next game's tags.
+func findGames(sb *strings.Builder, text string) {
+	var game []string
+	inMoves := false
+	flush := func() {
+		if len(game) > 0 {
+			writeGame(sb, strings.Join(game, "\n"))
+		}
+		game, inMoves = nil, false
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		isTag := tagLine.MatchString(line)
+		switch {
+		case isTag && (game == nil || inMoves):
+			flush()
+			game = []string{strings.TrimSpace(line)}
+		case game == nil:
+		case isTag:
+			game = append(game, strings.TrimSpace(line))
+		case strings.TrimSpace(line) == "":
+			if inMoves {
+				flush()
+			}
+		default:
+			if !inMoves {
+				game = append(game, "")
+				inMoves = true
+			}
+			game = append(game, strings.TrimSpace(line))
+			if resultEnd.MatchString(line) {
+				flush()
+			}
+		}
+	}
+	flush()
+}
+
+func writeGame(sb *strings.Builder, game string) {
+	sb.WriteString(game)
+	sb.WriteString("\n\n")
+}
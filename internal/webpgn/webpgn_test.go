@@ -0,0 +1,84 @@
+package webpgn
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	page := `<html><head><style>pre { color: red }</style>
+<script>var pgn = '[Event "Script"]';</script></head>
+<body>
+<p>A famous game:</p>
+<pre class="pgn"><code>[Event "Opera Game"]
+[White "Morphy, Paul"]
+[Black "Duke &amp; Count"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 d6 1-0</code></pre>
+<pre>def not_pgn(): pass</pre>
+<p>[Event "Inline"]<br>
+[Result "*"]<br>
+<br>
+1. d4 d5 *</p>
+<p>Thanks for reading.</p>
+</body></html>`
+
+	got := HTML(page)
+	want := `[Event "Opera Game"]
+[White "Morphy, Paul"]
+[Black "Duke & Count"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 d6 1-0
+
+[Event "Inline"]
+[Result "*"]
+
+1. d4 d5 *
+
+`
+	if got != want {
+		t.Errorf("HTML() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	doc := "# Notes\n\n" +
+		"```pgn\n1. e4 c5 2. Nf3 *\n```\n\n" +
+		"```go\nfmt.Println(\"[not a game]\")\n```\n\n" +
+		"Played online:\n\n" +
+		"[Event \"Blitz\"]\n[Result \"0-1\"]\n\n1. f3 e5 2. g4 Qh4# 0-1\n" +
+		"That was quick.\n\n" +
+		"~~~~\n[Event \"Unclosed\"]\n"
+
+	got := Markdown(doc)
+	games := strings.Split(strings.TrimSpace(got), "\n\n")
+	want := []string{
+		"1. e4 c5 2. Nf3 *",
+		"[Event \"Blitz\"]\n[Result \"0-1\"]",
+		"1. f3 e5 2. g4 Qh4# 0-1",
+		"[Event \"Unclosed\"]",
+	}
+	if len(games) != len(want) {
+		t.Fatalf("Markdown() =\n%s", got)
+	}
+	for i := range want {
+		if games[i] != want[i] {
+			t.Errorf("part %d = %q, want %q", i, games[i], want[i])
+		}
+	}
+	if strings.Contains(got, "quick") || strings.Contains(got, "not a game") {
+		t.Errorf("prose or code leaked into the games:\n%s", got)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	got, err := Extract(strings.NewReader("<pre>1. e4 *</pre>"), "html")
+	if err != nil || string(got) != "1. e4 *\n\n" {
+		t.Errorf("Extract(html) = %q, %v", got, err)
+	}
+	if _, err := Extract(strings.NewReader(""), "pdf"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
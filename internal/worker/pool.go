@@ -2,6 +2,7 @@
 package worker
 
 import (
+	"bytes"
 	"sync"
 	"sync/atomic"
 
@@ -19,10 +20,12 @@ type ProcessResult struct {
 	Game         *chess.Game
 	Index        int
 	Matched      bool
-	Board        *chess.Board // Final board position (may be nil)
-	GameInfo     interface{}  // Opaque analysis payload; typed by consumer
-	ShouldOutput bool         // Whether to output this game
-	OutputToDup  bool         // Whether to output to duplicate file
+	Board        *chess.Board  // Final board position (may be nil)
+	GameInfo     interface{}   // Opaque analysis payload; typed by consumer
+	ShouldOutput bool          // Whether to output this game
+	OutputToDup  bool          // Whether to output to duplicate file
+	AlsoMatched  bool          // Whether a second filter set matched
+	Output       *bytes.Buffer // Game text rendered by the worker, nil if left to the consumer
 	Error        error
 }
 